@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The access log has a line per request in the common or combined log
+// format of Apache (followed by the latency in seconds) or as JSON.
+var (
+	accessLog       = flag.String("access-log", "", "file the access log is appended to, '-' for stdout (empty disables it)")
+	accessLogFormat = flag.String("access-log-format", "combined", "format of the access log: 'common', 'combined' or 'json'")
+)
+
+const AccessTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+type accessKey struct{}
+
+// accessInfo collects what inner handlers know about a request, like the
+// user authenticated by them.
+type accessInfo struct {
+	user string
+}
+
+// accessEntry is a line of the access log.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Size      int64     `json:"size"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Latency   float64   `json:"latency"` // in seconds
+	RequestID string    `json:"requestID,omitempty"`
+}
+
+// format returns e as line of the access log in format.
+func (e *accessEntry) format(format string) []byte {
+	if format == "json" {
+		b, _ := json.Marshal(e)
+		return append(b, '\n')
+	}
+	host := e.Remote
+	if h, _, err := net.SplitHostPort(e.Remote); err == nil {
+		host = h
+	}
+	user := e.User
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if e.Size > 0 {
+		size = strconv.FormatInt(e.Size, 10)
+	}
+	line := fmt.Sprintf("%s - %s [%s] %s %d %s", host, user, e.Time.Format(AccessTimeFormat),
+		strconv.Quote(e.Method+" "+e.URI+" "+e.Proto), e.Status, size)
+	if format == "combined" {
+		line += " " + quoteOrDash(e.Referer) + " " + quoteOrDash(e.UserAgent)
+	}
+	return []byte(line + " " + strconv.FormatFloat(e.Latency, 'f', 3, 64) + "\n")
+}
+
+func quoteOrDash(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+var (
+	accessOut   io.Writer // nil: no access log
+	accessMutex sync.Mutex
+)
+
+func initAccessLog() {
+	switch *accessLogFormat {
+	case "common", "combined", "json":
+	default:
+		fatal("Unknown access log format", "format", *accessLogFormat)
+	}
+	switch *accessLog {
+	case "":
+	case "-":
+		accessOut = os.Stdout
+	default:
+		f, err := os.OpenFile(*accessLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			fatal("Unable to open access log", "file", *accessLog, "err", err)
+		}
+		accessOut = f
+	}
+}
+
+// accessLogHandler wraps h to write a line per request to the access log.
+func accessLogHandler(h http.Handler) http.Handler {
+	if accessOut == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &accessInfo{}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessKey{}, info)))
+		e := &accessEntry{
+			Time: start, Remote: r.RemoteAddr, User: info.user,
+			Method: r.Method, URI: r.RequestURI, Proto: r.Proto,
+			Status: rec.status, Size: rec.size,
+			Referer: r.Referer(), UserAgent: r.UserAgent(),
+			Latency: time.Since(start).Seconds(), RequestID: requestID(r.Context()),
+		}
+		accessMutex.Lock()
+		defer accessMutex.Unlock()
+		if _, err := accessOut.Write(e.format(*accessLogFormat)); err != nil {
+			logger(r.Context()).Error("Unable to write access log", "err", err)
+		}
+	})
+}
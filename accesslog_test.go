@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	e := &accessEntry{
+		Time: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), Remote: "192.0.2.1:4711", User: "alice",
+		Method: "GET", URI: "/view/docs", Proto: "HTTP/1.1", Status: 200, Size: 512,
+		Referer: "https://example.com/", UserAgent: `curl "8"`, Latency: 0.0123, RequestID: "abc",
+	}
+	for i, this := range []struct {
+		format string
+		expect string
+	}{
+		{"common", `192.0.2.1 - alice [01/Mar/2024:12:30:00 +0000] "GET /view/docs HTTP/1.1" 200 512 0.012` + "\n"},
+		{"combined", `192.0.2.1 - alice [01/Mar/2024:12:30:00 +0000] "GET /view/docs HTTP/1.1" 200 512 "https://example.com/" "curl \"8\"" 0.012` + "\n"},
+		{"json", `{"time":"2024-03-01T12:30:00Z","remote":"192.0.2.1:4711","user":"alice","method":"GET","uri":"/view/docs","proto":"HTTP/1.1","status":200,"size":512,"referer":"https://example.com/","userAgent":"curl \"8\"","latency":0.0123,"requestID":"abc"}` + "\n"},
+	} {
+		if got := string(e.format(this.format)); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+
+	var out strings.Builder
+	accessOut = &out
+	defer func() { accessOut = nil }()
+	h := accessLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		withUser(r, "bob")
+		http.NotFound(w, r)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/view/missing", nil))
+	if got := out.String(); !strings.HasPrefix(got, "192.0.2.1 - bob [") || !strings.Contains(got, `"GET /view/missing HTTP/1.1" 404 19 "-" "-"`) {
+		t.Errorf("got access log %q", got)
+	}
+}
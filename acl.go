@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An ACL file restricts who may view and edit sections; the last matching
+// rule wins and pages without one are open to everybody:
+//
+//	# pattern   view=who,...  edit=who,...
+//	internal/** view=@users   edit=@staff
+//	hr/         view=@hr,carol
+//
+// Patterns are those of the owners file. "*" is everybody, "@users" every
+// logged in user and other groups come from the users file or the owners
+// file. A missing view or edit list doesn't restrict it, but only those
+// who may view a page may edit it. The rules are enforced before the
+// handlers of pages, their attachments and the page API run; listings,
+// feeds and reports only contain the pages the user may view.
+var aclFile = flag.String("acl-file", "./gwiki-acl", "file restricting who may view and edit sections")
+
+// UsersGroup contains all logged in users.
+const UsersGroup = "@users"
+
+type aclRule struct {
+	pattern    string
+	re         *regexp.Regexp
+	view, edit []string // nil: everybody
+}
+
+type aclTable struct {
+	mutex   sync.Mutex
+	modTime time.Time
+	rules   []aclRule
+}
+
+var acls = &aclTable{}
+
+func parseACL(sc *bufio.Scanner) ([]aclRule, error) {
+	var rules []aclRule
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fs := strings.Fields(line)
+		if len(fs) == 0 {
+			continue
+		}
+		re, err := ownerPattern(fs[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		rule := aclRule{pattern: fs[0], re: re}
+		for _, f := range fs[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			who := strings.Split(v, ",")
+			switch k {
+			case "view":
+				rule.view = who
+			case "edit":
+				rule.edit = who
+			default:
+				return nil, fmt.Errorf("line %d: expected 'view=' or 'edit=' but got '%s'", n, f)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
+
+// load (re)reads the ACL file if it changed.
+func (at *aclTable) load() {
+	fi, err := os.Stat(*aclFile)
+	if err != nil {
+		at.rules, at.modTime = nil, time.Time{}
+		return
+	}
+	if fi.ModTime().Equal(at.modTime) {
+		return
+	}
+	f, err := os.Open(*aclFile)
+	if err != nil {
+		slog.Error("Unable to read ACL file", "file", *aclFile, "err", err)
+		return
+	}
+	defer f.Close()
+	rules, err := parseACL(bufio.NewScanner(f))
+	if err != nil {
+		slog.Error("Unable to parse ACL file", "file", *aclFile, "err", err)
+		return
+	}
+	at.rules, at.modTime = rules, fi.ModTime()
+}
+
+// rule returns the last rule matching path or nil.
+func (at *aclTable) rule(path string) *aclRule {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+	at.load()
+	for i := len(at.rules) - 1; i >= 0; i-- {
+		if at.rules[i].re.MatchString(path) {
+			return &at.rules[i]
+		}
+	}
+	return nil
+}
+
+// isMember reports whether user is one of who.
+func isMember(user string, who []string) bool {
+	var groups []string
+	for _, w := range who {
+		switch {
+		case w == "*":
+			return true
+		case w == UsersGroup:
+			if user != "anonymous" {
+				return true
+			}
+		case strings.HasPrefix(w, "@"):
+			if user == "anonymous" {
+				continue
+			}
+			if groups == nil {
+				groups = users.Groups(user)
+			}
+			if contains(groups, w) || contains(owners.Group(w), user) {
+				return true
+			}
+		case w == user && user != "anonymous":
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether user may view (or edit) the page at path.
+func (at *aclTable) Allowed(user, path string, edit bool) bool {
+	rule := at.rule(path)
+	if rule == nil {
+		return true
+	}
+	if rule.view != nil && !isMember(user, rule.view) {
+		return false
+	}
+	return !edit || rule.edit == nil || isMember(user, rule.edit)
+}
+
+// mayView reports whether the user of r may view the page at path. A nil
+// r is an anonymous reader (e.g. of the static build).
+func mayView(r *http.Request, path string) bool {
+	if r == nil {
+		return acls.Allowed("anonymous", path, false)
+	}
+	return acls.Allowed(currentUser(r), path, false) && tokenAllows(r, path)
+}
+
+// visibleInfos returns the pages of infos the user of r may view. Every
+// listing is filtered with it since the ACL handler only protects the
+// pages addressed by URL.
+func visibleInfos(r *http.Request, infos []*PageInfo) []*PageInfo {
+	var visible []*PageInfo
+	for _, info := range infos {
+		if mayView(r, info.Path) {
+			visible = append(visible, info)
+		}
+	}
+	return visible
+}
+
+// aclPath returns the page (or attachment) path of the request r and
+// whether it is a change.
+func aclPath(r *http.Request) (string, bool) {
+	p := r.URL.Path
+	if m := validPath.FindStringSubmatch(p); m != nil {
+		return m[2], m[1] != "view" && m[1] != "diff" || !isSafeMethod(r.Method)
+	}
+	for _, prefix := range []string{"/files/", "/api/v1/canonical/"} {
+		if strings.HasPrefix(p, prefix) {
+			return strings.Trim(strings.TrimPrefix(p, prefix), "/"), !isSafeMethod(r.Method)
+		}
+	}
+	// /export/<format>/<path>
+	if rest, ok := strings.CutPrefix(p, PandocPath); ok {
+		if _, path, ok := strings.Cut(rest, "/"); ok {
+			return strings.Trim(path, "/"), !isSafeMethod(r.Method)
+		}
+	}
+	return "", false
+}
+
+// aclHandler enforces the ACL file for the pages addressed by URL. Users
+// that aren't logged in are asked to.
+func aclHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, edit := aclPath(r)
+		user := currentUser(r)
+		if path == "" || acls.Allowed(user, path, edit) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		logger(r.Context()).Info("Access denied by ACL", "path", path, "edit", edit)
+		denyAccess(w, r)
+	})
+}
+
+// denyAccess refuses the request r. Users that aren't logged in are asked
+// to.
+func denyAccess(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case currentUser(r) != "anonymous":
+		http.Error(w, "access denied", http.StatusForbidden)
+	case oauthConfig != nil && r.Method == http.MethodGet:
+		http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	case *usersFile != "":
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", *authRealm))
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+	default:
+		http.Error(w, "access denied", http.StatusForbidden)
+	}
+}
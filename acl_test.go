@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestACLHandler(t *testing.T) {
+	h, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "gwiki-acl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"users": "alice:" + string(h) + ":staff\nbob:" + string(h) + "\n",
+		"acl":   "# internal pages\ninternal/** view=@users edit=@staff\ninternal/hr view=carol,@staff\n",
+	}
+	for fn, s := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, fn), []byte(s), 0600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	defer func(u, a string) { *usersFile, *aclFile = u, a }(*usersFile, *aclFile)
+	*usersFile, *aclFile = filepath.Join(dir, "users"), filepath.Join(dir, "acl")
+	users, acls = &userTable{}, &aclTable{}
+
+	handler := aclHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, this := range []struct {
+		method, url, user string
+		expect            int
+	}{
+		{"GET", "/view/index", "", http.StatusOK},
+		{"GET", "/view/internal/plan", "", http.StatusUnauthorized},
+		{"GET", "/view/internal/plan", "bob", http.StatusOK},
+		{"GET", "/edit/internal/plan", "bob", http.StatusForbidden},
+		{"POST", "/save/internal/plan", "bob", http.StatusForbidden},
+		{"GET", "/edit/internal/plan", "alice", http.StatusOK},
+		{"GET", "/view/internal/hr", "bob", http.StatusForbidden},
+		{"GET", "/view/internal/hr/salaries", "alice", http.StatusOK},
+		{"GET", "/edit/internal/hr", "carol", http.StatusOK},
+		{"GET", "/files/internal/plan.png", "", http.StatusUnauthorized},
+		{"GET", "/api/v1/canonical/internal/plan", "bob", http.StatusOK},
+		{"GET", "/list/internal", "", http.StatusOK},
+	} {
+		r := httptest.NewRequest(this.method, this.url, nil)
+		if this.user != "" {
+			r = withUser(r, this.user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != this.expect {
+			t.Errorf("[%d] got %d for %s %s as %q but expected %d", i, w.Code, this.method, this.url, this.user, this.expect)
+		}
+	}
+}
+
+func TestACLListings(t *testing.T) {
+	testSetup(t)
+	dir, err := ioutil.TempDir("", "gwiki-acl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err = os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = ioutil.WriteFile("acl", []byte("secret/** view=alice\ndocs/hidden view=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(a, rd, sd string) { *aclFile, *reviewsDir, *snapshotDir = a, rd, sd }(*aclFile, *reviewsDir, *snapshotDir)
+	*aclFile, *reviewsDir, *snapshotDir = filepath.Join(dir, "acl"), dir, dir
+	acls = &aclTable{}
+	defer func() { acls = &aclTable{} }()
+
+	r := withUser(httptest.NewRequest("POST", "/save/secret/plan", nil), "alice")
+	for _, this := range []struct{ path, body string }{
+		{"public", "nothing secret"},
+		{"secret/plan", "[public](public) and [missing](secret/missing)"},
+		{"docs/_index", "Docs"},
+		{"docs/open", "open"},
+		{"docs/hidden", "hidden"},
+	} {
+		p := NewPage(this.path)
+		p.Body = []byte(this.body)
+		if this.path == "secret/plan" {
+			p.SetTitle("Plan")
+			p.SetTags("hidden")
+		}
+		if err = storePage(r, p, NewPage(this.path), ""); err != nil {
+			t.Fatalf("unable to store %s: %s", this.path, err)
+		}
+	}
+	rv := &Review{ID: "1", Path: "secret/plan", User: "alice", Status: "pending"}
+	if err = writeJSONFile(reviewFile(rv.ID), rv); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rep := &SnapshotReport{ID: "20240101-000000", Changes: []PageChange{{Path: "secret/plan", Kind: "added"}}}
+	if err = writeJSONFile(filepath.Join(dir, rep.ID+".json"), rep); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i, this := range []struct {
+		handler     http.HandlerFunc
+		url, hidden string
+	}{
+		{listHandler, "/list/", "secret/plan"},
+		{treeHandler, "/api/v1/tree", "secret/plan"},
+		{graphHandler, "/api/v1/graph", "secret/plan"},
+		{bookHandler, "/api/v1/book", "secret/plan"},
+		{tagsHandler, "/tags/", "hidden"},
+		{tagsHandler, "/tags/hidden", "secret/plan"},
+		{tagSuggestHandler, "/api/v1/tags?q=hid", "hidden"},
+		{activityFeedHandler, "/activity.atom", "secret/plan"},
+		{activityHandler, "/api/v1/activity", "secret/plan"},
+		{linkReportHandler, "/report/links?format=json", "secret/plan"},
+		{qualityReportHandler, "/report/quality?format=json", "secret/plan"},
+		{snapshotsHandler, "/report/snapshots?format=json", "secret/plan"},
+		{auditHandler, "/api/v1/audit", "secret/plan"},
+		{reviewsHandler, "/reviews", "secret/plan"},
+		{makeHandler(viewHandler), "/view/public", "secret/plan"},
+		{makeHandler(viewHandler), "/view/docs/_index", "docs/hidden"},
+	} {
+		for _, user := range []string{"anonymous", "alice"} {
+			w := httptest.NewRecorder()
+			this.handler(w, withUser(httptest.NewRequest("GET", this.url, nil), user))
+			if got := strings.Contains(w.Body.String(), this.hidden); got != (user == "alice") {
+				t.Errorf("[%d] %s as %s: got %q in the response %t:\n%s", i, this.url, user, this.hidden, got, w.Body)
+			}
+		}
+	}
+}
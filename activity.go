@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ActivityDefaultLimit = 50
+	ActivityMaxLimit     = 1000
+)
+
+// activityActions are the audit log actions shown in the activity stream.
+// Logins, backups, shares and theme changes are left out.
+var activityActions = map[string]bool{
+	"save": true, "rename": true, "rename-tag": true, "upload": true, "restore-attachment": true,
+	"publish": true, "request-review": true, "approve-review": true, "reject-review": true,
+}
+
+// Activity is an entry of the activity stream, taken from the audit log.
+type Activity struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Action  string    `json:"action"`
+	Path    string    `json:"path,omitempty"`
+	From    string    `json:"from,omitempty"` // old path of renamed pages
+	Title   string    `json:"title,omitempty"`
+	Summary string    `json:"summary,omitempty"`
+}
+
+// inSection reports whether path is section or below it.
+func inSection(path, section string) bool {
+	return section == "" || path == section || strings.HasPrefix(path, section+"/")
+}
+
+// activities returns the activity of section ("" for all) the user of r
+// may view newest first, without drafts unless drafts is set.
+func activities(r *http.Request, section string, drafts bool) ([]*Activity, error) {
+	es, err := readAudit(&auditFilter{})
+	if err != nil {
+		return nil, err
+	}
+	section = strings.Trim(section, "/")
+	as := []*Activity{}
+	for _, e := range es {
+		if !activityActions[e.Action] {
+			continue
+		}
+		a := &Activity{Time: e.Time, User: e.User, Action: e.Action, Path: e.Path, Summary: e.Summary}
+		if e.Action == "rename" {
+			if i := strings.Index(e.Path, " -> "); i >= 0 {
+				a.From, a.Path = e.Path[:i], e.Path[i+4:]
+			}
+		}
+		if section != "" && !inSection(a.Path, section) && (a.From == "" || !inSection(a.From, section)) {
+			continue
+		}
+		if a.Path != "" && !mayView(r, a.Path) || a.From != "" && !mayView(r, a.From) {
+			continue
+		}
+		if info, ok := index.Get(a.Path); ok {
+			if info.Draft && !drafts {
+				continue
+			}
+			a.Title = info.Title
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// activityHandler serves the activity stream as JSON
+// (/api/v1/activity?section=&offset=&limit=&drafts=true).
+func activityHandler(w http.ResponseWriter, r *http.Request) {
+	as, err := activities(r, r.FormValue("section"), r.FormValue("drafts") == "true")
+	if err != nil {
+		logger(r.Context()).Error("Unable to read the activity", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pg := paginate(r, len(as), ActivityDefaultLimit, ActivityMaxLimit)
+	start, end := pg.Bounds()
+	writeJSON(w, map[string]interface{}{"total": pg.Total, "offset": pg.Offset, "limit": pg.Limit, "entries": as[start:end]})
+}
+
+// activityTitle describes a for feed readers, e.g. "alice saved docs/intro".
+func activityTitle(a *Activity) string {
+	what := a.Path
+	if a.Title != "" {
+		what = a.Title
+	}
+	switch a.Action {
+	case "save":
+		return fmt.Sprintf("%s saved %s", a.User, what)
+	case "rename":
+		return fmt.Sprintf("%s renamed %s to %s", a.User, a.From, a.Path)
+	case "upload", "restore-attachment":
+		return fmt.Sprintf("%s uploaded %s", a.User, a.Path)
+	case "publish":
+		return fmt.Sprintf("%s published the site", a.User)
+	}
+	return fmt.Sprintf("%s: %s %s", a.User, a.Action, what)
+}
+
+// activityFeedHandler serves the activity stream as Atom feed
+// (/activity.atom?section=&drafts=true) with the latest entries.
+func activityFeedHandler(w http.ResponseWriter, r *http.Request) {
+	section := strings.Trim(r.FormValue("section"), "/")
+	as, err := activities(r, section, r.FormValue("drafts") == "true")
+	if err != nil {
+		logger(r.Context()).Error("Unable to read the activity", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(as) > ActivityDefaultLimit {
+		as = as[:ActivityDefaultLimit]
+	}
+	base := baseURL(r)
+	f := &atomFeed{
+		ID:      base + r.URL.RequestURI(),
+		Title:   "Activity",
+		Updated: atomTime(time.Now()),
+		Links:   []atomLink{{Rel: "self", Href: base + r.URL.RequestURI()}},
+	}
+	if site.Title != "" {
+		f.Title = site.Title + ": " + f.Title
+	}
+	if section != "" {
+		f.Title += " in " + section
+	}
+	if len(as) > 0 {
+		f.Updated = atomTime(as[0].Time)
+	}
+	for _, a := range as {
+		e := atomEntry{
+			ID:      fmt.Sprintf("%s/activity/%d/%s/%s", base, a.Time.UnixNano(), a.Action, a.Path),
+			Title:   activityTitle(a),
+			Updated: atomTime(a.Time),
+			Author:  &atomAuthor{Name: a.User},
+			Summary: a.Summary,
+		}
+		if a.Path != "" && a.Action != "upload" && a.Action != "restore-attachment" {
+			e.Links = []atomLink{{Href: base + "/view/" + a.Path}}
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	writeAtom(w, f)
+}
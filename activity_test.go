@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivity(t *testing.T) {
+	for i, this := range []struct {
+		path, section string
+		expect        bool
+	}{
+		{"docs/intro", "", true},
+		{"docs/intro", "docs", true},
+		{"docs", "docs", true},
+		{"docs-old/intro", "docs", false},
+		{"blog/post", "docs", false},
+	} {
+		if got := inSection(this.path, this.section); got != this.expect {
+			t.Errorf("[%d] got %t but expected %t", i, got, this.expect)
+		}
+	}
+	for i, this := range []struct {
+		a      *Activity
+		expect string
+	}{
+		{&Activity{User: "alice", Action: "save", Path: "docs/intro", Title: "Intro"}, "alice saved Intro"},
+		{&Activity{User: "alice", Action: "save", Path: "docs/intro"}, "alice saved docs/intro"},
+		{&Activity{User: "bob", Action: "rename", From: "a", Path: "b"}, "bob renamed a to b"},
+		{&Activity{User: "bob", Action: "upload", Path: "docs/chart.png"}, "bob uploaded docs/chart.png"},
+		{&Activity{User: "bob", Action: "publish"}, "bob published the site"},
+		{&Activity{User: "eve", Action: "approve-review", Path: "docs/intro"}, "eve: approve-review docs/intro"},
+	} {
+		if got := activityTitle(this.a); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	writeAtom(w, &atomFeed{ID: "http://wiki/activity.atom", Title: "A & B", Updated: atomTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+		Entries: []atomEntry{{ID: "x", Title: "alice saved <Intro>", Updated: "2024-01-02T03:04:05Z", Author: &atomAuthor{Name: "alice"}}}})
+	for _, expect := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<title>A &amp; B</title><updated>2024-01-02T03:04:05Z</updated>`,
+		`<entry><id>x</id><title>alice saved &lt;Intro&gt;</title><updated>2024-01-02T03:04:05Z</updated><author><name>alice</name></author></entry>`,
+	} {
+		if !strings.Contains(w.Body.String(), expect) {
+			t.Errorf("expected %q in\n%s", expect, w.Body.String())
+		}
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+		t.Errorf("got content type %q", ct)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+)
+
+// The pages below /admin/ (themes, backups, imports, publishing, mails and
+// marks) are only for admins. Without -admins the editors are admins, but
+// users that aren't logged in never are once there are logins.
+var admins = flag.String("admins", "", "comma separated users and @groups (of the owners file) that may use the /admin/ pages (empty: the editors)")
+
+const AdminPrefix = "/admin/"
+
+// adminExempt are the pages below /admin/ every user may use since they
+// only show the user's own data.
+var adminExempt = []string{"/admin/tokens"}
+
+// hasLogins reports whether users can log in.
+func hasLogins() bool {
+	return *usersFile != "" || oauthConfig != nil
+}
+
+// isAdmin reports whether the user of r may use the /admin/ pages.
+func isAdmin(r *http.Request) bool {
+	user := currentUser(r)
+	if *admins != "" {
+		return user != "anonymous" && isListed(user, *admins)
+	}
+	return isEditor(r) && (user != "anonymous" || !hasLogins())
+}
+
+// adminHandler refuses the /admin/ pages to everybody but admins.
+func adminHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, AdminPrefix) || hasAnyPrefix(r.URL.Path, adminExempt) || isAdmin(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		logger(r.Context()).Info("Access denied to admin page", "path", r.URL.Path)
+		denyAccess(w, r)
+	})
+}
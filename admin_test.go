@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	defer func(a, e, u string) { *admins, *editors, *usersFile = a, e, u }(*admins, *editors, *usersFile)
+	handler := adminHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, this := range []struct {
+		admins, editors, users string
+		url, user              string
+		expect                 int
+	}{
+		{"", "", "", "/admin/backup", "", http.StatusOK},
+		{"", "", "users", "/admin/backup", "", http.StatusUnauthorized},
+		{"", "", "users", "/admin/backup", "bob", http.StatusOK},
+		{"", "alice", "users", "/admin/backup", "bob", http.StatusForbidden},
+		{"", "alice", "users", "/admin/import", "alice", http.StatusOK},
+		{"carol", "alice", "users", "/admin/themes", "alice", http.StatusForbidden},
+		{"carol", "", "", "/admin/marks", "", http.StatusForbidden},
+		{"carol", "", "", "/admin/marks", "carol", http.StatusOK},
+		{"carol", "", "users", "/admin/tokens", "bob", http.StatusOK},
+		{"carol", "", "users", "/view/index", "", http.StatusOK},
+	} {
+		*admins, *editors, *usersFile = this.admins, this.editors, this.users
+		r := httptest.NewRequest("GET", this.url, nil)
+		if this.user != "" {
+			r = withUser(r, this.user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != this.expect {
+			t.Errorf("[%d] got %d for %s as %q but expected %d", i, w.Code, this.url, this.user, this.expect)
+		}
+	}
+}
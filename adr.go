@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Architecture decision records (ADRs) are the pages NNNN-<slug> in the
+// -adr-section. They are created numbered (/adr), their status moves
+// through a lifecycle and an accepted ADR listing others in "supersedes"
+// marks them superseded with a link back ("supersededBy").
+var adrSection = flag.String("adr-section", "decisions", "section of architecture decision records (empty disables them)")
+
+const ADRTemplate = "adr" // boilerplate used for new ADRs (if it exists)
+
+// adrTransitions are the allowed status changes of ADRs.
+var adrTransitions = map[string][]string{
+	"proposed":   {"accepted", "rejected"},
+	"accepted":   {"deprecated", "superseded"},
+	"rejected":   {"proposed"},
+	"deprecated": {},
+	"superseded": {},
+}
+
+var (
+	adrName    = regexp.MustCompile(`^([0-9]{4})-[a-z0-9-]+$`)
+	nonSlugRun = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// adrNumber returns the number of the ADR at p or 0 if p isn't an ADR.
+func adrNumber(p string) int {
+	if *adrSection == "" || path.Dir(p) != *adrSection {
+		return 0
+	}
+	m := adrName.FindStringSubmatch(path.Base(p))
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+func (p *Page) IsADR() bool {
+	return adrNumber(p.Path) > 0
+}
+
+func slugify(s string) string {
+	return strings.Trim(nonSlugRun.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+func (p *Page) Status() string {
+	return getString(p, "status")
+}
+
+// Supersedes returns the ADRs p supersedes.
+func (p *Page) Supersedes() []string {
+	return getStrings(p, "supersedes")
+}
+
+// StatusOptions returns the current status of the ADR p and the ones it
+// can change to in the editor ("superseded" is set by superseding ADRs).
+func (p *Page) StatusOptions() []string {
+	opts := []string{p.Status()}
+	if opts[0] == "" {
+		opts[0] = "proposed"
+	}
+	for _, s := range adrTransitions[opts[0]] {
+		if s != "superseded" {
+			opts = append(opts, s)
+		}
+	}
+	return opts
+}
+
+func (p *Page) SupersededBy() string {
+	return getString(p, "supersededBy")
+}
+
+// checkADR validates the status of the ADR p and its change from old.
+func checkADR(old, p *Page) error {
+	if adrNumber(p.Path) == 0 {
+		return nil
+	}
+	status := p.Status()
+	if _, ok := adrTransitions[status]; !ok {
+		return fmt.Errorf("invalid status '%s' of decision record '%s'", status, p.Path)
+	}
+	if prev := old.Status(); prev != "" && prev != status && !contains(adrTransitions[prev], status) {
+		return fmt.Errorf("the status of decision record '%s' can't change from '%s' to '%s'", p.Path, prev, status)
+	}
+	if status == "superseded" && p.SupersededBy() == "" {
+		return fmt.Errorf("superseded decision record '%s' needs 'supersededBy'", p.Path)
+	}
+	for _, s := range p.Supersedes() {
+		if adrNumber(s) == 0 || s == p.Path {
+			return fmt.Errorf("'%s' superseded by '%s' isn't another decision record", s, p.Path)
+		}
+		if _, ok := index.Get(s); !ok {
+			return fmt.Errorf("superseded decision record '%s' doesn't exist", s)
+		}
+	}
+	return nil
+}
+
+// markSuperseded sets status and supersededBy of the ADRs p supersedes
+// once p is accepted.
+func markSuperseded(r *http.Request, p *Page) {
+	if !p.IsADR() || p.Status() != "accepted" {
+		return
+	}
+	for _, s := range p.Supersedes() {
+		sp, err := LoadPage(s)
+		if err != nil || sp.SupersededBy() == p.Path {
+			continue
+		}
+		old := sp.Copy()
+		sp.FrontMatter["status"] = "superseded"
+		sp.FrontMatter["supersededBy"] = p.Path
+		if err = storePage(r, sp, old, "superseded by "+p.Path); err != nil {
+			logger(r.Context()).Error("Unable to mark decision record as superseded", "path", s, "err", err)
+		}
+	}
+}
+
+// ADR is an entry of the ADR listing.
+type ADR struct {
+	Number       int
+	Path         string
+	Title        string
+	Status       string
+	Date         string
+	SupersededBy string
+}
+
+// listADRs returns all ADRs ordered by number.
+func listADRs() []ADR {
+	var adrs []ADR
+	for _, info := range index.Pages(true) {
+		n := adrNumber(info.Path)
+		if n == 0 {
+			continue
+		}
+		a := ADR{Number: n, Path: info.Path, Title: info.Title, Date: info.Date}
+		a.Status, _ = info.Params["status"].(string)
+		a.SupersededBy, _ = info.Params["supersededby"].(string)
+		adrs = append(adrs, a)
+	}
+	sort.Slice(adrs, func(i, j int) bool { return adrs[i].Number < adrs[j].Number })
+	return adrs
+}
+
+// newADR creates the next numbered ADR with title, superseding the ADR
+// supersedes (if not empty).
+func newADR(r *http.Request, title, supersedes string) (*Page, error) {
+	slug := slugify(title)
+	if slug == "" {
+		return nil, fmt.Errorf("a decision record needs a title")
+	}
+	next := 1
+	for _, a := range listADRs() {
+		if a.Number >= next {
+			next = a.Number + 1
+		}
+	}
+	p := NewPage(fmt.Sprintf("%s/%04d-%s", *adrSection, next, slug))
+	boilerplate := ""
+	if contains(listBoilerplates(), ADRTemplate) {
+		boilerplate = ADRTemplate
+	}
+	if err := applyNewPage(p, boilerplate, time.Now()); err != nil {
+		return nil, err
+	}
+	p.SetTitle(title)
+	p.FrontMatter["status"] = "proposed"
+	p.FrontMatter["date"] = time.Now().Truncate(24 * time.Hour)
+	if supersedes != "" {
+		setStrings(p, "supersedes", []string{supersedes})
+	}
+	if err := validatePage(NewPage(p.Path), p); err != nil {
+		return nil, err
+	}
+	return p, storePage(r, p, NewPage(p.Path), "new decision record")
+}
+
+type adrData struct {
+	Section string
+	ADRs    []ADR
+	Err     string
+}
+
+// adrHandler lists the ADRs (/adr) and creates a new one (POST with title
+// and optionally the ADR it supersedes).
+func adrHandler(w http.ResponseWriter, r *http.Request) {
+	if *adrSection == "" {
+		http.NotFound(w, r)
+		return
+	}
+	data := adrData{Section: *adrSection}
+	if r.Method == http.MethodPost {
+		p, err := newADR(r, strings.TrimSpace(r.FormValue("title")), r.FormValue("supersedes"))
+		if err == nil {
+			http.Redirect(w, r, "/edit/"+p.Path, http.StatusFound)
+			return
+		}
+		data.Err = err.Error()
+	}
+	for _, a := range listADRs() {
+		if mayView(r, a.Path) {
+			data.ADRs = append(data.ADRs, a)
+		}
+	}
+	renderTemplate(w, "adr", data)
+}
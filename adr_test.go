@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestCheckADR(t *testing.T) {
+	defer func(s string) { *adrSection = s }(*adrSection)
+	*adrSection = "decisions"
+	page := func(path, status string, fm ...string) *Page {
+		p := NewPage(path)
+		if status != "" {
+			p.FrontMatter["status"] = status
+		}
+		for i := 0; i+1 < len(fm); i += 2 {
+			p.FrontMatter[fm[i]] = fm[i+1]
+		}
+		return p
+	}
+	const adr = "decisions/0002-use-go"
+	for i, this := range []struct {
+		old, p *Page
+		ok     bool
+	}{
+		{NewPage("docs/x"), page("docs/x", "whatever"), true},
+		{NewPage(adr), page(adr, "proposed"), true},
+		{NewPage(adr), page(adr, ""), false},
+		{NewPage(adr), page(adr, "unknown"), false},
+		{page(adr, "proposed"), page(adr, "accepted"), true},
+		{page(adr, "proposed"), page(adr, "deprecated"), false},
+		{page(adr, "accepted"), page(adr, "proposed"), false},
+		{page(adr, "accepted"), page(adr, "superseded"), false},
+		{page(adr, "accepted"), page(adr, "superseded", "supersededBy", "decisions/0003-use-rust"), true},
+		{page(adr, "superseded"), page(adr, "superseded"), false},
+	} {
+		if err := checkADR(this.old, this.p); (err == nil) != this.ok {
+			t.Errorf("[%d] got error %v but expected ok=%t", i, err, this.ok)
+		}
+	}
+}
+
+func TestADRNumber(t *testing.T) {
+	defer func(s string) { *adrSection = s }(*adrSection)
+	*adrSection = "decisions"
+	for i, this := range []struct {
+		path   string
+		expect int
+	}{
+		{"decisions/0001-first", 1},
+		{"decisions/0042-use-go", 42},
+		{"decisions/_index", 0},
+		{"decisions/old/0003-x", 0},
+		{"docs/0004-x", 0},
+		{"decisions/12-x", 0},
+	} {
+		if n := adrNumber(this.path); n != this.expect {
+			t.Errorf("[%d] got %d but expected %d", i, n, this.expect)
+		}
+	}
+	if s := slugify("Use PostgreSQL (v16) for Orders!"); s != "use-postgresql-v16-for-orders" {
+		t.Errorf("got %q", s)
+	}
+}
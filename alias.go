@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// aliasIndex maps the aliases of all pages to the paths of the pages.
+type aliasIndex struct {
+	mutex sync.RWMutex
+	m     map[string]string // alias -> page path
+}
+
+var aliases = &aliasIndex{m: make(map[string]string)}
+
+// aliasPath turns a Hugo alias like "/old/page/" or "old/page.html" into
+// the page path it would have in gwiki.
+func aliasPath(a string) string {
+	a = strings.Trim(a, "/")
+	a = strings.TrimSuffix(a, "/index.html")
+	return strings.TrimSuffix(a, ".html")
+}
+
+func (ai *aliasIndex) Lookup(path string) (string, bool) {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+	target, ok := ai.m[path]
+	return target, ok
+}
+
+// Check returns an error if an alias of p is the path of another page or
+// an alias of another page.
+func (ai *aliasIndex) Check(p *Page) error {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+	for _, a := range p.Aliases() {
+		ap := aliasPath(a)
+		if ap == p.Path {
+			return fmt.Errorf("alias '%s' of page '%s' points to the page itself", a, p.Path)
+		}
+		if target, ok := ai.m[ap]; ok && target != p.Path {
+			return fmt.Errorf("alias '%s' of page '%s' is already used by page '%s'", a, p.Path, target)
+		}
+		if pageExists(ap) {
+			return fmt.Errorf("alias '%s' of page '%s' collides with an existing page", a, p.Path)
+		}
+	}
+	return nil
+}
+
+// Update replaces all aliases of p with its current ones.
+func (ai *aliasIndex) Update(p *Page) {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.remove(p.Path)
+	ai.add(p)
+}
+
+// Remove removes the aliases of the page at path.
+func (ai *aliasIndex) Remove(path string) {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.remove(path)
+}
+
+func (ai *aliasIndex) remove(path string) {
+	for a, target := range ai.m {
+		if target == path {
+			delete(ai.m, a)
+		}
+	}
+}
+
+func (ai *aliasIndex) add(p *Page) {
+	for _, a := range p.Aliases() {
+		ap := aliasPath(a)
+		if target, ok := ai.m[ap]; ok && target != p.Path {
+			slog.Warn("Alias is already used by another page", "alias", a, "path", p.Path, "target", target)
+			continue
+		}
+		ai.m[ap] = p.Path
+	}
+}
+
+func initAliases() {
+	ps, err := listPages()
+	if err != nil {
+		slog.Error("Unable to list pages for aliases", "err", err)
+	}
+	metas := loadMetas(ps)
+	aliases.mutex.Lock()
+	defer aliases.mutex.Unlock()
+	for _, p := range metas {
+		aliases.add(p)
+	}
+}
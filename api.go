@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("Unable to write JSON response", "err", err)
+	}
+}
+
+// Pagination is a page of a listing selected by the query parameters
+// offset and limit.
+type Pagination struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Total  int `json:"total"`
+}
+
+// paginate reads offset and limit (default def, at most max) from r for a
+// listing of total entries.
+func paginate(r *http.Request, total, def, max int) Pagination {
+	pg := Pagination{Offset: intParam(r, "offset", 0), Limit: intParam(r, "limit", def), Total: total}
+	if pg.Limit > max {
+		pg.Limit = max
+	}
+	if pg.Offset > total {
+		pg.Offset = total
+	}
+	return pg
+}
+
+// Bounds returns the slice bounds of the page.
+func (pg Pagination) Bounds() (int, int) {
+	end := pg.Offset + pg.Limit
+	if end > pg.Total {
+		end = pg.Total
+	}
+	return pg.Offset, end
+}
+
+func (pg Pagination) HasPrev() bool { return pg.Offset > 0 }
+func (pg Pagination) HasNext() bool { return pg.Limit > 0 && pg.Offset+pg.Limit < pg.Total }
+
+func (pg Pagination) Prev() int {
+	if pg.Offset < pg.Limit {
+		return 0
+	}
+	return pg.Offset - pg.Limit
+}
+func (pg Pagination) Next() int { return pg.Offset + pg.Limit }
+
+// From and To are the (1-based) numbers of the first and last entry of
+// the page.
+func (pg Pagination) From() int {
+	if pg.Total == 0 {
+		return 0
+	}
+	return pg.Offset + 1
+}
+func (pg Pagination) To() int {
+	_, end := pg.Bounds()
+	return end
+}
+
+func intParam(r *http.Request, name string, def int) int {
+	s := r.FormValue(name)
+	if s == "" {
+		return def
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 {
+		return def
+	}
+	return i
+}
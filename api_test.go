@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	for i, this := range []struct {
+		query            string
+		total            int
+		start, end       int
+		hasPrev, hasNext bool
+		prev, next, to   int
+	}{
+		{"", 25, 0, 10, false, true, 0, 10, 10},
+		{"?offset=10", 25, 10, 20, true, true, 0, 20, 20},
+		{"?offset=20", 25, 20, 25, true, false, 10, 30, 25},
+		{"?offset=30", 25, 25, 25, true, false, 15, 35, 25},
+		{"?offset=5&limit=100", 25, 5, 25, true, false, 0, 55, 25},
+		{"?limit=0", 25, 0, 0, false, false, 0, 0, 0},
+		{"?offset=-1&limit=x", 0, 0, 0, false, false, 0, 10, 0},
+	} {
+		pg := paginate(httptest.NewRequest("GET", "/list/"+this.query, nil), this.total, 10, 50)
+		start, end := pg.Bounds()
+		if start != this.start || end != this.end {
+			t.Errorf("[%d] got bounds %d:%d but expected %d:%d", i, start, end, this.start, this.end)
+		}
+		if pg.HasPrev() != this.hasPrev || pg.HasNext() != this.hasNext {
+			t.Errorf("[%d] got prev/next %t/%t but expected %t/%t", i, pg.HasPrev(), pg.HasNext(), this.hasPrev, this.hasNext)
+		}
+		if pg.Prev() != this.prev || pg.Next() != this.next || pg.To() != this.to {
+			t.Errorf("[%d] got %d/%d/%d but expected %d/%d/%d", i, pg.Prev(), pg.Next(), pg.To(), this.prev, this.next, this.to)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Pages can list extra assets in the front matter fields "css" and "js":
+//
+//	css = ["/static/css/chart.css", "/static/css/print.css"]
+//	js = "/static/js/chart.js"
+//
+// Assets run with the rights of the user viewing the page, so they have to
+// come from the static directory of the wiki (/static/). Attachments
+// (/files/) and the directories of the static directory that uploads are
+// stored in (upload policies with target "static") aren't allowed since
+// every uploader could add scripts there. External URLs aren't allowed
+// either.
+
+// CSS returns the URLs of the extra style sheets of p.
+func (p *Page) CSS() []string {
+	return pageAssets(p, "css")
+}
+
+// JS returns the URLs of the extra scripts of p.
+func (p *Page) JS() []string {
+	return pageAssets(p, "js")
+}
+
+func pageAssets(p *Page, key string) []string {
+	var urls []string
+	for _, a := range toStrings(p.FrontMatter[key]) {
+		a = strings.TrimSpace(a)
+		if !trustedAsset(a) {
+			slog.Warn("Ignoring asset", "asset", a, "path", p.Path)
+			continue
+		}
+		urls = append(urls, a)
+	}
+	return urls
+}
+
+// trustedAsset reports whether a is a file of the static directory
+// uploads can't write.
+func trustedAsset(a string) bool {
+	if !strings.HasPrefix(a, "/static/") || path.Clean(a) != a {
+		return false
+	}
+	uploads, err1 := filepath.Abs(filepath.Join(*siteDir, "static"))
+	static, err2 := filepath.Abs("static")
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	if uploads != static {
+		return true
+	}
+	dir := path.Dir(strings.TrimPrefix(a, "/static/"))
+	if dir == "." {
+		dir = ""
+	}
+	return uploadPolicy(dir).Target != TargetStatic
+}
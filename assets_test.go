@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPageAssets(t *testing.T) {
+	defer func(ps []*UploadPolicy) { uploadPolicies = ps }(uploadPolicies)
+	uploadPolicies = []*UploadPolicy{{Section: "uploads", Target: TargetStatic}, {Section: "blog", Target: TargetBundle}}
+	defer func(s string) { *siteDir = s }(*siteDir)
+
+	p := NewPage("blog/post")
+	p.FrontMatter["js"] = []interface{}{
+		"/static/js/chart.js",
+		" /static/main.js ",
+		"chart.js",                  // attachment
+		"/files/blog/chart.js",      // attachment
+		"/static/uploads/evil.js",   // uploaded
+		"/static/uploads/x/evil.js", // uploaded
+		"/static/js/../uploads/evil.js",
+		"https://example.com/x.js",
+	}
+	p.FrontMatter["css"] = "/static/blog/print.css"
+	for i, this := range []struct {
+		site    string
+		js, css []string
+	}{
+		{"./", []string{"/static/js/chart.js", "/static/main.js"}, []string{"/static/blog/print.css"}},
+		// uploads go to the static directory of another site
+		{"site", []string{"/static/js/chart.js", "/static/main.js", "/static/uploads/evil.js", "/static/uploads/x/evil.js"}, []string{"/static/blog/print.css"}},
+	} {
+		*siteDir = this.site
+		if got := p.JS(); !reflect.DeepEqual(got, this.js) {
+			t.Errorf("[%d] got scripts %q but expected %q", i, got, this.js)
+		}
+		if got := p.CSS(); !reflect.DeepEqual(got, this.css) {
+			t.Errorf("[%d] got style sheets %q but expected %q", i, got, this.css)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attachments (images, PDFs, ...) are stored next to their page in the
+// content directory so Hugo publishes them as page resources (or in the
+// static directory of the site, see the upload policies). Overwritten
+// versions are kept outside of it so Hugo doesn't publish them.
+var (
+	attachmentHistory  = flag.String("attachment-history", "./attachment-history/", "directory for previous versions of attachments")
+	attachmentVersions = flag.Int("attachment-versions", 5, "number of previous versions kept per attachment (0 disables versioning)")
+)
+
+const MaxUploadSize = 32 << 20
+
+var validAttachmentName = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*\.[a-zA-Z0-9]+$`)
+
+// Attachment is a file in the directory of a page.
+type Attachment struct {
+	Name     string
+	Size     int64
+	Time     time.Time
+	Versions []AttachmentVersion // newest first
+}
+
+// AttachmentVersion is a previous version of an attachment.
+type AttachmentVersion struct {
+	ID   string // unix nano time of the overwrite
+	Size int64
+	Time time.Time
+}
+
+type attachmentsData struct {
+	Path        string
+	Dir         string
+	Err         string
+	Policy      *UploadPolicy
+	Attachments []Attachment
+}
+
+// attachmentDir returns the directory of the page at path relative to the
+// content directory ("" for the top level).
+func attachmentDir(path string) string {
+	if d := filepath.ToSlash(filepath.Dir(path)); d != "." {
+		return d
+	}
+	return ""
+}
+
+// attachmentFile returns the name of an attachment in attachmentFS(dir).
+func attachmentFile(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+func historyDir(dir, name string) string {
+	return filepath.Join(*attachmentHistory, dir, name)
+}
+
+// listAttachments returns all non-page files in the directory dir.
+func listAttachments(dir string) ([]Attachment, error) {
+	des, err := attachmentFS(dir).ReadDir(fsDir(dir))
+	if err != nil {
+		return nil, err
+	}
+	var as []Attachment
+	for _, de := range des {
+		if de.IsDir() || path.Ext(de.Name()) == Suffix || !validAttachmentName.MatchString(de.Name()) {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			return nil, err
+		}
+		a := Attachment{Name: fi.Name(), Size: fi.Size(), Time: fi.ModTime()}
+		a.Versions, err = attachmentVersionsOf(dir, fi.Name())
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+func attachmentVersionsOf(dir, name string) ([]AttachmentVersion, error) {
+	fis, err := ioutil.ReadDir(historyDir(dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var vs []AttachmentVersion
+	for _, fi := range fis {
+		if ns, err := strconv.ParseInt(fi.Name(), 10, 64); err == nil {
+			vs = append(vs, AttachmentVersion{ID: fi.Name(), Size: fi.Size(), Time: time.Unix(0, ns)})
+		}
+	}
+	sort.Slice(vs, func(i, j int) bool { return vs[i].ID > vs[j].ID })
+	return vs, nil
+}
+
+// keepVersion copies the current version of the attachment (if any) into
+// the history and removes versions exceeding the limit.
+func keepVersion(dir, name string) error {
+	fsys := attachmentFS(dir)
+	in, err := fsys.Open(attachmentFile(dir, name))
+	if os.IsNotExist(err) || *attachmentVersions <= 0 {
+		if err == nil {
+			in.Close()
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	hd := historyDir(dir, name)
+	if err := writeFile(filepath.Join(hd, strconv.FormatInt(time.Now().UnixNano(), 10)), in); err != nil {
+		return err
+	}
+	vs, err := attachmentVersionsOf(dir, name)
+	if err != nil {
+		return err
+	}
+	for i := *attachmentVersions; i < len(vs); i++ {
+		if err := os.Remove(filepath.Join(hd, vs[i].ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveAttachment stores the content of r as attachment name in dir.
+func saveAttachment(dir, name string, r io.Reader) error {
+	if !validAttachmentName.MatchString(name) || filepath.Ext(name) == Suffix {
+		return fmt.Errorf("invalid attachment name '%s'", name)
+	}
+	if err := keepVersion(dir, name); err != nil {
+		return fmt.Errorf("unable to keep the previous version of '%s': %s", name, err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return attachmentFS(dir).WriteFile(attachmentFile(dir, name), b)
+}
+
+// restoreAttachment makes the version id of the attachment current again.
+// The replaced version is kept in the history, too.
+func restoreAttachment(dir, name, id string) error {
+	if !validAttachmentName.MatchString(name) {
+		return fmt.Errorf("invalid attachment name '%s'", name)
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return fmt.Errorf("invalid version '%s'", id)
+	}
+	in, err := os.Open(filepath.Join(historyDir(dir, name), id))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return saveAttachment(dir, name, in)
+}
+
+// attachmentsHandler lists the attachments of a page (GET), uploads a new
+// one (POST with file) or restores a previous version (POST with name and
+// version).
+func attachmentsHandler(w http.ResponseWriter, r *http.Request, p string) {
+	data := attachmentsData{Path: p, Dir: attachmentDir(p)}
+	data.Policy = uploadPolicy(data.Dir)
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, data.Policy.MaxSize+1<<20)
+		var err error
+		name := r.FormValue("name")
+		if v := r.FormValue("version"); v != "" {
+			if err = restoreAttachment(data.Dir, name, v); err == nil {
+				audit(r, "restore-attachment", path.Join(data.Dir, name)+"@"+v)
+			}
+		} else {
+			f, fh, ferr := r.FormFile("file")
+			if ferr != nil {
+				err = ferr
+			} else {
+				defer f.Close()
+				name = filepath.Base(fh.Filename)
+				var content io.Reader
+				if content, err = data.Policy.checkUpload(name, fh.Size, f); err == nil {
+					if err = saveAttachment(data.Dir, name, content); err == nil {
+						audit(r, "upload", path.Join(data.Dir, name))
+					}
+				}
+			}
+		}
+		if err == nil {
+			http.Redirect(w, r, "/attachments/"+p, http.StatusSeeOther)
+			return
+		}
+		logger(r.Context()).Error("Unable to store attachment", "name", name, "path", p, "err", err)
+		data.Err = err.Error()
+	}
+	as, err := listAttachments(data.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		logger(r.Context()).Error("Unable to list attachments", "path", p, "err", err)
+		data.Err = err.Error()
+	}
+	data.Attachments = as
+	renderTemplate(w, "attachments", data)
+}
+
+// fileHandler serves attachments (/files/<dir>/<name>). Attachments come
+// from the same origin as the wiki, so they run sandboxed and all but
+// raster images are downloaded instead of shown: an uploaded HTML, SVG or
+// script file must not run with the cookies of the wiki.
+func fileHandler(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	if !validAttachmentName.MatchString(name) || path.Ext(name) == Suffix {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if ext := strings.ToLower(path.Ext(name)); !imageExtensions[ext] || ext == ".svg" {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	dir := strings.TrimPrefix(path.Dir(r.URL.Path), "/files")
+	fsys := attachmentFS(strings.TrimPrefix(dir, "/"))
+	http.StripPrefix("/files/", http.FileServer(http.FS(fsys))).ServeHTTP(w, r)
+}
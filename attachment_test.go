@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentVersions(t *testing.T) {
+	testSetup(t)
+	defer func(h string, n int) { *attachmentHistory, *attachmentVersions = h, n }(*attachmentHistory, *attachmentVersions)
+	*attachmentHistory, *attachmentVersions = t.TempDir(), 3
+	current := func(dir, name string) string {
+		b, err := attachmentFS(dir).ReadFile(attachmentFile(dir, name))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return string(b)
+	}
+	versions := func(dir, name string) []string {
+		vs, err := attachmentVersionsOf(dir, name)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var contents []string
+		for _, v := range vs {
+			b, err := ioutil.ReadFile(filepath.Join(historyDir(dir, name), v.ID))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			contents = append(contents, string(b))
+		}
+		return contents
+	}
+
+	for i := 1; i <= 5; i++ {
+		if err := saveAttachment("docs", "spec.txt", strings.NewReader(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if got, vs := current("docs", "spec.txt"), strings.Join(versions("docs", "spec.txt"), " "); got != "v5" || vs != "v4 v3 v2" {
+		t.Errorf("got %s with versions %s but expected v5 with the versions v4 v3 v2", got, vs)
+	}
+
+	vs, _ := attachmentVersionsOf("docs", "spec.txt")
+	if err := restoreAttachment("docs", "spec.txt", vs[len(vs)-1].ID); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, vs := current("docs", "spec.txt"), strings.Join(versions("docs", "spec.txt"), " "); got != "v2" || vs != "v5 v4 v3" {
+		t.Errorf("got %s with versions %s after the restore but expected v2 with the versions v5 v4 v3", got, vs)
+	}
+	as, err := listAttachments("docs")
+	if err != nil || len(as) != 1 || as[0].Name != "spec.txt" || len(as[0].Versions) != 3 {
+		t.Errorf("got attachments %v (%v)", as, err)
+	}
+
+	*attachmentVersions = 0
+	for i := 1; i <= 2; i++ {
+		if err := saveAttachment("", "logo.png", strings.NewReader(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if got, vs := current("", "logo.png"), versions("", "logo.png"); got != "v2" || vs != nil {
+		t.Errorf("got %s with versions %v but expected no versions", got, vs)
+	}
+
+	for i, this := range []struct{ name, id string }{
+		{"../spec.txt", vs[0].ID},
+		{"page.md", vs[0].ID},
+		{"spec.txt", "../../etc/passwd"},
+		{"spec.txt", "12345"},
+	} {
+		if err := restoreAttachment("docs", this.name, this.id); err == nil {
+			t.Errorf("[%d] expected restoring %s version %s to fail", i, this.name, this.id)
+		}
+	}
+	if err := saveAttachment("docs", "page.md", strings.NewReader("# Page")); err == nil {
+		t.Errorf("expected saving a page as attachment to fail")
+	}
+}
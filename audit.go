@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var auditFile = flag.String("audit-log", "./audit.log", "file the changes are logged to")
+
+const (
+	AuditDefaultLimit = 50
+	AuditMaxLimit     = 1000
+	AuditBlockSize    = 64 << 10 // bytes read at once from the end of the log
+)
+
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"` // e.g. "save"
+	Path   string    `json:"path"`
+	Remote string    `json:"remote,omitempty"`
+
+	RequestID string `json:"requestID,omitempty"` // ID of the request making the change
+
+	Summary string `json:"summary,omitempty"` // edit summary given by the user
+
+	Changes []FieldChange `json:"changes,omitempty"` // changed front matter fields
+}
+
+type userKey struct{}
+
+var auditMutex sync.Mutex
+
+// currentUser returns the name of the user making the request.
+func currentUser(r *http.Request) string {
+	if u, ok := r.Context().Value(userKey{}).(string); ok && u != "" {
+		return u
+	}
+	return "anonymous"
+}
+
+// localRequest returns a request of user for changes that don't come in
+// over HTTP, so the rules of the web pages apply to them. remote is the
+// source shown in the audit log (e.g. "rpc").
+func localRequest(user, remote string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remote
+	return withUser(r, user)
+}
+
+func withUser(r *http.Request, user string) *http.Request {
+	if a, ok := r.Context().Value(accessKey{}).(*accessInfo); ok {
+		a.user = user
+	}
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
+
+// audit appends an entry to the audit log. Errors are only logged since the
+// action itself has already happened.
+func audit(r *http.Request, action, path string) {
+	logAudit(newAuditEntry(r, action, path))
+}
+
+func newAuditEntry(r *http.Request, action, path string) *AuditEntry {
+	return &AuditEntry{User: currentUser(r), Action: action, Path: path, Remote: r.RemoteAddr, RequestID: requestID(r.Context())}
+}
+
+func logAudit(e *AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	fireWebhooks(e)
+	publishChange(e)
+	b, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Unable to marshal audit entry", "err", err)
+		return
+	}
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	f, err := os.OpenFile(*auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		slog.Error("Unable to open audit log", "file", *auditFile, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		slog.Error("Unable to write audit log", "file", *auditFile, "err", err)
+	}
+}
+
+type auditFilter struct {
+	User       string
+	PathPrefix string
+	Action     string
+	From, To   time.Time
+}
+
+func (af *auditFilter) match(e *AuditEntry) bool {
+	switch {
+	case af.User != "" && e.User != af.User:
+		return false
+	case af.PathPrefix != "" && !strings.HasPrefix(e.Path, af.PathPrefix):
+		return false
+	case af.Action != "" && e.Action != af.Action:
+		return false
+	case !af.From.IsZero() && e.Time.Before(af.From):
+		return false
+	case !af.To.IsZero() && !e.Time.Before(af.To):
+		return false
+	}
+	return true
+}
+
+// readAudit returns all entries matching the filter, newest first.
+func readAudit(af *auditFilter) ([]*AuditEntry, error) {
+	var es []*AuditEntry
+	err := scanAudit(func(e *AuditEntry) bool {
+		if af.match(e) {
+			es = append(es, e)
+		}
+		return true
+	})
+	return es, err
+}
+
+// scanAudit calls fn for the entries of the audit log newest first until
+// it returns false. The log is read backwards in blocks, so looking at the
+// latest entries doesn't read the whole file. fn must not write the log.
+func scanAudit(fn func(e *AuditEntry) bool) error {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	f, err := os.Open(*auditFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	next := func(line []byte) bool {
+		if len(line) == 0 {
+			return true
+		}
+		e := &AuditEntry{}
+		if err := json.Unmarshal(line, e); err != nil {
+			slog.Warn("Skipping ill formatted audit entry", "entry", string(line))
+			return true
+		}
+		return fn(e)
+	}
+	var rest []byte // start of a line continued in the block read before
+	for off := fi.Size(); off > 0; {
+		n := min(off, AuditBlockSize)
+		off -= n
+		b := make([]byte, n, n+int64(len(rest)))
+		if _, err := f.ReadAt(b, off); err != nil {
+			return err
+		}
+		lines := bytes.Split(append(b, rest...), []byte("\n"))
+		rest = lines[0]
+		for i := len(lines) - 1; i > 0; i-- {
+			if !next(lines[i]) {
+				return nil
+			}
+		}
+	}
+	next(rest)
+	return nil
+}
+
+// parseTime accepts RFC 3339 timestamps or plain dates.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(DateFormat, s)
+}
+
+// auditVisible reports whether the user of r may view the pages of e. Both
+// paths of a rename ("old -> new") have to be visible.
+func auditVisible(r *http.Request, e *AuditEntry) bool {
+	if e.Path == "" {
+		return true
+	}
+	for _, p := range strings.Split(e.Path, " -> ") {
+		if !mayView(r, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	af := &auditFilter{User: r.FormValue("user"), PathPrefix: r.FormValue("path"), Action: r.FormValue("action")}
+	var err error
+	if af.From, err = parseTime(r.FormValue("from")); err != nil {
+		http.Error(w, fmt.Sprintf("invalid 'from' time: %s", err), http.StatusBadRequest)
+		return
+	}
+	if af.To, err = parseTime(r.FormValue("to")); err != nil {
+		http.Error(w, fmt.Sprintf("invalid 'to' time: %s", err), http.StatusBadRequest)
+		return
+	}
+	es, err := readAudit(af)
+	if err != nil {
+		logger(r.Context()).Error("Unable to read audit log", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// only admins see the addresses the changes came from
+	admin := isAdmin(r)
+	visible := []*AuditEntry{}
+	for _, e := range es {
+		if !auditVisible(r, e) {
+			continue
+		}
+		if !admin {
+			e.Remote = ""
+		}
+		visible = append(visible, e)
+	}
+	es = visible
+
+	if r.FormValue("format") == "csv" {
+		writeAuditCSV(w, es)
+		return
+	}
+	pg := paginate(r, len(es), AuditDefaultLimit, AuditMaxLimit)
+	start, end := pg.Bounds()
+	writeJSON(w, map[string]interface{}{"total": pg.Total, "offset": pg.Offset, "limit": pg.Limit, "entries": es[start:end]})
+}
+
+func writeAuditCSV(w http.ResponseWriter, es []*AuditEntry) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "user", "action", "path", "remote", "summary"})
+	for _, e := range es {
+		cw.Write([]string{e.Time.Format(time.RFC3339), e.User, e.Action, e.Path, e.Remote, e.Summary})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		slog.Error("Unable to write audit CSV", "err", err)
+	}
+}
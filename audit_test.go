@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadAudit(t *testing.T) {
+	testSetup(t)
+	// enough entries for several blocks
+	const n = 3000
+	for i := 0; i < n; i++ {
+		logAudit(&AuditEntry{User: "alice", Action: "save", Path: fmt.Sprintf("page%d", i)})
+		if i == n/2 {
+			f, err := os.OpenFile(*auditFile, os.O_APPEND|os.O_WRONLY, 0640)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			f.WriteString("not json\n")
+			f.Close()
+		}
+	}
+	if fi, err := os.Stat(*auditFile); err != nil || fi.Size() < 3*AuditBlockSize {
+		t.Fatalf("got an audit log of %v bytes (%v) but expected several blocks", fi.Size(), err)
+	}
+
+	es, err := readAudit(&auditFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(es) != n {
+		t.Fatalf("got %d entries but expected %d", len(es), n)
+	}
+	for i, e := range es {
+		if expect := fmt.Sprintf("page%d", n-1-i); e.Path != expect {
+			t.Fatalf("[%d] got %s but expected %s", i, e.Path, expect)
+		}
+	}
+	if es, err = readAudit(&auditFilter{PathPrefix: "page123"}); err != nil || len(es) != 11 || es[0].Path != "page1239" || es[10].Path != "page123" {
+		t.Errorf("got filtered entries %v (%v)", es, err)
+	}
+
+	var seen int
+	if err = scanAudit(func(e *AuditEntry) bool { seen++; return seen < 3 }); err != nil || seen != 3 {
+		t.Errorf("got %d entries (%v) but expected the scan to stop after 3", seen, err)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	testSetup(t)
+	defer func(a, e, u string) { *admins, *editors, *usersFile = a, e, u }(*admins, *editors, *usersFile)
+	*admins, *editors, *usersFile = "carol", "", "users"
+	logAudit(&AuditEntry{User: "alice", Action: "save", Path: "docs/intro", Remote: "192.0.2.7:4321"})
+
+	for i, this := range []struct {
+		user, format string
+		remote       bool
+	}{
+		{"bob", "", false},
+		{"bob", "csv", false},
+		{"carol", "", true},
+		{"carol", "csv", true},
+	} {
+		w := httptest.NewRecorder()
+		auditHandler(w, withUser(httptest.NewRequest("GET", "/api/v1/audit?format="+this.format, nil), this.user))
+		if !strings.Contains(w.Body.String(), "docs/intro") {
+			t.Errorf("[%d] got no entry for %s: %s", i, this.user, w.Body)
+		}
+		if remote := strings.Contains(w.Body.String(), "192.0.2.7"); remote != this.remote {
+			t.Errorf("[%d] got the remote address %t for %s: %s", i, remote, this.user, w.Body)
+		}
+	}
+}
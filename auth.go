@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// With a users file every request needs HTTP basic auth except those below
+// the -auth-exempt prefixes (anybody may read then, but only users may
+// edit). The users file has a line "name:bcrypt-hash" per user like an
+// htpasswd file created with "htpasswd -B" or "gwiki -hash-password",
+// optionally followed by ":group,..." (see the ACL file).
+var (
+	usersFile    = flag.String("users-file", "", "file with 'name:bcrypt-hash' lines; enables HTTP basic auth")
+	authExempt   = flag.String("auth-exempt", "/view/,/static/,/shared/", "comma separated path prefixes that don't need basic auth")
+	authRealm    = flag.String("auth-realm", "gwiki", "realm of the basic auth")
+	hashPassword = flag.Bool("hash-password", false, "read a password from stdin, print its bcrypt hash for the users file and exit")
+)
+
+type userTable struct {
+	mutex    sync.Mutex
+	modTime  time.Time
+	hashes   map[string][]byte
+	groups   map[string][]string
+	verified map[[sha256.Size]byte]bool // of successful checks since bcrypt is slow
+}
+
+var users = &userTable{}
+
+// dummyHash is compared for unknown users so they take as long as known ones.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+func parseUsers(sc *bufio.Scanner) (map[string][]byte, map[string][]string, error) {
+	hashes := make(map[string][]byte)
+	groups := make(map[string][]string)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("line %d: expected 'name:hash'", n)
+		}
+		h, gs, _ := strings.Cut(line[i+1:], ":")
+		if _, err := bcrypt.Cost([]byte(h)); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		hashes[line[:i]] = []byte(h)
+		for _, g := range strings.Split(gs, ",") {
+			if g = strings.TrimPrefix(strings.TrimSpace(g), "@"); g != "" {
+				groups[line[:i]] = append(groups[line[:i]], "@"+g)
+			}
+		}
+	}
+	return hashes, groups, sc.Err()
+}
+
+// load (re)reads the users file if it changed.
+func (ut *userTable) load() {
+	fi, err := os.Stat(*usersFile)
+	if err != nil {
+		slog.Error("Unable to read users file", "file", *usersFile, "err", err)
+		return
+	}
+	if fi.ModTime().Equal(ut.modTime) {
+		return
+	}
+	f, err := os.Open(*usersFile)
+	if err != nil {
+		slog.Error("Unable to read users file", "file", *usersFile, "err", err)
+		return
+	}
+	defer f.Close()
+	hashes, groups, err := parseUsers(bufio.NewScanner(f))
+	if err != nil {
+		slog.Error("Unable to parse users file", "file", *usersFile, "err", err)
+		return
+	}
+	ut.hashes, ut.groups, ut.modTime = hashes, groups, fi.ModTime()
+	ut.verified = make(map[[sha256.Size]byte]bool)
+}
+
+// Check reports whether password is the one of user.
+func (ut *userTable) Check(user, password string) bool {
+	ut.mutex.Lock()
+	ut.load()
+	h, ok := ut.hashes[user]
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + string(h)))
+	verified := ut.verified[key]
+	ut.mutex.Unlock()
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	if verified {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(h, []byte(password)) != nil {
+		return false
+	}
+	ut.mutex.Lock()
+	ut.verified[key] = true
+	ut.mutex.Unlock()
+	return true
+}
+
+// Groups returns the groups ("@name") of user in the users file.
+func (ut *userTable) Groups(user string) []string {
+	if *usersFile == "" {
+		return nil
+	}
+	ut.mutex.Lock()
+	defer ut.mutex.Unlock()
+	ut.load()
+	return ut.groups[user]
+}
+
+func isAuthExempt(path string) bool {
+	if path == "/healthz" || path == "/readyz" || strings.HasPrefix(path, "/shared/") {
+		return true
+	}
+	for _, p := range strings.Split(*authExempt, ",") {
+		if p = strings.TrimSpace(p); p != "" && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// authHandler requires basic auth for h if there is a users file. The
+// user is available with currentUser.
+func authHandler(h http.Handler) http.Handler {
+	if *usersFile == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestToken(r) != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if ok && loginLimiter != nil {
+			// checked before bcrypt, which is slow on purpose
+			if d := loginLimiter.wait(clientIP(r)); d > 0 {
+				tooManyRequests(w, r, d)
+				return
+			}
+		}
+		if ok && users.Check(user, password) {
+			h.ServeHTTP(w, withUser(r, user))
+			return
+		}
+		if !ok && isAuthExempt(r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if ok {
+			logger(r.Context()).Warn("Failed login", "login", user, "remote", r.RemoteAddr)
+			if loginLimiter != nil {
+				loginLimiter.take(clientIP(r))
+			}
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", *authRealm))
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+	})
+}
+
+func initAuth() {
+	if *usersFile == "" {
+		return
+	}
+	users.mutex.Lock()
+	defer users.mutex.Unlock()
+	users.load()
+	if users.hashes == nil {
+		fatal("No users in users file", "file", *usersFile)
+	}
+	slog.Info("Basic auth enabled", "users", len(users.hashes))
+}
+
+// printPasswordHash implements -hash-password.
+func printPasswordHash() {
+	sc := bufio.NewScanner(os.Stdin)
+	if !sc.Scan() || sc.Text() == "" {
+		fatal("No password on stdin")
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(sc.Text()), bcrypt.DefaultCost)
+	if err != nil {
+		fatal("Unable to hash password", "err", err)
+	}
+	fmt.Println(string(h))
+}
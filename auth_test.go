@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthHandler(t *testing.T) {
+	h, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "gwiki-auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "users")
+	if err = ioutil.WriteFile(fn, []byte("# users\nalice:"+string(h)+"\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(f string) { *usersFile = f }(*usersFile)
+	*usersFile = fn
+
+	handler := authHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(currentUser(r)))
+	}))
+	for i, this := range []struct {
+		url, user, password string
+		expectCode          int
+		expectUser          string
+	}{
+		{"/edit/x", "", "", http.StatusUnauthorized, ""},
+		{"/edit/x", "alice", "secret", http.StatusOK, "alice"},
+		{"/edit/x", "alice", "secret", http.StatusOK, "alice"},
+		{"/edit/x", "alice", "wrong", http.StatusUnauthorized, ""},
+		{"/edit/x", "bob", "secret", http.StatusUnauthorized, ""},
+		{"/view/x", "", "", http.StatusOK, "anonymous"},
+		{"/view/x", "alice", "secret", http.StatusOK, "alice"},
+		{"/view/x", "alice", "wrong", http.StatusUnauthorized, ""},
+	} {
+		r := httptest.NewRequest("GET", this.url, nil)
+		if this.user != "" {
+			r.SetBasicAuth(this.user, this.password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != this.expectCode {
+			t.Errorf("[%d] got code %d but expected %d", i, w.Code, this.expectCode)
+		}
+		if this.expectUser != "" && w.Body.String() != this.expectUser {
+			t.Errorf("[%d] got user %q but expected %q", i, w.Body.String(), this.expectUser)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// pageLinks returns the paths of all wiki pages p links to. Links of large
+// pages aren't extracted to keep indexing fast.
+func pageLinks(p *Page) []string {
+	if p.Large() {
+		return nil
+	}
+	var ls []string
+	for _, l := range extractLinks(p.Body) {
+		t, ok := resolveLink(p.Path, l)
+		if ok && t != p.Path && !contains(ls, t) {
+			ls = append(ls, t)
+		}
+	}
+	sort.Strings(ls)
+	return ls
+}
+
+func addBacklinks(backlinks map[string]map[string]bool, info *PageInfo) {
+	for _, t := range info.Links {
+		if backlinks[t] == nil {
+			backlinks[t] = make(map[string]bool)
+		}
+		backlinks[t][info.Path] = true
+	}
+}
+
+func removeBacklinks(backlinks map[string]map[string]bool, info *PageInfo) {
+	for _, t := range info.Links {
+		delete(backlinks[t], info.Path)
+		if len(backlinks[t]) == 0 {
+			delete(backlinks, t)
+		}
+	}
+}
+
+// Backlinks returns the (non-draft) pages linking to path sorted by path.
+func (pi *pageIndex) Backlinks(path string, drafts bool) []*PageInfo {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	var infos []*PageInfo
+	for from := range pi.backlinks[path] {
+		if info, ok := pi.pages[from]; ok && (drafts || !info.Draft) {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos
+}
+
+// Backlinks returns the pages linking to p ("pages that link here") the
+// reader may view. Drafts are only listed for editors.
+func (p *Page) Backlinks() []*PageInfo {
+	return visibleInfos(p.viewer, index.Backlinks(p.Path, p.viewer != nil && isEditor(p.viewer)))
+}
+
+// Graph contains all pages as nodes and the links between them as edges.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID    string   `json:"id"` // page path
+	Title string   `json:"title"`
+	Draft bool     `json:"draft,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Graph returns the link graph of all (non-draft) pages. It is cached
+// until the index changes. Links to missing pages are left out.
+func (pi *pageIndex) Graph(drafts bool) *Graph {
+	pi.mutex.RLock()
+	g, ok := pi.graphs[drafts]
+	gen := pi.generation
+	if !ok {
+		g = pi.graph(drafts)
+	}
+	pi.mutex.RUnlock()
+	if ok {
+		return g
+	}
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+	if pi.generation == gen {
+		if pi.graphs == nil {
+			pi.graphs = make(map[bool]*Graph)
+		}
+		pi.graphs[drafts] = g
+	}
+	return g
+}
+
+// graph builds the link graph. The caller holds the read lock.
+func (pi *pageIndex) graph(drafts bool) *Graph {
+	g := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, info := range pi.pages {
+		if drafts || !info.Draft {
+			g.Nodes = append(g.Nodes, GraphNode{ID: info.Path, Title: info.Title, Draft: info.Draft, Tags: info.Tags})
+		}
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	for _, n := range g.Nodes {
+		for _, t := range pi.pages[n.ID].Links {
+			if to, ok := pi.pages[t]; ok && (drafts || !to.Draft) {
+				g.Edges = append(g.Edges, GraphEdge{Source: n.ID, Target: t})
+			}
+		}
+	}
+	return g
+}
+
+// For returns the part of the graph the user of r may view.
+func (g *Graph) For(r *http.Request) *Graph {
+	v := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	visible := make(map[string]bool)
+	for _, n := range g.Nodes {
+		if mayView(r, n.ID) {
+			visible[n.ID] = true
+			v.Nodes = append(v.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		if visible[e.Source] && visible[e.Target] {
+			v.Edges = append(v.Edges, e)
+		}
+	}
+	return v
+}
+
+// graphHandler serves the link graph (/api/v1/graph?drafts=true). The
+// ETag is the hash of the graph the reader gets.
+func graphHandler(w http.ResponseWriter, r *http.Request) {
+	g := index.Graph(r.FormValue("drafts") == "true").For(r)
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		logger(r.Context()).Error("Unable to marshal the link graph", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(b)
+	etag := `"graph-` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(append(b, '\n'))
+}
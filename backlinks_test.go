@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBacklinks(t *testing.T) {
+	pi := &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool)}
+	page := func(path, body string) *Page {
+		p := NewPage(path)
+		p.Body = []byte(body)
+		return p
+	}
+	paths := func(infos []*PageInfo) []string {
+		var ps []string
+		for _, info := range infos {
+			ps = append(ps, info.Path)
+		}
+		return ps
+	}
+	pi.Update(page("blog/a", "see [b](b), [[docs/c]] and [self](a)"))
+	pi.Update(page("docs/c", "[a](/view/blog/a#top) and [ext](https://example.org)"))
+	pi.Update(page("d", `{{< ref "docs/c.md" >}}`))
+
+	for i, this := range []struct {
+		path   string
+		expect []string
+	}{
+		{"blog/a", []string{"docs/c"}},
+		{"blog/b", []string{"blog/a"}},
+		{"docs/c", []string{"blog/a", "d"}},
+		{"d", nil},
+	} {
+		if result := paths(pi.Backlinks(this.path, true)); !reflect.DeepEqual(result, this.expect) {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+
+	pi.Update(page("blog/a", "no links anymore"))
+	pi.Remove("d")
+	if result := pi.Backlinks("docs/c", true); len(result) != 0 {
+		t.Errorf("got %q but expected no backlinks", paths(result))
+	}
+	if len(pi.backlinks) != 1 {
+		t.Errorf("got %d link targets but expected 1", len(pi.backlinks))
+	}
+}
+
+func TestPageBacklinks(t *testing.T) {
+	defer func(pi *pageIndex, e string) { index, *editors = pi, e }(index, *editors)
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	*editors = "alice"
+	for _, path := range []string{"a", "b"} {
+		p := NewPage(path)
+		p.Body = []byte("[target](target)")
+		if path == "b" {
+			p.FrontMatter["draft"] = true
+		}
+		index.Update(p)
+	}
+	target := NewPage("target")
+	for i, this := range []struct {
+		p      *Page
+		expect int
+	}{
+		{target, 1},
+		{target.For(httptest.NewRequest("GET", "/view/target", nil)), 1},
+		{target.For(withUser(httptest.NewRequest("GET", "/view/target", nil), "bob")), 1},
+		{target.For(withUser(httptest.NewRequest("GET", "/view/target", nil), "alice")), 2},
+	} {
+		if bls := this.p.Backlinks(); len(bls) != this.expect {
+			t.Errorf("[%d] got %d backlinks but expected %d", i, len(bls), this.expect)
+		}
+	}
+}
+
+func TestGraphHandler(t *testing.T) {
+	defer func(pi *pageIndex, a string) { index, *aclFile = pi, a }(index, *aclFile)
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl"), []byte("secret/** view=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	*aclFile = filepath.Join(dir, "acl")
+	acls = &aclTable{}
+	defer func() { acls = &aclTable{} }()
+	update := func(path, body string) {
+		p := NewPage(path)
+		p.Body = []byte(body)
+		index.Update(p)
+	}
+	update("a", "[b](b) and [plan](secret/plan)")
+	update("b", "")
+	update("secret/plan", "[a](/view/a)")
+
+	get := func(user, etag string) (*httptest.ResponseRecorder, *Graph) {
+		r := httptest.NewRequest("GET", "/api/v1/graph", nil)
+		if user != "" {
+			r = withUser(r, user)
+		}
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		graphHandler(w, r)
+		g := &Graph{}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), g); err != nil {
+				t.Fatalf("got invalid graph %s: %s", w.Body, err)
+			}
+		}
+		return w, g
+	}
+	w, g := get("", "")
+	anon := w.Header().Get("ETag")
+	if len(g.Nodes) != 2 || len(g.Edges) != 1 {
+		t.Errorf("got graph %+v for anonymous", g)
+	}
+	w, g = get("alice", "")
+	if len(g.Nodes) != 3 || len(g.Edges) != 3 {
+		t.Errorf("got graph %+v for alice", g)
+	}
+	alice := w.Header().Get("ETag")
+	if anon == "" || anon == alice {
+		t.Errorf("got the ETags %s and %s for different graphs", anon, alice)
+	}
+	if w, _ = get("", anon); w.Code != http.StatusNotModified {
+		t.Errorf("got status %d for an unchanged graph", w.Code)
+	}
+	// a change anonymous readers don't see keeps their ETag
+	update("secret/plan", "")
+	if w, _ = get("", anon); w.Code != http.StatusNotModified {
+		t.Errorf("got status %d after an invisible change", w.Code)
+	}
+	if w, _ = get("alice", alice); w.Code != http.StatusOK {
+		t.Errorf("got status %d after a visible change", w.Code)
+	}
+}
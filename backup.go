@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// archiver writes the files of a backup archive.
+type archiver interface {
+	Add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+type zipArchiver struct{ zw *zip.Writer }
+
+func (a *zipArchiver) Add(name string, size int64, modTime time.Time, r io.Reader) error {
+	f, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (a *zipArchiver) Close() error {
+	return a.zw.Close()
+}
+
+type tarArchiver struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarArchiver) Add(name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := a.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.tw, r)
+	return err
+}
+
+func (a *tarArchiver) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gw.Close()
+}
+
+// writeBackup writes all pages (from the storage) to a below content/, as
+// the user of r may see them (see For). With media the attachments in the
+// content directory are added and with history their previous versions
+// (below attachment-history/).
+func writeBackup(r *http.Request, a archiver, media, history bool) error {
+	ps, err := listPages()
+	if err != nil {
+		return err
+	}
+	for _, path := range ps {
+		b, err := store.Load(path)
+		if err == nil {
+			b, err = sourceFor(r, path, b)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read page '%s': %s", path, err)
+		}
+		if err = a.Add("content/"+path+Suffix, int64(len(b)), pageModTime(path), bytes.NewReader(b)); err != nil {
+			return err
+		}
+	}
+	if media {
+		err = addFiles(a, content, "content/", func(name string) bool { return !strings.HasSuffix(name, Suffix) })
+		if err != nil {
+			return err
+		}
+	}
+	if history {
+		if err = addFiles(a, os.DirFS(*attachmentHistory), "attachment-history/", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFiles adds the files of fsys (except dot files) that match (if not
+// nil) with prefix.
+func addFiles(a archiver, fsys fs.FS, prefix string, match func(name string) bool) error {
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && name != "." {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || (match != nil && !match(d.Name())) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return a.Add(prefix+name, fi.Size(), fi.ModTime(), f)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// backupHandler streams a backup of the content: GET /admin/backup with
+// format=zip (default) or format=tar.gz; media=true adds the attachments
+// and history=true their previous versions.
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	name := "gwiki-backup-" + time.Now().Format("20060102-150405")
+	var a archiver
+	switch format := r.FormValue("format"); format {
+	case "", "zip":
+		name += ".zip"
+		w.Header().Set("Content-Type", "application/zip")
+		a = &zipArchiver{zw: zip.NewWriter(w)}
+	case "tar.gz", "tgz":
+		name += ".tar.gz"
+		w.Header().Set("Content-Type", "application/gzip")
+		gw := gzip.NewWriter(w)
+		a = &tarArchiver{gw: gw, tw: tar.NewWriter(gw)}
+	default:
+		http.Error(w, fmt.Sprintf("unknown backup format '%s'", format), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	audit(r, "backup", "")
+	err := writeBackup(r, a, r.FormValue("media") == "true", r.FormValue("history") == "true")
+	if err == nil {
+		err = a.Close()
+	}
+	if err != nil {
+		// the response is partly written already, so a broken archive is
+		// all the client gets
+		logger(r.Context()).Error("Unable to write backup", "name", name, "err", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestWriteBackup(t *testing.T) {
+	defer func(s Storage) { store = s }(store)
+	store = newMemoryStorage()
+	pages := map[string]string{"a": "+++\n+++\nA\n", "docs/b": "+++\n+++\nB\n"}
+	for path, content := range pages {
+		if err := store.Save(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := map[string]string{"content/a.md": pages["a"], "content/docs/b.md": pages["docs/b"]}
+
+	var zb bytes.Buffer
+	za := &zipArchiver{zw: zip.NewWriter(&zb)}
+	if err := writeBackup(nil, za, false, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := za.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zb.Bytes()), int64(zb.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(b)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %q from zip but expected %q", got, expect)
+	}
+
+	var tb bytes.Buffer
+	gw := gzip.NewWriter(&tb)
+	ta := &tarArchiver{gw: gw, tw: tar.NewWriter(gw)}
+	if err := writeBackup(nil, ta, false, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ta.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gr, err := gzip.NewReader(&tb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(tr)
+		got[h.Name] = string(b)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %q from tar but expected %q", got, expect)
+	}
+}
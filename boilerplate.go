@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// New pages start with the front matter of the Hugo archetype of their
+// section (archetypes/<section>.md or archetypes/default.md of the site)
+// and optionally a boilerplate: <boilerplates>/<name>.md with body and
+// front matter inserted into the new page (/edit/<page>?boilerplate=<name>).
+// Archetypes and boilerplates are Go templates like in Hugo, e.g.
+//
+//	title = "{{ replace .Name "-" " " | title }}"
+//	date = {{ .Date }}
+var boilerplatesDir = flag.String("boilerplates", "./boilerplates/", "directory with body boilerplates for new pages (<name>.md)")
+
+var validBoilerplate = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// newPageData is the data of archetype and boilerplate templates.
+type newPageData struct {
+	Name    string // last path element of the page
+	Path    string
+	Section string // first path element ("" for top level pages)
+	Type    string // the section or "page"
+	Date    string // now in RFC 3339
+	File    struct{ ContentBaseName string }
+}
+
+var newPageFuncs = template.FuncMap{
+	"replace": func(s, old, new string) string { return strings.Replace(s, old, new, -1) },
+	"title":   strings.Title,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"now":     time.Now,
+}
+
+func newPageTemplateData(p string, now time.Time) *newPageData {
+	d := &newPageData{Name: path.Base(p), Path: p, Date: now.Format(time.RFC3339), Type: "page"}
+	d.File.ContentBaseName = d.Name
+	if i := strings.Index(p, "/"); i > 0 {
+		d.Section, d.Type = p[:i], p[:i]
+	}
+	return d
+}
+
+// executeNewPage executes the template file fn for a new page and parses
+// the result. It returns the front matter (maybe empty) and body.
+func executeNewPage(fn string, data *newPageData) (map[string]interface{}, []byte, error) {
+	src, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := template.New(filepath.Base(fn)).Funcs(newPageFuncs).Parse(string(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	var b bytes.Buffer
+	if err = t.Execute(&b, data); err != nil {
+		return nil, nil, err
+	}
+	pg, err := parser.ReadFrom(&b)
+	if err != nil {
+		return nil, nil, err
+	}
+	fm := make(map[string]interface{})
+	if len(pg.FrontMatter()) > 0 {
+		md, err := pg.Metadata()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing front matter of '%s': %s", fn, err)
+		}
+		if m, ok := md.(map[string]interface{}); ok {
+			fm = m
+		}
+	}
+	return fm, pg.Content(), nil
+}
+
+// archetypeFile returns the archetype of the section or the default one
+// ("" if there is none).
+func archetypeFile(section string) string {
+	dir := filepath.Join(*siteDir, "archetypes")
+	for _, name := range []string{section, "default"} {
+		if name == "" {
+			continue
+		}
+		fn := filepath.Join(dir, name+Suffix)
+		if _, err := os.Stat(fn); err == nil {
+			return fn
+		}
+	}
+	return ""
+}
+
+// applyNewPage sets the archetype front matter and the boilerplate (if
+// not empty) on the new page p. Boilerplate front matter wins.
+func applyNewPage(p *Page, boilerplate string, now time.Time) error {
+	data := newPageTemplateData(p.Path, now)
+	if fn := archetypeFile(data.Section); fn != "" {
+		fm, _, err := executeNewPage(fn, data)
+		if err != nil {
+			return fmt.Errorf("unable to apply archetype '%s': %s", fn, err)
+		}
+		for k, v := range fm {
+			p.FrontMatter[k] = v
+		}
+	}
+	if boilerplate == "" {
+		return nil
+	}
+	if !validBoilerplate.MatchString(boilerplate) {
+		return fmt.Errorf("invalid boilerplate '%s'", boilerplate)
+	}
+	fm, body, err := executeNewPage(filepath.Join(*boilerplatesDir, boilerplate+Suffix), data)
+	if err != nil {
+		return fmt.Errorf("unable to apply boilerplate '%s': %s", boilerplate, err)
+	}
+	for k, v := range fm {
+		p.FrontMatter[k] = v
+	}
+	p.Body = body
+	return nil
+}
+
+// listBoilerplates returns the names of all boilerplates.
+func listBoilerplates() []string {
+	fns, err := filepath.Glob(filepath.Join(*boilerplatesDir, "*"+Suffix))
+	if err != nil {
+		slog.Error("Unable to list boilerplates", "err", err)
+	}
+	var names []string
+	for _, fn := range fns {
+		if name := strings.TrimSuffix(filepath.Base(fn), Suffix); validBoilerplate.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Boilerplates returns the boilerplates a new page without text can start
+// with.
+func (p *Page) Boilerplates() []string {
+	if p.Revision != "" || len(bytes.TrimSpace(p.Body)) > 0 {
+		return nil
+	}
+	return listBoilerplates()
+}
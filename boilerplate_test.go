@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyNewPage(t *testing.T) {
+	dir := t.TempDir()
+	defer func(site, bp string) { *siteDir, *boilerplatesDir = site, bp }(*siteDir, *boilerplatesDir)
+	*siteDir, *boilerplatesDir = dir, filepath.Join(dir, "boilerplates")
+	for fn, content := range map[string]string{
+		"archetypes/default.md":    "+++\ntitle = \"{{ replace .Name \"-\" \" \" | title }}\"\ndraft = true\n+++\n",
+		"archetypes/blog.md":       "+++\ntitle = \"{{ .File.ContentBaseName }}\"\ntype = \"{{ .Type }}\"\n+++\n",
+		"boilerplates/adr.md":      "+++\ntags = [\"adr\"]\ndraft = false\n+++\n## Context\n\nWritten {{ .Date }}\n",
+		"boilerplates/plain.md":    "Just text\n",
+		"boilerplates/.hidden.md":  "hidden",
+		"boilerplates/no-page.txt": "no page",
+	} {
+		fn = filepath.Join(dir, fn)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names := listBoilerplates(); !reflect.DeepEqual(names, []string{"adr", "plain"}) {
+		t.Errorf("got boilerplates %q", names)
+	}
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, this := range []struct {
+		path, boilerplate string
+		fm                map[string]interface{}
+		body              string
+		ok                bool
+	}{
+		{"docs/new-page", "", map[string]interface{}{"title": "New Page", "draft": true}, "", true},
+		{"blog/first-post", "", map[string]interface{}{"title": "first-post", "type": "blog"}, "", true},
+		{"decisions/use-go", "adr", map[string]interface{}{"title": "Use Go", "draft": false, "tags": []interface{}{"adr"}}, "## Context\n\nWritten 2025-03-01T12:00:00Z\n", true},
+		{"x", "plain", map[string]interface{}{"title": "X", "draft": true}, "Just text\n", true},
+		{"x", "missing", map[string]interface{}{"title": "X", "draft": true}, "", false},
+		{"x", "../adr", map[string]interface{}{"title": "X", "draft": true}, "", false},
+	} {
+		p := NewPage(this.path)
+		err := applyNewPage(p, this.boilerplate, now)
+		if (err == nil) != this.ok {
+			t.Errorf("[%d] got error %v but expected ok=%t", i, err, this.ok)
+		}
+		if !reflect.DeepEqual(p.FrontMatter, this.fm) {
+			t.Errorf("[%d] got front matter %v but expected %v", i, p.FrontMatter, this.fm)
+		}
+		if string(p.Body) != this.body {
+			t.Errorf("[%d] got %q but expected %q", i, p.Body, this.body)
+		}
+	}
+}
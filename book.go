@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// BookLink points to a page in reading order.
+type BookLink struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
+}
+
+// BookNav is the navigation of a page in reading order.
+type BookNav struct {
+	Prev *BookLink `json:"prev"`
+	Next *BookLink `json:"next"`
+}
+
+func (p *Page) Weight() int {
+	return toInt(p.FrontMatter["weight"])
+}
+
+type bookEntry struct {
+	page    *PageInfo
+	section string // non-empty for sections
+}
+
+// bookOrder returns all non-draft pages of language lang the user of r may
+// view in reading order: depth first through the sections, each section
+// starting with its _index page, entries ordered by weight (unset weights
+// last), title and path. It only uses the index, so no page is loaded.
+func bookOrder(r *http.Request, lang string) []*PageInfo {
+	pages := make(map[string]*PageInfo)
+	for _, info := range visibleInfos(r, index.Pages(false)) {
+		if infoLang(info) == lang {
+			pages[basePath(info.Path)] = info
+		}
+	}
+	return appendSection(nil, "", pages)
+}
+
+// infoLang is like Page.Lang for an indexed page.
+func infoLang(info *PageInfo) string {
+	if l := pageLanguage(info.Path); l != "" {
+		return l
+	}
+	if l, _ := info.Params["language"].(string); l != "" {
+		return l
+	}
+	return site.DefaultLanguage
+}
+
+// isDraft is like Draft but a missing draft status isn't worth a warning.
+func isDraft(p *Page) bool {
+	d, ok := p.FrontMatter["draft"].(bool)
+	return ok && d
+}
+
+func appendSection(order []*PageInfo, section string, pages map[string]*PageInfo) []*PageInfo {
+	prefix := ""
+	if section != "" {
+		prefix = section + "/"
+	}
+	if p, ok := pages[prefix+IndexPage]; ok {
+		order = append(order, p)
+	}
+	var es []bookEntry
+	seen := make(map[string]bool)
+	for path, p := range pages {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(path, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			sub := prefix + rest[:i]
+			if !seen[sub] {
+				seen[sub] = true
+				es = append(es, bookEntry{page: pages[sub+"/"+IndexPage], section: sub})
+			}
+		} else if rest != IndexPage {
+			es = append(es, bookEntry{page: p})
+		}
+	}
+	sort.Slice(es, func(i, j int) bool { return lessEntry(es[i], es[j]) })
+	for _, e := range es {
+		if e.section != "" {
+			order = appendSection(order, e.section, pages)
+		} else {
+			order = append(order, e.page)
+		}
+	}
+	return order
+}
+
+func lessEntry(a, b bookEntry) bool {
+	wa, wb, ta, tb := 0, 0, a.section, b.section
+	if a.page != nil {
+		wa, ta = toInt(a.page.Params["weight"]), a.page.Title
+	}
+	if b.page != nil {
+		wb, tb = toInt(b.page.Params["weight"]), b.page.Title
+	}
+	if wa != wb {
+		if wa == 0 || wb == 0 {
+			return wb == 0
+		}
+		return wa < wb
+	}
+	if ta != tb {
+		return ta < tb
+	}
+	return entryPath(a) < entryPath(b)
+}
+
+func entryPath(e bookEntry) string {
+	if e.section != "" {
+		return e.section
+	}
+	return e.page.Path
+}
+
+func bookLink(info *PageInfo) *BookLink {
+	t := info.Title
+	if t == "" {
+		t = info.Path
+	}
+	return &BookLink{Path: info.Path, Title: t}
+}
+
+// Book returns the previous and next page of p in reading order.
+func (p *Page) Book() BookNav {
+	order := bookOrder(p.viewer, p.Lang())
+	nav := BookNav{}
+	for i, o := range order {
+		if o.Path != p.Path {
+			continue
+		}
+		if i > 0 {
+			nav.Prev = bookLink(order[i-1])
+		}
+		if i < len(order)-1 {
+			nav.Next = bookLink(order[i+1])
+		}
+		break
+	}
+	return nav
+}
+
+// bookHandler serves the reading order (/api/v1/book?lang=xx) or the
+// navigation of a single page (/api/v1/book/<path>).
+func bookHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/book"), "/")
+	if path != "" {
+		p, err := loadValidPage(path)
+		if err != nil || !mayView(r, path) {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, p.For(r).Book())
+		return
+	}
+	lang := r.FormValue("lang")
+	if lang == "" {
+		lang = site.DefaultLanguage
+	}
+	order := bookOrder(r, lang)
+	links := make([]*BookLink, len(order))
+	for i, info := range order {
+		links[i] = bookLink(info)
+	}
+	writeJSON(w, links)
+}
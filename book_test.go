@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBookOrder(t *testing.T) {
+	defer func(pi *pageIndex) { index = pi }(index)
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	for _, this := range []struct {
+		path string
+		fm   map[string]interface{}
+	}{
+		{"b", map[string]interface{}{"title": "B"}},
+		{"a", map[string]interface{}{"title": "A"}},
+		{"docs/_index", map[string]interface{}{"title": "Docs", "weight": 1}},
+		{"docs/intro", map[string]interface{}{"title": "Intro", "weight": int64(1)}},
+		{"docs/setup", map[string]interface{}{"title": "Setup"}},
+		{"draft", map[string]interface{}{"title": "Draft", "draft": true}},
+		{"other", map[string]interface{}{"title": "Other", "language": "xx"}},
+	} {
+		p := NewPage(this.path)
+		p.FrontMatter = this.fm
+		index.Update(p)
+	}
+	var paths []string
+	for _, info := range bookOrder(nil, site.DefaultLanguage) {
+		paths = append(paths, info.Path)
+	}
+	if got := strings.Join(paths, " "); got != "docs/_index docs/intro docs/setup a b" {
+		t.Errorf("got reading order %s", got)
+	}
+	nav := NewPage("docs/setup").Book()
+	if nav.Prev == nil || nav.Prev.Title != "Intro" || nav.Next == nil || nav.Next.Path != "a" {
+		t.Errorf("got navigation %+v", nav)
+	}
+}
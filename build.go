@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The build mode (-build <dir>) renders all published pages anonymous
+// visitors may view with the view templates into a static site, a minimal
+// publishing path without Hugo. The URLs stay those of the wiki, so the
+// site has to be served from the root of its host:
+//
+//	index.html              all pages
+//	view/<path>/index.html  the pages
+//	tags/index.html         all tags
+//	tags/<tag>/index.html   the pages with a tag
+//	files/<dir>/<name>      the attachments of the pages
+//	static/                 style sheets, scripts and images
+var buildDir = flag.String("build", "", "render all non-draft pages to a static site in this directory and exit")
+
+const StaticDir = "./static"
+
+// staticPage is the data of static.html: a rendered page or a listing of
+// pages or tags.
+type staticPage struct {
+	Title   string
+	Content template.HTML
+	Pages   []*PageInfo
+	Tags    []TagCount
+}
+
+// BuildReport counts what a build wrote.
+type BuildReport struct {
+	Pages, Tags, Files int
+}
+
+// buildPages returns the non-draft pages anonymous visitors may view.
+func buildPages() []*PageInfo {
+	var infos []*PageInfo
+	for _, info := range index.Pages(false) {
+		if acls.Allowed("anonymous", info.Path, false) {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// writeStaticPage renders sp with static.html to dir/index.html.
+func writeStaticPage(dir string, sp *staticPage) error {
+	var buf bytes.Buffer
+	if err := currentTemplates().ExecuteTemplate(&buf, "static.html", sp); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.html"), buf.Bytes(), 0644)
+}
+
+// buildPage renders the page at p (redacted) to out/view/<p>/index.html.
+func buildPage(out, p string) error {
+	pg, err := LoadPage(p)
+	if err != nil {
+		return err
+	}
+	pg = pg.Redacted()
+	var buf bytes.Buffer
+	if err = layoutFor(pg.Path, "view").ExecuteTemplate(&buf, "view.html", pg); err != nil {
+		return err
+	}
+	sp := &staticPage{Title: pg.Title(), Content: template.HTML(buf.String())}
+	return writeStaticPage(filepath.Join(out, "view", filepath.FromSlash(p)), sp)
+}
+
+// buildFiles copies the attachments in dir to out/files/<dir>.
+func buildFiles(out, dir string) (int, error) {
+	as, err := listAttachments(dir)
+	if err != nil {
+		return 0, err
+	}
+	fsys := attachmentFS(dir)
+	for _, a := range as {
+		src, err := fsys.Open(attachmentFile(dir, a.Name))
+		if err != nil {
+			return 0, err
+		}
+		err = writeFile(filepath.Join(out, "files", filepath.FromSlash(dir), a.Name), src)
+		src.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(as), nil
+}
+
+// copyStatic copies the directory src to dst.
+func copyStatic(dst, src string) error {
+	fsys := os.DirFS(src)
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return writeFile(filepath.Join(dst, filepath.FromSlash(name)), f)
+	})
+}
+
+// isTagDir reports whether tag can be used as directory name.
+func isTagDir(tag string) bool {
+	return tag != "" && tag != "." && tag != ".." && !strings.ContainsAny(tag, `/\`)
+}
+
+// buildSite renders the static site to out.
+func buildSite(out string) (*BuildReport, error) {
+	rep := &BuildReport{}
+	infos := buildPages()
+	dirs := make(map[string]bool)
+	for _, info := range infos {
+		if err := buildPage(out, info.Path); err != nil {
+			return rep, fmt.Errorf("unable to build page '%s': %s", info.Path, err)
+		}
+		rep.Pages++
+		dir := attachmentDir(info.Path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		n, err := buildFiles(out, dir)
+		if err != nil && !os.IsNotExist(err) {
+			return rep, fmt.Errorf("unable to copy the attachments of '%s': %s", dir, err)
+		}
+		rep.Files += n
+	}
+	if err := writeStaticPage(out, &staticPage{Title: site.Title, Pages: infos}); err != nil {
+		return rep, err
+	}
+	var tcs []TagCount
+	for _, tc := range index.Tags(false) {
+		var tagged []*PageInfo
+		for _, info := range index.Tagged(tc.Tag, false) {
+			if acls.Allowed("anonymous", info.Path, false) {
+				tagged = append(tagged, info)
+			}
+		}
+		if len(tagged) == 0 || !isTagDir(tc.Tag) {
+			continue
+		}
+		tcs = append(tcs, TagCount{Tag: tc.Tag, Count: len(tagged)})
+		if err := writeStaticPage(filepath.Join(out, "tags", tc.Tag), &staticPage{Title: "Tag " + tc.Tag, Pages: tagged}); err != nil {
+			return rep, err
+		}
+		rep.Tags++
+	}
+	if err := writeStaticPage(filepath.Join(out, "tags"), &staticPage{Title: "Tags", Tags: tcs}); err != nil {
+		return rep, err
+	}
+	if err := copyStatic(filepath.Join(out, "static"), StaticDir); err != nil {
+		return rep, fmt.Errorf("unable to copy the static files: %s", err)
+	}
+	return rep, nil
+}
+
+// writeBuildReport prints rep for the command line.
+func writeBuildReport(w io.Writer, out string, rep *BuildReport) {
+	fmt.Fprintf(w, "Built %d pages, %d tags and %d files in %s\n", rep.Pages, rep.Tags, rep.Files, out)
+}
+
+// runBuild renders the static site to the directory of -build.
+func runBuild() {
+	// The static site has nothing to edit or convert.
+	*readOnly = true
+	pdfBackend = nil
+	*pandocBinary = ""
+	rep, err := buildSite(*buildDir)
+	if err != nil {
+		fatal("Unable to build the static site", "dir", *buildDir, "err", err)
+	}
+	writeBuildReport(os.Stdout, *buildDir, rep)
+}
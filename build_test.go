@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildSite(t *testing.T) {
+	defer func(s Storage, pi *pageIndex, c ContentFS) { store, index, content = s, pi, c; cachedPages.Clear() }(store, index, content)
+	store = newMemoryStorage()
+	cachedPages.Clear()
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	content = newMemFS()
+	for path, src := range map[string]string{
+		"docs/setup":   "+++\ntitle = \"Setup\"\ndraft = false\ntags = [\"x\", \"a/b\"]\n+++\n![diagram](/files/docs/diagram.png) See [[other]].\n",
+		"docs/drafted": "+++\ntitle = \"Draft\"\ndraft = true\ntags = [\"y\"]\n+++\nDraft.\n",
+		"other":        "+++\ntitle = \"Other\"\ndraft = false\ntags = [\"x\"]\n+++\nOther.\n",
+	} {
+		if err := store.Save(path, []byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := content.WriteFile(attachmentFile("docs", "diagram.png"), []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Build(); err != nil {
+		t.Fatal(err)
+	}
+	defer func(ro bool) { *readOnly = ro }(*readOnly)
+	*readOnly = true
+
+	out := t.TempDir()
+	rep, err := buildSite(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *rep != (BuildReport{Pages: 2, Tags: 1, Files: 1}) {
+		t.Errorf("got report %+v", rep)
+	}
+	for fn, expect := range map[string][]string{
+		"index.html":                 {`href="/view/docs/setup/"`, `href="/view/other/"`},
+		"view/docs/setup/index.html": {"<title>Setup</title>", "<h1>Setup</h1>", `src="/files/docs/diagram.png"`, `href="/view/other"`},
+		"tags/index.html":            {`href="/tags/x/"`, "(2)"},
+		"tags/x/index.html":          {"<title>Tag x</title>", `href="/view/other/"`},
+		"files/docs/diagram.png":     {"png"},
+		"static/css/style.css":       nil,
+	} {
+		b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(fn)))
+		if err != nil {
+			t.Errorf("%s: %s", fn, err)
+			continue
+		}
+		for _, s := range expect {
+			if !strings.Contains(string(b), s) {
+				t.Errorf("%q is missing in %s: %s", s, fn, b)
+			}
+		}
+		if strings.Contains(string(b), "/edit/") || strings.Contains(string(b), "drafted") {
+			t.Errorf("%s links to editing or drafts: %s", fn, b)
+		}
+	}
+	for _, fn := range []string{"view/docs/drafted", "tags/y"} {
+		if _, err := os.Stat(filepath.Join(out, fn)); !os.IsNotExist(err) {
+			t.Errorf("%s was built", fn)
+		}
+	}
+}
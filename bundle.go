@@ -0,0 +1,72 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// writeBundle writes the page p (see For) to a as <name>/<name>.md (the
+// source), <name>/<name>.html (rendered) and the attachments next to them.
+func writeBundle(a archiver, p *Page) error {
+	name := path.Base(p.Path)
+	src, err := store.Load(p.Path)
+	if err != nil {
+		return err
+	}
+	if src, err = sourceFor(p.viewer, p.Path, src); err != nil {
+		return err
+	}
+	modTime := pageModTime(p.Path)
+	if err = a.Add(name+"/"+name+Suffix, int64(len(src)), modTime, bytes.NewReader(src)); err != nil {
+		return err
+	}
+	var html bytes.Buffer
+	if err = currentTemplates().ExecuteTemplate(&html, "bundle.html", p); err != nil {
+		return err
+	}
+	if err = a.Add(name+"/"+name+".html", int64(html.Len()), time.Now(), &html); err != nil {
+		return err
+	}
+	dir := attachmentDir(p.Path)
+	as, err := listAttachments(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, at := range as {
+		f, err := attachmentFS(dir).Open(attachmentFile(dir, at.Name))
+		if err != nil {
+			return err
+		}
+		err = a.Add(name+"/"+at.Name, at.Size, at.Time, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundleHandler serves the page with its attachments as zip
+// (/bundle/<page>).
+func bundleHandler(w http.ResponseWriter, r *http.Request, p string) {
+	pg, err := loadPage(r.Context(), p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(p)+`.zip"`)
+	a := &zipArchiver{zw: zip.NewWriter(w)}
+	err = writeBundle(a, pg.For(r))
+	if err == nil {
+		err = a.Close()
+	}
+	if err != nil {
+		// the response is partly written already
+		logger(r.Context()).Error("Unable to write bundle", "path", p, "err", err)
+	}
+}
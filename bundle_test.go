@@ -0,0 +1,58 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWriteBundle(t *testing.T) {
+	defer func(s Storage) { store = s }(store)
+	store = newMemoryStorage()
+	src := "+++\ntitle = \"Report\"\n+++\n![chart](chart.png)\n"
+	if err := store.Save("docs/report", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	defer func(c ContentFS) { content = c }(content)
+	content = newMemFS()
+	if err := content.WriteFile(attachmentFile("docs", "chart.png"), []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPage("docs/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	a := &zipArchiver{zw: zip.NewWriter(&b)}
+	if err = writeBundle(a, p); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a.Close()
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		c, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(c)
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if expect := "report/chart.png report/report.html report/report.md"; strings.Join(names, " ") != expect {
+		t.Errorf("got %q but expected %q", names, expect)
+	}
+	if files["report/report.md"] != src {
+		t.Errorf("got %q but expected the page source", files["report/report.md"])
+	}
+	if !strings.Contains(files["report/report.html"], `<img src="chart.png" alt="chart">`) {
+		t.Errorf("got %q but expected the rendered page", files["report/report.html"])
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gwiki can sit behind a CDN or Varnish: page views get Cache-Control and
+// surrogate key headers and changed pages are purged via a webhook.
+var (
+	cacheControl    = flag.String("cache-control", "", "Cache-Control header for page views, e.g. 'public, max-age=300' (empty disables caching headers)")
+	surrogateHeader = flag.String("surrogate-header", "Surrogate-Key", "header for the surrogate keys of a page (e.g. Surrogate-Key, Cache-Tag or xkey)")
+	purgeURL        = flag.String("purge-url", "", "URL called with the surrogate keys of changed pages")
+	purgeMethod     = flag.String("purge-method", "POST", "HTTP method of the purge request (e.g. POST or PURGE)")
+)
+
+// surrogateKeys returns the cache keys of a page: the page itself, all
+// sections above it (their listings show the page) and its tags.
+func surrogateKeys(p *Page) []string {
+	keys := []string{"page:" + p.Path}
+	dirs := strings.Split(p.Path, "/")
+	for i := len(dirs) - 1; i >= 0; i-- {
+		keys = append(keys, "section:"+strings.Join(dirs[:i], "/"))
+	}
+	for _, t := range p.Tags() {
+		keys = append(keys, "tag:"+tagKey(t))
+	}
+	return keys
+}
+
+func joinKeys(keys []string) string {
+	if strings.EqualFold(*surrogateHeader, "Cache-Tag") {
+		return strings.Join(keys, ",")
+	}
+	return strings.Join(keys, " ")
+}
+
+// setCacheHeaders marks the response for p as cacheable. Views of logged
+// in users (filtered by the ACL, with drafts for editors) and pages not
+// every reader gets the same way (restricted by the ACL or with private
+// parts) must not be kept by shared caches.
+func setCacheHeaders(w http.ResponseWriter, r *http.Request, p *Page) {
+	w.Header().Add("Vary", "Cookie, Authorization")
+	if !mayView(nil, p.Path) || *editors != "" && p.HasPrivate() {
+		w.Header().Set("Cache-Control", "private, no-store")
+		return
+	}
+	if *cacheControl == "" {
+		return
+	}
+	if currentUser(r) != "anonymous" {
+		w.Header().Set("Cache-Control", "private")
+		return
+	}
+	w.Header().Set("Cache-Control", *cacheControl)
+	if *surrogateHeader != "" {
+		w.Header().Set(*surrogateHeader, joinKeys(surrogateKeys(p)))
+	}
+}
+
+// purgePages asks the cache to drop everything showing one of the pages.
+// Pass the page before and after a change so removed tags are purged, too.
+// The request is sent in the background.
+func purgePages(ps ...*Page) {
+	if *purgeURL == "" {
+		return
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for _, p := range ps {
+		if p == nil {
+			continue
+		}
+		// pages linked from p show it as backlink
+		for _, k := range append(surrogateKeys(p), linkKeys(p)...) {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	goBackground(func() { sendPurge(keys) })
+}
+
+func linkKeys(p *Page) []string {
+	var keys []string
+	for _, t := range pageLinks(p) {
+		keys = append(keys, "page:"+t)
+	}
+	return keys
+}
+
+func sendPurge(keys []string) {
+	b, _ := json.Marshal(map[string][]string{"keys": keys})
+	req, err := http.NewRequest(*purgeMethod, *purgeURL, bytes.NewReader(b))
+	if err != nil {
+		slog.Error("Unable to create purge request", "url", *purgeURL, "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *surrogateHeader != "" {
+		req.Header.Set(*surrogateHeader, joinKeys(keys))
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Error("Unable to purge keys", "keys", len(keys), "url", *purgeURL, "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		slog.Error("Unable to purge keys", "keys", len(keys), "url", *purgeURL, "status", resp.Status)
+	}
+}
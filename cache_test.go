@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetCacheHeaders(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl"), []byte("secret/** view=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(c, s, e, a string) { *cacheControl, *surrogateHeader, *editors, *aclFile = c, s, e, a }(*cacheControl, *surrogateHeader, *editors, *aclFile)
+	*cacheControl, *surrogateHeader, *editors, *aclFile = "public, max-age=300", "Surrogate-Key", "alice", filepath.Join(dir, "acl")
+	acls = &aclTable{}
+	defer func() { acls = &aclTable{} }()
+
+	for i, this := range []struct {
+		path, body, user, cache, keys string
+	}{
+		{"docs/intro", "Hello", "anonymous", "public, max-age=300", "page:docs/intro section:docs section:"},
+		{"docs/intro", "Hello", "bob", "private", ""},
+		{"secret/plan", "Hello", "anonymous", "private, no-store", ""},
+		{"docs/team", "Hello\n\n::: private\nPhone: 123\n:::\n", "anonymous", "private, no-store", ""},
+	} {
+		p := NewPage(this.path)
+		p.Body = []byte(this.body)
+		w := httptest.NewRecorder()
+		setCacheHeaders(w, withUser(httptest.NewRequest("GET", "/view/"+this.path, nil), this.user), p)
+		if got := w.Header().Get("Cache-Control"); got != this.cache {
+			t.Errorf("[%d] got Cache-Control %q but expected %q", i, got, this.cache)
+		}
+		if got := w.Header().Get("Surrogate-Key"); got != this.keys {
+			t.Errorf("[%d] got Surrogate-Key %q but expected %q", i, got, this.keys)
+		}
+		if got := w.Header().Get("Vary"); got != "Cookie, Authorization" {
+			t.Errorf("[%d] got Vary %q", i, got)
+		}
+	}
+
+	// the view of a logged in user shows what only they may see
+	testSetup(t)
+	for _, path := range []string{"docs/intro", "secret/plan"} {
+		p := NewPage(path)
+		p.Body = []byte("See [intro](/view/docs/intro)")
+		if err := storePage(httptest.NewRequest("POST", "/save/"+path, nil), p, NewPage(path), ""); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	for i, user := range []string{"anonymous", "alice"} {
+		w := httptest.NewRecorder()
+		makeHandler(viewHandler)(w, withUser(httptest.NewRequest("GET", "/view/docs/intro", nil), user))
+		shared := strings.HasPrefix(w.Header().Get("Cache-Control"), "public")
+		if shows := strings.Contains(w.Body.String(), "secret/plan"); shared == (user != "anonymous") || shows != (user == "alice") {
+			t.Errorf("[%d] got Cache-Control %q for %s showing the restricted backlink %t", i, w.Header().Get("Cache-Control"), user, shows)
+		}
+	}
+}
+
+func TestPurgePages(t *testing.T) {
+	testSetup(t)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	purged := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Keys []string }
+		json.NewDecoder(r.Body).Decode(&req)
+		purged <- strings.Join(req.Keys, " ")
+	}))
+	defer ts.Close()
+	defer func(u string) { *purgeURL = u }(*purgeURL)
+	*purgeURL = ts.URL
+	next := func() string {
+		select {
+		case keys := <-purged:
+			return keys
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/save/docs/intro", nil)
+	p := NewPage("docs/intro")
+	p.Body = []byte("See [setup](setup)")
+	if err := storePage(r, p, NewPage(p.Path), ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := "page:docs/intro page:docs/setup section: section:docs"
+	if got := next(); got != expect {
+		t.Errorf("got keys %q for the save but expected %q", got, expect)
+	}
+	if err := deletePage(r, "docs/intro"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := next(); got != expect {
+		t.Errorf("got keys %q for the deletion but expected %q", got, expect)
+	}
+
+	if err := store.Save("docs/broken", []byte("\n\n---\ntitle: Broken\n---\nText\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := checkMarks(true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = "page:docs/broken section: section:docs"
+	if got := next(); got != expect {
+		t.Errorf("got keys %q for the repair but expected %q", got, expect)
+	}
+	if info, ok := index.Get("docs/broken"); !ok || info.Title != "Broken" {
+		t.Errorf("got index entry %+v for the repaired page", info)
+	}
+}
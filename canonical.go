@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// The canonical form of a page is meant for diffing and validation
+// pipelines: the same content always gives the same bytes, however the
+// file was written. It's only output, the file isn't changed.
+var (
+	canonicalPath   = flag.String("canonical", "", "print the page at this path in canonical form and exit")
+	canonicalFormat = flag.String("canonical-format", "", "front matter format of the canonical form: 'yaml', 'toml' or 'json' (default: the format of the page)")
+	canonicalOrder  = flag.String("canonical-order", "sorted", "order of the front matter keys in the canonical form: 'sorted' or 'schema' (common Hugo fields, then the schema fields, then the rest sorted)")
+)
+
+// schemaKeyOrder are the common Hugo front matter fields in the order of
+// the canonical form with -canonical-order schema.
+var schemaKeyOrder = []string{"title", "description", "date", "lastmod", "draft", "id", "tags", "categories", "aliases", "language", "translationKey"}
+
+// canonicalKeys returns the front matter keys of p in canonical order.
+func canonicalKeys(p *Page, order string) ([]string, error) {
+	keys := make([]string, 0, len(p.FrontMatter))
+	for k := range p.FrontMatter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	switch order {
+	case "", "sorted":
+		return keys, nil
+	case "schema":
+	default:
+		return nil, fmt.Errorf("unknown key order '%s'", order)
+	}
+	first := append([]string(nil), schemaKeyOrder...)
+	for _, f := range schema.FieldsFor(p.Path) {
+		first = append(first, f.Name)
+	}
+	ordered := make([]string, 0, len(keys))
+	seen := make(map[string]bool)
+	for _, k := range first {
+		if _, ok := p.FrontMatter[k]; ok && !seen[k] {
+			ordered = append(ordered, k)
+			seen[k] = true
+		}
+	}
+	for _, k := range keys {
+		if !seen[k] {
+			ordered = append(ordered, k)
+		}
+	}
+	return ordered, nil
+}
+
+// canonicalBody normalizes line ends and whitespace independent of the
+// flags for saving: no trailing whitespace (except Markdown hard line
+// breaks), no leading or trailing blank lines and a final newline.
+func canonicalBody(body []byte) []byte {
+	body = bytes.Replace(body, []byte("\r\n"), []byte("\n"), -1)
+	lines := bytes.Split(body, []byte("\n"))
+	for i, l := range lines {
+		lines[i] = trimLine(l)
+	}
+	body = bytes.Trim(bytes.Join(lines, []byte("\n")), "\n")
+	if len(body) > 0 {
+		body = append(body, '\n')
+	}
+	return body
+}
+
+// canonicalPage returns p in canonical form with the front matter in format
+// (empty for the format of p) and its keys in order.
+func canonicalPage(p *Page, format, order string) ([]byte, error) {
+	mark := p.Mark
+	if format != "" {
+		switch strings.ToLower(format) {
+		case "yaml", "yml", "toml", "json":
+			mark = parser.FormatToLeadRune(format)
+		default:
+			return nil, fmt.Errorf("unknown front matter format '%s'", format)
+		}
+	}
+	keys, err := canonicalKeys(p, order)
+	if err != nil {
+		return nil, err
+	}
+	fm, err := parser.InterfaceToOrderedFrontMatter(p.FrontMatter, keys, mark)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate front matter for page '%s': %s", p.Path, err)
+	}
+	body := canonicalBody(p.Body)
+	var b bytes.Buffer
+	b.Write(fm)
+	if len(body) > 0 {
+		b.WriteString("\n")
+	}
+	b.Write(body)
+	return b.Bytes(), nil
+}
+
+// canonicalHandler serves /api/v1/canonical/<page>?format=&order=.
+func canonicalHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/canonical"), "/")
+	p, err := loadValidPage(path)
+	if err != nil || !tokenAllows(r, path) {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := canonicalPage(p.For(r), r.FormValue("format"), r.FormValue("order"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write(b)
+}
+
+// printCanonical implements -canonical.
+func printCanonical() {
+	p, err := loadValidPage(*canonicalPath)
+	if err == nil {
+		var b []byte
+		if b, err = canonicalPage(p, *canonicalFormat, *canonicalOrder); err == nil {
+			os.Stdout.Write(b)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalPage(t *testing.T) {
+	defer func(s *Schema) { schema = s }(schema)
+	schema = &Schema{Fields: []*Field{{Name: "owner", Widget: WidgetText}}}
+	fm := map[string]interface{}{"zeta": 1, "tags": []interface{}{"b", "a"}, "owner": "alice", "title": "T", "params": map[string]interface{}{"y": 2, "x": 1}}
+	body := "\r\n\r\nLine  \r\nhard break  \r\ntrailing \t\r\n\r\n\r\n"
+	for i, this := range []struct {
+		mark          rune
+		format, order string
+		expect        string
+	}{
+		{'-', "", "", "---\nowner: alice\nparams:\n  x: 1\n  \"y\": 2\ntags:\n- b\n- a\ntitle: T\nzeta: 1\n---\n\nLine  \nhard break  \ntrailing\n"},
+		{'-', "", "schema", "---\ntitle: T\ntags:\n- b\n- a\nowner: alice\nparams:\n  x: 1\n  \"y\": 2\nzeta: 1\n---\n\nLine  \nhard break  \ntrailing\n"},
+		{'-', "json", "schema", "{\n   \"title\": \"T\",\n   \"tags\": [\n      \"b\",\n      \"a\"\n   ],\n   \"owner\": \"alice\",\n   \"params\": {\n      \"x\": 1,\n      \"y\": 2\n   },\n   \"zeta\": 1\n}\n\nLine  \nhard break  \ntrailing\n"},
+		{'+', "", "schema", "+++\ntitle = \"T\"\ntags = [\"b\", \"a\"]\nowner = \"alice\"\nzeta = 1\n\n[params]\n  x = 1\n  y = 2\n+++\n\nLine  \nhard break  \ntrailing\n"},
+	} {
+		p := &Page{Path: "a", Mark: this.mark, FrontMatter: fm, Body: []byte(body)}
+		got, err := canonicalPage(p, this.format, this.order)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		if string(got) != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+	if _, err := canonicalPage(&Page{Mark: '-', FrontMatter: fm}, "xml", ""); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
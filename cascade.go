@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+)
+
+// IndexPage is the name of the page holding the front matter of a section.
+const IndexPage = "_index"
+
+// cascadeCache caches the cascade front matter of sections during one request.
+type cascadeCache map[string]map[string]interface{}
+
+// cascadeFor returns the front matter defaults a page at path inherits from
+// the "cascade" maps in the _index pages of all its ancestor sections
+// (just like Hugo does). Nearer sections win.
+func cascadeFor(path string, cache cascadeCache) map[string]interface{} {
+	defaults := make(map[string]interface{})
+	dirs := strings.Split(path, "/")
+	dirs = dirs[:len(dirs)-1]
+	for i := 0; i <= len(dirs); i++ {
+		idx := strings.Join(append(dirs[:i:i], IndexPage), "/")
+		if idx == path {
+			break
+		}
+		for k, v := range sectionCascade(idx, cache) {
+			defaults[k] = v
+		}
+	}
+	return defaults
+}
+
+func sectionCascade(idx string, cache cascadeCache) map[string]interface{} {
+	if c, ok := cache[idx]; ok {
+		return c
+	}
+	var c map[string]interface{}
+	if p, err := LoadPage(idx); err == nil {
+		c = lowerKeys(p.FrontMatter["cascade"])
+	}
+	if cache != nil {
+		cache[idx] = c
+	}
+	return c
+}
+
+// applyDefaults sets all defaults not already set in the front matter of p.
+func applyDefaults(p *Page, defaults map[string]interface{}) {
+	for k, v := range defaults {
+		if _, ok := p.FrontMatter[k]; !ok {
+			p.FrontMatter[k] = v
+		}
+	}
+}
+
+// Effective returns a copy of p with the inherited defaults applied.
+func (p *Page) Effective(cache cascadeCache) *Page {
+	e := p.Copy()
+	applyDefaults(e, cascadeFor(p.Path, cache))
+	return e
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCascadeFor(t *testing.T) {
+	testSetup(t)
+	r := httptest.NewRequest("POST", "/save/", nil)
+	for path, cascade := range map[string]map[string]interface{}{
+		IndexPage:                  {"layout": "root", "license": "CC-BY", "toc": true},
+		"docs/" + IndexPage:        {"layout": "docs", "Owner": "alice"},
+		"docs/api/" + IndexPage:    {"layout": "api"},
+		"blog/" + IndexPage:        nil,
+		"docs/guides/" + IndexPage: {"toc": false},
+	} {
+		p := NewPage(path)
+		if cascade != nil {
+			p.FrontMatter["cascade"] = cascade
+		}
+		if err := storePage(r, p, NewPage(path), ""); err != nil {
+			t.Fatalf("unable to store %s: %s", path, err)
+		}
+	}
+
+	cache := make(cascadeCache)
+	for i, this := range []struct {
+		path   string
+		expect map[string]interface{}
+	}{
+		{"about", map[string]interface{}{"layout": "root", "license": "CC-BY", "toc": true}},
+		{IndexPage, map[string]interface{}{}},
+		{"docs/" + IndexPage, map[string]interface{}{"layout": "root", "license": "CC-BY", "toc": true}},
+		{"docs/intro", map[string]interface{}{"layout": "docs", "license": "CC-BY", "toc": true, "owner": "alice"}},
+		{"docs/api/v1", map[string]interface{}{"layout": "api", "license": "CC-BY", "toc": true, "owner": "alice"}},
+		{"docs/guides/setup/linux", map[string]interface{}{"layout": "docs", "license": "CC-BY", "toc": false, "owner": "alice"}},
+		{"blog/post", map[string]interface{}{"layout": "root", "license": "CC-BY", "toc": true}},
+	} {
+		for _, c := range []cascadeCache{nil, cache} {
+			if got := cascadeFor(this.path, c); !reflect.DeepEqual(got, this.expect) {
+				t.Errorf("[%d] got %v for %s but expected %v", i, got, this.path, this.expect)
+			}
+		}
+	}
+
+	// the page's own front matter wins over the cascade
+	p := NewPage("docs/api/v2")
+	p.FrontMatter["layout"] = "v2"
+	e := p.Effective(cache)
+	if e.FrontMatter["layout"] != "v2" || e.FrontMatter["owner"] != "alice" {
+		t.Errorf("got effective front matter %v", e.FrontMatter)
+	}
+	if _, ok := p.FrontMatter["owner"]; ok {
+		t.Errorf("got the cascade applied to the page itself")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	ChangesDefaultLimit = 50
+	ChangesMaxLimit     = 1000
+)
+
+// Change is a recently modified page. The modification time comes from
+// the file so changes made outside of gwiki (e.g. via git) show up, too.
+// User and summary come from the last save in the audit log (if any),
+// which also tells whether the page was published (its draft status
+// cleared).
+type Change struct {
+	Path      string
+	Title     string
+	Time      time.Time
+	User      string
+	Summary   string
+	Published bool
+}
+
+// recentChanges returns all pages the user of r may view, most recently
+// modified first.
+func recentChanges(r *http.Request, drafts bool) []*Change {
+	var cs []*Change
+	for _, info := range index.Pages(drafts) {
+		if !mayView(r, info.Path) {
+			continue
+		}
+		t := pageModTime(info.Path)
+		if t.IsZero() {
+			continue
+		}
+		cs = append(cs, &Change{Path: info.Path, Title: info.Title, Time: t})
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Time.After(cs[j].Time) })
+	return cs
+}
+
+// addAuthors fills in user and summary of cs from the audit log. It only
+// reads the log back to the last save of each change.
+func addAuthors(cs []*Change) error {
+	todo := make(map[string]*Change)
+	for _, c := range cs {
+		todo[c.Path] = c
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+	return scanAudit(func(e *AuditEntry) bool { // newest first
+		c, ok := todo[e.Path]
+		if !ok || e.Action != "save" {
+			return true
+		}
+		delete(todo, e.Path)
+		c.User, c.Summary = e.User, e.Summary
+		for _, fc := range e.Changes {
+			if fc.Key == "draft" && fc.New == "false" {
+				c.Published = true
+			}
+		}
+		return len(todo) > 0
+	})
+}
+
+type changesData struct {
+	Drafts  bool
+	Changes []*Change
+	Pagination
+}
+
+// changesHandler lists the recently changed pages (/changes?offset=&limit=&drafts=true).
+func changesHandler(w http.ResponseWriter, r *http.Request) {
+	data := changesData{Drafts: r.FormValue("drafts") == "true"}
+	cs := recentChanges(r, data.Drafts)
+	data.Pagination = paginate(r, len(cs), ChangesDefaultLimit, ChangesMaxLimit)
+	start, end := data.Bounds()
+	data.Changes = cs[start:end]
+	if err := addAuthors(data.Changes); err != nil {
+		logger(r.Context()).Error("Unable to read the audit log for recent changes", "err", err)
+	}
+	renderTemplate(w, "changes", data)
+}
+
+// changesFeedHandler serves the recent changes as Atom feed
+// (/changes.atom?drafts=true) with links to the pages and their changes
+// since the last snapshot.
+func changesFeedHandler(w http.ResponseWriter, r *http.Request) {
+	cs := recentChanges(r, r.FormValue("drafts") == "true")
+	if len(cs) > ChangesDefaultLimit {
+		cs = cs[:ChangesDefaultLimit]
+	}
+	if err := addAuthors(cs); err != nil {
+		logger(r.Context()).Error("Unable to read the audit log for recent changes", "err", err)
+	}
+	base := baseURL(r)
+	f := &atomFeed{
+		ID:      base + r.URL.RequestURI(),
+		Title:   "Recent changes",
+		Updated: atomTime(time.Now()),
+		Links:   []atomLink{{Rel: "self", Href: base + r.URL.RequestURI()}, {Rel: "alternate", Href: base + "/changes"}},
+	}
+	if site.Title != "" {
+		f.Title = site.Title + ": " + f.Title
+	}
+	if len(cs) > 0 {
+		f.Updated = atomTime(cs[0].Time)
+	}
+	for _, c := range cs {
+		title := c.Title
+		if title == "" {
+			title = c.Path
+		}
+		if c.Published {
+			title = "Published: " + title
+		}
+		user := c.User
+		if user == "" {
+			user = "unknown"
+		}
+		f.Entries = append(f.Entries, atomEntry{
+			ID:      fmt.Sprintf("%s/changes/%d/%s", base, c.Time.UnixNano(), c.Path),
+			Title:   title,
+			Updated: atomTime(c.Time),
+			Author:  &atomAuthor{Name: user},
+			Links: []atomLink{
+				{Href: base + "/view/" + c.Path},
+				{Rel: "related", Href: base + "/diff/" + c.Path + "?since=snapshot"},
+			},
+			Summary: c.Summary,
+		})
+	}
+	writeAtom(w, f)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAddAuthors(t *testing.T) {
+	testSetup(t)
+	logAudit(&AuditEntry{User: "carol", Action: "save", Path: "a", Summary: "first"})
+	logAudit(&AuditEntry{User: "alice", Action: "save", Path: "a", Summary: "typo"})
+	for i := 0; i < 2000; i++ {
+		logAudit(&AuditEntry{User: "dave", Action: "save", Path: fmt.Sprintf("other%d", i)})
+	}
+	logAudit(&AuditEntry{User: "bob", Action: "save", Path: "b", Changes: []FieldChange{{Key: "draft", Old: "true", New: "false"}}})
+	logAudit(&AuditEntry{User: "eve", Action: "view", Path: "a"})
+
+	cs := []*Change{{Path: "a"}, {Path: "b"}, {Path: "c"}}
+	if err := addAuthors(cs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i, expect := range []Change{
+		{Path: "a", User: "alice", Summary: "typo"},
+		{Path: "b", User: "bob", Published: true},
+		{Path: "c"},
+	} {
+		if *cs[i] != expect {
+			t.Errorf("[%d] got %+v but expected %+v", i, *cs[i], expect)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Section pages (_index) list their sections and pages below the content.
+// Front matter can change that:
+//   children = false           no listing
+//   childrenSort = "date"      newest first ("title" and "weight" work, too;
+//                              default is sections first, then by name)
+//   childrenLimit = 10         only the first 10 entries
+
+const SummaryLength = 200
+
+// ChildPage is an entry in the listing of a section page.
+type ChildPage struct {
+	Path    string
+	Title   string
+	Date    string
+	Summary string
+	Section bool
+	Draft   bool
+	weight  int
+}
+
+// Children returns the listing for a section page or nil for other pages.
+func (p *Page) Children() []ChildPage {
+	if path.Base(p.Path) != IndexPage {
+		return nil
+	}
+	if show, ok := p.FrontMatter["children"].(bool); ok && !show {
+		return nil
+	}
+	dir := strings.TrimSuffix(strings.TrimSuffix(p.Path, IndexPage), "/")
+	cs := sectionChildren(p.viewer, dir, false)
+	switch getString(p, "childrenSort") {
+	case "date":
+		sort.SliceStable(cs, func(i, j int) bool { return cs[i].Date > cs[j].Date })
+	case "title":
+		sort.SliceStable(cs, func(i, j int) bool { return strings.ToLower(cs[i].Title) < strings.ToLower(cs[j].Title) })
+	case "weight":
+		sort.SliceStable(cs, func(i, j int) bool { return cs[i].weight < cs[j].weight })
+	}
+	if limit := toInt(p.FrontMatter["childrenLimit"]); limit > 0 && len(cs) > limit {
+		cs = cs[:limit]
+	}
+	return cs
+}
+
+// sectionChildren returns the sections and pages directly below dir the
+// user of r may view, sections first and both by name.
+func sectionChildren(r *http.Request, dir string, drafts bool) []ChildPage {
+	node := contentTree(r, drafts).find(dir)
+	if node == nil {
+		return nil
+	}
+	var cs []ChildPage
+	for _, n := range node.Children {
+		target := n.Path
+		if n.Section {
+			target = n.Path + "/" + IndexPage
+		}
+		c := ChildPage{Path: n.Path, Title: n.Title, Section: n.Section, Draft: n.Draft}
+		if c.Title == "" {
+			c.Title = n.Name
+		}
+		if !mayView(r, target) {
+			cs = append(cs, c)
+			continue
+		}
+		if info, ok := index.Get(target); ok {
+			c.Date = info.Date
+		}
+		if cp, err := LoadPage(target); err == nil {
+			c.Summary = summary(cp.For(r))
+			c.weight = cp.Weight()
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// summary returns the description of p or the start of its first
+// paragraph.
+func summary(p *Page) string {
+	if d := p.Description(); d != "" {
+		return d
+	}
+	for _, para := range bytes.Split(p.Body, []byte("\n\n")) {
+		s := strings.Join(strings.Fields(string(para)), " ")
+		if s == "" || strings.HasPrefix(s, "#") || strings.HasPrefix(s, "{{") || strings.HasPrefix(s, "```") {
+			continue
+		}
+		if rs := []rune(s); len(rs) > SummaryLength {
+			s = string(rs[:SummaryLength])
+			if i := strings.LastIndex(s, " "); i > 0 {
+				s = s[:i]
+			}
+			s += " …"
+		}
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	long := strings.Repeat("word ", 60)
+	for i, this := range []struct {
+		description string
+		body        string
+		expect      string
+	}{
+		{"The description", "Body text", "The description"},
+		{"", "# Heading\n\nFirst\nparagraph.\n\nSecond.", "First paragraph."},
+		{"", "{{< toc >}}\n\n```go\ncode\n```\n\nText", "Text"},
+		{"", long, strings.TrimSpace(long[:strings.LastIndex(long[:SummaryLength], " ")]) + " …"},
+		{"", "", ""},
+	} {
+		p := NewPage("a")
+		p.SetDescription(this.description)
+		p.Body = []byte(this.body)
+		if result := summary(p); result != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+}
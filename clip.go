@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// The web clipper creates a draft page from a web page (POST /api/v1/clip
+// with url): the main content is extracted like readability does, converted
+// to Markdown and its images are downloaded next to the page. Only public
+// addresses are fetched unless -clip-private-hosts is set.
+var (
+	clipSection      = flag.String("clip-section", "clips", "section clipped web pages are created in")
+	clipMaxSize      = flag.Int64("clip-max-size", 5<<20, "maximum size in bytes of a clipped web page and each of its images")
+	clipPrivateHosts = flag.Bool("clip-private-hosts", false, "allow clipping web pages from loopback and private network addresses")
+)
+
+const (
+	ClipPath      = "/api/v1/clip"
+	ClipMaxImages = 50
+)
+
+var (
+	// clipUnlikely matches the class or id of elements that aren't content
+	// unless clipMaybe matches too.
+	clipUnlikely = regexp.MustCompile(`(?i)comment|sidebar|footer|\bnav|menu|share|social|advert|\bads?\b|promo|related|cookie|banner|popup|subscribe|newsletter|breadcrumb`)
+	clipMaybe    = regexp.MustCompile(`(?i)article|body|content|main|post|entry`)
+)
+
+// clipDropped are removed from the content with their children.
+var clipDropped = setOf("nav aside footer form iframe object embed noscript button dialog")
+
+var clipClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: clipDialControl}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// ClipResult is the page created from a web page with its downloaded
+// images and the ones that are still loaded from the web.
+type ClipResult struct {
+	Path     string   `json:"path"`
+	Status   string   `json:"status"` // "applied" or "review"
+	Title    string   `json:"title"`
+	Source   string   `json:"source"`
+	Images   []string `json:"images"`
+	Problems []string `json:"problems"`
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598) which
+// netip.Addr doesn't count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// clipDialControl refuses connections to addresses that aren't public.
+func clipDialControl(network, address string, _ syscall.RawConn) error {
+	if *clipPrivateHosts {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err == nil {
+		ip = ip.Unmap()
+	}
+	if err != nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("address %s isn't public", host)
+	}
+	return nil
+}
+
+// clipFetch returns the content at u, the URL after redirects and the
+// media type.
+func clipFetch(ctx context.Context, u string) ([]byte, *url.URL, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	req.Header.Set("User-Agent", "gwiki-clipper")
+	resp, err := clipClient.Do(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, "", fmt.Errorf("fetching '%s' failed: %s", u, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, *clipMaxSize+1))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if int64(len(b)) > *clipMaxSize {
+		return nil, nil, "", fmt.Errorf("'%s' is larger than %d bytes", u, *clipMaxSize)
+	}
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return b, resp.Request.URL, mt, nil
+}
+
+// clipTitle returns the title of the document: og:title, the title element
+// or the first h1.
+func clipTitle(doc *html.Node) string {
+	var og, title, h1 string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "meta" && attr(n, "property") == "og:title" && og == "":
+				og = attr(n, "content")
+			case n.Data == "title" && title == "":
+				title = textContent(n)
+			case n.Data == "h1" && h1 == "":
+				h1 = textContent(n)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	for _, t := range []string{og, title, h1} {
+		if t = oneLine(t); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// clipClean removes the elements of n that aren't content and makes lazy
+// loaded images load their source.
+func clipClean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			idClass := attr(c, "id") + " " + attr(c, "class")
+			switch {
+			case clipDropped[c.Data] || droppedElements[c.Data] || hasAttr(c, "hidden") || attr(c, "aria-hidden") == "true":
+				n.RemoveChild(c)
+			case c.Data != "body" && c.Data != "article" && c.Data != "main" && clipUnlikely.MatchString(idClass) && !clipMaybe.MatchString(idClass):
+				n.RemoveChild(c)
+			default:
+				if c.Data == "img" {
+					if src := attr(c, "data-src"); src != "" && (attr(c, "src") == "" || strings.HasPrefix(attr(c, "src"), "data:")) {
+						setAttr(c, "src", src)
+					}
+				}
+				clipClean(c)
+			}
+		}
+		c = next
+	}
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// clipContent returns the element of the cleaned document doc with the
+// main content: the only article or else the parent of the most and
+// longest paragraphs.
+func clipContent(doc *html.Node) *html.Node {
+	var articles, candidates []*html.Node
+	var body *html.Node
+	scores := make(map[*html.Node]float64)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "article":
+				articles = append(articles, n)
+			case "body":
+				body = n
+			case "p", "pre", "blockquote":
+				text := strings.TrimSpace(textContent(n))
+				if len(text) < 25 {
+					break
+				}
+				score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text)/100), 3)
+				for i, a := 0, n.Parent; i < 2 && a != nil && a.Type == html.ElementNode; i, a = i+1, a.Parent {
+					if _, ok := scores[a]; !ok {
+						candidates = append(candidates, a)
+					}
+					scores[a] += score / float64(i+1)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if len(articles) == 1 {
+		return articles[0]
+	}
+	var best *html.Node
+	for _, c := range candidates {
+		if best == nil || scores[c] > scores[best] {
+			best = c
+		}
+	}
+	if best != nil {
+		return best
+	}
+	if body != nil {
+		return body
+	}
+	return doc
+}
+
+// clipper downloads the images of a clipped page next to it.
+type clipper struct {
+	r       *http.Request
+	page    *Page
+	base    *url.URL
+	images  map[string]string // local URLs by remote URL
+	pending []clipImage       // downloaded images, stored once the page is saved
+	res     *ClipResult
+}
+
+// clipImage is a downloaded image of a clipped page.
+type clipImage struct {
+	dir, name string
+	content   io.Reader
+}
+
+// link returns the absolute URL of the link href or the local URL of the
+// downloaded image src.
+func (c *clipper) link(href string, image bool) string {
+	u, err := c.base.Parse(href)
+	if err != nil || strings.HasPrefix(href, "#") || (u.Scheme != "http" && u.Scheme != "https" && (image || u.Scheme != "mailto")) {
+		return "" // anchors on the clipped page are gone
+	}
+	if !image {
+		return u.String()
+	}
+	if local, ok := c.images[u.String()]; ok {
+		return local
+	}
+	local, err := c.download(u)
+	if err != nil {
+		c.res.Problems = append(c.res.Problems, fmt.Sprintf("image '%s' isn't downloaded: %s", u, err))
+		local = u.String()
+	}
+	c.images[u.String()] = local
+	return local
+}
+
+// download fetches the image at u to be stored next to the page and
+// returns its URL.
+func (c *clipper) download(u *url.URL) (string, error) {
+	if len(c.pending) >= ClipMaxImages {
+		return "", fmt.Errorf("more than %d images", ClipMaxImages)
+	}
+	b, _, mt, err := clipFetch(c.r.Context(), u.String())
+	if err != nil {
+		return "", err
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if !imageExtensions[ext] {
+		exts, _ := mime.ExtensionsByType(mt)
+		if len(exts) == 0 || !strings.HasPrefix(mt, "image/") {
+			return "", fmt.Errorf("no image but '%s'", mt)
+		}
+		ext = exts[0]
+	}
+	dir := attachmentDir(c.page.Path)
+	base := slugify(strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path)))
+	if base == "" {
+		base = "image"
+	}
+	name := path.Base(c.page.Path) + "-" + base + ext
+	for i := 2; ; i++ {
+		if _, err := attachmentFS(dir).Stat(attachmentFile(dir, name)); os.IsNotExist(err) && !c.isPending(name) {
+			break
+		}
+		name = fmt.Sprintf("%s-%s-%d%s", path.Base(c.page.Path), base, i, ext)
+	}
+	if !tokenAllows(c.r, path.Join(dir, name)) || !acls.Allowed(currentUser(c.r), path.Join(dir, name), true) {
+		return "", fmt.Errorf("not allowed to upload to '%s'", dir)
+	}
+	content, err := uploadPolicy(dir).checkUpload(name, int64(len(b)), bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	c.pending = append(c.pending, clipImage{dir: dir, name: name, content: content})
+	return path.Join("/files", dir, name), nil
+}
+
+func (c *clipper) isPending(name string) bool {
+	for _, img := range c.pending {
+		if img.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// store stores the downloaded images after the page was saved, so failed
+// clips leave no attachments behind.
+func (c *clipper) store() {
+	for _, img := range c.pending {
+		if err := saveAttachment(img.dir, img.name, img.content); err != nil {
+			c.res.Problems = append(c.res.Problems, fmt.Sprintf("image '%s' isn't stored: %s", img.name, err))
+			continue
+		}
+		audit(c.r, "upload", path.Join(img.dir, img.name))
+		c.res.Images = append(c.res.Images, path.Join(img.dir, img.name))
+	}
+}
+
+// clipHandler creates a draft page from a web page (POST /api/v1/clip with
+// url and optionally section, title and tags separated by commas).
+func clipHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	src, err := url.Parse(r.FormValue("url"))
+	if err != nil || (src.Scheme != "http" && src.Scheme != "https") || src.Host == "" {
+		http.Error(w, fmt.Sprintf("invalid url '%s'", r.FormValue("url")), http.StatusBadRequest)
+		return
+	}
+	section := strings.Trim(r.FormValue("section"), "/")
+	if section == "" {
+		section = *clipSection
+	}
+	if checkPath(section) != nil {
+		http.Error(w, fmt.Sprintf("invalid section '%s'", section), http.StatusBadRequest)
+		return
+	}
+	// Permissions are checked on the section before anything is fetched.
+	if !tokenAllows(r, section+"/") || !acls.Allowed(currentUser(r), section+"/", true) {
+		http.Error(w, fmt.Sprintf("not allowed to create pages in '%s'", section), http.StatusForbidden)
+		return
+	}
+	b, final, mt, err := clipFetch(r.Context(), src.String())
+	if err == nil && mt != "text/html" && mt != "application/xhtml+xml" {
+		err = fmt.Errorf("'%s' is no web page but '%s'", src, mt)
+	}
+	var doc *html.Node
+	if err == nil {
+		doc, err = html.Parse(bytes.NewReader(b))
+	}
+	if err != nil {
+		logger(r.Context()).Info("Unable to clip web page", "url", src.String(), "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if base := findElement(doc, "base"); base != nil && attr(base, "href") != "" {
+		if u, err := final.Parse(attr(base, "href")); err == nil {
+			final = u
+		}
+	}
+	title := oneLine(r.FormValue("title"))
+	if title == "" {
+		if title = clipTitle(doc); title == "" {
+			title = final.Host
+		}
+	}
+	slug := slugify(title)
+	if len(slug) > MicropubSlugMax {
+		slug = strings.Trim(slug[:MicropubSlugMax], "-")
+	}
+	p := NewPage(unusedPath(section, slug))
+	p.FrontMatter["title"] = title
+	p.FrontMatter["draft"] = true
+	p.FrontMatter["source"] = final.String()
+	p.FrontMatter["date"] = time.Now().UTC().Truncate(time.Second)
+	var tags []interface{}
+	for _, t := range strings.Split(r.FormValue("tags"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	if tags != nil {
+		p.FrontMatter["tags"] = tags
+	}
+	res := &ClipResult{Path: p.Path, Title: title, Source: final.String(), Images: []string{}, Problems: []string{}}
+	c := &clipper{r: r, page: p, base: final, images: make(map[string]string), res: res}
+	clipClean(doc)
+	content := clipContent(doc)
+	if h := findElement(content, "h1"); h != nil && oneLine(textContent(h)) == title {
+		h.Parent.RemoveChild(h)
+	}
+	body := htmlToMarkdown(content, c.link)
+	edit := QueuedEdit{Path: p.Path, FrontMatter: p.FrontMatter, Body: &body, Summary: "Clipped from " + final.String()}
+	er := applyEdits(r, []QueuedEdit{edit})[0]
+	if er.Status != "applied" && er.Status != "review" {
+		logger(r.Context()).Info("Unable to save clipped web page", "url", final.String(), "path", p.Path, "err", er.Error)
+		http.Error(w, er.Error, http.StatusBadRequest)
+		return
+	}
+	res.Status = er.Status
+	c.store()
+	logger(r.Context()).Info("Clipped web page", "url", final.String(), "path", p.Path, "images", len(res.Images))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Location", baseURL(r)+"/view/"+p.Path)
+	if er.Status == "review" {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	writeJSON(w, res)
+}
+
+// findElement returns the first element below n with the name tag.
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if f := findElement(c, tag); f != nil {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const clipTestPage = `<html><head><title>Site | Post</title><meta property="og:title" content="The Post"></head><body>
+<header><nav><a href="/">Home</a></nav></header>
+<div class="sidebar"><p>Popular posts, recent posts, all posts and more posts.</p></div>
+<div id="main-content"><h1>The Post</h1>
+<p>First paragraph with enough text, commas, and <a href="/other">a link</a>.</p>
+<p>Second paragraph with enough text to count. <img data-src="img/pic.png" src="data:image/gif;base64,R0lGOD" alt="Pic"></p>
+<p hidden>Hidden paragraph with enough text to count.</p>
+<div class="share-buttons">Share this</div></div>
+<footer><p>Copyright by somebody, some year, somewhere else.</p></footer></body></html>`
+
+func TestClipContent(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(clipTestPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := clipTitle(doc); title != "The Post" {
+		t.Errorf("got title %q", title)
+	}
+	clipClean(doc)
+	content := clipContent(doc)
+	var images []string
+	md := htmlToMarkdown(content, func(href string, image bool) string {
+		if image {
+			images = append(images, href)
+			return "/files/clips/pic.png"
+		}
+		return "https://example.com" + href
+	})
+	expect := "# The Post\n\nFirst paragraph with enough text, commas, and [a link](https://example.com/other).\n\n" +
+		"Second paragraph with enough text to count. ![Pic](/files/clips/pic.png)\n"
+	if md != expect {
+		t.Errorf("got %q but expected %q", md, expect)
+	}
+	if len(images) != 1 || images[0] != "img/pic.png" {
+		t.Errorf("got images %v", images)
+	}
+
+	doc, _ = html.Parse(strings.NewReader("<body><article><p>Short</p></article><div><p>Long enough text outside of the article.</p></div></body>"))
+	if a := clipContent(doc); a.Data != "article" {
+		t.Errorf("got %s instead of the article", a.Data)
+	}
+}
+
+func TestClipFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/page", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<p>Hi</p>"))
+	}))
+	defer ts.Close()
+	if _, _, _, err := clipFetch(context.Background(), ts.URL+"/moved"); err == nil || !strings.Contains(err.Error(), "isn't public") {
+		t.Errorf("expected the loopback address to be refused but got %v", err)
+	}
+	defer func(v bool) { *clipPrivateHosts = v }(*clipPrivateHosts)
+	*clipPrivateHosts = true
+	b, u, mt, err := clipFetch(context.Background(), ts.URL+"/moved")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(b) != "<p>Hi</p>" || u.Path != "/page" || mt != "text/html" {
+		t.Errorf("got %q from %s as %s", b, u, mt)
+	}
+}
+
+func TestClipDialControl(t *testing.T) {
+	for i, this := range []struct {
+		address string
+		ok      bool
+	}{
+		{"93.184.216.34:80", true},
+		{"[2606:2800:220:1::1]:443", true},
+		{"100.63.255.255:80", true},
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:80", false},
+		{"100.64.0.1:80", false},
+		{"100.127.255.254:443", false},
+		{"169.254.169.254:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:100.64.0.1]:80", false},
+		{"[fd00::1]:80", false},
+		{"0.0.0.0:80", false},
+	} {
+		if err := clipDialControl("tcp", this.address, nil); (err == nil) != this.ok {
+			t.Errorf("[%d] got %v for %s", i, err, this.address)
+		}
+	}
+}
+
+func TestClipHandlerImages(t *testing.T) {
+	testSetup(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/img/pic.png" {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(clipTestPage))
+	}))
+	defer ts.Close()
+	defer func(v bool, n int64) { *clipPrivateHosts, *maxPageSize = v, n }(*clipPrivateHosts, *maxPageSize)
+	*clipPrivateHosts = true
+
+	for i, this := range []struct {
+		maxSize int64
+		code    int
+		stored  bool
+	}{
+		{10, http.StatusBadRequest, false},
+		{1 << 20, http.StatusCreated, true},
+	} {
+		*maxPageSize = this.maxSize
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", ClipPath, strings.NewReader("url="+ts.URL+"/post"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		clipHandler(w, r)
+		if w.Code != this.code {
+			t.Errorf("[%d] got %d but expected %d: %s", i, w.Code, this.code, w.Body)
+		}
+		_, err := attachmentFS("clips").Stat(attachmentFile("clips", "the-post-pic.png"))
+		if stored := err == nil; stored != this.stored {
+			t.Errorf("[%d] got the image stored %t", i, stored)
+		}
+		if this.stored && !strings.Contains(w.Body.String(), `"clips/the-post-pic.png"`) {
+			t.Errorf("[%d] got result %s", i, w.Body)
+		}
+	}
+}
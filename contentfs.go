@@ -0,0 +1,336 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// All access to the content directory goes through a ContentFS rooted at
+// it. Names are slash separated and relative like for io/fs, and the file
+// system of a directory is an os.Root, so neither ".." nor symbolic links
+// lead outside of it. newMemFS keeps everything in memory (e.g. for tests)
+// and ReadOnlyFS serves any fs.FS, e.g. embedded content, refusing changes.
+var contentDir = flag.String("content-dir", ContentDir, "directory with the pages and their attachments")
+
+// ContentFS is a file system that can be changed.
+type ContentFS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+	// WriteFile replaces the file name atomically and creates missing
+	// parent directories.
+	WriteFile(name string, data []byte) error
+	// Mkdir creates the directory name; its parent has to exist.
+	Mkdir(name string) error
+	Remove(name string) error
+	// Rename creates missing parent directories of to.
+	Rename(from, to string) error
+}
+
+// ErrReadOnly is returned by changes of a read-only ContentFS.
+var ErrReadOnly = errors.New("read-only file system")
+
+var content ContentFS = newDirFS(ContentDir, false)
+
+// dirFS is the ContentFS of a directory, which is opened on first use.
+type dirFS struct {
+	dir    string
+	create bool // create dir if it doesn't exist
+	mutex  sync.Mutex
+	root   *os.Root
+}
+
+func newDirFS(dir string, create bool) *dirFS {
+	return &dirFS{dir: dir, create: create}
+}
+
+// open returns the root of d, opening it first if needed.
+func (d *dirFS) open() (fs.FS, *os.Root, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.root == nil {
+		if d.create {
+			if err := os.MkdirAll(d.dir, 0755); err != nil {
+				return nil, nil, err
+			}
+		}
+		r, err := os.OpenRoot(d.dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		d.root = r
+	}
+	return d.root.FS(), d.root, nil
+}
+
+// Dir returns the directory of d.
+func (d *dirFS) Dir() string {
+	return d.dir
+}
+
+func (d *dirFS) Open(name string) (fs.File, error) {
+	fsys, _, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	return fsys.Open(name)
+}
+
+func (d *dirFS) ReadFile(name string) ([]byte, error) {
+	fsys, _, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+func (d *dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, _, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(fsys, name)
+}
+
+func (d *dirFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, _, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(fsys, name)
+}
+
+func (d *dirFS) WriteFile(name string, data []byte) error {
+	_, r, err := d.open()
+	if err != nil {
+		return err
+	}
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if err = r.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	return writeRootAtomic(r, name, data, 0644)
+}
+
+func (d *dirFS) Mkdir(name string) error {
+	_, r, err := d.open()
+	if err != nil {
+		return err
+	}
+	return r.Mkdir(name, 0755)
+}
+
+func (d *dirFS) Remove(name string) error {
+	_, r, err := d.open()
+	if err != nil {
+		return err
+	}
+	return r.Remove(name)
+}
+
+func (d *dirFS) Rename(from, to string) error {
+	_, r, err := d.open()
+	if err != nil {
+		return err
+	}
+	if err = r.MkdirAll(path.Dir(to), 0755); err != nil {
+		return err
+	}
+	return r.Rename(from, to)
+}
+
+// writeRootAtomic replaces name in r with data so that it is never
+// truncated: it writes a temporary file in the same directory, syncs it
+// and renames it over name. An existing file keeps its mode, else perm is
+// used.
+func writeRootAtomic(r *os.Root, name string, data []byte, perm os.FileMode) error {
+	if fi, err := r.Stat(name); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp-"+hex.EncodeToString(b))
+	f, err := r.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = r.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = r.Rename(tmp, name)
+	}
+	if err != nil {
+		r.Remove(tmp)
+		return err
+	}
+	// make the rename itself durable
+	if d, err := r.Open(path.Dir(name)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// memFS is a ContentFS in memory.
+type memFS struct {
+	mutex sync.RWMutex
+	files fstest.MapFS
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: make(fstest.MapFS)}
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.files.Open(name)
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.files.ReadFile(name)
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.files.ReadDir(name)
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.files.Stat(name)
+}
+
+func (m *memFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.files[name] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: 0644, ModTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) Mkdir(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.files.Stat(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if fi, err := m.files.Stat(path.Dir(name)); err != nil || !fi.IsDir() {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+	}
+	m.files[name] = &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) Rename(from, to string) error {
+	if !fs.ValidPath(to) || to == "." {
+		return &fs.PathError{Op: "rename", Path: to, Err: fs.ErrInvalid}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	f, ok := m.files[from]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: from, Err: fs.ErrNotExist}
+	}
+	delete(m.files, from)
+	m.files[to] = f
+	return nil
+}
+
+// ReadOnlyFS returns fsys (e.g. an embed.FS) as ContentFS refusing all
+// changes.
+func ReadOnlyFS(fsys fs.FS) ContentFS {
+	return readOnlyFS{fsys}
+}
+
+type readOnlyFS struct {
+	fs.FS
+}
+
+func (r readOnlyFS) ReadFile(name string) ([]byte, error)       { return fs.ReadFile(r.FS, name) }
+func (r readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(r.FS, name) }
+func (r readOnlyFS) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(r.FS, name) }
+
+func (r readOnlyFS) WriteFile(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Mkdir(name string) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Rename(from, to string) error {
+	return &fs.PathError{Op: "rename", Path: from, Err: ErrReadOnly}
+}
+
+// attachmentFSs are the file systems of attachment roots outside of the
+// content directory, e.g. the static directory of the site.
+var (
+	attachmentFSMutex sync.Mutex
+	attachmentFSs     = make(map[string]*dirFS)
+)
+
+// attachmentFS returns the file system attachments of dir are stored in.
+func attachmentFS(dir string) ContentFS {
+	root := attachmentRoot(dir)
+	if root == *contentDir {
+		return content
+	}
+	attachmentFSMutex.Lock()
+	defer attachmentFSMutex.Unlock()
+	d, ok := attachmentFSs[root]
+	if !ok {
+		d = newDirFS(root, true)
+		attachmentFSs[root] = d
+	}
+	return d
+}
+
+// fsDir returns dir (relative to the root of a ContentFS) as fs name.
+func fsDir(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
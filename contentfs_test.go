@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFsStorageMemFS(t *testing.T) {
+	s := &fsStorage{fsys: newMemFS()}
+	for _, path := range []string{"b", "a/x", "a/y"} {
+		if err := s.Save(path, []byte("content of "+path)); err != nil {
+			t.Fatalf("unable to save '%s': %s", path, err)
+		}
+	}
+	if err := s.Rename("a/y", "c/d"); err != nil {
+		t.Errorf("unexpected rename error: %s", err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("unexpected delete error: %s", err)
+	}
+	if err := s.Save("../escape", nil); err == nil {
+		t.Errorf("expected an error saving outside of the root")
+	}
+	ps, _ := s.List()
+	if expect := []string{"a/x", "c/d"}; !reflect.DeepEqual(ps, expect) {
+		t.Errorf("got %q but expected %q", ps, expect)
+	}
+	if b, err := s.Load("c/d"); err != nil || string(b) != "content of a/y" {
+		t.Errorf("got %q (%v) for the renamed page", b, err)
+	}
+	if _, err := s.Load("b"); !os.IsNotExist(err) {
+		t.Errorf("got error %v for the deleted page", err)
+	}
+}
+
+func TestReadOnlyFS(t *testing.T) {
+	s := &fsStorage{fsys: ReadOnlyFS(fstest.MapFS{"docs/intro.md": {Data: []byte("intro")}})}
+	if b, err := s.Load("docs/intro"); err != nil || string(b) != "intro" {
+		t.Errorf("got %q (%v) but expected the embedded page", b, err)
+	}
+	if ps, _ := s.List(); !reflect.DeepEqual(ps, []string{"docs/intro"}) {
+		t.Errorf("got pages %q", ps)
+	}
+	if err := s.Save("docs/intro", []byte("changed")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("got error %v but expected %v", err, ErrReadOnly)
+	}
+}
+
+func TestDirFSEscape(t *testing.T) {
+	outside := t.TempDir()
+	dir := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	d := newDirFS(dir, false)
+	for i, name := range []string{"../escape.md", "link/escape.md", "/escape.md"} {
+		if err := d.WriteFile(name, []byte("x")); err == nil {
+			t.Errorf("[%d] expected an error writing %q", i, name)
+		}
+	}
+	if fis, _ := os.ReadDir(outside); len(fis) != 0 {
+		t.Errorf("got %d files outside of the root", len(fis))
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"html/template"
+	"mime"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Browsers send the basic auth credentials and cookies of the wiki along
+// with forms posted by other websites, so changes from a browser need a
+// CSRF token: an HMAC of a random secret in a cookie. Forms get it with
+// {{csrfField}} (or {{csrfToken}} in the action of multipart forms, which
+// aren't parsed before the handler limits their size), scripts in the
+// X-CSRF-Token header. Clients that aren't browsers (no cookies and no
+// Origin or Sec-Fetch-Site header) don't need one.
+var csrfEnabled = flag.Bool("csrf", true, "require CSRF tokens for changes from browsers")
+
+const (
+	CSRFCookie = "gwiki_csrf"
+	CSRFField  = "csrf"
+	CSRFHeader = "X-CSRF-Token"
+	CSRFMaxAge = 365 * 24 * time.Hour
+)
+
+// csrfPlaceholder is written by the template functions and replaced with
+// the token of the request when the template is rendered.
+const csrfPlaceholder = "GWIKICSRFTOKENPLACEHOLDER"
+
+var validCSRFSecret = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// csrfField returns the hidden form field with the token (see
+// withCSRFToken).
+func csrfField() template.HTML {
+	return template.HTML(`<input type="hidden" name="` + CSRFField + `" value="` + csrfPlaceholder + `">`)
+}
+
+func csrfTokenOf(secret string) string {
+	mac := hmac.New(sha256.New, shareKey)
+	mac.Write([]byte("csrf\n" + secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isSafeMethod reports whether requests with method don't change anything.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || method == "PROPFIND"
+}
+
+// isBrowser reports whether r may have been sent by a browser.
+func isBrowser(r *http.Request) bool {
+	return r.Header.Get("Cookie") != "" || r.Header.Get("Origin") != "" || r.Header.Get("Sec-Fetch-Site") != ""
+}
+
+// requestCSRFToken returns the token sent with r.
+func requestCSRFToken(r *http.Request) string {
+	if t := r.Header.Get(CSRFHeader); t != "" {
+		return t
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "multipart/form-data" {
+		return r.URL.Query().Get(CSRFField)
+	}
+	return r.PostFormValue(CSRFField)
+}
+
+// csrfWriter knows the token of the request for the templates.
+type csrfWriter struct {
+	http.ResponseWriter
+	token string
+}
+
+// Unwrap lets http.ResponseController reach the original writer.
+func (w *csrfWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withCSRFToken replaces the placeholders in the rendered template b with
+// the token of the request written to w (if any).
+func withCSRFToken(w http.ResponseWriter, b []byte) []byte {
+	for {
+		if cw, ok := w.(*csrfWriter); ok {
+			return bytes.ReplaceAll(b, []byte(csrfPlaceholder), []byte(cw.token))
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return bytes.ReplaceAll(b, []byte(csrfPlaceholder), nil)
+		}
+		w = u.Unwrap()
+	}
+}
+
+// csrfHandler sets the secret cookie and rejects changes from browsers
+// without a valid token.
+func csrfHandler(h http.Handler) http.Handler {
+	if !*csrfEnabled {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestToken(r) != nil || isDAV(r) {
+			h.ServeHTTP(w, r) // browsers don't send bearer tokens or these methods by themselves
+			return
+		}
+		var secret string
+		if c, err := r.Cookie(CSRFCookie); err == nil && validCSRFSecret.MatchString(c.Value) {
+			secret = c.Value
+		} else if !isSafeMethod(r.Method) && isBrowser(r) {
+			logger(r.Context()).Warn("Missing CSRF cookie", "method", r.Method, "path", r.URL.Path)
+			http.Error(w, "invalid CSRF token, please reload the page", http.StatusForbidden)
+			return
+		} else {
+			b := make([]byte, 32)
+			rand.Read(b)
+			secret = hex.EncodeToString(b)
+			setCookie(w, r, CSRFCookie, secret, CSRFMaxAge)
+		}
+		token := csrfTokenOf(secret)
+		if !isSafeMethod(r.Method) && isBrowser(r) && !hmac.Equal([]byte(requestCSRFToken(r)), []byte(token)) {
+			logger(r.Context()).Warn("Invalid CSRF token", "method", r.Method, "path", r.URL.Path)
+			http.Error(w, "invalid CSRF token, please reload the page", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(&csrfWriter{ResponseWriter: w, token: token}, r)
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	var rendered string
+	h := csrfHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rendered = string(withCSRFToken(w, []byte(`<form>`+string(templateFuncs["csrfField"].(func() template.HTML)())+`</form>`)))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/edit/docs", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookie {
+		t.Fatalf("got cookies %v", cookies)
+	}
+	token := csrfTokenOf(cookies[0].Value)
+	if !strings.Contains(rendered, `value="`+token+`"`) {
+		t.Errorf("got %q without the token", rendered)
+	}
+
+	for i, this := range []struct {
+		cookie bool
+		origin string
+		form   string
+		header string
+		query  string
+		ctype  string
+		expect int
+	}{
+		{true, "", "csrf=" + token, "", "", "application/x-www-form-urlencoded", http.StatusOK},
+		{true, "", "csrf=wrong", "", "", "application/x-www-form-urlencoded", http.StatusForbidden},
+		{true, "", "body=x", "", "", "application/x-www-form-urlencoded", http.StatusForbidden},
+		{true, "", `{"a":1}`, token, "", "application/json", http.StatusOK},
+		{true, "", "--x--", "", "?csrf=" + url.QueryEscape(token), "multipart/form-data; boundary=x", http.StatusOK},
+		{true, "", "--x--", "", "", "multipart/form-data; boundary=x", http.StatusForbidden},
+		{false, "https://evil.example", "body=x", "", "", "application/x-www-form-urlencoded", http.StatusForbidden},
+		{false, "", "body=x", "", "", "application/x-www-form-urlencoded", http.StatusOK}, // no browser
+	} {
+		r := httptest.NewRequest("POST", "/save/docs"+this.query, strings.NewReader(this.form))
+		r.Header.Set("Content-Type", this.ctype)
+		if this.cookie {
+			r.AddCookie(cookies[0])
+		}
+		if this.origin != "" {
+			r.Header.Set("Origin", this.origin)
+		}
+		if this.header != "" {
+			r.Header.Set(CSRFHeader, this.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != this.expect {
+			t.Errorf("[%d] got %d but expected %d", i, w.Code, this.expect)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Front matter fields of all pages can be edited like a spreadsheet: GET
+// /api/v1/frontmatter exports them as CSV with the path and revision of
+// each page and POSTing the edited CSV back applies the changed cells as
+// queued edits, so rows of pages changed in the meantime are conflicts.
+// Lists are separated by commas and empty cells remove a field.
+
+const (
+	CSVMaxSize       = 16 << 20
+	CSVListSep       = ", "
+	CSVSummary       = "CSV import"
+	CSVDefaultFields = "title,date,draft,tags"
+)
+
+// csvCell returns the front matter value v as CSV cell.
+func csvCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		if h, m, s := v.Clock(); h == 0 && m == 0 && s == 0 && v.Nanosecond() == 0 {
+			return v.Format(DateFormat)
+		}
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, CSVListSep)
+	case []interface{}:
+		return strings.Join(toStrings(v), CSVListSep)
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// isListField reports whether a new field key is a list.
+func isListField(key string) bool {
+	return key == "tags" || key == "aliases" || contains(site.TaxonomyNames(), key)
+}
+
+// csvValue returns the cell of the field key as front matter value of the
+// type of the current value old (nil for an empty cell).
+func csvValue(key, cell string, old interface{}) (interface{}, error) {
+	if cell == "" {
+		return nil, nil
+	}
+	if old == nil {
+		switch {
+		case isListField(key):
+			old = []interface{}{}
+		case key == "draft":
+			old = false
+		case key == "date" || key == "lastmod":
+			old = time.Time{}
+		}
+	}
+	switch old.(type) {
+	case bool:
+		return strconv.ParseBool(cell)
+	case int64, int:
+		return strconv.ParseInt(cell, 10, 64)
+	case float64:
+		return strconv.ParseFloat(cell, 64)
+	case time.Time:
+		if t, err := time.Parse(DateFormat, cell); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.RFC3339, cell)
+	case []string, []interface{}:
+		var vs []interface{}
+		for _, s := range strings.Split(cell, strings.TrimSpace(CSVListSep)) {
+			if s = strings.TrimSpace(s); s != "" {
+				vs = append(vs, s)
+			}
+		}
+		return vs, nil
+	case map[string]interface{}:
+		var m map[string]interface{}
+		err := json.Unmarshal([]byte(cell), &m)
+		return m, err
+	}
+	return cell, nil
+}
+
+// csvFields returns the fields of the query parameter fields.
+func csvFields(r *http.Request) []string {
+	s := r.FormValue("fields")
+	if s == "" {
+		s = CSVDefaultFields
+	}
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" && f != "path" && f != "revision" && !contains(fields, f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// writeFrontMatterCSV writes the fields of the pages at paths as CSV.
+func writeFrontMatterCSV(w io.Writer, r *http.Request, fields []string, paths []string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"path", "revision"}, fields...))
+	for _, path := range paths {
+		p, err := loadPage(r.Context(), path)
+		if err != nil {
+			return fmt.Errorf("unable to load page '%s': %s", path, err)
+		}
+		p = p.For(r)
+		row := []string{path, p.Revision}
+		for _, f := range fields {
+			row = append(row, csvCell(p.FrontMatter[f]))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvEdits reads the CSV in rd and returns the queued edits of the rows
+// with changed cells. The results of the other rows ("unchanged" or
+// "error") are returned by row, the rows with edits are missing.
+func csvEdits(r *http.Request, rd io.Reader) ([]QueuedEdit, map[int]EditResult, int, error) {
+	cr := csv.NewReader(rd)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid CSV: %s", err)
+	}
+	if len(header) < 2 || header[0] != "path" || header[1] != "revision" {
+		return nil, nil, 0, fmt.Errorf("the first columns have to be 'path' and 'revision'")
+	}
+	var edits []QueuedEdit
+	others := make(map[int]EditResult)
+	n := 0
+	for ; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid CSV: %s", err)
+		}
+		path := row[0]
+		res := EditResult{Path: path, Status: "error"}
+		if !mayView(r, path) {
+			res.Error = fmt.Sprintf("not allowed to change '%s'", path)
+			others[n] = res
+			continue
+		}
+		p, err := loadPage(r.Context(), path)
+		if err != nil {
+			res.Error = fmt.Sprintf("unable to load page '%s': %s", path, err)
+			others[n] = res
+			continue
+		}
+		changes := make(map[string]interface{})
+		for i, f := range header[2:] {
+			cell := strings.TrimSpace(row[i+2])
+			if cell == csvCell(p.FrontMatter[f]) {
+				continue
+			}
+			v, err := csvValue(f, cell, p.FrontMatter[f])
+			if err != nil {
+				res.Error = fmt.Sprintf("invalid value '%s' of '%s': %s", cell, f, err)
+				break
+			}
+			changes[f] = v
+		}
+		switch {
+		case res.Error != "":
+			others[n] = res
+		case len(changes) == 0:
+			others[n] = EditResult{Path: path, Status: "unchanged", Revision: p.Revision}
+		default:
+			edits = append(edits, QueuedEdit{Path: path, Base: row[1], FrontMatter: changes, Summary: CSVSummary})
+		}
+	}
+	return edits, others, n, nil
+}
+
+// frontMatterCSVHandler exports the front matter fields (?fields=a,b)
+// of the pages below ?section= (with ?drafts=true also drafts) as CSV and
+// applies edited CSV (POST as body or file) returning {"results": [...]}
+// by row.
+func frontMatterCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		importFrontMatterCSV(w, r)
+		return
+	}
+	section := strings.Trim(r.FormValue("section"), "/")
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="frontmatter.csv"`)
+	paths := exportPaths(r, section, r.FormValue("drafts") == "true")
+	if err := writeFrontMatterCSV(w, r, csvFields(r), paths); err != nil {
+		// the response is partly written already
+		logger(r.Context()).Error("Unable to write front matter CSV", "section", section, "err", err)
+	}
+}
+
+// importFrontMatterCSV applies the front matter CSV of the request.
+func importFrontMatterCSV(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, CSVMaxSize)
+	var rd io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "the CSV file is missing: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		rd = f
+	}
+	edits, others, n, err := csvEdits(r, rd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applied := applyEdits(r, edits)
+	results := make([]EditResult, n)
+	for i := range results {
+		if res, ok := others[i]; ok {
+			results[i] = res
+		} else {
+			results[i], applied = applied[0], applied[1:]
+		}
+	}
+	logger(r.Context()).Info("Imported front matter CSV", "rows", n, "edits", len(edits))
+	writeJSON(w, map[string]interface{}{"results": results})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVValue(t *testing.T) {
+	day := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	for i, this := range []struct {
+		key   string
+		old   interface{}
+		cell  string
+		value interface{}
+	}{
+		{"title", "Old", "New, really", "New, really"},
+		{"tags", []interface{}{"a"}, "a, b", []interface{}{"a", "b"}},
+		{"tags", nil, "x,y", []interface{}{"x", "y"}},
+		{"draft", true, "false", false},
+		{"weight", int64(1), "2", int64(2)},
+		{"date", day, "2024-05-07", day.AddDate(0, 0, 1)},
+		{"date", nil, "2024-05-06T07:08:09Z", day.Add(7*time.Hour + 8*time.Minute + 9*time.Second)},
+		{"params", map[string]interface{}{"x": 1.0}, `{"y":2}`, map[string]interface{}{"y": 2.0}},
+		{"owner", "alice", "", nil},
+	} {
+		v, err := csvValue(this.key, this.cell, this.old)
+		if err != nil || !reflect.DeepEqual(v, this.value) {
+			t.Errorf("[%d] got %#v and error %v but expected %#v", i, v, err, this.value)
+		}
+		if this.value != nil && csvCell(v) != strings.ReplaceAll(this.cell, ",y", ", y") {
+			t.Errorf("[%d] got cell %q for %q", i, csvCell(v), this.cell)
+		}
+	}
+	if _, err := csvValue("draft", "maybe", true); err == nil {
+		t.Error("expected an error for an invalid boolean")
+	}
+}
+
+func TestFrontMatterCSV(t *testing.T) {
+	defer func(s Storage, pi *pageIndex) { store, index = s, pi; cachedPages.Clear() }(store, index)
+	store = newMemoryStorage()
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	cachedPages.Clear()
+	for path, src := range map[string]string{
+		"docs/a": "+++\ntitle = \"A\"\ndate = 2024-05-06T00:00:00Z\ndraft = false\ntags = [\"x\", \"y\"]\n+++\nA\n",
+		"docs/b": "+++\ntitle = \"B, the second\"\ndraft = false\nowner = \"bob\"\n+++\nB\n",
+	} {
+		if err := store.Save(path, []byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := index.Build(); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	frontMatterCSVHandler(w, httptest.NewRequest("GET", "/api/v1/frontmatter?section=docs&fields=title,tags,owner", nil))
+	a, _ := LoadPage("docs/a")
+	b, _ := LoadPage("docs/b")
+	expect := "path,revision,title,tags,owner\n" +
+		"docs/a," + a.Revision + ",A,\"x, y\",\n" +
+		"docs/b," + b.Revision + ",\"B, the second\",,bob\n"
+	if w.Body.String() != expect {
+		t.Errorf("got %q but expected %q", w.Body, expect)
+	}
+
+	edited := "path,revision,title,tags,owner,draft\n" +
+		"docs/a," + a.Revision + ",A,\"x, y\",,false\n" +
+		"docs/b," + b.Revision + ",B,go,,false\n" +
+		"docs/c,1234,C,,,false\n" +
+		"docs/a," + a.Revision + ",A,,,no\n"
+	edits, others, n, err := csvEdits(httptest.NewRequest("POST", "/api/v1/frontmatter", nil), strings.NewReader(edited))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 4 {
+		t.Errorf("got %d rows but expected 4", n)
+	}
+	expectEdits := []QueuedEdit{{Path: "docs/b", Base: b.Revision, Summary: CSVSummary,
+		FrontMatter: map[string]interface{}{"title": "B", "tags": []interface{}{"go"}, "owner": nil}}}
+	if !reflect.DeepEqual(edits, expectEdits) {
+		t.Errorf("got edits %+v", edits)
+	}
+	if others[0].Status != "unchanged" || others[2].Status != "error" || others[3].Status != "error" || len(others) != 3 {
+		t.Errorf("got results %+v", others)
+	}
+	if _, _, _, err = csvEdits(httptest.NewRequest("POST", "/api/v1/frontmatter", nil), strings.NewReader("title\nA\n")); err == nil {
+		t.Error("expected an error for a CSV without path and revision")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof/ at http.DefaultServeMux
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The profiles of net/http/pprof (/debug/pprof/) and the runtime stats
+// (/debug/runtime) help to diagnose performance problems of large wikis in
+// production. They need authentication like every other page.
+var debugEnabled = flag.Bool("debug", false, "serve pprof profiles at /debug/pprof/ and runtime stats at /debug/runtime")
+
+var startTime = time.Now()
+
+// RuntimeStats are the goroutine, memory and GC stats of the process.
+type RuntimeStats struct {
+	GoVersion    string  `json:"goVersion"`
+	Uptime       string  `json:"uptime"`
+	CPUs         int     `json:"cpus"`
+	GOMAXPROCS   int     `json:"gomaxprocs"`
+	Goroutines   int     `json:"goroutines"`
+	HeapAlloc    uint64  `json:"heapAlloc"` // bytes
+	HeapInuse    uint64  `json:"heapInuse"`
+	HeapObjects  uint64  `json:"heapObjects"`
+	TotalAlloc   uint64  `json:"totalAlloc"`
+	Sys          uint64  `json:"sys"`
+	NumGC        uint32  `json:"numGC"`
+	PauseTotal   string  `json:"pauseTotal"`
+	LastGC       string  `json:"lastGC,omitempty"`
+	GCCPUPercent float64 `json:"gcCPUPercent"`
+}
+
+func runtimeStats() *RuntimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s := &RuntimeStats{
+		GoVersion:    runtime.Version(),
+		Uptime:       time.Since(startTime).Round(time.Second).String(),
+		CPUs:         runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapObjects:  m.HeapObjects,
+		TotalAlloc:   m.TotalAlloc,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotal:   time.Duration(m.PauseTotalNs).String(),
+		GCCPUPercent: m.GCCPUFraction * 100,
+	}
+	if m.LastGC > 0 {
+		s.LastGC = time.Unix(0, int64(m.LastGC)).UTC().Format(time.RFC3339)
+	}
+	return s
+}
+
+// runtimeHandler serves the runtime stats as JSON (/debug/runtime).
+func runtimeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, runtimeStats())
+}
+
+// debugHandler hides /debug/ unless it is enabled; importing net/http/pprof
+// registers its handlers in any case.
+func debugHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !*debugEnabled && strings.HasPrefix(r.URL.Path, "/debug/") {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func initDebug() {
+	if *debugEnabled {
+		http.HandleFunc("/debug/runtime", runtimeHandler)
+	}
+}
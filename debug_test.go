@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	defer func(b bool) { *debugEnabled = b }(*debugEnabled)
+	h := debugHandler(http.DefaultServeMux)
+	for i, this := range []struct {
+		enabled bool
+		url     string
+		expect  int
+	}{
+		{false, "/debug/pprof/", http.StatusNotFound},
+		{false, "/debug/pprof/goroutine?debug=1", http.StatusNotFound},
+		{true, "/debug/pprof/", http.StatusOK},
+		{true, "/debug/pprof/goroutine?debug=1", http.StatusOK},
+	} {
+		*debugEnabled = this.enabled
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", this.url, nil))
+		if w.Code != this.expect {
+			t.Errorf("[%d] got %d but expected %d", i, w.Code, this.expect)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	runtimeHandler(w, httptest.NewRequest("GET", "/debug/runtime", nil))
+	var s RuntimeStats
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil || s.Goroutines == 0 || s.HeapAlloc == 0 || s.GoVersion == "" {
+		t.Errorf("got %+v (%v)", s, err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of front matter changes.
+const (
+	FieldAdded   = "added"
+	FieldRemoved = "removed"
+	FieldChanged = "changed"
+)
+
+// FieldChange is the change of a single front matter field.
+type FieldChange struct {
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// diffFrontMatter compares two front matter maps key by key.
+func diffFrontMatter(old, new map[string]interface{}) []FieldChange {
+	var cs []FieldChange
+	for k, ov := range old {
+		nv, ok := new[k]
+		if !ok {
+			cs = append(cs, FieldChange{Key: k, Kind: FieldRemoved, Old: formatValue(ov)})
+		} else if o, n := formatValue(ov), formatValue(nv); o != n {
+			cs = append(cs, FieldChange{Key: k, Kind: FieldChanged, Old: o, New: n})
+		}
+	}
+	for k, nv := range new {
+		if _, ok := old[k]; !ok {
+			cs = append(cs, FieldChange{Key: k, Kind: FieldAdded, New: formatValue(nv)})
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Key < cs[j].Key })
+	return cs
+}
+
+// formatValue formats a front matter value so that equal values of
+// different types (e.g. []string and []interface{}) look the same.
+func formatValue(v interface{}) string {
+	switch tv := v.(type) {
+	case time.Time:
+		if tv.Equal(tv.Truncate(24 * time.Hour)) {
+			return tv.Format(DateFormat)
+		}
+		return tv.Format(time.RFC3339)
+	case []string, []interface{}:
+		ss := toStrings(v)
+		return "[" + strings.Join(ss, ", ") + "]"
+	case map[string]interface{}:
+		ks := make([]string, 0, len(tv))
+		for k := range tv {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		es := make([]string, len(ks))
+		for i, k := range ks {
+			es[i] = k + ": " + formatValue(tv[k])
+		}
+		return "{" + strings.Join(es, ", ") + "}"
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// DiffLine is a line of a line based diff. Kind is ' ', '+' or '-'.
+type DiffLine struct {
+	Kind string
+	Text string
+}
+
+// maxDiffCells limits the memory used by diffLines.
+const maxDiffCells = 4000000
+
+// diffLines computes a line based diff via the longest common subsequence.
+// It returns nil for texts too big to diff.
+func diffLines(old, new string) []DiffLine {
+	a, b := strings.Split(old, "\n"), strings.Split(new, "\n")
+	if len(a)*len(b) > maxDiffCells {
+		return nil
+	}
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ds []DiffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ds = append(ds, DiffLine{" ", a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			ds = append(ds, DiffLine{"+", b[j]})
+			j++
+		default:
+			ds = append(ds, DiffLine{"-", a[i]})
+			i++
+		}
+	}
+	return ds
+}
+
+type diffData struct {
+	Path        string
+	Err         string
+	FrontMatter []FieldChange
+	Body        []DiffLine
+	BodyChanged bool
+}
+
+// diffHandler shows the changes the submitted edit form would make or
+// (with since=snapshot) the changes since the last content snapshot.
+func diffHandler(w http.ResponseWriter, r *http.Request, path string) {
+	p, err := LoadPage(path)
+	if err != nil {
+		p = NewPage(path)
+	}
+	old := p.Copy()
+	if r.FormValue("since") == "snapshot" {
+		if old, err = snapshotPage(path); err != nil {
+			logger(r.Context()).Info("No snapshot of the page", "path", path, "err", err)
+			old = NewPage(path)
+		}
+	} else {
+		applyForm(p, r)
+	}
+	data := diffData{Path: path, FrontMatter: diffFrontMatter(old.FrontMatter, p.FrontMatter)}
+	if r.FormValue("since") != "snapshot" {
+		if err = validatePage(old, p); err != nil {
+			data.Err = err.Error()
+		}
+	}
+	ob, nb := string(normalizeBody(old.Body)), string(normalizeBody(p.Body))
+	if ob != nb {
+		data.BodyChanged = true
+		data.Body = diffLines(ob, nb)
+	}
+	logger(r.Context()).Debug("Reviewing front matter changes", "path", path, "changes", len(data.FrontMatter))
+	renderTemplate(w, "diff", data)
+}
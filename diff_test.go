@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffFrontMatter(t *testing.T) {
+	date := time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC)
+	old := map[string]interface{}{
+		"title": "Old", "date": date, "tags": []interface{}{"a", "b"}, "draft": true,
+	}
+	new := map[string]interface{}{
+		"title": "New", "date": date, "tags": []string{"a", "b"}, "weight": 3,
+	}
+	expect := []FieldChange{
+		{Key: "draft", Kind: FieldRemoved, Old: "true"},
+		{Key: "title", Kind: FieldChanged, Old: "Old", New: "New"},
+		{Key: "weight", Kind: FieldAdded, New: "3"},
+	}
+	if result := diffFrontMatter(old, new); !reflect.DeepEqual(result, expect) {
+		t.Errorf("got %#v but expected %#v", result, expect)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	result := diffLines("a\nb\nc", "a\nc\nd")
+	expect := []DiffLine{{" ", "a"}, {"-", "b"}, {" ", "c"}, {"+", "d"}}
+	if !reflect.DeepEqual(result, expect) {
+		t.Errorf("got %v but expected %v", result, expect)
+	}
+}
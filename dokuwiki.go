@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The data directory of a DokuWiki (or just its pages directory) is
+// imported with the namespaces as sections and the pages converted to
+// Markdown. The media files are moved next to the first page using them
+// (unused ones stay in the section of their namespace). Tags of the tag
+// plugin become tags and the change logs in meta/ the dates and
+// contributors.
+
+var (
+	dwCode        = regexp.MustCompile(`(?s)<(code|file)([^>]*)>\n?(.*?)</(?:code|file)>`)
+	dwNowiki      = regexp.MustCompile(`(?s)<nowiki>(.*?)</nowiki>|%%(.*?)%%|''(.+?)''`)
+	dwTags        = regexp.MustCompile(`\{\{tag>([^}]*)\}\}`)
+	dwMacro       = regexp.MustCompile(`~~[A-Z_]+(?::[^~]*)?~~`)
+	dwFootnote    = regexp.MustCompile(`(?s)\(\((.+?)\)\)`)
+	dwLink        = regexp.MustCompile(`\[\[([^\[\]]*)\]\]`)
+	dwMedia       = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+	dwURL         = regexp.MustCompile(`(?:https?|ftp)://[^\s\[\]<>|]+[^\s\[\]<>|.,;:!?)]`)
+	dwScheme      = regexp.MustCompile(`^(?:[a-zA-Z][a-zA-Z0-9+.-]*://|mailto:)`)
+	dwInterwiki   = regexp.MustCompile(`^[a-zA-Z0-9._-]+>`)
+	dwHeading     = regexp.MustCompile(`^\s*(={2,6})\s*(.+?)\s*={2,}\s*$`)
+	dwList        = regexp.MustCompile(`^((?:  )+|\t+)([*-])\s*(.*)$`)
+	dwBold        = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	dwItalic      = regexp.MustCompile(`//(.+?)//`)
+	dwUnderline   = regexp.MustCompile(`__(.+?)__`)
+	dwStrike      = regexp.MustCompile(`<del>(.*?)</del>`)
+	dwBreak       = regexp.MustCompile(`\\\\(?:\s+|$)`)
+	dwPlaceholder = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// dokuWiki converts the pages of a DokuWiki data directory.
+type dokuWiki struct {
+	*importFiles
+	section  string
+	pages    string // directory of the pages
+	meta     string // directory of the change logs
+	reported map[string]bool
+}
+
+// dokuPage converts the markup of a single page to Markdown.
+type dokuPage struct {
+	dw        *dokuWiki
+	id        string // of the page: namespaces and name separated by ":"
+	dir       string // of the page path, attachments are placed there
+	tags      []interface{}
+	protected []string
+	notes     []string
+	kinds     []string // list markers of the open (nested) list items
+}
+
+// importDokuWiki converts the pages and media files of the DokuWiki data
+// directory dir (with pages/, media/ and meta/, or the pages directory
+// only) to pages below section.
+func importDokuWiki(dir, section string) (*Import, error) {
+	dw := &dokuWiki{importFiles: newImportFiles(dir), section: section, pages: filepath.Join(dir, "pages"),
+		meta: filepath.Join(dir, "meta"), reported: make(map[string]bool)}
+	if fi, err := os.Stat(dw.pages); err != nil || !fi.IsDir() {
+		dw.pages = dir
+	}
+	var ids []string
+	err := filepath.WalkDir(dw.pages, func(fn string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() || path.Ext(de.Name()) != ".txt" {
+			return nil
+		}
+		rel, err := filepath.Rel(dw.pages, fn)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, strings.ReplaceAll(strings.TrimSuffix(filepath.ToSlash(rel), ".txt"), "/", ":"))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p, err := dw.page(id)
+		if err != nil {
+			dw.imp.problem("unable to import page '%s': %s", id, err)
+			continue
+		}
+		dw.imp.Pages = append(dw.imp.Pages, p)
+	}
+	media := filepath.Join(dir, "media")
+	if fi, err := os.Stat(media); err == nil && fi.IsDir() && dw.pages != dir {
+		err = filepath.WalkDir(media, func(fn string, de fs.DirEntry, err error) error {
+			if err != nil || de.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, fn)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if dw.placed[rel] == nil {
+				ns := strings.ReplaceAll(path.Dir(strings.TrimPrefix(rel, "media/")), "/", ":")
+				if ns == "." {
+					ns = ""
+				}
+				dw.place(rel, dwPath(section, ns))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	dw.sortFiles()
+	return dw.imp, nil
+}
+
+// dwPath returns the path of the page (or namespace) id below section.
+func dwPath(section, id string) string {
+	segs := []string{section}
+	for _, s := range strings.Split(strings.Trim(id, ":"), ":") {
+		if s == "" {
+			continue
+		}
+		if s = slugify(s); s == "" {
+			s = "page"
+		}
+		segs = append(segs, s)
+	}
+	return path.Join(segs...)
+}
+
+// dwNamespace returns the namespace of the page id.
+func dwNamespace(id string) string {
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		return id[:i]
+	}
+	return ""
+}
+
+// dwResolve returns the full id of the link target t on a page in the
+// namespace ns: absolute with ":" or another namespace, relative with "."
+// and ".." and in ns without any. Like in DokuWiki "/" separates
+// namespaces, too, and "." and ".." can't leave the wiki.
+func dwResolve(ns, t string) string {
+	t = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(t), " ", "_"))
+	t = strings.ReplaceAll(t, "/", ":")
+	switch {
+	case strings.HasPrefix(t, "."):
+		segs := strings.Split(ns, ":")
+		if ns == "" {
+			segs = nil
+		}
+		parts := strings.Split(t, ":")
+		for len(parts) > 1 && (parts[0] == "." || parts[0] == "..") {
+			if parts[0] == ".." && len(segs) > 0 {
+				segs = segs[:len(segs)-1]
+			}
+			parts = parts[1:]
+		}
+		t = strings.Join(append(segs, parts...), ":")
+	case strings.HasPrefix(t, ":"):
+		t = t[1:]
+	case !strings.Contains(t, ":") && ns != "":
+		t = ns + ":" + t
+	}
+	if strings.HasSuffix(t, ":") {
+		t += "start"
+	}
+	var segs []string
+	for _, s := range strings.Split(t, ":") {
+		if s != "" && s != "." && s != ".." {
+			segs = append(segs, s)
+		}
+	}
+	return strings.Join(segs, ":")
+}
+
+// page reads and converts the page id.
+func (dw *dokuWiki) page(id string) (*Page, error) {
+	fn := filepath.Join(dw.pages, filepath.FromSlash(strings.ReplaceAll(id, ":", "/"))+".txt")
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	p := NewPage(uniqueName(dw.taken, dwPath(dw.section, id)))
+	if !isValidPath(p.Path) {
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidPath, p.Path)
+	}
+	// Like DokuWiki the first heading is the title.
+	src := strings.TrimLeft(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	first, rest, _ := strings.Cut(src, "\n")
+	if h := dwHeading.FindStringSubmatch(first); h != nil {
+		p.FrontMatter["title"], src = h[2], rest
+	} else {
+		p.FrontMatter["title"] = strings.ReplaceAll(id[strings.LastIndex(id, ":")+1:], "_", " ")
+	}
+	dp := &dokuPage{dw: dw, id: id, dir: attachmentDir(p.Path)}
+	p.Body = []byte(dp.convert(src))
+	times, contributors := dw.changes(id)
+	if len(times) == 0 {
+		if fi, err := os.Stat(fn); err == nil {
+			times = append(times, fi.ModTime())
+		}
+	}
+	if len(times) > 0 {
+		first, last := times[0], times[len(times)-1]
+		p.FrontMatter["date"] = first.UTC().Format(time.RFC3339)
+		if !last.Equal(first) {
+			p.FrontMatter["lastmod"] = last.UTC().Format(time.RFC3339)
+		}
+	}
+	if contributors != nil {
+		p.FrontMatter["contributors"] = contributors
+	}
+	if dp.tags != nil {
+		p.FrontMatter["tags"] = dp.tags
+	}
+	return p, nil
+}
+
+// changes returns the times of the changes of the page id and who made
+// them from its change log (meta/<id>.changes, tab separated: time, IP,
+// type, id, user, summary).
+func (dw *dokuWiki) changes(id string) ([]time.Time, []interface{}) {
+	f, err := os.Open(filepath.Join(dw.meta, filepath.FromSlash(strings.ReplaceAll(id, ":", "/"))+".changes"))
+	if err != nil {
+		return nil, nil
+	}
+	defer f.Close()
+	var times []time.Time
+	var contributors []interface{}
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) < 5 {
+			continue
+		}
+		sec, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, time.Unix(sec, 0))
+		c := fields[4]
+		if c == "" {
+			c = fields[1]
+		}
+		if c != "" && !seen[c] {
+			seen[c] = true
+			contributors = append(contributors, c)
+		}
+	}
+	return times, contributors
+}
+
+// problemOnce reports a problem only the first time for key.
+func (dw *dokuWiki) problemOnce(key, format string, args ...interface{}) {
+	if !dw.reported[key] {
+		dw.reported[key] = true
+		dw.imp.problem(format, args...)
+	}
+}
+
+// protect returns a placeholder for the Markdown s that isn't converted.
+func (dp *dokuPage) protect(s string) string {
+	dp.protected = append(dp.protected, s)
+	return fmt.Sprintf("\x00%d\x00", len(dp.protected)-1)
+}
+
+// convert returns the DokuWiki markup s as Markdown.
+func (dp *dokuPage) convert(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = dwCode.ReplaceAllStringFunc(s, func(m string) string {
+		sm := dwCode.FindStringSubmatch(m)
+		lang := ""
+		if attrs := strings.Fields(sm[2]); len(attrs) > 0 && attrs[0] != "-" {
+			lang = attrs[0]
+		}
+		return "\n" + dp.protect("```"+lang+"\n"+strings.Trim(sm[3], "\n")+"\n```") + "\n"
+	})
+	s = dwNowiki.ReplaceAllStringFunc(s, func(m string) string {
+		sm := dwNowiki.FindStringSubmatch(m)
+		if strings.HasPrefix(m, "''") {
+			return dp.protect("`" + sm[3] + "`")
+		}
+		return dp.protect(sm[1] + sm[2])
+	})
+	s = dwTags.ReplaceAllStringFunc(s, func(m string) string {
+		for _, t := range strings.Fields(dwTags.FindStringSubmatch(m)[1]) {
+			dp.tags = append(dp.tags, strings.ReplaceAll(t, "_", " "))
+		}
+		return ""
+	})
+	s = dwMacro.ReplaceAllString(s, "")
+	s = dwFootnote.ReplaceAllStringFunc(s, func(m string) string {
+		dp.notes = append(dp.notes, dwFootnote.FindStringSubmatch(m)[1])
+		return fmt.Sprintf("[^%d]", len(dp.notes))
+	})
+	// Links and media contain the separators of table cells and URLs the
+	// markup of italics.
+	s = dwLink.ReplaceAllStringFunc(s, dp.link)
+	s = dwMedia.ReplaceAllStringFunc(s, dp.media)
+	s = dwURL.ReplaceAllStringFunc(s, dp.protect)
+
+	var out, pre, table []string
+	flush := func() {
+		if pre != nil {
+			out = append(out, "```", strings.Join(pre, "\n"), "```")
+			pre = nil
+		}
+		if table != nil {
+			out = append(out, dp.table(table)...)
+			table = nil
+		}
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "^") || strings.HasPrefix(t, "|") {
+			if pre != nil {
+				flush()
+			}
+			table = append(table, t)
+			continue
+		}
+		if m := dwList.FindStringSubmatch(line); m != nil {
+			flush()
+			out = append(out, dp.listItem(m))
+			continue
+		}
+		if (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) && strings.TrimSpace(line) != "" {
+			if table != nil {
+				flush()
+			}
+			pre = append(pre, strings.TrimPrefix(strings.TrimPrefix(line, "\t"), "  "))
+			continue
+		}
+		flush()
+		dp.kinds = nil
+		out = append(out, dp.block(line))
+	}
+	flush()
+	md := strings.TrimSpace(strings.Join(out, "\n"))
+	for i, n := range dp.notes {
+		if i == 0 {
+			md += "\n"
+		}
+		md += fmt.Sprintf("\n[^%d]: %s", i+1, dp.inline(strings.TrimSpace(n)))
+	}
+	for dwPlaceholder.MatchString(md) {
+		md = dwPlaceholder.ReplaceAllStringFunc(md, func(m string) string {
+			i, _ := strconv.Atoi(strings.Trim(m, "\x00"))
+			return dp.protected[i]
+		})
+	}
+	return md + "\n"
+}
+
+// block converts a line outside of lists, tables and preformatted text.
+func (dp *dokuPage) block(line string) string {
+	if m := dwHeading.FindStringSubmatch(line); m != nil {
+		return strings.Repeat("#", 7-len(m[1])) + " " + dp.inline(m[2])
+	}
+	if strings.HasPrefix(strings.TrimSpace(line), "----") {
+		return "\n---"
+	}
+	return dp.inline(line)
+}
+
+// listItem converts a list item (indented by two spaces per level).
+func (dp *dokuPage) listItem(m []string) string {
+	level := len(m[1]) / 2
+	if strings.HasPrefix(m[1], "\t") {
+		level = len(m[1])
+	}
+	if level > len(dp.kinds)+1 {
+		level = len(dp.kinds) + 1
+	}
+	dp.kinds = dp.kinds[:level-1]
+	indent := ""
+	for _, k := range dp.kinds {
+		indent += strings.Repeat(" ", len(k)+1)
+	}
+	marker := "-"
+	if m[2] == "-" {
+		marker = "1."
+	}
+	dp.kinds = append(dp.kinds, marker)
+	return indent + marker + " " + dp.inline(m[3])
+}
+
+// table converts the rows of a table: "^" separates header cells and "|"
+// the others.
+func (dp *dokuPage) table(rows []string) []string {
+	var cells [][]string
+	header := false
+	cols := 0
+	for i, r := range rows {
+		if i == 0 && strings.HasPrefix(r, "^") {
+			header = true
+		}
+		r = strings.TrimRight(r[1:], " ")
+		r = strings.TrimSuffix(strings.TrimSuffix(r, "|"), "^")
+		var row []string
+		for _, c := range strings.FieldsFunc(r, func(r rune) bool { return r == '|' || r == '^' }) {
+			row = append(row, strings.ReplaceAll(dp.inline(strings.TrimSpace(c)), "|", `\|`))
+		}
+		if len(row) > cols {
+			cols = len(row)
+		}
+		cells = append(cells, row)
+	}
+	if !header {
+		cells = append([][]string{make([]string, cols)}, cells...)
+	}
+	out := []string{""}
+	for i, row := range cells {
+		for len(row) < cols {
+			row = append(row, "")
+		}
+		out = append(out, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			out = append(out, strings.TrimSuffix(strings.Repeat("| --- ", cols), " ")+" |")
+		}
+	}
+	return append(out, "")
+}
+
+// inline converts the formatting.
+func (dp *dokuPage) inline(s string) string {
+	s = dwBold.ReplaceAllString(s, "**$1**")
+	s = dwItalic.ReplaceAllString(s, "*$1*")
+	s = dwUnderline.ReplaceAllString(s, "*$1*")
+	s = dwStrike.ReplaceAllString(s, "~~$1~~")
+	return dwBreak.ReplaceAllString(s, "\\\n")
+}
+
+// link converts a link [[target|label]].
+func (dp *dokuPage) link(m string) string {
+	target, label, _ := strings.Cut(dwLink.FindStringSubmatch(m)[1], "|")
+	target, label = strings.TrimSpace(target), strings.TrimSpace(label)
+	if label != "" {
+		label = dwMedia.ReplaceAllStringFunc(label, dp.media)
+	}
+	switch {
+	case dwScheme.MatchString(target):
+		if label == "" {
+			return dp.protect("<" + target + ">")
+		}
+		return dp.protect("[" + label + "](" + target + ")")
+	case dwInterwiki.MatchString(target) || strings.HasPrefix(target, `\\`):
+		dp.dw.problemOnce(dp.id+" "+target, "link '%s' in '%s' isn't supported and is kept as text", target, dp.id)
+		if label == "" {
+			_, label, _ = strings.Cut(target, ">")
+		}
+		return label
+	}
+	page, anchor, _ := strings.Cut(target, "#")
+	if label == "" {
+		label = page
+		if page == "" {
+			label = anchor
+		}
+	}
+	u := ""
+	if page != "" {
+		u = "/view/" + dwPath(dp.dw.section, dwResolve(dwNamespace(dp.id), page))
+	}
+	if anchor != "" {
+		u += "#" + slugify(anchor)
+	}
+	return dp.protect("[" + label + "](" + u + ")")
+}
+
+// media converts an embedding {{name?options|caption}} of a media file.
+func (dp *dokuPage) media(m string) string {
+	src, caption, _ := strings.Cut(dwMedia.FindStringSubmatch(m)[1], "|")
+	src, caption = strings.TrimSpace(src), strings.TrimSpace(caption)
+	if dwInterwiki.MatchString(src) {
+		dp.dw.problemOnce(dp.id+" "+src, "plugin '%s' in '%s' is kept as text", src, dp.id)
+		return m
+	}
+	src, _, _ = strings.Cut(src, "?")
+	ext := strings.ToLower(path.Ext(src))
+	var u string
+	if dwScheme.MatchString(src) {
+		u = src
+	} else {
+		id := dwResolve(dwNamespace(dp.id), src)
+		rel := path.Clean("media/" + strings.ReplaceAll(id, ":", "/"))
+		if !strings.HasPrefix(rel, "media/") {
+			dp.dw.problemOnce(dp.id+" "+id, "media file '%s' of '%s' is outside of the media directory", id, dp.id)
+			return caption
+		}
+		if fi, err := os.Stat(filepath.Join(dp.dw.dir, filepath.FromSlash(rel))); err != nil || !fi.Mode().IsRegular() {
+			dp.dw.problemOnce(dp.id+" "+id, "media file '%s' of '%s' is missing", id, dp.id)
+			if caption == "" {
+				caption = id
+			}
+			return caption
+		}
+		u = dp.dw.url(rel, dp.dir)
+	}
+	if caption == "" {
+		caption = src[strings.LastIndexAny(src, ":/")+1:]
+	}
+	if !imageExtensions[ext] {
+		return dp.protect("[" + caption + "](" + u + ")")
+	}
+	return dp.protect("![" + caption + "](" + u + ")")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDokuWikiMarkup(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFile(filepath.Join(dir, "media", "wiki", "arch.png"), strings.NewReader("png")); err != nil {
+		t.Fatal(err)
+	}
+	for i, this := range []struct {
+		markup string
+		expect string
+		tags   []interface{}
+	}{
+		{"===== Intro =====\nSome **bold**, //italic//, __underlined__ and <del>gone</del>.",
+			"## Intro\nSome **bold**, *italic*, *underlined* and ~~gone~~.\n", nil},
+		{"See [[setup]], [[:start|home]], [[.:sub:page#First steps]], [[..:other]] and [[#top]].",
+			"See [setup](/view/dw/wiki/setup), [home](/view/dw/start), [.:sub:page](/view/dw/wiki/sub/page#first-steps), [..:other](/view/dw/other) and [top](#top).\n", nil},
+		{"[[https://example.com|Example]] [[https://example.org]] http://example.net/a//b. [[wp>Go]]",
+			"[Example](https://example.com) <https://example.org> http://example.net/a//b. Go\n", nil},
+		{"{{arch.png?200|The architecture}} {{:wiki:arch.png}} {{gone.pdf}}",
+			"![The architecture](/files/dw/wiki/arch.png) ![arch.png](/files/dw/wiki/arch.png) wiki:gone.pdf\n", nil},
+		{"  * a\n    * b\n  - one\n    - two", "- a\n  - b\n1. one\n   1. two\n", nil},
+		{"<code go>\nfunc f() {}\n</code>\n''**x**'' %%//raw//%%", "```go\nfunc f() {}\n```\n\n`**x**` //raw//\n", nil},
+		{"Para\n  preformatted\n    more\nEnd", "Para\n```\npreformatted\n  more\n```\nEnd\n", nil},
+		{"Fact.((Source A)) Other.((B))", "Fact.[^1] Other.[^2]\n\n[^1]: Source A\n[^2]: B\n", nil},
+		{"^ A ^ B ^\n| 1 | [[x|y]] |", "| A | B |\n| --- | --- |\n| 1 | [y](/view/dw/wiki/x) |\n", nil},
+		{"~~NOTOC~~\nline\\\\ break\n----\n{{tag>go web_dev}}", "line\\\nbreak\n\n---\n", []interface{}{"go", "web dev"}},
+	} {
+		dw := &dokuWiki{importFiles: newImportFiles(dir), section: "dw", reported: make(map[string]bool)}
+		dp := &dokuPage{dw: dw, id: "wiki:page", dir: "dw/wiki"}
+		if got := dp.convert(this.markup); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+		if !reflect.DeepEqual(dp.tags, this.tags) {
+			t.Errorf("[%d] got tags %v but expected %v", i, dp.tags, this.tags)
+		}
+	}
+}
+
+func TestImportDokuWiki(t *testing.T) {
+	dir := t.TempDir()
+	for fn, s := range map[string]string{
+		"pages/start.txt":         "====== Welcome ======\nSee [[wiki:setup]].\n",
+		"pages/wiki/setup.txt":    "Setup {{diagram.png}}\n{{tag>howto}}\n",
+		"media/wiki/diagram.png":  "png",
+		"media/wiki/unused.pdf":   "pdf",
+		"meta/wiki/setup.changes": "1577934245\t192.0.2.1\tC\twiki:setup\talice\tcreated\n1609556645\t192.0.2.2\tE\twiki:setup\t\tfix\n",
+	} {
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(fn)), strings.NewReader(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "pages", "start.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	imp, err := importDokuWiki(dir, "dw")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(imp.Pages) != 2 {
+		t.Fatalf("got %d pages but expected 2", len(imp.Pages))
+	}
+	for i, this := range []struct {
+		path, body string
+		fm         map[string]interface{}
+	}{
+		{"dw/start", "See [wiki:setup](/view/dw/wiki/setup).\n", map[string]interface{}{"title": "Welcome", "date": "2022-03-04T05:06:07Z"}},
+		{"dw/wiki/setup", "Setup ![diagram.png](/files/dw/wiki/diagram.png)\n", map[string]interface{}{"title": "setup",
+			"date": "2020-01-02T03:04:05Z", "lastmod": "2021-01-02T03:04:05Z", "contributors": []interface{}{"alice", "192.0.2.2"}, "tags": []interface{}{"howto"}}},
+	} {
+		p := imp.Pages[i]
+		if p.Path != this.path || string(p.Body) != this.body || !reflect.DeepEqual(p.FrontMatter, this.fm) {
+			t.Errorf("[%d] got page %s with %v and body %q", i, p.Path, p.FrontMatter, p.Body)
+		}
+	}
+	var files []string
+	for _, f := range imp.Files {
+		files = append(files, f.Dir+"/"+f.Name)
+	}
+	if !reflect.DeepEqual(files, []string{"dw/wiki/diagram.png", "dw/wiki/unused.pdf"}) {
+		t.Errorf("got files %v", files)
+	}
+}
+
+func TestDokuWikiMediaOutside(t *testing.T) {
+	for i, this := range []struct{ ns, target, id string }{
+		{"wiki", ":..:..:etc:passwd", "etc:passwd"},
+		{"wiki", "../../etc/passwd", "etc:passwd"},
+		{"wiki:sub", "..:pic.png", "wiki:pic.png"},
+		{"wiki", "a/b", "a:b"},
+	} {
+		if id := dwResolve(this.ns, this.target); id != this.id {
+			t.Errorf("[%d] got %q but expected %q", i, id, this.id)
+		}
+	}
+	dir := t.TempDir()
+	for fn, s := range map[string]string{
+		"pages/wiki/evil.txt": "{{:..:..:..:secret.txt}} {{..:..:..:secret.txt}} {{/../secret.txt|x}}\n",
+		"secret.txt":          "secret",
+	} {
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(fn)), strings.NewReader(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imp, err := importDokuWiki(dir, "dw")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(imp.Files) != 0 || len(imp.Problems) == 0 {
+		t.Errorf("got files %+v and problems %q", imp.Files, imp.Problems)
+	}
+}
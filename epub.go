@@ -0,0 +1,341 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// A section or the pages with a tag are exported as EPUB (GET /export/epub
+// with section and/or tag) with a chapter per page ordered by weight and
+// date, a table of contents and the images the pages embed. Links between
+// the chapters stay in the book, other links point to the wiki.
+
+const EPUBPath = "/export/epub"
+
+// epubChapter is a page of the book.
+type epubChapter struct {
+	ID, File, Title string
+}
+
+// epubImage is an attachment embedded by a chapter.
+type epubImage struct {
+	ID, File, MediaType string
+}
+
+type epubBook struct {
+	ID, Title, Lang, Modified string
+	Chapters                  []*epubChapter
+	Images                    []*epubImage
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+var epubTemplates = template.Must(template.New("").Funcs(template.FuncMap{"xml": xmlEscape, "inc": func(i int) int { return i + 1 }}).Parse(`
+{{define "container"}}<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+{{end}}
+{{define "opf"}}<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">{{xml .ID}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:language>{{xml .Lang}}</dc:language>
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+{{range .Chapters}}    <item id="{{.ID}}" href="{{.File}}" media-type="application/xhtml+xml"/>
+{{end}}{{range .Images}}    <item id="{{.ID}}" href="{{xml .File}}" media-type="{{.MediaType}}"/>
+{{end}}  </manifest>
+  <spine toc="ncx">
+{{range .Chapters}}    <itemref idref="{{.ID}}"/>
+{{end}}  </spine>
+</package>
+{{end}}
+{{define "nav"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{xml .Lang}}" xml:lang="{{xml .Lang}}">
+<head><meta charset="UTF-8"/><title>{{xml .Title}}</title></head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>{{xml .Title}}</h1>
+<ol>
+{{range .Chapters}}<li><a href="{{.File}}">{{xml .Title}}</a></li>
+{{end}}</ol>
+</nav>
+</body>
+</html>
+{{end}}
+{{define "ncx"}}<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head><meta name="dtb:uid" content="{{xml .ID}}"/></head>
+  <docTitle><text>{{xml .Title}}</text></docTitle>
+  <navMap>
+{{range $i, $c := .Chapters}}    <navPoint id="n{{$c.ID}}" playOrder="{{inc $i}}"><navLabel><text>{{xml $c.Title}}</text></navLabel><content src="{{$c.File}}"/></navPoint>
+{{end}}  </navMap>
+</ncx>
+{{end}}
+{{define "chapter"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" lang="{{xml .Lang}}" xml:lang="{{xml .Lang}}">
+<head><meta charset="UTF-8"/><title>{{xml .Title}}</title></head>
+<body>
+<h1>{{xml .Title}}</h1>
+{{.Body}}
+</body>
+</html>
+{{end}}`))
+
+// epubPages returns the pages the client of r may view below section and
+// with tag (if not empty) in book order: by weight and date (unset ones
+// last), title and path with the index page of the section first.
+func epubPages(r *http.Request, section, tag string, drafts bool) []*PageInfo {
+	var infos []*PageInfo
+	for _, info := range index.Pages(drafts) {
+		if inSection(info.Path, section) && (tag == "" || contains(info.Tags, tag)) && mayView(r, info.Path) {
+			infos = append(infos, info)
+		}
+	}
+	first := path.Join(section, IndexPage)
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if (a.Path == first) != (b.Path == first) {
+			return a.Path == first
+		}
+		if wa, wb := toInt(a.Params["weight"]), toInt(b.Params["weight"]); wa != wb {
+			if wa == 0 || wb == 0 {
+				return wb == 0
+			}
+			return wa < wb
+		}
+		if a.Date != b.Date {
+			return a.Date != "" && (b.Date == "" || a.Date < b.Date)
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.Path < b.Path
+	})
+	return infos
+}
+
+// epubWriter writes the files of a book to a zip.
+type epubWriter struct {
+	zw     *zip.Writer
+	book   *epubBook
+	files  map[string]string // chapter files by page path
+	images map[string]string // image files by attachment path
+	base   string            // URL of the wiki
+}
+
+// writeEPUB writes the book title of the pages infos to w.
+func writeEPUB(w io.Writer, r *http.Request, title string, infos []*PageInfo) error {
+	ew := &epubWriter{zw: zip.NewWriter(w), files: make(map[string]string), images: make(map[string]string), base: baseURL(r)}
+	ew.book = &epubBook{Title: title, Lang: site.DefaultLanguage, Modified: time.Now().UTC().Format("2006-01-02T15:04:05Z")}
+	id := sha1.New()
+	for i, info := range infos {
+		c := &epubChapter{ID: fmt.Sprintf("c%d", i+1), File: fmt.Sprintf("chapter-%03d.xhtml", i+1), Title: info.Title}
+		if c.Title == "" {
+			c.Title = info.Path
+		}
+		ew.files[info.Path] = c.File
+		ew.book.Chapters = append(ew.book.Chapters, c)
+		fmt.Fprintln(id, info.Path)
+	}
+	sum := id.Sum(nil)
+	ew.book.ID = fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+	// The mimetype comes first and uncompressed.
+	mt, err := ew.zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(mt, "application/epub+zip"); err != nil {
+		return err
+	}
+	if err = ew.template("META-INF/container.xml", "container", nil); err != nil {
+		return err
+	}
+	for i, info := range infos {
+		p, _, err := exportPage(r, info.Path)
+		if err != nil {
+			return fmt.Errorf("unable to export page '%s': %s", info.Path, err)
+		}
+		if i == 0 {
+			ew.book.Lang = p.Lang()
+		}
+		body, err := ew.xhtml(p)
+		if err != nil {
+			return fmt.Errorf("unable to convert page '%s': %s", info.Path, err)
+		}
+		data := map[string]string{"Title": ew.book.Chapters[i].Title, "Lang": p.Lang(), "Body": body}
+		if err = ew.template("OEBPS/"+ew.book.Chapters[i].File, "chapter", data); err != nil {
+			return err
+		}
+	}
+	for _, f := range []struct{ name, tmpl string }{{"OEBPS/nav.xhtml", "nav"}, {"OEBPS/toc.ncx", "ncx"}, {"OEBPS/content.opf", "opf"}} {
+		if err = ew.template(f.name, f.tmpl, ew.book); err != nil {
+			return err
+		}
+	}
+	return ew.zw.Close()
+}
+
+func (ew *epubWriter) template(name, tmpl string, data interface{}) error {
+	f, err := ew.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return epubTemplates.ExecuteTemplate(f, tmpl, data)
+}
+
+// xhtml returns the rendered page p as XHTML with links to chapters
+// pointing into the book, images added to it and other links to the wiki.
+func (ew *epubWriter) xhtml(p *Page) (string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(string(p.Rendered())), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return "", err
+	}
+	var rewrite func(*html.Node) error
+	rewrite = func(n *html.Node) error {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				switch {
+				case a.Key == "href" && strings.HasPrefix(a.Val, "/view/"):
+					target, anchor, _ := strings.Cut(strings.TrimPrefix(a.Val, "/view/"), "#")
+					if f, ok := ew.files[target]; ok {
+						n.Attr[i].Val = strings.TrimSuffix(f+"#"+anchor, "#")
+					} else {
+						n.Attr[i].Val = ew.base + a.Val
+					}
+				case a.Key == "src" && strings.HasPrefix(a.Val, "/files/"):
+					f, err := ew.image(strings.TrimPrefix(a.Val, "/files/"))
+					if err != nil {
+						return err
+					}
+					if f == "" {
+						f = ew.base + a.Val
+					}
+					n.Attr[i].Val = f
+				case (a.Key == "href" || a.Key == "src") && strings.HasPrefix(a.Val, "/") && !strings.HasPrefix(a.Val, "//"):
+					n.Attr[i].Val = ew.base + a.Val
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if err := rewrite(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		if err = rewrite(n); err != nil {
+			return "", err
+		}
+		if err = html.Render(&buf, n); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// image adds the attachment at path to the book and returns its file, ""
+// if it doesn't exist.
+func (ew *epubWriter) image(p string) (string, error) {
+	p, _, _ = strings.Cut(p, "?")
+	if f, ok := ew.images[p]; ok {
+		return f, nil
+	}
+	dir := attachmentDir(p)
+	src, err := attachmentFS(dir).Open(attachmentFile(dir, path.Base(p)))
+	if err != nil {
+		ew.images[p] = ""
+		return "", nil
+	}
+	defer src.Close()
+	f := "images/" + p
+	w, err := ew.zw.Create("OEBPS/" + f)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		return "", err
+	}
+	mt := mime.TypeByExtension(path.Ext(p))
+	if mt == "" {
+		mt = "application/octet-stream"
+	}
+	mt, _, _ = strings.Cut(mt, ";")
+	ew.images[p] = f
+	ew.book.Images = append(ew.book.Images, &epubImage{ID: fmt.Sprintf("i%d", len(ew.book.Images)+1), File: f, MediaType: mt})
+	return f, nil
+}
+
+// epubHandler exports the pages below ?section= and/or with ?tag= (with
+// ?drafts=true also drafts) as EPUB titled ?title=.
+func epubHandler(w http.ResponseWriter, r *http.Request) {
+	section := strings.Trim(r.FormValue("section"), "/")
+	tag := r.FormValue("tag")
+	if section != "" && checkPath(section) != nil {
+		http.Error(w, fmt.Sprintf("invalid section '%s'", section), http.StatusBadRequest)
+		return
+	}
+	infos := epubPages(r, section, tag, r.FormValue("drafts") == "true")
+	if len(infos) == 0 {
+		http.Error(w, "no pages to export", http.StatusNotFound)
+		return
+	}
+	title, name := r.FormValue("title"), "wiki"
+	switch {
+	case section != "":
+		name = path.Base(section)
+	case tag != "":
+		name = slugify(tag)
+	}
+	if title == "" {
+		title = site.Title
+		switch {
+		case infos[0].Path == path.Join(section, IndexPage) && infos[0].Title != "":
+			title = infos[0].Title
+		case section != "":
+			title = path.Base(section)
+		case tag != "":
+			title = "Pages tagged " + tag
+		}
+	}
+	if title == "" {
+		title = "Wiki"
+	}
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.epub"`)
+	if err := writeEPUB(w, r, title, infos); err != nil {
+		// the response is partly written already
+		logger(r.Context()).Error("Unable to write EPUB", "section", section, "tag", tag, "err", err)
+		return
+	}
+	audit(r, "export", section)
+}
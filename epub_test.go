@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEPUB(t *testing.T) {
+	defer func(s Storage, pi *pageIndex, c ContentFS) { store, index, content = s, pi, c }(store, index, content)
+	store = newMemoryStorage()
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	content = newMemFS()
+	for path, src := range map[string]string{
+		"docs/_index":  "+++\ntitle = \"The Docs\"\n+++\nStart with [[docs/setup]].\n",
+		"docs/setup":   "+++\ntitle = \"Setup\"\nweight = 1\ntags = [\"x\"]\n+++\n![diagram](/files/docs/diagram.png) ![gone](/files/docs/gone.png) See [[docs/usage#details|usage]] and [[other]].\\\nNext line.\n",
+		"docs/usage":   "+++\ntitle = \"Usage\"\ndate = 2024-01-02T00:00:00Z\n+++\nUse it & enjoy.\n",
+		"docs/older":   "+++\ntitle = \"Older\"\ndate = 2023-01-02T00:00:00Z\ntags = [\"x\"]\n+++\nOld.\n",
+		"docs/drafted": "+++\ntitle = \"Draft\"\ndraft = true\n+++\nDraft.\n",
+		"other":        "+++\ntitle = \"Other\"\ntags = [\"x\"]\n+++\nOther.\n",
+	} {
+		if err := store.Save(path, []byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := content.WriteFile(attachmentFile("docs", "diagram.png"), []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Build(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "http://wiki/export/epub", nil)
+	for i, this := range []struct {
+		section, tag string
+		expect       []string
+	}{
+		{"docs", "", []string{"docs/_index", "docs/setup", "docs/older", "docs/usage"}},
+		{"", "x", []string{"docs/setup", "docs/older", "other"}},
+		{"docs", "x", []string{"docs/setup", "docs/older"}},
+	} {
+		var paths []string
+		for _, info := range epubPages(r, this.section, this.tag, false) {
+			paths = append(paths, info.Path)
+		}
+		if !reflect.DeepEqual(paths, this.expect) {
+			t.Errorf("[%d] got %v but expected %v", i, paths, this.expect)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := writeEPUB(&b, r, "The Docs", epubPages(r, "docs", "", false)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		c, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(c)
+		names = append(names, f.Name)
+	}
+	if names[0] != "mimetype" || zr.File[0].Method != zip.Store || files["mimetype"] != "application/epub+zip" {
+		t.Errorf("the mimetype isn't first and stored: %v", names)
+	}
+	for name, parts := range map[string][]string{
+		"OEBPS/chapter-001.xhtml":       {"<h1>The Docs</h1>", `href="chapter-002.xhtml"`},
+		"OEBPS/chapter-002.xhtml":       {`src="images/docs/diagram.png"`, `src="http://wiki/files/docs/gone.png"`, `href="chapter-004.xhtml#details"`, `href="http://wiki/view/other"`, "<br/>"},
+		"OEBPS/chapter-004.xhtml":       {"Use it &amp; enjoy."},
+		"OEBPS/images/docs/diagram.png": {"png"},
+		"OEBPS/nav.xhtml":               {`<li><a href="chapter-003.xhtml">Older</a></li>`},
+		"OEBPS/content.opf":             {"<dc:title>The Docs</dc:title>", `<item id="i1" href="images/docs/diagram.png" media-type="image/png"/>`, `<itemref idref="c4"/>`},
+		"OEBPS/toc.ncx":                 {`playOrder="4"`},
+		"META-INF/container.xml":        {`full-path="OEBPS/content.opf"`},
+	} {
+		for _, p := range parts {
+			if !strings.Contains(files[name], p) {
+				t.Errorf("%q is missing in %s: %s", p, name, files[name])
+			}
+		}
+	}
+}
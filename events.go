@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Page changes are streamed as server-sent events (GET /events?path=) so
+// open views can refresh and external tools can react. Clients only get
+// events of pages they may view; slow clients miss events.
+
+const (
+	EventsBuffer    = 16
+	EventsHeartbeat = 30 * time.Second
+)
+
+// ChangeEvent is a change of a page sent to /events.
+type ChangeEvent struct {
+	ID   uint64    `json:"-"`
+	Kind string    `json:"kind"` // "save", "delete" or "rename"
+	Path string    `json:"path"`
+	From string    `json:"from,omitempty"` // old path of renamed pages
+	User string    `json:"user"`
+	Time time.Time `json:"time"`
+}
+
+type eventBroker struct {
+	mutex  sync.Mutex
+	lastID uint64
+	subs   map[chan *ChangeEvent]bool
+}
+
+var changeEvents = &eventBroker{subs: make(map[chan *ChangeEvent]bool)}
+
+// Subscribe returns a channel receiving all events until Unsubscribe.
+func (b *eventBroker) Subscribe() chan *ChangeEvent {
+	c := make(chan *ChangeEvent, EventsBuffer)
+	b.mutex.Lock()
+	b.subs[c] = true
+	b.mutex.Unlock()
+	return c
+}
+
+func (b *eventBroker) Unsubscribe(c chan *ChangeEvent) {
+	b.mutex.Lock()
+	delete(b.subs, c)
+	b.mutex.Unlock()
+}
+
+// Publish sends e to all subscribers that aren't behind.
+func (b *eventBroker) Publish(e *ChangeEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.lastID++
+	e.ID = b.lastID
+	for c := range b.subs {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// publishChange publishes the page changes of the audit entry e.
+func publishChange(e *AuditEntry) {
+	switch e.Action {
+	case "save", "delete":
+		changeEvents.Publish(&ChangeEvent{Kind: e.Action, Path: e.Path, User: e.User, Time: e.Time})
+	case "rename":
+		if from, to, ok := strings.Cut(e.Path, " -> "); ok {
+			changeEvents.Publish(&ChangeEvent{Kind: e.Action, Path: to, From: from, User: e.User, Time: e.Time})
+		}
+	}
+}
+
+// wants reports whether the client of r gets the event e for pages below
+// prefix.
+func (e *ChangeEvent) wants(r *http.Request, prefix string) bool {
+	for _, p := range []string{e.Path, e.From} {
+		if p != "" && inSection(p, prefix) && mayView(r, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventsHandler streams the page changes (below ?path=) as server-sent
+// events until the client goes away or the server shuts down.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.Trim(r.FormValue("path"), "/")
+	c := changeEvents.Subscribe()
+	defer changeEvents.Unsubscribe(c)
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger(r.Context()).Error("Unable to stream events", "err", err)
+		return
+	}
+	heartbeat := time.NewTicker(EventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e := <-c:
+			if !e.wants(r, prefix) {
+				continue
+			}
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", e.ID, b)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		case <-stopping:
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublishChange(t *testing.T) {
+	c := changeEvents.Subscribe()
+	defer changeEvents.Unsubscribe(c)
+	for _, e := range []*AuditEntry{
+		{Action: "save", Path: "docs/a", User: "alice"},
+		{Action: "upload", Path: "docs/x.png", User: "alice"},
+		{Action: "rename", Path: "docs/a -> docs/b", User: "bob"},
+		{Action: "delete", Path: "docs/b", User: "bob"},
+	} {
+		publishChange(e)
+	}
+	for i, expect := range []ChangeEvent{
+		{Kind: "save", Path: "docs/a", User: "alice"},
+		{Kind: "rename", Path: "docs/b", From: "docs/a", User: "bob"},
+		{Kind: "delete", Path: "docs/b", User: "bob"},
+	} {
+		got := <-c
+		if got.Kind != expect.Kind || got.Path != expect.Path || got.From != expect.From || got.User != expect.User {
+			t.Errorf("[%d] got %+v but expected %+v", i, got, expect)
+		}
+	}
+	if len(c) != 0 {
+		t.Errorf("got %d unexpected events", len(c))
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/events?path=docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got content type %q", ct)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		changeEvents.mutex.Lock()
+		n := len(changeEvents.subs)
+		changeEvents.mutex.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	publishChange(&AuditEntry{Action: "save", Path: "blog/a", User: "alice"})
+	publishChange(&AuditEntry{Action: "rename", Path: "blog/b -> docs/b", User: "alice"})
+	br := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(l))
+	}
+	if lines[1] != "event: change" || !strings.HasPrefix(lines[2], `data: {"kind":"rename","path":"docs/b","from":"blog/b","user":"alice"`) {
+		t.Errorf("got %q", lines)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// The bulk export (GET /api/v1/export?section=&format=zip|jsonl) streams
+// all pages of a section the client may view for migrations and external
+// processing: as zip of the page files or as one JSON object per line.
+
+// ExportedPage is a line of the JSON-lines export.
+type ExportedPage struct {
+	Path        string                 `json:"path"`
+	Revision    string                 `json:"revision"`
+	Modified    *time.Time             `json:"modified,omitempty"`
+	FrontMatter map[string]interface{} `json:"frontMatter"`
+	Body        string                 `json:"body"`
+}
+
+// exportPaths returns the paths of the pages below section the client of
+// r may view.
+func exportPaths(r *http.Request, section string, drafts bool) []string {
+	var paths []string
+	for _, info := range index.Pages(drafts) {
+		if inSection(info.Path, section) && mayView(r, info.Path) {
+			paths = append(paths, info.Path)
+		}
+	}
+	return paths
+}
+
+// exportPage loads the page at path (redacted for non-editors) and returns
+// it with its source.
+func exportPage(r *http.Request, path string) (*Page, []byte, error) {
+	p, err := loadPage(r.Context(), path)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := store.Load(path)
+	if err == nil {
+		src, err = sourceFor(r, path, src)
+	}
+	return p.For(r), src, err
+}
+
+// writeExport writes the pages at paths to w in format ("zip" or "jsonl").
+func writeExport(w io.Writer, r *http.Request, format string, paths []string) error {
+	var a archiver
+	enc := json.NewEncoder(w)
+	if format == "zip" {
+		a = &zipArchiver{zw: zip.NewWriter(w)}
+	}
+	for _, path := range paths {
+		p, src, err := exportPage(r, path)
+		if err != nil {
+			return fmt.Errorf("unable to export page '%s': %s", path, err)
+		}
+		modTime := pageModTime(path)
+		if a != nil {
+			err = a.Add(path+Suffix, int64(len(src)), modTime, bytes.NewReader(src))
+		} else {
+			ep := ExportedPage{Path: path, Revision: p.Revision, FrontMatter: p.FrontMatter, Body: string(p.Body)}
+			if !modTime.IsZero() {
+				ep.Modified = &modTime
+			}
+			err = enc.Encode(ep)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		return a.Close()
+	}
+	return nil
+}
+
+// exportHandler streams the pages below ?section= (with ?drafts=true also
+// drafts) as zip (format=zip, default) or JSON lines (format=jsonl).
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	section := strings.Trim(r.FormValue("section"), "/")
+	format := r.FormValue("format")
+	name := "export"
+	if section != "" {
+		name = path.Base(section)
+	}
+	switch format {
+	case "", "zip":
+		format = "zip"
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.jsonl"`)
+	default:
+		http.Error(w, fmt.Sprintf("unknown format '%s'", format), http.StatusBadRequest)
+		return
+	}
+	paths := exportPaths(r, section, r.FormValue("drafts") == "true")
+	if err := writeExport(w, r, format, paths); err != nil {
+		// the response is partly written already
+		logger(r.Context()).Error("Unable to write export", "section", section, "format", format, "err", err)
+		return
+	}
+	audit(r, "export", section)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWriteExport(t *testing.T) {
+	defer func(s Storage) { store = s }(store)
+	store = newMemoryStorage()
+	pages := map[string]string{"export/a": "+++\ntitle = \"A\"\n+++\nA\n", "export/b": "---\ntags: [x]\n---\nB\n"}
+	for path, content := range pages {
+		if err := store.Save(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := []string{"export/a", "export/b"}
+	r := httptest.NewRequest("GET", "/api/v1/export", nil)
+
+	var zb bytes.Buffer
+	if err := writeExport(&zb, r, "zip", paths); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zb.Bytes()), int64(zb.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(b)
+	}
+	expect := map[string]string{"export/a.md": pages["export/a"], "export/b.md": pages["export/b"]}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %q from zip but expected %q", got, expect)
+	}
+
+	var jb bytes.Buffer
+	if err := writeExport(&jb, r, "jsonl", paths); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sc := bufio.NewScanner(&jb)
+	for i, this := range []struct {
+		path  string
+		title interface{}
+		body  string
+	}{
+		{"export/a", "A", "A\n"},
+		{"export/b", nil, "B\n"},
+	} {
+		if !sc.Scan() {
+			t.Fatalf("[%d] missing line", i)
+		}
+		var ep ExportedPage
+		if err := json.Unmarshal(sc.Bytes(), &ep); err != nil {
+			t.Fatalf("[%d] invalid line %q: %s", i, sc.Text(), err)
+		}
+		if ep.Path != this.path || ep.FrontMatter["title"] != this.title || ep.Body != this.body || ep.Revision == "" {
+			t.Errorf("[%d] got %+v but expected %s with title %v and body %q", i, ep, this.path, this.title, this.body)
+		}
+	}
+	if sc.Scan() {
+		t.Errorf("got unexpected line %q", sc.Text())
+	}
+
+	if err := writeExport(&jb, r, "jsonl", []string{"export/missing"}); err == nil {
+		t.Errorf("got no error for a missing page")
+	}
+}
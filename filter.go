@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a compiled front matter filter expression like
+//
+//	params.project == "atlas" && weight < 50
+//
+// Names are front matter keys ("params." is optional, "path" is the page
+// path). Supported are ==, !=, <, <=, >, >=, =~ (regexp), in (list or
+// substring), !, &&, || and parentheses.
+type Filter struct {
+	expr filterExpr
+}
+
+type filterExpr interface {
+	eval(info *PageInfo) interface{}
+}
+
+// ParseFilter compiles expr. An empty expression matches all pages.
+func ParseFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return &Filter{}, nil
+	}
+	toks, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	fp := &filterParser{toks: toks}
+	e, err := fp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if fp.pos < len(fp.toks) {
+		return nil, fmt.Errorf("unexpected '%s' in filter at position %d", fp.toks[fp.pos].text, fp.toks[fp.pos].pos)
+	}
+	return &Filter{expr: e}, nil
+}
+
+// Match reports whether info satisfies the filter.
+func (f *Filter) Match(info *PageInfo) bool {
+	if f == nil || f.expr == nil {
+		return true
+	}
+	return truthy(f.expr.eval(info))
+}
+
+type filterToken struct {
+	kind  byte // 'n'ame, 's'tring, 'd'igit, 'o'perator
+	text  string
+	value interface{}
+	pos   int
+}
+
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")"}
+
+func tokenizeFilter(s string) ([]filterToken, error) {
+	var toks []filterToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string in filter at position %d", i)
+			}
+			toks = append(toks, filterToken{kind: 's', text: s[i : j+1], value: b.String(), pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' in filter at position %d", s[i:j], i)
+			}
+			toks = append(toks, filterToken{kind: 'd', text: s[i:j], value: f, pos: i})
+			i = j
+		case isNameByte(c):
+			j := i
+			for j < len(s) && (isNameByte(s[j]) || s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == '-') {
+				j++
+			}
+			toks = append(toks, filterToken{kind: 'n', text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range filterOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected '%c' in filter at position %d", c, i)
+			}
+			toks = append(toks, filterToken{kind: 'o', text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (fp *filterParser) peek(op string) bool {
+	if fp.pos >= len(fp.toks) {
+		return false
+	}
+	t := fp.toks[fp.pos]
+	return (t.kind == 'o' || t.kind == 'n') && t.text == op
+}
+
+func (fp *filterParser) parseOr() (filterExpr, error) {
+	l, err := fp.parseAnd()
+	for err == nil && fp.peek("||") {
+		fp.pos++
+		var r filterExpr
+		if r, err = fp.parseAnd(); err == nil {
+			l = logicalExpr{op: "||", l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (fp *filterParser) parseAnd() (filterExpr, error) {
+	l, err := fp.parseNot()
+	for err == nil && fp.peek("&&") {
+		fp.pos++
+		var r filterExpr
+		if r, err = fp.parseNot(); err == nil {
+			l = logicalExpr{op: "&&", l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (fp *filterParser) parseNot() (filterExpr, error) {
+	if fp.peek("!") {
+		fp.pos++
+		e, err := fp.parseNot()
+		return notExpr{e}, err
+	}
+	return fp.parseCompare()
+}
+
+func (fp *filterParser) parseCompare() (filterExpr, error) {
+	l, err := fp.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "=~", "<", ">", "in"} {
+		if fp.peek(op) {
+			fp.pos++
+			r, err := fp.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			if op == "=~" {
+				lit, ok := r.(literalExpr)
+				s, isString := lit.v.(string)
+				if !ok || !isString {
+					return nil, fmt.Errorf("'=~' needs a string literal as regular expression")
+				}
+				re, err := regexp.Compile(s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid regular expression '%s': %s", s, err)
+				}
+				return matchExpr{l: l, re: re}, nil
+			}
+			return compareExpr{op: op, l: l, r: r}, nil
+		}
+	}
+	return l, nil
+}
+
+func (fp *filterParser) parseOperand() (filterExpr, error) {
+	if fp.pos >= len(fp.toks) {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	t := fp.toks[fp.pos]
+	fp.pos++
+	switch t.kind {
+	case 's', 'd':
+		return literalExpr{t.value}, nil
+	case 'n':
+		switch t.text {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		}
+		return nameExpr(strings.ToLower(t.text)), nil
+	}
+	if t.text == "(" {
+		e, err := fp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !fp.peek(")") {
+			return nil, fmt.Errorf("missing ')' in filter")
+		}
+		fp.pos++
+		return e, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s' in filter at position %d", t.text, t.pos)
+}
+
+type literalExpr struct{ v interface{} }
+
+func (e literalExpr) eval(info *PageInfo) interface{} { return e.v }
+
+// nameExpr looks up a (dotted) front matter key. Like in Hugo templates
+// custom keys can be prefixed with "params.".
+type nameExpr string
+
+func (e nameExpr) eval(info *PageInfo) interface{} {
+	if e == "path" {
+		return info.Path
+	}
+	v := lookupParam(info.Params, string(e))
+	if v == nil && strings.HasPrefix(string(e), "params.") {
+		v = lookupParam(info.Params, strings.TrimPrefix(string(e), "params."))
+	}
+	return normalizeFilterValue(v)
+}
+
+func lookupParam(params map[string]interface{}, key string) interface{} {
+	var v interface{} = params
+	for _, k := range strings.Split(key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+type notExpr struct{ e filterExpr }
+
+func (e notExpr) eval(info *PageInfo) interface{} { return !truthy(e.e.eval(info)) }
+
+type logicalExpr struct {
+	op   string
+	l, r filterExpr
+}
+
+func (e logicalExpr) eval(info *PageInfo) interface{} {
+	if e.op == "&&" {
+		return truthy(e.l.eval(info)) && truthy(e.r.eval(info))
+	}
+	return truthy(e.l.eval(info)) || truthy(e.r.eval(info))
+}
+
+type matchExpr struct {
+	l  filterExpr
+	re *regexp.Regexp
+}
+
+func (e matchExpr) eval(info *PageInfo) interface{} {
+	v := e.l.eval(info)
+	if v == nil {
+		return false
+	}
+	return e.re.MatchString(fmt.Sprint(v))
+}
+
+type compareExpr struct {
+	op   string
+	l, r filterExpr
+}
+
+func (e compareExpr) eval(info *PageInfo) interface{} {
+	l, r := e.l.eval(info), e.r.eval(info)
+	switch e.op {
+	case "in":
+		switch rv := r.(type) {
+		case []interface{}:
+			for _, x := range rv {
+				if c, ok := compareValues(l, x); ok && c == 0 {
+					return true
+				}
+			}
+		case string:
+			ls, ok := l.(string)
+			return ok && strings.Contains(rv, ls)
+		}
+		return false
+	case "==":
+		c, ok := compareValues(l, r)
+		return ok && c == 0
+	case "!=":
+		c, ok := compareValues(l, r)
+		return !ok || c != 0
+	}
+	c, ok := compareValues(l, r)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// compareValues compares numbers, strings and booleans. Values of
+// different types can't be compared.
+func compareValues(a, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			switch {
+			case av < bv:
+				return -1, true
+			case av > bv:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0, true
+			}
+			if bv {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// normalizeFilterValue converts front matter values so they can be
+// compared: all numbers become float64 and dates RFC 3339 strings.
+func normalizeFilterValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, x := range v {
+			res[i] = normalizeFilterValue(x)
+		}
+		return res
+	case []string:
+		res := make([]interface{}, len(v))
+		for i, x := range v {
+			res[i] = x
+		}
+		return res
+	}
+	return v
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return true
+}
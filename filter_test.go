@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	info := &PageInfo{Path: "blog/atlas", Params: map[string]interface{}{
+		"title":   "Atlas",
+		"weight":  int64(10),
+		"draft":   false,
+		"tags":    []interface{}{"go", "maps"},
+		"date":    time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		"params":  map[string]interface{}{"owner": "ann"},
+		"project": "atlas",
+	}}
+	for i, this := range []struct {
+		expr   string
+		expect bool
+	}{
+		{``, true},
+		{`params.project == "atlas" && weight < 50`, true},
+		{`params.project == "atlas" && weight >= 50`, false},
+		{`project != 'atlas' || !draft`, true},
+		{`"go" in tags && !("rust" in tags)`, true},
+		{`params.owner == "ann"`, true},
+		{`date >= "2024-01-01" && date < "2025"`, true},
+		{`path =~ "^blog/"`, true},
+		{`missing`, false},
+		{`missing != 1`, true},
+		{`Title == "Atlas"`, true},
+		{`weight == -10`, false},
+	} {
+		f, err := ParseFilter(this.expr)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		if result := f.Match(info); result != this.expect {
+			t.Errorf("[%d] got %t but expected %t", i, result, this.expect)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for i, expr := range []string{
+		`title ==`,
+		`(weight < 5`,
+		`title == "x`,
+		`title =~ weight`,
+		`title =~ "("`,
+		`weight < 5 )`,
+		`title # 1`,
+	} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("[%d] expected an error for %q", i, expr)
+		}
+	}
+}
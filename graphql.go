@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A small GraphQL (https://spec.graphql.org/) implementation for the page
+// model: queries and mutations with arguments, variables, aliases and
+// fragments. Directives, subscriptions and introspection aren't supported;
+// the schema is served as SDL instead (see graphqlapi.go).
+
+const GraphQLMaxDepth = 10
+
+type gqlDocument struct {
+	Ops       []*gqlOperation
+	Fragments map[string]*gqlSelection // with On and Sel
+}
+
+type gqlOperation struct {
+	Kind string // "query" or "mutation"
+	Name string
+	Vars []gqlVarDef
+	Sel  []*gqlSelection
+}
+
+type gqlVarDef struct {
+	Name, Type string
+	Default    interface{}
+	HasDefault bool
+}
+
+// gqlSelection is a field (Name), a fragment spread (Spread) or an inline
+// fragment (On and Sel).
+type gqlSelection struct {
+	Alias, Name string
+	Args        map[string]interface{}
+	Spread      string
+	On          string
+	Sel         []*gqlSelection
+}
+
+// gqlVariable is a reference to a variable in a value.
+type gqlVariable string
+
+type gqlToken struct {
+	kind byte // 'p'unctuator, 'n'ame, 'i'nt, 'f'loat, 's'tring or 0 at the end
+	val  string
+	pos  int
+}
+
+func lexGraphQL(src string) ([]gqlToken, error) {
+	var ts []gqlToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			ts = append(ts, gqlToken{'p', "...", i})
+			i += 3
+		case strings.IndexByte("!$()[]{}:=@|", c) >= 0:
+			ts = append(ts, gqlToken{'p', string(c), i})
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			ts = append(ts, gqlToken{'n', src[i:j], i})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j, kind := i+1, byte('i')
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				if strings.IndexByte(".eE", src[j]) >= 0 {
+					kind = 'f'
+				}
+				j++
+			}
+			ts = append(ts, gqlToken{kind, src[i:j], i})
+			i = j
+		case c == '"':
+			if strings.HasPrefix(src[i:], `"""`) {
+				end := strings.Index(src[i+3:], `"""`)
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated string at %d", i)
+				}
+				ts = append(ts, gqlToken{'s', src[i+3 : i+3+end], i})
+				i += end + 6
+				continue
+			}
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			s, err := strconv.Unquote(strings.ReplaceAll(src[i:j+1], `\/`, "/"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d", i)
+			}
+			ts = append(ts, gqlToken{'s', s, i})
+			i = j + 1
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, fmt.Errorf("unexpected character '%c' at %d", r, i)
+		}
+	}
+	return append(ts, gqlToken{pos: len(src)}), nil
+}
+
+type gqlParser struct {
+	ts []gqlToken
+	i  int
+}
+
+func (p *gqlParser) peek(val string) bool {
+	t := p.ts[p.i]
+	return (t.kind == 'p' || t.kind == 'n') && t.val == val
+}
+
+func (p *gqlParser) skip(val string) bool {
+	if p.peek(val) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(val string) error {
+	if !p.skip(val) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *gqlParser) unexpected() error {
+	t := p.ts[p.i]
+	if t.kind == 0 {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected '%s' at %d", t.val, t.pos)
+}
+
+func (p *gqlParser) name() (string, error) {
+	if t := p.ts[p.i]; t.kind == 'n' {
+		p.i++
+		return t.val, nil
+	}
+	return "", p.unexpected()
+}
+
+// parseGraphQL parses the query document src.
+func parseGraphQL(src string) (*gqlDocument, error) {
+	ts, err := lexGraphQL(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{ts: ts}
+	doc := &gqlDocument{Fragments: make(map[string]*gqlSelection)}
+	for p.ts[p.i].kind != 0 {
+		switch {
+		case p.peek("{"):
+			op := &gqlOperation{Kind: "query"}
+			if op.Sel, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			doc.Ops = append(doc.Ops, op)
+		case p.peek("query") || p.peek("mutation"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Ops = append(doc.Ops, op)
+		case p.skip("fragment"):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			f := &gqlSelection{}
+			if err = p.expect("on"); err != nil {
+				return nil, err
+			}
+			if f.On, err = p.name(); err != nil {
+				return nil, err
+			}
+			if f.Sel, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			doc.Fragments[name] = f
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.Ops) == 0 {
+		return nil, fmt.Errorf("no operation")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{Kind: p.ts[p.i].val}
+	p.i++
+	if p.ts[p.i].kind == 'n' {
+		op.Name, _ = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			var v gqlVarDef
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			var err error
+			if v.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if v.Type, err = p.typeRef(); err != nil {
+				return nil, err
+			}
+			if p.skip("=") {
+				v.HasDefault = true
+				if v.Default, err = p.value(true); err != nil {
+					return nil, err
+				}
+			}
+			op.Vars = append(op.Vars, v)
+		}
+	}
+	if p.peek("@") {
+		return nil, fmt.Errorf("directives aren't supported")
+	}
+	var err error
+	op.Sel, err = p.selectionSet()
+	return op, err
+}
+
+func (p *gqlParser) typeRef() (string, error) {
+	var t string
+	if p.skip("[") {
+		e, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect("]"); err != nil {
+			return "", err
+		}
+		t = "[" + e + "]"
+	} else {
+		var err error
+		if t, err = p.name(); err != nil {
+			return "", err
+		}
+	}
+	if p.skip("!") {
+		t += "!"
+	}
+	return t, nil
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []*gqlSelection
+	for !p.skip("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, s)
+	}
+	return sels, nil
+}
+
+func (p *gqlParser) selection() (*gqlSelection, error) {
+	s := &gqlSelection{}
+	var err error
+	if p.skip("...") {
+		if p.skip("on") {
+			if s.On, err = p.name(); err != nil {
+				return nil, err
+			}
+		} else if !p.peek("{") {
+			s.Spread, err = p.name()
+			return s, err
+		}
+		s.Sel, err = p.selectionSet()
+		return s, err
+	}
+	if s.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.skip(":") {
+		s.Alias = s.Name
+		if s.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.skip("(") {
+		s.Args = make(map[string]interface{})
+		for !p.skip(")") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if s.Args[name], err = p.value(false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p.peek("@") {
+		return nil, fmt.Errorf("directives aren't supported")
+	}
+	if p.peek("{") {
+		s.Sel, err = p.selectionSet()
+	}
+	return s, err
+}
+
+// value parses a value; constant values can't contain variables.
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	t := p.ts[p.i]
+	switch {
+	case t.kind == 'p' && t.val == "$" && !constant:
+		p.i++
+		name, err := p.name()
+		return gqlVariable(name), err
+	case t.kind == 'p' && t.val == "[":
+		p.i++
+		l := []interface{}{}
+		for !p.skip("]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	case t.kind == 'p' && t.val == "{":
+		p.i++
+		m := map[string]interface{}{}
+		for !p.skip("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if m[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case t.kind == 'i':
+		p.i++
+		return strconv.Atoi(t.val)
+	case t.kind == 'f':
+		p.i++
+		return strconv.ParseFloat(t.val, 64)
+	case t.kind == 's':
+		p.i++
+		return t.val, nil
+	case t.kind == 'n':
+		p.i++
+		switch t.val {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t.val, nil // enum values are used as strings
+	}
+	return nil, p.unexpected()
+}
+
+// gqlField is a field of a schema type. Type is the name of a scalar or
+// of a type in the schema, lists are written as "[Type]".
+type gqlField struct {
+	Type    string
+	Resolve func(e *gqlExec, parent interface{}, args map[string]interface{}) (interface{}, error)
+}
+
+type gqlSchema map[string]map[string]*gqlField // type -> field -> definition
+
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlObject is a JSON object keeping the order of the selection.
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	Key   string
+	Value interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.Key)
+		v, err := json.Marshal(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// gqlExec executes an operation for a request.
+type gqlExec struct {
+	schema gqlSchema
+	doc    *gqlDocument
+	vars   map[string]interface{}
+	errors []gqlError
+	ctx    interface{} // passed to the resolvers (the HTTP request)
+}
+
+// operation returns the operation to execute.
+func (doc *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(doc.Ops) > 1 {
+			return nil, fmt.Errorf("operationName is required for documents with several operations")
+		}
+		return doc.Ops[0], nil
+	}
+	for _, op := range doc.Ops {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation '%s'", name)
+}
+
+// execute runs op with the variables vars and returns the data.
+func (e *gqlExec) execute(op *gqlOperation, vars map[string]interface{}) (gqlObject, error) {
+	e.vars = make(map[string]interface{})
+	for _, v := range op.Vars {
+		val, ok := vars[v.Name]
+		switch {
+		case ok:
+			e.vars[v.Name] = val
+		case v.HasDefault:
+			e.vars[v.Name] = v.Default
+		case strings.HasSuffix(v.Type, "!"):
+			return nil, fmt.Errorf("variable '$%s' of type %s is required", v.Name, v.Type)
+		}
+	}
+	root := strings.ToUpper(op.Kind[:1]) + op.Kind[1:]
+	if e.schema[root] == nil {
+		return nil, fmt.Errorf("%s isn't supported", op.Kind)
+	}
+	return e.selection(root, nil, op.Sel, nil), nil
+}
+
+// collect returns the fields of sels for the type typ with fragments
+// expanded. seen holds the fragments being expanded.
+func (e *gqlExec) collect(typ string, sels []*gqlSelection, seen map[string]bool) ([]*gqlSelection, error) {
+	var fs []*gqlSelection
+	for _, s := range sels {
+		if s.Name != "" {
+			fs = append(fs, s)
+			continue
+		}
+		name := s.Spread
+		if name != "" {
+			if s = e.doc.Fragments[name]; s == nil {
+				return nil, fmt.Errorf("unknown fragment '%s'", name)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("fragment '%s' spreads itself", name)
+			}
+		}
+		if s.On != "" && s.On != typ {
+			continue
+		}
+		seen[name] = true
+		sub, err := e.collect(typ, s.Sel, seen)
+		delete(seen, name)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, sub...)
+	}
+	return fs, nil
+}
+
+func (e *gqlExec) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, gqlError{Message: err.Error(), Path: append([]interface{}(nil), path...)})
+}
+
+// selection resolves the fields sels of the value parent of type typ.
+func (e *gqlExec) selection(typ string, parent interface{}, sels []*gqlSelection, path []interface{}) gqlObject {
+	depth := 0
+	for _, p := range path {
+		if _, ok := p.(string); ok {
+			depth++
+		}
+	}
+	if depth > GraphQLMaxDepth {
+		e.fail(path, fmt.Errorf("query is nested deeper than %d levels", GraphQLMaxDepth))
+		return nil
+	}
+	fs, err := e.collect(typ, sels, make(map[string]bool))
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	obj := gqlObject{}
+	for _, f := range fs {
+		key := f.Name
+		if f.Alias != "" {
+			key = f.Alias
+		}
+		fpath := append(path[:len(path):len(path)], key)
+		if f.Name == "__typename" {
+			obj = append(obj, gqlEntry{key, typ})
+			continue
+		}
+		def := e.schema[typ][f.Name]
+		if def == nil {
+			e.fail(fpath, fmt.Errorf("unknown field '%s' on type %s", f.Name, typ))
+			obj = append(obj, gqlEntry{key, nil})
+			continue
+		}
+		args := map[string]interface{}{}
+		if f.Args != nil {
+			args = e.args(f.Args).(map[string]interface{})
+		}
+		v, err := def.Resolve(e, parent, args)
+		if err != nil {
+			e.fail(fpath, err)
+			obj = append(obj, gqlEntry{key, nil})
+			continue
+		}
+		obj = append(obj, gqlEntry{key, e.complete(def.Type, v, f, fpath)})
+	}
+	return obj
+}
+
+// args replaces the variables in v.
+func (e *gqlExec) args(v interface{}) interface{} {
+	switch v := v.(type) {
+	case gqlVariable:
+		return e.vars[string(v)]
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, x := range v {
+			l[i] = e.args(x)
+		}
+		return l
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			m[k] = e.args(x)
+		}
+		return m
+	}
+	return v
+}
+
+// complete returns the value v of type typ for the response.
+func (e *gqlExec) complete(typ string, v interface{}, f *gqlSelection, path []interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice {
+			e.fail(path, fmt.Errorf("internal error: no list"))
+			return nil
+		}
+		l := make([]interface{}, rv.Len())
+		for i := range l {
+			l[i] = e.complete(typ[1:len(typ)-1], rv.Index(i).Interface(), f, append(path[:len(path):len(path)], i))
+		}
+		return l
+	}
+	if e.schema[typ] == nil {
+		if f.Sel != nil {
+			e.fail(path, fmt.Errorf("field '%s' of type %s has no fields", f.Name, typ))
+			return nil
+		}
+		return v
+	}
+	if f.Sel == nil {
+		e.fail(path, fmt.Errorf("field '%s' of type %s needs a selection of its fields", f.Name, typ))
+		return nil
+	}
+	if obj := e.selection(typ, v, f.Sel, path); obj != nil {
+		return obj
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type gqlTestBook struct {
+	Title  string
+	Author *gqlTestBook // the "author" is a book too to test nesting
+}
+
+var gqlTestSchema = gqlSchema{
+	"Query": {
+		"books": {"[Book]", func(_ *gqlExec, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			books := []*gqlTestBook{{Title: "A"}, {Title: "B", Author: &gqlTestBook{Title: "C"}}}
+			if n, ok := args["first"].(int); ok {
+				books = books[:n]
+			}
+			return books, nil
+		}},
+		"echo": {"JSON", func(_ *gqlExec, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			return args["v"], nil
+		}},
+		"fail": {"String", func(*gqlExec, interface{}, map[string]interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("failed")
+		}},
+	},
+	"Book": {
+		"title": {"String", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return p.(*gqlTestBook).Title, nil
+		}},
+		"author": {"Book", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return p.(*gqlTestBook).Author, nil
+		}},
+		"self": {"Book", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) { return p, nil }},
+	},
+}
+
+func TestGraphQL(t *testing.T) {
+	for i, this := range []struct {
+		query  string
+		op     string
+		vars   string
+		expect string // data and errors as JSON or the error
+	}{
+		{`{ books { title } }`, "", ``, `{"data":{"books":[{"title":"A"},{"title":"B"}]}}`},
+		{`query { b: books(first: 1) { t: title __typename } }`, "", ``, `{"data":{"b":[{"t":"A","__typename":"Book"}]}}`},
+		{`query Q($n: Int = 1) { books(first: $n) { title } }`, "", ``, `{"data":{"books":[{"title":"A"}]}}`},
+		{`query Q($n: Int!) { books(first: $n) { title } }`, "", ``, `variable '$n' of type Int! is required`},
+		{`query Q($v: JSON) { echo(v: $v) }`, "", `{"v":{"a":[1,"x"]}}`, `{"data":{"echo":{"a":[1,"x"]}}}`},
+		{`{ echo(v: {a: [1, 2.5, "x\ny", true, null, ENUM]}) }`, "", ``, `{"data":{"echo":{"a":[1,2.5,"x\ny",true,null,"ENUM"]}}}`},
+		{`{ echo(v: """ block "quoted" """) }`, "", ``, `{"data":{"echo":" block \"quoted\" "}}`},
+		{`{ books { ...F } } fragment F on Book { title author { title } }`, "", ``,
+			`{"data":{"books":[{"title":"A","author":null},{"title":"B","author":{"title":"C"}}]}}`},
+		{`{ books(first: 1) { ... on Book { title } ... on Other { x } } }`, "", ``, `{"data":{"books":[{"title":"A"}]}}`},
+		{`{ books { ...F } } fragment F on Book { title ...F }`, "", ``, `fragment 'F' spreads itself`},
+		{`{ books { ...F } } fragment F on Book { self { ...F } }`, "", ``, `nested deeper`},
+		{`{ fail books(first: 1) { title } }`, "", ``, `{"data":{"fail":null,"books":[{"title":"A"}]},"errors":[{"message":"failed","path":["fail"]}]}`},
+		{`{ books(first: 1) { nope } }`, "", ``, `{"data":{"books":[{"nope":null}]},"errors":[{"message":"unknown field 'nope' on type Book","path":["books",0,"nope"]}]}`},
+		{`{ books }`, "", ``, `needs a selection`},
+		{`{ echo(v: 1) { x } }`, "", ``, `has no fields`},
+		{`{ books(first: 1) { s1: self { s2: self { s3: self { s4: self { s5: self { s6: self { s7: self { s8: self { s9: self { s10: self { title } } } } } } } } } } } }`, "", ``, `nested deeper`},
+		{`query A { books { title } } query B { echo(v: 2) }`, "B", ``, `{"data":{"echo":2}}`},
+		{`query A { books { title } } query B { echo(v: 2) }`, "", ``, `operationName is required`},
+		{`mutation { books { title } }`, "", ``, `mutation isn't supported`},
+		{`{ books { title }`, "", ``, `unexpected end`},
+		{`{ books @skip(if: true) { title } }`, "", ``, `directives`},
+	} {
+		got := gqlRun(gqlTestSchema, this.query, this.op, this.vars)
+		if strings.HasPrefix(this.expect, "{") && got != this.expect || !strings.Contains(got, this.expect) {
+			t.Errorf("[%d] got %s but expected %s", i, got, this.expect)
+		}
+	}
+}
+
+// gqlRun executes query and returns the result as JSON or the error.
+func gqlRun(schema gqlSchema, query, op, vars string) string {
+	doc, err := parseGraphQL(query)
+	if err != nil {
+		return err.Error()
+	}
+	o, err := doc.operation(op)
+	if err != nil {
+		return err.Error()
+	}
+	var vs map[string]interface{}
+	if vars != "" {
+		if err := json.Unmarshal([]byte(vars), &vs); err != nil {
+			return err.Error()
+		}
+	}
+	e := &gqlExec{schema: schema, doc: doc}
+	data, err := e.execute(o, vs)
+	if err != nil {
+		return err.Error()
+	}
+	res := map[string]interface{}{"data": data}
+	if e.errors != nil {
+		res["errors"] = e.errors
+	}
+	b, _ := json.Marshal(res)
+	return string(b)
+}
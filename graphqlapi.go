@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The GraphQL API (/api/v1/graphql) queries pages by section, tag and
+// date with the front matter fields needed and saves or deletes pages.
+// GET without query returns the schema.
+
+const GraphQLPath = "/api/v1/graphql"
+
+const GraphQLSchema = `# JSON is any JSON value.
+scalar JSON
+
+type Query {
+  page(path: String!): Page
+  # pages below section with tag, dated from/to (dates or RFC 3339), matching
+  # the front matter filter expression and containing the text q
+  pages(section: String, tag: String, from: String, to: String, filter: String, q: String, drafts: Boolean, offset: Int, limit: Int): [Page!]!
+  tags(drafts: Boolean): [Tag!]!
+}
+
+type Mutation {
+  # merges frontMatter into the page; without base the page is overwritten
+  savePage(path: String!, base: String, frontMatter: JSON, body: String, summary: String): EditResult!
+  deletePage(path: String!): Boolean!
+}
+
+type Page {
+  path: String!
+  id: String
+  title: String!
+  date: String
+  draft: Boolean!
+  tags: [String!]!
+  revision: String!
+  section: String!
+  url: String!
+  # all front matter with lower case keys
+  frontMatter: JSON!
+  field(name: String!): JSON
+  body: String!
+  backlinks(drafts: Boolean): [Page!]!
+}
+
+type Tag {
+  tag: String!
+  count: Int!
+}
+
+type EditResult {
+  path: String!
+  # "applied", "conflict", "review" or "error"
+  status: String!
+  revision: String
+  error: String
+}
+`
+
+func gqlRequest(e *gqlExec) *http.Request {
+	return e.ctx.(*http.Request)
+}
+
+func gqlString(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+func gqlBool(args map[string]interface{}, name string) bool {
+	b, _ := args[name].(bool)
+	return b
+}
+
+func gqlInt(args map[string]interface{}, name string, def int) int {
+	if i, ok := args[name].(int); ok && i >= 0 {
+		return i
+	}
+	if f, ok := args[name].(float64); ok && f >= 0 { // from JSON variables
+		return int(f)
+	}
+	return def
+}
+
+// gqlInfo returns the page info for the client of r or nil.
+func gqlInfo(r *http.Request, info *PageInfo) *PageInfo {
+	if info == nil || !mayView(r, info.Path) {
+		return nil
+	}
+	if !isEditor(r) {
+		return redactInfo(info)
+	}
+	return info
+}
+
+// gqlPages resolves the pages query.
+func gqlPages(e *gqlExec, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	r := gqlRequest(e)
+	from, err := parseTime(gqlString(args, "from"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'from' time: %s", err)
+	}
+	to, err := parseTime(gqlString(args, "to"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'to' time: %s", err)
+	}
+	infos, err := filterPages(gqlString(args, "filter"), gqlString(args, "q"), gqlBool(args, "drafts"), !isEditor(r))
+	if err != nil {
+		return nil, err
+	}
+	section, tag := strings.Trim(gqlString(args, "section"), "/"), gqlString(args, "tag")
+	pages := []*PageInfo{}
+	for _, info := range infos {
+		if !inSection(info.Path, section) || tag != "" && !contains(info.Tags, tag) || !mayView(r, info.Path) {
+			continue
+		}
+		if !from.IsZero() || !to.IsZero() {
+			d, err := parseTime(info.Date)
+			if err != nil || d.IsZero() || !from.IsZero() && d.Before(from) || !to.IsZero() && d.After(to) {
+				continue
+			}
+		}
+		pages = append(pages, info)
+	}
+	pg := paginate(&http.Request{Form: map[string][]string{
+		"offset": {fmt.Sprint(gqlInt(args, "offset", 0))},
+		"limit":  {fmt.Sprint(gqlInt(args, "limit", PagesDefaultLimit))},
+	}}, len(pages), PagesDefaultLimit, PagesMaxLimit)
+	start, end := pg.Bounds()
+	return pages[start:end], nil
+}
+
+// gqlTags counts the tags of the pages the client may view.
+func gqlTags(e *gqlExec, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	r := gqlRequest(e)
+	counts := make(map[string]int)
+	for _, info := range index.Pages(gqlBool(args, "drafts")) {
+		if mayView(r, info.Path) {
+			for _, t := range info.Tags {
+				counts[t]++
+			}
+		}
+	}
+	tcs := []TagCount{}
+	for t, n := range counts {
+		tcs = append(tcs, TagCount{Tag: t, Count: n})
+	}
+	sort.Slice(tcs, func(i, j int) bool { return tcs[i].Tag < tcs[j].Tag })
+	return tcs, nil
+}
+
+// gqlMutation checks whether the client of e may change pages.
+func gqlMutation(e *gqlExec) error {
+	r := gqlRequest(e)
+	switch t := requestToken(r); {
+	case r.Method != http.MethodPost:
+		return fmt.Errorf("mutations need POST")
+	case *readOnly:
+		return fmt.Errorf("the wiki is read-only")
+	case t != nil && t.Scope != WriteScope:
+		return fmt.Errorf("read-only API token")
+	}
+	return nil
+}
+
+func gqlSavePage(e *gqlExec, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	if err := gqlMutation(e); err != nil {
+		return nil, err
+	}
+	r := gqlRequest(e)
+	edit := QueuedEdit{Path: gqlString(args, "path"), Summary: gqlString(args, "summary")}
+	if base, ok := args["base"].(string); ok {
+		edit.Base = base
+	} else if info, ok := index.Get(edit.Path); ok {
+		edit.Base = info.Revision
+	}
+	if fm, ok := args["frontMatter"]; ok && fm != nil {
+		if edit.FrontMatter, ok = fm.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("frontMatter must be an object")
+		}
+	}
+	if body, ok := args["body"].(string); ok {
+		edit.Body = &body
+	}
+	res := applyEdits(r, []QueuedEdit{edit})[0]
+	if res.Status != "applied" {
+		logger(r.Context()).Info("GraphQL edit not applied", "path", res.Path, "status", res.Status, "err", res.Error)
+	}
+	return res, nil
+}
+
+func gqlDeletePage(e *gqlExec, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	if err := gqlMutation(e); err != nil {
+		return nil, err
+	}
+	r := gqlRequest(e)
+	path := gqlString(args, "path")
+	if !isValidPath(path) {
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidPath, path)
+	}
+	if !tokenAllows(r, path) || !acls.Allowed(currentUser(r), path, true) {
+		return nil, fmt.Errorf("not allowed to delete '%s'", path)
+	}
+	if err := deletePage(r, path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return nil, err
+	}
+	return true, nil
+}
+
+// pageField returns a resolver of a field of a page.
+func pageField(fn func(r *http.Request, info *PageInfo, args map[string]interface{}) (interface{}, error)) func(*gqlExec, interface{}, map[string]interface{}) (interface{}, error) {
+	return func(e *gqlExec, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		return fn(gqlRequest(e), parent.(*PageInfo), args)
+	}
+}
+
+func gqlBody(r *http.Request, info *PageInfo, _ map[string]interface{}) (interface{}, error) {
+	p, err := loadPage(r.Context(), info.Path)
+	if err != nil {
+		return nil, err
+	}
+	return string(p.For(r).Body), nil
+}
+
+func gqlBacklinks(r *http.Request, info *PageInfo, args map[string]interface{}) (interface{}, error) {
+	pages := []*PageInfo{}
+	for _, b := range index.Backlinks(info.Path, gqlBool(args, "drafts")) {
+		if b = gqlInfo(r, b); b != nil {
+			pages = append(pages, b)
+		}
+	}
+	return pages, nil
+}
+
+var graphQLSchema = gqlSchema{
+	"Query": {
+		"page": {"Page", func(e *gqlExec, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			info, _ := index.Get(strings.Trim(gqlString(args, "path"), "/"))
+			return gqlInfo(gqlRequest(e), info), nil
+		}},
+		"pages": {"[Page]", gqlPages},
+		"tags":  {"[Tag]", gqlTags},
+	},
+	"Mutation": {
+		"savePage":   {"EditResult", gqlSavePage},
+		"deletePage": {"Boolean", gqlDeletePage},
+	},
+	"Page": {
+		"path":  {"String", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) { return i.Path, nil })},
+		"title": {"String", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) { return i.Title, nil })},
+		"draft": {"Boolean", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) { return i.Draft, nil })},
+		"id": {"String", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) {
+			if i.ID == "" {
+				return nil, nil
+			}
+			return i.ID, nil
+		})},
+		"date": {"String", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) {
+			if i.Date == "" {
+				return nil, nil
+			}
+			return i.Date, nil
+		})},
+		"tags": {"[String]", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) {
+			if i.Tags == nil {
+				return []string{}, nil
+			}
+			return i.Tags, nil
+		})},
+		"revision": {"String", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) {
+			return i.Revision, nil
+		})},
+		"section": {"String", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) {
+			return attachmentDir(i.Path), nil
+		})},
+		"url": {"String", pageField(func(r *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) {
+			return baseURL(r) + "/view/" + i.Path, nil
+		})},
+		"frontMatter": {"JSON", pageField(func(_ *http.Request, i *PageInfo, _ map[string]interface{}) (interface{}, error) {
+			return i.Params, nil
+		})},
+		"field": {"JSON", pageField(func(_ *http.Request, i *PageInfo, args map[string]interface{}) (interface{}, error) {
+			return i.Params[strings.ToLower(gqlString(args, "name"))], nil
+		})},
+		"body":      {"String", pageField(gqlBody)},
+		"backlinks": {"[Page]", pageField(gqlBacklinks)},
+	},
+	"Tag": {
+		"tag": {"String", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return p.(TagCount).Tag, nil
+		}},
+		"count": {"Int", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return p.(TagCount).Count, nil
+		}},
+	},
+	"EditResult": {
+		"path": {"String", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return p.(EditResult).Path, nil
+		}},
+		"status": {"String", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return p.(EditResult).Status, nil
+		}},
+		"revision": {"String", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return nilIfEmpty(p.(EditResult).Revision), nil
+		}},
+		"error": {"String", func(_ *gqlExec, p interface{}, _ map[string]interface{}) (interface{}, error) {
+			return nilIfEmpty(p.(EditResult).Error), nil
+		}},
+	},
+}
+
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// graphQLRequest is the body of a GraphQL POST request.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLHandler executes GraphQL queries (GET ?query= or POST) and
+// serves the schema (GET without query).
+func graphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		if req.Query = r.FormValue("query"); req.Query == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, GraphQLSchema)
+			return
+		}
+		req.OperationName = r.FormValue("operationName")
+		if vs := r.FormValue("variables"); vs != "" {
+			if err := json.Unmarshal([]byte(vs), &req.Variables); err != nil {
+				graphQLError(w, fmt.Errorf("invalid variables: %s", err))
+				return
+			}
+		}
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, *maxPageSize+1<<20)
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/graphql" {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				graphQLError(w, err)
+				return
+			}
+			req.Query = string(b)
+		} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			graphQLError(w, err)
+			return
+		}
+	default:
+		http.Error(w, "GET or POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		graphQLError(w, err)
+		return
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		graphQLError(w, err)
+		return
+	}
+	e := &gqlExec{schema: graphQLSchema, doc: doc, ctx: r}
+	data, err := e.execute(op, req.Variables)
+	if err != nil {
+		graphQLError(w, err)
+		return
+	}
+	res := map[string]interface{}{"data": data}
+	if e.errors != nil {
+		res["errors"] = e.errors
+	}
+	writeJSON(w, res)
+}
+
+// graphQLError answers requests that couldn't be executed.
+func graphQLError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	writeJSON(w, map[string]interface{}{"errors": []gqlError{{Message: err.Error()}}})
+}
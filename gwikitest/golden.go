@@ -0,0 +1,83 @@
+package gwikitest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// Update makes AssertGolden write the golden files instead of comparing
+// with them. It is set by the environment variable GWIKITEST_UPDATE=1.
+var Update = os.Getenv("GWIKITEST_UPDATE") == "1"
+
+// GoldenDir contains the golden files.
+var GoldenDir = "testdata"
+
+// AssertGolden compares got with the file <GoldenDir>/<name>.golden.
+func AssertGolden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	fn := filepath.Join(GoldenDir, name+".golden")
+	if Update {
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expect, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("unable to read golden file (run with GWIKITEST_UPDATE=1 to create it): %s", err)
+	}
+	if !bytes.Equal(got, expect) {
+		t.Errorf("%s: got\n%s\nbut expected\n%s", fn, got, expect)
+	}
+}
+
+// RoundTrip parses a page file and writes it again the way gwiki saves
+// pages (without normalizing the body).
+func RoundTrip(src []byte) ([]byte, error) {
+	pg, err := parser.ReadFrom(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	md, err := pg.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing frontmatter: %s", err)
+	}
+	mark := rune('+')
+	if fm := pg.FrontMatter(); len(fm) > 0 {
+		mark = rune(fm[0])
+	}
+	if md == nil {
+		md = map[string]interface{}{}
+	}
+	fm, err := parser.InterfaceToFrontMatter(md, mark)
+	if err != nil {
+		return nil, err
+	}
+	return append(fm, pg.Content()...), nil
+}
+
+// AssertRoundTrip compares the round-trip of src with a golden file.
+func AssertRoundTrip(t testing.TB, name string, src []byte) {
+	t.Helper()
+	got, err := RoundTrip(src)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	AssertGolden(t, name, got)
+}
+
+// AssertRendered compares the rendered content of a page with a golden
+// file.
+func (s *Server) AssertRendered(t testing.TB, name, path string) {
+	t.Helper()
+	AssertGolden(t, name, []byte(s.Rendered(t, path)))
+}
@@ -0,0 +1,266 @@
+// Package gwikitest runs a gwiki server against a temporary content tree
+// and compares parser round-trips and rendered pages with golden files.
+//
+// The gwiki binary is built once per test run from the
+// github.com/flowdev/gwiki package (or taken from $GWIKI_BINARY); its
+// templates and static files are copied from the package source.
+package gwikitest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const Package = "github.com/flowdev/gwiki"
+
+// Options configure a test server. All fields are optional.
+type Options struct {
+	Binary string   // gwiki binary (default: $GWIKI_BINARY or built from Package)
+	Source string   // directory with tmpl/ and static/ (default: source of Package)
+	Args   []string // additional command line flags
+}
+
+// Server is a running gwiki with its own working directory.
+type Server struct {
+	URL string // e.g. http://127.0.0.1:43215
+	Dir string // working directory; the pages are in Dir/content/
+
+	cmd *exec.Cmd
+	log logBuffer
+}
+
+// logBuffer collects the output of gwiki while it is running.
+type logBuffer struct {
+	mutex sync.Mutex
+	b     strings.Builder
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.b.Write(p)
+}
+
+func (l *logBuffer) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.b.String()
+}
+
+// NewServer starts gwiki with the given pages (path without suffix ->
+// file content) and stops it when the test is finished.
+func NewServer(t testing.TB, pages map[string]string, opts *Options) *Server {
+	t.Helper()
+	if opts == nil {
+		opts = &Options{}
+	}
+	bin, src, err := locate(opts)
+	if err != nil {
+		t.Fatalf("unable to find gwiki: %s", err)
+	}
+	s := &Server{Dir: t.TempDir()}
+	for _, d := range []string{"tmpl", "static"} {
+		if err = copyDir(filepath.Join(src, d), filepath.Join(s.Dir, d)); err != nil {
+			t.Fatalf("unable to copy %s: %s", d, err)
+		}
+	}
+	for path, content := range pages {
+		s.WritePage(t, path, content)
+	}
+	addr, err := freeAddr()
+	if err != nil {
+		t.Fatalf("unable to find a free port: %s", err)
+	}
+	s.URL = "http://" + addr
+	args := append([]string{"-addr", addr, "-snapshot-interval", "0"}, opts.Args...)
+	s.cmd = exec.Command(bin, args...)
+	s.cmd.Dir = s.Dir
+	s.cmd.Stdout, s.cmd.Stderr = &s.log, &s.log
+	if err = s.cmd.Start(); err != nil {
+		t.Fatalf("unable to start gwiki: %s", err)
+	}
+	t.Cleanup(s.stop)
+	if err = s.wait(10 * time.Second); err != nil {
+		t.Fatalf("gwiki didn't start: %s\n%s", err, s.log.String())
+	}
+	return s
+}
+
+func (s *Server) stop() {
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+}
+
+func (s *Server) wait(timeout time.Duration) error {
+	var err error
+	for end := time.Now().Add(timeout); time.Now().Before(end); time.Sleep(50 * time.Millisecond) {
+		var resp *http.Response
+		if resp, err = http.Get(s.URL + "/list/"); err == nil {
+			resp.Body.Close()
+			return nil
+		}
+	}
+	return err
+}
+
+// Log returns everything gwiki logged so far.
+func (s *Server) Log() string {
+	return s.log.String()
+}
+
+// WritePage writes a page file directly (pages written after the start
+// aren't in gwiki's index).
+func (s *Server) WritePage(t testing.TB, path, content string) {
+	t.Helper()
+	fn := filepath.Join(s.Dir, "content", filepath.FromSlash(path)+".md")
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ReadPage returns the content of a page file.
+func (s *Server) ReadPage(t testing.TB, path string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(s.Dir, "content", filepath.FromSlash(path)+".md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// Get returns the body of a GET request and fails the test unless the
+// status is 200.
+func (s *Server) Get(t testing.TB, urlPath string) string {
+	t.Helper()
+	resp, err := http.Get(s.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s\n%s", urlPath, resp.Status, b)
+	}
+	return string(b)
+}
+
+// Rendered returns the rendered content of a page without the
+// surrounding layout.
+func (s *Server) Rendered(t testing.TB, path string) string {
+	t.Helper()
+	body := s.Get(t, "/view/"+path)
+	const start = `<div class="content">`
+	i := strings.Index(body, start)
+	if i < 0 {
+		t.Fatalf("no content in view of page '%s'", path)
+	}
+	body = body[i+len(start):]
+	depth := 1
+	for j := 0; j < len(body); j++ {
+		switch {
+		case strings.HasPrefix(body[j:], "<div"):
+			depth++
+		case strings.HasPrefix(body[j:], "</div>"):
+			if depth--; depth == 0 {
+				return body[:j]
+			}
+		}
+	}
+	t.Fatalf("unterminated content in view of page '%s'", path)
+	return ""
+}
+
+var (
+	srcOnce, binOnce sync.Once
+	srcDir, binFile  string
+	srcErr, binErr   error
+)
+
+func locate(opts *Options) (bin, src string, err error) {
+	bin, src = opts.Binary, opts.Source
+	if bin == "" {
+		bin = os.Getenv("GWIKI_BINARY")
+	}
+	if src == "" {
+		srcOnce.Do(func() {
+			out, err := exec.Command("go", "list", "-f", "{{.Dir}}", Package).Output()
+			if err != nil {
+				srcErr = fmt.Errorf("unable to find package %s: %s", Package, err)
+			}
+			srcDir = strings.TrimSpace(string(out))
+		})
+		if src, err = srcDir, srcErr; err != nil {
+			return "", "", err
+		}
+	}
+	if bin == "" {
+		binOnce.Do(func() {
+			dir, err := ioutil.TempDir("", "gwikitest-")
+			if err != nil {
+				binErr = err
+				return
+			}
+			binFile = filepath.Join(dir, "gwiki")
+			if out, err := exec.Command("go", "build", "-o", binFile, Package).CombinedOutput(); err != nil {
+				binErr = fmt.Errorf("unable to build %s: %s\n%s", Package, err, out)
+			}
+		})
+		bin, err = binFile, binErr
+	}
+	return bin, src, err
+}
+
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+func copyDir(from, to string) error {
+	return filepath.Walk(from, func(fn string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, fn)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		in, err := os.Open(fn)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -0,0 +1,34 @@
+package gwikitest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, this := range []struct {
+		name string
+		src  string
+	}{
+		{"roundtrip-toml", "+++\ntitle = \"TOML\"\ntags = [\"a\", \"b\"]\n+++\n\nSome *text*.\n"},
+		{"roundtrip-yaml", "---\ntitle: YAML\ndraft: true\n---\nSome *text*.\n"},
+		{"roundtrip-json", "{\n  \"title\": \"JSON\"\n}\n\nSome *text*.\n"},
+	} {
+		AssertRoundTrip(t, this.name, []byte(this.src))
+	}
+}
+
+func TestServer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs gwiki")
+	}
+	s := NewServer(t, map[string]string{
+		"home":       "+++\ntitle = \"Home\"\n+++\n\nSee [[docs/intro]].\n\n| a | b |\n|---|---|\n| 1 | 2 |\n",
+		"docs/intro": "+++\ntitle = \"Intro\"\n+++\n\n<div>raw</div>\n\nBack [home](home).\n",
+	}, nil)
+	s.AssertRendered(t, "rendered-home", "home")
+	s.AssertRendered(t, "rendered-intro", "docs/intro")
+	if body := s.Get(t, "/view/docs/intro"); !strings.Contains(body, "Pages that link here") {
+		t.Errorf("got no backlinks in\n%s", body)
+	}
+}
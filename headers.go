@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+)
+
+// Security headers are set on all responses; an empty flag leaves its
+// header out. The default policy allows what the bundled templates need:
+// scripts and style sheets of the wiki, inline styles, images from
+// anywhere (pages often embed them), frames of the wiki itself (the mail
+// preview) and the hosts of the youtube, vimeo and gist shortcodes. The Hugo preview gets no policy since the site may use
+// anything.
+var (
+	contentSecurityPolicy = flag.String("csp", DefaultCSP, "Content-Security-Policy header")
+	frameOptions          = flag.String("frame-options", "SAMEORIGIN", "X-Frame-Options header")
+	referrerPolicy        = flag.String("referrer-policy", "same-origin", "Referrer-Policy header (share links must not leak to other sites)")
+	noSniff               = flag.Bool("nosniff", true, "set 'X-Content-Type-Options: nosniff'")
+)
+
+const DefaultCSP = "default-src 'self'; script-src 'self' https://gist.github.com; style-src 'self' 'unsafe-inline' https://github.githubassets.com; img-src 'self' data: https:; frame-src 'self' https://www.youtube.com https://player.vimeo.com; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'self'"
+
+// securityHeadersHandler sets the security headers before h, which may
+// change them.
+func securityHeadersHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hd := w.Header()
+		for _, f := range []struct{ name, value string }{
+			{"Content-Security-Policy", *contentSecurityPolicy},
+			{"X-Frame-Options", *frameOptions},
+			{"Referrer-Policy", *referrerPolicy},
+		} {
+			if f.value != "" && !(f.name == "Content-Security-Policy" && strings.HasPrefix(r.URL.Path, PreviewPrefix)) {
+				hd.Set(f.name, f.value)
+			}
+		}
+		if *noSniff {
+			hd.Set("X-Content-Type-Options", "nosniff")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	defer func(fo string) { *frameOptions = fo }(*frameOptions)
+	*frameOptions = ""
+	h := securityHeadersHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin/mails" {
+			w.Header().Set("Referrer-Policy", "no-referrer")
+		}
+	}))
+	for i, this := range []struct {
+		url, header, expect string
+	}{
+		{"/view/index", "Content-Security-Policy", DefaultCSP},
+		{"/view/index", "X-Content-Type-Options", "nosniff"},
+		{"/view/index", "Referrer-Policy", "same-origin"},
+		{"/view/index", "X-Frame-Options", ""},
+		{"/admin/mails", "Referrer-Policy", "no-referrer"},
+		{"/preview/docs/", "Content-Security-Policy", ""},
+		{"/preview/docs/", "X-Content-Type-Options", "nosniff"},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", this.url, nil))
+		if got := w.Header().Get(this.header); got != this.expect {
+			t.Errorf("[%d] got %s %q but expected %q", i, this.header, got, this.expect)
+		}
+	}
+	// the embeds of the shortcodes must not be blocked
+	for _, src := range []string{"frame-src 'self' https://www.youtube.com https://player.vimeo.com", "script-src 'self' https://gist.github.com"} {
+		if !strings.Contains(DefaultCSP, src) {
+			t.Errorf("expected the default policy to contain %q", src)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// /healthz answers as long as the process serves requests; /readyz only
+// if gwiki can serve pages, so load balancers and Kubernetes can route
+// around an instance that is starting, broken or shutting down. Both are
+// exempt from authentication. readinessChecks are the checks of /readyz.
+var readinessChecks = []struct {
+	name  string
+	check func() error
+}{
+	{"content", checkContent},
+	{"templates", checkTemplates},
+	{"index", checkIndex},
+	{"shutdown", checkShutdown},
+}
+
+func checkContent() error {
+	if p, ok := store.(pinger); ok {
+		return p.Ping()
+	}
+	_, err := store.List()
+	return err
+}
+
+func checkTemplates() error {
+	t := currentTemplates()
+	for _, n := range templateNames {
+		if t == nil || t.Lookup(n) == nil {
+			return fmt.Errorf("template '%s' isn't parsed", n)
+		}
+	}
+	return nil
+}
+
+func checkIndex() error {
+	if !index.Built() {
+		return fmt.Errorf("page index isn't built")
+	}
+	return nil
+}
+
+func checkShutdown() error {
+	select {
+	case <-stopping:
+		return fmt.Errorf("shutting down")
+	default:
+		return nil
+	}
+}
+
+// healthzHandler reports that the process is alive (/healthz).
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler runs the readiness checks (/readyz) and answers 503 if one
+// fails. The result of every check is listed in the body.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	body := ""
+	for _, c := range readinessChecks {
+		if err := c.check(); err != nil {
+			status = http.StatusServiceUnavailable
+			body += fmt.Sprintf("%s: %s\n", c.name, err)
+		} else {
+			body += c.name + ": ok\n"
+		}
+	}
+	if status != http.StatusOK {
+		logger(r.Context()).Warn("Not ready", "checks", body)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	defer func(s Storage, pi *pageIndex) { store, index = s, pi }(store, index)
+	store = &fsStorage{fsys: newDirFS(t.TempDir(), false)}
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	ready := func() (int, string) {
+		w := httptest.NewRecorder()
+		readyzHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code, w.Body.String()
+	}
+	if code, body := ready(); code != http.StatusServiceUnavailable || !strings.Contains(body, "index: page index isn't built") {
+		t.Errorf("got %d %q before the index is built", code, body)
+	}
+	if err := index.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := ready(); code != http.StatusOK || body != "content: ok\ntemplates: ok\nindex: ok\nshutdown: ok\n" {
+		t.Errorf("got %d %q", code, body)
+	}
+	store = &fsStorage{fsys: newDirFS("./does-not-exist", false)}
+	if code, body := ready(); code != http.StatusServiceUnavailable || !strings.Contains(body, "content: open ./does-not-exist") {
+		t.Errorf("got %d %q with a missing content dir", code, body)
+	}
+	if !isAuthExempt("/healthz") || !isAuthExempt("/readyz") || isAuthExempt("/readyz/x") {
+		t.Errorf("expected the probes and only them to be exempt from authentication")
+	}
+}
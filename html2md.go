@@ -0,0 +1,335 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML of imports and clipped web pages is converted to Markdown. Elements
+// without a Markdown equivalent keep only their text; scripts, styles and
+// forms are dropped.
+
+// htmlConverter converts HTML to Markdown.
+type htmlConverter struct {
+	// link returns the target for the href of a link or src of an image,
+	// "" to drop it.
+	link func(href string, image bool) string
+	pre  int // depth of pre elements
+}
+
+var (
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+	markdownChars = strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+	spaces        = regexp.MustCompile(`\s+`)
+)
+
+// droppedFormElements are removed with their content in addition to
+// droppedElements.
+var droppedFormElements = map[string]bool{"head": true, "form": true, "button": true, "input": true, "select": true, "canvas": true}
+
+// blockElements are separated from their siblings by a blank line.
+var blockElements = setOf("p div section article header footer main aside nav figure figcaption details summary address center")
+
+// htmlToMarkdown returns the Markdown of the HTML node n with link targets
+// translated by link (if not nil).
+func htmlToMarkdown(n *html.Node, link func(href string, image bool) string) string {
+	c := &htmlConverter{link: link}
+	if c.link == nil {
+		c.link = func(href string, image bool) string { return href }
+	}
+	md := c.node(n)
+	lines := strings.Split(md, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	md = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	if md = strings.Trim(md, "\n"); md == "" {
+		return ""
+	}
+	return md + "\n"
+}
+
+func (c *htmlConverter) children(n *html.Node) string {
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(c.node(ch))
+	}
+	return sb.String()
+}
+
+func (c *htmlConverter) node(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		if c.pre > 0 {
+			return n.Data
+		}
+		return markdownChars.Replace(spaces.ReplaceAllString(n.Data, " "))
+	case html.ElementNode:
+	case html.DocumentNode:
+		return c.children(n)
+	default:
+		return ""
+	}
+	if droppedElements[n.Data] || droppedFormElements[n.Data] {
+		return ""
+	}
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+		if s := oneLine(c.children(n)); s != "" {
+			return "\n\n" + strings.Repeat("#", level) + " " + s + "\n\n"
+		}
+		return ""
+	case "br":
+		if c.pre > 0 {
+			return "\n"
+		}
+		return "\\\n"
+	case "hr":
+		return "\n\n---\n\n"
+	case "strong", "b":
+		return emphasis("**", c.children(n))
+	case "em", "i", "cite":
+		return emphasis("*", c.children(n))
+	case "del", "s", "strike":
+		return emphasis("~~", c.children(n))
+	case "code", "kbd", "samp", "tt":
+		if c.pre > 0 {
+			return c.children(n)
+		}
+		return codeSpan(textContent(n))
+	case "pre":
+		return c.preformatted(n)
+	case "a":
+		label := strings.TrimSpace(c.children(n))
+		href := attr(n, "href")
+		if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return label
+		}
+		if href = c.link(href, false); href == "" || label == "" {
+			return label
+		}
+		return "[" + label + "](" + markdownURL(href) + ")"
+	case "img":
+		src := attr(n, "src")
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return ""
+		}
+		if src = c.link(src, true); src == "" {
+			return ""
+		}
+		return "![" + markdownChars.Replace(oneLine(attr(n, "alt"))) + "](" + markdownURL(src) + ")"
+	case "ul", "ol":
+		return c.list(n)
+	case "blockquote":
+		s := strings.Trim(blankLines.ReplaceAllString(c.children(n), "\n\n"), " \n")
+		if s == "" {
+			return ""
+		}
+		return "\n\n" + prefixLines(s, "> ", "> ") + "\n\n"
+	case "table":
+		return c.table(n)
+	case "dt":
+		return "\n\n" + oneLine(c.children(n)) + "\n"
+	case "dd":
+		return ": " + oneLine(c.children(n)) + "\n"
+	case "dl":
+		return "\n\n" + c.children(n) + "\n\n"
+	}
+	if blockElements[n.Data] {
+		return "\n\n" + strings.TrimSpace(c.children(n)) + "\n\n"
+	}
+	return c.children(n)
+}
+
+// preformatted returns the fenced code block of the pre element n with the
+// language of a "language-*" class.
+func (c *htmlConverter) preformatted(n *html.Node) string {
+	lang := ""
+	for _, e := range []*html.Node{n, n.FirstChild} {
+		if e == nil || e.Type != html.ElementNode {
+			continue
+		}
+		for _, cl := range strings.Fields(attr(e, "class")) {
+			if l, ok := strings.CutPrefix(cl, "language-"); ok && lang == "" {
+				lang = l
+			}
+		}
+	}
+	c.pre++
+	code := strings.Trim(c.children(n), "\n")
+	c.pre--
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return "\n\n" + fence + lang + "\n" + code + "\n" + fence + "\n\n"
+}
+
+// list returns the items of the ul or ol element n with nested blocks
+// indented below their marker.
+func (c *htmlConverter) list(n *html.Node) string {
+	var items []string
+	num, _ := strconv.Atoi(attr(n, "start"))
+	if num == 0 {
+		num = 1
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = strconv.Itoa(num) + ". "
+			num++
+		}
+		s := strings.Trim(blankLines.ReplaceAllString(c.children(li), "\n\n"), " \n")
+		if cb := li.FirstChild; cb != nil && cb.Type == html.ElementNode && cb.Data == "input" && attr(cb, "type") == "checkbox" {
+			if hasAttr(cb, "checked") {
+				s = "[x] " + s
+			} else {
+				s = "[ ] " + s
+			}
+		}
+		items = append(items, prefixLines(s, marker, strings.Repeat(" ", len(marker))))
+	}
+	if items == nil {
+		return ""
+	}
+	return "\n\n" + strings.Join(items, "\n") + "\n\n"
+}
+
+// table returns the GFM table of the table element n with the first row
+// as header.
+func (c *htmlConverter) table(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(e *html.Node) {
+		for ch := e.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.Type != html.ElementNode {
+				continue
+			}
+			switch ch.Data {
+			case "thead", "tbody", "tfoot":
+				walk(ch)
+			case "tr":
+				var row []string
+				for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						row = append(row, strings.ReplaceAll(oneLine(c.children(cell)), "|", `\|`))
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	walk(n)
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	if cols == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n")
+	for i, r := range rows {
+		for len(r) < cols {
+			r = append(r, "")
+		}
+		sb.WriteString("| " + strings.Join(r, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString(strings.Repeat("| --- ", cols) + "|\n")
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// textContent returns the text of n and its children.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	if n.Type == html.ElementNode && n.Data == "br" {
+		return "\n"
+	}
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(textContent(ch))
+	}
+	return sb.String()
+}
+
+// emphasis wraps s in the marker m keeping surrounding spaces outside.
+func emphasis(m, s string) string {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return s
+	}
+	i := strings.Index(s, t)
+	return s[:i] + m + t + m + s[i+len(t):]
+}
+
+func codeSpan(s string) string {
+	s = spaces.ReplaceAllString(s, " ")
+	if s == "" {
+		return ""
+	}
+	ticks := "`"
+	for strings.Contains(s, ticks) {
+		ticks += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return ticks + s + ticks
+}
+
+// oneLine returns s with line breaks replaced by spaces.
+func oneLine(s string) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(strings.ReplaceAll(s, "\\\n", " "), " "))
+}
+
+// markdownURL returns u usable as link destination.
+func markdownURL(u string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(u)
+}
+
+// prefixLines prefixes the first line of s with first and the others with
+// rest (blank lines stay blank except in quotes).
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		p := rest
+		if i == 0 {
+			p = first
+		}
+		if l == "" && strings.TrimSpace(p) == "" {
+			continue
+		}
+		lines[i] = strings.TrimRight(p+l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
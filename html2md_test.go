@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	for i, this := range []struct {
+		html   string
+		expect string
+	}{
+		{"<h2>Intro</h2><p>Some <b>bold</b>, <em>italic </em>and <code>a*b</code>.</p>", "## Intro\n\nSome **bold**, *italic* and `a*b`.\n"},
+		{"<p>a [b] *c*<br>d</p><script>alert(1)</script>", "a \\[b\\] \\*c\\*\\\nd\n"},
+		{`<p><a href="/x y">link</a> <a href="javascript:void(0)">js</a> <img src="i.png" alt="An image"></p>`, "[link](/x%20y) js ![An image](i.png)\n"},
+		{"<ul><li>a<ul><li>b</li></ul></li><li>c</li></ul><ol start=\"3\"><li>x</li><li><p>y</p><p>z</p></li></ol>",
+			"- a\n\n  - b\n- c\n\n3. x\n4. y\n\n   z\n"},
+		{"<ul><li><input type=\"checkbox\" checked> done</li><li><input type=\"checkbox\"> todo</li></ul>", "- [x] done\n- [ ] todo\n"},
+		{"<pre><code class=\"language-go\">func f() {\n\treturn\n}</code></pre>", "```go\nfunc f() {\n\treturn\n}\n```\n"},
+		{"<blockquote><p>one</p><p>two</p></blockquote><hr>", "> one\n>\n> two\n\n---\n"},
+		{"<table><thead><tr><th>A</th><th>B</th></tr></thead><tbody><tr><td>1|2</td></tr></tbody></table>", "| A | B |\n| --- | --- |\n| 1\\|2 |  |\n"},
+		{"<dl><dt>Term</dt><dd>Definition</dd></dl>", "Term\n: Definition\n"},
+	} {
+		doc, err := html.Parse(strings.NewReader(this.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := htmlToMarkdown(doc, nil); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+}
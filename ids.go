@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Pages can have a stable ID in the front matter ("id"). /id/<id> redirects
+// to the page wherever it was renamed to, so links and external systems
+// can use IDs instead of paths. With -page-ids pages without an ID get a
+// random UUID when they are saved.
+var pageIDs = flag.Bool("page-ids", false, "give pages without an ID a UUID in the front matter when saving them")
+
+// IDKey is the front matter key of page IDs.
+const IDKey = "id"
+
+var validID = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// NewID returns a new page ID. It can be replaced to use another scheme.
+var NewID = newUUID
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		fatal("Unable to read random bytes", "err", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (p *Page) ID() string {
+	return getString(p, IDKey)
+}
+
+// ensureID gives p a new ID if it has none and -page-ids is set.
+func ensureID(p *Page) {
+	if *pageIDs && p.ID() == "" {
+		p.FrontMatter[IDKey] = NewID()
+	}
+}
+
+// CheckID returns an error if the ID of p is invalid or used by another
+// page.
+func (pi *pageIndex) CheckID(p *Page) error {
+	id := p.ID()
+	if id == "" {
+		return nil
+	}
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid ID '%s' of page '%s'", id, p.Path)
+	}
+	if path, ok := pi.ByID(id); ok && path != p.Path {
+		return fmt.Errorf("ID '%s' of page '%s' is already used by page '%s'", id, p.Path, path)
+	}
+	return nil
+}
+
+// ByID returns the path of the page with the ID id.
+func (pi *pageIndex) ByID(id string) (string, bool) {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	path, ok := pi.ids[id]
+	return path, ok
+}
+
+// addID maps the ID of info to its page; the page added last wins.
+func addID(ids map[string]string, info *PageInfo) {
+	if info.ID == "" {
+		return
+	}
+	if path, ok := ids[info.ID]; ok && path != info.Path {
+		slog.Warn("ID is used by more than one page", "id", info.ID, "path", info.Path, "other", path)
+	}
+	ids[info.ID] = info.Path
+}
+
+func removeID(ids map[string]string, info *PageInfo) {
+	if ids[info.ID] == info.Path {
+		delete(ids, info.ID)
+	}
+}
+
+// idHandler redirects /id/<id> to /view/<path> of the page with the ID and
+// /id/<id>/<action> (edit, diff, ...) to /<action>/<path>.
+func idHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/id/")
+	id, action := rest, "view"
+	if i := strings.Index(rest, "/"); i >= 0 {
+		id, action = rest[:i], rest[i+1:]
+	}
+	path, ok := index.ByID(id)
+	if !ok || !validID.MatchString(id) {
+		http.NotFound(w, r)
+		return
+	}
+	target := "/" + action + "/" + path
+	if !validPath.MatchString(target) {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewUUID(t *testing.T) {
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := newUUID(), newUUID()
+	if !re.MatchString(a) {
+		t.Errorf("got %q but expected a version 4 UUID", a)
+	}
+	if a == b {
+		t.Errorf("got the same UUID %q twice", a)
+	}
+}
+
+func TestPageIDs(t *testing.T) {
+	pi := &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	page := func(path, id string) *Page {
+		p := NewPage(path)
+		if id != "" {
+			p.FrontMatter[IDKey] = id
+		}
+		return p
+	}
+	pi.Update(page("a", "1234"))
+	pi.Update(page("b", ""))
+
+	for i, this := range []struct {
+		page *Page
+		ok   bool
+	}{
+		{page("a", "1234"), true},
+		{page("c", "1234"), false},
+		{page("c", "5678"), true},
+		{page("c", "no/slash"), false},
+		{page("c", ""), true},
+	} {
+		if err := pi.CheckID(this.page); (err == nil) != this.ok {
+			t.Errorf("[%d] got error %v but expected ok=%t", i, err, this.ok)
+		}
+	}
+
+	// a rename keeps the ID
+	pi.Update(page("renamed", "1234"))
+	pi.Remove("a")
+	if path, ok := pi.ByID("1234"); !ok || path != "renamed" {
+		t.Errorf("got %q but expected %q", path, "renamed")
+	}
+	pi.Remove("renamed")
+	if _, ok := pi.ByID("1234"); ok {
+		t.Errorf("expected the ID to be removed with its page")
+	}
+}
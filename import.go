@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Exports of other wikis and note apps are converted by importers into
+// pages and attachments (-import <format>:<source>). Whatever couldn't be
+// translated is reported instead of silently dropped.
+var (
+	importFrom      = flag.String("import", "", "import pages and exit: '<format>:<file or directory>' with format 'obsidian' (a vault), 'notion' (an extracted HTML or Markdown export), 'mediawiki' (an XML export), 'dokuwiki' (a data or pages directory) or 'tiddlywiki' (a JSON export of the tiddlers)")
+	importSection   = flag.String("import-section", "", "section imported pages are created in")
+	importOverwrite = flag.Bool("import-overwrite", false, "replace existing pages and files when importing (else they are kept)")
+	importMaxSize   = flag.Int64("import-max-size", 256<<20, "maximum size in bytes of an export uploaded to /admin/import")
+)
+
+// imageExtensions are the extensions of attachments embedded as images.
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".svg": true, ".bmp": true, ".avif": true}
+
+// importMdLink matches Markdown links and images in imported pages.
+var importMdLink = regexp.MustCompile(`(!?)\[([^\]\n]*)\]\((?:<([^>\n]+)>|([^)\s]+))\)`)
+
+// Import is the outcome of an importer: the pages and attachments to store
+// and the problems found while converting them.
+type Import struct {
+	Pages    []*Page
+	Files    []*ImportedFile
+	Problems []string
+}
+
+// ImportedFile is an attachment of the imported pages.
+type ImportedFile struct {
+	Dir, Name string
+	Source    string // file the content is read from
+	Data      []byte // content if there is no Source
+}
+
+func (imp *Import) problem(format string, args ...interface{}) {
+	imp.Problems = append(imp.Problems, fmt.Sprintf(format, args...))
+}
+
+// importer converts the export at src to pages below section.
+type importer struct {
+	fn  func(src, section string) (*Import, error)
+	dir bool // src is a directory (uploaded as zip)
+}
+
+var importers = map[string]importer{
+	"obsidian":   {importObsidian, true},
+	"notion":     {importNotion, true},
+	"mediawiki":  {importMediaWiki, false},
+	"dokuwiki":   {importDokuWiki, true},
+	"tiddlywiki": {importTiddlyWiki, false},
+}
+
+// ImportReport lists what an import stored and what it couldn't.
+type ImportReport struct {
+	Pages    []string `json:"pages"`
+	Reviews  []string `json:"reviews"` // IDs of the review requests of owned pages
+	Skipped  []string `json:"skipped"` // existing pages and files that were kept
+	Files    []string `json:"files"`
+	Problems []string `json:"problems"`
+}
+
+// storeImport stores the files and pages of imp as the user of r. Existing
+// pages and files are only replaced with overwrite.
+func storeImport(r *http.Request, imp *Import, overwrite bool) *ImportReport {
+	rep := &ImportReport{Pages: []string{}, Reviews: []string{}, Skipped: []string{}, Files: []string{}, Problems: append([]string{}, imp.Problems...)}
+	for _, f := range imp.Files {
+		name := path.Join(f.Dir, f.Name)
+		if _, err := attachmentFS(f.Dir).Stat(attachmentFile(f.Dir, f.Name)); err == nil && !overwrite {
+			rep.Skipped = append(rep.Skipped, name)
+			continue
+		}
+		if err := storeImportedFile(f); err != nil {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("unable to store file '%s': %s", name, err))
+			continue
+		}
+		audit(r, "upload", name)
+		rep.Files = append(rep.Files, name)
+	}
+	for _, p := range imp.Pages {
+		old := NewPage(p.Path)
+		if pageExists(p.Path) {
+			if !overwrite {
+				rep.Skipped = append(rep.Skipped, p.Path)
+				continue
+			}
+			var err error
+			if old, err = LoadPage(p.Path); err != nil {
+				rep.Problems = append(rep.Problems, fmt.Sprintf("unable to load page '%s': %s", p.Path, err))
+				continue
+			}
+		}
+		var re *reviewError
+		if err := storeImportedPage(r, p, old); errors.As(err, &re) {
+			rep.Reviews = append(rep.Reviews, re.review.ID)
+			continue
+		} else if err != nil {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("unable to store page '%s': %s", p.Path, err))
+			continue
+		}
+		rep.Pages = append(rep.Pages, p.Path)
+	}
+	return rep
+}
+
+func storeImportedFile(f *ImportedFile) error {
+	if f.Source == "" {
+		return saveAttachment(f.Dir, f.Name, bytes.NewReader(f.Data))
+	}
+	in, err := os.Open(f.Source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return saveAttachment(f.Dir, f.Name, in)
+}
+
+func storeImportedPage(r *http.Request, p, old *Page) error {
+	if int64(len(p.Body)) > *maxPageSize {
+		return fmt.Errorf("page is larger than %d bytes", *maxPageSize)
+	}
+	if err := checkPage(old, p); err != nil {
+		return err
+	}
+	return storePage(r, p, old, "import")
+}
+
+// importFiles places the attachments of a directory export next to the
+// first page using them.
+type importFiles struct {
+	imp    *Import
+	dir    string                   // of the export
+	placed map[string]*ImportedFile // by path in the export
+	taken  map[string]bool          // page paths and attachment paths
+}
+
+func newImportFiles(dir string) *importFiles {
+	return &importFiles{imp: &Import{}, dir: dir, placed: make(map[string]*ImportedFile), taken: make(map[string]bool)}
+}
+
+// place adds the attachment at the path src of the export in the
+// directory dir with a slug as name.
+func (fs *importFiles) place(src, dir string) *ImportedFile {
+	ext := strings.ToLower(path.Ext(src))
+	base := slugify(strings.TrimSuffix(path.Base(src), path.Ext(src)))
+	if base == "" {
+		base = "file"
+	}
+	name := path.Base(uniqueName(fs.taken, path.Join(dir, base+ext)))
+	f := &ImportedFile{Dir: dir, Name: name, Source: filepath.Join(fs.dir, filepath.FromSlash(src))}
+	fs.placed[src] = f
+	fs.imp.Files = append(fs.imp.Files, f)
+	return f
+}
+
+// url returns the URL of the attachment src, placed in dir if it isn't
+// yet.
+func (fs *importFiles) url(src, dir string) string {
+	f := fs.placed[src]
+	if f == nil {
+		f = fs.place(src, dir)
+	}
+	return path.Join("/files", f.Dir, f.Name)
+}
+
+// sortFiles sorts the files of the import by path.
+func (fs *importFiles) sortFiles() {
+	files := fs.imp.Files
+	sort.Slice(files, func(i, j int) bool {
+		return path.Join(files[i].Dir, files[i].Name) < path.Join(files[j].Dir, files[j].Name)
+	})
+}
+
+// pageURL returns the URL of the page at p with the anchor (without "#").
+func pageURL(p, anchor string) string {
+	if anchor != "" {
+		return "/view/" + p + "#" + anchor
+	}
+	return "/view/" + p
+}
+
+// uniqueName returns name or, if taken, name with a number added before
+// the extension and marks it as taken.
+func uniqueName(taken map[string]bool, name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	taken[name] = true
+	return name
+}
+
+func writeImportReport(w io.Writer, rep *ImportReport) {
+	sort.Strings(rep.Skipped)
+	fmt.Fprintf(w, "Imported pages: %d\nImported files: %d\n", len(rep.Pages), len(rep.Files))
+	fmt.Fprintf(w, "Existing pages and files kept (%d):\n", len(rep.Skipped))
+	for _, p := range rep.Skipped {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+	fmt.Fprintf(w, "Problems (%d):\n", len(rep.Problems))
+	for _, p := range rep.Problems {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+}
+
+// runImport runs the import of -import and prints the report.
+func runImport() {
+	format, src, _ := strings.Cut(*importFrom, ":")
+	imp, ok := importers[format]
+	if !ok || src == "" {
+		fatal("Unknown import format or missing source", "import", *importFrom)
+	}
+	section := strings.Trim(*importSection, "/")
+	if section != "" && checkPath(section) != nil {
+		fatal("Invalid import section", "section", section)
+	}
+	res, err := imp.fn(src, section)
+	if err != nil {
+		fatal("Unable to import", "source", src, "err", err)
+	}
+	writeImportReport(os.Stdout, storeImport(localRequest(rpcUser(), "import"), res, *importOverwrite))
+}
+
+// importHandler imports an uploaded export (POST /admin/import with the
+// file, format, section and overwrite=true) and returns the report.
+// Directories like Obsidian vaults are uploaded as zip.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, *importMaxSize)
+	imp, ok := importers[r.FormValue("format")]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown import format '%s'", r.FormValue("format")), http.StatusBadRequest)
+		return
+	}
+	section := strings.Trim(r.FormValue("section"), "/")
+	if section != "" && checkPath(section) != nil {
+		http.Error(w, fmt.Sprintf("invalid section '%s'", section), http.StatusBadRequest)
+		return
+	}
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "the export is missing: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	tmp, err := os.MkdirTemp("", "gwiki-import-")
+	if err != nil {
+		logger(r.Context()).Error("Unable to create import directory", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "export")
+	if imp.dir {
+		err = extractZip(f, src)
+	} else {
+		err = writeFile(src, f)
+	}
+	if err != nil {
+		http.Error(w, "unable to read the export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := imp.fn(src, section)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rep := storeImport(r, res, r.FormValue("overwrite") == "true")
+	logger(r.Context()).Info("Imported pages", "format", r.FormValue("format"), "section", section, "pages", len(rep.Pages), "files", len(rep.Files), "problems", len(rep.Problems))
+	writeJSON(w, rep)
+}
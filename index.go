@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var indexWorkers = flag.Int("index-workers", runtime.NumCPU(), "number of pages loaded in parallel when building the page index")
+
+// IndexProgressInterval is how often the progress of building the page
+// index is logged.
+const IndexProgressInterval = 5 * time.Second
+
+// PageInfo is the metadata of a page kept in the index.
+type PageInfo struct {
+	Path  string   `json:"path"`
+	ID    string   `json:"id,omitempty"`
+	Title string   `json:"title"`
+	Date  string   `json:"date"`
+	Draft bool     `json:"draft"`
+	Tags  []string `json:"tags,omitempty"`
+
+	Revision string `json:"revision"`
+
+	Params map[string]interface{} `json:"params,omitempty"` // all front matter (lower case keys)
+	Links  []string               `json:"links,omitempty"`  // paths of linked pages
+}
+
+// pageIndex holds the metadata of all pages so listings don't have to
+// load every page.
+type pageIndex struct {
+	mutex     sync.RWMutex
+	pages     map[string]*PageInfo
+	backlinks map[string]map[string]bool // linked page -> linking pages
+	ids       map[string]string          // page ID -> page path
+
+	generation int             // incremented on every change
+	built      bool            // Build succeeded at least once
+	graphs     map[bool]*Graph // cached link graphs with and without drafts
+}
+
+var index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+
+func newPageInfo(p *Page) *PageInfo {
+	pi := &PageInfo{Path: p.Path, ID: p.ID(), Title: p.Title(), Draft: isDraft(p), Tags: p.Tags(), Revision: p.Revision, Params: lowerKeys(p.FrontMatter), Links: pageLinks(p)}
+	if t, ok := p.FrontMatter["date"]; ok {
+		pi.Date = formatValue(t)
+	}
+	return pi
+}
+
+// Build (re)builds the index from all pages in ContentDir. Pages are
+// loaded by -index-workers goroutines and the progress is logged for big
+// content trees.
+func (pi *pageIndex) Build() error {
+	ps, err := listPages()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	infos := loadPageInfos(ps, func(done int) {
+		slog.Info("Indexing pages", "done", done, "total", len(ps))
+	})
+	pages := make(map[string]*PageInfo, len(ps))
+	backlinks := make(map[string]map[string]bool)
+	ids := make(map[string]string)
+	for _, info := range infos {
+		if info != nil {
+			pages[info.Path] = info
+			addBacklinks(backlinks, info)
+			addID(ids, info)
+		}
+	}
+	pi.mutex.Lock()
+	pi.pages, pi.backlinks, pi.ids = pages, backlinks, ids
+	pi.built = true
+	pi.changed()
+	pi.mutex.Unlock()
+	slog.Info("Indexed pages", "pages", len(pages), "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// loadPageInfos loads the pages at paths in parallel and returns their
+// metadata in the same order (nil for pages that can't be loaded).
+// progress is called every IndexProgressInterval while loading.
+func loadPageInfos(paths []string, progress func(done int)) []*PageInfo {
+	infos := make([]*PageInfo, len(paths))
+	var done int64
+	next := make(chan int)
+	var wg sync.WaitGroup
+	workers := *indexWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				p, err := LoadPage(paths[i])
+				if err != nil {
+					slog.Warn("Unable to index page", "path", paths[i], "err", err)
+				} else {
+					infos[i] = newPageInfo(p)
+				}
+				atomic.AddInt64(&done, 1)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(IndexProgressInterval)
+	defer ticker.Stop()
+	for i := range paths {
+		select {
+		case next <- i:
+		case <-ticker.C:
+			progress(int(atomic.LoadInt64(&done)))
+			next <- i
+		}
+	}
+	close(next)
+	wg.Wait()
+	return infos
+}
+
+// Update adds or replaces the metadata of p.
+func (pi *pageIndex) Update(p *Page) {
+	info := newPageInfo(p)
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+	if old, ok := pi.pages[p.Path]; ok {
+		removeBacklinks(pi.backlinks, old)
+		removeID(pi.ids, old)
+	}
+	pi.pages[p.Path] = info
+	addBacklinks(pi.backlinks, info)
+	addID(pi.ids, info)
+	pi.changed()
+}
+
+func (pi *pageIndex) Remove(path string) {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+	if old, ok := pi.pages[path]; ok {
+		removeBacklinks(pi.backlinks, old)
+		removeID(pi.ids, old)
+	}
+	delete(pi.pages, path)
+	pi.changed()
+}
+
+// Sizes returns the number of pages, links between them and page IDs.
+func (pi *pageIndex) Sizes() (pages, links, ids int) {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	for _, from := range pi.backlinks {
+		links += len(from)
+	}
+	return len(pi.pages), links, len(pi.ids)
+}
+
+// HasSection reports whether any page (including drafts) is below path.
+func (pi *pageIndex) HasSection(path string) bool {
+	prefix := path + "/"
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	for p := range pi.pages {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// changed invalidates cached data. The caller must hold the write lock.
+func (pi *pageIndex) changed() {
+	pi.generation++
+	pi.graphs = nil
+}
+
+// Get returns the metadata of the page at path.
+func (pi *pageIndex) Get(path string) (*PageInfo, bool) {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	info, ok := pi.pages[path]
+	return info, ok
+}
+
+// Pages returns the metadata of all (non-draft) pages sorted by path.
+func (pi *pageIndex) Pages(drafts bool) []*PageInfo {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	infos := make([]*PageInfo, 0, len(pi.pages))
+	for _, info := range pi.pages {
+		if drafts || !info.Draft {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos
+}
+
+// TagCount is a tag together with the number of pages using it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Tags returns all tags of (non-draft) pages sorted by tag.
+func (pi *pageIndex) Tags(drafts bool) []TagCount {
+	return tagCounts(pi.Pages(drafts))
+}
+
+// tagCounts returns the tags of infos with the number of pages using them,
+// sorted by tag.
+func tagCounts(infos []*PageInfo) []TagCount {
+	counts := make(map[string]int)
+	for _, info := range infos {
+		for _, t := range info.Tags {
+			counts[t]++
+		}
+	}
+	tcs := make([]TagCount, 0, len(counts))
+	for t, c := range counts {
+		tcs = append(tcs, TagCount{Tag: t, Count: c})
+	}
+	sort.Slice(tcs, func(i, j int) bool { return tcs[i].Tag < tcs[j].Tag })
+	return tcs
+}
+
+// Tagged returns all (non-draft) pages having tag.
+func (pi *pageIndex) Tagged(tag string, drafts bool) []*PageInfo {
+	var infos []*PageInfo
+	for _, info := range pi.Pages(drafts) {
+		if contains(info.Tags, tag) {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// Filter returns all (non-draft) pages matching f.
+func (pi *pageIndex) Filter(f *Filter, drafts bool) []*PageInfo {
+	var infos []*PageInfo
+	for _, info := range pi.Pages(drafts) {
+		if f.Match(info) {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// Built reports whether the index has been built.
+func (pi *pageIndex) Built() bool {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	return pi.built
+}
+
+func initIndex() {
+	_, sp := startSpan(context.Background(), "index")
+	defer sp.End()
+	if err := index.Build(); err != nil {
+		sp.SetError(err)
+		slog.Error("Unable to build page index", "err", err)
+	}
+}
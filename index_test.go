@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuildIndex(t *testing.T) {
+	defer func(s Storage, workers int) { store, *indexWorkers = s, workers; cachedPages.Clear() }(store, *indexWorkers)
+	store, *indexWorkers = newMemoryStorage(), 4
+	cachedPages.Clear()
+	const n = 100
+	for i := 0; i < n; i++ {
+		body := fmt.Sprintf("+++\ntitle = \"Page %d\"\n+++\nsee [next](p%d)\n", i, (i+1)%n)
+		if err := store.Save(fmt.Sprintf("p%d", i), []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Save("broken", []byte("no front matter")); err != nil {
+		t.Fatal(err)
+	}
+
+	pi := &pageIndex{}
+	if err := pi.Build(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pi.pages) != n {
+		t.Errorf("got %d pages but expected %d", len(pi.pages), n)
+	}
+	for i, this := range []struct {
+		path   string
+		title  string
+		linked string
+	}{
+		{"p0", "Page 0", "p99"},
+		{"p42", "Page 42", "p41"},
+	} {
+		info, ok := pi.Get(this.path)
+		if !ok || info.Title != this.title {
+			t.Errorf("[%d] got %v but expected title %q", i, info, this.title)
+		}
+		if bls := pi.Backlinks(this.path, true); len(bls) != 1 || bls[0].Path != this.linked {
+			t.Errorf("[%d] got %d backlinks but expected one from %q", i, len(bls), this.linked)
+		}
+	}
+}
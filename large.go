@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"html"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Very large pages (e.g. pasted logs or generated tables) are shown and
+// edited as plain text: features that scale badly with the body size are
+// skipped for them. Their view is streamed: the body is escaped and
+// written in chunks instead of being rendered in memory.
+var (
+	largePage   = flag.Int("large-page", 1<<20, "body size in bytes above which shortcodes, code execution and link previews are skipped (0 disables)")
+	maxPageSize = flag.Int64("max-page-size", 16<<20, "maximum size in bytes of a page that can be saved")
+)
+
+const (
+	LargeChunkSize = 64 << 10
+	// largeMarker stands for the body of a large page in its rendered view.
+	largeMarker = "<!-- gwiki:large-body -->"
+)
+
+// Large reports whether the body of p exceeds the large page threshold.
+func (p *Page) Large() bool {
+	return *largePage > 0 && len(p.Body) > *largePage
+}
+
+// renderLarge renders the body of a large page as escaped text only.
+func renderLarge(p *Page) template.HTML {
+	var sb strings.Builder
+	writeLarge(&sb, p.Body)
+	return template.HTML(sb.String())
+}
+
+// writeLarge writes body as escaped text in chunks.
+func writeLarge(w io.Writer, body []byte) error {
+	if _, err := io.WriteString(w, `<pre class="large">`); err != nil {
+		return err
+	}
+	for len(body) > 0 {
+		n := min(len(body), LargeChunkSize)
+		// only ASCII characters are escaped, so cutting runes doesn't matter
+		if _, err := io.WriteString(w, html.EscapeString(string(body[:n]))); err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+	_, err := io.WriteString(w, `</pre>`)
+	return err
+}
+
+// largeView is a large page in the view template, which gets the marker
+// instead of the body.
+type largeView struct {
+	*Page
+}
+
+func (largeView) Rendered() template.HTML {
+	return largeMarker
+}
+
+// renderLargeLayout renders the view of the large page p and streams the
+// body into it.
+func renderLargeLayout(w http.ResponseWriter, p *Page) {
+	var buf bytes.Buffer
+	err := layoutFor(p.Path, "view").ExecuteTemplate(&buf, "view.html", largeView{p})
+	if err != nil {
+		slog.Error("Unable to render layout", "template", "view", "path", p.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	before, after, ok := bytes.Cut(withCSRFToken(w, buf.Bytes()), []byte(largeMarker))
+	w.Write(before)
+	if !ok {
+		return // the layout doesn't show the body
+	}
+	if err = writeLarge(w, p.Body); err != nil {
+		slog.Info("Unable to write large page", "path", p.Path, "err", err)
+		return
+	}
+	w.Write(after)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chunkRecorder records the size of the largest write.
+type chunkRecorder struct {
+	*httptest.ResponseRecorder
+	largest int
+}
+
+func (w *chunkRecorder) Write(b []byte) (int, error) {
+	w.largest = max(w.largest, len(b))
+	return w.ResponseRecorder.Write(b)
+}
+
+func (w *chunkRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func TestRenderLargeLayout(t *testing.T) {
+	defer func(n int) { *largePage = n }(*largePage)
+	*largePage = 1000
+	p := NewPage("logs/big")
+	p.Body = []byte(strings.Repeat("<script>alert(1)</script>\n", 20*LargeChunkSize/26))
+	if !p.Large() {
+		t.Fatalf("expected the page to be large")
+	}
+	escaped := strings.Repeat("&lt;script&gt;alert(1)&lt;/script&gt;\n", 20*LargeChunkSize/26)
+
+	w := &chunkRecorder{ResponseRecorder: httptest.NewRecorder()}
+	renderLargeLayout(w, p)
+	body := w.Body.String()
+	if strings.Contains(body, "<script>alert") {
+		t.Errorf("got an unescaped body")
+	}
+	if n := strings.Count(body, `<pre class="large">`+escaped+`</pre>`); n != 1 {
+		t.Errorf("got the body %d times but expected it once", n)
+	}
+	if strings.Contains(body, largeMarker) || !strings.Contains(body, "This page is very large") {
+		t.Errorf("got no layout around the body")
+	}
+	if w.largest > 6*LargeChunkSize {
+		t.Errorf("got a write of %d bytes for a body of %d bytes", w.largest, len(p.Body))
+	}
+	if got := string(renderLarge(p)); got != `<pre class="large">`+escaped+`</pre>` {
+		t.Errorf("got a rendered body of %d bytes but expected %d", len(got), len(escaped)+25)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sections can override templates: <template dir>/<section>/<name>.html is
+// used for the pages below <section> instead of <name>.html and the
+// deepest section wins. An override is parsed on top of the default
+// templates, so it can use and redefine everything defined there.
+
+type layout struct {
+	modTime time.Time
+	t       *template.Template
+}
+
+var layouts = struct {
+	sync.Mutex
+	m map[string]*layout // override file -> parsed templates
+}{m: make(map[string]*layout)}
+
+// templateDir returns the directory of the active templates.
+func templateDir() string {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+	if activeTheme == "" {
+		return TemplateDir
+	}
+	return filepath.Join(*themesDir, activeTheme)
+}
+
+func resetLayouts() {
+	layouts.Lock()
+	defer layouts.Unlock()
+	layouts.m = make(map[string]*layout)
+}
+
+// layoutFor returns the templates for rendering name for the page at p.
+func layoutFor(p, name string) *template.Template {
+	dir := templateDir()
+	for section := path.Dir(p); section != "." && section != "/"; section = path.Dir(section) {
+		fn := filepath.Join(dir, filepath.FromSlash(section), name+".html")
+		fi, err := os.Stat(fn)
+		if err != nil {
+			continue
+		}
+		t, err := parseLayout(dir, fn, fi.ModTime())
+		if err != nil {
+			slog.Error("Unable to parse template", "file", fn, "err", err)
+			continue
+		}
+		return t
+	}
+	return currentTemplates()
+}
+
+// parseLayout parses the default templates in dir and the override fn on
+// top (again if fn changed since).
+func parseLayout(dir, fn string, modTime time.Time) (*template.Template, error) {
+	layouts.Lock()
+	defer layouts.Unlock()
+	if l, ok := layouts.m[fn]; ok && l.modTime.Equal(modTime) {
+		return l.t, nil
+	}
+	t, err := parseTemplates(dir)
+	if err != nil {
+		return nil, err
+	}
+	if t, err = t.ParseFiles(fn); err != nil {
+		return nil, err
+	}
+	layouts.m[fn] = &layout{modTime: modTime, t: t}
+	return t, nil
+}
+
+// renderLayout is renderTemplate with the section overrides for the page
+// at p.
+func renderLayout(w http.ResponseWriter, tmpl, p string, data interface{}) {
+	var buf bytes.Buffer
+	err := layoutFor(p, tmpl).ExecuteTemplate(&buf, tmpl+".html", data)
+	if err != nil {
+		slog.Error("Unable to render layout", "template", tmpl, "path", p, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(withCSRFToken(w, buf.Bytes()))
+}
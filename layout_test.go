@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLayoutFor(t *testing.T) {
+	themes := t.TempDir()
+	dir := filepath.Join(themes, "test")
+	for _, fn := range templateNames {
+		b, err := ioutil.ReadFile(filepath.Join(TemplateDir, fn))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err = writeFile(filepath.Join(dir, fn), bytes.NewReader(b)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	for fn, s := range map[string]string{
+		"blog/view.html":      "blog",
+		"blog/2024/view.html": "blog 2024",
+		"docs/view.html":      "{{broken",
+	} {
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(fn)), bytes.NewReader([]byte(s))); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	defer func(d, a string) { *themesDir, activeTheme = d, a }(*themesDir, activeTheme)
+	*themesDir, activeTheme = themes, "test"
+	resetLayouts()
+	defer resetLayouts()
+
+	for i, this := range []struct {
+		path, expect string
+	}{
+		{"blog/post", "blog"},
+		{"blog/" + IndexPage, "blog"},
+		{"blog/2024/post", "blog 2024"},
+		{"blog/2024/drafts/post", "blog 2024"},
+		{"blog/2025/post", "blog"},
+		{"docs/intro", ""},
+		{"about", ""},
+	} {
+		l := layoutFor(this.path, "view")
+		if this.expect == "" {
+			if l != currentTemplates() {
+				t.Errorf("[%d] got a section layout for %s but expected the default templates", i, this.path)
+			}
+			continue
+		}
+		var buf bytes.Buffer
+		if err := l.ExecuteTemplate(&buf, "view.html", nil); err != nil || buf.String() != this.expect {
+			t.Errorf("[%d] got %q (%v) for %s but expected %q", i, buf.String(), err, this.path, this.expect)
+		}
+		if l.Lookup("edit.html") == nil {
+			t.Errorf("[%d] got a layout for %s without the default templates", i, this.path)
+		}
+	}
+	if l := layoutFor("blog/post", "edit"); l != currentTemplates() {
+		t.Errorf("got a section layout for a template without override")
+	}
+
+	// changed overrides are parsed again
+	fn := filepath.Join(dir, "blog", "view.html")
+	if err := ioutil.WriteFile(fn, []byte("blog v2"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(fn, later, later); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := layoutFor("blog/post", "view").ExecuteTemplate(&buf, "view.html", nil); err != nil || buf.String() != "blog v2" {
+		t.Errorf("got %q (%v) after the change but expected %q", buf.String(), err, "blog v2")
+	}
+}
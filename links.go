@@ -0,0 +1,158 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of internal links.
+const (
+	LinkWiki     = "wiki"     // [[path]] or [[path|label]]
+	LinkMarkdown = "markdown" // [label](target)
+	LinkRef      = "ref"      // {{< ref "target" >}}
+)
+
+// Link is a link found in a page body. Start and End delimit the link
+// target in the body so it can be rewritten in place.
+type Link struct {
+	Kind       string
+	Start, End int
+	Target     string
+}
+
+var (
+	wikiLink     = regexp.MustCompile(`\[\[([^\]|#\n]+)(#[^\]|\n]*)?(\|[^\]\n]*)?\]\]`)
+	markdownLink = regexp.MustCompile(`\]\(\s*<?([^)\s>#?]*)([#?][^)\s>]*)?>?(?:\s+"[^"]*")?\s*\)`)
+	refLink      = regexp.MustCompile(`\{\{[<%]\s*(?:rel)?ref\s+"([^"#]+)(#[^"]*)?"\s*[>%]\}\}`)
+	externalLink = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+)
+
+// extractLinks returns all potentially internal links of body in order.
+func extractLinks(body []byte) []Link {
+	var ls []Link
+	for _, m := range wikiLink.FindAllSubmatchIndex(body, -1) {
+		ls = append(ls, Link{Kind: LinkWiki, Start: m[2], End: m[3], Target: strings.TrimSpace(string(body[m[2]:m[3]]))})
+	}
+	for _, m := range markdownLink.FindAllSubmatchIndex(body, -1) {
+		if m[3] > m[2] {
+			ls = append(ls, Link{Kind: LinkMarkdown, Start: m[2], End: m[3], Target: string(body[m[2]:m[3]])})
+		}
+	}
+	for _, m := range refLink.FindAllSubmatchIndex(body, -1) {
+		ls = append(ls, Link{Kind: LinkRef, Start: m[2], End: m[3], Target: string(body[m[2]:m[3]])})
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Start < ls[j].Start })
+	return ls
+}
+
+// resolveLink returns the path of the page a link on page from points to.
+// Wiki links and refs are relative to ContentDir; Markdown links are
+// relative to the directory of from unless they start with "/" or "/view/".
+// Attachments, static files and other files than pages aren't pages.
+func resolveLink(from string, l Link) (string, bool) {
+	t := l.Target
+	if t == "" || externalLink.MatchString(t) || strings.HasPrefix(t, "//") {
+		return "", false
+	}
+	switch {
+	case l.Kind == LinkWiki || l.Kind == LinkRef:
+		t = path.Clean("/" + t)
+	case strings.HasPrefix(t, "/view/"):
+		t = path.Clean(strings.TrimPrefix(t, "/view"))
+	case strings.HasPrefix(t, "/"):
+		t = path.Clean(t)
+	default:
+		t = path.Clean("/" + path.Join(path.Dir(from), t))
+	}
+	if strings.HasPrefix(t, "/files/") || strings.HasPrefix(t, "/static/") {
+		return "", false
+	}
+	if ext := path.Ext(t); ext != "" && ext != Suffix {
+		return "", false
+	}
+	t = strings.TrimSuffix(strings.TrimPrefix(t, "/"), Suffix)
+	if t == "" || strings.HasPrefix(t, "..") || !isValidPath(t) {
+		return "", false
+	}
+	return t, true
+}
+
+// linkTarget returns the target text for a link of the same style as l on
+// page from pointing to the page at to.
+func linkTarget(from string, l Link, to string) string {
+	t := l.Target
+	suffix := ""
+	if strings.HasSuffix(t, Suffix) {
+		suffix = Suffix
+	}
+	switch {
+	case l.Kind == LinkWiki:
+		return to
+	case l.Kind == LinkRef:
+		if strings.HasPrefix(t, "/") {
+			return "/" + to + suffix
+		}
+		return to + suffix
+	case strings.HasPrefix(t, "/view/"):
+		return "/view/" + to
+	case strings.HasPrefix(t, "/"):
+		if strings.HasSuffix(t, "/") {
+			return "/" + to + "/"
+		}
+		return "/" + to + suffix
+	default:
+		return relativePath(path.Dir(from), to) + suffix
+	}
+}
+
+// relativePath returns the relative path from directory dir to target.
+func relativePath(dir, target string) string {
+	if dir == "." {
+		dir = ""
+	}
+	ds := strings.Split(dir, "/")
+	if dir == "" {
+		ds = nil
+	}
+	ts := strings.Split(target, "/")
+	i := 0
+	for i < len(ds) && i < len(ts)-1 && ds[i] == ts[i] {
+		i++
+	}
+	return strings.Repeat("../", len(ds)-i) + strings.Join(ts[i:], "/")
+}
+
+// rewriteLinks returns body with all links on page from (being at newFrom
+// afterwards) rewritten by fn, which maps old to new target paths.
+// It returns nil if nothing changed.
+func rewriteLinks(body []byte, from, newFrom string, fn func(string) (string, bool)) []byte {
+	var out []byte
+	last, changed := 0, false
+	for _, l := range extractLinks(body) {
+		target, ok := resolveLink(from, l)
+		if !ok {
+			continue
+		}
+		newTarget, ok := fn(target)
+		if !ok && from == newFrom {
+			continue
+		}
+		if !ok {
+			newTarget = target
+		}
+		nt := linkTarget(newFrom, l, newTarget)
+		if nt == l.Target || l.Start < last {
+			continue
+		}
+		out = append(out, body[last:l.Start]...)
+		out = append(out, nt...)
+		last = l.End
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return append(out, body[last:]...)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	rename := func(from, to string) func(string) (string, bool) {
+		return func(p string) (string, bool) {
+			return to, p == from
+		}
+	}
+	for i, this := range []struct {
+		page, newPage string
+		body          string
+		from, to      string
+		expect        string
+	}{
+		{"blog/a", "blog/a", "see [b](b) and [c](c)", "blog/b", "docs/b", "see [b](../docs/b) and [c](c)"},
+		{"blog/a", "blog/a", "see [[blog/b|B]] and [[x]]", "blog/b", "docs/b", "see [[docs/b|B]] and [[x]]"},
+		{"a", "a", `[x](/view/blog/b#top) [y]({{< ref "blog/b.md" >}})`, "blog/b", "c", `[x](/view/c#top) [y]({{< ref "c.md" >}})`},
+		{"a", "a", "[ext](https://example.org/blog/b)", "blog/b", "c", ""},
+		{"blog/a", "docs/deep/a", "[b](b)", "x", "y", "[b](../../blog/b)"},
+	} {
+		result := string(rewriteLinks([]byte(this.body), this.page, this.newPage, rename(this.from, this.to)))
+
+		if result != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+}
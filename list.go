@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// listPages returns the paths of all pages in the storage, sorted.
+func listPages() ([]string, error) {
+	return store.List()
+}
+
+// searchPages returns the paths of all pages whose title, tags or body
+// contain q (case insensitive).
+func searchPages(q string) ([]string, error) {
+	return infoPaths(searchInfos(index.Pages(true), q, false)), nil
+}
+
+// searchInfos returns the pages of infos whose title, tags or body contain
+// q (case insensitive). Title and tags come from the index, bodies are
+// only read for pages that don't match already and bypass the page cache,
+// so a search doesn't evict the pages in use. With redact private blocks
+// aren't searched.
+func searchInfos(infos []*PageInfo, q string, redact bool) []*PageInfo {
+	lq := strings.ToLower(q)
+	var found []*PageInfo
+	for _, info := range infos {
+		if strings.Contains(strings.ToLower(info.Title), lq) ||
+			strings.Contains(strings.ToLower(strings.Join(info.Tags, " ")), lq) ||
+			bodyContains(info.Path, []byte(lq), redact) {
+			found = append(found, info)
+		}
+	}
+	return found
+}
+
+func bodyContains(path string, lq []byte, redact bool) bool {
+	if p, ok := cachedPages.Get(path); ok {
+		if redact {
+			return bytes.Contains(bytes.ToLower(redactBody(p.Body)), lq)
+		}
+		return bytes.Contains(bytes.ToLower(p.Body), lq)
+	}
+	b, err := store.Load(path)
+	if err != nil {
+		return false
+	}
+	pg, err := parser.ReadFrom(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+	body := pg.Content()
+	if redact {
+		body = redactBody(body)
+	}
+	return bytes.Contains(bytes.ToLower(body), lq)
+}
+
+type listData struct {
+	Section string
+	Pages   []*Page
+	Pagination
+}
+
+// listHandler lists all pages (of a section) with their effective front
+// matter, PagesDefaultLimit at a time (?offset=&limit=).
+func listHandler(w http.ResponseWriter, r *http.Request) {
+	section := strings.Trim(strings.TrimPrefix(r.URL.Path, "/list/"), "/")
+	if section != "" && !isValidPath(section) {
+		http.NotFound(w, r)
+		return
+	}
+	ps, err := listPages()
+	if err != nil {
+		logger(r.Context()).Error("Unable to list pages", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := listData{Section: section}
+	var paths []string
+	for _, path := range ps {
+		if (section == "" || strings.HasPrefix(path, section+"/")) && mayView(r, path) {
+			paths = append(paths, path)
+		}
+	}
+	data.Pagination = paginate(r, len(paths), PagesDefaultLimit, PagesMaxLimit)
+	start, end := data.Bounds()
+	cache := make(cascadeCache)
+	for _, p := range loadMetas(paths[start:end]) {
+		data.Pages = append(data.Pages, p.Effective(cache).For(r))
+	}
+	renderTemplate(w, "list", data)
+}
+
+const (
+	PagesDefaultLimit = 100
+	PagesMaxLimit     = 1000
+)
+
+// filterPages returns the metadata of all pages matching the front matter
+// filter expression and containing q (if not empty). With redact private
+// fields and blocks are neither matched nor returned.
+func filterPages(expr, q string, drafts, redact bool) ([]*PageInfo, error) {
+	f, err := ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	var infos []*PageInfo
+	if redact {
+		for _, info := range index.Pages(drafts) {
+			if info = redactInfo(info); f.Match(info) {
+				infos = append(infos, info)
+			}
+		}
+	} else {
+		infos = index.Filter(f, drafts)
+	}
+	if q == "" {
+		return infos, nil
+	}
+	return searchInfos(infos, q, redact), nil
+}
+
+// pagesHandler serves /api/v1/pages?filter=&q=&drafts=true&offset=&limit=.
+func pagesHandler(w http.ResponseWriter, r *http.Request) {
+	infos, err := filterPages(r.FormValue("filter"), r.FormValue("q"), r.FormValue("drafts") == "true", !isEditor(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	infos = visibleInfos(r, infos)
+	if infos == nil {
+		infos = []*PageInfo{}
+	}
+	pg := paginate(r, len(infos), PagesDefaultLimit, PagesMaxLimit)
+	start, end := pg.Bounds()
+	writeJSON(w, map[string]interface{}{"total": pg.Total, "offset": pg.Offset, "limit": pg.Limit, "pages": infos[start:end]})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The web server listens on a TCP address, on a unix domain socket
+// (-addr unix:/run/gwiki.sock, e.g. behind nginx) or on the sockets passed
+// by systemd socket activation (LISTEN_FDS): the first one is used for
+// -addr and the second one (if any) for -http-addr.
+var socketMode = flag.String("socket-mode", "0660", "file mode of the unix domain socket")
+
+// UnixPrefix marks an address as unix domain socket.
+const UnixPrefix = "unix:"
+
+// ListenFDsStart is the first file descriptor passed by systemd.
+const ListenFDsStart = 3
+
+var activated []net.Listener // by systemd
+
+func initListeners() {
+	ls, err := systemdListeners()
+	if err != nil {
+		fatal("Unable to use the sockets of systemd", "err", err)
+	}
+	activated = ls
+}
+
+// systemdListeners returns the listeners passed by systemd socket
+// activation (if any).
+func systemdListeners() ([]net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS '%s'", os.Getenv("LISTEN_FDS"))
+	}
+	// child processes (e.g. Hugo) must not use them
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	var ls []net.Listener
+	for fd := ListenFDsStart; fd < ListenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("file descriptor %d isn't a socket: %s", fd, err)
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// listen returns the listener for addr or the i-th listener passed by
+// systemd.
+func listen(addr string, i int) (net.Listener, error) {
+	if i < len(activated) {
+		return activated[i], nil
+	}
+	if !strings.HasPrefix(addr, UnixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket mode '%s'", *socketMode)
+	}
+	fn := strings.TrimPrefix(addr, UnixPrefix)
+	// a socket left by a crashed process makes listening fail
+	if fi, err := os.Lstat(fn); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", fn); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("socket '%s' is in use", fn)
+		}
+		os.Remove(fn)
+	}
+	l, err := net.Listen("unix", fn)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(fn, os.FileMode(mode)); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "gwiki.sock")
+	l, err := listen(UnixPrefix+fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(fn); err != nil || fi.Mode().Perm() != 0660 {
+		t.Errorf("got %v (%v) but expected a socket with mode 0660", fi, err)
+	}
+	if _, err := listen(UnixPrefix+fn, 0); err == nil {
+		t.Errorf("expected an error for a socket in use")
+	}
+	// a stale socket is replaced
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if l, err = listen(UnixPrefix+fn, 0); err != nil {
+		t.Errorf("unexpected error for a stale socket: %s", err)
+	} else {
+		l.Close()
+	}
+
+	os.Setenv("LISTEN_PID", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	if ls, err := systemdListeners(); ls != nil || err != nil {
+		t.Errorf("got %v (%v) for sockets of another process", ls, err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Everything is logged with log/slog to stderr. Every request gets an ID,
+// taken from a valid X-Request-ID header (e.g. set by a proxy) or
+// generated, which is sent back in the response and added to all messages
+// about the request, its spans and its audit log entries.
+var (
+	logLevel  = flag.String("log-level", "info", "minimum level of log messages: 'debug', 'info', 'warn' or 'error'")
+	logFormat = flag.String("log-format", "text", "format of log messages: 'text' or 'json'")
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// newLogHandler returns the slog handler for level and format writing to w.
+func newLogHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level '%s'", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format '%s'", format)
+}
+
+func initLogging() {
+	h, err := newLogHandler(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// requestID returns the ID of the request of ctx or "".
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logger returns the logger for messages about the request of ctx: with
+// its ID and user (if known).
+func logger(ctx context.Context) *slog.Logger {
+	l := slog.Default()
+	if id := requestID(ctx); id != "" {
+		l = l.With("request_id", id)
+	}
+	if u, ok := ctx.Value(userKey{}).(string); ok && u != "" {
+		l = l.With("user", u)
+	}
+	return l
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDHandler wraps h so every request has an ID.
+func requestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
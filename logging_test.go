@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	for i, this := range []struct {
+		level, format string
+		expectErr     bool
+	}{
+		{"info", "text", false},
+		{"DEBUG", "json", false},
+		{"warn", "JSON", false},
+		{"verbose", "text", true},
+		{"error", "xml", true},
+	} {
+		_, err := newLogHandler(&bytes.Buffer{}, this.level, this.format)
+		if (err != nil) != this.expectErr {
+			t.Errorf("[%d] got error %v but expected error: %t", i, err, this.expectErr)
+		}
+	}
+
+	var buf bytes.Buffer
+	h, _ := newLogHandler(&buf, "info", "json")
+	old := slog.Default()
+	slog.SetDefault(slog.New(h))
+	defer slog.SetDefault(old)
+
+	var id string
+	handler := requestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = requestID(r.Context())
+		logger(withUser(r, "alice").Context()).Info("Saved page", "path", "docs/install")
+		logger(r.Context()).Debug("Hidden")
+	}))
+	for i, this := range []struct {
+		header   string
+		expectID string
+	}{
+		{"abc-123", "abc-123"},
+		{"", ""},
+		{"no spaces", ""},
+		{strings.Repeat("x", 65), ""},
+	} {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/view/x", nil)
+		if this.header != "" {
+			r.Header.Set(RequestIDHeader, this.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if this.expectID != "" && id != this.expectID {
+			t.Errorf("[%d] got request ID %q but expected %q", i, id, this.expectID)
+		}
+		if !validRequestID.MatchString(id) {
+			t.Errorf("[%d] got invalid request ID %q", i, id)
+		}
+		if got := w.Header().Get(RequestIDHeader); got != id {
+			t.Errorf("[%d] got response header %q but expected %q", i, got, id)
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("[%d] expected a single JSON log entry, got %q: %s", i, buf.String(), err)
+		}
+		if entry["request_id"] != id || entry["user"] != "alice" || entry["path"] != "docs/install" || entry["level"] != "INFO" {
+			t.Errorf("[%d] got log entry %v", i, entry)
+		}
+	}
+}
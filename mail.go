@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	smtpAddr = flag.String("smtp", "localhost:25", "SMTP server (host:port) for mails")
+	mailFrom = flag.String("mail-from", "gwiki@localhost", "sender address of mails")
+	mailURL  = flag.String("mail-url", "", "base URL of the wiki for links in mails (default: the URL of the request causing a mail)")
+)
+
+// Mails are rendered from the templates in the mail directory of the active
+// theme (or of the default templates): <name>.txt for the text part and
+// <name>.html, which defines "content" for layout.html, for the HTML part.
+const MailDir = "mail"
+
+// Mail is a rendered mail.
+type Mail struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type mailData struct {
+	Site    *SiteConfig
+	Subject string
+	URL     string // base URL of the wiki
+	Data    interface{}
+}
+
+// mailSamples return subject and data of every mail for previews.
+var mailSamples = map[string]func() (string, interface{}){
+	"change": func() (string, interface{}) {
+		return "change of docs/install", &changeMail{User: "alice", Path: "docs/install", Summary: "Add the Windows steps"}
+	},
+	"review": func() (string, interface{}) {
+		return "review request for docs/install", &changeMail{User: "alice", Path: "docs/install", Summary: "Add the Windows steps", Review: "1700000000000000000"}
+	},
+	"snapshot": func() (string, interface{}) {
+		now := time.Now().UTC().Truncate(time.Hour)
+		return "changes " + now.Format("2006-01-02T15"), &SnapshotReport{
+			ID: now.Format("2006-01-02T15"), Since: now.Add(-24 * time.Hour), Until: now,
+			Changes: []PageChange{{Path: "docs/install", Kind: "changed", Added: 12, Removed: 3}, {Path: "blog/hello", Kind: "added", Added: 20}},
+		}
+	},
+}
+
+// changeMail is the data of "change" and "review" mails.
+type changeMail struct {
+	User    string
+	Path    string
+	Summary string
+	Review  string // ID of the review request
+}
+
+// mailTemplateFile returns the file of a mail template, falling back to the
+// default templates if the active theme has none.
+func mailTemplateFile(name string) string {
+	fn := filepath.Join(templateDir(), MailDir, name)
+	if _, err := os.Stat(fn); err != nil {
+		return filepath.Join(TemplateDir, MailDir, name)
+	}
+	return fn
+}
+
+// renderMail renders the mail name; url is the base URL for links unless
+// -mail-url is set.
+func renderMail(name, subject, url string, data interface{}) (*Mail, error) {
+	if *mailURL != "" {
+		url = *mailURL
+	}
+	if site.Title != "" {
+		subject = site.Title + ": " + subject
+	}
+	md := &mailData{Site: site, Subject: subject, URL: strings.TrimSuffix(url, "/"), Data: data}
+	m := &Mail{Subject: md.Subject}
+	tt, err := template.ParseFiles(mailTemplateFile(name + ".txt"))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err = tt.Execute(&b, md); err != nil {
+		return nil, err
+	}
+	m.Text = b.String()
+	ht, err := htmltemplate.ParseFiles(mailTemplateFile("layout.html"), mailTemplateFile(name+".html"))
+	if err != nil {
+		return nil, err
+	}
+	b.Reset()
+	if err = ht.ExecuteTemplate(&b, "layout.html", md); err != nil {
+		return nil, err
+	}
+	m.HTML = b.String()
+	return m, nil
+}
+
+// message returns m as multipart/alternative message.
+func (m *Mail) message(from string, to []string) ([]byte, error) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=%s\r\n\r\n",
+		from, strings.Join(to, ", "), mime.QEncoding.Encode("utf-8", m.Subject), time.Now().Format(time.RFC1123Z), mw.Boundary())
+	for _, part := range []struct{ typ, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err = qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// sendMail sends m with a text and an HTML part.
+func sendMail(to []string, m *Mail) error {
+	msg, err := m.message(*mailFrom, to)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(*smtpAddr, nil, *mailFrom, to, msg)
+}
+
+type mailsData struct {
+	Names []string
+	Name  string
+	Mail  *Mail
+	Err   string
+}
+
+// mailsHandler previews the mails with sample data (/admin/mails): the
+// text and HTML part of ?name=<mail> or the HTML part alone with
+// &format=html.
+func mailsHandler(w http.ResponseWriter, r *http.Request) {
+	data := mailsData{Name: r.FormValue("name")}
+	for n := range mailSamples {
+		data.Names = append(data.Names, n)
+	}
+	sort.Strings(data.Names)
+	if sample, ok := mailSamples[data.Name]; ok {
+		subject, d := sample()
+		m, err := renderMail(data.Name, subject, baseURL(r), d)
+		if err != nil {
+			data.Err = err.Error()
+		} else if r.FormValue("format") == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(m.HTML))
+			return
+		}
+		data.Mail = m
+	} else if data.Name != "" {
+		http.NotFound(w, r)
+		return
+	}
+	renderTemplate(w, "mails", data)
+}
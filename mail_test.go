@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestRenderMail(t *testing.T) {
+	for name, sample := range mailSamples {
+		subject, data := sample()
+		m, err := renderMail(name, subject, "https://wiki.example/", data)
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %s", name, err)
+			continue
+		}
+		if !strings.HasSuffix(m.Subject, subject) {
+			t.Errorf("[%s] got subject %q", name, m.Subject)
+		}
+		for _, part := range []string{m.Text, m.HTML} {
+			if !strings.Contains(part, "https://wiki.example/") {
+				t.Errorf("[%s] expected a link to the wiki in %q", name, part)
+			}
+		}
+	}
+}
+
+func TestMailMessage(t *testing.T) {
+	m := &Mail{Subject: "Änderung", Text: "Grüße\n", HTML: "<p>Grüße</p>"}
+	b, err := m.message("gwiki@example.org", []string{"a@example.org", "b@example.org"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); s != m.Subject {
+		t.Errorf("got subject %q but expected %q", s, m.Subject)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for i, expect := range []string{m.Text, m.HTML} {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", i, err)
+		}
+		got, _ := ioutil.ReadAll(p) // decodes quoted-printable with CRLF line ends
+		if strings.Replace(string(got), "\r\n", "\n", -1) != expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, expect)
+		}
+	}
+}
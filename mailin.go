@@ -0,0 +1,693 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// The mail gateway creates draft pages from mails: the subject becomes the
+// title, the HTML body (converted to Markdown) or else the text body the
+// content, the attachments are stored next to the page and the sender is
+// the author. Mails are polled from an IMAP mailbox (-imap, over TLS, and
+// marked as seen) or POSTed raw to /api/v1/mail by inbound mail webhooks,
+// which must sign the body with the secret of -mail-in-secret-file.
+//
+// The From header is easily forged, so a sender only counts if the own
+// mail server (-mail-in-authserv-id) authenticated it in the
+// Authentication-Results header. Pages are stored as the authenticated
+// sender or else as anonymous, so changes of owned sections need approval.
+// With -mail-in-senders only mails of these authenticated senders create
+// pages.
+var (
+	mailInSection    = flag.String("mail-in-section", "inbox", "section pages created from mails are created in")
+	mailInSenders    = flag.String("mail-in-senders", "", "addresses and @domains (separated by commas) whose authenticated mails create pages (default: all)")
+	mailInAuthServID = flag.String("mail-in-authserv-id", "", "authserv-id of the own mail server in the Authentication-Results header of received mails")
+	mailInSecretFile = flag.String("mail-in-secret-file", "", "file with the secret the mail webhook signs its POSTs with (HMAC-SHA256 of the body in X-Gwiki-Signature; without it the webhook is disabled)")
+	mailInMaxSize    = flag.Int64("mail-in-max-size", 25<<20, "maximum size in bytes of a mail creating a page")
+	imapAddr         = flag.String("imap", "", "IMAP server (host:port, TLS) polled for mails creating draft pages")
+	imapUser         = flag.String("imap-user", "", "IMAP user")
+	imapPasswordFile = flag.String("imap-password-file", "", "file with the IMAP password")
+	imapMailbox      = flag.String("imap-mailbox", "INBOX", "IMAP mailbox polled for mails")
+	imapInterval     = flag.Duration("imap-interval", 5*time.Minute, "interval of polling the IMAP mailbox")
+)
+
+const (
+	MailInPath     = "/api/v1/mail"
+	MailInMaxFiles = 50
+	MailMaxDepth   = 10 // of nested multipart parts
+	IMAPTimeout    = time.Minute
+)
+
+var (
+	errMailSender = errors.New("the sender isn't allowed to create pages")
+
+	// mailInFields are the form fields inbound mail webhooks send the raw
+	// mail in (generic, SendGrid, Mailgun).
+	mailInFields = []string{"message", "email", "body-mime"}
+
+	mailSignature = regexp.MustCompile(`\n-- ?\n`)
+	imapLiteral   = regexp.MustCompile(`\{(\d+)\}$`)
+	imapPassword  string
+	mailInSecret  string
+	// imapTLSConfig is used for the connections to the IMAP server.
+	imapTLSConfig *tls.Config
+)
+
+// mailFile is an attachment or inline part of a mail.
+type mailFile struct {
+	name, cid string
+	data      []byte
+	used      bool // inline in the HTML body
+	file      *ImportedFile
+}
+
+// mailContent collects the bodies and files of a mail.
+type mailContent struct {
+	text, html string
+	files      []*mailFile
+}
+
+// mailSenderAllowed reports whether mails of the address addr create pages.
+func mailSenderAllowed(addr string, authenticated bool) bool {
+	if strings.TrimSpace(*mailInSenders) == "" {
+		return true
+	}
+	if !authenticated {
+		return false
+	}
+	addr = strings.ToLower(addr)
+	for _, s := range strings.Split(strings.ToLower(*mailInSenders), ",") {
+		s = strings.TrimSpace(s)
+		if s != "" && (s == addr || strings.HasPrefix(s, "@") && strings.HasSuffix(addr, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mailAuthenticated reports whether the own mail server verified that the
+// mail with the header h comes from the domain of from: DMARC passed, or
+// DKIM or SPF passed for that domain. Only the topmost Authentication-Results
+// header of -mail-in-authserv-id counts since the server replaces the ones
+// in received mails.
+func mailAuthenticated(h mail.Header, from *mail.Address) bool {
+	if *mailInAuthServID == "" {
+		return false
+	}
+	_, domain, _ := strings.Cut(strings.ToLower(from.Address), "@")
+	for _, ar := range h["Authentication-Results"] {
+		id, results, _ := strings.Cut(ar, ";")
+		if f := strings.Fields(id); len(f) == 0 || !strings.EqualFold(f[0], *mailInAuthServID) {
+			continue
+		}
+		for _, res := range strings.Split(results, ";") {
+			f := strings.Fields(strings.ToLower(res))
+			if len(f) == 0 {
+				continue
+			}
+			switch f[0] {
+			case "dmarc=pass":
+				if authResultFor(f, domain, "header.from") {
+					return true
+				}
+			case "dkim=pass":
+				if authResultFor(f, domain, "header.d", "header.i") {
+					return true
+				}
+			case "spf=pass":
+				if authResultFor(f, domain, "smtp.mailfrom") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// authResultFor reports whether one of the properties of the method result
+// f is the domain or an address of it.
+func authResultFor(f []string, domain string, props ...string) bool {
+	for _, kv := range f[1:] {
+		k, v, _ := strings.Cut(kv, "=")
+		v = strings.Trim(v, `"`)
+		if contains(props, k) && domain != "" && (v == domain || strings.HasSuffix(v, "@"+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mailWordDecoder decodes encoded words (RFC 2047) in headers.
+var mailWordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+func decodeMailHeader(s string) string {
+	if d, err := mailWordDecoder.DecodeHeader(s); err == nil {
+		return d
+	}
+	return s
+}
+
+// mailText returns the text b in the charset cs as UTF-8.
+func mailText(b []byte, cs string) string {
+	if cs != "" && !strings.EqualFold(cs, "utf-8") && !strings.EqualFold(cs, "us-ascii") {
+		if r, err := charset.NewReaderLabel(cs, bytes.NewReader(b)); err == nil {
+			if d, err := io.ReadAll(r); err == nil {
+				b = d
+			}
+		}
+	}
+	return strings.ReplaceAll(string(b), "\r\n", "\n")
+}
+
+// read adds the part with the header h to mc.
+func (mc *mailContent) read(h textproto.MIMEHeader, body io.Reader, depth int) error {
+	mt, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mt, params = "text/plain", map[string]string{}
+	}
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		if depth >= MailMaxDepth {
+			return fmt.Errorf("parts are nested more than %d levels", MailMaxDepth)
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err = mc.read(p.Header, p, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	disp, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	name := dparams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if disp != "attachment" && name == "" {
+		switch {
+		case mt == "text/plain" && mc.text == "":
+			mc.text = mailText(b, params["charset"])
+			return nil
+		case mt == "text/html" && mc.html == "":
+			mc.html = mailText(b, params["charset"])
+			return nil
+		}
+	}
+	if name = decodeMailHeader(name); name == "" {
+		name = "attachment"
+		if exts, _ := mime.ExtensionsByType(mt); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	cid := strings.Trim(h.Get("Content-Id"), "<> ")
+	mc.files = append(mc.files, &mailFile{name: name, cid: cid, data: b})
+	return nil
+}
+
+// mailAuthor returns the sender a as author.
+func mailAuthor(a *mail.Address) string {
+	if a.Name == "" {
+		return a.Address
+	}
+	return a.Name + " <" + a.Address + ">"
+}
+
+// mailBody returns the text of a mail without the signature (whose
+// delimiter "-- " loses its space in quoted-printable).
+func mailBody(text string) string {
+	if i := mailSignature.FindStringIndex(text); i != nil {
+		text = text[:i[0]]
+	}
+	if text = strings.Trim(text, "\n"); text == "" {
+		return ""
+	}
+	return text + "\n"
+}
+
+// importMail converts the mail raw to a draft page below section with its
+// attachments and returns it with the sender and whether the sender is
+// authenticated.
+func importMail(raw []byte, section string) (*Import, *mail.Address, bool, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("invalid mail: %s", err)
+	}
+	froms, err := msg.Header.AddressList("From")
+	if err != nil || len(froms) == 0 {
+		return nil, nil, false, fmt.Errorf("the mail has no valid sender")
+	}
+	from := froms[0]
+	authenticated := mailAuthenticated(msg.Header, from)
+	if !mailSenderAllowed(from.Address, authenticated) {
+		return nil, from, authenticated, errMailSender
+	}
+	mc := &mailContent{}
+	if err = mc.read(textproto.MIMEHeader(msg.Header), msg.Body, 0); err != nil {
+		return nil, from, authenticated, fmt.Errorf("invalid mail: %s", err)
+	}
+	title := oneLine(decodeMailHeader(msg.Header.Get("Subject")))
+	if title == "" {
+		title = "Mail from " + mailAuthor(from)
+	}
+	slug := slugify(title)
+	if len(slug) > MicropubSlugMax {
+		slug = strings.Trim(slug[:MicropubSlugMax], "-")
+	}
+	p := NewPage(unusedPath(section, slug))
+	p.FrontMatter["title"] = title
+	p.FrontMatter["draft"] = true
+	p.FrontMatter["author"] = mailAuthor(from)
+	date, err := msg.Header.Date()
+	if err != nil {
+		date = time.Now()
+	}
+	p.FrontMatter["date"] = date.UTC().Truncate(time.Second)
+	imp := &Import{Pages: []*Page{p}}
+
+	dir := attachmentDir(p.Path)
+	taken := make(map[string]bool)
+	for _, f := range mc.files {
+		if len(imp.Files) >= MailInMaxFiles {
+			imp.problem("attachment '%s' isn't stored: more than %d attachments", f.name, MailInMaxFiles)
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.name))
+		base := slugify(strings.TrimSuffix(f.name, path.Ext(f.name)))
+		if base == "" {
+			base = "file"
+		}
+		// The attachments of the section share the directory.
+		want := path.Join(dir, path.Base(p.Path)+"-"+base+ext)
+		name := path.Base(uniqueName(taken, want))
+		for {
+			if _, err := attachmentFS(dir).Stat(attachmentFile(dir, name)); err != nil {
+				break
+			}
+			name = path.Base(uniqueName(taken, want))
+		}
+		content, err := uploadPolicy(dir).checkUpload(name, int64(len(f.data)), bytes.NewReader(f.data))
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(content)
+		}
+		if err != nil {
+			imp.problem("attachment '%s' isn't stored: %s", f.name, err)
+			continue
+		}
+		f.file = &ImportedFile{Dir: dir, Name: name, Data: data}
+		imp.Files = append(imp.Files, f.file)
+	}
+
+	var body string
+	if mc.html != "" {
+		doc, err := html.Parse(strings.NewReader(mc.html))
+		if err != nil {
+			return nil, from, authenticated, fmt.Errorf("invalid HTML body: %s", err)
+		}
+		remote := 0
+		body = htmlToMarkdown(doc, func(href string, image bool) string {
+			if cid, ok := strings.CutPrefix(href, "cid:"); ok {
+				for _, f := range mc.files {
+					if f.cid != "" && f.cid == cid && f.file != nil {
+						f.used = true
+						return path.Join("/files", f.file.Dir, f.file.Name)
+					}
+				}
+				return ""
+			}
+			if image {
+				// Remote images of mails are often used for tracking.
+				remote++
+				return ""
+			}
+			return href
+		})
+		if remote > 0 {
+			imp.problem("%d remote images aren't loaded", remote)
+		}
+	} else {
+		body = mailBody(mc.text)
+	}
+	var sb strings.Builder
+	for _, f := range mc.files {
+		if f.file == nil || f.used {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("\n## Attachments\n\n")
+		}
+		u := path.Join("/files", f.file.Dir, f.file.Name)
+		if imageExtensions[path.Ext(f.file.Name)] {
+			fmt.Fprintf(&sb, "- ![%s](%s)\n", markdownChars.Replace(f.name), u)
+		} else {
+			fmt.Fprintf(&sb, "- [%s](%s)\n", markdownChars.Replace(f.name), u)
+		}
+	}
+	p.Body = []byte(body + sb.String())
+	return imp, from, authenticated, nil
+}
+
+// receiveMail stores the page created from the mail raw below section as
+// the user of the request returned for the sender (anonymous unless the
+// sender is authenticated).
+func receiveMail(raw []byte, section string, request func(user string) *http.Request) (*ImportReport, error) {
+	if int64(len(raw)) > *mailInMaxSize {
+		return nil, fmt.Errorf("the mail is larger than %d bytes", *mailInMaxSize)
+	}
+	imp, from, authenticated, err := importMail(raw, section)
+	if err != nil {
+		return nil, err
+	}
+	user := "anonymous"
+	if authenticated {
+		user = strings.ToLower(from.Address)
+	}
+	rep := storeImport(request(user), imp, false)
+	if len(rep.Pages) == 0 && len(rep.Reviews) == 0 {
+		return rep, fmt.Errorf("unable to store the page: %s", strings.Join(rep.Problems, ", "))
+	}
+	return rep, nil
+}
+
+// mailInHandler creates a draft page from an inbound mail webhook (POST
+// /api/v1/mail with the raw mail as body or form field message, email or
+// body-mime and optionally section) and returns the import report. The
+// body must be signed with the secret of -mail-in-secret-file.
+func mailInHandler(w http.ResponseWriter, r *http.Request) {
+	if mailInSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, *mailInMaxSize+1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !hmac.Equal([]byte(r.Header.Get(WebhookSignatureHeader)), []byte(webhookSignature(mailInSecret, body))) {
+		logger(r.Context()).Info("Mail with an invalid signature refused")
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var raw []byte
+	ct := r.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "multipart/form-data") || strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
+		for _, field := range mailInFields {
+			if f, _, ferr := r.FormFile(field); ferr == nil {
+				raw, err = io.ReadAll(f)
+				f.Close()
+				break
+			} else if v := r.FormValue(field); v != "" {
+				raw = []byte(v)
+				break
+			}
+		}
+	} else {
+		raw, err = io.ReadAll(r.Body)
+	}
+	if err != nil || len(raw) == 0 {
+		http.Error(w, "the mail is missing", http.StatusBadRequest)
+		return
+	}
+	section := strings.Trim(r.URL.Query().Get("section"), "/")
+	if section == "" {
+		section = strings.Trim(r.FormValue("section"), "/")
+	}
+	if section == "" {
+		section = *mailInSection
+	}
+	if checkPath(section) != nil {
+		http.Error(w, fmt.Sprintf("invalid section '%s'", section), http.StatusBadRequest)
+		return
+	}
+	if !tokenAllows(r, section+"/") || !acls.Allowed(currentUser(r), section+"/", true) {
+		http.Error(w, fmt.Sprintf("not allowed to create pages in '%s'", section), http.StatusForbidden)
+		return
+	}
+	rep, err := receiveMail(raw, section, func(user string) *http.Request { return withUser(r, user) })
+	switch {
+	case err == errMailSender:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil && rep == nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		logger(r.Context()).Error("Unable to store page from mail", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if len(rep.Pages) == 0 {
+		logger(r.Context()).Info("Requested review of page from mail", "review", rep.Reviews[0], "files", len(rep.Files))
+		w.Header().Set("Location", baseURL(r)+"/reviews?id="+rep.Reviews[0])
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		logger(r.Context()).Info("Created page from mail", "path", rep.Pages[0], "files", len(rep.Files))
+		w.Header().Set("Location", baseURL(r)+"/view/"+rep.Pages[0])
+		w.WriteHeader(http.StatusCreated)
+	}
+	writeJSON(w, rep)
+}
+
+// imapConn is a minimal IMAP4rev1 client for polling a mailbox.
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is an untagged response with its literals.
+type imapResponse struct {
+	line     string
+	literals [][]byte // nil for literals larger than -mail-in-max-size
+}
+
+func dialIMAP(addr string) (*imapConn, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: IMAPTimeout}, "tcp", addr, imapTLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(IMAPTimeout))
+	greeting, err := c.readResponse()
+	if err == nil && !strings.HasPrefix(greeting.line, "* OK") {
+		err = fmt.Errorf("unexpected greeting '%s'", greeting.line)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// readResponse reads a response line with its literals.
+func (c *imapConn) readResponse() (*imapResponse, error) {
+	res := &imapResponse{}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		res.line += line
+		m := imapLiteral.FindStringSubmatch(line)
+		if m == nil {
+			return res, nil
+		}
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n > *mailInMaxSize {
+			if _, err = io.CopyN(io.Discard, c.r, n); err != nil {
+				return nil, err
+			}
+			res.literals = append(res.literals, nil)
+			continue
+		}
+		b := make([]byte, n)
+		if _, err = io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		res.literals = append(res.literals, b)
+	}
+}
+
+// cmd runs the command and returns its untagged responses.
+func (c *imapConn) cmd(command string) ([]*imapResponse, error) {
+	c.tag++
+	tag := "G" + strconv.Itoa(c.tag)
+	c.conn.SetDeadline(time.Now().Add(IMAPTimeout))
+	if _, err := io.WriteString(c.conn, tag+" "+command+"\r\n"); err != nil {
+		return nil, err
+	}
+	var untagged []*imapResponse
+	for {
+		res, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if status, ok := strings.CutPrefix(res.line, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("%s failed: %s", strings.Fields(command)[0], status)
+			}
+			return untagged, nil
+		}
+		if strings.HasPrefix(res.line, "* ") {
+			untagged = append(untagged, res)
+		}
+	}
+}
+
+func (c *imapConn) Close() error {
+	c.cmd("LOGOUT")
+	return c.conn.Close()
+}
+
+// imapQuote returns s as IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// pollIMAP creates pages from the unseen mails of the IMAP mailbox and
+// marks them as seen, also the ones that didn't create a page.
+func pollIMAP() error {
+	c, err := dialIMAP(*imapAddr)
+	if err != nil {
+		return fmt.Errorf("unable to connect to '%s': %s", *imapAddr, err)
+	}
+	defer c.Close()
+	if _, err = c.cmd("LOGIN " + imapQuote(*imapUser) + " " + imapQuote(imapPassword)); err != nil {
+		return err
+	}
+	if _, err = c.cmd("SELECT " + imapQuote(*imapMailbox)); err != nil {
+		return err
+	}
+	found, err := c.cmd("UID SEARCH UNSEEN")
+	if err != nil {
+		return err
+	}
+	var uids []string
+	for _, res := range found {
+		if rest, ok := strings.CutPrefix(res.line, "* SEARCH"); ok {
+			uids = append(uids, strings.Fields(rest)...)
+		}
+	}
+	request := func(user string) *http.Request { return localRequest(user, "imap") }
+	section := strings.Trim(*mailInSection, "/")
+	for _, uid := range uids {
+		fetched, err := c.cmd("UID FETCH " + uid + " BODY.PEEK[]")
+		if err != nil {
+			return err
+		}
+		var raw []byte
+		var ok bool
+		for _, res := range fetched {
+			if len(res.literals) > 0 {
+				raw, ok = res.literals[0], true
+				break
+			}
+		}
+		switch {
+		case !ok:
+			slog.Warn("Mail not found", "uid", uid)
+		case raw == nil:
+			slog.Warn("Mail is too large to create a page", "uid", uid, "max", *mailInMaxSize)
+		default:
+			if rep, err := receiveMail(raw, section, request); err != nil {
+				slog.Warn("Unable to create page from mail", "uid", uid, "err", err)
+			} else if len(rep.Pages) == 0 {
+				slog.Info("Requested review of page from mail", "uid", uid, "review", rep.Reviews[0], "files", len(rep.Files))
+			} else {
+				slog.Info("Created page from mail", "uid", uid, "path", rep.Pages[0], "files", len(rep.Files))
+			}
+		}
+		if _, err = c.cmd("UID STORE " + uid + ` +FLAGS.SILENT (\Seen)`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initMailIn reads the secret of the mail webhook and starts polling the
+// IMAP mailbox of -imap.
+func initMailIn() {
+	if *mailInSecretFile != "" {
+		b, err := os.ReadFile(*mailInSecretFile)
+		if err != nil {
+			fatal("Unable to read the mail webhook secret", "err", err)
+		}
+		mailInSecret = strings.TrimSpace(string(b))
+	}
+	if *imapAddr == "" || *readOnly {
+		return
+	}
+	if *imapPasswordFile != "" {
+		b, err := os.ReadFile(*imapPasswordFile)
+		if err != nil {
+			fatal("Unable to read the IMAP password", "err", err)
+		}
+		imapPassword = strings.TrimSpace(string(b))
+	}
+	if checkPath(strings.Trim(*mailInSection, "/")) != nil {
+		fatal("Invalid section for pages from mails", "section", *mailInSection)
+	}
+	goBackground(func() {
+		t := time.NewTicker(*imapInterval)
+		defer t.Stop()
+		for {
+			if err := pollIMAP(); err != nil {
+				slog.Error("Unable to poll the IMAP mailbox", "err", err)
+			}
+			select {
+			case <-stopping:
+				return
+			case <-t.C:
+			}
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mailInTestMail = "From: Alice Example <alice@example.com>\r\n" +
+	"To: wiki@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Training_notes?=\r\n" +
+	"Date: Mon, 6 May 2024 07:08:09 +0200\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/related; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<html><head><style>p {}</style></head><body><p>See <b>this</b>: <img src=3D\"cid:pic1\" alt=3D\"Board\">=\r\n" +
+	"<img src=3D\"https://tracker.example.com/p.gif\"></p></body></html>\r\n" +
+	"--inner\r\n" +
+	"Content-Type: image/png; name=\"board photo.png\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-ID: <pic1>\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"Agenda.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--outer--\r\n"
+
+// mailInTestAuth is the header of the own mail server authenticating the
+// sender of mailInTestMail.
+const mailInTestAuth = "Authentication-Results: mx.example.org;\r\n spf=fail smtp.mailfrom=example.com;\r\n dkim=pass (2048-bit key) header.d=example.com\r\n"
+
+func TestImportMail(t *testing.T) {
+	testSetup(t)
+	imp, from, authenticated, err := importMail([]byte(mailInTestMail), "inbox")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if from.Address != "alice@example.com" || authenticated {
+		t.Errorf("got sender %v (authenticated %t)", from, authenticated)
+	}
+	p := imp.Pages[0]
+	if p.Path != "inbox/training-notes" {
+		t.Errorf("got path %s", p.Path)
+	}
+	if p.FrontMatter["title"] != "Training notes" || p.FrontMatter["draft"] != true || p.FrontMatter["author"] != "Alice Example <alice@example.com>" {
+		t.Errorf("got front matter %v", p.FrontMatter)
+	}
+	if d, _ := p.FrontMatter["date"].(time.Time); !d.Equal(time.Date(2024, 5, 6, 5, 8, 9, 0, time.UTC)) {
+		t.Errorf("got date %v", p.FrontMatter["date"])
+	}
+	base := "/files/inbox/" + strings.TrimPrefix(p.Path, "inbox/")
+	expect := "See **this**: ![Board](" + base + "-board-photo.png)\n\n## Attachments\n\n- [Agenda.pdf](" + base + "-agenda.pdf)\n"
+	if string(p.Body) != expect {
+		t.Errorf("got body %q but expected %q", p.Body, expect)
+	}
+	if len(imp.Files) != 2 || string(imp.Files[0].Data) != "\x89PNG\r\n\x1a\n" || string(imp.Files[1].Data) != "%PDF-1.4\n" {
+		t.Errorf("got files %+v", imp.Files)
+	}
+	if len(imp.Problems) != 1 || !strings.Contains(imp.Problems[0], "remote images") {
+		t.Errorf("got problems %q", imp.Problems)
+	}
+
+	text := "From: bob@example.org\r\nSubject: Plain\r\nContent-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\nGr=FC=DFe\r\n\r\n-- \r\nBob\r\n"
+	imp, _, _, err = importMail([]byte(text), "inbox")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p := imp.Pages[0]; string(p.Body) != "Grüße\n" || p.FrontMatter["author"] != "bob@example.org" || p.Path != "inbox/plain" {
+		t.Errorf("got page %s with body %q and front matter %v", p.Path, p.Body, p.FrontMatter)
+	}
+
+	defer func(s, a string) { *mailInSenders, *mailInAuthServID = s, a }(*mailInSenders, *mailInAuthServID)
+	*mailInSenders, *mailInAuthServID = "carol@example.net, @example.com", "mx.example.org"
+	if _, _, _, err = importMail([]byte(text), "inbox"); err != errMailSender {
+		t.Errorf("expected the sender to be refused but got %v", err)
+	}
+	if _, _, _, err = importMail([]byte(mailInTestMail), "inbox"); err != errMailSender {
+		t.Errorf("expected the unauthenticated sender to be refused but got %v", err)
+	}
+	if _, _, authenticated, err = importMail([]byte(mailInTestAuth+mailInTestMail), "inbox"); err != nil || !authenticated {
+		t.Errorf("expected the domain to be allowed but got %v (authenticated %t)", err, authenticated)
+	}
+}
+
+func TestMailAuthenticated(t *testing.T) {
+	defer func(a string) { *mailInAuthServID = a }(*mailInAuthServID)
+	*mailInAuthServID = "mx.example.org"
+	for i, this := range []struct {
+		header string
+		expect bool
+	}{
+		{"", false},
+		{mailInTestAuth, true},
+		{"Authentication-Results: mx.example.org 1; dmarc=pass header.from=example.com\r\n", true},
+		{"Authentication-Results: mx.example.org; spf=pass smtp.mailfrom=alice@example.com\r\n", true},
+		{"Authentication-Results: MX.example.org; dkim=pass header.i=@example.com\r\n", true},
+		// a forged header of another server
+		{"Authentication-Results: mx.example.net; dkim=pass header.d=example.com\r\n", false},
+		// only the topmost header of the own server counts
+		{"Authentication-Results: mx.example.org; dkim=fail header.d=example.com\r\n" + mailInTestAuth, false},
+		// signed by another domain
+		{"Authentication-Results: mx.example.org; dkim=pass header.d=evil.example\r\n", false},
+		{"Authentication-Results: mx.example.org; dkim=pass header.d=notexample.com\r\n", false},
+		{"Authentication-Results: mx.example.org; spf=pass smtp.mailfrom=example.com.evil\r\n", false},
+		{"Authentication-Results: mx.example.org; none\r\n", false},
+	} {
+		_, _, got, err := importMail([]byte(this.header+mailInTestMail), "inbox")
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+		} else if got != this.expect {
+			t.Errorf("[%d] got %t but expected %t", i, got, this.expect)
+		}
+	}
+	*mailInAuthServID = ""
+	if _, _, got, _ := importMail([]byte(mailInTestAuth+mailInTestMail), "inbox"); got {
+		t.Errorf("expected no authentication without -mail-in-authserv-id")
+	}
+}
+
+func TestMailInHandler(t *testing.T) {
+	testSetup(t)
+	w := httptest.NewRecorder()
+	mailInHandler(w, httptest.NewRequest("POST", MailInPath, strings.NewReader(mailInTestMail)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d without secret", w.Code)
+	}
+	defer func(s string) { mailInSecret = s }(mailInSecret)
+	mailInSecret = "s3cret"
+	for _, sig := range []string{"", webhookSignature("guess", []byte(mailInTestMail))} {
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("POST", MailInPath, strings.NewReader(mailInTestMail))
+		r.Header.Set(WebhookSignatureHeader, sig)
+		mailInHandler(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("got status %d for the signature %q", w.Code, sig)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", MailInPath+"?section=notes", strings.NewReader(mailInTestMail))
+	r.Header.Set("Content-Type", "message/rfc822")
+	r.Header.Set(WebhookSignatureHeader, webhookSignature(mailInSecret, []byte(mailInTestMail)))
+	mailInHandler(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	loc := w.Header().Get("Location")
+	p, err := LoadPage(strings.TrimPrefix(loc[strings.Index(loc, "/view/"):], "/view/"))
+	if err != nil {
+		t.Fatalf("unable to load the page of %s: %s", loc, err)
+	}
+	if !strings.HasPrefix(p.Path, "notes/") || p.FrontMatter["draft"] != true {
+		t.Errorf("got page %s with front matter %v", p.Path, p.FrontMatter)
+	}
+	if b, err := content.ReadFile(attachmentFile("notes", p.Path[len("notes/"):]+"-agenda.pdf")); err != nil || string(b) != "%PDF-1.4\n" {
+		t.Errorf("got attachment %q and error %v", b, err)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", MailInPath, strings.NewReader("no mail"))
+	r.Header.Set(WebhookSignatureHeader, webhookSignature(mailInSecret, []byte("no mail")))
+	mailInHandler(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid mail", w.Code)
+	}
+}
+
+func TestPollIMAP(t *testing.T) {
+	testSetup(t)
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", ts.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	mails := map[string]string{"7": mailInTestAuth + mailInTestMail, "9": "From: mallory@example.org\r\nSubject: Spam\r\n\r\nBuy!\r\n"}
+	var commands []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("* OK IMAP4rev1 ready\r\n"))
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, command, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			commands = append(commands, command)
+			switch {
+			case strings.HasPrefix(command, "UID SEARCH"):
+				conn.Write([]byte("* SEARCH 7 9\r\n"))
+			case strings.HasPrefix(command, "UID FETCH"):
+				uid := strings.Fields(command)[2]
+				m := mails[uid]
+				conn.Write([]byte("* 1 FETCH (UID " + uid + " BODY[] {" + strconv.Itoa(len(m)) + "}\r\n" + m + ")\r\n"))
+			}
+			conn.Write([]byte(tag + " OK done\r\n"))
+			if command == "LOGOUT" {
+				return
+			}
+		}
+	}()
+	defer func(a, u, p, s, as string, c *tls.Config) {
+		*imapAddr, *imapUser, imapPassword, *mailInSenders, *mailInAuthServID, imapTLSConfig = a, u, p, s, as, c
+	}(*imapAddr, *imapUser, imapPassword, *mailInSenders, *mailInAuthServID, imapTLSConfig)
+	*imapAddr, *imapUser, imapPassword, *mailInSenders, *mailInAuthServID = ln.Addr().String(), "wiki", `pa"ss`, "@example.com", "mx.example.org"
+	imapTLSConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+	if err := pollIMAP(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	<-done
+	expect := []string{`LOGIN "wiki" "pa\"ss"`, `SELECT "INBOX"`, "UID SEARCH UNSEEN",
+		"UID FETCH 7 BODY.PEEK[]", `UID STORE 7 +FLAGS.SILENT (\Seen)`,
+		"UID FETCH 9 BODY.PEEK[]", `UID STORE 9 +FLAGS.SILENT (\Seen)`, "LOGOUT"}
+	if strings.Join(commands, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("got commands %q", commands)
+	}
+	var paths []string
+	for _, info := range index.Pages(true) {
+		paths = append(paths, info.Path)
+	}
+	if len(paths) != 1 || !strings.HasPrefix(paths[0], "inbox/") {
+		t.Errorf("got pages %v", paths)
+	}
+}
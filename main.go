@@ -1,14 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/flowdev/gwiki/parser"
@@ -22,14 +25,33 @@ const (
 	DateFormat  = "2006-01-02"
 )
 
-var templates = template.Must(template.ParseFiles(TemplateDir+"edit.html", TemplateDir+"view.html"))
-var validPath = regexp.MustCompile("^/(edit|save|view)/([a-zA-Z0-9/_-]+)$")
+var addr = flag.String("addr", Address, "address the web server listens on (unix:<path> for a unix domain socket)")
+
+var templates = template.Must(parseTemplates(TemplateDir))
+var validPath = regexp.MustCompile(`^/(edit|save|view|diff|rename|attachments|share|bundle)/([a-zA-Z0-9/_-]+(?:\.[a-zA-Z-]+)?)$`)
 
 type Page struct {
 	Path        string                 // from the URL and hints to the file
 	FrontMatter map[string]interface{} // all FrontMatter params
 	Mark        rune                   // mark for front matter format (YAML(-), TOML(+) or JSON({))
 	Body        []byte                 // the content
+	Revision    string                 // hash of the stored file (empty for new pages)
+	Boilerplate string                 // boilerplate a new page is started with
+	viewer      *http.Request          // request the page is shown for (nil for static output)
+}
+
+func NewPage(path string) *Page {
+	return &Page{Path: path, FrontMatter: make(map[string]interface{}), Mark: '+'}
+}
+
+// Copy returns a copy of the page with its own front matter map.
+func (p *Page) Copy() *Page {
+	c := *p
+	c.FrontMatter = make(map[string]interface{}, len(p.FrontMatter))
+	for k, v := range p.FrontMatter {
+		c.FrontMatter[k] = v
+	}
+	return &c
 }
 
 func (p *Page) Title() string {
@@ -50,44 +72,41 @@ func (p *Page) Date() string {
 		if t, ok := v.(time.Time); ok {
 			d = t
 		} else {
-			log.Printf("ERROR: Ill formatted date on page '%s': %#v", p.Path, v)
+			slog.Error("Ill formatted date", "path", p.Path, "date", v)
 		}
 	} else {
-		log.Printf("WARNING: No date on page '%s'.", p.Path)
+		slog.Warn("No date on page", "path", p.Path)
 	}
 	return d.Format(DateFormat)
 }
 func (p *Page) SetDate(d string) {
 	t, err := time.Parse(DateFormat, d)
 	if err != nil {
-		log.Printf("ERROR: Ill formatted date for page '%s': %s", p.Path, d)
+		slog.Error("Ill formatted date", "path", p.Path, "date", d)
 	} else {
 		p.FrontMatter["date"] = t
 	}
 }
 func (p *Page) Tags() []string {
-	if v, ok := p.FrontMatter["tags"]; ok {
-		if s, ok := v.([]string); ok {
-			return s
-		} else if es, ok := v.([]interface{}); ok {
-			ss := make([]string, len(es))
-			for i, e := range es {
-				ss[i] = fmt.Sprintf("%s", e)
-			}
-			return ss
-		} else {
-			return []string{fmt.Sprintf("No_string_slice:%#v", v)}
-		}
-	} else {
-		return nil
-	}
+	return p.Taxonomy("tags")
 }
 func (p *Page) SetTags(t string) {
-	ts := strings.Fields(t)
-	if p.Mark == '+' {
-		p.FrontMatter["tags"] = toInterSlice(ts)
+	p.SetTaxonomy("tags", t)
+}
+func (p *Page) Taxonomy(plural string) []string {
+	return getStrings(p, plural)
+}
+func (p *Page) SetTaxonomy(plural string, t string) {
+	setStrings(p, plural, strings.Fields(t))
+}
+func (p *Page) Aliases() []string {
+	return getStrings(p, "aliases")
+}
+func (p *Page) SetAliases(a string) {
+	if as := strings.Fields(a); len(as) > 0 {
+		setStrings(p, "aliases", as)
 	} else {
-		p.FrontMatter["tags"] = ts
+		delete(p.FrontMatter, "aliases")
 	}
 }
 func (p *Page) Language() string {
@@ -101,17 +120,29 @@ func (p *Page) Draft() bool {
 		if b, ok := v.(bool); ok {
 			return b
 		} else {
-			log.Printf("WARNING: Ill formated draft status '%#v' for page '%s'\n", v, p.Path)
+			slog.Warn("Ill formatted draft status", "path", p.Path, "draft", v)
 			return true
 		}
 	} else {
-		log.Printf("WARNING: Missing draft status. Default is 'true' for page '%s'\n", p.Path)
+		slog.Warn("Missing draft status, default is true", "path", p.Path)
 		return true
 	}
 }
 func (p *Page) SetDraft(d string) {
 	p.FrontMatter["draft"] = strings.EqualFold(d, "on")
 }
+func (p *Page) Site() *SiteConfig {
+	return site
+}
+func (p *Page) Permalink() string {
+	return site.permalink(p)
+}
+func (p *Page) Rendered() template.HTML {
+	if p.Large() {
+		return renderLarge(p)
+	}
+	return renderPage(p)
+}
 func getString(p *Page, key string) string {
 	if v, ok := p.FrontMatter[key]; ok {
 		if s, ok := v.(string); ok {
@@ -123,6 +154,30 @@ func getString(p *Page, key string) string {
 		return ""
 	}
 }
+func getStrings(p *Page, key string) []string {
+	if v, ok := p.FrontMatter[key]; ok {
+		if s, ok := v.([]string); ok {
+			return s
+		} else if es, ok := v.([]interface{}); ok {
+			ss := make([]string, len(es))
+			for i, e := range es {
+				ss[i] = fmt.Sprintf("%s", e)
+			}
+			return ss
+		} else {
+			return []string{fmt.Sprintf("No_string_slice:%#v", v)}
+		}
+	} else {
+		return nil
+	}
+}
+func setStrings(p *Page, key string, ss []string) {
+	if p.Mark == '+' {
+		p.FrontMatter[key] = toInterSlice(ss)
+	} else {
+		p.FrontMatter[key] = ss
+	}
+}
 func toInterSlice(ss []string) []interface{} {
 	is := make([]interface{}, len(ss))
 	for i, s := range ss {
@@ -132,37 +187,74 @@ func toInterSlice(ss []string) []interface{} {
 }
 
 func (p *Page) Save() error {
-	filename := ContentDir + p.Path + Suffix
-	fout, err := os.Create(filename)
-	if err != nil {
-		return errors.New(fmt.Sprintf("unable to open or create page '%s': %s", filename, err))
+	if err := checkPath(p.Path); err != nil {
+		return err
 	}
-	fmBytes, err := parser.InterfaceToFrontMatter(p.FrontMatter, p.Mark)
+	p.Body = normalizeBody(p.Body)
+	b, err := p.Source()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate front matter for page '%s': %s", filename, err))
+		return errors.New(fmt.Sprintf("unable to generate front matter for page '%s': %s", p.Path, err))
 	}
-	_, err = fout.Write(fmBytes)
+	err = store.Save(p.Path, b)
+	cachedPages.Invalidate(p.Path)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to write front matter for page '%s': %s", filename, err))
+		return errors.New(fmt.Sprintf("unable to write page '%s': %s", p.Path, err))
 	}
-	_, err = fout.Write(p.Body)
+	p.Revision = revision(b)
+	return nil
+}
+
+// Source returns the page as stored: front matter and body.
+func (p *Page) Source() ([]byte, error) {
+	fmBytes, err := parser.InterfaceToFrontMatter(p.FrontMatter, p.Mark)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to write content for page '%s': %s", filename, err))
+		return nil, err
 	}
-	return nil
+	var buf bytes.Buffer
+	buf.Write(fmBytes)
+	buf.Write(frontMatterSeparator(p.Body))
+	buf.Write(p.Body)
+	return buf.Bytes(), nil
 }
 
 func LoadPage(path string) (*Page, error) {
-	filename := ContentDir + path + Suffix
-	f, err := os.Open(filename)
+	return loadPage(context.Background(), path)
+}
+
+// loadPage is LoadPage with tracing spans for loading and parsing.
+func loadPage(ctx context.Context, path string) (p *Page, err error) {
+	ctx, sp := startSpan(ctx, "load")
+	sp.SetAttr("page.path", path)
+	defer func() { sp.SetError(err); sp.End() }()
+	if err := checkPath(path); err != nil {
+		return nil, err
+	}
+	if p, ok := cachedPages.Get(path); ok {
+		sp.SetAttr("cache.hit", true)
+		return p, nil
+	}
+	gen := cachedPages.Generation()
+	b, err := store.Load(path)
 	if err != nil {
 		return nil, err
 	}
-	pg, err := parser.ReadFrom(f)
+	_, psp := startSpan(ctx, "parse")
+	defer psp.End()
+	if p, err = parsePage(path, b); err != nil {
+		return nil, err
+	}
+	cachedPages.Add(p, gen)
+
+	return p, nil
+}
+
+// parsePage returns the page at path with the stored source b.
+func parsePage(path string, b []byte) (*Page, error) {
+	pg, err := parser.ReadFrom(bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
-	p := &Page{Path: path, Mark: mark(pg.FrontMatter()), Body: pg.Content()}
+	p := &Page{Path: path, Mark: mark(pg.FrontMatter()), Body: pg.Content(), Revision: revision(b)}
 	md, err := pg.Metadata()
 	if err != nil {
 		return nil, fmt.Errorf("error parsing frontmatter of file '%s': %s", path, err)
@@ -170,9 +262,7 @@ func LoadPage(path string) (*Page, error) {
 	if md == nil {
 		return nil, fmt.Errorf("no frontmatter in file '%s': %s", path, err)
 	}
-	m := md.(map[string]interface{})
-	p.FrontMatter = m
-
+	p.FrontMatter = md.(map[string]interface{})
 	return p, nil
 }
 func mark(fm []byte) rune {
@@ -183,42 +273,121 @@ func mark(fm []byte) rune {
 }
 
 func viewHandler(w http.ResponseWriter, r *http.Request, path string) {
-	p, err := LoadPage(path)
+	p, err := loadPage(r.Context(), path)
 	if err != nil {
-		log.Printf("ERROR: %s\n", err)
+		if isSection(path) {
+			sectionHandler(w, r, path)
+			return
+		}
+		if target, ok := aliases.Lookup(path); ok {
+			http.Redirect(w, r, "/view/"+target, http.StatusMovedPermanently)
+			return
+		}
+		logger(r.Context()).Error("Unable to load page", "path", path, "err", err)
+		if *readOnly {
+			http.NotFound(w, r)
+			return
+		}
 		http.Redirect(w, r, "/edit/"+path, http.StatusFound)
 		return
 	}
-	renderTemplate(w, "view", p)
+	_, sp := startSpan(r.Context(), "render")
+	sp.SetAttr("page.path", path)
+	setCacheHeaders(w, r, p)
+	p = p.For(r)
+	if p.Large() {
+		renderLargeLayout(w, p)
+	} else {
+		renderLayout(w, "view", p.Path, p)
+	}
+	sp.End()
 }
 
 func editHandler(w http.ResponseWriter, r *http.Request, path string) {
-	p, err := LoadPage(path)
+	p, err := loadPage(r.Context(), path)
 	if err != nil {
-		log.Printf("ERROR: While loading the page '%s': %s\n", path, err)
-		p = &Page{Path: path}
+		logger(r.Context()).Info("New page", "path", path, "err", err)
+		p = NewPage(path)
+		if from := r.FormValue("from"); from != "" {
+			p = newTranslation(path, from)
+		} else if err = applyNewPage(p, r.FormValue("boilerplate"), time.Now()); err != nil {
+			logger(r.Context()).Error("Unable to apply boilerplate", "path", path, "err", err)
+		} else {
+			p.Boilerplate = r.FormValue("boilerplate")
+		}
+		applyDefaults(p, cascadeFor(path, nil))
 	}
 	renderTemplate(w, "edit", p)
 }
 
-func saveHandler(w http.ResponseWriter, r *http.Request, path string) {
-	p, err := LoadPage(path)
-	if err != nil {
-		log.Printf("ERROR: Unable to load page '%s': %s\n", path, err)
-		p = &Page{Path: path}
-	}
+// applyForm sets all fields of the edit form on the page.
+func applyForm(p *Page, r *http.Request) {
 	p.Body = []byte(r.FormValue("body"))
 	p.SetDraft(r.FormValue("draft"))
 	p.SetLanguage(r.FormValue("language"))
 	p.SetDate(r.FormValue("date"))
 	p.SetTitle(r.FormValue("title"))
 	p.SetTags(r.FormValue("tags"))
+	for _, plural := range site.TaxonomyNames() {
+		if _, ok := r.Form["taxonomy-"+plural]; ok {
+			p.SetTaxonomy(plural, r.FormValue("taxonomy-"+plural))
+		}
+	}
 	p.SetDescription(r.FormValue("description"))
-	log.Printf("DEBUG: 'Saving' (draft: %t, lang: %s, date: %v, title: %s, tags: %v, desc: %s) body: %s\n",
-		p.FrontMatter["draft"], p.FrontMatter["language"], p.FrontMatter["date"], p.FrontMatter["title"], p.FrontMatter["tags"], p.FrontMatter["description"], p.Body)
-	err = p.Save()
+	p.SetAliases(r.FormValue("aliases"))
+	if tk := r.FormValue("translationKey"); tk != "" {
+		p.FrontMatter["translationKey"] = tk
+	}
+	if s := r.FormValue("status"); s != "" && p.IsADR() {
+		p.FrontMatter["status"] = s
+	}
+	p.SetCustomFields(r.Form)
+}
+
+func saveHandler(w http.ResponseWriter, r *http.Request, path string) {
+	defer lockPage(path)()
+	p, err := loadPage(r.Context(), path)
 	if err != nil {
-		log.Printf("ERROR: %s\n", err)
+		logger(r.Context()).Info("New page", "path", path, "err", err)
+		p = NewPage(path)
+	}
+	old := p.Copy()
+	r.Body = http.MaxBytesReader(w, r.Body, *maxPageSize)
+	if err = r.ParseForm(); err != nil {
+		logger(r.Context()).Error("Unable to read the form", "path", path, "err", err)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if p.Revision == "" {
+		// keeps archetype and boilerplate front matter the form doesn't have
+		if err = applyNewPage(p, r.FormValue("boilerplate"), time.Now()); err != nil {
+			logger(r.Context()).Error("Unable to apply boilerplate", "path", path, "err", err)
+		}
+	}
+	applyForm(p, r)
+	if err = validatePage(old, p); err != nil {
+		logger(r.Context()).Error("Invalid page", "path", path, "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = aliases.Check(p); err != nil {
+		logger(r.Context()).Error("Alias conflict", "path", path, "err", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err = index.CheckID(p); err != nil {
+		logger(r.Context()).Error("ID conflict", "path", path, "err", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	logger(r.Context()).Debug("Saving page", "path", path, "draft", p.FrontMatter["draft"], "language", p.FrontMatter["language"],
+		"date", p.FrontMatter["date"], "title", p.FrontMatter["title"], "tags", p.FrontMatter["tags"], "description", p.FrontMatter["description"], "body", string(p.Body))
+	var re *reviewError
+	if err = storePage(r, p, old, r.FormValue("summary")); errors.As(err, &re) {
+		http.Redirect(w, r, "/reviews?id="+re.review.ID, http.StatusFound)
+		return
+	} else if err != nil {
+		logger(r.Context()).Error("Unable to save page", "path", path, "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -226,10 +395,128 @@ func saveHandler(w http.ResponseWriter, r *http.Request, path string) {
 	http.Redirect(w, r, "/edit/"+path, http.StatusFound)
 }
 
+// validatePage checks p before it replaces old.
+func validatePage(old, p *Page) error {
+	if err := schema.Validate(p); err != nil {
+		return err
+	}
+	return checkADR(old, p)
+}
+
+// checkPage validates p before it replaces old and checks that its aliases
+// and ID don't conflict with those of other pages.
+func checkPage(old, p *Page) error {
+	if err := validatePage(old, p); err != nil {
+		return err
+	}
+	if err := aliases.Check(p); err != nil {
+		return err
+	}
+	return index.CheckID(p)
+}
+
+// pageLocks are the locks of the pages being changed with the number of
+// their users, so unused locks can be dropped.
+var pageLocks = struct {
+	sync.Mutex
+	m map[string]*pageLock
+}{m: make(map[string]*pageLock)}
+
+type pageLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockPage locks the page at path and returns the function unlocking it.
+// Changes that load a page, check it and store it hold the lock of the
+// page from loading to storing, so they can't overwrite each other.
+func lockPage(path string) func() {
+	pageLocks.Lock()
+	l, ok := pageLocks.m[path]
+	if !ok {
+		l = &pageLock{}
+		pageLocks.m[path] = l
+	}
+	l.users++
+	pageLocks.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		pageLocks.Lock()
+		defer pageLocks.Unlock()
+		if l.users--; l.users == 0 {
+			delete(pageLocks.m, path)
+		}
+	}
+}
+
+// storePage saves a validated page and updates everything depending on it.
+// old is the page before the change. Changes needing the approval of an
+// owner are stored as review request instead (see reviewError). All page
+// changes go through storePage or deletePage. Callers checking old hold
+// the lock of the page (see lockPage).
+func storePage(r *http.Request, p, old *Page, summary string) error {
+	if needsApproval(r, p.Path) {
+		rv, err := requestReview(r, p, old, summary)
+		if err != nil {
+			return err
+		}
+		return &reviewError{rv}
+	}
+	ensureID(p)
+	err := p.Save()
+	countSave(err)
+	if err != nil {
+		return err
+	}
+	logger(r.Context()).Info("Saved page", "path", p.Path, "revision", p.Revision)
+	aliases.Update(p)
+	_, sp := startSpan(r.Context(), "index")
+	index.Update(p)
+	sp.End()
+	e := newAuditEntry(r, "save", p.Path)
+	e.Changes = diffFrontMatter(old.FrontMatter, p.FrontMatter)
+	e.Summary = strings.TrimSpace(summary)
+	logAudit(e)
+	purgePages(old, p)
+	if user := currentUser(r); !owners.IsOwner(user, p.Path) {
+		notifyOwners(r, p.Path, "change", "change of "+p.Path, &changeMail{User: user, Path: p.Path, Summary: e.Summary})
+	}
+	markSuperseded(r, p)
+	return nil
+}
+
+// deletePage deletes the page at path or requests a review of the
+// deletion like storePage.
+func deletePage(r *http.Request, path string) error {
+	defer lockPage(path)()
+	if needsApproval(r, path) {
+		old, err := LoadPage(path)
+		if err != nil {
+			return err
+		}
+		rv, err := requestReview(r, nil, old, "")
+		if err != nil {
+			return err
+		}
+		return &reviewError{rv}
+	}
+	old, _ := LoadPage(path)
+	err := store.Delete(path)
+	cachedPages.Invalidate(path)
+	if err != nil {
+		return err
+	}
+	index.Remove(path)
+	purgePages(old)
+	audit(r, "delete", path)
+	return nil
+}
+
 func makeHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		m := validPath.FindStringSubmatch(r.URL.Path)
-		if m == nil {
+		if m == nil || checkPath(m[2]) != nil {
 			http.NotFound(w, r)
 			return
 		}
@@ -237,19 +524,133 @@ func makeHandler(fn func(http.ResponseWriter, *http.Request, string)) http.Handl
 	}
 }
 
-func renderTemplate(w http.ResponseWriter, tmpl string, p *Page) {
-	err := templates.ExecuteTemplate(w, tmpl+".html", p)
+func renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
+	var buf bytes.Buffer
+	err := currentTemplates().ExecuteTemplate(&buf, tmpl+".html", data)
 	if err != nil {
-		log.Printf("ERROR: %s\n", err)
+		slog.Error("Unable to render template", "template", tmpl, "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	w.Write(withCSRFToken(w, buf.Bytes()))
 }
 
 func main() {
+	flag.Parse()
+	initLogging()
+	if *hashPassword {
+		printPasswordHash()
+		return
+	}
+	initTracing()
+	defer stopTracing()
+	initStorage()
+	initPDF()
+	initFrontMatterMarks()
+	initSite()
+	initTheme()
+	initSchema()
+	initAliases()
+	initPageCache()
+	initIndex()
+	initShare()
+	initProxies()
+	initAuth()
+	initOAuth()
+	initMetrics()
+	initDebug()
+	initRateLimits()
+	initTokens()
+	initWebDAV()
+	initUploadPolicies()
+	initWebhooks()
+	initSanitizer()
+	initNotebook()
+	initAccessLog()
+	if *reportLinks {
+		printLinkReport()
+	}
+	if *canonicalPath != "" {
+		printCanonical()
+		return
+	}
+	if *importFrom != "" {
+		runImport()
+		return
+	}
+	if *buildDir != "" {
+		runBuild()
+		return
+	}
+	if *rpcMode {
+		serveRPC()
+		return
+	}
+
 	http.HandleFunc("/view/", makeHandler(viewHandler))
 	http.HandleFunc("/edit/", makeHandler(editHandler))
 	http.HandleFunc("/save/", makeHandler(saveHandler))
+	http.HandleFunc("/diff/", makeHandler(diffHandler))
+	http.HandleFunc("/rename/", makeHandler(renameHandler))
+	http.HandleFunc("/attachments/", makeHandler(attachmentsHandler))
+	http.HandleFunc("/share/", makeHandler(shareHandler))
+	http.HandleFunc("/bundle/", makeHandler(bundleHandler))
+	http.HandleFunc(PDFPath, pdfHandler)
+	http.HandleFunc(EPUBPath, epubHandler)
+	http.HandleFunc(PandocPath, pandocHandler)
+	http.HandleFunc("/shared/", sharedHandler)
+	http.HandleFunc("/id/", idHandler)
+	http.HandleFunc("/files/", fileHandler)
+	http.HandleFunc("/list/", listHandler)
+	http.HandleFunc("/tags/", tagsHandler)
+	http.HandleFunc("/changes", changesHandler)
+	http.HandleFunc("/changes.atom", changesFeedHandler)
+	http.HandleFunc("/events", eventsHandler)
+	http.HandleFunc("/sitemap.xml", sitemapHandler)
+	http.HandleFunc("/activity.atom", activityFeedHandler)
+	http.HandleFunc("/adr", adrHandler)
+	http.HandleFunc("/new", newPageHandler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/readyz", readyzHandler)
+	http.HandleFunc("/reviews", reviewsHandler)
+	http.HandleFunc("/report/links", linkReportHandler)
+	http.HandleFunc("/report/quality", qualityReportHandler)
+	http.HandleFunc("/report/snapshots", snapshotsHandler)
+	http.HandleFunc("/admin/publish", publishHandler)
+	http.HandleFunc("/admin/themes", themesHandler)
+	http.HandleFunc("/admin/backup", backupHandler)
+	http.HandleFunc("/admin/import", importHandler)
+	http.HandleFunc("/admin/mails", mailsHandler)
+	http.HandleFunc("/admin/marks", marksHandler)
+	http.HandleFunc("/admin/tokens", tokensHandler)
+	http.HandleFunc("/api/v1/audit", auditHandler)
+	http.HandleFunc("/api/v1/activity", activityHandler)
+	http.HandleFunc("/api/v1/pages", pagesHandler)
+	http.HandleFunc("/api/v1/tree", treeHandler)
+	http.HandleFunc("/api/v1/graph", graphHandler)
+	http.HandleFunc("/api/v1/batch", batchHandler)
+	http.HandleFunc("/api/v1/export", exportHandler)
+	http.HandleFunc("/api/v1/frontmatter", frontMatterCSVHandler)
+	http.HandleFunc("/api/v1/book", bookHandler)
+	http.HandleFunc("/api/v1/tags", tagSuggestHandler)
+	http.HandleFunc("/api/v1/tags/rename", tagRenameHandler)
+	http.HandleFunc("/api/v1/book/", bookHandler)
+	http.HandleFunc("/api/v1/canonical/", canonicalHandler)
+	http.HandleFunc("/api/v1/openapi.json", openAPIHandler)
+	http.HandleFunc(MicropubPath, micropubHandler)
+	http.HandleFunc(MicropubMediaPath, micropubMediaHandler)
+	http.HandleFunc(GraphQLPath, graphQLHandler)
+	http.HandleFunc(ClipPath, clipHandler)
+	http.HandleFunc(MailInPath, mailInHandler)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
-	log.Printf("INFO: Starting web server on address: '%s'\n", Address)
-	http.ListenAndServe(Address, nil)
+	initPreview()
+	defer stopPreview()
+	initSnapshots()
+	initMailIn()
+	initTLS()
+	initListeners()
+	slog.Info("Starting web server", "addr", *addr)
+	if err := serve(proxyHandler(securityHeadersHandler(requestIDHandler(accessLogHandler(traceHandler(metricsHandler(rateLimitHandler(readOnlyHandler(tokenHandler(authHandler(oauthHandler(aclHandler(adminHandler(csrfHandler(debugHandler(http.DefaultServeMux)))))))))))))))); err != nil {
+		fatal("Unable to run web server", "err", err)
+	}
 }
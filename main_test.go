@@ -0,0 +1,21 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testSetup gives the test empty memory storage, content file system,
+// index and page cache and its own audit log.
+func testSetup(t *testing.T) {
+	s, pi, c, a := store, index, content, *auditFile
+	store = newMemoryStorage()
+	content = newMemFS()
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	cachedPages.Clear()
+	*auditFile = filepath.Join(t.TempDir(), "audit.log")
+	t.Cleanup(func() {
+		store, index, content, *auditFile = s, pi, c, a
+		cachedPages.Clear()
+	})
+}
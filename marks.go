@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// Pages usually start with the front matter delimiter, so mark takes the
+// first byte. Leading blank lines, byte order marks, HTML comments or
+// white space behind the delimiter make that guess (and at worst the front
+// matter) wrong on save, so they are found and repaired at startup or on
+// demand (/admin/marks).
+var frontMatterMarks = flag.String("frontmatter-marks", "", "check the front matter marks of all pages at startup: 'report' or 'repair'")
+
+// MarkIssue is a page whose front matter mark can't be taken from its
+// first byte.
+type MarkIssue struct {
+	Path     string `json:"path"`
+	Mark     string `json:"mark,omitempty"` // found mark
+	Problem  string `json:"problem"`
+	Repaired bool   `json:"repaired"`
+}
+
+// findMark returns the mark of the front matter of the raw page b and the
+// offset of its opening delimiter line; leading BOMs, white space and HTML
+// comment lines are skipped. comment reports whether such a comment was
+// skipped.
+func findMark(b []byte) (mark rune, offset int, comment bool, err error) {
+	i := 0
+	for i < len(b) {
+		r, n := utf8.DecodeRune(b[i:])
+		switch {
+		case r == parser.BOM || unicode.IsSpace(r):
+			i += n
+		case bytes.HasPrefix(b[i:], []byte(parser.HTMLCommentStart)):
+			end := bytes.IndexByte(b[i:], '\n')
+			if end < 0 {
+				return 0, 0, false, fmt.Errorf("no front matter behind the comment")
+			}
+			i += end + 1
+			comment = true
+		default:
+			line := b[i:]
+			if end := bytes.IndexByte(line, '\n'); end >= 0 {
+				line = line[:end]
+			}
+			switch string(bytes.TrimRight(line, " \t\r")) {
+			case parser.TOMLDelim:
+				return '+', i, comment, nil
+			case parser.YAMLDelim:
+				return '-', i, comment, nil
+			}
+			if line[0] == parser.JSONLead[0] {
+				return '{', i, comment, nil
+			}
+			return 0, 0, false, fmt.Errorf("no front matter delimiter")
+		}
+	}
+	return 0, 0, false, fmt.Errorf("empty page")
+}
+
+// checkMark returns the issue of the raw page b at path (nil if there is
+// none) and the repaired page if it can be repaired: the opening
+// delimiter moves to the start and loses trailing white space. Comments
+// in front of it are left for a human.
+func checkMark(path string, b []byte) (*MarkIssue, []byte) {
+	m, offset, comment, err := findMark(b)
+	if err != nil {
+		return &MarkIssue{Path: path, Problem: err.Error()}, nil
+	}
+	mi := &MarkIssue{Path: path, Mark: string(m)}
+	line := b[offset:]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	delim := bytes.TrimRight(line, " \t\r")
+	switch {
+	case comment:
+		mi.Problem = "comment in front of the front matter"
+		return mi, nil
+	case offset > 0:
+		mi.Problem = "blank lines or byte order mark in front of the front matter"
+	case m != '{' && len(line) > len(delim) && !bytes.Equal(line[len(delim):], []byte("\r")):
+		mi.Problem = "white space behind the front matter delimiter"
+	default:
+		return nil, nil
+	}
+	var fixed []byte
+	if m == '{' {
+		fixed = append(fixed, b[offset:]...)
+	} else {
+		fixed = append(append(fixed, delim...), b[offset+len(line):]...)
+	}
+	pg, err := parser.ReadFrom(bytes.NewReader(fixed))
+	if err != nil || len(pg.FrontMatter()) == 0 || rune(pg.FrontMatter()[0]) != m {
+		mi.Problem += " (unable to repair)"
+		return mi, nil
+	}
+	return mi, fixed
+}
+
+// checkMarks checks all pages and repairs them if repair is set.
+func checkMarks(repair bool) ([]*MarkIssue, error) {
+	ps, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	mis := []*MarkIssue{}
+	for _, path := range ps {
+		b, err := store.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read page '%s': %s", path, err)
+		}
+		mi, fixed := checkMark(path, b)
+		if mi == nil {
+			continue
+		}
+		if repair && fixed != nil {
+			if err = store.Save(path, fixed); err != nil {
+				return nil, fmt.Errorf("unable to repair page '%s': %s", path, err)
+			}
+			cachedPages.Invalidate(path)
+			if p, err := LoadPage(path); err == nil {
+				index.Update(p)
+				purgePages(p)
+			}
+			mi.Repaired = true
+		}
+		mis = append(mis, mi)
+	}
+	return mis, nil
+}
+
+func initFrontMatterMarks() {
+	switch *frontMatterMarks {
+	case "":
+		return
+	case "report":
+	case "repair":
+		if *readOnly {
+			fatal("Front matter marks can't be repaired in read-only mode")
+		}
+	default:
+		fatal("Unknown front matter mark check", "frontmatter-marks", *frontMatterMarks)
+	}
+	mis, err := checkMarks(*frontMatterMarks == "repair")
+	if err != nil {
+		fatal("Unable to check front matter marks", "err", err)
+	}
+	for _, mi := range mis {
+		if mi.Repaired {
+			slog.Info("Repaired front matter mark", "path", mi.Path, "problem", mi.Problem)
+		} else {
+			slog.Warn("Front matter mark can't be determined", "path", mi.Path, "problem", mi.Problem)
+		}
+	}
+}
+
+// marksHandler reports the pages with front matter mark issues (GET
+// /admin/marks) or repairs them (POST).
+func marksHandler(w http.ResponseWriter, r *http.Request) {
+	repair := r.Method == http.MethodPost
+	mis, err := checkMarks(repair)
+	if err != nil {
+		logger(r.Context()).Error("Unable to check front matter marks", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, mi := range mis {
+		if !mi.Repaired {
+			continue
+		}
+		audit(r, "repair-mark", mi.Path)
+		cachedPages.Invalidate(mi.Path)
+		if p, err := loadPage(r.Context(), mi.Path); err == nil {
+			index.Update(p)
+		}
+	}
+	writeJSON(w, map[string]interface{}{"issues": mis})
+}
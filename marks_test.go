@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckMark(t *testing.T) {
+	for i, this := range []struct {
+		src         string
+		expectIssue bool
+		expectFixed string
+	}{
+		{"+++\ntitle = \"A\"\n+++\nText\n", false, ""},
+		{"---\r\ntitle: A\r\n---\r\nText\r\n", false, ""},
+		{"{\"title\": \"A\"}\nText\n", false, ""},
+		{"\n\n---\ntitle: A\n---\nText\n", true, "---\ntitle: A\n---\nText\n"},
+		{"\ufeff+++\ntitle = \"A\"\n+++\nText\n", true, "+++\ntitle = \"A\"\n+++\nText\n"},
+		{"---    \ntitle: A\n---\nText\n", true, "---\ntitle: A\n---\nText\n"},
+		{"<!-- generated -->\n---\ntitle: A\n---\nText\n", true, ""},
+		{"Just text\n", true, ""},
+		{"", true, ""},
+	} {
+		mi, fixed := checkMark("p", []byte(this.src))
+		if (mi != nil) != this.expectIssue {
+			t.Errorf("[%d] got issue %+v but expected one: %t", i, mi, this.expectIssue)
+		}
+		if string(fixed) != this.expectFixed {
+			t.Errorf("[%d] got %q but expected %q", i, fixed, this.expectFixed)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A MediaWiki XML export (Special:Export or dumpBackup.php) is imported
+// with the pages of the main namespace converted to Markdown. Redirects
+// become aliases and categories tags. Files aren't part of the export, so
+// only their links are converted; templates are kept as text.
+
+// Namespaces with a special meaning in links. Their (localized) names are
+// in the export.
+const (
+	mwMediaNS    = -2
+	mwMainNS     = 0
+	mwFileNS     = 6
+	mwCategoryNS = 14
+)
+
+type mwPage struct {
+	Title    string `xml:"title"`
+	NS       int    `xml:"ns"`
+	Redirect *struct {
+		Title string `xml:"title,attr"`
+	} `xml:"redirect"`
+	Revisions []mwRevision `xml:"revision"`
+}
+
+type mwRevision struct {
+	Timestamp   string `xml:"timestamp"`
+	Contributor struct {
+		Username string `xml:"username"`
+		IP       string `xml:"ip"`
+	} `xml:"contributor"`
+	Text string `xml:"text"`
+}
+
+// importMediaWiki converts the pages of the MediaWiki XML export fn to
+// pages below section.
+func importMediaWiki(fn, section string) (*Import, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ns := map[string]int{"media": mwMediaNS, "file": mwFileNS, "image": mwFileNS, "category": mwCategoryNS}
+	var pages []*mwPage
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid MediaWiki export: %s", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "namespace":
+			var n struct {
+				Key  int    `xml:"key,attr"`
+				Name string `xml:",chardata"`
+			}
+			if err := d.DecodeElement(&n, &se); err != nil {
+				return nil, fmt.Errorf("invalid MediaWiki export: %s", err)
+			}
+			if n.Name != "" {
+				ns[strings.ToLower(n.Name)] = n.Key
+			}
+		case "page":
+			var p mwPage
+			if err := d.DecodeElement(&p, &se); err != nil {
+				return nil, fmt.Errorf("invalid MediaWiki export: %s", err)
+			}
+			pages = append(pages, &p)
+		}
+	}
+
+	imp := &Import{}
+	skipped := make(map[int]int)
+	redirects := make(map[string][]interface{}) // target page path -> alias paths
+	taken := make(map[string]bool)
+	var ps []*Page
+	for _, mp := range pages {
+		switch {
+		case mp.NS != mwMainNS:
+			skipped[mp.NS]++
+		case len(mp.Revisions) == 0:
+			imp.problem("page '%s' has no revisions", mp.Title)
+		case mp.Redirect != nil:
+			target, _, _ := strings.Cut(mp.Redirect.Title, "#")
+			redirects[mwPath(section, target)] = append(redirects[mwPath(section, target)], mwPath(section, mp.Title))
+		default:
+			p := NewPage(uniqueName(taken, mwPath(section, mp.Title)))
+			if !isValidPath(p.Path) {
+				imp.problem("page '%s' has the invalid path '%s'", mp.Title, p.Path)
+				continue
+			}
+			first, last := mp.Revisions[0], mp.Revisions[len(mp.Revisions)-1]
+			wt := &wikitext{imp: imp, title: mp.Title, section: section, ns: ns, files: make(map[string]bool)}
+			p.Body = []byte(wt.convert(last.Text))
+			p.FrontMatter["title"] = strings.ReplaceAll(mp.Title, "_", " ")
+			p.FrontMatter["date"] = first.Timestamp
+			if last.Timestamp != first.Timestamp {
+				p.FrontMatter["lastmod"] = last.Timestamp
+			}
+			var contributors []interface{}
+			seen := make(map[string]bool)
+			for _, rev := range mp.Revisions {
+				c := rev.Contributor.Username
+				if c == "" {
+					c = rev.Contributor.IP
+				}
+				if c != "" && !seen[c] {
+					seen[c] = true
+					contributors = append(contributors, c)
+				}
+			}
+			if contributors != nil {
+				p.FrontMatter["contributors"] = contributors
+			}
+			if wt.categories != nil {
+				p.FrontMatter["tags"] = wt.categories
+			}
+			ps = append(ps, p)
+		}
+	}
+	for _, p := range ps {
+		if as := redirects[p.Path]; as != nil {
+			p.FrontMatter["aliases"] = as
+			delete(redirects, p.Path)
+		}
+	}
+	var targets []string
+	for target := range redirects {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		for _, a := range redirects[target] {
+			imp.problem("redirect '%s' to the missing page '%s' is dropped", a, target)
+		}
+	}
+	var nss []int
+	for n := range skipped {
+		nss = append(nss, n)
+	}
+	sort.Ints(nss)
+	for _, n := range nss {
+		imp.problem("%d pages of namespace %d aren't imported", skipped[n], n)
+	}
+	imp.Pages = ps
+	return imp, nil
+}
+
+// mwPath returns the page path of the page with title below section.
+func mwPath(section, title string) string {
+	segs := []string{section}
+	for _, s := range strings.Split(strings.Trim(title, "/"), "/") {
+		if s = slugify(s); s == "" {
+			s = "page"
+		}
+		segs = append(segs, s)
+	}
+	return path.Join(segs...)
+}
+
+var (
+	mwPre         = regexp.MustCompile(`(?s)<(pre|syntaxhighlight|source)([^>]*)>(.*?)</(?:pre|syntaxhighlight|source)>`)
+	mwLang        = regexp.MustCompile(`lang="?([a-zA-Z0-9_+-]+)`)
+	mwNowiki      = regexp.MustCompile(`(?s)<nowiki>(.*?)</nowiki>|<code>(.*?)</code>`)
+	mwRef         = regexp.MustCompile(`(?s)<ref(?:\s+name="?([^">/]+)"?)?\s*(?:/>|>(.*?)</ref>)`)
+	mwReferences  = regexp.MustCompile(`<references\s*/>|<references>\s*</references>`)
+	mwMagic       = regexp.MustCompile(`__[A-Z]+__`)
+	mwTemplate    = regexp.MustCompile(`\{\{\s*([^{}|\n]+?)\s*[|}]`)
+	mwHeading     = regexp.MustCompile(`^(={1,6})\s*(.+?)\s*={1,6}\s*$`)
+	mwList        = regexp.MustCompile(`^([*#:;]+)\s*(.*)$`)
+	mwInternal    = regexp.MustCompile(`\[\[([^\[\]]*)\]\]([a-z]*)`)
+	mwExternal    = regexp.MustCompile(`\[((?:https?|ftp)://[^\s\]]+|mailto:[^\s\]]+)(?:\s+([^\]]*))?\]`)
+	mwBoldItalic  = regexp.MustCompile(`'''''(.+?)'''''`)
+	mwBold        = regexp.MustCompile(`'''(.+?)'''`)
+	mwItalic      = regexp.MustCompile(`''(.+?)''`)
+	mwBreak       = regexp.MustCompile(`<br\s*/?>`)
+	mwStrike      = regexp.MustCompile(`<(?:s|del|strike)>(.*?)</(?:s|del|strike)>`)
+	mwCellSep     = regexp.MustCompile(`!!|\|\|`)
+	mwPlaceholder = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// mwImageOptions are the options of file links that aren't the caption.
+var mwImageOptions = regexp.MustCompile(`^(thumb|thumbnail|frame|frameless|border|left|right|center|centre|none|upright.*|\d*x?\d+px|(alt|link|page|class|lang)=.*)$`)
+
+// wikitext converts the wikitext of a page to Markdown.
+type wikitext struct {
+	imp        *Import
+	title      string // of the page for problems
+	section    string
+	ns         map[string]int
+	categories []interface{}
+	files      map[string]bool // reported missing files
+	protected  []string        // code and nowiki text by placeholder
+	notes      []string        // footnotes
+	noteNames  map[string]int  // footnote numbers by reference name
+	inTable    bool
+}
+
+// protect returns a placeholder for the text s that isn't converted.
+func (wt *wikitext) protect(s string) string {
+	wt.protected = append(wt.protected, s)
+	return fmt.Sprintf("\x00%d\x00", len(wt.protected)-1)
+}
+
+// convert returns the wikitext s as Markdown.
+func (wt *wikitext) convert(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = mwPre.ReplaceAllStringFunc(s, func(m string) string {
+		sm := mwPre.FindStringSubmatch(m)
+		lang := ""
+		if l := mwLang.FindStringSubmatch(sm[2]); l != nil {
+			lang = l[1]
+		}
+		return "\n" + wt.protect("```"+lang+"\n"+strings.Trim(sm[3], "\n")+"\n```") + "\n"
+	})
+	s = mwNowiki.ReplaceAllStringFunc(s, func(m string) string {
+		sm := mwNowiki.FindStringSubmatch(m)
+		if strings.HasPrefix(m, "<code>") {
+			return wt.protect("`" + sm[2] + "`")
+		}
+		return wt.protect(sm[1])
+	})
+	reported := make(map[string]bool)
+	for _, m := range mwTemplate.FindAllStringSubmatch(s, -1) {
+		if !reported[m[1]] {
+			reported[m[1]] = true
+			wt.imp.problem("template '%s' in '%s' is kept as text", m[1], wt.title)
+		}
+	}
+	s = mwRef.ReplaceAllStringFunc(s, wt.footnote)
+	s = mwReferences.ReplaceAllString(s, "")
+	s = mwMagic.ReplaceAllString(s, "")
+
+	var out []string
+	var pre, table []string
+	flushPre := func() {
+		if pre != nil {
+			out = append(out, "```", strings.Join(pre, "\n"), "```")
+			pre = nil
+		}
+	}
+	for _, line := range strings.Split(s, "\n") {
+		switch {
+		case wt.inTable:
+			if strings.HasPrefix(strings.TrimSpace(line), "|}") {
+				out = append(out, wt.table(table)...)
+				wt.inTable, table = false, nil
+				continue
+			}
+			table = append(table, line)
+			continue
+		case strings.HasPrefix(strings.TrimSpace(line), "{|"):
+			flushPre()
+			wt.inTable = true
+			continue
+		case strings.HasPrefix(line, " ") && strings.TrimSpace(line) != "":
+			pre = append(pre, line[1:])
+			continue
+		}
+		flushPre()
+		out = append(out, wt.block(line))
+	}
+	flushPre()
+	if wt.inTable {
+		out = append(out, wt.table(table)...)
+	}
+	md := strings.TrimSpace(strings.Join(out, "\n"))
+	for i, n := range wt.notes {
+		if i == 0 {
+			md += "\n"
+		}
+		md += fmt.Sprintf("\n[^%d]: %s", i+1, wt.inline(n))
+	}
+	for mwPlaceholder.MatchString(md) {
+		md = mwPlaceholder.ReplaceAllStringFunc(md, func(m string) string {
+			var i int
+			fmt.Sscanf(strings.Trim(m, "\x00"), "%d", &i)
+			return wt.protected[i]
+		})
+	}
+	return md + "\n"
+}
+
+// footnote replaces a reference by a footnote.
+func (wt *wikitext) footnote(m string) string {
+	sm := mwRef.FindStringSubmatch(m)
+	name, text := strings.TrimSpace(sm[1]), strings.TrimSpace(sm[2])
+	if wt.noteNames == nil {
+		wt.noteNames = make(map[string]int)
+	}
+	if i, ok := wt.noteNames[name]; ok && name != "" {
+		if text != "" && wt.notes[i-1] == "" {
+			wt.notes[i-1] = text
+		}
+		return fmt.Sprintf("[^%d]", i)
+	}
+	wt.notes = append(wt.notes, text)
+	if name != "" {
+		wt.noteNames[name] = len(wt.notes)
+	}
+	return fmt.Sprintf("[^%d]", len(wt.notes))
+}
+
+// block converts a line outside of tables and preformatted text.
+func (wt *wikitext) block(line string) string {
+	if m := mwHeading.FindStringSubmatch(line); m != nil {
+		return strings.Repeat("#", len(m[1])) + " " + wt.inline(m[2])
+	}
+	if strings.HasPrefix(line, "----") {
+		return "\n---"
+	}
+	m := mwList.FindStringSubmatch(line)
+	if m == nil {
+		return wt.inline(line)
+	}
+	marks, text := m[1], wt.inline(m[2])
+	indent := ""
+	for _, c := range marks[:len(marks)-1] {
+		switch c {
+		case '*':
+			indent += "  "
+		case '#':
+			indent += "   "
+		}
+	}
+	switch marks[len(marks)-1] {
+	case '*':
+		return indent + "- " + text
+	case '#':
+		return indent + "1. " + text
+	case ';':
+		if term, def, ok := strings.Cut(text, " : "); ok {
+			return "\n" + term + "\n: " + def
+		}
+		return "\n" + text
+	}
+	if marks == ":" || strings.HasPrefix(marks, ";") {
+		return ": " + text
+	}
+	return indent + "  " + text
+}
+
+// table converts the lines of a table (without its delimiters).
+func (wt *wikitext) table(lines []string) []string {
+	var rows [][]string
+	var row []string
+	header, caption := false, ""
+	for _, line := range lines {
+		l := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(l, "|+"):
+			caption = wt.cell(l[2:])
+		case strings.HasPrefix(l, "|-"):
+			if row != nil {
+				rows = append(rows, row)
+			}
+			row = nil
+		case strings.HasPrefix(l, "!"):
+			header = header || len(rows) == 0
+			for _, c := range mwCellSep.Split(l[1:], -1) {
+				row = append(row, wt.cell(c))
+			}
+		case strings.HasPrefix(l, "|"):
+			for _, c := range strings.Split(l[1:], "||") {
+				row = append(row, wt.cell(c))
+			}
+		case len(row) > 0:
+			row[len(row)-1] += " " + wt.cell(l)
+		}
+	}
+	if row != nil {
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	cols := 0
+	for _, r := range rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	out := []string{""}
+	if caption != "" {
+		out = append(out, "**"+caption+"**", "")
+	}
+	if !header {
+		rows = append([][]string{make([]string, cols)}, rows...)
+	}
+	for i, r := range rows {
+		for len(r) < cols {
+			r = append(r, "")
+		}
+		out = append(out, "| "+strings.Join(r, " | ")+" |")
+		if i == 0 {
+			out = append(out, strings.TrimSuffix(strings.Repeat("| --- ", cols), " ")+" |")
+		}
+	}
+	return append(out, "")
+}
+
+// cell returns the content of a table cell without its attributes.
+func (wt *wikitext) cell(c string) string {
+	if i := strings.Index(c, "|"); i >= 0 && !strings.Contains(c[:i], "[[") && strings.Contains(c[:i], "=") {
+		attrs := c[:i]
+		if strings.Contains(attrs, "rowspan") || strings.Contains(attrs, "colspan") {
+			wt.imp.problem("table cells spanning rows or columns in '%s' aren't spanned", wt.title)
+		}
+		c = c[i+1:]
+	}
+	return strings.ReplaceAll(wt.inline(strings.TrimSpace(c)), "|", `\|`)
+}
+
+// inline converts links and formatting.
+func (wt *wikitext) inline(s string) string {
+	for i := 0; i < 3 && strings.Contains(s, "[["); i++ {
+		s = mwInternal.ReplaceAllStringFunc(s, wt.link)
+	}
+	s = mwExternal.ReplaceAllStringFunc(s, func(m string) string {
+		sm := mwExternal.FindStringSubmatch(m)
+		if sm[2] == "" {
+			return "<" + sm[1] + ">"
+		}
+		return "[" + sm[2] + "](" + sm[1] + ")"
+	})
+	s = mwBoldItalic.ReplaceAllString(s, "***$1***")
+	s = mwBold.ReplaceAllString(s, "**$1**")
+	s = mwItalic.ReplaceAllString(s, "*$1*")
+	s = mwStrike.ReplaceAllString(s, "~~$1~~")
+	if wt.inTable {
+		return mwBreak.ReplaceAllString(s, " ")
+	}
+	return mwBreak.ReplaceAllString(s, "\\\n")
+}
+
+// link converts an internal link [[target|label]]suffix.
+func (wt *wikitext) link(m string) string {
+	sm := mwInternal.FindStringSubmatch(m)
+	parts := strings.Split(sm[1], "|")
+	target := strings.TrimSpace(parts[0])
+	colon := strings.HasPrefix(target, ":")
+	target = strings.TrimPrefix(target, ":")
+	label := strings.Join(parts[1:], "|")
+	if label == "" {
+		label = target
+	}
+	label += sm[2]
+	prefix, rest, hasNS := strings.Cut(target, ":")
+	ns, known := wt.ns[strings.ToLower(strings.TrimSpace(prefix))]
+	switch {
+	case hasNS && known && ns == mwCategoryNS && !colon:
+		wt.categories = append(wt.categories, strings.TrimSpace(rest))
+		return ""
+	case hasNS && known && (ns == mwFileNS || ns == mwMediaNS) && !colon:
+		return wt.file(strings.TrimSpace(rest), parts[1:], ns == mwMediaNS)
+	case hasNS && known:
+		if label == target+sm[2] {
+			label = strings.TrimSpace(rest) + sm[2]
+		}
+		return label
+	}
+	page, anchor, _ := strings.Cut(target, "#")
+	u := "/view/" + mwPath(wt.section, page)
+	if page == "" {
+		u = ""
+	}
+	if anchor != "" {
+		u += "#" + slugify(anchor)
+	}
+	return "[" + strings.ReplaceAll(label, "_", " ") + "](" + u + ")"
+}
+
+// file converts a link to (or an embedding of) a file.
+func (wt *wikitext) file(name string, params []string, media bool) string {
+	ext := strings.ToLower(path.Ext(name))
+	base := slugify(strings.TrimSuffix(name, path.Ext(name)))
+	u := "/files/" + path.Join(wt.section, base+ext)
+	if !wt.files[name] {
+		wt.files[name] = true
+		wt.imp.problem("file '%s' of '%s' isn't part of the export, copy it to '%s'", name, wt.title, strings.TrimPrefix(u, "/files/"))
+	}
+	caption := ""
+	for _, p := range params {
+		if p = strings.TrimSpace(p); p != "" && !mwImageOptions.MatchString(p) {
+			caption = p
+		}
+	}
+	if media || !imageExtensions[ext] {
+		if caption == "" {
+			caption = name
+		}
+		return "[" + caption + "](" + u + ")"
+	}
+	return "![" + caption + "](" + u + ")"
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWikitext(t *testing.T) {
+	ns := map[string]int{"file": mwFileNS, "category": mwCategoryNS, "kategorie": mwCategoryNS, "user": 2}
+	for i, this := range []struct {
+		wikitext   string
+		expect     string
+		categories []interface{}
+	}{
+		{"== Intro ==\nSome '''bold''', ''italic'' and '''''both'''''.", "## Intro\nSome **bold**, *italic* and ***both***.\n", nil},
+		{"See [[Main Page]], [[Other page|the other]]s and [[Guide/Setup#First steps]].",
+			"See [Main Page](/view/wiki/main-page), [the others](/view/wiki/other-page) and [Guide/Setup#First steps](/view/wiki/guide/setup#first-steps).\n", nil},
+		{"[[#Top|up]] [http://example.com Example] [https://example.org]",
+			"[up](#top) [Example](http://example.com) <https://example.org>\n", nil},
+		{"* a\n** b\n# one\n## two", "- a\n  - b\n1. one\n   1. two\n", nil},
+		{"; Term : Definition", "Term\n: Definition\n", nil},
+		{"Text [[Category:Go]][[Kategorie:Web|sort]] [[:Category:Go]] [[User:Bob|Bob]]", "Text  Go Bob\n", []interface{}{"Go", "Web"}},
+		{"[[File:Arch Diagram.png|thumb|200px|The architecture]] [[File:spec.pdf]]",
+			"![The architecture](/files/wiki/arch-diagram.png) [spec.pdf](/files/wiki/spec.pdf)\n", nil},
+		{"<code>[[x]]</code> <nowiki>''raw''</nowiki>", "`[[x]]` ''raw''\n", nil},
+		{"<syntaxhighlight lang=\"go\">\nfunc f() {}\n</syntaxhighlight>", "```go\nfunc f() {}\n```\n", nil},
+		{"Para\n preformatted\n  more\nEnd", "Para\n```\npreformatted\n more\n```\nEnd\n", nil},
+		{"Fact.<ref name=\"a\">Source A</ref> Again.<ref name=\"a\" /> Other.<ref>B</ref>\n<references />",
+			"Fact.[^1] Again.[^1] Other.[^2]\n\n[^1]: Source A\n[^2]: B\n", nil},
+		{"{| class=\"wikitable\"\n|+ Caption\n! A !! B\n|-\n| 1 || style=\"x\" | 2\n|-\n| a<br>b || c\n|}",
+			"**Caption**\n\n| A | B |\n| --- | --- |\n| 1 | 2 |\n| a b | c |\n", nil},
+		{"__TOC__\nline<br/>break <s>gone</s>\n----\nx", "line\\\nbreak ~~gone~~\n\n---\nx\n", nil},
+	} {
+		wt := &wikitext{imp: &Import{}, title: "T", section: "wiki", ns: ns, files: make(map[string]bool)}
+		if got := wt.convert(this.wikitext); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+		if !reflect.DeepEqual(wt.categories, this.categories) {
+			t.Errorf("[%d] got categories %v but expected %v", i, wt.categories, this.categories)
+		}
+	}
+}
+
+const mwTestExport = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/">
+  <siteinfo>
+    <namespaces>
+      <namespace key="0" case="first-letter" />
+      <namespace key="1" case="first-letter">Talk</namespace>
+      <namespace key="14" case="first-letter">Kategorie</namespace>
+    </namespaces>
+  </siteinfo>
+  <page>
+    <title>Main Page</title>
+    <ns>0</ns>
+    <revision>
+      <timestamp>2020-01-02T03:04:05Z</timestamp>
+      <contributor><username>Alice</username></contributor>
+      <text xml:space="preserve">old</text>
+    </revision>
+    <revision>
+      <timestamp>2021-01-02T03:04:05Z</timestamp>
+      <contributor><ip>192.0.2.1</ip></contributor>
+      <text xml:space="preserve">Hello {{Welcome|x}} [[Kategorie:Start]]</text>
+    </revision>
+  </page>
+  <page>
+    <title>Home</title>
+    <ns>0</ns>
+    <redirect title="Main Page" />
+    <revision><timestamp>2020-01-02T03:04:05Z</timestamp><text>#REDIRECT [[Main Page]]</text></revision>
+  </page>
+  <page>
+    <title>Gone</title>
+    <ns>0</ns>
+    <redirect title="Nowhere" />
+    <revision><timestamp>2020-01-02T03:04:05Z</timestamp><text>#REDIRECT [[Nowhere]]</text></revision>
+  </page>
+  <page>
+    <title>Talk:Main Page</title>
+    <ns>1</ns>
+    <revision><timestamp>2020-01-02T03:04:05Z</timestamp><text>talk</text></revision>
+  </page>
+</mediawiki>
+`
+
+func TestImportMediaWiki(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "export.xml")
+	if err := os.WriteFile(fn, []byte(mwTestExport), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imp, err := importMediaWiki(fn, "wiki")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(imp.Pages) != 1 {
+		t.Fatalf("got %d pages but expected 1", len(imp.Pages))
+	}
+	p := imp.Pages[0]
+	expect := map[string]interface{}{"title": "Main Page", "date": "2020-01-02T03:04:05Z", "lastmod": "2021-01-02T03:04:05Z",
+		"contributors": []interface{}{"Alice", "192.0.2.1"}, "tags": []interface{}{"Start"}, "aliases": []interface{}{"wiki/home"}}
+	if p.Path != "wiki/main-page" || !reflect.DeepEqual(p.FrontMatter, expect) || string(p.Body) != "Hello {{Welcome|x}}\n" {
+		t.Errorf("got page %s with %v and body %q", p.Path, p.FrontMatter, p.Body)
+	}
+	problems := strings.Join(imp.Problems, "\n")
+	for _, p := range []string{"template 'Welcome'", "redirect 'wiki/gone' to the missing page 'wiki/nowhere'", "1 pages of namespace 1"} {
+		if !strings.Contains(problems, p) {
+			t.Errorf("problem %q wasn't reported in %q", p, problems)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// opener is implemented by storages that can stream a page, so reading
+// the front matter doesn't need the whole file.
+type opener interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// LoadMeta loads only the front matter of the page at path. The body of
+// the returned page is empty, so it must not be saved.
+func LoadMeta(path string) (*Page, error) {
+	if p, ok := cachedPages.Get(path); ok {
+		return p, nil
+	}
+	var pg parser.Page
+	if o, ok := store.(opener); ok {
+		f, err := o.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if pg, err = parser.ReadFrontMatter(f); err != nil {
+			return nil, err
+		}
+	} else {
+		b, err := store.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if pg, err = parser.ReadFrontMatter(bytes.NewReader(b)); err != nil {
+			return nil, err
+		}
+	}
+	md, err := pg.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing frontmatter of file '%s': %s", path, err)
+	}
+	if md == nil {
+		return nil, fmt.Errorf("no frontmatter in file '%s'", path)
+	}
+	return &Page{Path: path, Mark: mark(pg.FrontMatter()), FrontMatter: md.(map[string]interface{})}, nil
+}
+
+// loadMetas loads the front matter of all pages at paths in parallel.
+// Pages that can't be loaded are logged and left out; the order is kept.
+func loadMetas(paths []string) []*Page {
+	ps := make([]*Page, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				p, err := LoadMeta(paths[i])
+				if err != nil {
+					slog.Warn("Unable to load page", "path", paths[i], "err", err)
+					continue
+				}
+				ps[i] = p
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	loaded := ps[:0]
+	for _, p := range ps {
+		if p != nil {
+			loaded = append(loaded, p)
+		}
+	}
+	return loaded
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics are served at /metrics in the Prometheus text format. Like the
+// tracing they are written without a client library.
+var metricsEnabled = flag.Bool("metrics", true, "serve Prometheus metrics at /metrics")
+
+// DurationBuckets are the upper bounds of the request duration histogram.
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	handler, method, code string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(DurationBuckets, v)
+	if i < len(DurationBuckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+var metrics = struct {
+	sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram // per handler
+}{requests: make(map[requestKey]uint64), durations: make(map[string]*histogram)}
+
+var (
+	pageSaves       uint64
+	pageSaveErrors  uint64
+	pageCacheHits   uint64
+	pageCacheMisses uint64
+)
+
+// countSave counts a save of a page and its failure.
+func countSave(err error) {
+	atomic.AddUint64(&pageSaves, 1)
+	if err != nil {
+		atomic.AddUint64(&pageSaveErrors, 1)
+	}
+}
+
+// handlerLabel returns the registered pattern handling r, so the number of
+// label values is bounded.
+func handlerLabel(r *http.Request) string {
+	if _, pattern := http.DefaultServeMux.Handler(r); pattern != "" {
+		return pattern
+	}
+	return "none"
+}
+
+// methodLabel returns the method of r or "other" for unknown ones.
+func methodLabel(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return r.Method
+	}
+	return "other"
+}
+
+// metricsHandler wraps h to count requests and their durations.
+func metricsHandler(h http.Handler) http.Handler {
+	if !*metricsEnabled {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler := handlerLabel(r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		d := time.Since(start).Seconds()
+		metrics.Lock()
+		defer metrics.Unlock()
+		metrics.requests[requestKey{handler, methodLabel(r), strconv.Itoa(rec.status)}]++
+		hist, ok := metrics.durations[handler]
+		if !ok {
+			hist = &histogram{counts: make([]uint64, len(DurationBuckets))}
+			metrics.durations[handler] = hist
+		}
+		hist.observe(d)
+	})
+}
+
+func writeMetric(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// writeMetrics writes all metrics in the Prometheus text format.
+func writeMetrics(w io.Writer) {
+	metrics.Lock()
+	keys := make([]requestKey, 0, len(metrics.requests))
+	for k := range metrics.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		return a.handler+" "+a.method+" "+a.code < b.handler+" "+b.method+" "+b.code
+	})
+	writeMetric(w, "gwiki_http_requests_total", "counter", "Number of HTTP requests by handler, method and status code.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "gwiki_http_requests_total{handler=%q,method=%q,code=%q} %d\n", k.handler, k.method, k.code, metrics.requests[k])
+	}
+	handlers := make([]string, 0, len(metrics.durations))
+	for h := range metrics.durations {
+		handlers = append(handlers, h)
+	}
+	sort.Strings(handlers)
+	writeMetric(w, "gwiki_http_request_duration_seconds", "histogram", "Duration of HTTP requests by handler.")
+	for _, h := range handlers {
+		hist := metrics.durations[h]
+		var cum uint64
+		for i, le := range DurationBuckets {
+			cum += hist.counts[i]
+			fmt.Fprintf(w, "gwiki_http_request_duration_seconds_bucket{handler=%q,le=%q} %d\n", h, formatFloat(le), cum)
+		}
+		fmt.Fprintf(w, "gwiki_http_request_duration_seconds_bucket{handler=%q,le=\"+Inf\"} %d\n", h, hist.count)
+		fmt.Fprintf(w, "gwiki_http_request_duration_seconds_sum{handler=%q} %s\n", h, formatFloat(hist.sum))
+		fmt.Fprintf(w, "gwiki_http_request_duration_seconds_count{handler=%q} %d\n", h, hist.count)
+	}
+	metrics.Unlock()
+
+	for _, m := range []struct {
+		name, typ, help string
+		value           uint64
+	}{
+		{"gwiki_page_saves_total", "counter", "Number of page saves.", atomic.LoadUint64(&pageSaves)},
+		{"gwiki_page_save_errors_total", "counter", "Number of failed page saves.", atomic.LoadUint64(&pageSaveErrors)},
+		{"gwiki_rate_limited_total", "counter", "Number of requests rejected by rate limits.", atomic.LoadUint64(&rateLimited)},
+		{"gwiki_page_cache_hits_total", "counter", "Number of pages found in the page cache.", atomic.LoadUint64(&pageCacheHits)},
+		{"gwiki_page_cache_misses_total", "counter", "Number of pages not found in the page cache.", atomic.LoadUint64(&pageCacheMisses)},
+		{"gwiki_page_cache_entries", "gauge", "Number of pages in the page cache.", uint64(cachedPages.Len())},
+	} {
+		writeMetric(w, m.name, m.typ, m.help)
+		fmt.Fprintf(w, "%s %d\n", m.name, m.value)
+	}
+	pages, links, ids := index.Sizes()
+	for _, m := range []struct {
+		name, help string
+		value      int
+	}{
+		{"gwiki_index_pages", "Number of pages in the index.", pages},
+		{"gwiki_index_links", "Number of links between pages in the index.", links},
+		{"gwiki_index_ids", "Number of page IDs in the index.", ids},
+	} {
+		writeMetric(w, m.name, "gauge", m.help)
+		fmt.Fprintf(w, "%s %d\n", m.name, m.value)
+	}
+}
+
+// metricsEndpoint serves the metrics (/metrics).
+func metricsEndpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w)
+}
+
+func initMetrics() {
+	if *metricsEnabled {
+		http.HandleFunc("/metrics", metricsEndpoint)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	http.HandleFunc("/metrics-test/", func(w http.ResponseWriter, r *http.Request) {})
+	h := metricsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics-test/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	for _, req := range []struct{ method, url string }{
+		{"GET", "/metrics-test/a"},
+		{"GET", "/metrics-test/b"},
+		{"GET", "/metrics-test/missing"},
+		{"BREW", "/metrics-test/a"},
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.url, nil))
+	}
+	countSave(nil)
+	var b strings.Builder
+	writeMetrics(&b)
+	out := b.String()
+	for i, expect := range []string{
+		`gwiki_http_requests_total{handler="/metrics-test/",method="GET",code="200"} 2`,
+		`gwiki_http_requests_total{handler="/metrics-test/",method="GET",code="404"} 1`,
+		`gwiki_http_requests_total{handler="/metrics-test/",method="other",code="200"} 1`,
+		`gwiki_http_request_duration_seconds_bucket{handler="/metrics-test/",le="+Inf"} 4`,
+		`gwiki_http_request_duration_seconds_count{handler="/metrics-test/"} 4`,
+		"# TYPE gwiki_page_saves_total counter",
+		"# TYPE gwiki_index_pages gauge",
+	} {
+		if !strings.Contains(out, expect+"\n") {
+			t.Errorf("[%d] expected %q in:\n%s", i, expect, out)
+		}
+	}
+}
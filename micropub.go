@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Micropub (https://www.w3.org/TR/micropub/) clients create and update
+// pages with an API token. Posts (h-entry) are created in a section, their
+// properties are mapped to front matter, uploads go to the media endpoint.
+var micropubSection = flag.String("micropub-section", "posts", "section Micropub posts and media are created in")
+
+const (
+	MicropubPath      = "/api/v1/micropub"
+	MicropubMediaPath = MicropubPath + "/media"
+	MicropubSlugMax   = 60
+)
+
+// micropubFields maps h-entry properties to front matter keys.
+var micropubFields = map[string]string{
+	"name":        "title",
+	"summary":     "description",
+	"published":   "date",
+	"updated":     "lastmod",
+	"category":    "tags",
+	"photo":       "images",
+	"syndication": "syndication",
+}
+
+// micropubLists are the front matter keys holding all values of their
+// property instead of the first one.
+var micropubLists = map[string]bool{"tags": true, "images": true, "syndication": true}
+
+// micropubRequest is a create (Type and Properties) or an action on the
+// post at URL. Form encoded requests are converted to it.
+type micropubRequest struct {
+	Type       []string                 `json:"type"`
+	Action     string                   `json:"action"`
+	URL        string                   `json:"url"`
+	Properties map[string][]interface{} `json:"properties"`
+	Replace    map[string][]interface{} `json:"replace"`
+	Add        map[string][]interface{} `json:"add"`
+	Delete     interface{}              `json:"delete"` // property names or values by property
+}
+
+var errMicropubForbidden = errors.New("not allowed to change the post")
+
+// micropubError writes an error response of the Micropub spec.
+func micropubError(w http.ResponseWriter, status int, code, desc string) {
+	w.WriteHeader(status)
+	writeJSON(w, map[string]string{"error": code, "error_description": desc})
+}
+
+// parseMicropub reads the JSON, form or multipart request r. Uploaded
+// files are saved in the media section.
+func parseMicropub(r *http.Request) (*micropubRequest, error) {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	req := &micropubRequest{}
+	if mt == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+	var err error
+	if mt == "multipart/form-data" {
+		err = r.ParseMultipartForm(MaxUploadSize)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Properties = make(map[string][]interface{})
+	for k, vs := range r.PostForm {
+		switch k = strings.TrimSuffix(k, "[]"); k {
+		case "h":
+			req.Type = []string{"h-" + vs[0]}
+		case "action":
+			req.Action = vs[0]
+		case "url":
+			req.URL = vs[0]
+		case "access_token":
+		default:
+			for _, v := range vs {
+				req.Properties[k] = append(req.Properties[k], v)
+			}
+		}
+	}
+	if r.MultipartForm == nil {
+		return req, nil
+	}
+	for k, fhs := range r.MultipartForm.File {
+		k = strings.TrimSuffix(k, "[]")
+		for _, fh := range fhs {
+			u, err := saveMicropubMedia(r, fh)
+			if err != nil {
+				return nil, err
+			}
+			req.Properties[k] = append(req.Properties[k], u)
+		}
+	}
+	return req, nil
+}
+
+// micropubString returns the value of a property: a string or the html or
+// value of an object like {"html": "..."} or {"value": "...", "alt": "..."}.
+func micropubString(v interface{}) string {
+	if m, ok := v.(map[string]interface{}); ok {
+		if h, ok := m["html"]; ok {
+			return toString(h)
+		}
+		return toString(m["value"])
+	}
+	return toString(v)
+}
+
+func micropubValue(key string, v interface{}) interface{} {
+	s := micropubString(v)
+	if key == "date" || key == "lastmod" {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t
+		}
+	}
+	return s
+}
+
+// setMicropub sets (or adds to) the fields of p from the properties.
+// Unknown properties are ignored.
+func setMicropub(p *Page, props map[string][]interface{}, add bool) {
+	for k, vs := range props {
+		if len(vs) == 0 {
+			continue
+		}
+		switch k {
+		case "content":
+			p.Body = []byte(micropubString(vs[0]))
+			continue
+		case "post-status":
+			p.FrontMatter["draft"] = micropubString(vs[0]) == "draft"
+			continue
+		}
+		key, ok := micropubFields[k]
+		if !ok {
+			continue
+		}
+		if !micropubLists[key] {
+			p.FrontMatter[key] = micropubValue(key, vs[0])
+			continue
+		}
+		var l []interface{}
+		if add {
+			for _, s := range toStrings(p.FrontMatter[key]) {
+				l = append(l, s)
+			}
+		}
+		for _, v := range vs {
+			if s := micropubString(v); !add || !contains(toStrings(l), s) {
+				l = append(l, s)
+			}
+		}
+		p.FrontMatter[key] = l
+	}
+}
+
+// deleteMicropub removes properties (a list of names) or some of their
+// values (lists by name) from p.
+func deleteMicropub(p *Page, del interface{}) error {
+	switch del := del.(type) {
+	case nil:
+	case []interface{}:
+		for _, k := range del {
+			switch k := toString(k); k {
+			case "content":
+				p.Body = nil
+			case "post-status":
+				delete(p.FrontMatter, "draft")
+			default:
+				if key, ok := micropubFields[k]; ok {
+					delete(p.FrontMatter, key)
+				}
+			}
+		}
+	case map[string]interface{}:
+		for k, vs := range del {
+			key := micropubFields[k]
+			if !micropubLists[key] {
+				continue
+			}
+			rm := toStrings(vs)
+			var l []interface{}
+			for _, s := range toStrings(p.FrontMatter[key]) {
+				if !contains(rm, s) {
+					l = append(l, s)
+				}
+			}
+			p.FrontMatter[key] = l
+		}
+	default:
+		return fmt.Errorf("invalid delete")
+	}
+	return nil
+}
+
+// micropubSource returns the properties of p as h-entry.
+func micropubSource(p *Page) map[string]interface{} {
+	props := map[string]interface{}{"content": []interface{}{string(p.Body)}}
+	for k, key := range micropubFields {
+		v, ok := p.FrontMatter[key]
+		switch {
+		case !ok:
+		case micropubLists[key]:
+			props[k] = toStrings(v)
+		case key == "date" || key == "lastmod":
+			if t, ok := v.(time.Time); ok {
+				v = t.Format(time.RFC3339)
+			}
+			props[k] = []interface{}{toString(v)}
+		default:
+			props[k] = []interface{}{toString(v)}
+		}
+	}
+	if draft, _ := p.FrontMatter["draft"].(bool); draft {
+		props["post-status"] = []interface{}{"draft"}
+	}
+	return map[string]interface{}{"type": []string{"h-entry"}, "properties": props}
+}
+
+// micropubPath returns the page path of a post URL (/view/<path>).
+func micropubPath(u string) (string, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	p := strings.TrimPrefix(pu.Path, "/view/")
+	if p == pu.Path || !isValidPath(p) {
+		return "", fmt.Errorf("unknown post URL '%s'", u)
+	}
+	return p, nil
+}
+
+// newPostPath returns an unused path in the Micropub section for a post
+// named by mp-slug, its name or the time.
+func newPostPath(props map[string][]interface{}) string {
+	var slug string
+	for _, k := range []string{"mp-slug", "name"} {
+		if vs := props[k]; len(vs) > 0 && slug == "" {
+			slug = slugify(micropubString(vs[0]))
+		}
+	}
+	if len(slug) > MicropubSlugMax {
+		slug = strings.Trim(slug[:MicropubSlugMax], "-")
+	}
+	return unusedPath(*micropubSection, slug)
+}
+
+// unusedPath returns the path dir/slug with a number added if it is taken
+// and the time as slug if it is empty.
+func unusedPath(dir, slug string) string {
+	if slug == "" {
+		slug = time.Now().UTC().Format("2006-01-02-150405")
+	}
+	p := path.Join(dir, slug)
+	for i := 2; ; i++ {
+		if !pageExists(p) {
+			return p
+		}
+		p = fmt.Sprintf("%s-%d", path.Join(dir, slug), i)
+	}
+}
+
+// saveMicropub validates and stores the post p replacing old (unless it
+// has to be approved).
+func saveMicropub(r *http.Request, p, old *Page) error {
+	if !tokenAllows(r, p.Path) || !acls.Allowed(currentUser(r), p.Path, true) {
+		return errMicropubForbidden
+	}
+	if int64(len(p.Body)) > *maxPageSize {
+		return fmt.Errorf("post is larger than %d bytes", *maxPageSize)
+	}
+	if err := checkPage(old, p); err != nil {
+		return err
+	}
+	return storePage(r, p, old, "Micropub")
+}
+
+// saveMicropubMedia stores an uploaded file in the Micropub section under
+// a unique name and returns its URL.
+func saveMicropubMedia(r *http.Request, fh *multipart.FileHeader) (string, error) {
+	dir := *micropubSection
+	ext := strings.ToLower(path.Ext(fh.Filename))
+	base := slugify(strings.TrimSuffix(path.Base(fh.Filename), path.Ext(fh.Filename)))
+	if base == "" {
+		base = "media"
+	}
+	name := time.Now().UTC().Format("20060102-150405-") + base + ext
+	if !tokenAllows(r, path.Join(dir, name)) || !acls.Allowed(currentUser(r), path.Join(dir, name), true) {
+		return "", errMicropubForbidden
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	content, err := uploadPolicy(dir).checkUpload(name, fh.Size, f)
+	if err != nil {
+		return "", err
+	}
+	if err = saveAttachment(dir, name, content); err != nil {
+		return "", err
+	}
+	audit(r, "upload", path.Join(dir, name))
+	return baseURL(r) + path.Join("/files", dir, name), nil
+}
+
+// micropubStatus returns the status and error code of the error err.
+func micropubStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, errMicropubForbidden):
+		return http.StatusForbidden, "forbidden"
+	}
+	return http.StatusBadRequest, "invalid_request"
+}
+
+// micropubHandler is the Micropub endpoint (/api/v1/micropub).
+func micropubHandler(w http.ResponseWriter, r *http.Request) {
+	if requestToken(r) == nil {
+		micropubError(w, http.StatusUnauthorized, "unauthorized", "an API token is required")
+		return
+	}
+	if r.Method == http.MethodGet {
+		micropubQuery(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "GET or POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, uploadPolicy(*micropubSection).MaxSize+1<<20)
+	req, err := parseMicropub(r)
+	if err != nil {
+		status, code := micropubStatus(err)
+		micropubError(w, status, code, err.Error())
+		return
+	}
+	var p *Page
+	switch req.Action {
+	case "", "create":
+		if len(req.Type) > 0 && req.Type[0] != "h-entry" {
+			micropubError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unsupported type '%s'", req.Type[0]))
+			return
+		}
+		p = NewPage(newPostPath(req.Properties))
+		p.FrontMatter["date"] = time.Now().UTC().Truncate(time.Second)
+		setMicropub(p, req.Properties, false)
+		err = saveMicropub(r, p, NewPage(p.Path))
+	case "update", "delete":
+		var path string
+		if path, err = micropubPath(req.URL); err == nil {
+			p, err = loadPage(r.Context(), path)
+		}
+		if err != nil {
+			micropubError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if req.Action == "delete" {
+			err = micropubDelete(r, path)
+			break
+		}
+		old := p.Copy()
+		setMicropub(p, req.Replace, false)
+		setMicropub(p, req.Add, true)
+		if err = deleteMicropub(p, req.Delete); err == nil {
+			err = saveMicropub(r, p, old)
+		}
+	default:
+		micropubError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unsupported action '%s'", req.Action))
+		return
+	}
+	switch {
+	case errors.Is(err, errReview):
+		w.Header().Set("Location", baseURL(r)+"/view/"+p.Path)
+		w.WriteHeader(http.StatusAccepted)
+	case err != nil:
+		logger(r.Context()).Info("Micropub request failed", "action", req.Action, "err", err)
+		status, code := micropubStatus(err)
+		micropubError(w, status, code, err.Error())
+	case req.Action == "" || req.Action == "create":
+		w.Header().Set("Location", baseURL(r)+"/view/"+p.Path)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func micropubDelete(r *http.Request, path string) error {
+	if !tokenAllows(r, path) || !acls.Allowed(currentUser(r), path, true) {
+		return errMicropubForbidden
+	}
+	return deletePage(r, path)
+}
+
+// micropubQuery answers the queries q=config, q=syndicate-to and
+// q=source&url=.
+func micropubQuery(w http.ResponseWriter, r *http.Request) {
+	switch q := r.FormValue("q"); q {
+	case "config":
+		writeJSON(w, map[string]interface{}{"media-endpoint": baseURL(r) + MicropubMediaPath, "syndicate-to": []string{}, "q": []string{"config", "syndicate-to", "source"}})
+	case "syndicate-to":
+		writeJSON(w, map[string]interface{}{"syndicate-to": []string{}})
+	case "source":
+		path, err := micropubPath(r.FormValue("url"))
+		var p *Page
+		if err == nil && mayView(r, path) {
+			p, err = loadPage(r.Context(), path)
+		} else if err == nil {
+			err = fmt.Errorf("unknown post URL '%s'", r.FormValue("url"))
+		}
+		if err != nil {
+			micropubError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeJSON(w, micropubSource(p.For(r)))
+	default:
+		micropubError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unsupported query '%s'", q))
+	}
+}
+
+// micropubMediaHandler is the media endpoint (POST /api/v1/micropub/media
+// with a file).
+func micropubMediaHandler(w http.ResponseWriter, r *http.Request) {
+	if requestToken(r) == nil {
+		micropubError(w, http.StatusUnauthorized, "unauthorized", "an API token is required")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, uploadPolicy(*micropubSection).MaxSize+1<<20)
+	_, fh, err := r.FormFile("file")
+	if err != nil {
+		micropubError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	u, err := saveMicropubMedia(r, fh)
+	if err != nil {
+		logger(r.Context()).Info("Micropub upload failed", "name", fh.Filename, "err", err)
+		status, code := micropubStatus(err)
+		micropubError(w, status, code, err.Error())
+		return
+	}
+	w.Header().Set("Location", u)
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMicropub(t *testing.T) {
+	for i, this := range []struct {
+		contentType, body string
+		expect            *micropubRequest
+	}{
+		{"application/x-www-form-urlencoded", "h=entry&content=Hello&category[]=a&category[]=b&access_token=x",
+			&micropubRequest{Type: []string{"h-entry"}, Properties: map[string][]interface{}{"content": {"Hello"}, "category": {"a", "b"}}}},
+		{"application/x-www-form-urlencoded", "action=delete&url=https://wiki/view/posts/a",
+			&micropubRequest{Action: "delete", URL: "https://wiki/view/posts/a", Properties: map[string][]interface{}{}}},
+		{"application/json", `{"type": ["h-entry"], "properties": {"name": ["Hi"], "content": [{"html": "<b>x</b>"}]}}`,
+			&micropubRequest{Type: []string{"h-entry"}, Properties: map[string][]interface{}{"name": {"Hi"}, "content": {map[string]interface{}{"html": "<b>x</b>"}}}}},
+		{"application/json", `{"action": "update", "url": "/view/a", "delete": ["category"]}`,
+			&micropubRequest{Action: "update", URL: "/view/a", Delete: []interface{}{"category"}}},
+	} {
+		r := httptest.NewRequest("POST", MicropubPath, strings.NewReader(this.body))
+		r.Header.Set("Content-Type", this.contentType)
+		got, err := parseMicropub(r)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, this.expect) {
+			t.Errorf("[%d] got %+v but expected %+v", i, got, this.expect)
+		}
+	}
+}
+
+func TestSetMicropub(t *testing.T) {
+	published := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	p := NewPage("posts/hi")
+	setMicropub(p, map[string][]interface{}{
+		"name": {"Hi"}, "content": {map[string]interface{}{"html": "<p>Hello</p>"}}, "category": {"a", "b"},
+		"published": {"2024-05-06T07:08:09Z"}, "post-status": {"draft"}, "photo": {map[string]interface{}{"value": "/files/x.jpg", "alt": "X"}},
+		"mp-syndicate-to": {"twitter"}, "location": {"geo:1,2"},
+	}, false)
+	expect := map[string]interface{}{"title": "Hi", "tags": []interface{}{"a", "b"}, "date": published, "draft": true, "images": []interface{}{"/files/x.jpg"}}
+	if !reflect.DeepEqual(p.FrontMatter, expect) || string(p.Body) != "<p>Hello</p>" {
+		t.Errorf("got %v %q but expected %v", p.FrontMatter, p.Body, expect)
+	}
+	setMicropub(p, map[string][]interface{}{"category": {"b", "c"}}, true)
+	setMicropub(p, map[string][]interface{}{"name": {"Hello"}}, false)
+	if err := deleteMicropub(p, map[string]interface{}{"category": []interface{}{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteMicropub(p, []interface{}{"photo", "post-status"}); err != nil {
+		t.Fatal(err)
+	}
+	expect = map[string]interface{}{"title": "Hello", "tags": []interface{}{"b", "c"}, "date": published}
+	if !reflect.DeepEqual(p.FrontMatter, expect) {
+		t.Errorf("got %v but expected %v", p.FrontMatter, expect)
+	}
+	if err := deleteMicropub(p, "category"); err == nil {
+		t.Errorf("expected an error for an invalid delete")
+	}
+
+	src := micropubSource(p)["properties"].(map[string]interface{})
+	for k, v := range map[string]interface{}{"name": []interface{}{"Hello"}, "category": []string{"b", "c"}, "published": []interface{}{"2024-05-06T07:08:09Z"}} {
+		if !reflect.DeepEqual(src[k], v) {
+			t.Errorf("got %v for %s but expected %v", src[k], k, v)
+		}
+	}
+}
+
+func TestMicropubPath(t *testing.T) {
+	for i, this := range []struct {
+		url, expect string
+	}{
+		{"https://wiki.example.com/view/posts/hello", "posts/hello"},
+		{"/view/posts/hello", "posts/hello"},
+		{"https://wiki.example.com/posts/hello", ""},
+		{"https://wiki.example.com/view/../etc", ""},
+	} {
+		got, err := micropubPath(this.url)
+		if got != this.expect || (err == nil) != (this.expect != "") {
+			t.Errorf("[%d] got %q, %v but expected %q", i, got, err, this.expect)
+		}
+	}
+}
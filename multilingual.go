@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Translation is a (possibly not yet existing) translation of a page.
+type Translation struct {
+	Language
+	Path   string
+	Exists bool
+}
+
+// pageLanguage returns the language encoded in the path of a page (by
+// language content dir or file name suffix) or an empty string.
+func pageLanguage(path string) string {
+	for _, l := range site.Languages {
+		if l.ContentDir != "" && strings.HasPrefix(path, l.ContentDir+"/") {
+			return l.Code
+		}
+		if strings.HasSuffix(path, "."+l.Code) {
+			return l.Code
+		}
+	}
+	return ""
+}
+
+// basePath returns the language neutral path of a page.
+func basePath(path string) string {
+	for _, l := range site.Languages {
+		if l.ContentDir != "" && strings.HasPrefix(path, l.ContentDir+"/") {
+			return strings.TrimPrefix(path, l.ContentDir+"/")
+		}
+		if strings.HasSuffix(path, "."+l.Code) {
+			return strings.TrimSuffix(path, "."+l.Code)
+		}
+	}
+	return path
+}
+
+// translationPath returns the path of the translation of a page into lang.
+// Languages with their own content dir use it; all others use a file name
+// suffix except for the default language.
+func translationPath(path string, l Language) string {
+	base := basePath(path)
+	switch {
+	case l.ContentDir != "":
+		return l.ContentDir + "/" + base
+	case l.Code == site.DefaultLanguage:
+		return base
+	default:
+		return base + "." + l.Code
+	}
+}
+
+// Lang returns the language of the page: by path, front matter or the
+// default language of the site.
+func (p *Page) Lang() string {
+	if l := pageLanguage(p.Path); l != "" {
+		return l
+	}
+	if l := p.Language(); l != "" {
+		return l
+	}
+	return site.DefaultLanguage
+}
+
+func (p *Page) TranslationKey() string {
+	return getString(p, "translationKey")
+}
+
+// Translations returns all other configured languages with the path of the
+// translation of the page. Pages with the same translationKey count as
+// translations just like in Hugo.
+func (p *Page) Translations() []Translation {
+	if len(site.Languages) < 2 {
+		return nil
+	}
+	byKey := make(map[string]string)
+	if key := p.TranslationKey(); key != "" {
+		ps, err := listPages()
+		if err != nil {
+			slog.Error("Unable to list pages", "err", err)
+		}
+		for _, tp := range loadMetas(ps) {
+			if tp.Path != p.Path && tp.TranslationKey() == key {
+				byKey[tp.Lang()] = tp.Path
+			}
+		}
+	}
+	own := p.Lang()
+	var ts []Translation
+	for _, l := range site.Languages {
+		if l.Code == own {
+			continue
+		}
+		t := Translation{Language: l, Path: translationPath(p.Path, l)}
+		if path, ok := byKey[l.Code]; ok {
+			t.Path = path
+		}
+		t.Exists = pageExists(t.Path)
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+// newTranslation creates a new page at path pre-filled with the front
+// matter and body of the page at from.
+func newTranslation(path, from string) *Page {
+	p := NewPage(path)
+	src, err := LoadPage(from)
+	if err != nil {
+		slog.Error("Unable to load source page for translation", "path", path, "from", from, "err", err)
+		return p
+	}
+	for k, v := range src.FrontMatter {
+		p.FrontMatter[k] = v
+	}
+	p.Mark = src.Mark
+	p.Body = src.Body
+	delete(p.FrontMatter, "aliases")
+	p.SetLanguage(p.Lang())
+	if src.TranslationKey() != "" {
+		p.FrontMatter["translationKey"] = src.TranslationKey()
+	}
+	return p
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTranslations(t *testing.T) {
+	testSetup(t)
+	defer func(sc *SiteConfig) { site = sc }(site)
+	site = defaultSiteConfig()
+	site.Languages = []Language{{Code: "en", Name: "English"}, {Code: "de", Name: "Deutsch", Weight: 1}, {Code: "fr", Name: "Français", Weight: 2, ContentDir: "fr"}}
+	r := httptest.NewRequest("POST", "/save/", nil)
+	for _, this := range []struct{ path, key string }{
+		{"docs/intro", ""},
+		{"docs/intro.de", ""},
+		{"blog/hello", "hello"},
+		{"fr/blog/bonjour", "hello"},
+	} {
+		p := NewPage(this.path)
+		p.Body = []byte("Hello")
+		if this.key != "" {
+			p.FrontMatter["translationKey"] = this.key
+		}
+		p.SetAliases("/" + this.path + "-old/")
+		if err := storePage(r, p, NewPage(p.Path), ""); err != nil {
+			t.Fatalf("unable to store %s: %s", this.path, err)
+		}
+	}
+
+	for i, this := range []struct {
+		path, lang string
+		expect     []Translation
+	}{
+		{"docs/intro", "en", []Translation{{site.Languages[1], "docs/intro.de", true}, {site.Languages[2], "fr/docs/intro", false}}},
+		{"docs/intro.de", "de", []Translation{{site.Languages[0], "docs/intro", true}, {site.Languages[2], "fr/docs/intro", false}}},
+		{"fr/docs/intro", "fr", []Translation{{site.Languages[0], "docs/intro", true}, {site.Languages[1], "docs/intro.de", true}}},
+		{"blog/hello", "en", []Translation{{site.Languages[1], "blog/hello.de", false}, {site.Languages[2], "fr/blog/bonjour", true}}},
+		{"fr/blog/bonjour", "fr", []Translation{{site.Languages[0], "blog/hello", true}, {site.Languages[1], "blog/bonjour.de", false}}},
+	} {
+		p, err := LoadPage(this.path)
+		if err != nil {
+			p = NewPage(this.path)
+		}
+		if lang := p.Lang(); lang != this.lang {
+			t.Errorf("[%d] got language %s for %s but expected %s", i, lang, this.path, this.lang)
+		}
+		if got := p.Translations(); !reflect.DeepEqual(got, this.expect) {
+			t.Errorf("[%d] got translations %v of %s but expected %v", i, got, this.path, this.expect)
+		}
+	}
+
+	p := newTranslation("blog/hello.de", "blog/hello")
+	if p.Lang() != "de" || p.Language() != "de" || p.TranslationKey() != "hello" || string(p.Body) != "Hello\n" || p.Aliases() != nil {
+		t.Errorf("got translation %s with front matter %v and body %q", p.Path, p.FrontMatter, p.Body)
+	}
+
+	site.Languages = site.Languages[:1]
+	if ts := NewPage("docs/intro").Translations(); ts != nil {
+		t.Errorf("got translations %v of a site with one language", ts)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+)
+
+var (
+	finalNewline           = flag.Bool("final-newline", true, "make saved pages end with exactly one newline")
+	trimTrailingWhitespace = flag.Bool("trim-trailing-whitespace", true, "strip trailing whitespace from lines of saved pages (Markdown hard line breaks are kept)")
+	frontMatterBlankLine   = flag.Bool("frontmatter-blank-line", true, "separate front matter and body of saved pages by exactly one blank line (else by none)")
+)
+
+// normalizeBody normalizes the whitespace of a page body according to the
+// flags so saving an unchanged page never produces a whitespace-only diff.
+func normalizeBody(body []byte) []byte {
+	body = bytes.TrimLeft(body, "\r\n")
+	if *trimTrailingWhitespace {
+		lines := bytes.Split(body, []byte("\n"))
+		for i, l := range lines {
+			lines[i] = trimLine(l)
+		}
+		body = bytes.Join(lines, []byte("\n"))
+	}
+	if *finalNewline {
+		body = bytes.TrimRight(body, "\r\n")
+		if len(body) > 0 {
+			body = append(body, '\n')
+		}
+	}
+	return body
+}
+
+// trimLine strips trailing white space but keeps two trailing spaces
+// (a Markdown hard line break) on lines with text.
+func trimLine(l []byte) []byte {
+	t := bytes.TrimRight(l, " \t\r")
+	if len(t) > 0 && len(l)-len(t) >= 2 && bytes.HasPrefix(l[len(t):], []byte("  ")) {
+		return append(t, ' ', ' ')
+	}
+	return t
+}
+
+// frontMatterSeparator returns what is written between front matter and body.
+func frontMatterSeparator(body []byte) []byte {
+	if *frontMatterBlankLine && len(body) > 0 {
+		return []byte("\n")
+	}
+	return nil
+}
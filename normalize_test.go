@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeBody(t *testing.T) {
+	for i, this := range []struct {
+		body   string
+		expect string
+	}{
+		{"", ""},
+		{"\n\n", ""},
+		{"text", "text\n"},
+		{"\n\ntext\n\n\n", "text\n"},
+		{"a  \r\nb \t\r\nc", "a  \nb\nc\n"},
+		{"hard   \nbreak", "hard  \nbreak\n"},
+		{"   \n", ""},
+	} {
+		result := string(normalizeBody([]byte(this.body)))
+
+		if result != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+}
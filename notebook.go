@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	runCode        = flag.Bool("run-code", false, "execute fenced code blocks marked run:go or run:sh in a sandbox (see -run-sandbox; only for trusted editors)")
+	runSandbox     = flag.String("run-sandbox", "bwrap", "sandbox for code blocks: 'bwrap' (bubblewrap) or 'nsjail'")
+	runTimeout     = flag.Duration("run-timeout", 10*time.Second, "maximum run time of a code block")
+	runOutputLimit = flag.Int("run-output-limit", 64*1024, "maximum number of bytes of output kept per code block")
+	runCacheSize   = flag.Int("run-cache", 200, "number of code block outputs kept in memory (0 runs every block on every view)")
+)
+
+// RunUser is the user (and group) id code blocks run as inside the
+// sandbox: nobody.
+const RunUser = "65534"
+
+var runBlock = regexp.MustCompile("(?m)^```run:(go|sh)[ \\t]*\\r?\\n([\\s\\S]*?)^```[ \\t]*$")
+
+// Code blocks run in a sandbox as nobody, with a read-only root file
+// system, a fresh /tmp, without network and without access to the working
+// directory of the wiki or the other files with its content, keys and logs.
+// Only the temporary directory of the block (including its Go build cache)
+// is writable. A sandbox returns the command line running the rest of the
+// arguments that way with just the environment env.
+var sandboxes = map[string]func(dir string, env []string) []string{
+	"bwrap":  bwrapArgs,
+	"nsjail": nsjailArgs,
+}
+
+func bwrapArgs(dir string, env []string) []string {
+	args := []string{"bwrap", "--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp"}
+	dirs, files := hiddenPaths()
+	for _, d := range dirs {
+		args = append(args, "--tmpfs", d)
+	}
+	for _, f := range files {
+		args = append(args, "--ro-bind", os.DevNull, f)
+	}
+	args = append(args, "--bind", dir, dir, "--chdir", dir, "--clearenv")
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		args = append(args, "--setenv", k, v)
+	}
+	return append(args, "--unshare-all", "--uid", RunUser, "--gid", RunUser,
+		"--cap-drop", "ALL", "--die-with-parent", "--new-session", "--")
+}
+
+func nsjailArgs(dir string, env []string) []string {
+	// nsjail has its own network namespace unless told otherwise
+	args := []string{"nsjail", "--mode", "o", "--quiet", "--chroot", "/", "--user", RunUser, "--group", RunUser, "--tmpfsmount", "/tmp"}
+	dirs, files := hiddenPaths()
+	for _, d := range dirs {
+		args = append(args, "--tmpfsmount", d)
+	}
+	for _, f := range files {
+		args = append(args, "--bindmount_ro", os.DevNull+":"+f)
+	}
+	args = append(args, "--bindmount", dir, "--cwd", dir)
+	for _, e := range env {
+		args = append(args, "--env", e)
+	}
+	return append(args, "--rlimit_as", "hard", "--rlimit_fsize", "1024", "--rlimit_nofile", "hard", "--")
+}
+
+// hiddenPaths returns the directories and files sandboxes hide: the working
+// directory and the configured files and directories of the wiki outside
+// of it (and /tmp).
+func hiddenPaths() (dirs, files []string) {
+	hidden := []string{"/tmp"}
+	if wd, err := os.Getwd(); err == nil && wd != "/" {
+		hidden = append(hidden, wd)
+		dirs = append(dirs, wd)
+	}
+	for _, p := range []string{*contentDir, *usersFile, *shareKeyFile, *tokensFile, *aclFile, *ownersFile,
+		*mailInSecretFile, *imapPasswordFile, *auditFile, *accessLog, *tlsKey, *autocertCache, *reviewsDir,
+		*snapshotDir, *attachmentHistory, *webhooksFile} {
+		if p == "" || p == "-" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs) // fails for missing files
+		}
+		if err != nil || isBelowAny(abs, hidden) {
+			continue
+		}
+		hidden = append(hidden, abs)
+		if fi, err := os.Stat(abs); err == nil && fi.IsDir() {
+			dirs = append(dirs, abs)
+		} else {
+			files = append(files, abs)
+		}
+	}
+	return dirs, files
+}
+
+// isBelowAny reports whether path is one of dirs or below one of them.
+func isBelowAny(path string, dirs []string) bool {
+	for _, d := range dirs {
+		if path == d || strings.HasPrefix(path, strings.TrimSuffix(d, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// initNotebook checks the sandbox is available if code blocks run.
+func initNotebook() {
+	if !*runCode {
+		return
+	}
+	f, ok := sandboxes[*runSandbox]
+	if !ok {
+		fatal("Unknown sandbox", "sandbox", *runSandbox)
+	}
+	if _, err := exec.LookPath(f("", nil)[0]); err != nil {
+		fatal("Unable to find the sandbox", "sandbox", *runSandbox, "err", err)
+	}
+}
+
+// runCache holds the output of recently executed code blocks keyed by a
+// hash of language and code, so a block only runs again when it changes.
+var runCache = struct {
+	sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *runOutput, most recently used first
+}{entries: make(map[string]*list.Element), lru: list.New()}
+
+type runOutput struct {
+	key, out string
+}
+
+// runBlockPlaceholders replaces the runnable code blocks of body by
+// placeholders for the code followed by its output.
+func runBlockPlaceholders(body []byte, ph *placeholders) []byte {
+	return runBlock.ReplaceAllFunc(body, func(m []byte) []byte {
+		sm := runBlock.FindSubmatch(m)
+		lang, code := string(sm[1]), string(sm[2])
+		var b bytes.Buffer
+		fmt.Fprintf(&b, `<pre><code class="language-%s">%s</code></pre>`, lang, html.EscapeString(code))
+		if *runCode {
+			fmt.Fprintf(&b, `<pre class="run-output"><samp>%s</samp></pre>`, html.EscapeString(runCached(lang, code)))
+		} else {
+			b.WriteString(`<p class="run-output">Code execution is disabled.</p>`)
+		}
+		return []byte("\n" + ph.add(b.String()) + "\n")
+	})
+}
+
+func runCached(lang, code string) string {
+	sum := sha256.Sum256([]byte(lang + "\x00" + code))
+	key := hex.EncodeToString(sum[:])
+	runCache.Lock()
+	if e, ok := runCache.entries[key]; ok {
+		runCache.lru.MoveToFront(e)
+		runCache.Unlock()
+		return e.Value.(*runOutput).out
+	}
+	runCache.Unlock()
+	out := runSandboxed(lang, code)
+	runCache.Lock()
+	defer runCache.Unlock()
+	if *runCacheSize <= 0 {
+		return out
+	}
+	if e, ok := runCache.entries[key]; ok {
+		runCache.lru.MoveToFront(e)
+		return out
+	}
+	runCache.entries[key] = runCache.lru.PushFront(&runOutput{key: key, out: out})
+	for runCache.lru.Len() > *runCacheSize {
+		e := runCache.lru.Back()
+		runCache.lru.Remove(e)
+		delete(runCache.entries, e.Value.(*runOutput).key)
+	}
+	return out
+}
+
+// runSandboxed runs code in the sandbox in a fresh temporary directory
+// with a minimal environment, limited CPU time, file size, wall clock time
+// and output.
+func runSandboxed(lang, code string) string {
+	sandbox, ok := sandboxes[*runSandbox]
+	if !ok {
+		return "ERROR: unknown sandbox " + *runSandbox
+	}
+	dir, err := ioutil.TempDir("", "gwiki-run-")
+	if err != nil {
+		return "ERROR: " + err.Error()
+	}
+	defer os.RemoveAll(dir)
+
+	var args []string
+	switch lang {
+	case "go":
+		if err = ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0600); err != nil {
+			return "ERROR: " + err.Error()
+		}
+		args = []string{"go", "run", "main.go"}
+	case "sh":
+		args = []string{"sh", "-c", code}
+	default:
+		return "ERROR: unsupported language " + lang
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *runTimeout)
+	defer cancel()
+	secs := int(runTimeout.Seconds()) + 1
+	limits := fmt.Sprintf(`ulimit -t %d; ulimit -f %d; exec "$@"`, secs, 1024*1024) // file size in 1K blocks (the Go compiler needs quite some)
+	env := []string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir, "TMPDIR=" + dir,
+		"GOCACHE=" + filepath.Join(dir, ".gocache"), "GO111MODULE=off"}
+	args = append(append(sandbox(dir, env), "sh", "-c", limits, "sh"), args...)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	out := &limitedBuffer{limit: *runOutputLimit}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+	res := out.String()
+	if out.truncated {
+		res += "\n... (output truncated)"
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		res += fmt.Sprintf("\nERROR: killed after %s", *runTimeout)
+	} else if err != nil {
+		res += "\nERROR: " + err.Error()
+	}
+	return res
+}
+
+// limitedBuffer keeps the first limit bytes written to it. The buffer
+// isn't embedded since io.Copy would use its ReadFrom bypassing the limit.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if rest := lb.limit - lb.buf.Len(); rest < len(p) {
+		lb.truncated = true
+		if rest <= 0 {
+			return n, nil
+		}
+		p = p[:rest]
+	}
+	lb.buf.Write(p)
+	return n, nil
+}
+
+func (lb *limitedBuffer) String() string {
+	return lb.buf.String()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSandbox runs code blocks without a sandbox, after printing the
+// directory they run in.
+func testSandbox(dir string, env []string) []string {
+	return []string{"sh", "-c", `echo "sandbox $0"; exec "$@"`, dir}
+}
+
+func runTestSetup() func() {
+	sandboxes["test"] = testSandbox
+	s, t, l, c := *runSandbox, *runTimeout, *runOutputLimit, *runCacheSize
+	*runSandbox = "test"
+	e, lru := runCache.entries, runCache.lru
+	runCache.entries, runCache.lru = make(map[string]*list.Element), list.New()
+	return func() {
+		*runSandbox, *runTimeout, *runOutputLimit, *runCacheSize = s, t, l, c
+		runCache.entries, runCache.lru = e, lru
+		delete(sandboxes, "test")
+	}
+}
+
+func TestRunSandboxed(t *testing.T) {
+	defer runTestSetup()()
+	*runTimeout, *runOutputLimit = 500*time.Millisecond, 100
+
+	out := runSandboxed("sh", `echo "$PWD"; echo "$HOME"`)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || lines[0] != "sandbox "+lines[1] || lines[1] != lines[2] || !strings.Contains(lines[1], "gwiki-run-") {
+		t.Errorf("got output %q but expected the block to run in the sandbox in its own directory", out)
+	}
+	if _, err := os.Stat(lines[1]); !os.IsNotExist(err) {
+		t.Errorf("expected the directory %s to be removed", lines[1])
+	}
+	for i, this := range []struct{ lang, code, expect string }{
+		{"sh", "yes | head -c 1000", "... (output truncated)"},
+		{"sh", "sleep 5", "ERROR: killed after 500ms"},
+		{"sh", "exit 3", "ERROR: exit status 3"},
+		{"python", "print(1)", "ERROR: unsupported language python"},
+	} {
+		if out := runSandboxed(this.lang, this.code); !strings.HasSuffix(out, this.expect) {
+			t.Errorf("[%d] got output %q but expected it to end with %q", i, out, this.expect)
+		}
+	}
+	*runSandbox = "none"
+	if out := runSandboxed("sh", "echo unsafe"); out != "ERROR: unknown sandbox none" {
+		t.Errorf("got output %q without a sandbox", out)
+	}
+}
+
+func TestRunCached(t *testing.T) {
+	defer runTestSetup()()
+	*runCacheSize = 2
+	const code = "date +%s%N"
+	first := runCached("sh", code)
+	if got := runCached("sh", code); got != first {
+		t.Errorf("got %q but expected the cached output %q", got, first)
+	}
+	runCached("sh", "echo b")
+	runCached("sh", "echo c")
+	if n := runCache.lru.Len(); n != 2 || len(runCache.entries) != 2 {
+		t.Errorf("got %d cached outputs but expected 2", n)
+	}
+	if got := runCached("sh", code); got == first {
+		t.Errorf("expected the least recently used output to be dropped")
+	}
+	if got := runCached("sh", "echo c"); got != "sandbox "+strings.SplitN(got, "\n", 2)[0][8:]+"\nc\n" {
+		t.Errorf("got output %q", got)
+	}
+}
+
+func TestBwrapSandbox(t *testing.T) {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		t.Skip("bwrap isn't installed")
+	}
+	defer runTestSetup()()
+	*runSandbox = "bwrap"
+	wd, _ := os.Getwd()
+	out := runSandboxed("sh", "id -u; touch /gwiki-test || echo read-only; ls -A "+wd+" | wc -l; wget -q -T 1 -O - http://1.1.1.1 || echo offline")
+	if fields := strings.Fields(out); len(fields) < 4 || fields[0] != RunUser || !strings.Contains(out, "read-only") || !strings.Contains(out, "\n0\n") || !strings.Contains(out, "offline") {
+		t.Errorf("got output %q", out)
+	}
+}
+
+func TestSandboxArgs(t *testing.T) {
+	testSetup(t)
+	wd, _ := os.Getwd()
+	defer func(u, s, h string) { *usersFile, *shareKeyFile, *attachmentHistory = u, s, h }(*usersFile, *shareKeyFile, *attachmentHistory)
+	*usersFile, *shareKeyFile, *attachmentHistory = "/etc/passwd", filepath.Join(t.TempDir(), "share.key"), "/usr"
+	if err := ioutil.WriteFile(*shareKeyFile, []byte("secret"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	env := []string{"HOME=/tmp/run", "GOCACHE=/tmp/run/.gocache"}
+	for i, this := range []struct {
+		args           []string
+		expect, absent []string
+	}{
+		{bwrapArgs("/tmp/run", env), []string{"--ro-bind / /", "--tmpfs /tmp", "--tmpfs " + wd, "--tmpfs /usr", "--ro-bind /dev/null /etc/passwd",
+			"--bind /tmp/run /tmp/run", "--clearenv", "--setenv GOCACHE /tmp/run/.gocache", "--unshare-all", "--uid 65534", "--cap-drop ALL"},
+			[]string{*shareKeyFile}},
+		{nsjailArgs("/tmp/run", env), []string{"--chroot /", "--user 65534", "--tmpfsmount /tmp", "--tmpfsmount " + wd, "--tmpfsmount /usr",
+			"--bindmount_ro /dev/null:/etc/passwd", "--bindmount /tmp/run", "--cwd /tmp/run", "--env HOME=/tmp/run"},
+			[]string{*shareKeyFile, "--keep_env"}},
+	} {
+		cmd := strings.Join(this.args, " ")
+		for _, arg := range this.expect {
+			if !strings.Contains(cmd, arg+" ") {
+				t.Errorf("[%d] got %s without %s", i, cmd, arg)
+			}
+		}
+		for _, arg := range this.absent {
+			if strings.Contains(cmd, arg) {
+				t.Errorf("[%d] got %s with %s", i, cmd, arg)
+			}
+		}
+		if !strings.HasSuffix(cmd, " --") {
+			t.Errorf("[%d] got %s without the end of the options", i, cmd)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// A Notion export (Markdown & CSV or HTML, extracted) is imported with the
+// hash suffixes of the file names dropped, child pages below their parent,
+// internal links pointing to the new page paths, images moved next to the
+// first page using them and the properties of database rows as front
+// matter. Databases themselves are only imported as their rows (and as
+// page in HTML exports).
+
+var (
+	notionHash     = regexp.MustCompile(`\s+[0-9a-f]{32}$`)
+	notionProperty = regexp.MustCompile(`^([^:\n]{1,40}): (.*)$`)
+)
+
+// notionDateLayouts are the formats of dates in property values.
+var notionDateLayouts = []string{"January 2, 2006 3:04 PM", "January 2, 2006", "2006/01/02 15:04", "2006/01/02", "2006-01-02T15:04:05Z07:00", DateFormat}
+
+type notionPage struct {
+	src  string // export path
+	page *Page
+	body []byte // Markdown
+	doc  *html.Node
+}
+
+type notionExport struct {
+	*importFiles
+	section string
+	pages   map[string]*notionPage // by export path
+	files   map[string]bool        // export paths of attachments
+}
+
+// importNotion converts the pages and attachments of the extracted Notion
+// export at dir to pages below section.
+func importNotion(dir, section string) (*Import, error) {
+	e := &notionExport{importFiles: newImportFiles(dir), section: section, pages: make(map[string]*notionPage), files: make(map[string]bool)}
+	var pages []*notionPage
+	var files []string
+	err := filepath.WalkDir(dir, func(fn string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fn)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch strings.ToLower(path.Ext(rel)) {
+		case Suffix, ".html":
+			pages = append(pages, &notionPage{src: rel})
+		case ".csv":
+			if !strings.HasSuffix(rel, "_all.csv") {
+				e.imp.problem("database '%s' is imported as its pages only", rel)
+			}
+		case ".zip":
+			e.imp.problem("archive '%s' isn't imported, extract it into the export first", rel)
+		default:
+			files = append(files, rel)
+			e.files[rel] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Parents first so their paths are taken before the ones of children.
+	sort.Slice(pages, func(i, j int) bool {
+		if di, dj := strings.Count(pages[i].src, "/"), strings.Count(pages[j].src, "/"); di != dj {
+			return di < dj
+		}
+		return pages[i].src < pages[j].src
+	})
+	for _, n := range pages {
+		if err := e.readPage(n); err != nil {
+			e.imp.problem("unable to read page '%s': %s", n.src, err)
+			continue
+		}
+		e.pages[n.src] = n
+	}
+	for _, n := range pages {
+		if n.page == nil {
+			continue
+		}
+		if n.doc != nil {
+			n.page.Body = []byte(e.convertHTML(n))
+		} else {
+			n.page.Body = e.convert(n)
+		}
+		e.imp.Pages = append(e.imp.Pages, n.page)
+	}
+	for _, f := range files {
+		if e.placed[f] == nil {
+			e.place(f, e.pagePath(path.Dir(f)))
+		}
+	}
+	e.sortFiles()
+	return e.imp, nil
+}
+
+// notionName returns the name of the export file or directory name
+// without extension and hash.
+func notionName(name string) string {
+	if ext := path.Ext(name); ext == Suffix || ext == ".html" {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return strings.TrimSpace(notionHash.ReplaceAllString(name, ""))
+}
+
+// pagePath returns the page path for the export path p.
+func (e *notionExport) pagePath(p string) string {
+	segs := []string{e.section}
+	if p != "." {
+		for _, s := range strings.Split(p, "/") {
+			if s = slugify(notionName(s)); s == "" {
+				s = "untitled"
+			}
+			segs = append(segs, s)
+		}
+	}
+	return path.Join(segs...)
+}
+
+// readPage reads the page n with its title and properties.
+func (e *notionExport) readPage(n *notionPage) error {
+	b, err := os.ReadFile(filepath.Join(e.dir, filepath.FromSlash(n.src)))
+	if err != nil {
+		return err
+	}
+	p := NewPage(e.pagePath(n.src))
+	p.Mark = '-'
+	p.Path = uniqueName(e.taken, p.Path)
+	if !isValidPath(p.Path) {
+		return fmt.Errorf("%w '%s'", ErrInvalidPath, p.Path)
+	}
+	title := notionName(path.Base(n.src))
+	if strings.ToLower(path.Ext(n.src)) == ".html" {
+		if n.doc, err = html.Parse(bytes.NewReader(b)); err != nil {
+			return err
+		}
+		if h := findClass(n.doc, "page-title"); h != nil && strings.TrimSpace(textContent(h)) != "" {
+			title = strings.TrimSpace(textContent(h))
+		}
+		if t := findClass(n.doc, "properties"); t != nil {
+			e.htmlProperties(p, t)
+		}
+	} else {
+		b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+		if rest, ok := bytes.CutPrefix(b, []byte("# ")); ok {
+			line, body, _ := bytes.Cut(rest, []byte("\n"))
+			title, b = strings.TrimSpace(string(line)), bytes.TrimLeft(body, "\n")
+		}
+		if e.isRow(n.src) {
+			b = e.mdProperties(p, b)
+		}
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	p.FrontMatter["title"] = title
+	n.page, n.body = p, b
+	return nil
+}
+
+// isRow reports whether the page at the export path src is a database row,
+// that is its directory belongs to a database.
+func (e *notionExport) isRow(src string) bool {
+	d := path.Dir(src)
+	if d == "." {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(e.dir, filepath.FromSlash(d)+".csv"))
+	return err == nil
+}
+
+// mdProperties sets the properties of the Markdown page body b ("Key:
+// Value" lines below the title) on p and returns the rest of the body.
+func (e *notionExport) mdProperties(p *Page, b []byte) []byte {
+	block, rest, _ := bytes.Cut(b, []byte("\n\n"))
+	lines := strings.Split(strings.TrimSpace(string(block)), "\n")
+	var props [][]string
+	for _, l := range lines {
+		m := notionProperty.FindStringSubmatch(l)
+		if m == nil {
+			return b
+		}
+		props = append(props, m[1:])
+	}
+	for _, kv := range props {
+		e.setProperty(p, kv[0], kv[1], strings.Split(kv[1], ", "))
+	}
+	return bytes.TrimLeft(rest, "\n")
+}
+
+// htmlProperties sets the properties of the HTML table t on p.
+func (e *notionExport) htmlProperties(p *Page, t *html.Node) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.Data != "tr" {
+				walk(c)
+				continue
+			}
+			var key, value string
+			var values []string
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				switch {
+				case cell.Type != html.ElementNode:
+				case cell.Data == "th":
+					key = strings.TrimSpace(textContent(cell))
+				case cell.Data == "td":
+					value = strings.TrimSpace(textContent(cell))
+					values = classTexts(cell, "selected-value")
+				}
+			}
+			if values == nil {
+				values = strings.Split(value, ", ")
+			}
+			if key != "" {
+				e.setProperty(p, key, value, values)
+			}
+		}
+	}
+	walk(t)
+}
+
+// setProperty sets the property key with the text value (of the values
+// of a multi-select) on p.
+func (e *notionExport) setProperty(p *Page, key, value string, values []string) {
+	if value == "" {
+		return
+	}
+	switch lk := strings.ToLower(key); lk {
+	case "tags", "tag", "labels", "categories":
+		tags := []interface{}{}
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				tags = append(tags, v)
+			}
+		}
+		p.FrontMatter["tags"] = tags
+	case "created", "created time", "date created", "date":
+		if _, ok := p.FrontMatter["date"]; !ok || lk != "date" {
+			p.FrontMatter["date"] = notionDate(value)
+		}
+	case "last edited time", "last edited", "updated", "modified":
+		p.FrontMatter["lastmod"] = notionDate(value)
+	case "title", "description", "status":
+		p.FrontMatter[lk] = value
+	default:
+		p.FrontMatter[key] = value
+	}
+}
+
+// notionDate returns the start of the date (range) s as RFC 3339 or date,
+// or s itself if it isn't a date.
+func notionDate(s string) string {
+	d, _, _ := strings.Cut(strings.TrimPrefix(s, "@"), " → ")
+	d = strings.TrimSpace(d)
+	for _, l := range notionDateLayouts {
+		if t, err := time.Parse(l, d); err == nil {
+			if t.Hour() == 0 && t.Minute() == 0 && !strings.Contains(l, "Z07") {
+				return t.Format(DateFormat)
+			}
+			return t.Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+func hasClass(n *html.Node, c string) bool {
+	if n.Type == html.ElementNode {
+		for _, cl := range strings.Fields(attr(n, "class")) {
+			if cl == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findClass returns the first element below n with the class c.
+func findClass(n *html.Node, c string) *html.Node {
+	if hasClass(n, c) {
+		return n
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if f := findClass(ch, c); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// classTexts returns the texts of the elements below n with the class c.
+func classTexts(n *html.Node, c string) []string {
+	var texts []string
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if hasClass(ch, c) {
+			texts = append(texts, strings.TrimSpace(textContent(ch)))
+		} else if ch.Type == html.ElementNode {
+			texts = append(texts, classTexts(ch, c)...)
+		}
+	}
+	return texts
+}
+
+// link returns the URL the link target t on the page n points to, "" if
+// it points nowhere in the export.
+func (e *notionExport) link(n *notionPage, t string) string {
+	if externalLink.MatchString(t) {
+		if u, err := url.Parse(t); err == nil && strings.HasSuffix(u.Host, "notion.so") {
+			e.imp.problem("link to Notion '%s' in '%s' is kept", t, n.src)
+		}
+		return t
+	}
+	if strings.HasPrefix(t, "#") || strings.HasPrefix(t, "mailto:") {
+		return t
+	}
+	if u, err := url.PathUnescape(t); err == nil {
+		t = u
+	}
+	t, anchor, _ := strings.Cut(t, "#")
+	src := path.Join(path.Dir(n.src), t)
+	if to := e.pages[src]; to != nil {
+		return pageURL(to.page.Path, slugify(anchor))
+	}
+	if e.files[src] {
+		return e.url(src, attachmentDir(n.page.Path))
+	}
+	if strings.EqualFold(path.Ext(t), ".csv") {
+		e.imp.problem("link to database '%s' in '%s' is kept", notionName(strings.TrimSuffix(path.Base(t), path.Ext(t))), n.src)
+	} else {
+		e.imp.problem("link to missing '%s' in '%s' is kept", t, n.src)
+	}
+	return ""
+}
+
+// convert returns the Markdown body of the page n with its links translated
+// outside of code blocks. Callouts become plain paragraphs.
+func (e *notionExport) convert(n *notionPage) []byte {
+	var out []string
+	fence := ""
+	for _, line := range strings.Split(string(n.body), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			fence = "```"
+		case trimmed == "<aside>" || trimmed == "</aside>":
+			line = ""
+		default:
+			line = importMdLink.ReplaceAllStringFunc(line, func(l string) string {
+				m := importMdLink.FindStringSubmatch(l)
+				if u := e.link(n, m[3]+m[4]); u != "" {
+					return m[1] + "[" + m[2] + "](" + markdownURL(u) + ")"
+				}
+				return l
+			})
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+// convertHTML returns the Markdown of the body of the HTML page n.
+func (e *notionExport) convertHTML(n *notionPage) string {
+	body := findClass(n.doc, "page-body")
+	if body == nil {
+		body = n.doc
+	}
+	return htmlToMarkdown(body, func(href string, image bool) string {
+		if strings.HasPrefix(href, "#") {
+			return "" // block ids of the table of contents
+		}
+		return e.link(n, href)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const notionTestHash = " 0123456789abcdef0123456789abcdef"
+
+func TestImportNotion(t *testing.T) {
+	export := t.TempDir()
+	h := notionTestHash
+	for fn, content := range map[string]string{
+		"Home" + h + ".md": "# Home\n\nSee [Tasks](Home%20" + h[1:] + "/Tasks%20" + h[1:] + ".csv), [Plan](Home%20" + h[1:] + "/Plan%20" + h[1:] + ".md#Goals)" +
+			" and [site](https://example.com).\n\n![Diagram](Home%20" + h[1:] + "/diagram.png)\n\n<aside>\nNote\n</aside>\n\n```\n[x](y.md)\n```\n",
+		"Home" + h + "/Plan" + h + ".md":                 "# Plan\n\nBack to [Home](../Home%20" + h[1:] + ".md) and [gone](Gone.md).\n",
+		"Home" + h + "/diagram.png":                      "png",
+		"Home" + h + "/Unused File.pdf":                  "pdf",
+		"Home" + h + "/Tasks" + h + ".csv":               "Name,Tags\n",
+		"Home" + h + "/Tasks" + h + "_all.csv":           "Name,Tags\n",
+		"Home" + h + "/Tasks" + h + "/Write" + h + ".md": "# Write docs\n\nTags: docs, web\nCreated: January 2, 2024 3:04 PM\nStatus: Done\nDue: March 1, 2024\n\nNote: body.\n",
+		"Wiki" + h + ".html": `<html><head><title>Wiki</title></head><body><article><header><h1 class="page-title">The Wiki</h1>
+<table class="properties"><tbody><tr><th>Tags</th><td><span class="selected-value">a</span><span class="selected-value">b c</span></td></tr>
+<tr><th>Date</th><td><time>@March 4, 2023</time></td></tr></tbody></table></header>
+<div class="page-body"><p>Start at <a href="Home%20` + h[1:] + `.md">home</a><a href="#abc">toc</a>.</p>
+<figure class="image"><a href="Wiki%20` + h[1:] + `/shot.png"><img src="Wiki%20` + h[1:] + `/shot.png"/></a></figure></div></article></body></html>`,
+		"Wiki" + h + "/shot.png": "png",
+	} {
+		fn = filepath.Join(export, filepath.FromSlash(fn))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imp, err := importNotion(export, "kb")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pages := make(map[string]*Page)
+	for _, p := range imp.Pages {
+		pages[p.Path] = p
+	}
+	for i, this := range []struct {
+		path        string
+		frontMatter map[string]interface{}
+		body        string
+	}{
+		{"kb/home", map[string]interface{}{"title": "Home"},
+			"See [Tasks](Home%20" + h[1:] + "/Tasks%20" + h[1:] + ".csv), [Plan](/view/kb/home/plan#goals) and [site](https://example.com).\n\n" +
+				"![Diagram](/files/kb/diagram.png)\n\n\nNote\n\n\n```\n[x](y.md)\n```\n"},
+		{"kb/home/plan", map[string]interface{}{"title": "Plan"}, "Back to [Home](/view/kb/home) and [gone](Gone.md).\n"},
+		{"kb/home/tasks/write", map[string]interface{}{"title": "Write docs", "tags": []interface{}{"docs", "web"}, "date": "2024-01-02T15:04:00Z",
+			"status": "Done", "Due": "March 1, 2024"}, "Note: body.\n"},
+		{"kb/wiki", map[string]interface{}{"title": "The Wiki", "tags": []interface{}{"a", "b c"}, "date": "2023-03-04"},
+			"Start at [home](/view/kb/home)toc.\n\n[![](/files/kb/shot.png)](/files/kb/shot.png)\n"},
+	} {
+		p := pages[this.path]
+		if p == nil {
+			t.Errorf("[%d] page %s is missing", i, this.path)
+			continue
+		}
+		if !reflect.DeepEqual(p.FrontMatter, this.frontMatter) || string(p.Body) != this.body {
+			t.Errorf("[%d] got %v and body %q but expected %v and %q", i, p.FrontMatter, p.Body, this.frontMatter, this.body)
+		}
+	}
+	if len(imp.Pages) != 4 {
+		t.Errorf("got %d pages but expected 4", len(imp.Pages))
+	}
+	var files []string
+	for _, f := range imp.Files {
+		files = append(files, f.Dir+"/"+f.Name)
+	}
+	if expect := []string{"kb/diagram.png", "kb/home/unused-file.pdf", "kb/shot.png"}; !reflect.DeepEqual(files, expect) {
+		t.Errorf("got files %v but expected %v", files, expect)
+	}
+	problems := strings.Join(imp.Problems, "\n")
+	for _, p := range []string{"database 'Home" + h + "/Tasks" + h + ".csv'", "missing 'Gone.md'", "link to database 'Tasks'"} {
+		if !strings.Contains(problems, p) {
+			t.Errorf("problem %q wasn't reported in %q", p, problems)
+		}
+	}
+}
+
+func TestNotionDate(t *testing.T) {
+	for i, this := range []struct {
+		value  string
+		expect string
+	}{
+		{"January 2, 2024", "2024-01-02"},
+		{"@January 2, 2024 3:04 PM", "2024-01-02T15:04:00Z"},
+		{"2024/01/02 → 2024/01/05", "2024-01-02"},
+		{"soon", "soon"},
+	} {
+		if got := notionDate(this.value); got != this.expect {
+			t.Errorf("[%d] got %s but expected %s", i, got, this.expect)
+		}
+	}
+}
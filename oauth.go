@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// With an OAuth2 provider users log in at Google, GitHub or any OpenID
+// Connect provider (e.g. Keycloak, Authentik, Azure AD) and get a session
+// cookie signed with the share key. Paths below -auth-exempt don't need a
+// login, like with basic auth.
+var (
+	oauthProvider     = flag.String("oauth-provider", "", "login with 'google', 'github' or 'oidc'")
+	oauthIssuer       = flag.String("oauth-issuer", "", "issuer URL of the OpenID Connect provider for -oauth-provider oidc")
+	oauthClientID     = flag.String("oauth-client-id", "", "OAuth2 client ID")
+	oauthClientSecret = flag.String("oauth-client-secret", "", "OAuth2 client secret")
+	oauthRedirectURL  = flag.String("oauth-redirect-url", "", "redirect URL registered at the provider (default: <base URL>/auth/callback)")
+	oauthUserClaim    = flag.String("oauth-user-claim", "email", "claim of the OpenID Connect user info used as user name (e.g. 'email' or 'preferred_username')")
+	oauthAllow        = flag.String("oauth-allow", "", "comma separated users and '@domain's allowed to log in (empty allows everybody with an account)")
+	sessionMaxAge     = flag.Duration("session-max-age", 7*24*time.Hour, "lifetime of login sessions")
+)
+
+const (
+	SessionCookie = "gwiki_session"
+	StateCookie   = "gwiki_oauth"
+	GoogleIssuer  = "https://accounts.google.com"
+	GitHubUserURL = "https://api.github.com/user"
+)
+
+var (
+	oauthConfig *oauth2.Config // nil: no OAuth2 login
+	userInfoURL string
+)
+
+func initOAuth() {
+	if *oauthProvider == "" {
+		return
+	}
+	if *usersFile != "" {
+		fatal("Use either -users-file or -oauth-provider")
+	}
+	if *oauthClientID == "" || *oauthClientSecret == "" {
+		fatal("-oauth-provider needs -oauth-client-id and -oauth-client-secret")
+	}
+	oauthConfig = &oauth2.Config{ClientID: *oauthClientID, ClientSecret: *oauthClientSecret, RedirectURL: *oauthRedirectURL}
+	switch *oauthProvider {
+	case "github":
+		oauthConfig.Endpoint = endpoints.GitHub
+		oauthConfig.Scopes = []string{"read:user"}
+		userInfoURL = GitHubUserURL
+	case "google", "oidc":
+		issuer := *oauthIssuer
+		if *oauthProvider == "google" {
+			issuer = GoogleIssuer
+		}
+		if issuer == "" {
+			fatal("-oauth-provider oidc needs -oauth-issuer")
+		}
+		if err := discoverOIDC(issuer); err != nil {
+			fatal("Unable to discover OpenID Connect provider", "issuer", issuer, "err", err)
+		}
+		oauthConfig.Scopes = []string{"openid", "email", "profile"}
+	default:
+		fatal("Unknown OAuth2 provider", "provider", *oauthProvider)
+	}
+	if *oauthAllow == "" {
+		slog.Warn("Everybody with an account at the provider can log in, use -oauth-allow to restrict it", "provider", *oauthProvider)
+	}
+	http.HandleFunc("/auth/login", loginHandler)
+	http.HandleFunc("/auth/callback", callbackHandler)
+	http.HandleFunc("/auth/logout", logoutHandler)
+}
+
+// discoverOIDC reads the endpoints from the provider configuration.
+func discoverOIDC(issuer string) error {
+	resp, err := http.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	var cfg struct {
+		AuthURL     string `json:"authorization_endpoint"`
+		TokenURL    string `json:"token_endpoint"`
+		UserInfoURL string `json:"userinfo_endpoint"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return err
+	}
+	if cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "" {
+		return fmt.Errorf("endpoints missing in the provider configuration")
+	}
+	oauthConfig.Endpoint = oauth2.Endpoint{AuthURL: cfg.AuthURL, TokenURL: cfg.TokenURL}
+	userInfoURL = cfg.UserInfoURL
+	return nil
+}
+
+// isAllowedUser checks user against the comma separated users and
+// '@domain's of allow.
+func isAllowedUser(allow, user string) bool {
+	if allow == "" {
+		return user != ""
+	}
+	for _, a := range strings.Split(allow, ",") {
+		a = strings.ToLower(strings.TrimSpace(a))
+		u := strings.ToLower(user)
+		if a != "" && (u == a || strings.HasPrefix(a, "@") && strings.HasSuffix(u, a)) {
+			return true
+		}
+	}
+	return false
+}
+
+func sessionSig(value string) string {
+	mac := hmac.New(sha256.New, shareKey)
+	fmt.Fprintf(mac, "session\n%s", value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sessionValue returns the signed cookie value of a session of user.
+func sessionValue(user string, expires time.Time) string {
+	v := url.QueryEscape(user) + ":" + strconv.FormatInt(expires.Unix(), 10)
+	return v + ":" + sessionSig(v)
+}
+
+// sessionUser returns the user of a valid session cookie value or "".
+func sessionUser(value string) string {
+	i := strings.LastIndex(value, ":")
+	if i < 0 || !hmac.Equal([]byte(value[i+1:]), []byte(sessionSig(value[:i]))) {
+		return ""
+	}
+	fs := strings.SplitN(value[:i], ":", 2)
+	if len(fs) != 2 {
+		return ""
+	}
+	exp, err := strconv.ParseInt(fs[1], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return ""
+	}
+	user, err := url.QueryUnescape(fs[0])
+	if err != nil {
+		return ""
+	}
+	return user
+}
+
+// setCookie sets a cookie for the whole wiki; a negative maxAge deletes it.
+func setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge time.Duration) {
+	ma := int(maxAge / time.Second)
+	if maxAge < 0 {
+		ma = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: name, Value: value, Path: "/", MaxAge: ma,
+		HttpOnly: true, Secure: isSecure(r), SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oauthHandler requires a login for h if there is an OAuth2 provider.
+func oauthHandler(h http.Handler) http.Handler {
+	if oauthConfig == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestToken(r) != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if c, err := r.Cookie(SessionCookie); err == nil {
+			if user := sessionUser(c.Value); user != "" {
+				h.ServeHTTP(w, withUser(r, user))
+				return
+			}
+		}
+		if isAuthExempt(r.URL.Path) || strings.HasPrefix(r.URL.Path, "/auth/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	})
+}
+
+func redirectURL(r *http.Request) string {
+	if oauthConfig.RedirectURL != "" {
+		return oauthConfig.RedirectURL
+	}
+	return baseURL(r) + "/auth/callback"
+}
+
+// loginHandler redirects to the provider (/auth/login?next=<url>). State,
+// PKCE verifier and next URL are kept in a short-lived cookie.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state, verifier := hex.EncodeToString(b), oauth2.GenerateVerifier()
+	setCookie(w, r, StateCookie, url.Values{"state": {state}, "verifier": {verifier}, "next": {next}}.Encode(), 10*time.Minute)
+	u := oauthConfig.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("redirect_uri", redirectURL(r)))
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// callbackHandler gets the user from the provider and starts a session.
+func callbackHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(StateCookie)
+	if err != nil {
+		http.Error(w, "login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	setCookie(w, r, StateCookie, "", -1)
+	st, _ := url.ParseQuery(c.Value)
+	if st.Get("state") == "" || r.FormValue("state") != st.Get("state") {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		http.Error(w, "login failed: "+e, http.StatusForbidden)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	tok, err := oauthConfig.Exchange(ctx, r.FormValue("code"), oauth2.VerifierOption(st.Get("verifier")), oauth2.SetAuthURLParam("redirect_uri", redirectURL(r)))
+	if err != nil {
+		logger(r.Context()).Error("Unable to get OAuth2 token", "err", err)
+		http.Error(w, "login failed", http.StatusForbidden)
+		return
+	}
+	user, err := fetchUser(oauthConfig.Client(ctx, tok))
+	if err != nil {
+		logger(r.Context()).Error("Unable to get user info", "err", err)
+		http.Error(w, "login failed", http.StatusForbidden)
+		return
+	}
+	if !isAllowedUser(*oauthAllow, user) {
+		logger(r.Context()).Warn("Login denied", "login", user, "remote", r.RemoteAddr)
+		http.Error(w, fmt.Sprintf("user '%s' isn't allowed", user), http.StatusForbidden)
+		return
+	}
+	setCookie(w, r, SessionCookie, sessionValue(user, time.Now().Add(*sessionMaxAge)), *sessionMaxAge)
+	audit(withUser(r, user), "login", "")
+	http.Redirect(w, r, st.Get("next"), http.StatusFound)
+}
+
+// fetchUser returns the user name from the user info of the provider.
+func fetchUser(client *http.Client) (string, error) {
+	resp, err := client.Get(userInfoURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("got status %s", resp.Status)
+	}
+	var info map[string]interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+	claim := *oauthUserClaim
+	if userInfoURL == GitHubUserURL {
+		claim = "login"
+	}
+	if claim == "email" && info["email_verified"] == false {
+		return "", fmt.Errorf("email address isn't verified")
+	}
+	user := toString(info[claim])
+	if user == "" {
+		return "", fmt.Errorf("no '%s' in the user info", claim)
+	}
+	return user, nil
+}
+
+// logoutHandler ends the session (/auth/logout).
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	setCookie(w, r, SessionCookie, "", -1)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	defer func(k []byte) { shareKey = k }(shareKey)
+	shareKey = []byte("test key")
+	now := time.Now()
+	valid := sessionValue("alice@example.org", now.Add(time.Hour))
+	for i, this := range []struct {
+		value  string
+		expect string
+	}{
+		{valid, "alice@example.org"},
+		{sessionValue("a:b c", now.Add(time.Hour)), "a:b c"},
+		{sessionValue("alice", now.Add(-time.Hour)), ""},
+		{strings.Replace(valid, "alice", "mallory", 1), ""},
+		{valid[:len(valid)-1], ""},
+		{"", ""},
+	} {
+		if got := sessionUser(this.value); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+}
+
+func TestIsAllowedUser(t *testing.T) {
+	for i, this := range []struct {
+		allow, user string
+		expect      bool
+	}{
+		{"", "anybody", true},
+		{"", "", false},
+		{"alice, @Example.org", "alice", true},
+		{"alice, @Example.org", "Bob@example.ORG", true},
+		{"alice, @Example.org", "bob@evil-example.org", false},
+		{"alice, @Example.org", "alice2", false},
+	} {
+		if got := isAllowedUser(this.allow, this.user); got != this.expect {
+			t.Errorf("[%d] got %t but expected %t", i, got, this.expect)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// An Obsidian vault is imported with wikilinks and embeds pointing to the
+// new page paths, YAML properties as front matter and the attachments moved
+// next to the first page using them (unused ones keep their folder).
+// Embedded notes become links since pages can't be transcluded.
+
+var (
+	obsidianLink    = regexp.MustCompile(`(!?)\[\[([^\]\n]+)\]\]`) // wikilink or embed
+	obsidianTag     = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+	obsidianCode    = regexp.MustCompile("`[^`\n]*`")
+	obsidianComment = regexp.MustCompile(`%%(.*?)%%`)
+	obsidianSize    = regexp.MustCompile(`^\d+(x\d+)?$`)
+)
+
+type obsidianNote struct {
+	src  string // vault path
+	page *Page
+	body []byte
+}
+
+type obsidianVault struct {
+	*importFiles
+	section string
+	notes   map[string]*obsidianNote // by lower case vault path (without .md), name and alias
+	files   map[string]string        // vault paths of attachments by lower case vault path and name
+}
+
+// importObsidian converts the notes and attachments of the vault at dir to
+// pages below section.
+func importObsidian(dir, section string) (*Import, error) {
+	v := &obsidianVault{importFiles: newImportFiles(dir), section: section, notes: make(map[string]*obsidianNote),
+		files: make(map[string]string)}
+	var notes []*obsidianNote
+	var files []string
+	err := filepath.WalkDir(dir, func(fn string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(de.Name(), ".") && fn != dir {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if de.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fn)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch ext := strings.ToLower(path.Ext(rel)); ext {
+		case Suffix:
+			notes = append(notes, &obsidianNote{src: rel})
+		case ".canvas":
+			v.imp.problem("canvas '%s' isn't imported", rel)
+		default:
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Shorter paths win for ambiguous names like in Obsidian.
+	byDepth := func(a, b string) bool {
+		if da, db := strings.Count(a, "/"), strings.Count(b, "/"); da != db {
+			return da < db
+		}
+		return a < b
+	}
+	sort.Slice(notes, func(i, j int) bool { return byDepth(notes[i].src, notes[j].src) })
+	sort.Slice(files, func(i, j int) bool { return byDepth(files[i], files[j]) })
+	for _, f := range files {
+		for _, k := range vaultKeys(f) {
+			if _, ok := v.files[k]; !ok {
+				v.files[k] = f
+			}
+		}
+	}
+	for _, n := range notes {
+		if err := v.readNote(n); err != nil {
+			v.imp.problem("unable to read note '%s': %s", n.src, err)
+			continue
+		}
+		for _, k := range vaultKeys(strings.TrimSuffix(n.src, path.Ext(n.src))) {
+			if _, ok := v.notes[k]; !ok {
+				v.notes[k] = n
+			}
+		}
+	}
+	for _, n := range notes {
+		if n.page == nil {
+			continue
+		}
+		var as []interface{}
+		for _, a := range toStrings(n.page.FrontMatter["aliases"]) {
+			ap := path.Join(attachmentDir(n.page.Path), slugify(a))
+			if _, ok := v.notes[strings.ToLower(a)]; !ok {
+				v.notes[strings.ToLower(a)] = n
+			}
+			if v.taken[ap] || slugify(a) == "" {
+				v.imp.problem("alias '%s' of note '%s' is dropped since its path is taken", a, n.src)
+				continue
+			}
+			v.taken[ap] = true
+			as = append(as, ap)
+		}
+		if as != nil {
+			n.page.FrontMatter["aliases"] = as
+		} else {
+			delete(n.page.FrontMatter, "aliases")
+		}
+	}
+	for _, n := range notes {
+		if n.page != nil {
+			n.page.Body = v.convert(n, n.body)
+			v.imp.Pages = append(v.imp.Pages, n.page)
+		}
+	}
+	for _, f := range files {
+		if v.placed[f] == nil {
+			v.place(f, v.pagePath(path.Dir(f)))
+		}
+	}
+	v.sortFiles()
+	return v.imp, nil
+}
+
+// vaultKeys returns the keys links may use for the vault path p: the
+// lower case path and name.
+func vaultKeys(p string) []string {
+	return []string{strings.ToLower(p), strings.ToLower(path.Base(p))}
+}
+
+// pagePath returns the page path for the vault path p (without .md).
+func (v *obsidianVault) pagePath(p string) string {
+	segs := []string{v.section}
+	if p != "." {
+		for _, s := range strings.Split(p, "/") {
+			if s = slugify(s); s == "" {
+				s = "note"
+			}
+			segs = append(segs, s)
+		}
+	}
+	return path.Join(segs...)
+}
+
+// readNote reads the note n and converts its properties to front matter.
+func (v *obsidianVault) readNote(n *obsidianNote) error {
+	b, err := os.ReadFile(filepath.Join(v.dir, filepath.FromSlash(n.src)))
+	if err != nil {
+		return err
+	}
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	fm := make(map[string]interface{})
+	if rest, ok := bytes.CutPrefix(b, []byte("---\n")); ok {
+		if i := bytes.Index(rest, []byte("\n---")); i >= 0 && (len(rest) == i+4 || rest[i+4] == '\n') {
+			props, err := parser.HandleYAMLMetaData(rest[:i])
+			if err != nil {
+				return fmt.Errorf("invalid properties: %s", err)
+			}
+			fm = props.(map[string]interface{})
+			b = bytes.TrimLeft(rest[i+4:], "\n")
+		}
+	}
+	name := strings.TrimSuffix(path.Base(n.src), path.Ext(n.src))
+	p := NewPage(v.pagePath(strings.TrimSuffix(n.src, path.Ext(n.src))))
+	p.Mark = '-'
+	p.Path = uniqueName(v.taken, p.Path)
+	if !isValidPath(p.Path) {
+		return fmt.Errorf("%w '%s'", ErrInvalidPath, p.Path)
+	}
+	for k, val := range fm {
+		switch lk := strings.ToLower(k); lk {
+		case "tags", "tag":
+			p.FrontMatter["tags"] = obsidianTags(val)
+		case "aliases", "alias":
+			p.FrontMatter["aliases"] = toStrings(val)
+		case "created", "date":
+			p.FrontMatter["date"] = val
+		case "updated", "modified", "lastmod":
+			p.FrontMatter["lastmod"] = val
+		case "title", "description", "draft":
+			p.FrontMatter[lk] = val
+		default:
+			p.FrontMatter[k] = val
+		}
+	}
+	if _, ok := p.FrontMatter["title"]; !ok {
+		p.FrontMatter["title"] = name
+	}
+	if _, ok := p.FrontMatter["date"]; !ok {
+		if fi, err := os.Stat(filepath.Join(v.dir, filepath.FromSlash(n.src))); err == nil {
+			p.FrontMatter["date"] = fi.ModTime().UTC().Format(time.RFC3339)
+		}
+	}
+	n.page, n.body = p, b
+	return nil
+}
+
+// obsidianTags returns the tags of the property val (a list or a comma or
+// space separated string) without "#".
+func obsidianTags(val interface{}) []interface{} {
+	ts := toStrings(val)
+	if s, ok := val.(string); ok {
+		ts = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	tags := []interface{}{}
+	for _, t := range ts {
+		if t = strings.TrimPrefix(strings.TrimSpace(t), "#"); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// convert returns the body of note n with links and embeds translated and
+// adds its inline tags.
+func (v *obsidianVault) convert(n *obsidianNote, body []byte) []byte {
+	var out []string
+	fence, comment := "", false
+	for _, line := range strings.Split(string(body), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			if lang := strings.TrimSpace(trimmed[3:]); lang == "dataview" || lang == "dataviewjs" || lang == "query" {
+				v.imp.problem("%s block in '%s' is kept as code", lang, n.src)
+			}
+		case trimmed == "%%":
+			if comment = !comment; comment {
+				line = "<!--"
+			} else {
+				line = "-->"
+			}
+		case !comment:
+			line = v.convertLine(n, line)
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+// convertLine translates the line outside of code spans.
+func (v *obsidianVault) convertLine(n *obsidianNote, line string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range append(obsidianCode.FindAllStringIndex(line, -1), []int{len(line), len(line)}) {
+		s := line[last:m[0]]
+		s = obsidianComment.ReplaceAllString(s, "<!--$1-->")
+		s = importMdLink.ReplaceAllStringFunc(s, func(l string) string { return v.markdownLink(n, l) })
+		s = obsidianLink.ReplaceAllStringFunc(s, func(l string) string {
+			if strings.HasPrefix(l, "!") {
+				return v.embed(n, l[3:len(l)-2], l)
+			}
+			return v.wikiLink(n, l[2:len(l)-2], l)
+		})
+		for _, t := range obsidianTag.FindAllStringSubmatch(s, -1) {
+			if strings.Trim(t[1], "0123456789") != "" {
+				v.addTag(n.page, t[1])
+			}
+		}
+		sb.WriteString(s)
+		sb.WriteString(line[m[0]:m[1]])
+		last = m[1]
+	}
+	return sb.String()
+}
+
+func (v *obsidianVault) addTag(p *Page, tag string) {
+	tags, _ := p.FrontMatter["tags"].([]interface{})
+	for _, t := range tags {
+		if t == tag {
+			return
+		}
+	}
+	p.FrontMatter["tags"] = append(tags, tag)
+}
+
+// splitLink splits the inner text of a wikilink into target, anchor
+// (without "#") and label.
+func splitLink(s string) (target, anchor, label string) {
+	s, label, _ = strings.Cut(s, "|")
+	target, anchor, _ = strings.Cut(s, "#")
+	return strings.TrimSpace(target), strings.TrimSpace(anchor), strings.TrimSpace(label)
+}
+
+// note returns the note the link target t refers to.
+func (v *obsidianVault) note(t string) *obsidianNote {
+	return v.notes[strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(t, "/"), Suffix))]
+}
+
+// file returns the URL of the attachment the link target t refers to for
+// a link on note n.
+func (v *obsidianVault) file(n *obsidianNote, t string) (string, bool) {
+	src, ok := v.files[strings.ToLower(strings.TrimPrefix(t, "/"))]
+	if !ok {
+		return "", false
+	}
+	return v.url(src, attachmentDir(n.page.Path)), true
+}
+
+// pageLink returns the wikilink to the page at p with anchor and label.
+func pageLink(p, anchor, label string) string {
+	if anchor != "" {
+		p += "#" + anchor
+	}
+	if label != "" {
+		p += "|" + label
+	}
+	return "[[" + p + "]]"
+}
+
+// wikiLink translates the wikilink with the inner text s (the text l) on
+// note n.
+func (v *obsidianVault) wikiLink(n *obsidianNote, s, l string) string {
+	target, anchor, label := splitLink(s)
+	if strings.HasPrefix(anchor, "^") {
+		v.imp.problem("block reference '%s' in '%s' became a link to the page", s, n.src)
+		anchor = ""
+	}
+	if anchor != "" {
+		anchor = slugify(anchor)
+	}
+	if target == "" {
+		return pageLink(n.page.Path, anchor, label)
+	}
+	if label == "" {
+		label = target
+	}
+	if to := v.note(target); to != nil {
+		return pageLink(to.page.Path, anchor, label)
+	}
+	if u, ok := v.file(n, target); ok {
+		return "[" + label + "](" + u + ")"
+	}
+	if ext := path.Ext(target); ext != "" && ext != Suffix {
+		v.imp.problem("link to missing file '%s' in '%s' is kept", target, n.src)
+		return l
+	}
+	v.imp.problem("link to missing note '%s' in '%s'", target, n.src)
+	return pageLink(v.pagePath(strings.TrimSuffix(target, Suffix)), anchor, label)
+}
+
+// embed translates the embed ![[s]] (the text e) on note n.
+func (v *obsidianVault) embed(n *obsidianNote, s, e string) string {
+	target, _, label := splitLink(s)
+	if obsidianSize.MatchString(label) {
+		label = ""
+		s, _, _ = strings.Cut(s, "|")
+	}
+	if u, ok := v.file(n, target); ok {
+		if label == "" {
+			label = strings.TrimSuffix(path.Base(target), path.Ext(target))
+		}
+		if imageExtensions[strings.ToLower(path.Ext(target))] {
+			return "![" + label + "](" + u + ")"
+		}
+		v.imp.problem("embedded file '%s' in '%s' became a link", target, n.src)
+		return "[" + label + "](" + u + ")"
+	}
+	if ext := path.Ext(target); ext != "" && ext != Suffix {
+		v.imp.problem("embed of missing file '%s' in '%s' is kept", target, n.src)
+		return e
+	}
+	if v.note(target) != nil {
+		v.imp.problem("embedded note '%s' in '%s' became a link", target, n.src)
+	}
+	return v.wikiLink(n, s, e)
+}
+
+// markdownLink translates the Markdown link or image l on note n if it
+// points into the vault.
+func (v *obsidianVault) markdownLink(n *obsidianNote, l string) string {
+	m := importMdLink.FindStringSubmatch(l)
+	t := m[3] + m[4]
+	if t == "" || externalLink.MatchString(t) || strings.HasPrefix(t, "#") || strings.HasPrefix(t, "/files/") {
+		return l
+	}
+	if u, err := url.PathUnescape(t); err == nil {
+		t = u
+	}
+	t, anchor, _ := strings.Cut(t, "#")
+	// relative to the note first, then like wikilinks
+	for _, c := range []string{path.Join(path.Dir(n.src), t), t} {
+		if to := v.note(c); to != nil {
+			if anchor != "" {
+				anchor = slugify(anchor)
+			}
+			return m[1] + "[" + m[2] + "](" + pageURL(to.page.Path, anchor) + ")"
+		}
+		if u, ok := v.file(n, c); ok {
+			return m[1] + "[" + m[2] + "](" + u + ")"
+		}
+	}
+	return l
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportObsidian(t *testing.T) {
+	vault := t.TempDir()
+	for fn, content := range map[string]string{
+		"Big Idea.md": "---\ntags: [idea, \"#work\"]\naliases: [The Idea]\ncreated: 2024-01-02\n---\n" +
+			"See [[Other Note#Some Heading|other]], [[The Idea]] and [[Missing]].\n" +
+			"![[diagram.png|300]] ![[Other Note]] [doc](files/Spec%20Sheet.pdf)\n" +
+			"#project `[[code]]` %%hidden%%\n```dataview\nLIST\n```\n",
+		"Notes/Other Note.md":    "Back to [[Big Idea#^abc]] and [its intro](../Big%20Idea.md#Intro).\n![[diagram.png]]\n",
+		"files/diagram.png":      "png",
+		"files/Spec Sheet.pdf":   "pdf",
+		"files/unused.txt":       "txt",
+		".obsidian/app.json":     "{}",
+		"Board.canvas":           "{}",
+		"Notes/.trash/gone.md":   "gone",
+		"Notes/Sub/Deep Note.md": "[[Other Note]]",
+	} {
+		fn = filepath.Join(vault, filepath.FromSlash(fn))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imp, err := importObsidian(vault, "kb")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pages := make(map[string]*Page)
+	for _, p := range imp.Pages {
+		pages[p.Path] = p
+	}
+	for i, this := range []struct {
+		path  string
+		title string
+		tags  []interface{}
+		body  string
+	}{
+		{"kb/big-idea", "Big Idea", []interface{}{"idea", "work", "project"},
+			"See [[kb/notes/other-note#some-heading|other]], [[kb/big-idea|The Idea]] and [[kb/missing|Missing]].\n" +
+				"![diagram](/files/kb/diagram.png) [[kb/notes/other-note|Other Note]] [doc](/files/kb/spec-sheet.pdf)\n" +
+				"#project `[[code]]` <!--hidden-->\n```dataview\nLIST\n```\n"},
+		{"kb/notes/other-note", "Other Note", nil, "Back to [[kb/big-idea|Big Idea]] and [its intro](/view/kb/big-idea#intro).\n![diagram](/files/kb/diagram.png)\n"},
+		{"kb/notes/sub/deep-note", "Deep Note", nil, "[[kb/notes/other-note|Other Note]]"},
+	} {
+		p := pages[this.path]
+		if p == nil {
+			t.Errorf("[%d] page %s is missing", i, this.path)
+			continue
+		}
+		if p.Title() != this.title || string(p.Body) != this.body {
+			t.Errorf("[%d] got title %q and body %q but expected %q and %q", i, p.Title(), p.Body, this.title, this.body)
+		}
+		if tags, _ := p.FrontMatter["tags"].([]interface{}); !reflect.DeepEqual(tags, this.tags) {
+			t.Errorf("[%d] got tags %v but expected %v", i, tags, this.tags)
+		}
+	}
+	if len(imp.Pages) != 3 {
+		t.Errorf("got %d pages but expected 3", len(imp.Pages))
+	}
+	if as := pages["kb/big-idea"].FrontMatter["aliases"]; !reflect.DeepEqual(as, []interface{}{"kb/the-idea"}) {
+		t.Errorf("got aliases %v", as)
+	}
+	var files []string
+	for _, f := range imp.Files {
+		files = append(files, f.Dir+"/"+f.Name)
+	}
+	if expect := []string{"kb/diagram.png", "kb/files/unused.txt", "kb/spec-sheet.pdf"}; !reflect.DeepEqual(files, expect) {
+		t.Errorf("got files %v but expected %v", files, expect)
+	}
+	problems := strings.Join(imp.Problems, "\n")
+	for _, p := range []string{"canvas 'Board.canvas'", "missing note 'Missing'", "embedded note 'Other Note'", "dataview block", "block reference 'Big Idea#^abc'"} {
+		if !strings.Contains(problems, p) {
+			t.Errorf("problem %q wasn't reported in %q", p, problems)
+		}
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	taken := make(map[string]bool)
+	for i, this := range []struct {
+		name   string
+		expect string
+	}{
+		{"a.png", "a.png"},
+		{"a.png", "a-2.png"},
+		{"a.png", "a-3.png"},
+		{"docs/a", "docs/a"},
+		{"docs/a", "docs/a-2"},
+	} {
+		if got := uniqueName(taken, this.name); got != this.expect {
+			t.Errorf("[%d] got %s but expected %s", i, got, this.expect)
+		}
+	}
+}
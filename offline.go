@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Offline clients queue edits together with the revision of the page they
+// were based on and send them as a batch when they are online again.
+// Edits whose page changed in the meantime are rejected as conflicts so
+// the client can merge them.
+
+const (
+	BatchMaxEdits = 100
+	BatchMaxPages = 4 // size of a batch in maximum page sizes
+)
+
+// revision identifies the stored content of a page.
+func revision(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:12])
+}
+
+// QueuedEdit is an edit made offline. An empty Base creates a new page.
+type QueuedEdit struct {
+	Path        string                 `json:"path"`
+	Base        string                 `json:"base"`
+	FrontMatter map[string]interface{} `json:"frontMatter,omitempty"` // merged into the existing front matter, null removes a field
+	Body        *string                `json:"body,omitempty"`        // unchanged if missing
+	Summary     string                 `json:"summary,omitempty"`
+}
+
+// EditResult is the outcome of a queued edit. Revision is the new
+// revision if the edit was applied and the current one on conflicts.
+type EditResult struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"` // "applied", "conflict", "review", "error" or "unchanged" (CSV import)
+	Revision string `json:"revision,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// batchRevisions are the revisions of a page before the first and after
+// the last edit of a batch applied to it.
+type batchRevisions struct {
+	before, after string
+}
+
+// applyEdits applies the edits in order. Several edits of the same page
+// may all use the revision from before the batch as base unless the page
+// was changed by somebody else between them.
+func applyEdits(r *http.Request, edits []QueuedEdit) []EditResult {
+	results := make([]EditResult, len(edits))
+	applied := make(map[string]*batchRevisions)
+	for i, e := range edits {
+		res := &results[i]
+		res.Path = e.Path
+		p, err := applyEdit(r, e, applied)
+		switch {
+		case err == errConflict:
+			res.Status = "conflict"
+		case errors.Is(err, errReview):
+			res.Status = "review"
+		case err != nil:
+			res.Status, res.Error = "error", err.Error()
+		default:
+			res.Status = "applied"
+		}
+		if p != nil {
+			res.Revision = p.Revision
+		}
+	}
+	return results
+}
+
+var errConflict = errors.New("page was changed")
+
+// applyEdit returns the current page on conflicts and the saved one on
+// success. Checking the base revision and saving happen under the lock of
+// the page.
+func applyEdit(r *http.Request, e QueuedEdit, applied map[string]*batchRevisions) (*Page, error) {
+	if !isValidPath(e.Path) {
+		return nil, fmt.Errorf("invalid page path '%s'", e.Path)
+	}
+	if !tokenAllows(r, e.Path) {
+		return nil, fmt.Errorf("API token isn't allowed to change '%s'", e.Path)
+	}
+	if !acls.Allowed(currentUser(r), e.Path, true) {
+		return nil, fmt.Errorf("not allowed to change '%s'", e.Path)
+	}
+	if e.Body != nil && int64(len(*e.Body)) > *maxPageSize {
+		return nil, fmt.Errorf("page '%s' is larger than %d bytes", e.Path, *maxPageSize)
+	}
+	defer lockPage(e.Path)()
+	p, err := loadPage(r.Context(), e.Path)
+	if os.IsNotExist(err) {
+		p, err = NewPage(e.Path), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revs, ok := applied[e.Path]; p.Revision != e.Base && !(ok && revs.before == e.Base && revs.after == p.Revision) {
+		return p, errConflict
+	}
+	old := p.Copy()
+	for k, v := range e.FrontMatter {
+		if v == nil {
+			delete(p.FrontMatter, k)
+		} else {
+			p.FrontMatter[k] = v
+		}
+	}
+	if e.Body != nil {
+		p.Body = []byte(*e.Body)
+	}
+	if err = checkPage(old, p); err != nil {
+		return nil, err
+	}
+	if err = storePage(r, p, old, e.Summary); errors.Is(err, errReview) {
+		return old, err
+	} else if err != nil {
+		return nil, err
+	}
+	if revs, ok := applied[e.Path]; ok {
+		revs.after = p.Revision
+	} else {
+		applied[e.Path] = &batchRevisions{before: old.Revision, after: p.Revision}
+	}
+	return p, nil
+}
+
+// batchHandler applies queued edits (POST /api/v1/batch with
+// {"edits": [...]}) and returns {"results": [...]} in the same order.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Edits []QueuedEdit `json:"edits"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, BatchMaxPages**maxPageSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Edits) > BatchMaxEdits {
+		http.Error(w, fmt.Sprintf("more than %d edits", BatchMaxEdits), http.StatusRequestEntityTooLarge)
+		return
+	}
+	results := applyEdits(r, req.Edits)
+	for _, res := range results {
+		if res.Status != "applied" {
+			logger(r.Context()).Info("Queued edit not applied", "path", res.Path, "status", res.Status, "err", res.Error)
+		}
+	}
+	writeJSON(w, map[string]interface{}{"results": results})
+}
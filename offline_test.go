@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyEdits(t *testing.T) {
+	testSetup(t)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r := httptest.NewRequest("POST", "/api/v1/batch", nil)
+	text := func(s string) *string { return &s }
+	body := func(path string) string {
+		p, err := LoadPage(path)
+		if err != nil {
+			return err.Error()
+		}
+		return strings.TrimSpace(string(p.Body))
+	}
+
+	res := applyEdits(r, []QueuedEdit{{Path: "a", Body: text("one")}})
+	base := res[0].Revision
+	res = applyEdits(r, []QueuedEdit{
+		{Path: "a", Base: base, Body: text("two")},
+		{Path: "a", Base: base, Body: text("three")},
+		{Path: "b", Base: "stale", Body: text("new")},
+		{Path: "../c", Body: text("c")},
+	})
+	for i, expect := range []string{"applied", "applied", "conflict", "error"} {
+		if res[i].Status != expect {
+			t.Errorf("[%d] got status %s but expected %s", i, res[i].Status, expect)
+		}
+	}
+	if got := body("a"); got != "three" {
+		t.Errorf("got body %q", got)
+	}
+
+	// a save between two edits of a batch is a conflict for the second
+	base = res[1].Revision
+	applied := make(map[string]*batchRevisions)
+	if _, err := applyEdit(r, QueuedEdit{Path: "a", Base: base, Body: text("four")}, applied); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p, _ := LoadPage("a")
+	old := p.Copy()
+	p.Body = []byte("between")
+	if err := storePage(r, p, old, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := applyEdit(r, QueuedEdit{Path: "a", Base: base, Body: text("five")}, applied); err != errConflict || body("a") != "between" {
+		t.Errorf("got %v and body %q for an edit after a save by somebody else", err, body("a"))
+	}
+
+	// batches wait for saves in progress
+	p, _ = LoadPage("a")
+	base = p.Revision
+	unlock := lockPage("a")
+	done := make(chan []EditResult)
+	go func() {
+		done <- applyEdits(r, []QueuedEdit{{Path: "a", Base: base, Body: text("four")}, {Path: "a", Base: base, Body: text("five")}})
+	}()
+	select {
+	case <-done:
+		t.Fatalf("the batch didn't wait for the lock of the page")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-done
+	go func() {
+		defer lockPage("a")()
+		time.Sleep(50 * time.Millisecond)
+		p, _ := LoadPage("a")
+		old := p.Copy()
+		p.Body = []byte("saved")
+		storePage(r, p, old, "")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	res = applyEdits(r, []QueuedEdit{{Path: "a", Base: base, Body: text("six")}})
+	if res[0].Status != "conflict" || body("a") != "saved" {
+		t.Errorf("got status %s and body %q after a concurrent save", res[0].Status, body("a"))
+	}
+}
+
+func TestSaveHandlerLock(t *testing.T) {
+	testSetup(t)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	unlock := lockPage("a")
+	done := make(chan bool)
+	go func() {
+		r := httptest.NewRequest("POST", "/save/a", strings.NewReader(url.Values{"body": {"form"}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		makeHandler(saveHandler)(httptest.NewRecorder(), r)
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Fatalf("the save didn't wait for the lock of the page")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-done
+	if p, err := LoadPage("a"); err != nil || strings.TrimSpace(string(p.Body)) != "form" {
+		t.Errorf("got page %v (%v)", p, err)
+	}
+	if len(pageLocks.m) != 0 {
+		t.Errorf("got %d unused page locks", len(pageLocks.m))
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The OpenAPI 3 document of the JSON API is generated from the endpoint
+// list below and the Go types of the requests and responses, so it can't
+// get out of sync with the JSON they are encoded to.
+
+const OpenAPIVersion = "3.0.3"
+
+// apiParam is a query (or form) parameter of an endpoint.
+type apiParam struct {
+	Name, Type, Description string
+}
+
+// apiEndpoint describes a JSON API endpoint. Response is a Go value of
+// the response type or a schema map.
+type apiEndpoint struct {
+	Path, Method, Summary string
+	Params                []apiParam
+	Request               interface{} // JSON body (nil for none)
+	Form                  []apiParam  // form encoded body
+	Multipart             bool        // Form is multipart/form-data
+	Response              interface{}
+	ContentType           string            // of the response (default JSON)
+	Empty                 map[string]string // status -> description of responses without body
+}
+
+var (
+	draftsParam = apiParam{"drafts", "boolean", "include drafts"}
+	offsetParam = apiParam{"offset", "integer", "number of entries to skip"}
+	limitParam  = apiParam{"limit", "integer", "maximum number of entries"}
+	pathParam   = apiParam{"path", "string", "page path without extension"}
+)
+
+// apiSchemaNames renames Go types in the document.
+var apiSchemaNames = map[reflect.Type]string{
+	reflect.TypeOf(PageInfo{}): "Page",
+}
+
+// paginated is the schema of a page of a listing with the entries in key.
+func paginated(key string, entry interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "object",
+		"required": []string{"total", "offset", "limit", key},
+		"properties": map[string]interface{}{
+			"total":  map[string]interface{}{"type": "integer"},
+			"offset": map[string]interface{}{"type": "integer"},
+			"limit":  map[string]interface{}{"type": "integer"},
+			key:      map[string]interface{}{"type": "array", "items": entry},
+		},
+	}
+}
+
+func apiEndpoints() []apiEndpoint {
+	return []apiEndpoint{
+		{Path: "/api/v1/pages", Method: "get", Summary: "List and search pages",
+			Params:   []apiParam{{"filter", "string", "front matter filter expression"}, {"q", "string", "full text query"}, draftsParam, offsetParam, limitParam},
+			Response: paginated("pages", PageInfo{})},
+		{Path: "/api/v1/canonical/{path}", Method: "get", Summary: "Page in canonical form",
+			Params:   []apiParam{pathParam, {"format", "string", "front matter format: yaml, toml or json"}, {"order", "string", "key order: sorted or schema"}},
+			Response: map[string]interface{}{"type": "string"}, ContentType: "text/markdown"},
+		{Path: "/api/v1/batch", Method: "post", Summary: "Apply queued edits",
+			Request: struct {
+				Edits []QueuedEdit `json:"edits"`
+			}{},
+			Response: struct {
+				Results []EditResult `json:"results"`
+			}{}},
+		{Path: "/api/v1/tree", Method: "get", Summary: "Content tree", Params: []apiParam{draftsParam}, Response: TreeNode{}},
+		{Path: "/api/v1/graph", Method: "get", Summary: "Link graph", Params: []apiParam{draftsParam}, Response: Graph{}},
+		{Path: "/api/v1/book", Method: "get", Summary: "Reading order",
+			Params: []apiParam{{"lang", "string", "language code"}}, Response: []BookLink{}},
+		{Path: "/api/v1/book/{path}", Method: "get", Summary: "Previous and next page in reading order",
+			Params: []apiParam{pathParam}, Response: BookNav{}},
+		{Path: "/api/v1/tags", Method: "get", Summary: "Tag suggestions",
+			Params: []apiParam{{"q", "string", "tag prefix"}, limitParam}, Response: []TagCount{}},
+		{Path: "/api/v1/tags/rename", Method: "post", Summary: "Rename or merge a tag",
+			Form: []apiParam{{"from", "string", "old tag"}, {"to", "string", "new tag"}},
+			Response: struct {
+				Touched []string `json:"touched"`
+				Error   string   `json:"error,omitempty"`
+			}{}},
+		{Path: "/api/v1/activity", Method: "get", Summary: "Activity stream",
+			Params:   []apiParam{{"section", "string", "only pages of the section"}, draftsParam, offsetParam, limitParam},
+			Response: paginated("entries", Activity{})},
+		{Path: "/api/v1/audit", Method: "get", Summary: "Audit log",
+			Params: []apiParam{{"user", "string", "user name"}, {"path", "string", "path prefix"}, {"action", "string", "action, e.g. save"},
+				{"from", "string", "start time (RFC 3339 or date)"}, {"to", "string", "end time (RFC 3339 or date)"}, {"format", "string", "csv for CSV"}, offsetParam, limitParam},
+			Response: paginated("entries", AuditEntry{})},
+		{Path: MicropubPath, Method: "get", Summary: "Micropub configuration and post source",
+			Params:   []apiParam{{"q", "string", "config, syndicate-to or source"}, {"url", "string", "post URL for q=source"}},
+			Response: map[string]interface{}{"type": "object"}},
+		{Path: MicropubPath, Method: "post", Summary: "Create, update or delete a post (Micropub, also as JSON)",
+			Form: []apiParam{{"h", "string", "entry"}, {"content", "string", "page body"}, {"name", "string", "title"}, {"summary", "string", "description"},
+				{"category[]", "string", "tag"}, {"published", "string", "date"}, {"post-status", "string", "draft or published"}, {"mp-slug", "string", "file name"},
+				{"action", "string", "update or delete"}, {"url", "string", "post URL for actions"}},
+			Empty: map[string]string{"201": "post created (Location header)", "202": "post awaits approval (Location header)", "204": "post updated or deleted"}},
+		{Path: MicropubMediaPath, Method: "post", Summary: "Upload a file for a post (Micropub media endpoint)",
+			Form: []apiParam{{"file", "string", "the file"}}, Multipart: true,
+			Empty: map[string]string{"201": "file uploaded (Location header)"}},
+		{Path: "/api/v1/export", Method: "get", Summary: "All pages of a section as zip of the page files or JSON lines (ExportedPage)",
+			Params:      []apiParam{{"section", "string", "only pages of the section"}, {"format", "string", "zip (default) or jsonl"}, draftsParam},
+			ContentType: "application/zip", Response: map[string]interface{}{"type": "string", "format": "binary"}},
+		{Path: "/api/v1/frontmatter", Method: "get", Summary: "Front matter fields of all pages of a section as CSV",
+			Params:      []apiParam{{"fields", "string", "fields separated by commas (default title,date,draft,tags)"}, {"section", "string", "only pages of the section"}, draftsParam},
+			ContentType: "text/csv", Response: map[string]interface{}{"type": "string"}},
+		{Path: "/api/v1/frontmatter", Method: "post", Summary: "Apply the changed cells of the front matter CSV (also as body)",
+			Form: []apiParam{{"file", "string", "the CSV with the columns path, revision and the fields"}}, Multipart: true,
+			Response: struct {
+				Results []EditResult `json:"results"`
+			}{}},
+		{Path: ClipPath, Method: "post", Summary: "Create a draft page from a web page with its images",
+			Form:     []apiParam{{"url", "string", "URL of the web page"}, {"section", "string", "section of the page"}, {"title", "string", "title instead of the one of the web page"}, {"tags", "string", "tags separated by commas"}},
+			Response: ClipResult{}},
+		{Path: MailInPath, Method: "post", Summary: "Create a draft page from a raw mail (also as body) with its attachments",
+			Params: []apiParam{{"section", "string", "section of the page"}},
+			Form:   []apiParam{{"message", "string", "the raw mail (also as email or body-mime)"}}, Multipart: true,
+			Response: ImportReport{}},
+		{Path: GraphQLPath, Method: "get", Summary: "GraphQL query or, without query, the GraphQL schema",
+			Params:   []apiParam{{"query", "string", "GraphQL query"}, {"variables", "string", "variables as JSON object"}, {"operationName", "string", "operation to execute"}},
+			Response: map[string]interface{}{"type": "object"}},
+		{Path: GraphQLPath, Method: "post", Summary: "GraphQL query or mutation",
+			Request: graphQLRequest{}, Response: map[string]interface{}{"type": "object"}},
+	}
+}
+
+// apiSchemas generates the schemas of Go types. Named structs are added
+// to the components.
+type apiSchemas map[string]interface{}
+
+func (s apiSchemas) of(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		return s.resolve(m)
+	}
+	return s.schema(reflect.TypeOf(v))
+}
+
+// resolve replaces Go values in the schema map m by their schema.
+func (s apiSchemas) resolve(m map[string]interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if k == "properties" {
+				ps := make(map[string]interface{}, len(v))
+				for pk, pv := range v {
+					ps[pk] = s.of(pv)
+				}
+				r[k] = ps
+			} else {
+				r[k] = s.resolve(v)
+			}
+		case string, []string:
+			r[k] = v
+		default:
+			r[k] = s.of(v)
+		}
+	}
+	return r
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s apiSchemas) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		return s.schema(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": true}
+	case t.Kind() == reflect.Interface:
+		return map[string]interface{}{}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() != reflect.Struct:
+		return map[string]interface{}{}
+	}
+	name := apiSchemaNames[t]
+	if name == "" {
+		name = t.Name()
+	}
+	if name != "" {
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if _, ok := s[name]; !ok {
+			s[name] = ref // breaks cycles, e.g. of TreeNode
+			s[name] = s.object(t)
+		}
+		return ref
+	}
+	return s.object(t)
+}
+
+// object is the schema of the struct type t with its JSON field names.
+// Fields without omitempty are required.
+func (s apiSchemas) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.schema(f.Type)
+		if opts != "omitempty" && f.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+	o := map[string]interface{}{"type": "object", "properties": props}
+	if required != nil {
+		o["required"] = required
+	}
+	return o
+}
+
+func apiParams(ps []apiParam, in string) []interface{} {
+	var params []interface{}
+	for _, p := range ps {
+		params = append(params, map[string]interface{}{
+			"name": p.Name, "in": in, "required": in == "path", "description": p.Description,
+			"schema": map[string]interface{}{"type": p.Type},
+		})
+	}
+	return params
+}
+
+// openAPIDocument returns the OpenAPI document of the JSON API served at
+// base.
+func openAPIDocument(base string) map[string]interface{} {
+	schemas := apiSchemas{}
+	paths := map[string]interface{}{}
+	for _, e := range apiEndpoints() {
+		op := map[string]interface{}{"summary": e.Summary}
+		var params []interface{}
+		for _, p := range e.Params {
+			in := "query"
+			if strings.Contains(e.Path, "{"+p.Name+"}") {
+				in = "path"
+			}
+			params = append(params, apiParams([]apiParam{p}, in)...)
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		switch {
+		case e.Request != nil:
+			op["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.of(e.Request)}}}
+		case e.Form != nil:
+			formType := "application/x-www-form-urlencoded"
+			if e.Multipart {
+				formType = "multipart/form-data"
+			}
+			props := map[string]interface{}{}
+			for _, p := range e.Form {
+				props[p.Name] = map[string]interface{}{"type": p.Type, "description": p.Description}
+			}
+			op["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+				formType: map[string]interface{}{"schema": map[string]interface{}{"type": "object", "properties": props}}}}
+		}
+		ct := e.ContentType
+		if ct == "" {
+			ct = "application/json"
+		}
+		responses := map[string]interface{}{}
+		if e.Response != nil {
+			responses["200"] = map[string]interface{}{"description": "OK", "content": map[string]interface{}{
+				ct: map[string]interface{}{"schema": schemas.of(e.Response)}}}
+		}
+		for status, desc := range e.Empty {
+			responses[status] = map[string]interface{}{"description": desc}
+		}
+		op["responses"] = responses
+		item, _ := paths[e.Path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[e.Path] = item
+		}
+		item[e.Method] = op
+	}
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info":    map[string]interface{}{"title": "gwiki API", "version": "1"},
+		"servers": []interface{}{map[string]interface{}{"url": base}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API token (" + TokenPrefix + "...)"},
+				"basic": map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"token": []string{}}, map[string]interface{}{"basic": []string{}}},
+	}
+}
+
+// openAPIHandler serves the OpenAPI document (/api/v1/openapi.json).
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, openAPIDocument(baseURL(r)))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := openAPIDocument("https://wiki.example.com")
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	paths := doc["paths"].(map[string]interface{})
+	for i, this := range []struct {
+		path, method string
+	}{
+		{"/api/v1/pages", "get"},
+		{"/api/v1/batch", "post"},
+		{"/api/v1/canonical/{path}", "get"},
+		{"/api/v1/tags/rename", "post"},
+	} {
+		item, _ := paths[this.path].(map[string]interface{})
+		if _, ok := item[this.method]; !ok {
+			t.Errorf("[%d] missing %s %s", i, this.method, this.path)
+		}
+	}
+	schemas := doc["components"].(map[string]interface{})["schemas"].(apiSchemas)
+	for i, this := range []struct {
+		schema, field string
+		expect        interface{}
+	}{
+		{"Page", "path", map[string]interface{}{"type": "string"}},
+		{"Page", "params", map[string]interface{}{"type": "object", "additionalProperties": true}},
+		{"AuditEntry", "time", map[string]interface{}{"type": "string", "format": "date-time"}},
+		{"TreeNode", "children", map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/TreeNode"}}},
+		{"BookNav", "prev", map[string]interface{}{"$ref": "#/components/schemas/BookLink"}},
+	} {
+		s, _ := schemas[this.schema].(map[string]interface{})
+		props, _ := s["properties"].(map[string]interface{})
+		if got := props[this.field]; !reflect.DeepEqual(got, this.expect) {
+			t.Errorf("[%d] got %v for %s.%s but expected %v", i, got, this.schema, this.field, this.expect)
+		}
+	}
+	if got := schemas["QueuedEdit"].(map[string]interface{})["required"]; !reflect.DeepEqual(got, []string{"path", "base"}) {
+		t.Errorf("got required %v but expected [path base]", got)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An owners file assigns pages to users, groups or mail addresses like a
+// CODEOWNERS file; the last matching rule wins:
+//
+//	# groups
+//	@docs = alice bob@example.org
+//	# rules: pattern owners...
+//	*          @docs
+//	/blog/     carol@example.org
+//	drafts/    # no owners
+//
+// Patterns without a slash (except a trailing one) match in every section,
+// "*" matches within a path segment and "**" across segments. Owners are
+// shown on pages and mailed about changes by others. With -owners-approval
+// changes by others become review requests owners have to approve.
+var (
+	ownersFile     = flag.String("owners-file", "./OWNERS", "file mapping page path patterns to owners")
+	ownersNotify   = flag.Bool("owners-notify", false, "mail owners (that are mail addresses) about changes of their pages by others")
+	ownersApproval = flag.Bool("owners-approval", false, "changes of owned pages by others need the approval of an owner")
+)
+
+type ownerRule struct {
+	pattern string
+	re      *regexp.Regexp
+	owners  []string
+}
+
+type ownerTable struct {
+	mutex   sync.Mutex
+	modTime time.Time
+	rules   []ownerRule
+	groups  map[string][]string
+}
+
+var owners = &ownerTable{}
+
+// ownerPattern converts a pattern of the owners file into a regexp for
+// page paths.
+func ownerPattern(pattern string) (*regexp.Regexp, error) {
+	p := strings.TrimSuffix(pattern, Suffix)
+	dir := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	q := regexp.QuoteMeta(p)
+	q = strings.Replace(q, `\*\*`, "\x00", -1)
+	q = strings.Replace(q, `\*`, "[^/]*", -1)
+	q = strings.Replace(q, `\?`, "[^/]", -1)
+	q = strings.Replace(q, "\x00", ".*", -1)
+	if !anchored {
+		q = "(?:.*/)?" + q
+	}
+	if dir {
+		q += "/.*"
+	} else {
+		q += "(?:/.*)?"
+	}
+	return regexp.Compile("^" + q + "$")
+}
+
+func parseOwners(sc *bufio.Scanner) ([]ownerRule, map[string][]string, error) {
+	var rules []ownerRule
+	groups := make(map[string][]string)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fs := strings.Fields(line)
+		if len(fs) == 0 {
+			continue
+		}
+		if len(fs) >= 2 && fs[1] == "=" && strings.HasPrefix(fs[0], "@") {
+			groups[fs[0]] = fs[2:]
+			continue
+		}
+		re, err := ownerPattern(fs[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		rules = append(rules, ownerRule{pattern: fs[0], re: re, owners: fs[1:]})
+	}
+	return rules, groups, sc.Err()
+}
+
+// load (re)reads the owners file if it changed.
+func (ot *ownerTable) load() {
+	fi, err := os.Stat(*ownersFile)
+	if err != nil {
+		ot.rules, ot.groups, ot.modTime = nil, nil, time.Time{}
+		return
+	}
+	if fi.ModTime().Equal(ot.modTime) {
+		return
+	}
+	f, err := os.Open(*ownersFile)
+	if err != nil {
+		slog.Error("Unable to read owners file", "file", *ownersFile, "err", err)
+		return
+	}
+	defer f.Close()
+	rules, groups, err := parseOwners(bufio.NewScanner(f))
+	if err != nil {
+		slog.Error("Unable to parse owners file", "file", *ownersFile, "err", err)
+		return
+	}
+	ot.rules, ot.groups, ot.modTime = rules, groups, fi.ModTime()
+}
+
+// Owners returns the owners of the page at path as written in the owners
+// file (groups aren't expanded).
+func (ot *ownerTable) Owners(path string) []string {
+	ot.mutex.Lock()
+	defer ot.mutex.Unlock()
+	ot.load()
+	for i := len(ot.rules) - 1; i >= 0; i-- {
+		if ot.rules[i].re.MatchString(path) {
+			return ot.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// Members returns the owners of the page at path with groups expanded.
+func (ot *ownerTable) Members(path string) []string {
+	raw := ot.Owners(path)
+	ot.mutex.Lock()
+	defer ot.mutex.Unlock()
+	var ms []string
+	for _, o := range raw {
+		if g, ok := ot.groups[o]; ok {
+			for _, m := range g {
+				if !contains(ms, m) {
+					ms = append(ms, m)
+				}
+			}
+		} else if !contains(ms, o) {
+			ms = append(ms, o)
+		}
+	}
+	return ms
+}
+
+// Group returns the members of the group name (e.g. "@docs").
+func (ot *ownerTable) Group(name string) []string {
+	ot.mutex.Lock()
+	defer ot.mutex.Unlock()
+	ot.load()
+	return ot.groups[name]
+}
+
+// IsOwner reports whether user owns the page at path.
+func (ot *ownerTable) IsOwner(user, path string) bool {
+	return contains(ot.Members(path), user)
+}
+
+// needsApproval reports whether the change of the page at path by the user
+// of r has to be approved by an owner.
+func needsApproval(r *http.Request, path string) bool {
+	if !*ownersApproval {
+		return false
+	}
+	ms := owners.Members(path)
+	return len(ms) > 0 && !contains(ms, currentUser(r))
+}
+
+// notifyOwners mails the owners of the page at path that are mail
+// addresses the mail name. The user causing the notification isn't mailed.
+func notifyOwners(r *http.Request, path, name, subject string, data interface{}) {
+	if !*ownersNotify {
+		return
+	}
+	user := currentUser(r)
+	var to []string
+	for _, m := range owners.Members(path) {
+		if m != user && strings.Contains(m, "@") && !strings.HasPrefix(m, "@") {
+			to = append(to, m)
+		}
+	}
+	if len(to) == 0 {
+		return
+	}
+	m, err := renderMail(name, subject, baseURL(r), data)
+	if err != nil {
+		logger(r.Context()).Error("Unable to render mail", "mail", name, "err", err)
+		return
+	}
+	goBackground(func() {
+		if err := sendMail(to, m); err != nil {
+			logger(r.Context()).Error("Unable to notify the owners", "path", path, "err", err)
+		}
+	})
+}
+
+func (p *Page) Owners() []string {
+	return owners.Owners(p.Path)
+}
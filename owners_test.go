@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOwnerPattern(t *testing.T) {
+	for i, this := range []struct {
+		pattern string
+		path    string
+		expect  bool
+	}{
+		{"*", "a/b/page", true},
+		{"/blog/", "blog/post", true},
+		{"/blog/", "blog", false},
+		{"/blog/", "docs/blog/post", false},
+		{"blog/", "docs/blog/post", true},
+		{"/docs/*.md", "docs/intro", true},
+		{"/docs/*", "docs/a/intro", true},
+		{"/docs/**/api", "docs/a/b/api", true},
+		{"intro", "docs/intro", true},
+		{"intro", "docs/introduction", false},
+	} {
+		re, err := ownerPattern(this.pattern)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		if got := re.MatchString(this.path); got != this.expect {
+			t.Errorf("[%d] got %t but expected %t for '%s' matching '%s'", i, got, this.expect, this.pattern, this.path)
+		}
+	}
+}
+
+func TestOwners(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "OWNERS")
+	err := ioutil.WriteFile(fn, []byte(`# groups
+@docs = alice bob@example.org
+*        @docs
+/blog/   carol   # the blog
+/blog/drafts/
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { *ownersFile = old }(*ownersFile)
+	*ownersFile = fn
+	ot := &ownerTable{}
+	for i, this := range []struct {
+		path    string
+		owners  []string
+		members []string
+	}{
+		{"intro", []string{"@docs"}, []string{"alice", "bob@example.org"}},
+		{"blog/post", []string{"carol"}, []string{"carol"}},
+		{"blog/drafts/post", []string{}, nil},
+	} {
+		if got := ot.Owners(this.path); !reflect.DeepEqual(got, this.owners) {
+			t.Errorf("[%d] got owners %q but expected %q", i, got, this.owners)
+		}
+		if got := ot.Members(this.path); !reflect.DeepEqual(got, this.members) {
+			t.Errorf("[%d] got members %q but expected %q", i, got, this.members)
+		}
+	}
+}
+
+func TestApproval(t *testing.T) {
+	testSetup(t)
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile("OWNERS", []byte("/owned/ carol carol@example.org\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(of, rd string, oa bool) { *ownersFile, *reviewsDir, *ownersApproval = of, rd, oa }(*ownersFile, *reviewsDir, *ownersApproval)
+	*ownersFile, *reviewsDir, *ownersApproval = filepath.Join(dir, "OWNERS"), dir, true
+	owners = &ownerTable{}
+	defer func() { owners = &ownerTable{} }()
+
+	carol, bob := localRequest("carol", "test"), localRequest("bob", "test")
+	p := NewPage("owned/page")
+	p.Body = []byte("by carol")
+	p.SetTags("old")
+	if err := storePage(carol, p, NewPage(p.Path), ""); err != nil {
+		t.Fatalf("the owner was refused: %s", err)
+	}
+	changed := func() bool {
+		p, err := LoadPage("owned/page")
+		return err != nil || strings.TrimSpace(string(p.Body)) != "by carol" || p.Tags()[0] != "old"
+	}
+
+	np := p.Copy()
+	np.Body = []byte("by bob")
+	if err := storePage(bob, np, p, ""); !errors.Is(err, errReview) {
+		t.Errorf("expected a review request for the save but got %v", err)
+	}
+	imp := &Import{Pages: []*Page{np}}
+	if rep := storeImport(bob, imp, true); len(rep.Pages) != 0 || len(rep.Reviews) != 1 {
+		t.Errorf("expected a review request for the import but got %+v", rep)
+	}
+	// the forged sender of a mail isn't trusted
+	mail := "From: carol@example.org\r\nSubject: Forged\r\n\r\nText\r\n"
+	request := func(user string) *http.Request { return localRequest(user, "test") }
+	if rep, err := receiveMail([]byte(mail), "owned", request); err != nil || len(rep.Pages) != 0 || len(rep.Reviews) != 1 {
+		t.Errorf("expected a review request for the mail but got %+v and %v", rep, err)
+	}
+	if err := renamePage(bob, "owned/page", "moved", nil, false); !errors.Is(err, errReview) {
+		t.Errorf("expected the rename to be refused but got %v", err)
+	}
+	if touched, err := renameTag(bob, "old", "new"); err != nil || len(touched) != 0 {
+		t.Errorf("expected no touched pages for the tag rename but got %q and %v", touched, err)
+	}
+	err := deletePage(bob, "owned/page")
+	var re *reviewError
+	if !errors.As(err, &re) || !re.review.Delete {
+		t.Fatalf("expected a review request for the deletion but got %v", err)
+	}
+	if changed() {
+		t.Fatalf("the page was changed without approval")
+	}
+	rvs, _ := listReviews()
+	if len(rvs) != 5 {
+		t.Errorf("got %d review requests", len(rvs))
+	}
+	if err = decideReview(carol, re.review, true); err != nil {
+		t.Fatalf("unable to approve the deletion: %s", err)
+	}
+	if pageExists("owned/page") {
+		t.Errorf("the approved deletion wasn't done")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"container/list"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Parsed pages are cached in memory. Saves and renames invalidate their
+// entries directly; changes by external editors or a git pull are noticed
+// by watching the content directory.
+var pageCacheSize = flag.Int("page-cache", 1000, "number of parsed pages kept in memory (0 disables the cache)")
+
+type pageCache struct {
+	mutex      sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // of *Page, most recently used first
+	generation int        // incremented on every invalidation
+}
+
+var cachedPages = &pageCache{entries: make(map[string]*list.Element), lru: list.New()}
+
+// Get returns a copy of the cached page at path.
+func (c *pageCache) Get(path string) (*Page, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[path]
+	if !ok {
+		atomic.AddUint64(&pageCacheMisses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&pageCacheHits, 1)
+	c.lru.MoveToFront(e)
+	return e.Value.(*Page).Copy(), true
+}
+
+// Len returns the number of cached pages.
+func (c *pageCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// Generation has to be read before loading a page that is added later.
+func (c *pageCache) Generation() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// Add caches a copy of p unless something was invalidated since gen.
+func (c *pageCache) Add(p *Page, gen int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if *pageCacheSize <= 0 || gen != c.generation {
+		return
+	}
+	if e, ok := c.entries[p.Path]; ok {
+		e.Value = p.Copy()
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[p.Path] = c.lru.PushFront(p.Copy())
+	for c.lru.Len() > *pageCacheSize {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*Page).Path)
+	}
+}
+
+// Invalidate removes the pages at paths from the cache.
+func (c *pageCache) Invalidate(paths ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	for _, path := range paths {
+		if e, ok := c.entries[path]; ok {
+			c.lru.Remove(e)
+			delete(c.entries, path)
+		}
+	}
+}
+
+// Clear empties the cache.
+func (c *pageCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// watchContent invalidates cached pages when their files change.
+func watchContent(dir string) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Unable to watch content, disabling the page cache", "err", err)
+		*pageCacheSize = 0
+		return
+	}
+	addDirs := func(root string) {
+		filepath.Walk(root, func(fn string, fi os.FileInfo, err error) error {
+			if err == nil && fi.IsDir() {
+				if err = w.Add(fn); err != nil {
+					slog.Warn("Unable to watch directory", "dir", fn, "err", err)
+				}
+			}
+			return nil
+		})
+	}
+	addDirs(dir)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&fsnotify.Create != 0 {
+					if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+						addDirs(ev.Name)
+					}
+				}
+				rel, err := filepath.Rel(dir, ev.Name)
+				if err != nil || strings.HasPrefix(filepath.Base(rel), ".") { // e.g. temporary files of saves
+					continue
+				}
+				if !strings.HasSuffix(rel, Suffix) {
+					// a removed or moved directory doesn't report its pages
+					if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+						cachedPages.Clear()
+					}
+					continue
+				}
+				cachedPages.Invalidate(strings.TrimSuffix(filepath.ToSlash(rel), Suffix))
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				// events may have been lost
+				slog.Warn("Error watching content, clearing the page cache", "err", err)
+				cachedPages.Clear()
+			}
+		}
+	}()
+}
+
+func initPageCache() {
+	if *pageCacheSize <= 0 {
+		return
+	}
+	if s, ok := store.(*fsStorage); ok {
+		if d, ok := s.fsys.(*dirFS); ok {
+			watchContent(d.Dir())
+		}
+	}
+}
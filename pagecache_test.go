@@ -0,0 +1,41 @@
+package main
+
+import (
+	"container/list"
+	"testing"
+)
+
+func TestPageCache(t *testing.T) {
+	size := *pageCacheSize
+	defer func() { *pageCacheSize = size }()
+	*pageCacheSize = 2
+	c := &pageCache{entries: make(map[string]*list.Element), lru: list.New()}
+
+	gen := c.Generation()
+	c.Add(NewPage("a"), gen)
+	c.Add(NewPage("b"), gen)
+	c.Get("a")
+	c.Add(NewPage("c"), gen) // evicts b
+	stale := c.Generation()
+	c.Invalidate("c")
+	c.Add(NewPage("c"), stale) // loaded before the invalidation
+
+	for i, this := range []struct {
+		path   string
+		expect bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", false},
+	} {
+		if _, result := c.Get(this.path); result != this.expect {
+			t.Errorf("[%d] got %t but expected %t", i, result, this.expect)
+		}
+	}
+
+	p, _ := c.Get("a")
+	p.SetTitle("changed")
+	if p, _ = c.Get("a"); p.Title() != "" {
+		t.Errorf("got title %q but expected the cached page to be unchanged", p.Title())
+	}
+}
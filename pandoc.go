@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// With -pandoc pages are exported to other formats by Pandoc
+// (/export/<format>/<path>): the rendered page with its images is
+// converted with the front matter as metadata. Pandoc runs in its sandbox,
+// so it reads nothing but its input: the images are embedded as data URLs
+// and remote ones are downloaded before like for PDFs.
+var pandocBinary = flag.String("pandoc", "", "Pandoc binary for exports to DOCX, ODT, LaTeX and other formats via /export/<format>/, empty to disable")
+
+const (
+	PandocPath    = "/export/"
+	PandocTimeout = time.Minute
+)
+
+// pandocFormat is an output format of Pandoc.
+type pandocFormat struct {
+	writer, ext, contentType string
+}
+
+var pandocFormats = map[string]pandocFormat{
+	"docx":     {"docx", ".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	"odt":      {"odt", ".odt", "application/vnd.oasis.opendocument.text"},
+	"rtf":      {"rtf", ".rtf", "application/rtf"},
+	"latex":    {"latex", ".tex", "application/x-latex"},
+	"rst":      {"rst", ".rst", "text/x-rst; charset=utf-8"},
+	"asciidoc": {"asciidoc", ".adoc", "text/asciidoc; charset=utf-8"},
+	"org":      {"org", ".org", "text/org; charset=utf-8"},
+	"textile":  {"textile", ".textile", "text/plain; charset=utf-8"},
+	"man":      {"man", ".1", "text/troff; charset=utf-8"},
+	"html":     {"html5", ".html", "text/html; charset=utf-8"},
+}
+
+// pandocMetadata returns the front matter of p as Pandoc metadata (JSON is
+// valid YAML).
+func pandocMetadata(p *Page) ([]byte, error) {
+	meta := make(map[string]interface{}, len(p.FrontMatter))
+	for k, v := range p.FrontMatter {
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(DateFormat)
+		}
+		meta[k] = v
+	}
+	if _, ok := meta["title"]; !ok {
+		meta["title"] = path.Base(p.Path)
+	}
+	return json.Marshal(meta)
+}
+
+// pandocImage matches the images localContent stored.
+var pandocImage = regexp.MustCompile(`src="((?:files|remote)/[^"]*)"`)
+
+// pandocExport converts the page p in dir to f and returns the file.
+func pandocExport(ctx context.Context, dir string, p *Page, f pandocFormat, base string) (string, error) {
+	content, err := localContent(ctx, dir, p, base)
+	if err != nil {
+		return "", err
+	}
+	content = pandocImage.ReplaceAllStringFunc(content, func(m string) string {
+		name, _, _ := strings.Cut(pandocImage.FindStringSubmatch(m)[1], "?")
+		name, err := url.PathUnescape(name)
+		if err != nil {
+			return `src=""`
+		}
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return `src=""`
+		}
+		mt := mime.TypeByExtension(path.Ext(name))
+		if mt == "" {
+			mt = http.DetectContentType(b)
+		}
+		return `src="data:` + mt + `;base64,` + base64.StdEncoding.EncodeToString(b) + `"`
+	})
+	meta, err := pandocMetadata(p)
+	if err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(filepath.Join(dir, "page.html"), []byte(content), 0644); err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(filepath.Join(dir, "meta.yaml"), meta, 0644); err != nil {
+		return "", err
+	}
+	out := "page" + f.ext
+	cmd := exec.CommandContext(ctx, *pandocBinary, "--sandbox", "--from", "html", "--to", f.writer, "--standalone",
+		"--metadata-file", "meta.yaml", "--output", out, "page.html")
+	cmd.Dir = dir
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("pandoc failed: %s: %s", err, strings.TrimSpace(string(b)))
+	}
+	return filepath.Join(dir, out), nil
+}
+
+// pandocHandler serves the page in a format of Pandoc
+// (/export/<format>/<path>).
+func pandocHandler(w http.ResponseWriter, r *http.Request) {
+	format, p, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, PandocPath), "/")
+	f, ok := pandocFormats[format]
+	if *pandocBinary == "" || !ok || checkPath(p) != nil || !mayView(r, p) {
+		http.NotFound(w, r)
+		return
+	}
+	pg, err := loadPage(r.Context(), p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	pg = pg.For(r)
+	select {
+	case conversions <- struct{}{}:
+		defer func() { <-conversions }()
+	case <-r.Context().Done():
+		return
+	}
+	tmp, err := os.MkdirTemp("", "gwiki-pandoc-")
+	if err != nil {
+		logger(r.Context()).Error("Unable to create export directory", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	ctx, cancel := context.WithTimeout(r.Context(), PandocTimeout)
+	defer cancel()
+	ctx, sp := startSpan(ctx, "pandoc")
+	sp.SetAttr("page.path", p)
+	sp.SetAttr("pandoc.format", format)
+	fn, err := pandocExport(ctx, tmp, pg, f, strings.TrimSuffix(*publicURL, "/"))
+	sp.End()
+	var out []byte
+	if err == nil {
+		out, err = os.ReadFile(fn)
+	}
+	if err != nil {
+		logger(r.Context()).Error("Unable to export page with Pandoc", "path", p, "format", format, "err", err)
+		http.Error(w, "unable to export the page as "+format, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(p)+f.ext+`"`)
+	w.Write(out)
+}
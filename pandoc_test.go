@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPandocMetadata(t *testing.T) {
+	defer func(s Storage) { store = s; cachedPages.Clear() }(store)
+	store = newMemoryStorage()
+	cachedPages.Clear()
+	if err := store.Save("docs/report", []byte("+++\ndate = 2024-05-06T07:08:09Z\ntags = [\"a\", \"b\"]\n+++\nText\n")); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPage("docs/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pandocMetadata(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var meta map[string]interface{}
+	if err = json.Unmarshal(b, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["title"] != "report" || meta["date"] != "2024-05-06" || len(meta["tags"].([]interface{})) != 2 {
+		t.Errorf("got %s", b)
+	}
+}
+
+func TestPandocHandler(t *testing.T) {
+	defer func(s Storage) { store = s; cachedPages.Clear() }(store)
+	store = newMemoryStorage()
+	cachedPages.Clear()
+	if err := store.Save("docs/report", []byte("+++\ntitle = \"Report\"\n+++\n# Report\n")); err != nil {
+		t.Fatal(err)
+	}
+	// The fake Pandoc copies its input to the output.
+	bin := filepath.Join(t.TempDir(), "pandoc")
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do [ \"$1\" = --output ] && out=$2; shift; done\ncp \"$1\" \"$out\"\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s string) { *pandocBinary = s }(*pandocBinary)
+	for i, this := range []struct {
+		binary, path string
+		status       int
+	}{
+		{"", "/export/docx/docs/report", 404},
+		{bin, "/export/docx/docs/report", 200},
+		{bin, "/export/exe/docs/report", 404},
+		{bin, "/export/odt/docs/missing", 404},
+		{bin, "/export/odt/../etc", 404},
+	} {
+		*pandocBinary = this.binary
+		w := httptest.NewRecorder()
+		pandocHandler(w, httptest.NewRequest("GET", this.path, nil))
+		if w.Code != this.status {
+			t.Errorf("[%d] got status %d but expected %d", i, w.Code, this.status)
+		}
+		if w.Code == 200 && (!strings.HasPrefix(w.Header().Get("Content-Type"), "application/vnd.openxmlformats") ||
+			!strings.Contains(w.Header().Get("Content-Disposition"), `"report.docx"`) || !strings.Contains(w.Body.String(), "Report")) {
+			t.Errorf("[%d] got %s: %s", i, w.Header(), w.Body)
+		}
+	}
+}
+
+func TestPandocExport(t *testing.T) {
+	testSetup(t)
+	if err := content.WriteFile(attachmentFile("docs", "chart.png"), []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+	// The fake Pandoc keeps its arguments and copies its input.
+	bin := filepath.Join(t.TempDir(), "pandoc")
+	script := "#!/bin/sh\necho \"$@\" > args\nwhile [ $# -gt 1 ]; do [ \"$1\" = --output ] && out=$2; shift; done\ncp \"$1\" \"$out\"\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s string) { *pandocBinary = s }(*pandocBinary)
+	*pandocBinary = bin
+	p := NewPage("docs/report")
+	p.Body = []byte("![chart](/files/docs/chart.png) ![remote](https://127.0.0.1:1/x.png)\n")
+	dir := t.TempDir()
+	fn, err := pandocExport(context.Background(), dir, p, pandocFormats["docx"], "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out, _ := os.ReadFile(fn)
+	if !strings.Contains(string(out), `src="data:image/png;base64,cG5n"`) || strings.Contains(string(out), "127.0.0.1") {
+		t.Errorf("got %s", out)
+	}
+	if args, _ := os.ReadFile(filepath.Join(dir, "args")); !strings.HasPrefix(string(args), "--sandbox ") || strings.Contains(string(args), "--resource-path") {
+		t.Errorf("got arguments %s", args)
+	}
+}
@@ -120,6 +120,82 @@ func InterfaceToFrontMatter(in interface{}, mark rune) ([]byte, error) {
 	}
 }
 
+// InterfaceToOrderedFrontMatter is InterfaceToFrontMatter with the top
+// level keys written in the order of keys (keys missing in in are skipped).
+// TOML tables have to follow all other keys, so they come last.
+func InterfaceToOrderedFrontMatter(in map[string]interface{}, keys []string, mark rune) ([]byte, error) {
+	if in == nil {
+		return []byte{}, errors.New("input was nil")
+	}
+
+	b := new(bytes.Buffer)
+
+	switch mark {
+	case rune(YAMLLead[0]):
+		ms := make(yaml.MapSlice, 0, len(keys))
+		for _, k := range keys {
+			if v, ok := in[k]; ok {
+				ms = append(ms, yaml.MapItem{Key: k, Value: v})
+			}
+		}
+		by, err := yaml.Marshal(ms)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(YAMLDelimUnix)
+		b.Write(by)
+		b.WriteString(YAMLDelimUnix)
+		return b.Bytes(), nil
+	case rune(TOMLLead[0]):
+		var tables bytes.Buffer
+		for _, k := range keys {
+			v, ok := in[k]
+			if !ok {
+				continue
+			}
+			t := toml.TreeFromMap(map[string]interface{}{k: v}).String()
+			if strings.HasPrefix(strings.TrimSpace(t), "[") { // table or array of tables
+				tables.WriteString(t)
+			} else {
+				b.WriteString(t)
+			}
+		}
+		return []byte(TOMLDelimUnix + b.String() + tables.String() + TOMLDelimUnix), nil
+	case rune(JSONLead[0]):
+		b.WriteString("{")
+		n := 0
+		for _, k := range keys {
+			v, ok := in[k]
+			if !ok {
+				continue
+			}
+			kb, err := json.Marshal(k)
+			if err != nil {
+				return nil, err
+			}
+			vb, err := json.MarshalIndent(v, "   ", "   ")
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n   ")
+			b.Write(kb)
+			b.WriteString(": ")
+			b.Write(vb)
+			n++
+		}
+		if n > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n")
+		return b.Bytes(), nil
+	default:
+		return nil, errors.New("Unsupported Format provided")
+	}
+}
+
 func FormatToLeadRune(kind string) rune {
 	switch FormatSanitize(kind) {
 	case "yaml":
@@ -101,6 +101,16 @@ func (p *page) Metadata() (meta interface{}, err error) {
 
 // ReadFrom reads the content from an io.Reader and constructs a page.
 func ReadFrom(r io.Reader) (p Page, err error) {
+	return readFrom(r, true)
+}
+
+// ReadFrontMatter is like ReadFrom but stops after the front matter, so the
+// page has no content.
+func ReadFrontMatter(r io.Reader) (p Page, err error) {
+	return readFrom(r, false)
+}
+
+func readFrom(r io.Reader, withContent bool) (p Page, err error) {
 	reader := bufio.NewReader(r)
 
 	// chomp BOM and assume UTF-8
@@ -130,6 +140,9 @@ func ReadFrom(r io.Reader) (p Page, err error) {
 		}
 		newp.frontmatter = fm
 	}
+	if !withContent {
+		return newp, nil
+	}
 
 	content, err := extractContent(reader)
 	if err != nil {
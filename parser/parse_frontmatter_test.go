@@ -138,6 +138,24 @@ func TestStandaloneCreatePageFrom(t *testing.T) {
 	}
 }
 
+func TestReadFrontMatter(t *testing.T) {
+	tests := []struct {
+		content     string
+		frontMatter string
+	}{
+		{contentNoFrontmatter, ""},
+		{contentWithFrontmatter, "---\ntitle: front matter\n---\n"},
+		{contentSlugWithJSONFrontMatter, "{\n  \"categories\": \"d\",\n  \"tags\": [\n    \"a\", \n    \"b\", \n    \"c\"\n  ]\n}"},
+	}
+
+	for _, test := range tests {
+		p := pageMust(ReadFrontMatter(strings.NewReader(test.content)))
+
+		checkPageFrontMatterContent(t, p, test.frontMatter)
+		checkPageContent(t, p, "")
+	}
+}
+
 func BenchmarkLongFormRender(b *testing.B) {
 
 	tests := []struct {
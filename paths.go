@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"unicode"
+)
+
+// Page paths come from URLs, forms, links and the storage. They are
+// checked here before pages are loaded or saved, and the content file
+// system (see ContentFS) resolves them below the content directory without
+// following symbolic links out of it.
+
+// ErrInvalidPath is returned for page paths that could leave the content
+// directory.
+var ErrInvalidPath = errors.New("invalid page path")
+
+// checkPath returns an error wrapping ErrInvalidPath unless path is
+// relative, slash separated and clean: no ".", ".." or empty elements, no
+// backslashes and no control characters.
+func checkPath(path string) error {
+	if path == "." || !fs.ValidPath(path) || strings.ContainsRune(path, '\\') || strings.IndexFunc(path, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w '%s'", ErrInvalidPath, path)
+	}
+	return nil
+}
+
+// isValidPath reports whether path is a page path that could come from a URL.
+func isValidPath(path string) bool {
+	return checkPath(path) == nil && validPath.MatchString("/view/"+path)
+}
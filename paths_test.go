@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckPath(t *testing.T) {
+	for i, this := range []struct {
+		path   string
+		expect bool
+	}{
+		{"docs/install", true},
+		{"blog/2025/post", true},
+		{"top", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../etc/passwd", false},
+		{"docs/../../escape", false},
+		{"docs/./install", false},
+		{"/etc/passwd", false},
+		{"docs//install", false},
+		{"docs/", false},
+		{`docs\..\escape`, false},
+		{"docs/in\x00stall", false},
+	} {
+		err := checkPath(this.path)
+		if (err == nil) != this.expect {
+			t.Errorf("[%d] got error %v for %q but expected valid: %t", i, err, this.path, this.expect)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("[%d] got error %v but expected %v", i, err, ErrInvalidPath)
+		}
+	}
+
+	if _, err := LoadPage("../escape"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("got error %v loading a page outside of the content directory", err)
+	}
+	if err := (&Page{Path: "docs/../../escape", Mark: '+'}).Save(); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("got error %v saving a page outside of the content directory", err)
+	}
+	called := false
+	h := makeHandler(func(w http.ResponseWriter, r *http.Request, path string) { called = true })
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/view/docs//install", nil))
+	if called || w.Code != http.StatusNotFound {
+		t.Errorf("got %d (called: %t) for an unclean path", w.Code, called)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Pages are exported as PDF (/export/pdf/<path>) by rendering them with
+// the print template and stylesheet into a temporary directory, with the
+// images they embed, and converting that with an external program. The
+// program only reads that directory: remote images are downloaded before
+// (only from public addresses like when clipping) and everything else it
+// could load is removed. Links point to -public-url.
+var (
+	pdfBackendName = flag.String("pdf-backend", "", "converter of pages to PDF for /export/pdf/: 'wkhtmltopdf' or 'chrome' (headless Chrome or Chromium), empty to disable")
+	pdfCommand     = flag.String("pdf-command", "", "binary of the PDF backend (default: wkhtmltopdf or chromium)")
+)
+
+const (
+	PDFPath        = "/export/pdf/"
+	PDFTimeout     = time.Minute
+	PrintStyle     = "./static/css/print.css"
+	MaxConversions = 2 // of pages to PDF and other formats at the same time
+)
+
+// PDFBackend converts a HTML file (with its images in the same directory)
+// to a PDF file.
+type PDFBackend interface {
+	Convert(ctx context.Context, htmlFile, pdfFile string) error
+}
+
+var pdfBackends = map[string]func(command string) PDFBackend{
+	"wkhtmltopdf": func(command string) PDFBackend {
+		return &commandPDF{command: command, def: "wkhtmltopdf", args: wkhtmltopdfArgs}
+	},
+	"chrome": func(command string) PDFBackend {
+		return &commandPDF{command: command, def: "chromium", args: chromeArgs}
+	},
+}
+
+// RegisterPDFBackend makes a PDF backend available for the -pdf-backend
+// flag, e.g. one using chromedp.
+func RegisterPDFBackend(name string, f func(command string) PDFBackend) {
+	pdfBackends[name] = f
+}
+
+var (
+	pdfBackend  PDFBackend
+	conversions = make(chan struct{}, MaxConversions)
+)
+
+func initPDF() {
+	if *pdfBackendName == "" {
+		return
+	}
+	f, ok := pdfBackends[*pdfBackendName]
+	if !ok {
+		fatal("Unknown PDF backend", "backend", *pdfBackendName)
+	}
+	pdfBackend = f(*pdfCommand)
+}
+
+// commandPDF runs a program to convert to PDF.
+type commandPDF struct {
+	command, def string
+	args         func(htmlFile, pdfFile string) []string
+}
+
+func wkhtmltopdfArgs(htmlFile, pdfFile string) []string {
+	return []string{"--quiet", "--disable-local-file-access", "--allow", filepath.Dir(htmlFile), "--print-media-type", htmlFile, pdfFile}
+}
+
+func chromeArgs(htmlFile, pdfFile string) []string {
+	return []string{"--headless", "--disable-gpu", "--no-pdf-header-footer", "--print-to-pdf=" + pdfFile, "file://" + filepath.ToSlash(htmlFile)}
+}
+
+func (c *commandPDF) Convert(ctx context.Context, htmlFile, pdfFile string) error {
+	name := c.command
+	if name == "" {
+		name = c.def
+	}
+	out, err := exec.CommandContext(ctx, name, c.args(htmlFile, pdfFile)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("command '%s' failed: %s: %s", name, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+var (
+	// printURL matches the URLs of the wiki in the rendered page.
+	printURL = regexp.MustCompile(`(src|href)="(/[^"/][^"]*)"`)
+	// printImage matches the images and printSrc the URLs the converter
+	// loads.
+	printImage = regexp.MustCompile(`<img\s[^>]*>`)
+	printSrc   = regexp.MustCompile(`\s(src|srcset)="([^"]*)"`)
+)
+
+// printPage is the data of the print template.
+type printPage struct {
+	*Page
+	Content template.HTML
+}
+
+// writePrintPage writes the page p as index.html with the print stylesheet
+// and the images it embeds to dir. Other links point to base.
+func writePrintPage(ctx context.Context, dir string, p *Page, base string) error {
+	content, err := localContent(ctx, dir, p, base)
+	if err != nil {
+		return err
+	}
+	if css, err := os.ReadFile(PrintStyle); err == nil {
+		if err = os.WriteFile(filepath.Join(dir, "print.css"), css, 0644); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if err := currentTemplates().ExecuteTemplate(&buf, "print.html", &printPage{Page: p, Content: template.HTML(content)}); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.html"), buf.Bytes(), 0644)
+}
+
+// localContent returns the rendered page p with the attachments it embeds
+// copied to dir/files, the remote images downloaded to dir/remote and the
+// links of the wiki pointing to base. Other embedded URLs are removed.
+func localContent(ctx context.Context, dir string, p *Page, base string) (string, error) {
+	var files []string
+	content := printURL.ReplaceAllStringFunc(string(p.Rendered()), func(m string) string {
+		s := printURL.FindStringSubmatch(m)
+		if f, ok := strings.CutPrefix(s[2], "/files/"); ok && s[1] == "src" {
+			files = append(files, f)
+			return s[1] + `="` + strings.TrimPrefix(s[2], "/") + `"`
+		} else if s[1] == "src" {
+			return m
+		}
+		return s[1] + `="` + base + s[2] + `"`
+	})
+	var remote []string
+	content = printImage.ReplaceAllStringFunc(content, func(img string) string {
+		return printSrc.ReplaceAllStringFunc(img, func(m string) string {
+			s := printSrc.FindStringSubmatch(m)
+			u := html.UnescapeString(s[2])
+			if s[1] != "src" || !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") || len(remote) >= ClipMaxImages {
+				return m
+			}
+			name, err := fetchPrintImage(ctx, dir, len(remote), u)
+			if err != nil {
+				logger(ctx).Info("Unable to download image for printing", "url", u, "err", err)
+				return m
+			}
+			remote = append(remote, name)
+			return ` src="` + name + `"`
+		})
+	})
+	content = printSrc.ReplaceAllStringFunc(content, func(m string) string {
+		s := printSrc.FindStringSubmatch(m)
+		if s[1] == "src" && (strings.HasPrefix(s[2], "files/") || strings.HasPrefix(s[2], "remote/") || strings.HasPrefix(s[2], "data:image/")) {
+			return m
+		}
+		return " " + s[1] + `=""`
+	})
+	for _, f := range files {
+		f, _, _ = strings.Cut(f, "?")
+		name, err := url.PathUnescape(f)
+		if err != nil || !fs.ValidPath(name) {
+			continue
+		}
+		src, err := attachmentFS(attachmentDir(name)).Open(attachmentFile(attachmentDir(name), path.Base(name)))
+		if err != nil {
+			continue // shown as missing like in the browser
+		}
+		err = writeFile(filepath.Join(dir, "files", filepath.FromSlash(name)), src)
+		src.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// fetchPrintImage downloads the i-th remote image at u to dir/remote and
+// returns its name relative to dir.
+func fetchPrintImage(ctx context.Context, dir string, i int, u string) (string, error) {
+	b, _, mt, err := clipFetch(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	exts, _ := mime.ExtensionsByType(mt)
+	if len(exts) == 0 || !strings.HasPrefix(mt, "image/") {
+		return "", fmt.Errorf("no image but '%s'", mt)
+	}
+	name := fmt.Sprintf("remote/%d%s", i, exts[0])
+	return name, writeFile(filepath.Join(dir, filepath.FromSlash(name)), bytes.NewReader(b))
+}
+
+// pdfHandler serves the page as PDF (/export/pdf/<path>).
+func pdfHandler(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, PDFPath)
+	if pdfBackend == nil || checkPath(p) != nil || !mayView(r, p) {
+		http.NotFound(w, r)
+		return
+	}
+	pg, err := loadPage(r.Context(), p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	pg = pg.For(r)
+	select {
+	case conversions <- struct{}{}:
+		defer func() { <-conversions }()
+	case <-r.Context().Done():
+		return
+	}
+	tmp, err := os.MkdirTemp("", "gwiki-pdf-")
+	if err != nil {
+		logger(r.Context()).Error("Unable to create PDF directory", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	ctx, cancel := context.WithTimeout(r.Context(), PDFTimeout)
+	defer cancel()
+	if err = writePrintPage(ctx, tmp, pg, strings.TrimSuffix(*publicURL, "/")); err != nil {
+		logger(r.Context()).Error("Unable to render page for PDF", "path", p, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, sp := startSpan(ctx, "pdf")
+	sp.SetAttr("page.path", p)
+	err = pdfBackend.Convert(ctx, filepath.Join(tmp, "index.html"), filepath.Join(tmp, "page.pdf"))
+	sp.End()
+	var pdf []byte
+	if err == nil {
+		pdf, err = os.ReadFile(filepath.Join(tmp, "page.pdf"))
+	}
+	if err != nil {
+		logger(r.Context()).Error("Unable to convert page to PDF", "path", p, "backend", *pdfBackendName, "err", err)
+		http.Error(w, "unable to convert the page to PDF", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(p)+`.pdf"`)
+	w.Write(pdf)
+}
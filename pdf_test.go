@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyPDF "converts" by copying the HTML.
+type copyPDF struct{}
+
+func (copyPDF) Convert(ctx context.Context, htmlFile, pdfFile string) error {
+	b, err := os.ReadFile(htmlFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pdfFile, b, 0644)
+}
+
+func TestPDFHandler(t *testing.T) {
+	defer func(s Storage) { store = s }(store)
+	store = newMemoryStorage()
+	src := "+++\ntitle = \"Report\"\ndate = 2024-05-06T07:08:09Z\n+++\n![chart](/files/docs/chart.png) ![gone](/files/docs/gone.png) [[docs/other]]\n"
+	if err := store.Save("docs/report", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	defer func(c ContentFS) { content = c }(content)
+	content = newMemFS()
+	if err := content.WriteFile(attachmentFile("docs", "chart.png"), []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	p, err := LoadPage("docs/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writePrintPage(context.Background(), dir, p, "http://wiki"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	html, _ := os.ReadFile(filepath.Join(dir, "index.html"))
+	for _, s := range []string{"<h1>Report</h1>", "2024-05-06", `src="files/docs/chart.png"`, `href="http://wiki/view/docs/other"`, `href="print.css"`} {
+		if !strings.Contains(string(html), s) {
+			t.Errorf("%q is missing in %s", s, html)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "files", "docs", "chart.png")); err != nil || string(b) != "png" {
+		t.Errorf("got image %q and error %v", b, err)
+	}
+
+	defer func(b PDFBackend) { pdfBackend = b }(pdfBackend)
+	for i, this := range []struct {
+		backend PDFBackend
+		path    string
+		status  int
+	}{
+		{nil, "/export/pdf/docs/report", 404},
+		{copyPDF{}, "/export/pdf/docs/report", 200},
+		{copyPDF{}, "/export/pdf/docs/missing", 404},
+		{copyPDF{}, "/export/pdf/../etc", 404},
+	} {
+		pdfBackend = this.backend
+		w := httptest.NewRecorder()
+		pdfHandler(w, httptest.NewRequest("GET", this.path, nil))
+		if w.Code != this.status {
+			t.Errorf("[%d] got status %d but expected %d", i, w.Code, this.status)
+		}
+		if w.Code == 200 && (w.Header().Get("Content-Type") != "application/pdf" || !strings.Contains(w.Body.String(), "<h1>Report</h1>")) {
+			t.Errorf("[%d] got %s: %s", i, w.Header().Get("Content-Type"), w.Body)
+		}
+	}
+}
+
+func TestLocalContent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer ts.Close()
+	p := NewPage("docs/report")
+	p.Body = []byte("![remote](" + ts.URL + "/chart.png) ![static](/static/img/logo.png) [other](/view/docs/other)\n\n" +
+		`{{< youtube w7Ft2ymGmfc >}}` + "\n")
+	defer func(h bool) { *clipPrivateHosts = h }(*clipPrivateHosts)
+	for i, this := range []struct {
+		privateHosts bool
+		expect       []string
+	}{
+		// the dial guard refuses the local test server
+		{false, []string{`src=""`, `href="http://wiki/view/docs/other"`}},
+		{true, []string{`src="remote/0.png"`}},
+	} {
+		*clipPrivateHosts = this.privateHosts
+		dir := t.TempDir()
+		content, err := localContent(context.Background(), dir, p, "http://wiki")
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", i, err)
+		}
+		for _, s := range this.expect {
+			if !strings.Contains(content, s) {
+				t.Errorf("[%d] %q is missing in %s", i, s, content)
+			}
+		}
+		for _, s := range []string{ts.URL, "/static/img/logo.png", "youtube.com"} {
+			if strings.Contains(content, s) {
+				t.Errorf("[%d] %q isn't removed from %s", i, s, content)
+			}
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, "remote", "0.png")); this.privateHosts && string(b) != "png" {
+			t.Errorf("[%d] got image %q and error %v", i, b, err)
+		}
+	}
+	for _, arg := range wkhtmltopdfArgs("/tmp/x/index.html", "/tmp/x/page.pdf") {
+		if arg == "--enable-local-file-access" {
+			t.Errorf("got wkhtmltopdf argument %s", arg)
+		}
+	}
+}
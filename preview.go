@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	previewMode = flag.Bool("preview", false, "start 'hugo server' and proxy /preview/ to it")
+	previewPort = flag.Int("preview-port", 1313, "local port used by 'hugo server'")
+	reloadPort  = flag.Int("preview-reload-port", 0, "port browsers reach gwiki on for the live reload of the preview (0: the port of -addr)")
+)
+
+const PreviewPrefix = "/preview/"
+
+var previewCmd *exec.Cmd
+
+// startPreview starts 'hugo server' (including drafts) as a child process.
+// Hugo watches the content itself and reloads open previews through the
+// proxied /livereload web socket, so saved pages show up automatically.
+func startPreview() (http.Handler, error) {
+	args := []string{"server",
+		"--bind", "127.0.0.1",
+		"--port", fmt.Sprintf("%d", *previewPort),
+		"--baseURL", PreviewPrefix,
+		"--appendPort=false",
+		"--buildDrafts",
+	}
+	if port := publicPort(); port != "" {
+		args = append(args, "--liveReloadPort", port)
+	}
+	args = append(args, strings.Fields(*hugoArgs)...)
+	previewCmd = exec.Command(*hugoBinary, args...)
+	previewCmd.Dir = *siteDir
+	previewCmd.Stdout = os.Stderr
+	previewCmd.Stderr = os.Stderr
+	if err := previewCmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start hugo server: %s", err)
+	}
+	go func() {
+		err := previewCmd.Wait()
+		slog.Warn("hugo server stopped", "err", err)
+	}()
+	target := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", *previewPort)}
+	return httputil.NewSingleHostReverseProxy(target), nil
+}
+
+// publicPort returns the port the live reload script of the preview
+// connects to or "" if there is none (a unix domain socket).
+func publicPort() string {
+	if *reloadPort != 0 {
+		return fmt.Sprintf("%d", *reloadPort)
+	}
+	if _, port, err := net.SplitHostPort(*addr); err == nil {
+		return port
+	}
+	return ""
+}
+
+// previewHandler only lets editors see the preview since it includes
+// drafts and private content. Pages are checked with the ACL of the page
+// they show.
+func previewHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isEditor(r) {
+			denyAccess(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, PreviewPrefix) {
+			if path := previewPath(r.URL.Path); !mayView(r, path) {
+				logger(r.Context()).Info("Access denied by ACL", "path", path, "edit", false)
+				denyAccess(w, r)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// previewPath returns the path of the page shown at the preview URL path,
+// the _index page of lists or, for assets, the URL path without the prefix.
+func previewPath(urlPath string) string {
+	rel := "/" + strings.TrimPrefix(urlPath, PreviewPrefix)
+	for _, info := range index.Pages(true) {
+		p := NewPage(info.Path)
+		p.FrontMatter = info.Params
+		if site.relPermalink(p) == rel {
+			return info.Path
+		}
+	}
+	path := strings.Trim(rel, "/")
+	if strings.HasSuffix(rel, "/") {
+		return strings.TrimPrefix(path+"/"+IndexPage, "/")
+	}
+	return path
+}
+
+func stopPreview() {
+	if previewCmd != nil && previewCmd.Process != nil {
+		previewCmd.Process.Kill()
+	}
+}
+
+func (p *Page) PreviewURL() string {
+	if !*previewMode {
+		return ""
+	}
+	return strings.TrimSuffix(PreviewPrefix, "/") + site.relPermalink(p)
+}
+
+func initPreview() {
+	if !*previewMode {
+		return
+	}
+	h, err := startPreview()
+	if err != nil {
+		fatal("Unable to start preview", "err", err)
+	}
+	h = previewHandler(h)
+	http.Handle(PreviewPrefix, h)
+	http.Handle("/livereload", h)
+	http.Handle("/livereload.js", h)
+	slog.Info("Proxying to hugo server", "prefix", PreviewPrefix, "port", *previewPort)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreviewHandler(t *testing.T) {
+	testSetup(t)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl"), []byte("secret/** view=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(e, a string) { *editors, *aclFile = e, a }(*editors, *aclFile)
+	*editors, *aclFile = "alice,bob", filepath.Join(dir, "acl")
+	acls = &aclTable{}
+	defer func() { acls = &aclTable{} }()
+	defer func(sc *SiteConfig) { site = sc }(site)
+	site = defaultSiteConfig()
+	site.Permalinks["secret"] = "/:slug/"
+	p := NewPage("secret/plan")
+	p.FrontMatter["slug"] = "hidden-plan"
+	index.Update(p)
+
+	h := previewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, this := range []struct {
+		path, user string
+		code       int
+	}{
+		{"/preview/docs/intro/", "anonymous", http.StatusForbidden},
+		{"/preview/docs/intro/", "bob", http.StatusOK},
+		{"/preview/secret/", "bob", http.StatusForbidden},
+		{"/preview/secret/plan.png", "bob", http.StatusForbidden},
+		{"/preview/", "bob", http.StatusOK},
+		{"/preview/hidden-plan/", "bob", http.StatusForbidden},
+		{"/preview/hidden-plan/", "alice", http.StatusOK},
+		{"/livereload", "anonymous", http.StatusForbidden},
+		{"/livereload", "bob", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, withUser(httptest.NewRequest("GET", this.path, nil), this.user))
+		if w.Code != this.code {
+			t.Errorf("[%d] got %d for %s on %s but expected %d", i, w.Code, this.user, this.path, this.code)
+		}
+	}
+}
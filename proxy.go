@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Behind a reverse proxy (nginx, Traefik, ...) the client address, scheme
+// and host come from the X-Forwarded-For, X-Forwarded-Proto and
+// X-Forwarded-Host headers. They are only used for requests from trusted
+// proxies since anybody else could fake them.
+var trustedProxies = flag.String("trusted-proxies", "", "comma separated IPs or CIDRs of reverse proxies whose X-Forwarded-* headers are used (e.g. '127.0.0.1,10.0.0.0/8')")
+
+var proxyNets []*net.IPNet
+
+// parseProxies parses the -trusted-proxies flag.
+func parseProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %s", p, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func initProxies() {
+	var err error
+	if proxyNets, err = parseProxies(*trustedProxies); err != nil {
+		fatal("Invalid trusted proxies", "err", err)
+	}
+}
+
+func isTrustedProxy(nets []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClient returns the client IP of a request from the trusted
+// proxy peer: the last address in X-Forwarded-For that isn't a trusted
+// proxy itself.
+func forwardedClient(nets []*net.IPNet, peer string, xff []string) string {
+	var hops []string
+	for _, h := range xff {
+		for _, a := range strings.Split(h, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				hops = append(hops, a)
+			}
+		}
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		client = hops[i]
+		if !isTrustedProxy(nets, client) {
+			break
+		}
+	}
+	return client
+}
+
+// applyForwarded rewrites RemoteAddr (to the client IP), Host and
+// URL.Scheme of r from the X-Forwarded-* headers if the request comes from
+// a trusted proxy.
+func applyForwarded(nets []*net.IPNet, r *http.Request) {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(nets, peer) {
+		return
+	}
+	r.RemoteAddr = forwardedClient(nets, peer, r.Header.Values("X-Forwarded-For"))
+	if proto := firstValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		r.URL.Scheme = proto
+	}
+	if host := firstValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+		r.Host = host
+	}
+}
+
+// firstValue returns the first of the comma separated values in h (added
+// by the proxy closest to the client).
+func firstValue(h string) string {
+	if i := strings.Index(h, ","); i >= 0 {
+		h = h[:i]
+	}
+	return strings.TrimSpace(h)
+}
+
+// proxyHandler applies the X-Forwarded-* headers of trusted proxies before
+// calling h.
+func proxyHandler(h http.Handler) http.Handler {
+	if len(proxyNets) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		applyForwarded(proxyNets, r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isSecure reports whether the client used HTTPS (directly or via a
+// trusted proxy), e.g. for secure cookies.
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || r.URL.Scheme == "https"
+}
+
+// baseURL returns scheme and host the client used, e.g. for absolute links.
+func baseURL(r *http.Request) string {
+	if isSecure(r) {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyForwarded(t *testing.T) {
+	nets, err := parseProxies("127.0.0.1, 10.0.0.0/8,::1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err = parseProxies("10.0.0.0/99"); err == nil {
+		t.Errorf("expected an error for an invalid CIDR")
+	}
+	for i, this := range []struct {
+		remote, xff, proto, host string
+		expectRemote, expectBase string
+	}{
+		{"192.0.2.1:1234", "203.0.113.9", "https", "evil.example", "192.0.2.1:1234", "http://wiki.example"},
+		{"127.0.0.1:1234", "203.0.113.9", "https", "docs.example", "203.0.113.9", "https://docs.example"},
+		{"127.0.0.1:1234", "198.51.100.7, 203.0.113.9, 10.1.2.3", "", "", "203.0.113.9", "http://wiki.example"},
+		{"127.0.0.1:1234", "", "ftp", "", "127.0.0.1", "http://wiki.example"},
+		{"[::1]:1234", "10.0.0.1, 10.0.0.2", "https", "", "10.0.0.1", "https://wiki.example"},
+		{"127.0.0.1:1234", "garbage, 203.0.113.9", "", "", "203.0.113.9", "http://wiki.example"},
+	} {
+		r := httptest.NewRequest("GET", "/view/x", nil)
+		r.RemoteAddr, r.Host = this.remote, "wiki.example"
+		if this.xff != "" {
+			r.Header.Set("X-Forwarded-For", this.xff)
+		}
+		if this.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", this.proto)
+		}
+		if this.host != "" {
+			r.Header.Set("X-Forwarded-Host", this.host)
+		}
+		applyForwarded(nets, r)
+		if r.RemoteAddr != this.expectRemote {
+			t.Errorf("[%d] got remote %q but expected %q", i, r.RemoteAddr, this.expectRemote)
+		}
+		if b := baseURL(r); b != this.expectBase {
+			t.Errorf("[%d] got %q but expected %q", i, b, this.expectBase)
+		}
+	}
+}
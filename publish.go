@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	hugoBinary = flag.String("hugo", "hugo", "Hugo binary used for publishing")
+	hugoArgs   = flag.String("hugo-args", "", "additional arguments for the Hugo build (space separated)")
+	deployCmd  = flag.String("deploy", "", "shell command run after a successful Hugo build (e.g. rsync to the web server)")
+)
+
+// PublishRun describes a single (possibly still running) publish run.
+type PublishRun struct {
+	User     string
+	Started  time.Time
+	Finished time.Time
+	Running  bool
+	Err      string
+	Output   string
+}
+
+type publisher struct {
+	mutex sync.Mutex
+	last  PublishRun
+}
+
+var publish = &publisher{}
+
+// Status returns a copy of the current or last publish run.
+func (pub *publisher) Status() PublishRun {
+	pub.mutex.Lock()
+	defer pub.mutex.Unlock()
+	return pub.last
+}
+
+// Start starts a publish run in the background.
+// It returns false if a run is already in progress.
+func (pub *publisher) Start(user string) bool {
+	pub.mutex.Lock()
+	defer pub.mutex.Unlock()
+	if pub.last.Running {
+		return false
+	}
+	pub.last = PublishRun{User: user, Started: time.Now(), Running: true}
+	goBackground(pub.run)
+	return true
+}
+
+func (pub *publisher) run() {
+	out := &bytes.Buffer{}
+	err := runCommand(out, *hugoBinary, strings.Fields(*hugoArgs)...)
+	if err == nil && *deployCmd != "" {
+		fmt.Fprintf(out, "\n$ %s\n", *deployCmd)
+		err = runCommand(out, "sh", "-c", *deployCmd)
+	}
+
+	pub.mutex.Lock()
+	defer pub.mutex.Unlock()
+	pub.last.Running = false
+	pub.last.Finished = time.Now()
+	pub.last.Output = out.String()
+	if err != nil {
+		pub.last.Err = err.Error()
+		slog.Error("Publishing failed", "err", err)
+	} else {
+		slog.Info("Published site", "duration", pub.last.Finished.Sub(pub.last.Started))
+	}
+}
+
+func runCommand(out *bytes.Buffer, name string, args ...string) error {
+	ctx, sp := startSpan(appCtx, "exec "+name)
+	sp.SetAttr("exec.args", strings.Join(args, " "))
+	defer sp.End()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = *siteDir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		sp.SetError(err)
+		return fmt.Errorf("command '%s' failed: %s", name, err)
+	}
+	return nil
+}
+
+func publishHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if publish.Start(currentUser(r)) {
+			audit(r, "publish", "")
+		}
+		http.Redirect(w, r, "/admin/publish", http.StatusSeeOther)
+		return
+	}
+	renderTemplate(w, "publish", publish.Status())
+}
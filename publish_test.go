@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublishHandler(t *testing.T) {
+	defer func(a, e, u string) { *admins, *editors, *usersFile = a, e, u }(*admins, *editors, *usersFile)
+	*admins, *editors, *usersFile = "", "alice", "users"
+	handler := adminHandler(http.HandlerFunc(publishHandler))
+	for i, this := range []struct {
+		method, user string
+		expect       int
+	}{
+		{"GET", "anonymous", http.StatusUnauthorized},
+		{"GET", "bob", http.StatusForbidden},
+		{"POST", "bob", http.StatusForbidden},
+		{"GET", "alice", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withUser(httptest.NewRequest(this.method, "/admin/publish", nil), this.user))
+		if w.Code != this.expect {
+			t.Errorf("[%d] got %d for %s as %s but expected %d", i, w.Code, this.method, this.user, this.expect)
+		}
+		if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), `action="/admin/publish"`) {
+			t.Errorf("[%d] got no form posting to /admin/publish", i)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The quality report scores every page from 0 to 100 by weighted signals,
+// worst pages first, so maintainers know where to invest effort:
+//
+//	description  the page has a description
+//	tags         the page has tags
+//	headings     long pages have headings and heading levels aren't skipped
+//	links        the page has no broken links
+//	fresh        the page changed within -quality-stale
+//	readability  Flesch reading ease of the text (60 and more is best)
+//
+// Signals with weight 0 are ignored.
+var (
+	qualityWeights = flag.String("quality-weights", "description=2,tags=1,headings=1,links=3,fresh=1,readability=1", "weights of the quality signals (signal=weight, comma separated)")
+	qualityStale   = flag.Duration("quality-stale", 365*24*time.Hour, "age after which a page counts as stale in the quality report")
+)
+
+// QualitySignals are the names of the quality signals in report order.
+var QualitySignals = []string{"description", "tags", "headings", "links", "fresh", "readability"}
+
+// LongPageWords is the number of words above which a page should have
+// headings.
+const LongPageWords = 300
+
+// PageQuality is the quality score of a page with the values (0 to 1) of
+// the signals and hints for improving it.
+type PageQuality struct {
+	Path    string             `json:"path"`
+	Title   string             `json:"title"`
+	Score   int                `json:"score"`
+	Signals map[string]float64 `json:"signals"`
+	Hints   []string           `json:"hints,omitempty"`
+}
+
+// parseWeights parses the -quality-weights flag.
+func parseWeights(s string) (map[string]float64, error) {
+	ws := make(map[string]float64)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 || !contains(QualitySignals, kv[0]) {
+			return nil, fmt.Errorf("invalid quality weight '%s'", f)
+		}
+		w, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid quality weight '%s'", f)
+		}
+		ws[kv[0]] = w
+	}
+	return ws, nil
+}
+
+var headingLine = regexp.MustCompile(`(?m)^(#{1,6})\s`)
+
+// headingsSignal checks the heading structure of body.
+func headingsSignal(body []byte, words int) (float64, string) {
+	hs := headingLine.FindAllSubmatch(stripCode(body), -1)
+	if len(hs) == 0 {
+		if words > LongPageWords {
+			return 0, fmt.Sprintf("add headings to structure the %d words", words)
+		}
+		return 1, ""
+	}
+	last := 0
+	for _, h := range hs {
+		level := len(h[1])
+		if last > 0 && level > last+1 {
+			return 0.5, fmt.Sprintf("heading level %d follows level %d", level, last)
+		}
+		last = level
+	}
+	return 1, ""
+}
+
+var (
+	codeBlock   = regexp.MustCompile("(?s)```.*?```")
+	markupChars = regexp.MustCompile(`{{[<%].*?[>%]}}|!?\[([^\]]*)\]\([^)]*\)|[#*_>` + "`" + `|]`)
+	sentenceEnd = regexp.MustCompile(`[.!?]+(\s|$)`)
+	vowelGroup  = regexp.MustCompile(`[aeiouyäöü]+`)
+)
+
+func stripCode(body []byte) []byte {
+	return codeBlock.ReplaceAll(body, nil)
+}
+
+// plainText returns the text of a Markdown body without code and markup.
+func plainText(body []byte) string {
+	return string(markupChars.ReplaceAll(stripCode(body), []byte("$1")))
+}
+
+// readingEase returns the Flesch reading ease of text (higher is easier)
+// and the number of words.
+func readingEase(text string) (float64, int) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return 100, 0
+	}
+	sentences := len(sentenceEnd.FindAllStringIndex(text, -1))
+	if sentences == 0 {
+		sentences = 1
+	}
+	syllables := 0
+	for _, w := range words {
+		n := len(vowelGroup.FindAllStringIndex(strings.ToLower(w), -1))
+		if n == 0 {
+			n = 1
+		}
+		syllables += n
+	}
+	wc := float64(len(words))
+	return 206.835 - 1.015*wc/float64(sentences) - 84.6*float64(syllables)/wc, len(words)
+}
+
+// pageQuality scores p (with the text body) by the weights ws; now is used
+// for staleness.
+func pageQuality(p *Page, body []byte, info *PageInfo, ws map[string]float64, now time.Time) *PageQuality {
+	q := &PageQuality{Path: p.Path, Title: p.Title(), Signals: make(map[string]float64)}
+	hint := func(h string) {
+		if h != "" {
+			q.Hints = append(q.Hints, h)
+		}
+	}
+	for _, s := range QualitySignals {
+		q.Signals[s] = 0
+	}
+	ease, words := readingEase(plainText(body))
+
+	if p.Description() != "" {
+		q.Signals["description"] = 1
+	} else {
+		hint("add a description")
+	}
+	if len(p.Tags()) > 0 {
+		q.Signals["tags"] = 1
+	} else {
+		hint("add tags")
+	}
+	v, h := headingsSignal(body, words)
+	q.Signals["headings"] = v
+	hint(h)
+	if broken := brokenLinks(info); len(broken) == 0 {
+		q.Signals["links"] = 1
+	} else {
+		hint(fmt.Sprintf("fix %d broken links", len(broken)))
+	}
+	if changed := lastChange(p); changed.IsZero() || now.Sub(changed) < *qualityStale {
+		q.Signals["fresh"] = 1
+	} else {
+		hint(fmt.Sprintf("review the content, it didn't change since %s", changed.Format(DateFormat)))
+	}
+	q.Signals["readability"] = math.Max(0, math.Min(1, ease/60))
+	if ease < 30 {
+		hint("use shorter sentences and words")
+	}
+
+	var sum, total float64
+	for _, s := range QualitySignals {
+		sum += ws[s] * q.Signals[s]
+		total += ws[s]
+	}
+	if total > 0 {
+		q.Score = int(math.Round(100 * sum / total))
+	}
+	return q
+}
+
+// lastChange returns the lastmod or date of p or else the modification
+// time of its file.
+func lastChange(p *Page) time.Time {
+	for _, key := range []string{"lastmod", "date"} {
+		if t, ok := p.FrontMatter[key].(time.Time); ok {
+			return t
+		}
+	}
+	return pageModTime(p.Path)
+}
+
+// qualityReport scores all pages (including drafts) the user of r may
+// view, worst first.
+func qualityReport(r *http.Request) ([]*PageQuality, error) {
+	ws, err := parseWeights(*qualityWeights)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	qs := []*PageQuality{}
+	for _, info := range visibleInfos(r, index.Pages(true)) {
+		p, err := LoadPage(info.Path)
+		if err != nil {
+			continue
+		}
+		body := p.Body
+		if *largePage > 0 && len(body) > *largePage {
+			body = body[:*largePage]
+		}
+		qs = append(qs, pageQuality(p, body, info, ws, now))
+	}
+	sort.SliceStable(qs, func(i, j int) bool { return qs[i].Score < qs[j].Score })
+	return qs, nil
+}
+
+// qualityReportHandler serves the worklist as HTML (/report/quality) or
+// JSON (?format=json); ?limit= shows only the worst pages.
+func qualityReportHandler(w http.ResponseWriter, r *http.Request) {
+	qs, err := qualityReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if limit := intParam(r, "limit", 0); limit > 0 && len(qs) > limit {
+		qs = qs[:limit]
+	}
+	if r.FormValue("format") == "json" {
+		writeJSON(w, qs)
+		return
+	}
+	renderTemplate(w, "quality", qs)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeadingsSignal(t *testing.T) {
+	for i, this := range []struct {
+		body   string
+		words  int
+		expect float64
+	}{
+		{"short text", 2, 1},
+		{"long text", LongPageWords + 1, 0},
+		{"## A\n\ntext\n\n### B\n", 3, 1},
+		{"## A\n\n#### B\n", 2, 0.5},
+		{"## A\n\n```\n#### not a heading\n```\n", 4, 1},
+	} {
+		if v, _ := headingsSignal([]byte(this.body), this.words); v != this.expect {
+			t.Errorf("[%d] got %v but expected %v", i, v, this.expect)
+		}
+	}
+}
+
+func TestReadingEase(t *testing.T) {
+	easy, _ := readingEase("The cat sat on the mat. It was a good day.")
+	hard, _ := readingEase("Notwithstanding considerable organizational complexity, institutional decisionmaking necessitates comprehensive documentation procedures")
+	if easy < 60 || hard > 30 {
+		t.Errorf("got %.1f for easy and %.1f for hard text", easy, hard)
+	}
+	if _, words := readingEase(plainText([]byte("See [the docs](docs) and `x`.\n\n```\ncode here\n```\n"))); words != 5 {
+		t.Errorf("got %d words but expected 5", words)
+	}
+}
+
+func TestPageQuality(t *testing.T) {
+	ws, err := parseWeights("description=1,tags=1,links=0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err = parseWeights("unknown=1"); err == nil {
+		t.Errorf("expected an error for an unknown signal")
+	}
+	p := NewPage("q")
+	p.FrontMatter["description"] = "a page"
+	p.FrontMatter["date"] = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := pageQuality(p, []byte("Some text."), &PageInfo{Path: "q"}, ws, time.Now())
+	if q.Score != 50 {
+		t.Errorf("got score %d but expected 50", q.Score)
+	}
+	if q.Signals["fresh"] != 0 || len(q.Hints) != 2 {
+		t.Errorf("got signals %v and hints %q", q.Signals, q.Hints)
+	}
+}
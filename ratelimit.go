@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Changes (all requests but GET, HEAD and OPTIONS) and failed logins are
+// limited per client IP with token buckets: a bucket holds up to burst
+// tokens, refills with the rate per minute and every request takes one.
+// Without tokens the response is 429 Too Many Requests. A rate of 0
+// disables the limit.
+var (
+	writeRate  = flag.Float64("write-rate", 60, "changes per minute per client IP (0 disables the limit)")
+	writeBurst = flag.Int("write-burst", 20, "changes a client IP may make at once")
+	loginRate  = flag.Float64("login-rate", 5, "failed logins per minute per client IP (0 disables the limit)")
+	loginBurst = flag.Int("login-burst", 10, "failed logins a client IP may have at once")
+)
+
+// MaxBuckets is the number of buckets kept before full ones are dropped.
+const MaxBuckets = 10000
+
+var rateLimited uint64 // rejected requests
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter keeps a token bucket per key.
+type limiter struct {
+	mutex   sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func newLimiter(perMinute float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: perMinute / 60, burst: float64(burst), buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// refill returns the bucket of key with the tokens added since its last
+// use.
+func (l *limiter) refill(key string) *bucket {
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= MaxBuckets {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	return b
+}
+
+// sweep drops the buckets that are full again.
+func (l *limiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// wait returns how long key has to wait for a token (0 if it has one).
+func (l *limiter) wait(key string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b := l.refill(key)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// take takes a token of key and reports how long it has to wait if there
+// is none.
+func (l *limiter) take(key string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b := l.refill(key)
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+var writeLimiter, loginLimiter *limiter
+
+func initRateLimits() {
+	if *writeRate > 0 {
+		writeLimiter = newLimiter(*writeRate, *writeBurst)
+	}
+	if *loginRate > 0 {
+		loginLimiter = newLimiter(*loginRate, *loginBurst)
+	}
+}
+
+// clientIP returns the IP of the client of r (see proxyHandler).
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// tooManyRequests rejects r, which may be retried after d.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, d time.Duration) {
+	atomic.AddUint64(&rateLimited, 1)
+	logger(r.Context()).Warn("Rate limit exceeded", "remote", clientIP(r), "method", r.Method, "path", r.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
+
+// rateLimitHandler limits the changes per client IP.
+func rateLimitHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writeLimiter != nil && !isSafeMethod(r.Method) {
+			if d := writeLimiter.take(clientIP(r)); d > 0 {
+				tooManyRequests(w, r, d)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLimiter(60, 2)
+	l.now = func() time.Time { return now }
+	for i, this := range []struct {
+		key    string
+		after  time.Duration
+		expect time.Duration
+	}{
+		{"1.2.3.4", 0, 0},
+		{"1.2.3.4", 0, 0},
+		{"1.2.3.4", 0, time.Second},
+		{"5.6.7.8", 0, 0},
+		{"1.2.3.4", 500 * time.Millisecond, 500 * time.Millisecond},
+		{"1.2.3.4", 500 * time.Millisecond, 0},
+		{"1.2.3.4", 0, time.Second},
+		{"1.2.3.4", time.Hour, 0},
+		{"1.2.3.4", 0, 0},
+		{"1.2.3.4", 0, time.Second},
+	} {
+		now = now.Add(this.after)
+		if got := l.take(this.key); got != this.expect {
+			t.Errorf("[%d] got %s but expected %s", i, got, this.expect)
+		}
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	defer func(l *limiter) { writeLimiter = l }(writeLimiter)
+	writeLimiter = newLimiter(1, 1)
+	h := rateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, this := range []struct {
+		method, remote string
+		expect         int
+	}{
+		{"POST", "1.2.3.4:1000", http.StatusOK},
+		{"POST", "1.2.3.4:1001", http.StatusTooManyRequests},
+		{"GET", "1.2.3.4:1002", http.StatusOK},
+		{"POST", "5.6.7.8", http.StatusOK},
+		{"DELETE", "5.6.7.8", http.StatusTooManyRequests},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(this.method, "/save/index", nil)
+		r.RemoteAddr = this.remote
+		h.ServeHTTP(w, r)
+		if w.Code != this.expect {
+			t.Errorf("[%d] got %d but expected %d", i, w.Code, this.expect)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("[%d] got Retry-After %q but expected %q", i, w.Header().Get("Retry-After"), "60")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+)
+
+// In read-only mode (e.g. a public mirror of the wiki) pages are only
+// rendered: all changes and the pages for making them are refused and the
+// templates hide the links to them ({{if not readOnly}}).
+var readOnly = flag.Bool("read-only", false, "serve rendered pages only and refuse all changes")
+
+// editingPrefixes are the paths of the pages for making changes.
+var editingPrefixes = []string{"/edit/", "/new", "/rename/", "/attachments/", "/share/", "/admin/", "/auth/login"}
+
+// isEditingPath reports whether the page at path is for making changes.
+func isEditingPath(path string) bool {
+	for _, p := range editingPrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyHandler refuses changes and the pages for making them in
+// read-only mode.
+func readOnlyHandler(h http.Handler) http.Handler {
+	if !*readOnly {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GraphQL mutations are refused by the executor.
+		if !isSafeMethod(r.Method) && r.URL.Path != GraphQLPath || isEditingPath(r.URL.Path) {
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			http.Error(w, "the wiki is read-only", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
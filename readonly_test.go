@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadOnlyHandler(t *testing.T) {
+	defer func(ro bool) { *readOnly = ro }(*readOnly)
+	*readOnly = true
+	h := readOnlyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, this := range []struct {
+		method, url string
+		expect      int
+	}{
+		{"GET", "/view/index", http.StatusOK},
+		{"HEAD", "/list/", http.StatusOK},
+		{"GET", "/api/v1/pages", http.StatusOK},
+		{"GET", "/edit/index", http.StatusForbidden},
+		{"GET", "/new", http.StatusForbidden},
+		{"GET", "/admin/backup", http.StatusForbidden},
+		{"POST", "/save/index", http.StatusForbidden},
+		{"POST", "/api/v1/batch", http.StatusForbidden},
+		{"DELETE", "/admin/tokens", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(this.method, this.url, nil))
+		if w.Code != this.expect {
+			t.Errorf("[%d] got %d for %s %s but expected %d", i, w.Code, this.method, this.url, this.expect)
+		}
+	}
+}
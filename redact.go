@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Front matter fields marked "private = true" in the schema and blocks
+//
+//	::: private
+//	...
+//	:::
+//
+// in the body are stored like everything else but only shown to editors.
+// Everybody else (and everybody following a share link) gets pages without
+// them. Editing a page shows everything.
+var editors = flag.String("editors", "", "comma separated users and @groups (of the owners file) that see private fields and blocks (empty: everybody)")
+
+var privateBlock = regexp.MustCompile(`(?ms)^:::[ \t]*private[ \t]*\r?\n(.*?)^:::[ \t]*(?:\r?\n|\z)`)
+
+// isEditor reports whether the user of r (nil: an anonymous reader) sees
+// private content.
+func isEditor(r *http.Request) bool {
+	if *editors == "" {
+		return true
+	}
+	return r != nil && isListed(currentUser(r), *editors)
+}
+
+// isListed reports whether user is one of the comma separated users and
+// @groups (of the owners file) of list.
+func isListed(user, list string) bool {
+	for _, e := range strings.Split(list, ",") {
+		e = strings.TrimSpace(e)
+		if e == user || strings.HasPrefix(e, "@") && contains(owners.Group(e), user) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBody removes all private blocks from body.
+func redactBody(body []byte) []byte {
+	return privateBlock.ReplaceAll(body, nil)
+}
+
+// privateFields returns the names of the private fields of the page at path.
+func privateFields(path string) []string {
+	var ns []string
+	for _, f := range schema.FieldsFor(path) {
+		if f.Private {
+			ns = append(ns, f.Name)
+		}
+	}
+	return ns
+}
+
+// privateKeys returns the front matter keys of p that are private fields.
+// Keys are matched ignoring case like Hugo does.
+func (p *Page) privateKeys() []string {
+	var ks []string
+	for _, n := range privateFields(p.Path) {
+		for k := range p.FrontMatter {
+			if strings.EqualFold(k, n) {
+				ks = append(ks, k)
+			}
+		}
+	}
+	return ks
+}
+
+// HasPrivate reports whether p has private fields or blocks.
+func (p *Page) HasPrivate() bool {
+	return len(p.privateKeys()) > 0 || privateBlock.Match(p.Body)
+}
+
+// Redacted returns p without private fields and blocks (p itself if it
+// has none).
+func (p *Page) Redacted() *Page {
+	if !p.HasPrivate() {
+		return p
+	}
+	c := p.Copy()
+	for _, k := range p.privateKeys() {
+		delete(c.FrontMatter, k)
+	}
+	c.Body = redactBody(p.Body)
+	return c
+}
+
+// For returns p as shown to the user of r (nil: an anonymous reader):
+// private fields and blocks are only kept for editors and the listings on
+// the page only contain what the reader may view. Everything showing a
+// page outside the editor goes through it.
+func (p *Page) For(r *http.Request) *Page {
+	if !isEditor(r) {
+		p = p.Redacted()
+	}
+	c := *p
+	c.viewer = r
+	return &c
+}
+
+// sourceFor returns the stored source b of the page at path as the user of
+// r may see it, see For. It is b itself unless private content is removed.
+func sourceFor(r *http.Request, path string, b []byte) ([]byte, error) {
+	if isEditor(r) {
+		return b, nil
+	}
+	p, err := parsePage(path, b)
+	if err != nil {
+		return nil, err
+	}
+	if !p.HasPrivate() {
+		return b, nil
+	}
+	return p.Redacted().Source()
+}
+
+// redactInfo returns info without private fields.
+func redactInfo(info *PageInfo) *PageInfo {
+	ns := privateFields(info.Path)
+	if len(ns) == 0 {
+		return info
+	}
+	c := *info
+	c.Params = make(map[string]interface{}, len(info.Params))
+	for k, v := range info.Params {
+		c.Params[k] = v
+	}
+	for _, n := range ns {
+		delete(c.Params, strings.ToLower(n))
+	}
+	return &c
+}
+
+// privateBlockPlaceholders renders the private blocks of p marked as such
+// for editors.
+func privateBlockPlaceholders(p *Page, body []byte, ph *placeholders) []byte {
+	return privateBlock.ReplaceAllFunc(body, func(m []byte) []byte {
+		inner := p.Copy()
+		inner.Body = bytes.TrimSuffix(privateBlock.FindSubmatch(m)[1], []byte("\n"))
+		return []byte("\n" + ph.add(`<div class="private">`+string(renderPage(inner))+`</div>`) + "\n")
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactBody(t *testing.T) {
+	for i, this := range []struct {
+		body   string
+		expect string
+	}{
+		{"public\n", "public\n"},
+		{"a\n::: private\nsecret\n:::\nb\n", "a\nb\n"},
+		{"a\n:::private\nsecret\n\nmore\n:::", "a\n"},
+		{"::: private\nx\n:::\nmid\n::: private\ny\n:::\n", "mid\n"},
+		{"::: note\nkept\n:::\n", "::: note\nkept\n:::\n"},
+		{"text ::: private\nkept\n", "text ::: private\nkept\n"},
+	} {
+		if got := string(redactBody([]byte(this.body))); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	defer func(s *Schema, e string) { schema, *editors = s, e }(schema, *editors)
+	schema = &Schema{Fields: []*Field{{Name: "salary", Widget: WidgetText, Private: true}, {Name: "team", Widget: WidgetText}}}
+	p := &Page{Path: "people/alice", FrontMatter: map[string]interface{}{"title": "Alice", "salary": 100, "team": "docs"},
+		Body: []byte("Hi\n\n::: private\nPhone: 123\n:::\n")}
+
+	v := p.Redacted()
+	if _, ok := v.FrontMatter["salary"]; ok || v.FrontMatter["team"] != "docs" {
+		t.Errorf("got front matter %v", v.FrontMatter)
+	}
+	if strings.Contains(string(v.Body), "123") || !strings.Contains(string(p.Body), "123") {
+		t.Errorf("got body %q of the redacted page and %q of the original", v.Body, p.Body)
+	}
+	if got := string(renderPage(p)); !strings.Contains(got, `<div class="private"><p>Phone: 123</p>`) {
+		t.Errorf("expected the private block in %q", got)
+	}
+	if info := redactInfo(newPageInfo(p)); info.Params["salary"] != nil || info.Params["team"] != "docs" {
+		t.Errorf("got params %v", info.Params)
+	}
+
+	// field names are matched ignoring case
+	p = &Page{Path: "people/bob", FrontMatter: map[string]interface{}{"title": "Bob", "Salary": 100}, Body: []byte("Hi\n")}
+	if !p.HasPrivate() {
+		t.Errorf("expected the field Salary to be private")
+	}
+	if v := p.Redacted(); len(v.FrontMatter) != 1 || v.FrontMatter["title"] != "Bob" {
+		t.Errorf("got front matter %v", v.FrontMatter)
+	}
+	*editors = "alice"
+	if b, err := sourceFor(nil, p.Path, []byte("---\ntitle: Bob\nSalary: 100\n---\nHi\n")); err != nil || strings.Contains(string(b), "100") {
+		t.Errorf("got source %q (%v)", b, err)
+	}
+
+	*editors = "alice"
+	r := httptest.NewRequest("GET", "/view/people/alice", nil)
+	if isEditor(r) || !isEditor(withUser(r, "alice")) {
+		t.Errorf("expected only alice to be an editor")
+	}
+}
+
+// memArchiver keeps the files of an archive.
+type memArchiver map[string]string
+
+func (a memArchiver) Add(name string, size int64, modTime time.Time, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	a[name] = string(b)
+	return err
+}
+
+func (a memArchiver) Close() error {
+	return nil
+}
+
+func TestPageFor(t *testing.T) {
+	defer func(c ContentFS, s Storage, pi *pageIndex, e string) {
+		content, store, index, *editors = c, s, pi, e
+		cachedPages.Clear()
+	}(content, store, index, *editors)
+	content = newMemFS()
+	store = &fsStorage{fsys: content}
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	cachedPages.Clear()
+	*editors = "alice"
+	if err := content.WriteFile("docs/plan.md", []byte("+++\ntitle = \"Plan\"\n+++\n::: private\nSECRET\n:::\n\nPublic part\n")); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPage("docs/plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Update(p)
+
+	outputs := map[string]func(r *http.Request) string{
+		"summary": func(r *http.Request) string {
+			return sectionChildren(r, "docs", false)[0].Summary
+		},
+		"bundle": func(r *http.Request) string {
+			a := memArchiver{}
+			if err := writeBundle(a, p.For(r)); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			return a["plan/plan.md"] + a["plan/plan.html"]
+		},
+		"backup": func(r *http.Request) string {
+			a := memArchiver{}
+			if err := writeBackup(r, a, true, false); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			return a["content/docs/plan.md"]
+		},
+		"micropub": func(r *http.Request) string {
+			w := httptest.NewRecorder()
+			micropubQuery(w, withUser(httptest.NewRequest("GET", MicropubPath+"?q=source&url=/view/docs/plan", nil), currentUser(r)))
+			return w.Body.String()
+		},
+		"webdav": func(r *http.Request) string {
+			w := httptest.NewRecorder()
+			davHandler(w, withUser(httptest.NewRequest("GET", "/dav/docs/plan.md", nil), currentUser(r)))
+			return w.Body.String()
+		},
+		"rpc": func(r *http.Request) string {
+			t.Setenv("USER", currentUser(r))
+			var reply PageReply
+			if err := new(Wiki).Read(&PathArgs{Path: "docs/plan"}, &reply); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			return reply.Body
+		},
+	}
+	for name, output := range outputs {
+		for _, user := range []string{"bob", "alice"} {
+			got := output(withUser(httptest.NewRequest("GET", "/", nil), user))
+			if strings.Contains(got, "SECRET") != (user == "alice") || user == "bob" && !strings.Contains(got, "Public part") {
+				t.Errorf("%s for %s: got %q", name, user, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// LinkChange is a page whose links will be rewritten by a rename.
+type LinkChange struct {
+	Path  string
+	Links []DiffLine
+	Large bool // the page is too large to show the changed lines
+}
+
+type renameData struct {
+	Path    string
+	To      string
+	Err     string
+	Changes []LinkChange
+}
+
+// linkChanges returns all pages with links that have to be rewritten when
+// the page at from is renamed to to (including the page itself).
+func linkChanges(from, to string) ([]LinkChange, error) {
+	ps, err := listPages()
+	if err != nil {
+		return nil, err
+	}
+	var cs []LinkChange
+	for _, path := range ps {
+		p, err := LoadPage(path)
+		if err != nil {
+			continue
+		}
+		newPath := path
+		if path == from {
+			newPath = to
+		}
+		body := rewriteLinks(p.Body, path, newPath, renameFunc(from, to))
+		if body == nil {
+			continue
+		}
+		if p.Large() {
+			cs = append(cs, LinkChange{Path: path, Large: true})
+			continue
+		}
+		var ls []DiffLine
+		for _, d := range diffLines(string(p.Body), string(body)) {
+			if d.Kind != " " {
+				ls = append(ls, d)
+			}
+		}
+		cs = append(cs, LinkChange{Path: path, Links: ls})
+	}
+	return cs, nil
+}
+
+func renameFunc(from, to string) func(string) (string, bool) {
+	return func(path string) (string, bool) {
+		return to, path == from
+	}
+}
+
+func checkRename(from, to string) error {
+	if !isValidPath(to) {
+		return fmt.Errorf("invalid page path '%s'", to)
+	}
+	if from == to {
+		return fmt.Errorf("the new path is the old one")
+	}
+	if pageExists(to) {
+		return fmt.Errorf("page '%s' exists already", to)
+	}
+	if !pageExists(from) {
+		return fmt.Errorf("page '%s' doesn't exist", from)
+	}
+	return nil
+}
+
+// renamePage moves the page at from to to and rewrites the links in all
+// pages listed in rewrite, which the user of r has to be allowed to edit.
+// With keepAlias the old path becomes an alias. Owned pages can only be
+// moved by their owners; the link rewrites of owned pages are requested as
+// reviews.
+func renamePage(r *http.Request, from, to string, rewrite map[string]bool, keepAlias bool) error {
+	if err := checkRename(from, to); err != nil {
+		return err
+	}
+	user := currentUser(r)
+	for path := range rewrite {
+		if !isValidPath(path) {
+			return fmt.Errorf("invalid page path '%s'", path)
+		}
+	}
+	for _, path := range []string{from, to} {
+		if !tokenAllows(r, path) || !acls.Allowed(user, path, true) {
+			return fmt.Errorf("not allowed to edit '%s'", path)
+		}
+	}
+	if needsApproval(r, from) || needsApproval(r, to) {
+		return fmt.Errorf("unable to rename page '%s': %w", from, errReview)
+	}
+	err := store.Rename(from, to)
+	cachedPages.Invalidate(from, to)
+	if err != nil {
+		return fmt.Errorf("unable to rename page '%s' to '%s': %s", from, to, err)
+	}
+	index.Remove(from)
+
+	p, err := LoadPage(to)
+	if err != nil {
+		return err
+	}
+	old := p.Copy()
+	old.Path = from
+	// an alias of the new path (after renaming back) would loop
+	var as []string
+	for _, a := range p.Aliases() {
+		if ap := aliasPath(a); ap != to && (ap != from || !keepAlias) {
+			as = append(as, a)
+		}
+	}
+	if keepAlias {
+		as = append(as, "/"+from+"/")
+	}
+	if len(as) > 0 {
+		setStrings(p, "aliases", as)
+	} else {
+		delete(p.FrontMatter, "aliases")
+	}
+	if rewrite[from] {
+		if body := rewriteLinks(p.Body, from, to, renameFunc(from, to)); body != nil {
+			p.Body = body
+		}
+	}
+	if err = p.Save(); err != nil {
+		return err
+	}
+	aliases.Remove(from)
+	aliases.Update(p)
+	index.Update(p)
+	purgePages(old, p)
+
+	for path := range rewrite {
+		if path == from {
+			continue
+		}
+		if !tokenAllows(r, path) || !acls.Allowed(user, path, true) {
+			slog.Warn("Links of page not rewritten", "path", path, "user", user)
+			continue
+		}
+		lp, err := LoadPage(path)
+		if err != nil {
+			slog.Error("Unable to load page for rewriting links", "path", path, "err", err)
+			continue
+		}
+		body := rewriteLinks(lp.Body, path, path, renameFunc(from, to))
+		if body == nil {
+			continue
+		}
+		lold := lp.Copy()
+		lp.Body = body
+		if err = storePage(r, lp, lold, "rewrite links to "+from); err != nil && !errors.Is(err, errReview) {
+			slog.Error("Unable to rewrite links", "path", path, "err", err)
+		}
+	}
+	return nil
+}
+
+// renameHandler shows the rename form (GET), a preview of the link
+// rewrites (GET with "to") and renames the page (POST).
+func renameHandler(w http.ResponseWriter, r *http.Request, path string) {
+	data := renameData{Path: path, To: r.FormValue("to")}
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		rewrite := make(map[string]bool)
+		for _, p := range r.PostForm["rewrite"] {
+			rewrite[p] = true
+		}
+		err := renamePage(r, path, data.To, rewrite, r.FormValue("alias") == "on")
+		if err == nil {
+			audit(r, "rename", path+" -> "+data.To)
+			http.Redirect(w, r, "/edit/"+data.To, http.StatusFound)
+			return
+		}
+		logger(r.Context()).Error("Unable to rename page", "path", path, "err", err)
+		data.Err = err.Error()
+	}
+	if data.To != "" {
+		if err := checkRename(path, data.To); err != nil {
+			data.Err = err.Error()
+		} else if data.Changes, err = linkChanges(path, data.To); err != nil {
+			data.Err = err.Error()
+		}
+	}
+	renderTemplate(w, "rename", data)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenamePage(t *testing.T) {
+	testSetup(t)
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile("acl", []byte("locked/** edit=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(a string) { *aclFile = a }(*aclFile)
+	*aclFile = filepath.Join(dir, "acl")
+	acls = &aclTable{}
+	defer func() { acls = &aclTable{} }()
+	defer func(ai *aliasIndex) { aliases = ai }(aliases)
+	aliases = &aliasIndex{m: make(map[string]string)}
+
+	r := withUser(httptest.NewRequest("POST", "/rename/a", nil), "bob")
+	for _, this := range []struct{ path, body string }{
+		{"a", "A"},
+		{"b", "[a](/view/a)"},
+		{"locked/c", "[a](/view/a)"},
+	} {
+		p := NewPage(this.path)
+		p.Body = []byte(this.body)
+		if err := storePage(r, p, NewPage(p.Path), ""); err != nil {
+			t.Fatalf("unable to store %s: %s", this.path, err)
+		}
+	}
+	body := func(path string) string {
+		p, err := LoadPage(path)
+		if err != nil {
+			return err.Error()
+		}
+		return strings.TrimSpace(string(p.Body))
+	}
+
+	for i, rewrite := range []map[string]bool{{"../etc/passwd": true}, {"": true}} {
+		if err := renamePage(r, "a", "x", rewrite, true); err == nil || !pageExists("a") {
+			t.Errorf("[%d] expected the rename with invalid rewrites to fail but got %v", i, err)
+		}
+	}
+	if err := renamePage(r, "a", "locked/a", nil, true); err == nil || !pageExists("a") {
+		t.Errorf("expected the rename to a locked page to fail but got %v", err)
+	}
+	if err := renamePage(r, "a", "x", map[string]bool{"b": true, "locked/c": true}, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := body("b"); got != "[a](/view/x)" {
+		t.Errorf("got links %q", got)
+	}
+	if got := body("locked/c"); got != "[a](/view/a)" {
+		t.Errorf("got links %q of a page bob may not edit", got)
+	}
+
+	for i, this := range []struct {
+		from, to string
+		aliases  []string
+		lookups  map[string]string
+	}{
+		{"x", "y", []string{"/a/", "/x/"}, map[string]string{"a": "y", "x": "y"}},
+		// renaming back drops the alias of the page itself
+		{"y", "a", []string{"/x/", "/y/"}, map[string]string{"a": "", "x": "a", "y": "a"}},
+	} {
+		if err := renamePage(r, this.from, this.to, nil, true); err != nil {
+			t.Fatalf("[%d] unexpected error: %s", i, err)
+		}
+		p, err := LoadPage(this.to)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", i, err)
+		}
+		if got := p.Aliases(); !reflect.DeepEqual(got, this.aliases) {
+			t.Errorf("[%d] got aliases %q but expected %q", i, got, this.aliases)
+		}
+		for a, expect := range this.lookups {
+			if got, _ := aliases.Lookup(a); got != expect {
+				t.Errorf("[%d] got target %q of alias %s but expected %q", i, got, a, expect)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmparser "github.com/yuin/goldmark/parser"
+)
+
+var defaultMarkup = flag.String("markup", "markdown", "renderer for pages without a 'markup' front matter field")
+
+// Renderer converts the markup of a page body to HTML.
+// Shortcodes and runnable code blocks are already replaced by placeholders
+// that have to be passed through unchanged.
+type Renderer interface {
+	Render(p *Page, src []byte) ([]byte, error)
+}
+
+// RendererFunc is an ordinary function used as Renderer.
+type RendererFunc func(p *Page, src []byte) ([]byte, error)
+
+func (f RendererFunc) Render(p *Page, src []byte) ([]byte, error) {
+	return f(p, src)
+}
+
+var (
+	renderersMutex sync.RWMutex
+	renderers      = map[string]Renderer{
+		"markdown": goldmarkRenderer,
+		"md":       goldmarkRenderer,
+		"goldmark": goldmarkRenderer,
+		"text":     RendererFunc(textRenderer),
+	}
+)
+
+// RegisterRenderer makes r available for pages with markup name
+// (front matter field "markup" like in Hugo). It replaces any renderer
+// already registered with that name.
+func RegisterRenderer(name string, r Renderer) {
+	renderersMutex.Lock()
+	defer renderersMutex.Unlock()
+	renderers[strings.ToLower(name)] = r
+}
+
+func rendererFor(p *Page) (Renderer, string) {
+	name := *defaultMarkup
+	if m, ok := p.FrontMatter["markup"].(string); ok && m != "" {
+		name = m
+	}
+	name = strings.ToLower(name)
+	renderersMutex.RLock()
+	defer renderersMutex.RUnlock()
+	return renderers[name], name
+}
+
+var goldmarkRenderer = newGoldmarkRenderer()
+
+// newGoldmarkRenderer configures goldmark like Hugo does by default
+// (raw HTML is omitted).
+func newGoldmarkRenderer() Renderer {
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM, extension.DefinitionList, extension.Footnote, extension.Typographer),
+		goldmark.WithParserOptions(gmparser.WithAutoHeadingID()),
+	)
+	return RendererFunc(func(p *Page, src []byte) ([]byte, error) {
+		var b bytes.Buffer
+		err := md.Convert(src, &b)
+		return b.Bytes(), err
+	})
+}
+
+func textRenderer(p *Page, src []byte) ([]byte, error) {
+	return []byte(`<pre class="text">` + html.EscapeString(string(src)) + `</pre>`), nil
+}
+
+// renderPage renders the body of p with the renderer for its markup.
+func renderPage(p *Page) template.HTML {
+	r, name := rendererFor(p)
+	if r == nil {
+		slog.Warn("No renderer for markup", "markup", name, "path", p.Path)
+		return renderShortcodes(p, p.Body)
+	}
+	ph := &placeholders{}
+	src := privateBlockPlaceholders(p, p.Body, ph)
+	src = runBlockPlaceholders(src, ph)
+	src = wikiLinkPlaceholders(src, ph)
+	var b strings.Builder
+	walkShortcodes(p, string(src), func(text string) {
+		b.WriteString(text)
+	}, func(h string) {
+		b.WriteString(ph.add(h))
+	})
+	out, err := r.Render(p, []byte(b.String()))
+	if err != nil {
+		slog.Error("Unable to render page", "path", p.Path, "markup", name, "err", err)
+		return renderShortcodes(p, p.Body)
+	}
+	if *sanitizeEnabled {
+		out = sanitizePolicy.Sanitize(out)
+	}
+	return template.HTML(ph.restore(out))
+}
+
+// wikiLinkPlaceholders replaces [[path#anchor|label]] by HTML links since
+// Markdown doesn't know them.
+func wikiLinkPlaceholders(body []byte, ph *placeholders) []byte {
+	return wikiLink.ReplaceAllFunc(body, func(m []byte) []byte {
+		sm := wikiLink.FindSubmatch(m)
+		target := strings.TrimSpace(string(sm[1]))
+		label := strings.TrimPrefix(string(sm[3]), "|")
+		if label == "" {
+			label = target
+		}
+		href := "/view/" + strings.TrimSuffix(strings.TrimPrefix(target, "/"), Suffix) + string(sm[2])
+		return []byte(ph.add(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(label) + `</a>`))
+	})
+}
+
+// placeholders keep rendered HTML out of the way of the markup renderer.
+type placeholders struct {
+	html []string
+}
+
+var placeholder = regexp.MustCompile(`<p>GWIKIPLACEHOLDER(\d+)X</p>|GWIKIPLACEHOLDER(\d+)X`)
+
+func (ph *placeholders) add(h string) string {
+	ph.html = append(ph.html, h)
+	return fmt.Sprintf("GWIKIPLACEHOLDER%dX", len(ph.html)-1)
+}
+
+// restore replaces all placeholders in out by their HTML. Block level
+// HTML loses the paragraph the renderer put around its placeholder.
+// Placeholders in attributes (e.g. a shortcode as link target) are
+// escaped and, since out is sanitized before, their URLs checked here.
+func (ph *placeholders) restore(out []byte) string {
+	if len(ph.html) == 0 {
+		return string(out)
+	}
+	var policy *SanitizePolicy
+	if *sanitizeEnabled {
+		policy = sanitizePolicy
+	}
+	out = replaceInAttributes(out, placeholder, ph.get, policy)
+	return placeholder.ReplaceAllStringFunc(string(out), ph.get)
+}
+
+// get returns the HTML of the placeholder m.
+func (ph *placeholders) get(m string) string {
+	sm := placeholder.FindStringSubmatch(m)
+	n := sm[1] + sm[2]
+	i, err := strconv.Atoi(n)
+	if err != nil || i >= len(ph.html) {
+		return m
+	}
+	return ph.html[i]
+}
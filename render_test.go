@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderPage(t *testing.T) {
+	for i, this := range []struct {
+		markup string
+		body   string
+		expect string
+	}{
+		{"", "# Title\n\nsome *text* <b>", "<h1 id=\"title\">Title</h1>\n<p>some <em>text</em> <!-- raw HTML omitted --></p>\n"},
+		{"", `{{< figure src="/a.png" >}}`, "<figure><img src=\"/a.png\"></figure>\n"},
+		{"", `see [post]({{< ref "blog/post.md" >}})`, "<p>see <a href=\"/view/blog/post\">post</a></p>\n"},
+		{"", "see [[blog/post#top|the post]]", "<p>see <a href=\"/view/blog/post#top\">the post</a></p>\n"},
+		{"", "```run:sh\necho hi\n```\n", "<pre><code class=\"language-sh\">echo hi\n</code></pre><p class=\"run-output\">Code execution is disabled.</p>\n"},
+		{"text", "*no* markdown {{% param author %}}", `<pre class="text">*no* markdown me</pre>`},
+		{"unknown", "a < b", "a &lt; b"},
+	} {
+		p := &Page{Path: "test", FrontMatter: map[string]interface{}{"author": "me"}}
+		if this.markup != "" {
+			p.FrontMatter["markup"] = this.markup
+		}
+		p.Body = []byte(this.body)
+		result := string(renderPage(p))
+
+		if result != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+}
+
+func TestRenderMaliciousShortcodes(t *testing.T) {
+	p := &Page{Path: "test", FrontMatter: map[string]interface{}{"link": "javascript:alert(1)", "quote": `x" onmouseover="alert(1)`}}
+	for i, this := range []struct {
+		body   string
+		expect string
+	}{
+		{`{{< figure src="/a.png" link="javascript:alert(1)" >}}`, "<figure><a><img src=\"/a.png\"></a></figure>\n"},
+		{`{{< figure src=" JavaScript:alert(1)" >}}`, "<figure><img></figure>\n"},
+		{`[x]({{< param link >}})`, "<p><a>x</a></p>\n"},
+		{`[x]({{< param quote >}})`, "<p><a href=\"x&#34; onmouseover=&#34;alert(1)\">x</a></p>\n"},
+		{`![x]({{< param link >}})`, "<p><img alt=\"x\"></p>\n"},
+		{`[post]({{< ref "blog/post.md" >}})`, "<p><a href=\"/view/blog/post\">post</a></p>\n"},
+	} {
+		p.Body = []byte(this.body)
+		if result := string(renderPage(p)); result != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+}
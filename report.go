@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+var reportLinks = flag.Bool("report-links", false, "print broken links and orphan pages and exit (exit code 1 if links are broken)")
+
+// BrokenLink is a link to a page that doesn't exist.
+type BrokenLink struct {
+	From   string `json:"from"`
+	Target string `json:"target"`
+}
+
+// LinkReport lists broken links and pages no other page links to.
+type LinkReport struct {
+	Broken  []BrokenLink `json:"broken"`
+	Orphans []*PageInfo  `json:"orphans"`
+}
+
+// linkReport checks all links in the index. Links to sections and aliases
+// aren't broken since the view handler resolves them. Section pages
+// (_index) and the home page are never orphans.
+func linkReport() *LinkReport {
+	rep := &LinkReport{Broken: []BrokenLink{}, Orphans: []*PageInfo{}}
+	linked := make(map[string]bool)
+	for _, info := range index.Pages(true) {
+		for _, t := range info.Links {
+			linked[t] = true
+		}
+		for _, t := range brokenLinks(info) {
+			rep.Broken = append(rep.Broken, BrokenLink{From: info.Path, Target: t})
+		}
+	}
+	for _, info := range index.Pages(true) {
+		if !linked[info.Path] && info.Path != IndexPage && !strings.HasSuffix(info.Path, "/"+IndexPage) {
+			rep.Orphans = append(rep.Orphans, info)
+		}
+	}
+	sort.Slice(rep.Broken, func(i, j int) bool {
+		if rep.Broken[i].From != rep.Broken[j].From {
+			return rep.Broken[i].From < rep.Broken[j].From
+		}
+		return rep.Broken[i].Target < rep.Broken[j].Target
+	})
+	return rep
+}
+
+// brokenLinks returns the link targets of the page that don't exist.
+func brokenLinks(info *PageInfo) []string {
+	var broken []string
+	for _, t := range info.Links {
+		if _, ok := index.Get(t); ok || isSection(t) {
+			continue
+		}
+		if _, ok := aliases.Lookup(t); ok {
+			continue
+		}
+		broken = append(broken, t)
+	}
+	return broken
+}
+
+func writeLinkReport(w io.Writer, rep *LinkReport) {
+	fmt.Fprintf(w, "Broken links (%d):\n", len(rep.Broken))
+	for _, b := range rep.Broken {
+		fmt.Fprintf(w, "  %s -> %s\n", b.From, b.Target)
+	}
+	fmt.Fprintf(w, "Orphan pages (%d):\n", len(rep.Orphans))
+	for _, o := range rep.Orphans {
+		fmt.Fprintf(w, "  %s\n", o.Path)
+	}
+}
+
+// For returns the part of the report the user of r may view: broken links
+// of the pages and the orphans they may view.
+func (rep *LinkReport) For(r *http.Request) *LinkReport {
+	v := &LinkReport{Broken: []BrokenLink{}, Orphans: visibleInfos(r, rep.Orphans)}
+	for _, b := range rep.Broken {
+		if mayView(r, b.From) {
+			v.Broken = append(v.Broken, b)
+		}
+	}
+	if v.Orphans == nil {
+		v.Orphans = []*PageInfo{}
+	}
+	return v
+}
+
+// linkReportHandler serves the report as HTML (/report/links) or JSON
+// (/report/links?format=json).
+func linkReportHandler(w http.ResponseWriter, r *http.Request) {
+	rep := linkReport().For(r)
+	if r.FormValue("format") == "json" {
+		writeJSON(w, rep)
+		return
+	}
+	renderTemplate(w, "linkreport", rep)
+}
+
+func printLinkReport() {
+	rep := linkReport()
+	writeLinkReport(os.Stdout, rep)
+	if len(rep.Broken) > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
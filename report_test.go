@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLinkReport(t *testing.T) {
+	testSetup(t)
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile("acl", []byte("secret/** view=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(a string) { *aclFile = a }(*aclFile)
+	*aclFile = filepath.Join(dir, "acl")
+	acls = &aclTable{}
+	defer func() { acls = &aclTable{} }()
+	defer func(ai *aliasIndex) { aliases = ai }(aliases)
+	aliases = &aliasIndex{m: make(map[string]string)}
+
+	r := httptest.NewRequest("POST", "/save/", nil)
+	for _, this := range []struct{ path, body, aliases string }{
+		{IndexPage, "[a](/view/a)", ""},
+		{"a", "[b](/view/b) [gone](/view/missing) [docs](/view/docs) [old](/view/old)\n\n" +
+			"![diagram](/files/a/diagram.png) [spec](/files/a/spec.pdf) [style](/static/css/style.css) " +
+			"![diagram](diagram.png) [mail](mailto:bob@example.com)", ""},
+		{"b", "B", "/old/"},
+		{"docs/x", "X", ""},
+		{"docs/" + IndexPage, "Docs", ""},
+		{"secret/plan", "[gone](/view/missing)", ""},
+	} {
+		p := NewPage(this.path)
+		p.Body = []byte(this.body)
+		p.SetAliases(this.aliases)
+		if err := storePage(r, p, NewPage(p.Path), ""); err != nil {
+			t.Fatalf("unable to store %s: %s", this.path, err)
+		}
+	}
+
+	if info, _ := index.Get("a"); !reflect.DeepEqual(info.Links, []string{"b", "docs", "missing", "old"}) {
+		t.Errorf("got links %q", info.Links)
+	}
+	rep := linkReport()
+	if expect := []BrokenLink{{"a", "missing"}, {"secret/plan", "missing"}}; !reflect.DeepEqual(rep.Broken, expect) {
+		t.Errorf("got broken links %v but expected %v", rep.Broken, expect)
+	}
+	orphans := func(rep *LinkReport) []string {
+		ps := []string{}
+		for _, o := range rep.Orphans {
+			ps = append(ps, o.Path)
+		}
+		return ps
+	}
+	if got, expect := orphans(rep), []string{"docs/x", "secret/plan"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("got orphans %q but expected %q", got, expect)
+	}
+	var buf bytes.Buffer
+	writeLinkReport(&buf, rep)
+	if expect := "Broken links (2):\n  a -> missing\n  secret/plan -> missing\nOrphan pages (2):\n  docs/x\n  secret/plan\n"; buf.String() != expect {
+		t.Errorf("got report %q but expected %q", buf.String(), expect)
+	}
+
+	for i, this := range []struct {
+		user    string
+		broken  int
+		orphans []string
+	}{
+		{"anonymous", 1, []string{"docs/x"}},
+		{"alice", 2, []string{"docs/x", "secret/plan"}},
+	} {
+		w := httptest.NewRecorder()
+		linkReportHandler(w, withUser(httptest.NewRequest("GET", "/report/links?format=json", nil), this.user))
+		var got LinkReport
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("[%d] got invalid JSON %s: %s", i, w.Body, err)
+		}
+		if len(got.Broken) != this.broken || !reflect.DeepEqual(orphans(&got), this.orphans) {
+			t.Errorf("[%d] got report %s for %s", i, w.Body, this.user)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Changes needing the approval of an owner are kept as review requests
+// until an owner approves or rejects them.
+var reviewsDir = flag.String("reviews-dir", "./reviews/", "directory for review requests of owned pages")
+
+var validReviewID = regexp.MustCompile(`^[0-9]+$`)
+
+var errReview = errors.New("owner approval required")
+
+// reviewError is returned for changes that were stored as review request.
+type reviewError struct {
+	review *Review
+}
+
+func (e *reviewError) Error() string {
+	return errReview.Error()
+}
+
+func (e *reviewError) Unwrap() error {
+	return errReview
+}
+
+// Review is a change of a page waiting for the approval of an owner.
+type Review struct {
+	ID          string                 `json:"id"`
+	Path        string                 `json:"path"`
+	User        string                 `json:"user"`
+	Time        time.Time              `json:"time"`
+	Summary     string                 `json:"summary,omitempty"`
+	Base        string                 `json:"base"` // revision the change is based on
+	FrontMatter map[string]interface{} `json:"frontMatter"`
+	Body        string                 `json:"body"`
+	Delete      bool                   `json:"delete,omitempty"` // the page is deleted
+	Status      string                 `json:"status"`           // "pending", "approved" or "rejected"
+	Reviewer    string                 `json:"reviewer,omitempty"`
+}
+
+func reviewFile(id string) string {
+	return filepath.Join(*reviewsDir, id+".json")
+}
+
+// requestReview stores the change of old to p as review request and
+// notifies the owners. p is nil for the deletion of old.
+func requestReview(r *http.Request, p, old *Page, summary string) (*Review, error) {
+	rv := &Review{
+		ID:      strconv.FormatInt(time.Now().UnixNano(), 10),
+		Path:    old.Path,
+		User:    currentUser(r),
+		Time:    time.Now().UTC(),
+		Summary: strings.TrimSpace(summary),
+		Base:    old.Revision,
+		Delete:  p == nil,
+		Status:  "pending",
+	}
+	if p != nil {
+		rv.FrontMatter, rv.Body = p.FrontMatter, string(p.Body)
+	}
+	if err := writeJSONFile(reviewFile(rv.ID), rv); err != nil {
+		return nil, err
+	}
+	audit(r, "request-review", rv.Path)
+	notifyOwners(r, rv.Path, "review", "review request for "+rv.Path,
+		&changeMail{User: rv.User, Path: rv.Path, Summary: rv.Summary, Review: rv.ID})
+	return rv, nil
+}
+
+func loadReview(id string) (*Review, error) {
+	if !validReviewID.MatchString(id) {
+		return nil, fmt.Errorf("invalid review '%s'", id)
+	}
+	b, err := ioutil.ReadFile(reviewFile(id))
+	if err != nil {
+		return nil, err
+	}
+	rv := &Review{}
+	return rv, json.Unmarshal(b, rv)
+}
+
+// listReviews returns all pending review requests, oldest first.
+func listReviews() ([]*Review, error) {
+	fns, err := filepath.Glob(filepath.Join(*reviewsDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var rvs []*Review
+	for _, fn := range fns {
+		rv, err := loadReview(strings.TrimSuffix(filepath.Base(fn), ".json"))
+		if err != nil {
+			slog.Warn("Unable to read review request", "file", fn, "err", err)
+			continue
+		}
+		if rv.Status == "pending" {
+			rvs = append(rvs, rv)
+		}
+	}
+	sort.Slice(rvs, func(i, j int) bool { return rvs[i].Time.Before(rvs[j].Time) })
+	return rvs, nil
+}
+
+// decideReview approves or rejects a review request. Approved changes are
+// only saved if the page didn't change since the request.
+func decideReview(r *http.Request, rv *Review, approve bool) error {
+	user := currentUser(r)
+	if !owners.IsOwner(user, rv.Path) {
+		return fmt.Errorf("only owners of '%s' can decide about changes", rv.Path)
+	}
+	if rv.Status != "pending" {
+		return fmt.Errorf("the change was %s already", rv.Status)
+	}
+	status, action := "rejected", "reject-review"
+	if approve {
+		p, err := LoadPage(rv.Path)
+		if os.IsNotExist(err) {
+			p, err = NewPage(rv.Path), nil
+		}
+		if err != nil {
+			return err
+		}
+		if p.Revision != rv.Base {
+			return fmt.Errorf("page '%s' was changed since the review was requested", rv.Path)
+		}
+		if rv.Delete {
+			err = deletePage(r, rv.Path)
+		} else {
+			err = approveChange(r, rv, p)
+		}
+		if err != nil {
+			return err
+		}
+		status, action = "approved", "approve-review"
+	}
+	rv.Status, rv.Reviewer = status, user
+	audit(r, action, rv.Path)
+	return writeJSONFile(reviewFile(rv.ID), rv)
+}
+
+// approveChange saves the change of p requested by rv.
+func approveChange(r *http.Request, rv *Review, p *Page) error {
+	old := p.Copy()
+	p.FrontMatter, p.Body = rv.FrontMatter, []byte(rv.Body)
+	if err := validatePage(old, p); err != nil {
+		return err
+	}
+	summary := fmt.Sprintf("%s (by %s, approved by %s)", rv.Summary, rv.User, currentUser(r))
+	return storePage(r, p, old, strings.TrimSpace(summary))
+}
+
+type reviewsData struct {
+	Reviews []*Review
+	Review  *Review
+	diffData
+	Owner bool
+	Done  string
+}
+
+// reviewsHandler lists the pending review requests (/reviews), shows one
+// with its changes (?id=) and approves or rejects it (POST with
+// action=approve or action=reject).
+func reviewsHandler(w http.ResponseWriter, r *http.Request) {
+	data := reviewsData{}
+	var err error
+	if id := r.FormValue("id"); id != "" {
+		if data.Review, err = loadReview(id); err != nil || !mayView(r, data.Review.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		rv := data.Review
+		if r.Method == http.MethodPost {
+			if err = decideReview(r, rv, r.FormValue("action") == "approve"); err != nil {
+				data.Err = err.Error()
+			} else {
+				data.Done = rv.Status
+			}
+		}
+		data.Path, data.Owner = rv.Path, owners.IsOwner(currentUser(r), rv.Path)
+		old, err := LoadPage(rv.Path)
+		if err != nil {
+			old = NewPage(rv.Path)
+		}
+		data.FrontMatter = diffFrontMatter(old.FrontMatter, rv.FrontMatter)
+		if ob, nb := string(old.Body), rv.Body; ob != nb {
+			data.BodyChanged = true
+			data.Body = diffLines(ob, nb)
+		}
+	}
+	rvs, err := listReviews()
+	if err != nil && !os.IsNotExist(err) {
+		data.Err = err.Error()
+	}
+	for _, rv := range rvs {
+		if mayView(r, rv.Path) {
+			data.Reviews = append(data.Reviews, rv)
+		}
+	}
+	renderTemplate(w, "reviews", data)
+}
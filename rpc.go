@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+)
+
+var rpcMode = flag.Bool("rpc", false, "serve page operations as JSON-RPC on stdin/stdout instead of running the web server")
+
+// Wiki exposes the page operations to editor plugins via JSON-RPC
+// (methods "Wiki.List", "Wiki.Read", "Wiki.Write", "Wiki.Search" and "Wiki.Render").
+type Wiki struct{}
+
+type PathArgs struct {
+	Path string
+}
+
+type WriteArgs struct {
+	Path        string
+	FrontMatter map[string]interface{} // merged into the existing front matter
+	Body        string
+}
+
+type ListArgs struct {
+	Filter string // front matter filter expression, see ParseFilter
+}
+
+type SearchArgs struct {
+	Query  string
+	Filter string
+}
+
+type PageReply struct {
+	Path        string
+	FrontMatter map[string]interface{}
+	Body        string
+}
+
+func (w *Wiki) List(args *ListArgs, reply *[]string) error {
+	if args.Filter == "" {
+		ps, err := listPages()
+		*reply = ps
+		return err
+	}
+	infos, err := filterPages(args.Filter, "", true, false)
+	*reply = infoPaths(infos)
+	return err
+}
+
+func (w *Wiki) Read(args *PathArgs, reply *PageReply) error {
+	p, err := loadValidPage(args.Path)
+	if err != nil {
+		return err
+	}
+	p = p.For(rpcRequest())
+	*reply = PageReply{Path: p.Path, FrontMatter: p.FrontMatter, Body: string(p.Body)}
+	return nil
+}
+
+func (w *Wiki) Write(args *WriteArgs, reply *PageReply) error {
+	if !isValidPath(args.Path) {
+		return fmt.Errorf("invalid page path '%s'", args.Path)
+	}
+	if int64(len(args.Body)) > *maxPageSize {
+		return fmt.Errorf("page '%s' is larger than %d bytes", args.Path, *maxPageSize)
+	}
+	p, err := LoadPage(args.Path)
+	if err != nil {
+		p = NewPage(args.Path)
+	}
+	old := p.Copy()
+	for k, v := range args.FrontMatter {
+		p.FrontMatter[k] = v
+	}
+	p.Body = []byte(args.Body)
+	if err = checkPage(old, p); err != nil {
+		return err
+	}
+	if err = storePage(rpcRequest(), p, old, ""); err != nil {
+		return err
+	}
+	*reply = PageReply{Path: p.Path, FrontMatter: p.FrontMatter, Body: string(p.Body)}
+	return nil
+}
+
+func (w *Wiki) Search(args *SearchArgs, reply *[]string) error {
+	if args.Filter == "" {
+		ps, err := searchPages(args.Query)
+		*reply = ps
+		return err
+	}
+	infos, err := filterPages(args.Filter, args.Query, true, false)
+	*reply = infoPaths(infos)
+	return err
+}
+
+func infoPaths(infos []*PageInfo) []string {
+	ps := make([]string, len(infos))
+	for i, info := range infos {
+		ps[i] = info.Path
+	}
+	return ps
+}
+
+func (w *Wiki) Render(args *PathArgs, reply *string) error {
+	p, err := loadValidPage(args.Path)
+	if err != nil {
+		return err
+	}
+	*reply = string(p.For(rpcRequest()).Rendered())
+	return nil
+}
+
+func loadValidPage(path string) (*Page, error) {
+	if !isValidPath(path) {
+		return nil, fmt.Errorf("invalid page path '%s'", path)
+	}
+	return LoadPage(path)
+}
+
+func rpcUser() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	return "anonymous"
+}
+
+// rpcRequest returns a request of the RPC user, so the rules of the web
+// pages apply to it.
+func rpcRequest() *http.Request {
+	return localRequest(rpcUser(), "rpc")
+}
+
+type stdioConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (c stdioConn) Close() error {
+	return nil
+}
+
+// serveRPC serves the Wiki methods on stdin/stdout until stdin is closed.
+func serveRPC() {
+	srv := rpc.NewServer()
+	if err := srv.Register(new(Wiki)); err != nil {
+		fatal("Unable to register RPC methods", "err", err)
+	}
+	slog.Info("Serving JSON-RPC on stdin/stdout")
+	srv.ServeCodec(jsonrpc.NewServerCodec(stdioConn{os.Stdin, os.Stdout}))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWikiWrite(t *testing.T) {
+	testSetup(t)
+	defer func(ai *aliasIndex) { aliases = ai }(aliases)
+	aliases = &aliasIndex{m: make(map[string]string)}
+	p := NewPage("a")
+	p.FrontMatter[IDKey] = "1234"
+	p.SetAliases("/old/")
+	if err := storePage(httptest.NewRequest("POST", "/save/a", nil), p, NewPage("a"), ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	w := new(Wiki)
+	for i, this := range []struct {
+		path        string
+		frontMatter map[string]interface{}
+		ok          bool
+	}{
+		{"b", map[string]interface{}{IDKey: "1234"}, false},
+		{"b", map[string]interface{}{"aliases": []string{"/old/"}}, false},
+		{"../b", nil, false},
+		{"b", map[string]interface{}{IDKey: "5678", "aliases": []string{"/older/"}}, true},
+		{"a", map[string]interface{}{"title": "A"}, true},
+	} {
+		var reply PageReply
+		err := w.Write(&WriteArgs{Path: this.path, FrontMatter: this.frontMatter, Body: "Hello\n"}, &reply)
+		if (err == nil) != this.ok {
+			t.Errorf("[%d] got error %v writing %s", i, err, this.path)
+			continue
+		}
+		if _, exists := index.Get(this.path); exists != this.ok {
+			t.Errorf("[%d] got %s stored %t", i, this.path, exists)
+		}
+		if this.ok && reply.Body != "Hello\n" {
+			t.Errorf("[%d] got reply %v", i, reply)
+		}
+	}
+}
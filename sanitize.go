@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/flowdev/gwiki/parser"
+	"golang.org/x/net/html"
+)
+
+// The HTML of the markup renderers is sanitized before shortcodes and
+// other HTML of gwiki itself are put in, so raw HTML in pages can't run
+// scripts in the browsers of readers; the URLs shortcodes put in are
+// checked afterwards. Like bluemonday's UGC policy only formatting
+// elements and attributes and URLs with safe schemes are kept; the policy
+// file adds more.
+var (
+	sanitizeEnabled    = flag.Bool("sanitize", true, "sanitize the HTML of rendered pages")
+	sanitizePolicyFile = flag.String("sanitize-policy", "./gwiki-sanitize.toml", "file with elements, attributes and URL schemes allowed in rendered pages in addition to the defaults (TOML, YAML or JSON)")
+)
+
+// SanitizePolicy lists what is kept by the sanitizer.
+type SanitizePolicy struct {
+	Elements   map[string]bool
+	Attributes map[string]map[string]bool // per element, "*" for all
+	Schemes    map[string]bool            // of absolute URLs
+}
+
+var textAlign = regexp.MustCompile(`^text-align:\s*(left|right|center);?$`)
+
+// urlAttributes contain URLs.
+var urlAttributes = map[string]bool{"href": true, "src": true, "cite": true, "action": true, "formaction": true, "poster": true, "background": true, "longdesc": true}
+
+// droppedElements are removed with their content, other elements that
+// aren't allowed only lose their tags.
+var droppedElements = map[string]bool{"script": true, "style": true, "iframe": true, "object": true, "embed": true, "noscript": true, "template": true, "textarea": true, "title": true, "xmp": true, "noembed": true, "noframes": true, "plaintext": true, "svg": true, "math": true}
+
+func setOf(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, f := range strings.Fields(s) {
+		m[f] = true
+	}
+	return m
+}
+
+func defaultSanitizePolicy() *SanitizePolicy {
+	return &SanitizePolicy{
+		Elements: setOf(`a abbr b bdi bdo blockquote br caption cite code col colgroup dd del details dfn div dl dt em
+			figcaption figure h1 h2 h3 h4 h5 h6 hr i img input ins kbd li mark ol p pre q rp rt ruby s samp section small
+			span strike strong sub summary sup table tbody td tfoot th thead time tr tt u ul var wbr`),
+		Attributes: map[string]map[string]bool{
+			"*":          setOf("id class title lang dir role"),
+			"a":          setOf("href name rel"),
+			"img":        setOf("src alt width height"),
+			"input":      setOf("type checked disabled"),
+			"ol":         setOf("start reversed type"),
+			"li":         setOf("value"),
+			"td":         setOf("align colspan rowspan style"),
+			"th":         setOf("align colspan rowspan scope style"),
+			"col":        setOf("span"),
+			"colgroup":   setOf("span"),
+			"blockquote": setOf("cite"),
+			"q":          setOf("cite"),
+			"del":        setOf("cite datetime"),
+			"ins":        setOf("cite datetime"),
+			"time":       setOf("datetime"),
+			"details":    setOf("open"),
+		},
+		Schemes: setOf("http https mailto tel ftp"),
+	}
+}
+
+var sanitizePolicy = defaultSanitizePolicy()
+
+// loadSanitizePolicy returns the default policy extended by the policy
+// file fn. A missing file means the default policy.
+//
+//	elements = ["iframe", "video"]
+//	schemes = ["xmpp"]
+//	[attributes]
+//	iframe = ["src", "width", "height", "allowfullscreen"]
+//	"*" = ["style"]
+func loadSanitizePolicy(fn string) (*SanitizePolicy, error) {
+	p := defaultSanitizePolicy()
+	data, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	switch filepath.Ext(fn) {
+	case ".json":
+		raw, err = parser.HandleJSONMetaData(data)
+	case ".yaml", ".yml":
+		raw, err = parser.HandleYAMLMetaData(data)
+	default:
+		raw, err = parser.HandleTOMLMetaData(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse sanitize policy '%s': %s", fn, err)
+	}
+	m := lowerKeys(raw)
+	for _, e := range toStrings(m["elements"]) {
+		e = strings.ToLower(e)
+		p.Elements[e] = true
+	}
+	for _, s := range toStrings(m["schemes"]) {
+		p.Schemes[strings.ToLower(s)] = true
+	}
+	as, _ := m["attributes"].(map[string]interface{})
+	for e, v := range as {
+		e = strings.ToLower(e)
+		if p.Attributes[e] == nil {
+			p.Attributes[e] = make(map[string]bool)
+		}
+		for _, a := range toStrings(v) {
+			p.Attributes[e][strings.ToLower(a)] = true
+		}
+	}
+	return p, nil
+}
+
+func initSanitizer() {
+	var err error
+	if sanitizePolicy, err = loadSanitizePolicy(*sanitizePolicyFile); err != nil {
+		fatal("Unable to read sanitize policy", "err", err)
+	}
+}
+
+// safeURL reports whether the URL u is relative or has an allowed scheme.
+func (p *SanitizePolicy) safeURL(u string) bool {
+	// browsers ignore white space and control characters in schemes
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	pu, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return pu.Scheme == "" || p.Schemes[strings.ToLower(pu.Scheme)]
+}
+
+func (p *SanitizePolicy) allowedAttr(elem string, a html.Attribute) bool {
+	if a.Namespace != "" || !(p.Attributes["*"][a.Key] || p.Attributes[elem][a.Key]) {
+		return false
+	}
+	if elem == "input" && a.Key == "type" && a.Val != "checkbox" {
+		return false // only the task lists of GFM
+	}
+	if a.Key == "style" && !p.Attributes["*"]["style"] && !textAlign.MatchString(a.Val) {
+		return false // only the alignment of GFM table cells
+	}
+	return !urlAttributes[a.Key] || p.safeURL(a.Val)
+}
+
+// SanitizeURLs returns the HTML fragment h of gwiki itself (e.g. of a
+// shortcode) without the URLs whose scheme p doesn't allow. Unlike
+// Sanitize it keeps all elements, so embeds still work, but parameters
+// like link="javascript:..." don't get through.
+func (p *SanitizePolicy) SanitizeURLs(h string) string {
+	var out strings.Builder
+	z := html.NewTokenizer(strings.NewReader(h))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out.String()
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(z.Raw())
+			continue
+		}
+		t := z.Token()
+		attrs := t.Attr[:0]
+		for _, a := range t.Attr {
+			if !urlAttributes[a.Key] || p.safeURL(a.Val) {
+				attrs = append(attrs, a)
+			}
+		}
+		if len(attrs) == len(t.Attr) {
+			out.WriteString(string(z.Raw()))
+			continue
+		}
+		t.Attr = attrs
+		out.WriteString(t.String())
+	}
+}
+
+// replaceInAttributes replaces the matches of re in the attribute values of
+// the HTML fragment b by the HTML replace returns for them, escaped as
+// attribute value. URL attributes with a scheme policy doesn't allow are
+// dropped then (nil: all are kept).
+func replaceInAttributes(b []byte, re *regexp.Regexp, replace func(string) string, policy *SanitizePolicy) []byte {
+	var out bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out.Bytes()
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken || !re.Match(z.Raw()) {
+			out.Write(z.Raw())
+			continue
+		}
+		t := z.Token()
+		attrs := t.Attr[:0]
+		for _, a := range t.Attr {
+			a.Val = html.UnescapeString(re.ReplaceAllStringFunc(a.Val, replace))
+			if policy == nil || !urlAttributes[a.Key] || policy.safeURL(a.Val) {
+				attrs = append(attrs, a)
+			}
+		}
+		t.Attr = attrs
+		out.WriteString(t.String())
+	}
+}
+
+// Sanitize returns the HTML fragment b with everything p doesn't allow
+// removed.
+func (p *SanitizePolicy) Sanitize(b []byte) []byte {
+	var out bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(b))
+	skip := "" // dropped element whose content is skipped
+	depth := 0 // of skip
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				slog.Warn("Unable to sanitize HTML", "err", z.Err())
+			}
+			return out.Bytes()
+		}
+		t := z.Token()
+		if skip != "" {
+			switch {
+			case tt == html.StartTagToken && t.Data == skip:
+				depth++
+			case tt == html.EndTagToken && t.Data == skip:
+				if depth--; depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+		switch tt {
+		case html.TextToken:
+			out.WriteString(html.EscapeString(t.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedElements[t.Data] && !p.Elements[t.Data] {
+				if tt == html.StartTagToken {
+					skip, depth = t.Data, 1
+				}
+				continue
+			}
+			if !p.Elements[t.Data] {
+				continue
+			}
+			attrs := t.Attr[:0]
+			for _, a := range t.Attr {
+				if p.allowedAttr(t.Data, a) {
+					attrs = append(attrs, a)
+				}
+			}
+			t.Attr = attrs
+			out.WriteString(t.String())
+		case html.EndTagToken:
+			if p.Elements[t.Data] {
+				out.WriteString(t.String())
+			}
+		case html.CommentToken:
+			out.WriteString(t.String()) // e.g. <!-- raw HTML omitted -->
+		}
+	}
+}
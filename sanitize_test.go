@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	p := defaultSanitizePolicy()
+	for i, this := range []struct {
+		src, expect string
+	}{
+		{`<p>some <em>text</em></p>`, `<p>some <em>text</em></p>`},
+		{`<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{`<img src="x.png" onerror="alert(1)">`, `<img src="x.png">`},
+		{`<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href=" java&#x09;script:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="https://example.com/?a=1&amp;b=2" target="_blank">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{`<a href="/view/docs#intro">x</a>`, `<a href="/view/docs#intro">x</a>`},
+		{`<iframe src="https://evil.example"><p>x</p></iframe>y`, `y`},
+		{`<form action="/save/x"><button>go</button></form>`, `go`},
+		{`<li><input checked="" disabled="" type="checkbox"> done</li>`, `<li><input checked="" disabled="" type="checkbox"> done</li>`},
+		{`<input type="text" name="q">`, `<input>`},
+		{`<div style="background:url(x)" class="note">&lt;b&gt;</div>`, `<div class="note">&lt;b&gt;</div>`},
+		{`<td style="text-align:right">1</td><td style="color:red">2</td>`, `<td style="text-align:right">1</td><td>2</td>`},
+		{`<!-- raw HTML omitted -->GWIKIPLACEHOLDER0X`, `<!-- raw HTML omitted -->GWIKIPLACEHOLDER0X`},
+	} {
+		if got := string(p.Sanitize([]byte(this.src))); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+
+	fn := filepath.Join(t.TempDir(), "sanitize.toml")
+	policy := "elements = [\"iframe\"]\nschemes = [\"xmpp\"]\n[attributes]\niframe = [\"src\"]\n"
+	if err := os.WriteFile(fn, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadSanitizePolicy(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := `<iframe src="https://video.example/1"></iframe><a href="xmpp:a@b">chat</a>`
+	if got := string(p.Sanitize([]byte(src))); got != src {
+		t.Errorf("got %q but expected %q", got, src)
+	}
+}
+
+func TestSanitizeURLs(t *testing.T) {
+	p := defaultSanitizePolicy()
+	for i, this := range []struct {
+		src, expect string
+	}{
+		{`<figure><a href="javascript:alert(1)"><img src="x.png"></a></figure>`, `<figure><a><img src="x.png"></a></figure>`},
+		{`<img src="data:text/html,x" alt="a &amp; b">`, `<img alt="a &amp; b">`},
+		{`<div class="embed"><iframe src="https://www.youtube.com/embed/x" allowfullscreen></iframe></div>`, `<div class="embed"><iframe src="https://www.youtube.com/embed/x" allowfullscreen></iframe></div>`},
+		{`<script src="https://gist.github.com/a/b.js"></script>`, `<script src="https://gist.github.com/a/b.js"></script>`},
+		{`/view/docs/intro`, `/view/docs/intro`},
+	} {
+		if got := p.SanitizeURLs(this.src); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+}
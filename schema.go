@@ -0,0 +1,305 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+var schemaFile = flag.String("schema", "./gwiki-schema.toml", "file describing custom front matter fields (TOML, YAML or JSON)")
+
+// Widgets usable for custom front matter fields.
+const (
+	WidgetText        = "text"
+	WidgetTextarea    = "textarea"
+	WidgetCheckbox    = "checkbox"
+	WidgetSelect      = "select"
+	WidgetMultiSelect = "multiselect"
+	WidgetDate        = "date"
+)
+
+// builtinFields have their own inputs in the editor and can't be redefined.
+var builtinFields = map[string]bool{
+	"title": true, "description": true, "date": true, "draft": true,
+	"tags": true, "language": true, "aliases": true,
+}
+
+// Field describes a custom front matter field.
+type Field struct {
+	Name     string
+	Label    string
+	Widget   string
+	Help     string
+	Options  []string // for select and multiselect
+	Required bool
+	Private  bool     // only shown to editors
+	Sections []string // empty means all sections
+}
+
+// Schema describes all custom front matter fields.
+type Schema struct {
+	Fields []*Field
+}
+
+var schema = &Schema{}
+
+// loadSchema reads the schema file. A missing file means no custom fields.
+//
+//	[fields.author]
+//	label = "Author"
+//	widget = "select"
+//	options = ["Alice", "Bob"]
+//	required = true
+//	private = true
+//	sections = ["blog"]
+func loadSchema(fn string) (*Schema, error) {
+	data, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return &Schema{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	switch filepath.Ext(fn) {
+	case ".json":
+		raw, err = parser.HandleJSONMetaData(data)
+	case ".yaml", ".yml":
+		raw, err = parser.HandleYAMLMetaData(data)
+	default:
+		raw, err = parser.HandleTOMLMetaData(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse schema '%s': %s", fn, err)
+	}
+	fields, _ := lowerKeys(raw)["fields"].(map[string]interface{})
+	s := &Schema{}
+	for name, v := range fields {
+		fm, _ := v.(map[string]interface{})
+		f := &Field{
+			Name:     name,
+			Label:    toString(fm["label"]),
+			Widget:   toString(fm["widget"]),
+			Help:     toString(fm["help"]),
+			Options:  toStrings(fm["options"]),
+			Required: fm["required"] == true,
+			Private:  fm["private"] == true,
+			Sections: toStrings(fm["sections"]),
+		}
+		if f.Label == "" {
+			f.Label = name
+		}
+		if f.Widget == "" {
+			f.Widget = WidgetText
+		}
+		if err = f.check(); err != nil {
+			return nil, fmt.Errorf("invalid schema '%s': %s", fn, err)
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	sort.Slice(s.Fields, func(i, j int) bool { return s.Fields[i].Name < s.Fields[j].Name })
+	return s, nil
+}
+
+func (f *Field) check() error {
+	if builtinFields[f.Name] {
+		return fmt.Errorf("field '%s' is built in", f.Name)
+	}
+	switch f.Widget {
+	case WidgetText, WidgetTextarea, WidgetCheckbox, WidgetDate:
+	case WidgetSelect, WidgetMultiSelect:
+		if len(f.Options) == 0 {
+			return fmt.Errorf("field '%s' needs options", f.Name)
+		}
+	default:
+		return fmt.Errorf("field '%s' has unknown widget '%s'", f.Name, f.Widget)
+	}
+	return nil
+}
+
+// FieldsFor returns the fields applicable to the page at path.
+func (s *Schema) FieldsFor(path string) []*Field {
+	var fs []*Field
+	for _, f := range s.Fields {
+		if len(f.Sections) == 0 {
+			fs = append(fs, f)
+			continue
+		}
+		for _, sec := range f.Sections {
+			if strings.HasPrefix(path, strings.Trim(sec, "/")+"/") {
+				fs = append(fs, f)
+				break
+			}
+		}
+	}
+	return fs
+}
+
+// FieldValue is a custom field together with the value of a page for the
+// edit template.
+type FieldValue struct {
+	*Field
+	Value  string
+	Values map[string]bool
+}
+
+func (p *Page) CustomFields() []FieldValue {
+	var fvs []FieldValue
+	for _, f := range schema.FieldsFor(p.Path) {
+		fv := FieldValue{Field: f, Values: make(map[string]bool)}
+		v, ok := p.FrontMatter[f.Name]
+		if ok {
+			switch f.Widget {
+			case WidgetMultiSelect:
+				for _, s := range toStrings(v) {
+					fv.Values[s] = true
+				}
+			case WidgetDate:
+				if t, ok := v.(time.Time); ok {
+					fv.Value = t.Format(DateFormat)
+				} else {
+					fv.Value = toString(v)
+				}
+			case WidgetCheckbox:
+				if v == true {
+					fv.Value = "on"
+				}
+			default:
+				fv.Value = toString(v)
+			}
+		}
+		fvs = append(fvs, fv)
+	}
+	return fvs
+}
+
+// SetCustomFields sets all custom fields of the page from the edit form.
+func (p *Page) SetCustomFields(form url.Values) {
+	for _, f := range schema.FieldsFor(p.Path) {
+		name := "field-" + f.Name
+		switch f.Widget {
+		case WidgetCheckbox:
+			p.FrontMatter[f.Name] = strings.EqualFold(form.Get(name), "on")
+		case WidgetMultiSelect:
+			setStrings(p, f.Name, form[name])
+		case WidgetDate:
+			if t, err := time.Parse(DateFormat, form.Get(name)); err == nil {
+				p.FrontMatter[f.Name] = t
+			} else if form.Get(name) == "" {
+				delete(p.FrontMatter, f.Name)
+			} else {
+				p.FrontMatter[f.Name] = form.Get(name) // reported by Validate
+			}
+		default:
+			if v := form.Get(name); v != "" {
+				p.FrontMatter[f.Name] = v
+			} else {
+				delete(p.FrontMatter, f.Name)
+			}
+		}
+	}
+}
+
+// Validate checks the custom front matter fields of p against the schema.
+func (s *Schema) Validate(p *Page) error {
+	var errs []string
+	for _, f := range s.FieldsFor(p.Path) {
+		v, ok := p.FrontMatter[f.Name]
+		if !ok || v == nil || v == "" {
+			if f.Required {
+				errs = append(errs, fmt.Sprintf("field '%s' is required", f.Name))
+			}
+			continue
+		}
+		if err := f.validate(v); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid front matter of page '%s': %s", p.Path, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (f *Field) validate(v interface{}) error {
+	switch f.Widget {
+	case WidgetCheckbox:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("field '%s' must be a boolean", f.Name)
+		}
+	case WidgetDate:
+		if _, ok := v.(time.Time); ok {
+			return nil
+		}
+		if _, err := parseTime(toString(v)); err != nil {
+			return fmt.Errorf("field '%s' must be a date", f.Name)
+		}
+	case WidgetSelect:
+		if !contains(f.Options, toString(v)) {
+			return fmt.Errorf("field '%s' must be one of: %s", f.Name, strings.Join(f.Options, ", "))
+		}
+	case WidgetMultiSelect:
+		ss, ok := v.([]string)
+		if !ok {
+			is, ok := v.([]interface{})
+			if !ok {
+				return fmt.Errorf("field '%s' must be a list", f.Name)
+			}
+			ss = toStrings(is)
+		}
+		for _, s := range ss {
+			if !contains(f.Options, s) {
+				return fmt.Errorf("field '%s' contains '%s' which isn't one of: %s", f.Name, s, strings.Join(f.Options, ", "))
+			}
+		}
+	default:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("field '%s' must be a string", f.Name)
+		}
+	}
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func toStrings(v interface{}) []string {
+	switch vs := v.(type) {
+	case []string:
+		return vs
+	case []interface{}:
+		ss := make([]string, len(vs))
+		for i, e := range vs {
+			ss[i] = toString(e)
+		}
+		return ss
+	case nil:
+		return nil
+	}
+	return []string{toString(v)}
+}
+
+func initSchema() {
+	s, err := loadSchema(*schemaFile)
+	if err != nil {
+		fatal("Unable to load schema", "err", err)
+	}
+	if len(s.Fields) > 0 {
+		slog.Info("Using custom front matter fields", "fields", len(s.Fields), "file", *schemaFile)
+	}
+	schema = s
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadSchema(t *testing.T) {
+	dir := t.TempDir()
+	for i, this := range []struct {
+		name, data, err string
+	}{
+		{"ok.toml", "[fields.author]\nwidget = \"select\"\noptions = [\"Alice\", \"Bob\"]\n", ""},
+		{"ok.yaml", "fields:\n  status:\n    required: true\n", ""},
+		{"ok.json", `{"fields": {"reviewed": {"widget": "checkbox"}}}`, ""},
+		{"builtin.toml", "[fields.title]\nlabel = \"Title\"\n", "field 'title' is built in"},
+		{"options.toml", "[fields.author]\nwidget = \"multiselect\"\n", "field 'author' needs options"},
+		{"widget.toml", "[fields.author]\nwidget = \"slider\"\n", "field 'author' has unknown widget 'slider'"},
+		{"syntax.toml", "[fields.author\n", "unable to parse schema"},
+	} {
+		fn := filepath.Join(dir, this.name)
+		if err := ioutil.WriteFile(fn, []byte(this.data), 0600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		s, err := loadSchema(fn)
+		switch {
+		case this.err == "" && err != nil:
+			t.Errorf("[%d] got unexpected error: %s", i, err)
+		case this.err == "" && len(s.Fields) != 1:
+			t.Errorf("[%d] got fields %v but expected one", i, s.Fields)
+		case this.err != "" && (err == nil || !strings.Contains(err.Error(), this.err)):
+			t.Errorf("[%d] got error %v but expected %q", i, err, this.err)
+		}
+	}
+	if s, err := loadSchema(filepath.Join(dir, "missing.toml")); err != nil || len(s.Fields) != 0 {
+		t.Errorf("got %v (%v) for a missing schema but expected no fields", s, err)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := &Schema{Fields: []*Field{
+		{Name: "author", Widget: WidgetSelect, Options: []string{"Alice", "Bob"}, Required: true},
+		{Name: "reviewed", Widget: WidgetCheckbox},
+		{Name: "due", Widget: WidgetDate},
+		{Name: "topics", Widget: WidgetMultiSelect, Options: []string{"go", "hugo"}},
+		{Name: "summary", Widget: WidgetTextarea, Sections: []string{"blog"}},
+	}}
+	for i, this := range []struct {
+		path        string
+		frontMatter map[string]interface{}
+		errs        []string
+	}{
+		{"docs/a", map[string]interface{}{"author": "Alice", "reviewed": true, "due": "2024-05-01", "topics": []interface{}{"go"}}, nil},
+		{"docs/a", map[string]interface{}{"author": "Bob", "due": time.Now()}, nil},
+		{"docs/a", map[string]interface{}{}, []string{"field 'author' is required"}},
+		{"docs/a", map[string]interface{}{"author": ""}, []string{"field 'author' is required"}},
+		{"docs/a", map[string]interface{}{"author": "Carol"}, []string{"field 'author' must be one of: Alice, Bob"}},
+		{"docs/a", map[string]interface{}{"author": "Alice", "reviewed": "yes"}, []string{"field 'reviewed' must be a boolean"}},
+		{"docs/a", map[string]interface{}{"author": "Alice", "due": "soon"}, []string{"field 'due' must be a date"}},
+		{"docs/a", map[string]interface{}{"author": "Alice", "topics": "go"}, []string{"field 'topics' must be a list"}},
+		{"docs/a", map[string]interface{}{"author": "Alice", "topics": []string{"go", "rust"}}, []string{"field 'topics' contains 'rust' which isn't one of: go, hugo"}},
+		{"docs/a", map[string]interface{}{"author": "Alice", "summary": 42}, nil},
+		{"blog/a", map[string]interface{}{"author": "Alice", "summary": 42}, []string{"field 'summary' must be a string"}},
+		{"blog/a", map[string]interface{}{"reviewed": 1, "due": "soon"}, []string{"field 'author' is required", "field 'reviewed' must be a boolean", "field 'due' must be a date"}},
+	} {
+		p := NewPage(this.path)
+		p.FrontMatter = this.frontMatter
+		err := s.Validate(p)
+		if this.errs == nil {
+			if err != nil {
+				t.Errorf("[%d] got unexpected error: %s", i, err)
+			}
+			continue
+		}
+		if expect := "invalid front matter of page '" + this.path + "': " + strings.Join(this.errs, "; "); err == nil || err.Error() != expect {
+			t.Errorf("[%d] got error %v but expected %q", i, err, expect)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Share links give read-only access to a single page (and optionally the
+// attachments next to it) until they expire. They are served below
+// /shared/, so a wiki that is private otherwise (e.g. behind an
+// authenticating proxy) only needs to expose that prefix and /static/.
+// They need no login since the signature grants the access, so authors
+// can let reviewers without an account preview drafts.
+var (
+	shareKeyFile = flag.String("share-key-file", "./share.key", "file with the secret key for signing share links (created if missing)")
+	shareMaxAge  = flag.Duration("share-max-age", 30*24*time.Hour, "maximum lifetime of share links")
+)
+
+const (
+	ShareDefaultDays  = 7
+	ShareDraftHours   = 48 // default for drafts, which change more often
+	ShareMinimumHours = 1
+	ShareKeyMinLength = 32
+)
+
+var shareKey []byte
+
+// ShareLink grants access to the page at Path until Expires.
+type ShareLink struct {
+	Path        string
+	Expires     time.Time
+	Attachments bool
+}
+
+func (l *ShareLink) sig() string {
+	att := "0"
+	if l.Attachments {
+		att = "1"
+	}
+	mac := hmac.New(sha256.New, shareKey)
+	fmt.Fprintf(mac, "%s\n%d\n%s", l.Path, l.Expires.Unix(), att)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns the path and query of the link.
+func (l *ShareLink) URL() string {
+	u := "/shared/" + l.Path + "?expires=" + strconv.FormatInt(l.Expires.Unix(), 10)
+	if l.Attachments {
+		u += "&attachments=1"
+	}
+	return u + "&sig=" + l.sig()
+}
+
+var errInvalidShare = errors.New("invalid or expired share link")
+
+// parseShareLink checks the signature and expiry of a request to /shared/.
+func parseShareLink(r *http.Request, path string) (*ShareLink, error) {
+	exp, err := strconv.ParseInt(r.FormValue("expires"), 10, 64)
+	if err != nil {
+		return nil, errInvalidShare
+	}
+	l := &ShareLink{Path: path, Expires: time.Unix(exp, 0), Attachments: r.FormValue("attachments") == "1"}
+	if !hmac.Equal([]byte(r.FormValue("sig")), []byte(l.sig())) || time.Now().After(l.Expires) {
+		return nil, errInvalidShare
+	}
+	return l, nil
+}
+
+func newShareLink(path string, age time.Duration, attachments bool) (*ShareLink, error) {
+	if age < ShareMinimumHours*time.Hour || age > *shareMaxAge {
+		return nil, fmt.Errorf("share links expire after %d hour to %d days", ShareMinimumHours, int(*shareMaxAge/(24*time.Hour)))
+	}
+	if !pageExists(path) {
+		return nil, fmt.Errorf("page '%s' doesn't exist", path)
+	}
+	return &ShareLink{Path: path, Expires: time.Now().Add(age).Truncate(time.Second), Attachments: attachments}, nil
+}
+
+type shareData struct {
+	Path  string
+	Draft bool
+	Valid int
+	Unit  string // "hours" or "days"
+	URL   string
+	Link  *ShareLink
+	Err   string
+}
+
+// shareHandler creates share links (/share/<page>) valid for some hours or
+// days.
+func shareHandler(w http.ResponseWriter, r *http.Request, path string) {
+	data := shareData{Path: path, Valid: ShareDefaultDays, Unit: "days"}
+	if p, err := loadPage(r.Context(), path); err == nil && isDraft(p) {
+		data.Draft, data.Valid, data.Unit = true, ShareDraftHours, "hours"
+	}
+	if r.Method == http.MethodPost {
+		valid, err := strconv.Atoi(r.FormValue("valid"))
+		if err == nil {
+			data.Valid, data.Unit = valid, r.FormValue("unit")
+			age := time.Duration(valid) * time.Hour
+			if data.Unit != "hours" {
+				data.Unit, age = "days", age*24
+			}
+			data.Link, err = newShareLink(path, age, r.FormValue("attachments") == "on")
+		}
+		if err != nil {
+			data.Err = err.Error()
+		} else {
+			data.URL = baseURL(r) + data.Link.URL()
+			audit(r, "share", path)
+		}
+	}
+	renderTemplate(w, "share", data)
+}
+
+type sharedData struct {
+	*Page
+	Draft       bool
+	Link        *ShareLink
+	Attachments []Attachment
+}
+
+// FileURL returns the share URL of an attachment.
+func (d *sharedData) FileURL(name string) string {
+	return d.Link.URL() + "&file=" + name
+}
+
+// sharedHandler serves a shared page read-only (/shared/<page>?...) and
+// its attachments (&file=<name>).
+func sharedHandler(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/shared/")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if !isValidPath(p) {
+		http.NotFound(w, r)
+		return
+	}
+	l, err := parseShareLink(r, p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	dir := attachmentDir(p)
+	if name := r.FormValue("file"); name != "" {
+		if !l.Attachments || !validAttachmentName.MatchString(name) || path.Ext(name) == Suffix {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFileFS(w, r, attachmentFS(dir), attachmentFile(dir, name))
+		return
+	}
+	pg, err := loadPage(r.Context(), p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	data := &sharedData{Page: pg.Redacted(), Draft: isDraft(pg), Link: l}
+	if l.Attachments {
+		if data.Attachments, err = listAttachments(dir); err != nil && !os.IsNotExist(err) {
+			logger(r.Context()).Error("Unable to list attachments", "path", p, "err", err)
+		}
+	}
+	renderTemplate(w, "shared", data)
+}
+
+// initShare loads the signing key or creates a new one.
+// loadShareKey reads the key in fn and creates it if the file is missing
+// or empty. Keys shorter than ShareKeyMinLength are refused since the key
+// also signs the CSRF tokens.
+func loadShareKey(fn string) ([]byte, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	key := []byte(strings.TrimSpace(string(b)))
+	if len(key) == 0 {
+		b = make([]byte, 32)
+		if _, err = rand.Read(b); err != nil {
+			return nil, err
+		}
+		key = []byte(hex.EncodeToString(b))
+		if err = ioutil.WriteFile(fn, key, 0600); err != nil {
+			return nil, err
+		}
+	}
+	if len(key) < ShareKeyMinLength {
+		return nil, fmt.Errorf("the key is shorter than %d bytes", ShareKeyMinLength)
+	}
+	return key, nil
+}
+
+func initShare() {
+	var err error
+	if shareKey, err = loadShareKey(*shareKeyFile); err != nil {
+		fatal("Unable to read share key", "file", *shareKeyFile, "err", err)
+	}
+}
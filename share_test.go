@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLink(t *testing.T) {
+	shareKey = []byte("test key")
+	valid := (&ShareLink{Path: "a/b", Expires: time.Now().Add(time.Hour).Truncate(time.Second)}).URL()
+	expired := (&ShareLink{Path: "a/b", Expires: time.Now().Add(-time.Hour)}).URL()
+
+	for i, this := range []struct {
+		url    string
+		expect bool
+	}{
+		{valid, true},
+		{expired, false},
+		{strings.Replace(valid, "/a/b?", "/a/c?", 1), false},
+		{strings.Replace(valid, "&sig=", "&attachments=1&sig=", 1), false},
+		{"/shared/a/b?expires=9999999999", false},
+	} {
+		r := httptest.NewRequest("GET", this.url, nil)
+		_, err := parseShareLink(r, strings.TrimPrefix(r.URL.Path, "/shared/"))
+		if result := err == nil; result != this.expect {
+			t.Errorf("[%d] got %t but expected %t for %s", i, result, this.expect, this.url)
+		}
+	}
+}
+
+func TestNewShareLinkAge(t *testing.T) {
+	defer func(s Storage, max time.Duration) { store, *shareMaxAge = s, max }(store, *shareMaxAge)
+	fsys := newMemFS()
+	fsys.WriteFile("draft.md", []byte("+++\ndraft = true\n+++\nwip\n"))
+	store = &fsStorage{fsys: fsys}
+	*shareMaxAge = 30 * 24 * time.Hour
+	for i, this := range []struct {
+		path   string
+		age    time.Duration
+		expect bool
+	}{
+		{"draft", time.Hour, true},
+		{"draft", 48 * time.Hour, true},
+		{"draft", 30 * 24 * time.Hour, true},
+		{"draft", 30*24*time.Hour + time.Hour, false},
+		{"draft", 30 * time.Minute, false},
+		{"missing", time.Hour, false},
+	} {
+		_, err := newShareLink(this.path, this.age, false)
+		if result := err == nil; result != this.expect {
+			t.Errorf("[%d] got %t but expected %t (err: %v)", i, result, this.expect, err)
+		}
+	}
+}
+
+func TestLoadShareKey(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "share.key")
+	key, err := loadShareKey(fn)
+	if err != nil || len(key) != 64 {
+		t.Fatalf("got key %q and error %v", key, err)
+	}
+	if again, err := loadShareKey(fn); err != nil || string(again) != string(key) {
+		t.Errorf("got key %q and error %v when reading it again", again, err)
+	}
+	empty := filepath.Join(dir, "empty.key")
+	os.WriteFile(empty, []byte("\n"), 0600)
+	if key, err := loadShareKey(empty); err != nil || len(key) != 64 {
+		t.Errorf("expected an empty key file to get a new key but got %q and %v", key, err)
+	}
+	short := filepath.Join(dir, "short.key")
+	os.WriteFile(short, []byte("secret"), 0600)
+	if _, err := loadShareKey(short); err == nil {
+		t.Error("expected a short key to be refused")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// shortcode is a single Hugo shortcode call found in a page body.
+type shortcode struct {
+	Name   string            // name of the shortcode, e.g. "figure"
+	Params map[string]string // named parameters (key="value")
+	Pos    []string          // positional parameters
+	Inner  string            // content between opening and closing tag (if any)
+	Raw    string            // the complete original text
+}
+
+func (sc *shortcode) Get(name string, pos int) string {
+	if v, ok := sc.Params[name]; ok {
+		return v
+	}
+	if pos >= 0 && pos < len(sc.Pos) {
+		return sc.Pos[pos]
+	}
+	return ""
+}
+
+// shortcodeFunc renders a shortcode to HTML.
+type shortcodeFunc func(p *Page, sc *shortcode) (string, error)
+
+var shortcodes = map[string]shortcodeFunc{
+	"figure":    figureShortcode,
+	"youtube":   youtubeShortcode,
+	"vimeo":     vimeoShortcode,
+	"gist":      gistShortcode,
+	"highlight": highlightShortcode,
+	"ref":       refShortcode,
+	"relref":    refShortcode,
+	"param":     paramShortcode,
+}
+
+var shortcodeTag = regexp.MustCompile(`\{\{([<%])\s*(/?)\s*([A-Za-z0-9_./-]+)((?:\s+(?:[A-Za-z0-9_-]+=)?(?:"[^"]*"|` + "`[^`]*`" + `|[^\s"` + "`" + `]+?))*?)\s*(/?)\s*[>%]\}\}`)
+var shortcodeComment = regexp.MustCompile(`\{\{([<%])/\*(.*?)\*/([>%])\}\}`)
+var shortcodeParam = regexp.MustCompile(`([A-Za-z0-9_-]+)=("[^"]*"|` + "`[^`]*`" + `|\S+)|("[^"]*"|` + "`[^`]*`" + `|\S+)`)
+
+// renderShortcodes expands all known shortcodes in body and HTML escapes the rest.
+// Unknown shortcodes are kept as visible text so nothing silently disappears.
+func renderShortcodes(p *Page, body []byte) template.HTML {
+	var b strings.Builder
+	walkShortcodes(p, string(body), func(text string) {
+		b.WriteString(html.EscapeString(text))
+	}, func(h string) {
+		b.WriteString(h)
+	})
+	return template.HTML(b.String())
+}
+
+// walkShortcodes calls text for the plain text parts of src and code with
+// the rendered HTML of each shortcode.
+func walkShortcodes(p *Page, src string, text func(string), code func(string)) {
+	for len(src) > 0 {
+		loc := firstShortcode(src)
+		if loc == nil {
+			text(src)
+			break
+		}
+		text(src[:loc[0]])
+		if c := shortcodeComment.FindStringSubmatchIndex(src[loc[0]:]); c != nil && c[0] == 0 {
+			// {{</* foo */>}} is how Hugo writes a literal shortcode.
+			m := src[loc[0] : loc[0]+c[1]]
+			sm := shortcodeComment.FindStringSubmatch(m)
+			text("{{" + sm[1] + sm[2] + sm[3] + "}}")
+			src = src[loc[0]+c[1]:]
+			continue
+		}
+		sc, end := parseShortcode(src, loc)
+		src = src[end:]
+		if sc == nil { // stray closing tag
+			continue
+		}
+		code(renderShortcode(p, sc))
+	}
+}
+
+func firstShortcode(src string) []int {
+	loc := shortcodeTag.FindStringSubmatchIndex(src)
+	c := shortcodeComment.FindStringIndex(src)
+	if c != nil && (loc == nil || c[0] <= loc[0]) {
+		return c
+	}
+	return loc
+}
+
+// parseShortcode parses the shortcode starting at loc and returns it together
+// with the index in src right after it (including a closing tag if present).
+func parseShortcode(src string, loc []int) (*shortcode, int) {
+	if src[loc[4]:loc[5]] == "/" {
+		return nil, loc[1]
+	}
+	sc := &shortcode{
+		Name:   src[loc[6]:loc[7]],
+		Params: make(map[string]string),
+		Raw:    src[loc[0]:loc[1]],
+	}
+	for _, m := range shortcodeParam.FindAllStringSubmatch(src[loc[8]:loc[9]], -1) {
+		if m[1] != "" {
+			sc.Params[m[1]] = unquote(m[2])
+		} else {
+			sc.Pos = append(sc.Pos, unquote(m[3]))
+		}
+	}
+	end := loc[1]
+	if src[loc[10]:loc[11]] == "/" { // self closing
+		return sc, end
+	}
+	closing := regexp.MustCompile(`\{\{[<%]\s*/\s*` + regexp.QuoteMeta(sc.Name) + `\s*[>%]\}\}`)
+	if c := closing.FindStringIndex(src[end:]); c != nil {
+		sc.Inner = src[end : end+c[0]]
+		sc.Raw = src[loc[0] : end+c[1]]
+		end += c[1]
+	}
+	return sc, end
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '`' && s[len(s)-1] == '`') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func renderShortcode(p *Page, sc *shortcode) string {
+	fn, ok := shortcodes[sc.Name]
+	if !ok {
+		return `<code class="shortcode">` + html.EscapeString(sc.Raw) + `</code>`
+	}
+	out, err := fn(p, sc)
+	if err != nil {
+		slog.Error("Unable to render shortcode", "shortcode", sc.Name, "path", p.Path, "err", err)
+		return `<code class="shortcode error">` + html.EscapeString(sc.Raw) + `</code>`
+	}
+	if *sanitizeEnabled {
+		out = sanitizePolicy.SanitizeURLs(out)
+	}
+	return out
+}
+
+func figureShortcode(p *Page, sc *shortcode) (string, error) {
+	src := sc.Get("src", 0)
+	if src == "" {
+		return "", fmt.Errorf("missing 'src' parameter")
+	}
+	e := html.EscapeString
+	var b strings.Builder
+	b.WriteString("<figure")
+	if c := sc.Get("class", -1); c != "" {
+		b.WriteString(` class="` + e(c) + `"`)
+	}
+	b.WriteString(">")
+	if l := sc.Get("link", -1); l != "" {
+		b.WriteString(`<a href="` + e(l) + `"`)
+		if t := sc.Get("target", -1); t != "" {
+			b.WriteString(` target="` + e(t) + `"`)
+		}
+		if r := sc.Get("rel", -1); r != "" {
+			b.WriteString(` rel="` + e(r) + `"`)
+		}
+		b.WriteString(">")
+	}
+	b.WriteString(`<img src="` + e(src) + `"`)
+	alt := sc.Get("alt", -1)
+	if alt == "" {
+		alt = sc.Get("caption", -1)
+	}
+	if alt != "" {
+		b.WriteString(` alt="` + e(alt) + `"`)
+	}
+	for _, a := range []string{"width", "height"} {
+		if v := sc.Get(a, -1); v != "" {
+			b.WriteString(" " + a + `="` + e(v) + `"`)
+		}
+	}
+	b.WriteString(">")
+	if sc.Get("link", -1) != "" {
+		b.WriteString("</a>")
+	}
+	title, caption, attr := sc.Get("title", -1), sc.Get("caption", -1), sc.Get("attr", -1)
+	if title != "" || caption != "" || attr != "" {
+		b.WriteString("<figcaption>")
+		if title != "" {
+			b.WriteString("<h4>" + e(title) + "</h4>")
+		}
+		if caption != "" || attr != "" {
+			b.WriteString("<p>" + e(caption))
+			if attr != "" {
+				if al := sc.Get("attrlink", -1); al != "" {
+					b.WriteString(` <a href="` + e(al) + `">` + e(attr) + "</a>")
+				} else {
+					b.WriteString(" " + e(attr))
+				}
+			}
+			b.WriteString("</p>")
+		}
+		b.WriteString("</figcaption>")
+	}
+	b.WriteString("</figure>")
+	return b.String(), nil
+}
+
+func youtubeShortcode(p *Page, sc *shortcode) (string, error) {
+	id := sc.Get("id", 0)
+	if id == "" {
+		return "", fmt.Errorf("missing video id")
+	}
+	return `<div class="embed video-player"><iframe src="https://www.youtube.com/embed/` + html.EscapeString(id) +
+		`" allowfullscreen title="YouTube Video"></iframe></div>`, nil
+}
+
+func vimeoShortcode(p *Page, sc *shortcode) (string, error) {
+	id := sc.Get("id", 0)
+	if id == "" {
+		return "", fmt.Errorf("missing video id")
+	}
+	return `<div class="embed vimeo-player"><iframe src="https://player.vimeo.com/video/` + html.EscapeString(id) +
+		`" allowfullscreen title="vimeo video"></iframe></div>`, nil
+}
+
+func gistShortcode(p *Page, sc *shortcode) (string, error) {
+	user, id := sc.Get("user", 0), sc.Get("id", 1)
+	if user == "" || id == "" {
+		return "", fmt.Errorf("missing user or gist id")
+	}
+	src := "https://gist.github.com/" + user + "/" + id + ".js"
+	if f := sc.Get("file", 2); f != "" {
+		src += "?file=" + f
+	}
+	return `<script src="` + html.EscapeString(src) + `"></script>`, nil
+}
+
+func highlightShortcode(p *Page, sc *shortcode) (string, error) {
+	lang := sc.Get("lang", 0)
+	code := strings.Trim(sc.Inner, "\r\n")
+	return `<pre><code class="language-` + html.EscapeString(lang) + `">` + html.EscapeString(code) + `</code></pre>`, nil
+}
+
+func refShortcode(p *Page, sc *shortcode) (string, error) {
+	ref := sc.Get("path", 0)
+	if ref == "" {
+		return "", fmt.Errorf("missing reference")
+	}
+	anchor := ""
+	if i := strings.Index(ref, "#"); i >= 0 {
+		ref, anchor = ref[:i], ref[i:]
+	}
+	ref = strings.TrimSuffix(strings.TrimPrefix(ref, "/"), Suffix)
+	return html.EscapeString("/view/" + ref + anchor), nil
+}
+
+func paramShortcode(p *Page, sc *shortcode) (string, error) {
+	name := sc.Get("name", 0)
+	v, ok := p.FrontMatter[name]
+	if !ok {
+		return "", fmt.Errorf("unknown page parameter '%s'", name)
+	}
+	return html.EscapeString(fmt.Sprintf("%v", v)), nil
+}
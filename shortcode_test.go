@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderShortcodes(t *testing.T) {
+	p := &Page{Path: "test", FrontMatter: map[string]interface{}{"author": "me"}}
+	for i, this := range []struct {
+		body   string
+		expect string
+	}{
+		{"no shortcodes <b>", "no shortcodes &lt;b&gt;"},
+		{`{{< figure src="/img/a.png" title="A & B" >}}`, `<figure><img src="/img/a.png"><figcaption><h4>A &amp; B</h4></figcaption></figure>`},
+		{`x {{< youtube w7Ft2ymGmfc >}} y`, `x <div class="embed video-player"><iframe src="https://www.youtube.com/embed/w7Ft2ymGmfc" allowfullscreen title="YouTube Video"></iframe></div> y`},
+		{"{{< highlight go >}}\na < b\n{{< /highlight >}}", `<pre><code class="language-go">a &lt; b</code></pre>`},
+		{`[link]({{< ref "blog/post.md#top" >}})`, `[link](/view/blog/post#top)`},
+		{`{{% param author %}}`, `me`},
+		{`{{< unknown x >}}`, `<code class="shortcode">{{&lt; unknown x &gt;}}</code>`},
+		{`{{</* figure src="x" */>}}`, `{{&lt; figure src=&#34;x&#34; &gt;}}`},
+	} {
+		result := string(renderShortcodes(p, []byte(this.body)))
+
+		if result != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+}
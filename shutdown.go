@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// On SIGINT or SIGTERM the server stops accepting connections and waits
+// for running requests and background work (publishing, purges, mails,
+// snapshots) before it exits. Requests and background work still running
+// at the timeout get their context (appCtx) canceled.
+var shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "maximum time to wait for running requests and background work on shutdown")
+
+var (
+	background sync.WaitGroup
+	stopping   = make(chan struct{}) // closed on shutdown to stop periodic work
+
+	// appCtx is the parent of all request contexts and should be used by
+	// background work; it's canceled when the shutdown times out.
+	appCtx, cancelApp = context.WithCancel(context.Background())
+)
+
+// Slow clients can't hold connections open forever. There is no write
+// timeout since event streams and exports run long.
+var readTimeout = flag.Duration("read-timeout", 10*time.Minute, "maximum time to read a request including its body (uploads, imports)")
+
+const (
+	ReadHeaderTimeout = 10 * time.Second
+	IdleTimeout       = 2 * time.Minute
+)
+
+// newServer returns a server for handler with the timeouts set.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		IdleTimeout:       IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return appCtx },
+	}
+}
+
+// goBackground runs fn in a goroutine the shutdown waits for.
+func goBackground(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// serve runs the web server with handler (and the HTTP server of
+// -http-addr when serving HTTPS) until a signal arrives.
+func serve(handler http.Handler) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := newServer(*addr, handler)
+	srv.TLSConfig = tlsConfig
+	srvs := []*http.Server{srv}
+	errc := make(chan error, 2)
+	l, err := listen(*addr, 0)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		go func() { errc <- srv.Serve(l) }()
+	} else {
+		go func() { errc <- srv.ServeTLS(l, "", "") }()
+		if *httpAddr != "" {
+			hl, err := listen(*httpAddr, 1)
+			if err != nil {
+				return err
+			}
+			hsrv := newServer(*httpAddr, httpHandler)
+			srvs = append(srvs, hsrv)
+			go func() { errc <- hsrv.Serve(hl) }()
+		}
+	}
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process
+	shutdown(srvs)
+	return nil
+}
+
+// shutdown stops srvs and waits for their running requests and the
+// background work up to the shutdown timeout.
+func shutdown(srvs []*http.Server) {
+	slog.Info("Shutting down, waiting for requests and background work", "timeout", *shutdownTimeout)
+	close(stopping)
+	sctx, scancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer scancel()
+	for _, s := range srvs {
+		if err := s.Shutdown(sctx); err != nil {
+			slog.Warn("Canceling running requests", "err", err)
+			cancelApp()
+			s.Close()
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		slog.Info("Shutdown complete")
+	case <-sctx.Done():
+		slog.Warn("Background work didn't finish in time", "timeout", *shutdownTimeout)
+	}
+	cancelApp()
+}
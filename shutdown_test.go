@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewServer(t *testing.T) {
+	srv := newServer(":8080", http.NotFoundHandler())
+	if srv.ReadHeaderTimeout != ReadHeaderTimeout || srv.ReadTimeout != *readTimeout || srv.IdleTimeout != IdleTimeout {
+		t.Errorf("got timeouts %s, %s and %s", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.IdleTimeout)
+	}
+	if srv.WriteTimeout != 0 {
+		t.Errorf("got write timeout %s, which ends event streams", srv.WriteTimeout)
+	}
+	if srv.BaseContext(nil) != appCtx {
+		t.Error("requests don't get the application context")
+	}
+}
+
+// shutdownTestSetup gives the test its own application context and
+// shutdown.
+func shutdownTestSetup(timeout time.Duration) func() {
+	ctx, cancel, s, st := appCtx, cancelApp, stopping, *shutdownTimeout
+	appCtx, cancelApp = context.WithCancel(context.Background())
+	stopping, *shutdownTimeout = make(chan struct{}), timeout
+	return func() { appCtx, cancelApp, stopping, *shutdownTimeout = ctx, cancel, s, st }
+}
+
+// startTestServer serves handler on a free port and returns its URL.
+func startTestServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	srv := newServer(l.Addr().String(), handler)
+	go srv.Serve(l)
+	return srv, "http://" + l.Addr().String()
+}
+
+func TestShutdown(t *testing.T) {
+	defer shutdownTestSetup(5 * time.Second)()
+	started, release := make(chan bool), make(chan bool)
+	srv, url := startTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		io.WriteString(w, "done")
+	}))
+	var finished atomic.Bool
+	goBackground(func() {
+		<-stopping
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	resp := make(chan string)
+	go func() {
+		res, err := http.Get(url)
+		if err != nil {
+			resp <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		resp <- string(b)
+	}()
+	<-started
+	done := make(chan bool)
+	go func() {
+		shutdown([]*http.Server{srv})
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Fatalf("the shutdown didn't wait for the running request")
+	case <-time.After(100 * time.Millisecond):
+	}
+	select {
+	case <-stopping:
+	default:
+		t.Errorf("the periodic work wasn't stopped")
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("expected new requests to be refused")
+	}
+	close(release)
+	if got := <-resp; got != "done" {
+		t.Errorf("got response %q of the running request", got)
+	}
+	<-done
+	if !finished.Load() {
+		t.Errorf("the shutdown didn't wait for the background work")
+	}
+	if appCtx.Err() == nil {
+		t.Errorf("expected the application context to be canceled at the end")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	defer shutdownTestSetup(200 * time.Millisecond)()
+	started, canceled := make(chan bool), make(chan error, 2)
+	srv, url := startTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-r.Context().Done()
+		canceled <- r.Context().Err()
+	}))
+	goBackground(func() {
+		<-appCtx.Done()
+		canceled <- appCtx.Err()
+	})
+	go http.Get(url)
+	<-started
+
+	start := time.Now()
+	shutdown([]*http.Server{srv})
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("the shutdown took %s with a timeout of %s", d, *shutdownTimeout)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-canceled:
+			if err != context.Canceled {
+				t.Errorf("[%d] got %v but expected the context to be canceled", i, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("[%d] the request or background work wasn't canceled", i)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+var siteDir = flag.String("site", "./", "root directory of the Hugo site (containing the Hugo config file)")
+
+// configFiles are tried in this order, just like Hugo does.
+var configFiles = []string{"hugo.toml", "hugo.yaml", "hugo.yml", "hugo.json", "config.toml", "config.yaml", "config.yml", "config.json"}
+
+// Language is a content language configured for the site.
+type Language struct {
+	Code       string
+	Name       string
+	Weight     int
+	ContentDir string // content directory of the language relative to the one of the wiki (if any)
+}
+
+// SiteConfig holds the parts of the Hugo site configuration gwiki cares about.
+type SiteConfig struct {
+	File            string            // the config file used (empty for defaults)
+	Title           string            // title of the site
+	BaseURL         string            // base URL of the published site
+	DefaultLanguage string            // defaultContentLanguage
+	Languages       []Language        // configured languages sorted by weight
+	Taxonomies      map[string]string // singular -> plural
+	Permalinks      map[string]string // section -> permalink pattern
+}
+
+var site = defaultSiteConfig()
+
+func defaultSiteConfig() *SiteConfig {
+	return &SiteConfig{
+		DefaultLanguage: "en",
+		Languages:       []Language{{Code: "en", Name: "English"}},
+		Taxonomies:      map[string]string{"tag": "tags", "category": "categories"},
+		Permalinks:      map[string]string{},
+	}
+}
+
+// loadSiteConfig reads the first Hugo config file found in dir.
+// Without any config file the Hugo defaults are used.
+func loadSiteConfig(dir string) (*SiteConfig, error) {
+	sc := defaultSiteConfig()
+	for _, name := range configFiles {
+		fn := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(fn)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read site config '%s': %s", fn, err)
+		}
+		var cfg interface{}
+		switch filepath.Ext(name) {
+		case ".toml":
+			cfg, err = parser.HandleTOMLMetaData(data)
+		case ".json":
+			cfg, err = parser.HandleJSONMetaData(data)
+		default:
+			cfg, err = parser.HandleYAMLMetaData(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse site config '%s': %s", fn, err)
+		}
+		sc.File = fn
+		sc.fill(lowerKeys(cfg))
+		return sc, nil
+	}
+	return sc, nil
+}
+
+func (sc *SiteConfig) fill(m map[string]interface{}) {
+	sc.Title = toString(m["title"])
+	sc.BaseURL = strings.TrimSuffix(toString(m["baseurl"]), "/")
+	if l := toString(m["defaultcontentlanguage"]); l != "" {
+		sc.DefaultLanguage = l
+	}
+	if ls, ok := m["languages"].(map[string]interface{}); ok && len(ls) > 0 {
+		sc.Languages = nil
+		for code, v := range ls {
+			l := Language{Code: code, Name: code}
+			if lm, ok := v.(map[string]interface{}); ok {
+				if n := toString(lm["languagename"]); n != "" {
+					l.Name = n
+				}
+				l.Weight = toInt(lm["weight"])
+				if cd := toString(lm["contentdir"]); cd != "" {
+					l.ContentDir = languageContentDir(cd)
+				}
+			}
+			sc.Languages = append(sc.Languages, l)
+		}
+		sort.Slice(sc.Languages, func(i, j int) bool {
+			if sc.Languages[i].Weight != sc.Languages[j].Weight {
+				return sc.Languages[i].Weight < sc.Languages[j].Weight
+			}
+			return sc.Languages[i].Code < sc.Languages[j].Code
+		})
+	} else {
+		sc.Languages = []Language{{Code: sc.DefaultLanguage, Name: sc.DefaultLanguage}}
+	}
+	if ts, ok := m["taxonomies"].(map[string]interface{}); ok {
+		sc.Taxonomies = make(map[string]string, len(ts))
+		for singular, plural := range ts {
+			sc.Taxonomies[singular] = toString(plural)
+		}
+	}
+	if ps, ok := m["permalinks"].(map[string]interface{}); ok {
+		for section, pattern := range ps {
+			if s, ok := pattern.(string); ok {
+				sc.Permalinks[section] = s
+			}
+		}
+	}
+}
+
+// TaxonomyNames returns the plural names of all taxonomies except "tags",
+// which has its own field in the editor.
+func (sc *SiteConfig) TaxonomyNames() []string {
+	var ns []string
+	for _, plural := range sc.Taxonomies {
+		if plural != "tags" && plural != "" {
+			ns = append(ns, plural)
+		}
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// LanguagesFor returns the configured languages plus lang if it isn't
+// configured, so editing a page never silently drops its language.
+func (sc *SiteConfig) LanguagesFor(lang string) []Language {
+	if lang == "" {
+		return sc.Languages
+	}
+	for _, l := range sc.Languages {
+		if l.Code == lang {
+			return sc.Languages
+		}
+	}
+	return append(sc.Languages[:len(sc.Languages):len(sc.Languages)], Language{Code: lang, Name: lang})
+}
+
+var permalinkToken = regexp.MustCompile(`:[a-z]+`)
+var nonURLChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// permalink returns the absolute URL of the page on the published site.
+func (sc *SiteConfig) permalink(p *Page) string {
+	return sc.BaseURL + sc.relPermalink(p)
+}
+
+// relPermalink expands the permalink pattern configured for the section of
+// the page or returns the default Hugo URL path.
+func (sc *SiteConfig) relPermalink(p *Page) string {
+	section, filename := "", p.Path
+	if i := strings.LastIndex(p.Path, "/"); i >= 0 {
+		filename = p.Path[i+1:]
+		section = strings.SplitN(p.Path, "/", 2)[0]
+	}
+	pattern, ok := sc.Permalinks[section]
+	if !ok {
+		return "/" + strings.ToLower(p.Path) + "/"
+	}
+	d, err := time.Parse(DateFormat, p.Date())
+	if err != nil {
+		d = time.Now()
+	}
+	url := permalinkToken.ReplaceAllStringFunc(pattern, func(tok string) string {
+		switch tok {
+		case ":year":
+			return d.Format("2006")
+		case ":month":
+			return d.Format("01")
+		case ":day":
+			return d.Format("02")
+		case ":yearday":
+			return fmt.Sprintf("%d", d.YearDay())
+		case ":title":
+			return urlize(p.Title())
+		case ":slug":
+			if s := getString(p, "slug"); s != "" {
+				return urlize(s)
+			}
+			return urlize(p.Title())
+		case ":filename", ":contentbasename":
+			return filename
+		case ":section":
+			return section
+		case ":sections":
+			return strings.TrimSuffix(p.Path, "/"+filename)
+		default:
+			return tok
+		}
+	})
+	return url
+}
+
+// languageContentDir returns the content dir of a language relative to
+// the content directory or an empty string if it isn't inside it.
+func languageContentDir(dir string) string {
+	abs, err := filepath.Abs(filepath.Join(*siteDir, dir))
+	if err != nil {
+		return ""
+	}
+	content, err := filepath.Abs(*contentDir)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(content, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		slog.Warn("Content dir isn't inside the content directory", "dir", dir, "content", *contentDir)
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func urlize(s string) string {
+	return strings.Trim(nonURLChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// lowerKeys normalizes a parsed config: keys become lower case (Hugo config
+// keys are case insensitive) and YAML maps become map[string]interface{}.
+func lowerKeys(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	switch vm := v.(type) {
+	case map[string]interface{}:
+		for k, e := range vm {
+			m[strings.ToLower(k)] = normalizeValue(e)
+		}
+	case map[interface{}]interface{}:
+		for k, e := range vm {
+			m[strings.ToLower(fmt.Sprintf("%v", k))] = normalizeValue(e)
+		}
+	}
+	return m
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch v.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return lowerKeys(v)
+	}
+	return v
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func toInt(v interface{}) int {
+	switch i := v.(type) {
+	case int:
+		return i
+	case int64:
+		return int(i)
+	case float64:
+		return int(i)
+	}
+	return 0
+}
+
+func initSite() {
+	sc, err := loadSiteConfig(*siteDir)
+	if err != nil {
+		slog.Error("Unable to read the site config, using defaults", "err", err)
+		return
+	}
+	if sc.File != "" {
+		slog.Info("Using Hugo site config", "file", sc.File)
+	}
+	site = sc
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPermalink(t *testing.T) {
+	sc := defaultSiteConfig()
+	sc.BaseURL = "https://example.org"
+	sc.Permalinks["blog"] = "/:year/:month/:slug/"
+	date := time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC)
+	for i, this := range []struct {
+		path   string
+		fm     map[string]interface{}
+		expect string
+	}{
+		{"About", map[string]interface{}{}, "https://example.org/about/"},
+		{"blog/good-to-great", map[string]interface{}{"title": "Good To Great", "date": date}, "https://example.org/2018/01/good-to-great/"},
+		{"blog/x", map[string]interface{}{"title": "X", "slug": "my slug", "date": date}, "https://example.org/2018/01/my-slug/"},
+	} {
+		p := &Page{Path: this.path, FrontMatter: this.fm}
+		result := sc.permalink(p)
+
+		if result != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, result, this.expect)
+		}
+	}
+}
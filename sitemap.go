@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The sitemap (https://www.sitemaps.org/protocol.html) lists all published
+// pages so search engines can index a public wiki.
+var publicURL = flag.String("public-url", "", "public base URL of the wiki used in the sitemap (default: the URL of the request) and in exported documents (default: links without host)")
+
+const (
+	SitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	SitemapMaxURLs   = 50000 // limit of the sitemap protocol
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	NS      string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapURLs returns the sitemap entries of the pages infos below base.
+func sitemapURLs(base string, infos []*PageInfo, modTime func(string) time.Time) []sitemapURL {
+	urls := make([]sitemapURL, 0, len(infos))
+	for _, info := range infos {
+		if len(urls) == SitemapMaxURLs {
+			break
+		}
+		u := sitemapURL{Loc: base + "/view/" + info.Path}
+		if t := modTime(info.Path); !t.IsZero() {
+			u.LastMod = t.UTC().Format("2006-01-02")
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// sitemapHandler serves the sitemap of all non-draft pages the client may
+// view.
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	base := strings.TrimSuffix(*publicURL, "/")
+	if base == "" {
+		base = baseURL(r)
+	}
+	var infos []*PageInfo
+	for _, info := range index.Pages(false) {
+		if mayView(r, info.Path) {
+			infos = append(infos, info)
+		}
+	}
+	s := &sitemapURLSet{NS: SitemapNamespace, URLs: sitemapURLs(base, infos, pageModTime)}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(s); err != nil {
+		logger(r.Context()).Error("Unable to write the sitemap", "err", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSitemapURLs(t *testing.T) {
+	mod := map[string]time.Time{"docs/intro": time.Date(2024, 3, 4, 23, 30, 0, 0, time.FixedZone("X", -2*3600))}
+	modTime := func(path string) time.Time { return mod[path] }
+	for i, this := range []struct {
+		infos  []*PageInfo
+		expect []sitemapURL
+	}{
+		{nil, []sitemapURL{}},
+		{[]*PageInfo{{Path: "docs/intro"}, {Path: "about"}}, []sitemapURL{
+			{Loc: "https://wiki.example.com/view/docs/intro", LastMod: "2024-03-05"},
+			{Loc: "https://wiki.example.com/view/about"},
+		}},
+	} {
+		if got := sitemapURLs("https://wiki.example.com", this.infos, modTime); !reflect.DeepEqual(got, this.expect) {
+			t.Errorf("[%d] got %+v but expected %+v", i, got, this.expect)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// A snapshot of all pages is taken periodically at a fixed time of day
+// (and every interval from it if the interval is shorter than a day). The
+// differences to the previous snapshot are stored as report and optionally
+// posted to a webhook and mailed.
+var (
+	snapshotDir      = flag.String("snapshot-dir", "./snapshots/", "directory for the content snapshot and the change reports")
+	snapshotInterval = flag.Duration("snapshot-interval", 24*time.Hour, "interval between content snapshots (0 disables them), whole days if longer than a day")
+	snapshotTime     = flag.String("snapshot-time", "03:00", "local time of day (HH:MM) content snapshots are taken at")
+	snapshotWebhook  = flag.String("snapshot-webhook", "", "URL the change report is posted to as JSON")
+	snapshotMailTo   = flag.String("snapshot-mail-to", "", "comma separated addresses the change report is mailed to")
+)
+
+const (
+	SnapshotFile     = "content.json"
+	SnapshotIDFormat = "20060102-150405"
+)
+
+var validSnapshotID = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}$`)
+
+// PageChange is a changed page in a snapshot report.
+type PageChange struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind"` // "added", "removed" or "changed"
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// SnapshotReport lists all changes between two snapshots.
+type SnapshotReport struct {
+	ID      string       `json:"id"`
+	Since   time.Time    `json:"since"`
+	Until   time.Time    `json:"until"`
+	Changes []PageChange `json:"changes"`
+}
+
+type snapshot struct {
+	Time  time.Time         `json:"time"`
+	Pages map[string]string `json:"pages"` // path -> file content
+}
+
+func takeSnapshot() (*snapshot, error) {
+	ps, err := listPages()
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{Time: time.Now().UTC(), Pages: make(map[string]string, len(ps))}
+	for _, path := range ps {
+		b, err := store.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		s.Pages[path] = string(b)
+	}
+	return s, nil
+}
+
+func loadSnapshot() (*snapshot, error) {
+	b, err := ioutil.ReadFile(filepath.Join(*snapshotDir, SnapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{}
+	return s, json.Unmarshal(b, s)
+}
+
+// snapshotPage returns the page at path as of the last snapshot.
+func snapshotPage(path string) (*Page, error) {
+	s, err := loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	content, ok := s.Pages[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	pg, err := parser.ReadFrom(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	md, err := pg.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing front matter of snapshot of '%s': %s", path, err)
+	}
+	m, ok := md.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no front matter in snapshot of '%s'", path)
+	}
+	return &Page{Path: path, Mark: mark(pg.FrontMatter()), Body: pg.Content(), FrontMatter: m}, nil
+}
+
+func writeJSONFile(fn string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(fn, bytes.NewReader(b))
+}
+
+// compareSnapshots returns the changes from old to new sorted by path.
+func compareSnapshots(old, new *snapshot) *SnapshotReport {
+	rep := &SnapshotReport{ID: new.Time.Format(SnapshotIDFormat), Since: old.Time, Until: new.Time, Changes: []PageChange{}}
+	for path, content := range new.Pages {
+		oc, ok := old.Pages[path]
+		switch {
+		case !ok:
+			rep.Changes = append(rep.Changes, PageChange{Path: path, Kind: "added", Added: strings.Count(content, "\n")})
+		case oc != content:
+			c := PageChange{Path: path, Kind: "changed"}
+			for _, d := range diffLines(oc, content) {
+				switch d.Kind {
+				case "+":
+					c.Added++
+				case "-":
+					c.Removed++
+				}
+			}
+			rep.Changes = append(rep.Changes, c)
+		}
+	}
+	for path, content := range old.Pages {
+		if _, ok := new.Pages[path]; !ok {
+			rep.Changes = append(rep.Changes, PageChange{Path: path, Kind: "removed", Removed: strings.Count(content, "\n")})
+		}
+	}
+	sort.Slice(rep.Changes, func(i, j int) bool { return rep.Changes[i].Path < rep.Changes[j].Path })
+	return rep
+}
+
+// snapshotContent takes a new snapshot and reports the changes since the
+// previous one. The first snapshot has no report.
+func snapshotContent() (*SnapshotReport, error) {
+	if err := os.MkdirAll(*snapshotDir, 0755); err != nil {
+		return nil, err
+	}
+	cur, err := takeSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	var rep *SnapshotReport
+	old, err := loadSnapshot()
+	if err == nil {
+		rep = compareSnapshots(old, cur)
+		if err = writeJSONFile(filepath.Join(*snapshotDir, rep.ID+".json"), rep); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return rep, writeJSONFile(filepath.Join(*snapshotDir, SnapshotFile), cur)
+}
+
+func sendSnapshotReport(rep *SnapshotReport) {
+	if *snapshotWebhook != "" {
+		b, _ := json.Marshal(rep)
+		client := http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Post(*snapshotWebhook, "application/json", bytes.NewReader(b))
+		if err != nil {
+			slog.Error("Unable to post change report", "url", *snapshotWebhook, "err", err)
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				slog.Error("Unable to post change report", "url", *snapshotWebhook, "status", resp.Status)
+			}
+		}
+	}
+	if *snapshotMailTo != "" {
+		to := strings.Split(*snapshotMailTo, ",")
+		m, err := renderMail("snapshot", "changes "+rep.ID, "", rep)
+		if err == nil {
+			err = sendMail(to, m)
+		}
+		if err != nil {
+			slog.Error("Unable to mail change report", "to", *snapshotMailTo, "err", err)
+		}
+	}
+}
+
+func runSnapshot() {
+	rep, err := snapshotContent()
+	if err != nil {
+		slog.Error("Unable to snapshot content", "err", err)
+		return
+	}
+	if rep != nil {
+		slog.Info("Snapshot report", "id", rep.ID, "changes", len(rep.Changes))
+		sendSnapshotReport(rep)
+	}
+}
+
+// listSnapshotReports returns the IDs of all reports, newest first.
+func listSnapshotReports() ([]string, error) {
+	fns, err := filepath.Glob(filepath.Join(*snapshotDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, fn := range fns {
+		if id := strings.TrimSuffix(filepath.Base(fn), ".json"); validSnapshotID.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+type snapshotsData struct {
+	IDs    []string
+	Report *SnapshotReport
+	Err    string
+}
+
+// snapshotsHandler shows a report (/report/snapshots?id=, default the
+// newest) and links to all others. format=json returns the report.
+func snapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	data := snapshotsData{}
+	var err error
+	if data.IDs, err = listSnapshotReports(); err != nil {
+		data.Err = err.Error()
+	}
+	id := r.FormValue("id")
+	if id == "" && len(data.IDs) > 0 {
+		id = data.IDs[0]
+	}
+	if validSnapshotID.MatchString(id) {
+		b, err := ioutil.ReadFile(filepath.Join(*snapshotDir, id+".json"))
+		if err == nil {
+			data.Report = &SnapshotReport{}
+			err = json.Unmarshal(b, data.Report)
+		}
+		if err != nil {
+			logger(r.Context()).Error("Unable to read snapshot report", "id", id, "err", err)
+			data.Err = err.Error()
+		} else {
+			var visible []PageChange
+			for _, c := range data.Report.Changes {
+				if mayView(r, c.Path) {
+					visible = append(visible, c)
+				}
+			}
+			data.Report.Changes = visible
+		}
+	}
+	if r.FormValue("format") == "json" {
+		writeJSON(w, data.Report)
+		return
+	}
+	renderTemplate(w, "snapshots", data)
+}
+
+// nextSnapshot returns the first time after now a snapshot is due: at the
+// time of day of at and every interval from it until the next day.
+// Intervals of a day or longer are rounded down to whole days.
+func nextSnapshot(now, at time.Time, interval time.Duration) time.Time {
+	day := func(t time.Time, days int) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day()+days, at.Hour(), at.Minute(), 0, 0, now.Location())
+	}
+	last := day(now, 0)
+	if last.After(now) {
+		last = day(now, -1)
+	}
+	if interval >= 24*time.Hour {
+		return day(last, int(interval/(24*time.Hour)))
+	}
+	next := last.Add((now.Sub(last)/interval + 1) * interval)
+	if tomorrow := day(last, 1); next.After(tomorrow) {
+		return tomorrow
+	}
+	return next
+}
+
+func initSnapshots() {
+	if *snapshotInterval <= 0 {
+		return
+	}
+	at, err := time.Parse("15:04", *snapshotTime)
+	if err != nil {
+		fatal("Invalid snapshot time", "time", *snapshotTime, "err", err)
+	}
+	if _, err := loadSnapshot(); os.IsNotExist(err) {
+		runSnapshot()
+	}
+	goBackground(func() {
+		for {
+			t := time.NewTimer(time.Until(nextSnapshot(time.Now(), at, *snapshotInterval)))
+			select {
+			case <-stopping:
+				t.Stop()
+				return
+			case <-t.C:
+				runSnapshot()
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareSnapshots(t *testing.T) {
+	old := &snapshot{Time: time.Unix(0, 0), Pages: map[string]string{
+		"a": "one\ntwo\nthree\n",
+		"b": "same\n",
+		"c": "gone\nfor good\n",
+	}}
+	new := &snapshot{Time: time.Unix(86400, 0).UTC(), Pages: map[string]string{
+		"a": "one\n2\nthree\nfour\n",
+		"b": "same\n",
+		"d": "new\n",
+	}}
+	rep := compareSnapshots(old, new)
+	expect := []PageChange{
+		{Path: "a", Kind: "changed", Added: 2, Removed: 1},
+		{Path: "c", Kind: "removed", Removed: 2},
+		{Path: "d", Kind: "added", Added: 1},
+	}
+	if !reflect.DeepEqual(rep.Changes, expect) {
+		t.Errorf("got %+v but expected %+v", rep.Changes, expect)
+	}
+	if rep.ID != "19700102-000000" {
+		t.Errorf("got ID %q but expected %q", rep.ID, "19700102-000000")
+	}
+}
+
+func TestSnapshotPage(t *testing.T) {
+	defer func(dir string) { *snapshotDir = dir }(*snapshotDir)
+	*snapshotDir = t.TempDir()
+	s := &snapshot{Time: time.Unix(0, 0), Pages: map[string]string{
+		"docs/intro": "+++\ntitle = \"Intro\"\n+++\nHello\n",
+		"docs/bad":   "no front matter\n",
+	}}
+	if err := writeJSONFile(filepath.Join(*snapshotDir, SnapshotFile), s); err != nil {
+		t.Fatal(err)
+	}
+	p, err := snapshotPage("docs/intro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.FrontMatter["title"] != "Intro" || string(p.Body) != "Hello\n" {
+		t.Errorf("got %v %q", p.FrontMatter, p.Body)
+	}
+	for i, path := range []string{"docs/missing", "docs/bad"} {
+		if _, err := snapshotPage(path); err == nil {
+			t.Errorf("[%d] expected an error for %s", i, path)
+		}
+	}
+}
+
+func TestNextSnapshot(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %s", err)
+	}
+	at, _ := time.Parse("15:04", "03:00")
+	date := func(d, h, m int) time.Time { return time.Date(2024, time.March, d, h, m, 0, 0, berlin) }
+	for i, this := range []struct {
+		now      time.Time
+		interval time.Duration
+		expect   time.Time
+	}{
+		{date(10, 1, 0), 24 * time.Hour, date(10, 3, 0)},
+		{date(10, 3, 0), 24 * time.Hour, date(11, 3, 0)},
+		{date(10, 17, 45), 24 * time.Hour, date(11, 3, 0)},
+		{date(10, 17, 45), 48 * time.Hour, date(12, 3, 0)},
+		{date(10, 17, 45), 6 * time.Hour, date(10, 21, 0)},
+		{date(10, 1, 0), 6 * time.Hour, date(10, 3, 0)},
+		{date(10, 23, 0), 7 * time.Hour, date(11, 0, 0)},
+		{date(11, 0, 0), 7 * time.Hour, date(11, 3, 0)},
+		// daylight saving time starts on March 31
+		{date(30, 4, 0), 24 * time.Hour, date(31, 3, 0)},
+		{date(31, 4, 0), 24 * time.Hour, date(1+31, 3, 0)},
+	} {
+		if got := nextSnapshot(this.now, at, this.interval); !got.Equal(this.expect) {
+			t.Errorf("[%d] got %s but expected %s", i, got, this.expect)
+		}
+	}
+}
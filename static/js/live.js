@@ -0,0 +1,18 @@
+// Reloads the page shown in #tree (data-path) when it's changed elsewhere
+// and follows renames, using the server-sent events of /events.
+(function() {
+	var nav = document.getElementById("tree");
+	if (!nav || !window.EventSource) {
+		return;
+	}
+	var current = nav.getAttribute("data-path");
+	var events = new EventSource("/events?path=" + encodeURIComponent(current));
+	events.addEventListener("change", function(ev) {
+		var e = JSON.parse(ev.data);
+		if (e.kind === "rename" && e.from === current) {
+			window.location.href = "/view/" + e.path;
+		} else if (e.path === current) {
+			window.location.reload();
+		}
+	});
+})();
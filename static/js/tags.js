@@ -0,0 +1,28 @@
+// Offers the tags already used in the wiki while typing the last tag.
+(function() {
+	var input = document.getElementById("tags");
+	var list = document.getElementById("tag-suggestions");
+	if (!input || !list) {
+		return;
+	}
+	input.addEventListener("input", function() {
+		var words = input.value.split(/\s+/);
+		var last = words.pop();
+		var prefix = words.length > 0 ? words.join(" ") + " " : "";
+		if (last === "") {
+			list.innerHTML = "";
+			return;
+		}
+		fetch("/api/v1/tags?q=" + encodeURIComponent(last))
+			.then(function(resp) { return resp.json(); })
+			.then(function(tags) {
+				list.innerHTML = "";
+				tags.forEach(function(t) {
+					var opt = document.createElement("option");
+					opt.value = prefix + t.tag + " ";
+					opt.label = t.tag + " (" + t.count + ")";
+					list.appendChild(opt);
+				});
+			});
+	});
+})();
@@ -0,0 +1,52 @@
+// Renders the content tree as collapsible navigation into #tree.
+// The section of the current page (data-path) is opened.
+(function() {
+	var nav = document.getElementById("tree");
+	if (!nav) {
+		return;
+	}
+	var current = nav.getAttribute("data-path") || "";
+
+	function link(href, text, draft) {
+		var a = document.createElement("a");
+		a.href = href;
+		a.textContent = text;
+		if (draft) {
+			a.className = "draft";
+		}
+		return a;
+	}
+
+	function render(node) {
+		var ul = document.createElement("ul");
+		node.children.forEach(function(c) {
+			var li = document.createElement("li");
+			if (c.section) {
+				var d = document.createElement("details");
+				var s = document.createElement("summary");
+				s.appendChild(link("/list/" + c.path, c.title || c.name, c.draft));
+				d.appendChild(s);
+				d.open = current.indexOf(c.path + "/") === 0;
+				if (c.children) {
+					d.appendChild(render(c));
+				}
+				li.appendChild(d);
+			} else {
+				li.appendChild(link("/view/" + c.path, c.title || c.name, c.draft));
+				if (c.path === current) {
+					li.className = "current";
+				}
+			}
+			ul.appendChild(li);
+		});
+		return ul;
+	}
+
+	fetch("/api/v1/tree?drafts=true")
+		.then(function(resp) { return resp.json(); })
+		.then(function(root) {
+			if (root.children) {
+				nav.appendChild(render(root));
+			}
+		});
+})();
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var storageName = flag.String("storage", "fs", "storage backend for pages: 'fs' (the content directory) or 'memory' (starts with a copy of it, nothing is persisted)")
+
+// Storage stores the raw content (front matter and body) of pages by path.
+// Load of a missing page returns an error for which os.IsNotExist is true.
+// Exists checks for a page without loading it.
+type Storage interface {
+	Load(path string) ([]byte, error)
+	Exists(path string) (bool, error)
+	Save(path string, data []byte) error
+	List() ([]string, error) // sorted
+	Delete(path string) error
+	Rename(from, to string) error
+}
+
+// modTimer is implemented by storages that know when a page was changed.
+type modTimer interface {
+	ModTime(path string) (time.Time, error)
+}
+
+// pinger is implemented by storages that can cheaply check they are
+// usable; the others are checked by listing all pages.
+type pinger interface {
+	Ping() error
+}
+
+var storages = map[string]func() (Storage, error){
+	"fs": func() (Storage, error) { return &fsStorage{fsys: content}, nil },
+	"memory": func() (Storage, error) {
+		s := newMemoryStorage()
+		return s, copyStorage(s, &fsStorage{fsys: content})
+	},
+}
+
+// RegisterStorage makes a storage backend available for the -storage flag.
+func RegisterStorage(name string, f func() (Storage, error)) {
+	storages[name] = f
+}
+
+var store Storage = &fsStorage{fsys: content}
+
+func initStorage() {
+	if err := os.MkdirAll(*contentDir, 0755); err != nil {
+		fatal("Unable to create the content directory", "dir", *contentDir, "err", err)
+	}
+	content = newDirFS(*contentDir, false)
+	f, ok := storages[*storageName]
+	if !ok {
+		fatal("Unknown storage", "storage", *storageName)
+	}
+	s, err := f()
+	if err != nil {
+		fatal("Unable to initialize storage", "storage", *storageName, "err", err)
+	}
+	store = s
+}
+
+// pageExists reports whether there is a page at path.
+func pageExists(path string) bool {
+	ok, err := store.Exists(path)
+	if err != nil {
+		slog.Warn("Unable to check page", "path", path, "err", err)
+	}
+	return ok
+}
+
+// pageModTime returns the time of the last change of the page at path or
+// the zero time if the storage doesn't know it.
+func pageModTime(path string) time.Time {
+	if mt, ok := store.(modTimer); ok {
+		if t, err := mt.ModTime(path); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func copyStorage(dst, src Storage) error {
+	ps, err := src.List()
+	if err != nil {
+		return err
+	}
+	for _, path := range ps {
+		b, err := src.Load(path)
+		if err != nil {
+			return err
+		}
+		if err = dst.Save(path, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsStorage keeps every page in a file <path><Suffix> of a ContentFS.
+type fsStorage struct {
+	fsys ContentFS
+}
+
+// name returns the file name of the page at path; it must not leave the
+// root of the file system.
+func (s *fsStorage) name(p string) (string, error) {
+	name := path.Clean(p + Suffix)
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("page path '%s' is outside of the content directory", p)
+	}
+	return name, nil
+}
+
+func (s *fsStorage) Load(path string) ([]byte, error) {
+	name, err := s.name(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.fsys.ReadFile(name)
+}
+
+func (s *fsStorage) Exists(path string) (bool, error) {
+	name, err := s.name(path)
+	if err != nil {
+		return false, err
+	}
+	fi, err := s.fsys.Stat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !fi.IsDir(), nil
+}
+
+func (s *fsStorage) Open(path string) (io.ReadCloser, error) {
+	name, err := s.name(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.fsys.Open(name)
+}
+
+// Save creates missing parent directories of the page, e.g. for a new
+// page blog/2025/post.
+func (s *fsStorage) Save(path string, data []byte) error {
+	name, err := s.name(path)
+	if err != nil {
+		return err
+	}
+	return s.fsys.WriteFile(name, data)
+}
+
+// Ping checks the content directory is readable.
+func (s *fsStorage) Ping() error {
+	_, err := s.fsys.ReadDir(".")
+	return err
+}
+
+func (s *fsStorage) List() ([]string, error) {
+	var ps []string
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(name, Suffix) {
+			return nil
+		}
+		ps = append(ps, strings.TrimSuffix(name, Suffix))
+		return nil
+	})
+	sort.Strings(ps)
+	return ps, err
+}
+
+func (s *fsStorage) Delete(path string) error {
+	name, err := s.name(path)
+	if err != nil {
+		return err
+	}
+	return s.fsys.Remove(name)
+}
+
+func (s *fsStorage) Rename(from, to string) error {
+	fromName, err := s.name(from)
+	if err != nil {
+		return err
+	}
+	toName, err := s.name(to)
+	if err != nil {
+		return err
+	}
+	return s.fsys.Rename(fromName, toName)
+}
+
+func (s *fsStorage) ModTime(path string) (time.Time, error) {
+	name, err := s.name(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err := s.fsys.Stat(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// memoryStorage keeps all pages in memory.
+type memoryStorage struct {
+	mutex sync.RWMutex
+	pages map[string]memoryPage
+}
+
+type memoryPage struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{pages: make(map[string]memoryPage)}
+}
+
+func notExist(op, path string) error {
+	return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+}
+
+func (s *memoryStorage) Load(path string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	mp, ok := s.pages[path]
+	if !ok {
+		return nil, notExist("load", path)
+	}
+	return append([]byte(nil), mp.data...), nil
+}
+
+func (s *memoryStorage) Exists(path string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.pages[path]
+	return ok, nil
+}
+
+func (s *memoryStorage) Save(path string, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pages[path] = memoryPage{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (s *memoryStorage) List() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	ps := make([]string, 0, len(s.pages))
+	for path := range s.pages {
+		ps = append(ps, path)
+	}
+	sort.Strings(ps)
+	return ps, nil
+}
+
+func (s *memoryStorage) Delete(path string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.pages[path]; !ok {
+		return notExist("delete", path)
+	}
+	delete(s.pages, path)
+	return nil
+}
+
+func (s *memoryStorage) Rename(from, to string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	mp, ok := s.pages[from]
+	if !ok {
+		return notExist("rename", from)
+	}
+	if _, ok := s.pages[to]; ok {
+		return fmt.Errorf("rename %s %s: page exists already", from, to)
+	}
+	delete(s.pages, from)
+	s.pages[to] = mp
+	return nil
+}
+
+func (s *memoryStorage) ModTime(path string) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	mp, ok := s.pages[path]
+	if !ok {
+		return time.Time{}, notExist("stat", path)
+	}
+	return mp.modTime, nil
+}
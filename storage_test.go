@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	s := newMemoryStorage()
+	for _, path := range []string{"b", "a/x", "a/y"} {
+		if err := s.Save(path, []byte("content of "+path)); err != nil {
+			t.Fatalf("unable to save '%s': %s", path, err)
+		}
+	}
+	if err := s.Rename("a/y", "c"); err != nil {
+		t.Errorf("unexpected rename error: %s", err)
+	}
+	if err := s.Rename("a/x", "b"); err == nil {
+		t.Errorf("expected an error renaming to an existing page")
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Errorf("unexpected delete error: %s", err)
+	}
+
+	ps, _ := s.List()
+	if expect := []string{"a/x", "c"}; !reflect.DeepEqual(ps, expect) {
+		t.Errorf("got %q but expected %q", ps, expect)
+	}
+	for i, this := range []struct {
+		path   string
+		expect string
+		exists bool
+	}{
+		{"a/x", "content of a/x", true},
+		{"c", "content of a/y", true},
+		{"a/y", "", false},
+		{"b", "", false},
+	} {
+		b, err := s.Load(this.path)
+		if this.exists != (err == nil) || (err != nil && !os.IsNotExist(err)) {
+			t.Errorf("[%d] got error %v but expected exists=%t", i, err, this.exists)
+		}
+		if string(b) != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, b, this.expect)
+		}
+		if ok, err := s.Exists(this.path); ok != this.exists || err != nil {
+			t.Errorf("[%d] got exists=%t (%v) but expected %t", i, ok, err, this.exists)
+		}
+	}
+}
+
+func TestDirFSWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "page.md")
+	if err := ioutil.WriteFile(fn, []byte("old content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := newDirFS(dir, false).WriteFile("page.md", []byte("new")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, _ := ioutil.ReadFile(fn)
+	if string(b) != "new" {
+		t.Errorf("got %q but expected %q", b, "new")
+	}
+	if fi, _ := os.Stat(fn); fi.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v but expected the original mode", fi.Mode().Perm())
+	}
+	if fis, _ := ioutil.ReadDir(dir); len(fis) != 1 {
+		t.Errorf("got %d files but expected no temporary files left", len(fis))
+	}
+}
+
+func TestFsStorageSave(t *testing.T) {
+	dir := t.TempDir() + "/"
+	s := &fsStorage{fsys: newDirFS(dir, false)}
+	for i, this := range []struct {
+		path string
+		ok   bool
+	}{
+		{"blog/2025/new-post", true},
+		{"top", true},
+		{"../escape", false},
+		{"blog/../../escape", false},
+		{"blog/../inside", true},
+	} {
+		err := s.Save(this.path, []byte("content"))
+		if (err == nil) != this.ok {
+			t.Errorf("[%d] got error %v but expected ok=%t", i, err, this.ok)
+		}
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "blog", "2025", "new-post.md")); err != nil || string(b) != "content" {
+		t.Errorf("got %q (%v) but expected the page in new directories", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(filepath.Clean(dir)), "escape.md")); err == nil {
+		t.Errorf("expected no page outside of the content directory")
+	}
+	for i, this := range []struct {
+		path   string
+		exists bool
+		ok     bool
+	}{
+		{"blog/2025/new-post", true, true},
+		{"missing", false, true},
+		{"../escape", false, false},
+	} {
+		exists, err := s.Exists(this.path)
+		if exists != this.exists || (err == nil) != this.ok {
+			t.Errorf("[%d] got exists=%t (%v) but expected %t", i, exists, err, this.exists)
+		}
+	}
+}
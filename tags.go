@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type tagsData struct {
+	Tag     string
+	Drafts  bool
+	Touched []string
+	Err     string
+	Tags    []TagCount
+	Pages   []*PageInfo
+	Pagination
+}
+
+const (
+	TagsDefaultLimit = 200
+	TagsMaxLimit     = 1000
+)
+
+// tagsHandler lists all tags (/tags/) or all pages with a tag (/tags/{tag}),
+// TagsDefaultLimit at a time (?offset=&limit=). Drafts are only included
+// with the query parameter drafts=true.
+func tagsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := url.PathUnescape(strings.Trim(strings.TrimPrefix(r.URL.Path, "/tags/"), "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	data := tagsData{Tag: tag, Drafts: r.FormValue("drafts") == "true"}
+	if r.Method == http.MethodPost && tag != "" {
+		data.Touched, err = doRenameTag(r, tag)
+		if err != nil {
+			data.Err = err.Error()
+		}
+	}
+	if tag == "" {
+		tcs := tagCounts(visibleInfos(r, index.Pages(data.Drafts)))
+		data.Pagination = paginate(r, len(tcs), TagsDefaultLimit, TagsMaxLimit)
+		start, end := data.Bounds()
+		data.Tags = tcs[start:end]
+	} else {
+		infos := visibleInfos(r, index.Tagged(tag, data.Drafts))
+		data.Pagination = paginate(r, len(infos), TagsDefaultLimit, TagsMaxLimit)
+		start, end := data.Bounds()
+		data.Pages = infos[start:end]
+	}
+	renderTemplate(w, "tags", data)
+}
+
+const TagSuggestLimit = 20
+
+// tagKey normalizes a tag for matching so near duplicates like "golang",
+// "GoLang" and "go-lang" all match the same query.
+func tagKey(t string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, t)
+}
+
+// tagSuggestHandler returns all tags already used (drafts included) that
+// start with the query parameter q, most used first.
+func tagSuggestHandler(w http.ResponseWriter, r *http.Request) {
+	q := tagKey(r.FormValue("q"))
+	limit := intParam(r, "limit", TagSuggestLimit)
+	tcs := []TagCount{}
+	for _, tc := range tagCounts(visibleInfos(r, index.Pages(true))) {
+		if strings.HasPrefix(tagKey(tc.Tag), q) {
+			tcs = append(tcs, tc)
+		}
+	}
+	sort.SliceStable(tcs, func(i, j int) bool { return tcs[i].Count > tcs[j].Count })
+	if len(tcs) > limit {
+		tcs = tcs[:limit]
+	}
+	writeJSON(w, tcs)
+}
+
+// renameTag renames the tag from to to in all pages using it. If a page
+// has both tags already they are merged. It returns the touched pages;
+// changes of owned pages may wait for an approval instead.
+func renameTag(r *http.Request, from, to string) ([]string, error) {
+	if from == "" || len(strings.Fields(to)) != 1 {
+		return nil, fmt.Errorf("invalid tags '%s' and '%s'", from, to)
+	}
+	var touched []string
+	for _, info := range index.Tagged(from, true) {
+		p, err := LoadPage(info.Path)
+		if err != nil {
+			return touched, err
+		}
+		old := p.Copy()
+		var ts []string
+		for _, t := range p.Tags() {
+			if t == from {
+				t = to
+			}
+			if !contains(ts, t) {
+				ts = append(ts, t)
+			}
+		}
+		setStrings(p, "tags", ts)
+		if err = storePage(r, p, old, "rename tag "+from+" to "+to); errors.Is(err, errReview) {
+			continue
+		} else if err != nil {
+			return touched, err
+		}
+		touched = append(touched, p.Path)
+	}
+	return touched, nil
+}
+
+func doRenameTag(r *http.Request, from string) ([]string, error) {
+	to := strings.TrimSpace(r.FormValue("to"))
+	touched, err := renameTag(r, from, to)
+	if err != nil {
+		logger(r.Context()).Error("Unable to rename tag", "from", from, "to", to, "err", err)
+	}
+	return touched, err
+}
+
+// tagRenameHandler renames or merges a tag: POST from=old&to=new.
+func tagRenameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	touched, err := doRenameTag(r, r.FormValue("from"))
+	res := map[string]interface{}{"touched": touched}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res["error"] = err.Error()
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tagsTestSetup stores tagged pages; secret/ is only visible to alice.
+func tagsTestSetup(t *testing.T) {
+	testSetup(t)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl"), []byte("secret/** view=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a := *aclFile
+	t.Cleanup(func() { *aclFile, acls = a, &aclTable{} })
+	*aclFile = filepath.Join(dir, "acl")
+	acls = &aclTable{}
+	r := httptest.NewRequest("POST", "/save/", nil)
+	for _, this := range []struct {
+		path  string
+		tags  []string
+		draft bool
+	}{
+		{"a", []string{"go", "hugo"}, false},
+		{"b", []string{"golang", "go"}, false},
+		{"c", []string{"golang", "wip"}, true},
+		{"d", nil, false},
+		{"secret/x", []string{"golang", "secret"}, false},
+	} {
+		p := NewPage(this.path)
+		if this.tags != nil {
+			setStrings(p, "tags", this.tags)
+		}
+		if this.draft {
+			p.FrontMatter["draft"] = true
+		}
+		if err := storePage(r, p, NewPage(p.Path), ""); err != nil {
+			t.Fatalf("unable to store %s: %s", this.path, err)
+		}
+	}
+}
+
+func TestTagsHandler(t *testing.T) {
+	tagsTestSetup(t)
+	for i, this := range []struct {
+		url, user       string
+		expect, missing []string
+	}{
+		{"/tags/", "anonymous", []string{`>go</a> (2)`, `>golang</a> (1)`, `>hugo</a> (1)`}, []string{"wip", "secret"}},
+		{"/tags/?drafts=true", "anonymous", []string{`>go</a> (2)`, `>golang</a> (2)`, `>wip</a> (1)`}, []string{"secret"}},
+		{"/tags/?drafts=true", "alice", []string{`>golang</a> (3)`, `>secret</a> (1)`}, nil},
+		{"/tags/golang", "anonymous", []string{`href="/view/b"`}, []string{"/view/a", "/view/c", "/view/secret/x"}},
+		{"/tags/golang?drafts=true", "alice", []string{`href="/view/b"`, `href="/view/c">c</a> (draft)`, `href="/view/secret/x"`}, []string{"/view/a"}},
+		{"/tags/missing", "anonymous", []string{"No pages."}, nil},
+	} {
+		w := httptest.NewRecorder()
+		tagsHandler(w, withUser(httptest.NewRequest("GET", this.url, nil), this.user))
+		body := w.Body.String()
+		for _, s := range this.expect {
+			if !strings.Contains(body, s) {
+				t.Errorf("[%d] got no %s for %s on %s", i, s, this.user, this.url)
+			}
+		}
+		for _, s := range this.missing {
+			if strings.Contains(body, s) {
+				t.Errorf("[%d] got %s for %s on %s", i, s, this.user, this.url)
+			}
+		}
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	tagsTestSetup(t)
+	for i, this := range []struct {
+		form, err string
+	}{
+		{"from=golang&to=two+words", "invalid tags"},
+		{"from=&to=go", "invalid tags"},
+		{"from=golang&to=go", ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/v1/tags/rename", strings.NewReader(this.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		tagRenameHandler(w, r)
+		var res struct {
+			Touched []string
+			Error   string
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("[%d] got invalid JSON %s: %s", i, w.Body, err)
+		}
+		if !strings.Contains(res.Error, this.err) || this.err == "" && res.Error != "" {
+			t.Errorf("[%d] got error %q but expected %q", i, res.Error, this.err)
+		}
+		if expect := []string{"b", "c", "secret/x"}; this.err == "" && !reflect.DeepEqual(res.Touched, expect) {
+			t.Errorf("[%d] got touched pages %q but expected %q", i, res.Touched, expect)
+		}
+	}
+	for path, expect := range map[string]string{"a": "go hugo", "b": "go", "c": "go wip", "d": "", "secret/x": "go secret"} {
+		p, err := LoadPage(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := strings.Join(p.Tags(), " "); got != expect {
+			t.Errorf("got tags %q of %s but expected %q", got, path, expect)
+		}
+	}
+	if infos := index.Tagged("golang", true); len(infos) != 0 {
+		t.Errorf("got pages %v still tagged golang", infos)
+	}
+	if infos := index.Tagged("go", true); len(infos) != 4 {
+		t.Errorf("got %d pages tagged go but expected 4", len(infos))
+	}
+}
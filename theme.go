@@ -0,0 +1,452 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	themesDir    = flag.String("themes", "./gwiki-themes/", "directory containing installed gwiki themes")
+	themeName    = flag.String("theme", "", "name of the installed theme to use instead of the default templates")
+	installTheme = flag.String("install-theme", "", "install a theme from a zip/tar(.gz) file, https URL or git repository and exit")
+)
+
+// templateNames are the templates every theme has to provide.
+var templateNames = []string{"edit.html", "view.html", "list.html", "section.html", "tags.html", "changes.html", "reviews.html", "adr.html", "linkreport.html", "quality.html", "snapshots.html", "diff.html", "rename.html", "attachments.html", "share.html", "shared.html", "bundle.html", "publish.html", "themes.html", "mails.html", "new.html", "print.html", "static.html"}
+
+var validThemeName = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+var (
+	templateMutex sync.RWMutex
+	activeTheme   string // empty for the default templates in TemplateDir
+)
+
+// templateFuncs are available in all templates.
+var templateFuncs = template.FuncMap{
+	"csrfField": csrfField,
+	"csrfToken": func() string { return csrfPlaceholder },
+	"readOnly":  func() bool { return *readOnly },
+	"pdfExport": func() bool { return pdfBackend != nil },
+	"pandoc":    func() bool { return *pandocBinary != "" },
+}
+
+func parseTemplates(dir string) (*template.Template, error) {
+	fns := make([]string, len(templateNames))
+	for i, n := range templateNames {
+		fns[i] = filepath.Join(dir, n)
+	}
+	return template.New("").Funcs(templateFuncs).ParseFiles(fns...)
+}
+
+func currentTemplates() *template.Template {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+	return templates
+}
+
+// validateTheme makes sure all required templates exist and parse.
+func validateTheme(dir string) error {
+	var missing []string
+	for _, n := range templateNames {
+		if _, err := os.Stat(filepath.Join(dir, n)); err != nil {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("theme is missing the templates: %s", strings.Join(missing, ", "))
+	}
+	_, err := parseTemplates(dir)
+	return err
+}
+
+// activateTheme switches all rendering to the installed theme name
+// (or back to the default templates if name is empty).
+func activateTheme(name string) error {
+	dir := TemplateDir
+	if name != "" {
+		if !validThemeName.MatchString(name) {
+			return fmt.Errorf("invalid theme name '%s'", name)
+		}
+		dir = filepath.Join(*themesDir, name)
+		if err := validateTheme(dir); err != nil {
+			return fmt.Errorf("unable to activate theme '%s': %s", name, err)
+		}
+	}
+	t, err := parseTemplates(dir)
+	if err != nil {
+		return fmt.Errorf("unable to activate theme '%s': %s", name, err)
+	}
+	templateMutex.Lock()
+	templates = t
+	activeTheme = name
+	templateMutex.Unlock()
+	resetLayouts()
+	return nil
+}
+
+func listThemes() ([]string, error) {
+	fis, err := ioutil.ReadDir(*themesDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ns []string
+	for _, fi := range fis {
+		if fi.IsDir() && validThemeName.MatchString(fi.Name()) {
+			ns = append(ns, fi.Name())
+		}
+	}
+	sort.Strings(ns)
+	return ns, nil
+}
+
+// installThemeFrom installs a theme from src, which can be a remote zip
+// or tar(.gz) archive or a git repository (both https only) or, with
+// local (on the command line), an archive on this machine. The theme is
+// only moved into place after it has been validated.
+func installThemeFrom(src, name string, local bool) (string, error) {
+	if err := checkThemeSource(src, local); err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = themeNameFromSource(src)
+	}
+	if !validThemeName.MatchString(name) {
+		return "", fmt.Errorf("invalid theme name '%s'", name)
+	}
+	target := filepath.Join(*themesDir, name)
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("theme '%s' is already installed", name)
+	}
+	if err := os.MkdirAll(*themesDir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(*themesDir, ".install-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if isGitURL(src) {
+		err = gitClone(src, filepath.Join(tmp, name))
+	} else {
+		err = extractArchive(src, tmp)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch theme from '%s': %s", src, err)
+	}
+	root, err := findThemeRoot(tmp)
+	if err != nil {
+		return "", err
+	}
+	if err = validateTheme(root); err != nil {
+		return "", err
+	}
+	if err = os.Rename(root, target); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func themeNameFromSource(src string) string {
+	n := path.Base(strings.TrimSuffix(filepath.ToSlash(src), "/"))
+	for _, ext := range []string{".git", ".zip", ".tgz", ".tar.gz", ".tar"} {
+		n = strings.TrimSuffix(n, ext)
+	}
+	return n
+}
+
+// checkThemeSource rejects sources other than https URLs and, unless
+// local, files on this machine.
+func checkThemeSource(src string, local bool) error {
+	if strings.HasPrefix(src, "https://") && len(src) > len("https://") {
+		return nil
+	}
+	if local && !strings.Contains(src, "://") && !strings.HasPrefix(src, "-") && !strings.HasPrefix(src, "git@") {
+		return nil
+	}
+	return fmt.Errorf("invalid theme source '%s': only https URLs are allowed", src)
+}
+
+func isGitURL(src string) bool {
+	return strings.HasSuffix(src, ".git")
+}
+
+func gitClone(url, dir string) error {
+	_, sp := startSpan(context.Background(), "git clone")
+	sp.SetAttr("git.url", url)
+	defer sp.End()
+	out, err := exec.Command("git", "clone", "--depth", "1", "--", url, dir).CombinedOutput()
+	if err != nil {
+		sp.SetError(err)
+		return fmt.Errorf("%s: %s", err, out)
+	}
+	return os.RemoveAll(filepath.Join(dir, ".git"))
+}
+
+// findThemeRoot returns dir or the single directory inside it, since
+// archives usually contain one top level directory.
+func findThemeRoot(dir string) (string, error) {
+	for {
+		if validateTheme(dir) == nil {
+			return dir, nil
+		}
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+		if len(fis) != 1 || !fis[0].IsDir() {
+			return dir, nil // validation will report what is missing
+		}
+		dir = filepath.Join(dir, fis[0].Name())
+	}
+}
+
+func openSource(src string) (io.ReadCloser, error) {
+	if strings.HasPrefix(src, "https://") {
+		resp, err := http.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("download failed: %s", resp.Status)
+		}
+		return resp.Body, nil
+	}
+	return os.Open(src)
+}
+
+func extractArchive(src, dir string) error {
+	rc, err := openSource(src)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	switch {
+	case strings.HasSuffix(src, ".zip"):
+		return extractZip(rc, dir)
+	case strings.HasSuffix(src, ".tar.gz"), strings.HasSuffix(src, ".tgz"):
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return err
+		}
+		return extractTar(gz, dir)
+	case strings.HasSuffix(src, ".tar"):
+		return extractTar(rc, dir)
+	default:
+		return errors.New("unsupported archive format (use .zip, .tar, .tar.gz or .tgz)")
+	}
+}
+
+// Extracted archives are limited, so a small zip bomb can't fill the disk.
+const (
+	ArchiveMaxSize     = 1 << 30 // all entries together
+	ArchiveMaxFileSize = 256 << 20
+	ArchiveMaxEntries  = 100000
+)
+
+// archiveBudget counts what an archive extracted so far.
+type archiveBudget struct {
+	size, maxSize, maxFileSize int64
+	entries                    int
+}
+
+func newArchiveBudget() *archiveBudget {
+	return &archiveBudget{maxSize: ArchiveMaxSize, maxFileSize: ArchiveMaxFileSize}
+}
+
+// extract writes the entry r to fn within the budget.
+func (b *archiveBudget) extract(fn string, r io.Reader) error {
+	if b.entries++; b.entries > ArchiveMaxEntries {
+		return fmt.Errorf("the archive has more than %d entries", ArchiveMaxEntries)
+	}
+	limit := b.maxFileSize
+	if rest := b.maxSize - b.size; rest < limit {
+		limit = rest
+	}
+	lr := &io.LimitedReader{R: r, N: limit + 1}
+	err := writeFile(fn, lr)
+	n := limit + 1 - lr.N
+	b.size += n
+	if err == nil && n > limit {
+		err = fmt.Errorf("the archive is too large unpacked (at most %d bytes per file and %d bytes in all)", b.maxFileSize, b.maxSize)
+	}
+	return err
+}
+
+// archivePath returns the target path for an archive entry and rejects
+// entries escaping dir.
+func archivePath(dir, name string) (string, error) {
+	fn := filepath.Join(dir, name)
+	if !strings.HasPrefix(fn, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return fn, nil
+}
+
+func extractZip(r io.Reader, dir string) error {
+	// zip needs random access
+	tmp, err := ioutil.TempFile("", "gwiki-theme-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	budget := newArchiveBudget()
+	for _, f := range zr.File {
+		fn, err := archivePath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err = os.MkdirAll(fn, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = budget.extract(fn, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	budget := newArchiveBudget()
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fn, err := archivePath(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(fn, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err = budget.extract(fn, tr); err != nil {
+				return err
+			}
+		default:
+			slog.Warn("Skipping unsupported archive entry", "name", h.Name)
+		}
+	}
+}
+
+func writeFile(fn string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type themesData struct {
+	Themes  []string
+	Active  string
+	Message string
+	Err     string
+}
+
+func themesHandler(w http.ResponseWriter, r *http.Request) {
+	data := themesData{}
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "install":
+			name, err := installThemeFrom(r.FormValue("source"), r.FormValue("name"), false)
+			if err != nil {
+				data.Err = err.Error()
+			} else {
+				data.Message = fmt.Sprintf("Theme '%s' installed.", name)
+				audit(r, "install-theme", name)
+			}
+		case "activate":
+			name := r.FormValue("name")
+			if err := activateTheme(name); err != nil {
+				data.Err = err.Error()
+			} else {
+				data.Message = fmt.Sprintf("Theme '%s' activated.", name)
+				audit(r, "activate-theme", name)
+			}
+		default:
+			data.Err = "unknown action"
+		}
+		if data.Err != "" {
+			logger(r.Context()).Error("Unable to manage themes", "err", data.Err)
+		}
+	}
+	var err error
+	if data.Themes, err = listThemes(); err != nil {
+		logger(r.Context()).Error("Unable to list themes", "err", err)
+		data.Err = err.Error()
+	}
+	templateMutex.RLock()
+	data.Active = activeTheme
+	templateMutex.RUnlock()
+	renderTemplate(w, "themes", data)
+}
+
+func initTheme() {
+	if *installTheme != "" {
+		name, err := installThemeFrom(*installTheme, *themeName, true)
+		if err != nil {
+			fatal("Unable to install theme", "err", err)
+		}
+		slog.Info("Installed theme", "theme", name, "dir", *themesDir)
+		os.Exit(0)
+	}
+	if *themeName != "" {
+		if err := activateTheme(*themeName); err != nil {
+			fatal("Unable to use theme", "err", err)
+		}
+		slog.Info("Using theme", "theme", *themeName)
+	}
+}
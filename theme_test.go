@@ -0,0 +1,78 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, s := range map[string]string{"theme/view.html": "view", "theme/static/app.css": "css"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(s))
+	}
+	zw.Close()
+	dir := t.TempDir()
+	if err := extractZip(bytes.NewReader(buf.Bytes()), dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "theme", "static", "app.css")); err != nil || string(b) != "css" {
+		t.Errorf("got %q and error %v", b, err)
+	}
+
+	buf.Reset()
+	zw = zip.NewWriter(&buf)
+	w, _ := zw.Create("../escape.txt")
+	w.Write([]byte("x"))
+	zw.Close()
+	if err := extractZip(bytes.NewReader(buf.Bytes()), t.TempDir()); err == nil || !strings.Contains(err.Error(), "illegal path") {
+		t.Errorf("expected the path to be refused but got %v", err)
+	}
+}
+
+func TestArchiveBudget(t *testing.T) {
+	dir := t.TempDir()
+	b := &archiveBudget{maxSize: 10, maxFileSize: 6}
+	if err := b.extract(filepath.Join(dir, "a"), strings.NewReader("123456")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := b.extract(filepath.Join(dir, "b"), strings.NewReader("1234567")); err == nil {
+		t.Error("expected an error for a file larger than the limit")
+	}
+	b = &archiveBudget{maxSize: 10, maxFileSize: 6}
+	b.extract(filepath.Join(dir, "c"), strings.NewReader("123456"))
+	if err := b.extract(filepath.Join(dir, "d"), strings.NewReader("12345")); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("expected an error for exceeding the total but got %v", err)
+	}
+}
+
+func TestCheckThemeSource(t *testing.T) {
+	for i, this := range []struct {
+		src   string
+		local bool
+		ok    bool
+	}{
+		{"https://example.com/theme.zip", false, true},
+		{"https://example.com/theme.git", false, true},
+		{"http://example.com/theme.zip", false, false},
+		{"/etc/passwd.tar", false, false},
+		{"theme.zip", false, false},
+		{"--upload-pack=touch /tmp/x", false, false},
+		{"--upload-pack=touch /tmp/x", true, false},
+		{"git@example.com:theme.git", true, false},
+		{"file:///tmp/theme.git", true, false},
+		{"./theme.zip", true, true},
+	} {
+		if err := checkThemeSource(this.src, this.local); (err == nil) != this.ok {
+			t.Errorf("[%d] got %v for %q", i, err, this.src)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A TiddlyWiki JSON export (of the tiddlers, e.g. from the Tiddlers tab of
+// Advanced Search) is imported with the WikiText tiddlers converted to
+// Markdown and "/" in titles as sections. System tiddlers and tiddlers
+// that aren't text (like images) aren't imported; macros and
+// transclusions are kept as text.
+
+// twTimeLayout is the format of the created and modified fields (UTC).
+const twTimeLayout = "20060102150405"
+
+type twTiddler struct {
+	Title    string `json:"title"`
+	Text     string `json:"text"`
+	Type     string `json:"type"`
+	Tags     string `json:"tags"`
+	Created  string `json:"created"`
+	Modified string `json:"modified"`
+	Creator  string `json:"creator"`
+	Modifier string `json:"modifier"`
+}
+
+var (
+	twTagList     = regexp.MustCompile(`\[\[([^\]]+)\]\]|(\S+)`)
+	twCode        = regexp.MustCompile("(?s)```([a-zA-Z0-9_+-]*)\n(.*?)\n```")
+	twMono        = regexp.MustCompile("`[^`\n]+`")
+	twMacro       = regexp.MustCompile(`<<([^\s<>]+)[^>\n]*>>|\{\{([^{}]+)\}\}`)
+	twImage       = regexp.MustCompile(`\[img(?:\s[^\[\]]*)?\[([^\[\]|]*?)(?:\|([^\[\]]*))?\]\]`)
+	twLink        = regexp.MustCompile(`\[\[([^\[\]|]*?)(?:\|([^\[\]]*))?\]\]`)
+	twExtLink     = regexp.MustCompile(`\[ext\[([^\[\]|]*?)(?:\|([^\[\]]*))?\]\]`)
+	twURL         = regexp.MustCompile(`(?:https?|ftp)://[^\s\[\]<>|]+[^\s\[\]<>|.,;:!?)]`)
+	twHeading     = regexp.MustCompile(`^(!{1,6})\s*(.*)$`)
+	twList        = regexp.MustCompile(`^([*#;:>]+)\s*(.*)$`)
+	twBold        = regexp.MustCompile(`''(.+?)''`)
+	twItalic      = regexp.MustCompile(`//(.+?)//`)
+	twUnderline   = regexp.MustCompile(`__(.+?)__`)
+	twSuper       = regexp.MustCompile(`\^\^(.+?)\^\^`)
+	twSub         = regexp.MustCompile(`,,(.+?),,`)
+	twPlaceholder = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// twPage converts the WikiText of a tiddler to Markdown.
+type twPage struct {
+	imp       *Import
+	title     string // of the tiddler for problems
+	section   string
+	protected []string
+}
+
+// importTiddlyWiki converts the tiddlers of the TiddlyWiki JSON export fn
+// to pages below section.
+func importTiddlyWiki(fn, section string) (*Import, error) {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var tiddlers []twTiddler
+	if err = json.Unmarshal(b, &tiddlers); err != nil {
+		return nil, fmt.Errorf("invalid TiddlyWiki export: %s", err)
+	}
+	sort.Slice(tiddlers, func(i, j int) bool { return tiddlers[i].Title < tiddlers[j].Title })
+	imp := &Import{}
+	taken := make(map[string]bool)
+	system := 0
+	for _, t := range tiddlers {
+		switch {
+		case strings.HasPrefix(t.Title, "$:/"):
+			system++
+			continue
+		case t.Type != "" && t.Type != "text/vnd.tiddlywiki" && t.Type != "text/x-markdown" && t.Type != "text/markdown" && t.Type != "text/plain":
+			imp.problem("tiddler '%s' of type '%s' isn't imported", t.Title, t.Type)
+			continue
+		}
+		p := NewPage(uniqueName(taken, mwPath(section, t.Title)))
+		if !isValidPath(p.Path) {
+			imp.problem("tiddler '%s' has the invalid path '%s'", t.Title, p.Path)
+			continue
+		}
+		switch t.Type {
+		case "text/x-markdown", "text/markdown":
+			p.Body = []byte(strings.TrimSpace(strings.ReplaceAll(t.Text, "\r\n", "\n")) + "\n")
+		case "text/plain":
+			p.Body = []byte("```\n" + strings.Trim(t.Text, "\n") + "\n```\n")
+		default:
+			tp := &twPage{imp: imp, title: t.Title, section: section}
+			p.Body = []byte(tp.convert(t.Text))
+		}
+		p.FrontMatter["title"] = path.Base(t.Title)
+		if d, ok := twTime(t.Created); ok {
+			p.FrontMatter["date"] = d
+		}
+		if d, ok := twTime(t.Modified); ok && d != p.FrontMatter["date"] {
+			p.FrontMatter["lastmod"] = d
+		}
+		var contributors []interface{}
+		for _, c := range []string{t.Creator, t.Modifier} {
+			if c != "" && (len(contributors) == 0 || contributors[0] != c) {
+				contributors = append(contributors, c)
+			}
+		}
+		if contributors != nil {
+			p.FrontMatter["contributors"] = contributors
+		}
+		if tags := twTags(t.Tags); tags != nil {
+			p.FrontMatter["tags"] = tags
+		}
+		imp.Pages = append(imp.Pages, p)
+	}
+	if system > 0 {
+		imp.problem("%d system tiddlers aren't imported", system)
+	}
+	return imp, nil
+}
+
+// twTime returns the time t of a tiddler (with or without milliseconds) as
+// RFC 3339.
+func twTime(t string) (string, bool) {
+	if len(t) < len(twTimeLayout) {
+		return "", false
+	}
+	tm, err := time.Parse(twTimeLayout, t[:len(twTimeLayout)])
+	if err != nil {
+		return "", false
+	}
+	return tm.Format(time.RFC3339), true
+}
+
+// twTags returns the tags of the tags field: separated by spaces with
+// [[...]] around tags containing spaces.
+func twTags(s string) []interface{} {
+	var tags []interface{}
+	for _, m := range twTagList.FindAllStringSubmatch(s, -1) {
+		if t := strings.TrimSpace(m[1] + m[2]); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// protect returns a placeholder for the Markdown s that isn't converted.
+func (tp *twPage) protect(s string) string {
+	tp.protected = append(tp.protected, s)
+	return fmt.Sprintf("\x00%d\x00", len(tp.protected)-1)
+}
+
+// convert returns the WikiText s as Markdown.
+func (tp *twPage) convert(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = twCode.ReplaceAllStringFunc(s, tp.protect)
+	s = twMono.ReplaceAllStringFunc(s, tp.protect)
+	reported := make(map[string]bool)
+	s = twMacro.ReplaceAllStringFunc(s, func(m string) string {
+		if !reported[m] {
+			reported[m] = true
+			tp.imp.problem("macro or transclusion '%s' in '%s' is kept as text", m, tp.title)
+		}
+		return tp.protect(m)
+	})
+	s = twImage.ReplaceAllStringFunc(s, tp.image)
+	s = twExtLink.ReplaceAllStringFunc(s, func(m string) string {
+		sm := twExtLink.FindStringSubmatch(m)
+		return tp.externalLink(sm[1], sm[2])
+	})
+	s = twLink.ReplaceAllStringFunc(s, tp.link)
+	s = twURL.ReplaceAllStringFunc(s, tp.protect)
+
+	var out, table []string
+	quote := false
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, "|") && strings.HasSuffix(strings.TrimSpace(line), "|") {
+			table = append(table, strings.TrimSpace(line))
+			continue
+		}
+		if table != nil {
+			out = append(out, tp.table(table)...)
+			table = nil
+		}
+		if strings.HasPrefix(line, "<<<") {
+			quote = !quote
+			continue
+		}
+		line = tp.block(line)
+		if quote {
+			line = "> " + line
+		}
+		out = append(out, line)
+	}
+	if table != nil {
+		out = append(out, tp.table(table)...)
+	}
+	md := strings.TrimSpace(strings.Join(out, "\n"))
+	for twPlaceholder.MatchString(md) {
+		md = twPlaceholder.ReplaceAllStringFunc(md, func(m string) string {
+			i, _ := strconv.Atoi(strings.Trim(m, "\x00"))
+			return tp.protected[i]
+		})
+	}
+	return md + "\n"
+}
+
+// block converts a line outside of tables.
+func (tp *twPage) block(line string) string {
+	if m := twHeading.FindStringSubmatch(line); m != nil {
+		return strings.Repeat("#", len(m[1])) + " " + tp.inline(m[2])
+	}
+	m := twList.FindStringSubmatch(line)
+	if m == nil {
+		return tp.inline(line)
+	}
+	marks, text := m[1], tp.inline(m[2])
+	indent := ""
+	for _, c := range marks[:len(marks)-1] {
+		switch c {
+		case '*':
+			indent += "  "
+		case '#':
+			indent += "   "
+		}
+	}
+	switch marks[len(marks)-1] {
+	case '*':
+		return indent + "- " + text
+	case '#':
+		return indent + "1. " + text
+	case ';':
+		return "\n" + text
+	case ':':
+		return ": " + text
+	}
+	return marks + " " + text
+}
+
+// table converts the rows of a table; cells starting with "!" are header
+// cells.
+func (tp *twPage) table(rows []string) []string {
+	var cells [][]string
+	header := false
+	cols := 0
+	for i, r := range rows {
+		var row []string
+		for _, c := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(r, "|"), "|"), "|") {
+			if strings.HasPrefix(c, "!") {
+				header = header || i == 0
+				c = c[1:]
+			}
+			row = append(row, tp.inline(strings.TrimSpace(c)))
+		}
+		if len(row) > cols {
+			cols = len(row)
+		}
+		cells = append(cells, row)
+	}
+	if !header {
+		cells = append([][]string{make([]string, cols)}, cells...)
+	}
+	out := []string{""}
+	for i, row := range cells {
+		for len(row) < cols {
+			row = append(row, "")
+		}
+		out = append(out, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			out = append(out, strings.TrimSuffix(strings.Repeat("| --- ", cols), " ")+" |")
+		}
+	}
+	return append(out, "")
+}
+
+// inline converts the formatting.
+func (tp *twPage) inline(s string) string {
+	s = twBold.ReplaceAllString(s, "**$1**")
+	s = twItalic.ReplaceAllString(s, "*$1*")
+	s = twUnderline.ReplaceAllString(s, "*$1*")
+	s = twSuper.ReplaceAllString(s, "<sup>$1</sup>")
+	return twSub.ReplaceAllString(s, "<sub>$1</sub>")
+}
+
+// externalLink returns the Markdown link to the URL u.
+func (tp *twPage) externalLink(label, u string) string {
+	if u == "" {
+		return tp.protect("<" + label + ">")
+	}
+	return tp.protect("[" + label + "](" + u + ")")
+}
+
+// link converts a link [[label|target]] (or [[target]]).
+func (tp *twPage) link(m string) string {
+	sm := twLink.FindStringSubmatch(m)
+	label, target := strings.TrimSpace(sm[1]), strings.TrimSpace(sm[2])
+	if target == "" {
+		target = label
+	}
+	if dwScheme.MatchString(target) {
+		return tp.externalLink(label, target)
+	}
+	return tp.protect("[" + label + "](/view/" + mwPath(tp.section, target) + ")")
+}
+
+// image converts an image [img[tooltip|source]] (or [img[source]]).
+func (tp *twPage) image(m string) string {
+	sm := twImage.FindStringSubmatch(m)
+	alt, src := strings.TrimSpace(sm[1]), strings.TrimSpace(sm[2])
+	if src == "" {
+		alt, src = "", alt
+	}
+	if !dwScheme.MatchString(src) {
+		tp.imp.problem("image '%s' in '%s' isn't imported, upload it and fix the link", src, tp.title)
+		return tp.protect(m)
+	}
+	return tp.protect("![" + alt + "](" + src + ")")
+}
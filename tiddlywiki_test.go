@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTiddlyWikiText(t *testing.T) {
+	for i, this := range []struct {
+		text, expect string
+	}{
+		{"! Intro\n!! More\nSome ''bold'', //italic//, __under__ and ^^up^^.", "# Intro\n## More\nSome **bold**, *italic*, *under* and <sup>up</sup>.\n"},
+		{"See [[Main Page]], [[the other|Other Page]] and [[site|https://example.com]].",
+			"See [Main Page](/view/tw/main-page), [the other](/view/tw/other-page) and [site](https://example.com).\n"},
+		{"[ext[https://example.org]] https://example.net/a//b [img[logo|https://example.com/logo.png]] [img[local.png]]",
+			"<https://example.org> https://example.net/a//b ![logo](https://example.com/logo.png) [img[local.png]]\n"},
+		{"* a\n** b\n# one\n## two", "- a\n  - b\n1. one\n   1. two\n"},
+		{"```go\nfunc f() {}\n```\n`//x//` <<toc>> {{Other}}", "```go\nfunc f() {}\n```\n`//x//` <<toc>> {{Other}}\n"},
+		{"<<<\nquoted\n<<<\n|!A|!B|\n|1|2|", "> quoted\n\n| A | B |\n| --- | --- |\n| 1 | 2 |\n"},
+	} {
+		tp := &twPage{imp: &Import{}, title: "T", section: "tw"}
+		if got := tp.convert(this.text); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+}
+
+const twTestExport = `[
+  {"title": "Main Page", "text": "Hello [[Notes/First]] <<now>>", "tags": "start [[two words]]",
+   "created": "20200102030405000", "modified": "20210102030405000", "creator": "alice", "modifier": "bob"},
+  {"title": "Notes/First", "text": "# Markdown", "type": "text/x-markdown", "created": "20200102030405000"},
+  {"title": "logo.png", "text": "iVBORw0K", "type": "image/png"},
+  {"title": "$:/StoryList", "text": ""}
+]`
+
+func TestImportTiddlyWiki(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "tiddlers.json")
+	if err := os.WriteFile(fn, []byte(twTestExport), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imp, err := importTiddlyWiki(fn, "tw")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(imp.Pages) != 2 {
+		t.Fatalf("got %d pages but expected 2", len(imp.Pages))
+	}
+	for i, this := range []struct {
+		path, body string
+		fm         map[string]interface{}
+	}{
+		{"tw/main-page", "Hello [Notes/First](/view/tw/notes/first) <<now>>\n", map[string]interface{}{"title": "Main Page",
+			"date": "2020-01-02T03:04:05Z", "lastmod": "2021-01-02T03:04:05Z", "contributors": []interface{}{"alice", "bob"}, "tags": []interface{}{"start", "two words"}}},
+		{"tw/notes/first", "# Markdown\n", map[string]interface{}{"title": "First", "date": "2020-01-02T03:04:05Z"}},
+	} {
+		p := imp.Pages[i]
+		if p.Path != this.path || string(p.Body) != this.body || !reflect.DeepEqual(p.FrontMatter, this.fm) {
+			t.Errorf("[%d] got page %s with %v and body %q", i, p.Path, p.FrontMatter, p.Body)
+		}
+	}
+	problems := strings.Join(imp.Problems, "\n")
+	for _, p := range []string{"macro or transclusion '<<now>>'", "tiddler 'logo.png' of type 'image/png'", "1 system tiddlers"} {
+		if !strings.Contains(problems, p) {
+			t.Errorf("problem %q wasn't reported in %q", p, problems)
+		}
+	}
+}
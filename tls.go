@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// gwiki serves HTTPS itself with either a certificate and key (e.g. from
+// an internal CA) or certificates from Let's Encrypt for the domains of
+// -autocert-domains. Let's Encrypt has to reach the server on port 443
+// (-addr :443) or on port 80 (-http-addr :80), which also redirects plain
+// HTTP to HTTPS.
+var (
+	tlsCert         = flag.String("tls-cert", "", "certificate file (PEM) for serving HTTPS")
+	tlsKey          = flag.String("tls-key", "", "key file (PEM) of -tls-cert")
+	autocertDomains = flag.String("autocert-domains", "", "comma separated domains to get certificates from Let's Encrypt for (serves HTTPS)")
+	autocertCache   = flag.String("autocert-cache", "./autocert/", "directory for certificates from Let's Encrypt")
+	autocertEmail   = flag.String("autocert-email", "", "contact address for Let's Encrypt (optional)")
+	httpAddr        = flag.String("http-addr", "", "address of a plain HTTP server redirecting to HTTPS and answering Let's Encrypt challenges (e.g. ':80')")
+)
+
+var (
+	tlsConfig   *tls.Config  // nil: plain HTTP
+	httpHandler http.Handler // for -http-addr
+)
+
+// splitDomains parses the -autocert-domains flag.
+func splitDomains(s string) []string {
+	var ds []string
+	for _, d := range strings.Split(s, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// checkTLSFlags reports contradicting or incomplete TLS flags.
+func checkTLSFlags(cert, key string, domains []string, httpAddr string) error {
+	switch {
+	case (cert == "") != (key == ""):
+		return fmt.Errorf("-tls-cert and -tls-key have to be used together")
+	case cert != "" && len(domains) > 0:
+		return fmt.Errorf("use either -tls-cert or -autocert-domains")
+	case httpAddr != "" && cert == "" && len(domains) == 0:
+		return fmt.Errorf("-http-addr needs -tls-cert or -autocert-domains")
+	}
+	return nil
+}
+
+func initTLS() {
+	domains := splitDomains(*autocertDomains)
+	if err := checkTLSFlags(*tlsCert, *tlsKey, domains, *httpAddr); err != nil {
+		fatal("Invalid TLS flags", "err", err)
+	}
+	switch {
+	case *tlsCert != "":
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			fatal("Unable to load TLS certificate", "err", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		httpHandler = http.HandlerFunc(redirectHTTPS)
+	case len(domains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(*autocertCache),
+			Email:      *autocertEmail,
+		}
+		tlsConfig = m.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		httpHandler = m.HTTPHandler(http.HandlerFunc(redirectHTTPS))
+		slog.Info("Getting certificates from Let's Encrypt", "domains", strings.Join(domains, ", "))
+	}
+}
+
+// redirectHTTPS redirects plain HTTP requests to HTTPS on -addr.
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(*addr); err == nil && port != "443" && port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u := *r.URL
+	u.Scheme, u.Host = "https", host
+	http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckTLSFlags(t *testing.T) {
+	for i, this := range []struct {
+		cert, key, domains, httpAddr string
+		expectErr                    bool
+	}{
+		{"", "", "", "", false},
+		{"c.pem", "k.pem", "", ":80", false},
+		{"", "", " Wiki.Example.org, ", ":80", false},
+		{"c.pem", "", "", "", true},
+		{"", "k.pem", "", "", true},
+		{"c.pem", "k.pem", "wiki.example.org", "", true},
+		{"", "", "", ":80", true},
+	} {
+		err := checkTLSFlags(this.cert, this.key, splitDomains(this.domains), this.httpAddr)
+		if (err != nil) != this.expectErr {
+			t.Errorf("[%d] got error %v but expected one: %t", i, err, this.expectErr)
+		}
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	defer func(a string) { *addr = a }(*addr)
+	for i, this := range []struct {
+		addr, host, url string
+		expect          string
+	}{
+		{":443", "wiki.example:80", "/view/x?a=1", "https://wiki.example/view/x?a=1"},
+		{":8443", "wiki.example", "/", "https://wiki.example:8443/"},
+	} {
+		*addr = this.addr
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", this.url, nil)
+		r.Host = this.host
+		redirectHTTPS(w, r)
+		if got := w.Header().Get("Location"); got != this.expect {
+			t.Errorf("[%d] got %q but expected %q", i, got, this.expect)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Automation and editor plugins authenticate at the JSON API (/api/) with
+// long-lived tokens in the "Authorization: Bearer <token>" header instead
+// of passwords or session cookies. Users issue and revoke their tokens at
+// /admin/tokens; a token acts for its user, read-only or read-write and
+// optionally only for the pages below some paths. Only hashes of the
+// tokens are kept in the tokens file.
+var tokensFile = flag.String("tokens-file", "./gwiki-tokens.json", "file with the hashes of the API tokens")
+
+const (
+	TokenPrefix = "gwt_"
+	ReadScope   = "read"
+	WriteScope  = "write"
+)
+
+// Token is an API token without its secret.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	User    string    `json:"user"`
+	Scope   string    `json:"scope"`           // ReadScope or WriteScope
+	Paths   []string  `json:"paths,omitempty"` // page path prefixes (empty: all pages)
+	Created time.Time `json:"created"`
+	Hash    string    `json:"hash,omitempty"` // SHA-256 of the secret
+}
+
+// pathScopedAPI are the endpoints that check the paths of path-scoped
+// tokens.
+var pathScopedAPI = []string{"/api/v1/batch", "/api/v1/pages", "/api/v1/canonical/", MicropubPath, GraphQLPath, "/api/v1/export", ClipPath, MailInPath}
+
+type tokenStore struct {
+	mutex  sync.Mutex
+	tokens map[string]*Token // by ID
+}
+
+var tokens = &tokenStore{tokens: make(map[string]*Token)}
+
+type tokenKey struct{}
+
+func initTokens() {
+	b, err := ioutil.ReadFile(*tokensFile)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		fatal("Unable to read tokens file", "file", *tokensFile, "err", err)
+	}
+	var ts []*Token
+	if err = json.Unmarshal(b, &ts); err != nil {
+		fatal("Unable to parse tokens file", "file", *tokensFile, "err", err)
+	}
+	for _, t := range ts {
+		tokens.tokens[t.ID] = t
+	}
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// save writes all tokens to the tokens file. The caller holds the mutex.
+func (ts *tokenStore) save() error {
+	l := ts.list("")
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*tokensFile, b, 0600)
+}
+
+// list returns the tokens of user (all for "") sorted by creation time.
+// The caller holds the mutex.
+func (ts *tokenStore) list(user string) []*Token {
+	l := []*Token{}
+	for _, t := range ts.tokens {
+		if user == "" || t.User == user {
+			l = append(l, t)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if !l[i].Created.Equal(l[j].Created) {
+			return l[i].Created.Before(l[j].Created)
+		}
+		return l[i].ID < l[j].ID
+	})
+	return l
+}
+
+// Issue creates a token for user and returns it with its secret, which is
+// shown only once.
+func (ts *tokenStore) Issue(user, name, scope string, paths []string) (*Token, string, error) {
+	if scope != ReadScope && scope != WriteScope {
+		return nil, "", fmt.Errorf("unknown scope '%s'", scope)
+	}
+	for i, p := range paths {
+		p = strings.Trim(p, "/")
+		if checkPath(p) != nil {
+			return nil, "", fmt.Errorf("invalid path '%s'", paths[i])
+		}
+		paths[i] = p
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	id, secret := hex.EncodeToString(b[:4]), hex.EncodeToString(b[4:])
+	t := &Token{ID: id, Name: name, User: user, Scope: scope, Paths: paths, Created: time.Now().UTC(), Hash: hashSecret(secret)}
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.tokens[id] = t
+	if err := ts.save(); err != nil {
+		delete(ts.tokens, id)
+		return nil, "", err
+	}
+	return t, TokenPrefix + id + "_" + secret, nil
+}
+
+// Revoke deletes the token id of user.
+func (ts *tokenStore) Revoke(user, id string) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	t := ts.tokens[id]
+	if t == nil || t.User != user {
+		return os.ErrNotExist
+	}
+	delete(ts.tokens, id)
+	if err := ts.save(); err != nil {
+		ts.tokens[id] = t
+		return err
+	}
+	return nil
+}
+
+// Check returns the token of the bearer token s or nil.
+func (ts *tokenStore) Check(s string) *Token {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(s, TokenPrefix), "_")
+	if !ok || !strings.HasPrefix(s, TokenPrefix) {
+		return nil
+	}
+	ts.mutex.Lock()
+	t := ts.tokens[id]
+	ts.mutex.Unlock()
+	if t == nil || subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(t.Hash)) != 1 {
+		return nil
+	}
+	return t
+}
+
+// Allows reports whether t may access the page at path.
+func (t *Token) Allows(path string) bool {
+	if len(t.Paths) == 0 {
+		return true
+	}
+	for _, p := range t.Paths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestToken returns the token the request was authenticated with.
+func requestToken(r *http.Request) *Token {
+	t, _ := r.Context().Value(tokenKey{}).(*Token)
+	return t
+}
+
+// tokenAllows reports whether the token of r (if any) may access the page
+// at path.
+func tokenAllows(r *http.Request, path string) bool {
+	t := requestToken(r)
+	return t == nil || t.Allows(path)
+}
+
+func bearerToken(r *http.Request) string {
+	a := r.Header.Get("Authorization")
+	if len(a) > 7 && strings.EqualFold(a[:7], "Bearer ") {
+		return strings.TrimSpace(a[7:])
+	}
+	// Micropub clients may send the token in the form instead.
+	if strings.HasPrefix(r.URL.Path, MicropubPath) && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return r.PostFormValue("access_token")
+	}
+	return ""
+}
+
+// tokenHandler authenticates requests to the JSON API with a bearer token
+// and enforces its scope. Other requests go on to the basic auth or OAuth2
+// login.
+func tokenHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := bearerToken(r)
+		if s == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if loginLimiter != nil {
+			if d := loginLimiter.wait(clientIP(r)); d > 0 {
+				tooManyRequests(w, r, d)
+				return
+			}
+		}
+		t := tokens.Check(s)
+		if t == nil || !strings.HasPrefix(r.URL.Path, "/api/") {
+			if t == nil {
+				logger(r.Context()).Warn("Invalid API token", "remote", r.RemoteAddr)
+				if loginLimiter != nil {
+					loginLimiter.take(clientIP(r))
+				}
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", *authRealm))
+			http.Error(w, "invalid API token", http.StatusUnauthorized)
+			return
+		}
+		// GraphQL queries are POSTed too, so mutations check the scope.
+		if t.Scope != WriteScope && !isSafeMethod(r.Method) && r.URL.Path != GraphQLPath {
+			http.Error(w, "read-only API token", http.StatusForbidden)
+			return
+		}
+		if len(t.Paths) > 0 && !hasAnyPrefix(r.URL.Path, pathScopedAPI) {
+			http.Error(w, "API token is limited to some pages", http.StatusForbidden)
+			return
+		}
+		r = withUser(r, t.User)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, t)))
+	})
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if s == p || strings.HasSuffix(p, "/") && strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokensHandler lists the tokens of the user (GET /admin/tokens), issues
+// one (POST with name, scope and comma separated paths) or revokes one
+// (DELETE ?id=).
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		tokens.mutex.Lock()
+		l := tokens.list(user)
+		ts := make([]Token, len(l))
+		for i, t := range l {
+			ts[i] = *t
+			ts[i].Hash = ""
+		}
+		tokens.mutex.Unlock()
+		writeJSON(w, map[string]interface{}{"tokens": ts})
+	case http.MethodPost:
+		var paths []string
+		for _, p := range strings.Split(r.FormValue("paths"), ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				paths = append(paths, p)
+			}
+		}
+		scope := r.FormValue("scope")
+		if scope == "" {
+			scope = ReadScope
+		}
+		t, secret, err := tokens.Issue(user, r.FormValue("name"), scope, paths)
+		if err != nil {
+			logger(r.Context()).Warn("Unable to issue API token", "err", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audit(r, "issue-token", t.ID)
+		tc := *t
+		tc.Hash = ""
+		writeJSON(w, map[string]interface{}{"token": secret, "info": tc})
+	case http.MethodDelete:
+		id := r.FormValue("id")
+		if err := tokens.Revoke(user, id); os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			logger(r.Context()).Error("Unable to revoke API token", "id", id, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit(r, "revoke-token", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "GET, POST or DELETE required", http.StatusMethodNotAllowed)
+	}
+}
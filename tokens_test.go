@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwiki-tokens")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(f string, ts *tokenStore) { *tokensFile, tokens = f, ts }(*tokensFile, tokens)
+	*tokensFile = filepath.Join(dir, "tokens.json")
+	tokens = &tokenStore{tokens: make(map[string]*Token)}
+
+	_, read, err := tokens.Issue("alice", "reader", ReadScope, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, docs, err := tokens.Issue("bob", "docs", WriteScope, []string{"/docs/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, _, err = tokens.Issue("bob", "bad", "admin", nil); err == nil {
+		t.Errorf("expected an error for an unknown scope")
+	}
+
+	handler := tokenHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(currentUser(r)))
+	}))
+	for i, this := range []struct {
+		method, url, token string
+		expectCode         int
+		expectUser         string
+	}{
+		{"GET", "/api/v1/pages", "", http.StatusOK, "anonymous"},
+		{"GET", "/api/v1/pages", read, http.StatusOK, "alice"},
+		{"GET", "/api/v1/tree", read, http.StatusOK, "alice"},
+		{"POST", "/api/v1/batch", read, http.StatusForbidden, ""},
+		{"GET", "/edit/x", read, http.StatusUnauthorized, ""},
+		{"GET", "/api/v1/pages", read + "0", http.StatusUnauthorized, ""},
+		{"GET", "/api/v1/pages", "gwt_nope", http.StatusUnauthorized, ""},
+		{"POST", "/api/v1/batch", docs, http.StatusOK, "bob"},
+		{"GET", "/api/v1/canonical/docs/a", docs, http.StatusOK, "bob"},
+		{"GET", "/api/v1/tree", docs, http.StatusForbidden, ""},
+	} {
+		r := httptest.NewRequest(this.method, this.url, nil)
+		if this.token != "" {
+			r.Header.Set("Authorization", "Bearer "+this.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != this.expectCode {
+			t.Errorf("[%d] got code %d but expected %d", i, w.Code, this.expectCode)
+		}
+		if this.expectUser != "" && w.Body.String() != this.expectUser {
+			t.Errorf("[%d] got user %q but expected %q", i, w.Body.String(), this.expectUser)
+		}
+	}
+
+	// the tokens survive a restart but revoked ones don't
+	if err = tokens.Revoke("alice", tokens.Check(docs).ID); err == nil {
+		t.Errorf("expected an error for revoking the token of another user")
+	}
+	if err = tokens.Revoke("alice", tokens.Check(read).ID); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tokens = &tokenStore{tokens: make(map[string]*Token)}
+	initTokens()
+	if tokens.Check(read) != nil || tokens.Check(docs) == nil {
+		t.Errorf("got tokens %v after reloading", tokens.list(""))
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	tok := &Token{Paths: []string{"docs", "team/a"}}
+	for i, this := range []struct {
+		path   string
+		expect bool
+	}{
+		{"docs", true},
+		{"docs/intro", true},
+		{"docsx", false},
+		{"team/a/b", true},
+		{"team/b", false},
+		{"index", false},
+	} {
+		if got := tok.Allows(this.path); got != this.expect {
+			t.Errorf("[%d] got %t for %q but expected %t", i, got, this.path, this.expect)
+		}
+	}
+}
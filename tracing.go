@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing is optional: spans are only recorded if an OTLP endpoint is
+// configured. They are sent as OTLP/HTTP JSON so no collector specific
+// client library is needed.
+var (
+	otlpEndpoint = flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP endpoint for traces, e.g. http://localhost:4318 (empty disables tracing)")
+	otlpService  = flag.String("otlp-service", "gwiki", "service name reported with traces")
+)
+
+const (
+	TraceBatchSize     = 512
+	TraceFlushInterval = 5 * time.Second
+	TraceQueueSize     = 4096
+)
+
+// span is a single timed operation of a trace.
+// All methods are safe to call on a nil span (tracing disabled).
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      string
+}
+
+type spanKey struct{}
+
+var tracer *spanExporter
+
+// startSpan starts a new span as a child of the span in ctx (if any).
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	s := &span{name: name, kind: 1, start: time.Now(), attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *span) SetAttr(key string, value interface{}) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+func (s *span) SetError(err error) {
+	if s != nil && err != nil {
+		s.err = err.Error()
+	}
+}
+
+func (s *span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	tracer.export(s)
+}
+
+// parseTraceparent reads a W3C traceparent header so gwiki spans join
+// traces started by proxies or other services.
+func parseTraceparent(h string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return
+	}
+	return traceID, spanID, traceID != [16]byte{} && spanID != [8]byte{}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64 // bytes of the body written
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the original writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// traceHandler wraps h so every request gets a server span.
+func traceHandler(h http.Handler) http.Handler {
+	if tracer == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, s := startSpan(r.Context(), r.Method+" "+handlerLabel(r))
+		if traceID, parentID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			s.traceID, s.parentID = traceID, parentID
+		}
+		s.kind = 2
+		s.SetAttr("http.method", r.Method)
+		s.SetAttr("http.target", r.URL.RequestURI())
+		s.SetAttr("http.user_agent", r.UserAgent())
+		s.SetAttr("http.request_id", requestID(r.Context()))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(ctx))
+		s.SetAttr("http.status_code", rec.status)
+		if rec.status >= 500 {
+			s.err = http.StatusText(rec.status)
+		}
+		s.End()
+	})
+}
+
+// spanExporter batches finished spans and posts them to the collector.
+// The spans channel is never closed: requests still running during a
+// shutdown end their spans after Stop, which are then dropped.
+type spanExporter struct {
+	url   string
+	spans chan *span
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newSpanExporter(endpoint string) *spanExporter {
+	e := &spanExporter{
+		url:   strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		spans: make(chan *span, TraceQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *spanExporter) export(s *span) {
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+	select {
+	case e.spans <- s:
+	default:
+		slog.Warn("Trace queue full, dropping span", "span", s.name)
+	}
+}
+
+func (e *spanExporter) run() {
+	defer close(e.done)
+	var batch []*span
+	ticker := time.NewTicker(TraceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= TraceBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		case <-e.stop:
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+				default:
+					e.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// Stop flushes all pending spans. Spans ending later are dropped.
+func (e *spanExporter) Stop() {
+	e.once.Do(func() {
+		close(e.stop)
+		<-e.done
+	})
+}
+
+func (e *spanExporter) send(batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(otlpRequest(batch))
+	if err != nil {
+		slog.Error("Unable to encode spans", "spans", len(batch), "err", err)
+		return
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Unable to export spans", "spans", len(batch), "url", e.url, "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		slog.Error("Unable to export spans", "spans", len(batch), "url", e.url, "status", resp.Status)
+	}
+}
+
+// otlpRequest builds an OTLP ExportTraceServiceRequest in its JSON encoding.
+func otlpRequest(batch []*span) map[string]interface{} {
+	spans := make([]interface{}, 0, len(batch))
+	for _, s := range batch {
+		js := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			js["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != "" {
+			js["status"] = map[string]interface{}{"code": 2, "message": s.err}
+		}
+		spans = append(spans, js)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": *otlpService}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "gwiki"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	res := make([]interface{}, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		res = append(res, map[string]interface{}{"key": k, "value": value})
+	}
+	return res
+}
+
+func initTracing() {
+	if *otlpEndpoint == "" {
+		return
+	}
+	tracer = newSpanExporter(*otlpEndpoint)
+	slog.Info("Exporting traces", "url", tracer.url)
+}
+
+func stopTracing() {
+	if tracer != nil {
+		tracer.Stop()
+	}
+}
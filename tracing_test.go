@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestTraceHandler(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct{ Name string }
+				}
+			}
+		}
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Errorf("got invalid request %s: %s", b, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					names = append(names, s.Name)
+				}
+			}
+		}
+	}))
+	defer ts.Close()
+	defer func(e *spanExporter) { tracer = e }(tracer)
+	tracer = newSpanExporter(ts.URL)
+
+	http.HandleFunc("/trace-test/", func(w http.ResponseWriter, r *http.Request) {})
+	h := traceHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, s := startSpan(r.Context(), "child")
+		s.End()
+	}))
+	for _, url := range []string{"/trace-test/a", "/trace-test/b?x=1"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+	}
+	_, late := startSpan(context.Background(), "late")
+	tracer.Stop()
+	tracer.Stop()
+	// a request ending during the shutdown must not panic
+	late.End()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expect := []string{"child", "GET /trace-test/", "child", "GET /trace-test/"}
+	if len(names) != len(expect) {
+		t.Fatalf("got spans %q but expected %q", names, expect)
+	}
+	for i := range expect {
+		if names[i] != expect[i] {
+			t.Errorf("[%d] got span %q but expected %q", i, names[i], expect[i])
+		}
+	}
+}
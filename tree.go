@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TreeNode is a section or page in the content tree.
+type TreeNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Title    string      `json:"title,omitempty"`
+	Draft    bool        `json:"draft,omitempty"`
+	Section  bool        `json:"section,omitempty"`
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// contentTree returns the hierarchy of sections and pages in ContentDir
+// the user of r may view. The title and draft status of a section come
+// from its _index page.
+func contentTree(r *http.Request, drafts bool) *TreeNode {
+	root := &TreeNode{Section: true}
+	sections := map[string]*TreeNode{"": root}
+	var section func(path string) *TreeNode
+	section = func(path string) *TreeNode {
+		if n, ok := sections[path]; ok {
+			return n
+		}
+		parent, name := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent, name = path[:i], path[i+1:]
+		}
+		n := &TreeNode{Name: name, Path: path, Section: true}
+		p := section(parent)
+		p.Children = append(p.Children, n)
+		sections[path] = n
+		return n
+	}
+	for _, info := range visibleInfos(r, index.Pages(drafts)) {
+		dir, name := "", info.Path
+		if i := strings.LastIndex(info.Path, "/"); i >= 0 {
+			dir, name = info.Path[:i], info.Path[i+1:]
+		}
+		s := section(dir)
+		if name == IndexPage {
+			s.Title, s.Draft = info.Title, info.Draft
+			continue
+		}
+		s.Children = append(s.Children, &TreeNode{Name: name, Path: info.Path, Title: info.Title, Draft: info.Draft})
+	}
+	sortTree(root)
+	return root
+}
+
+// sortTree sorts sections before pages and both by name.
+func sortTree(n *TreeNode) {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.Section != b.Section {
+			return a.Section
+		}
+		return a.Name < b.Name
+	})
+	for _, c := range n.Children {
+		sortTree(c)
+	}
+}
+
+// treeHandler serves the content tree as JSON (/api/v1/tree?drafts=true).
+func treeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, contentTree(r, r.FormValue("drafts") == "true"))
+}
+
+// find returns the node at path below n (nil if there is none).
+func (n *TreeNode) find(path string) *TreeNode {
+	if path == n.Path {
+		return n
+	}
+	for _, c := range n.Children {
+		if c.Path == path || c.Section && strings.HasPrefix(path, c.Path+"/") {
+			return c.find(path)
+		}
+	}
+	return nil
+}
+
+// Breadcrumb is a link to a section (or the page itself) above a page.
+type Breadcrumb struct {
+	Title string
+	Path  string
+}
+
+// breadcrumbs returns the path from the top section down to path
+// (e.g. blog > 2024 > post). Titles are taken from the _index pages.
+func breadcrumbs(path string) []Breadcrumb {
+	path = strings.TrimSuffix(path, "/"+IndexPage)
+	if path == "" || path == IndexPage {
+		return nil
+	}
+	segs := strings.Split(path, "/")
+	bs := make([]Breadcrumb, len(segs))
+	for i, seg := range segs {
+		p := strings.Join(segs[:i+1], "/")
+		bs[i] = Breadcrumb{Title: seg, Path: p}
+		if info, ok := index.Get(p + "/" + IndexPage); ok && info.Title != "" {
+			bs[i].Title = info.Title
+		} else if info, ok := index.Get(p); ok && info.Title != "" {
+			bs[i].Title = info.Title
+		}
+	}
+	return bs
+}
+
+func (p *Page) Breadcrumbs() []Breadcrumb {
+	return breadcrumbs(p.Path)
+}
+
+// isSection reports whether there are pages below path.
+func isSection(path string) bool {
+	return index.HasSection(path)
+}
+
+type sectionData struct {
+	Path        string
+	Title       string
+	Breadcrumbs []Breadcrumb
+	Children    []ChildPage
+}
+
+// sectionHandler shows the _index page of a section or a generated
+// listing of its sections and pages if there is none.
+func sectionHandler(w http.ResponseWriter, r *http.Request, path string) {
+	if p, err := loadPage(r.Context(), path+"/"+IndexPage); err == nil {
+		setCacheHeaders(w, r, p)
+		renderLayout(w, "view", p.Path, p.For(r))
+		return
+	}
+	setCacheHeaders(w, r, NewPage(path+"/"+IndexPage))
+	data := sectionData{Path: path, Breadcrumbs: breadcrumbs(path)}
+	data.Title = data.Breadcrumbs[len(data.Breadcrumbs)-1].Title
+	data.Children = sectionChildren(r, path, true)
+	renderLayout(w, "section", path+"/"+IndexPage, data)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// treeString returns n and the nodes below it in one line, e.g.
+// "/[blog/(Blog)[post] about]". Drafts are marked with a "*".
+func treeString(n *TreeNode) string {
+	s := n.Name
+	if n.Section {
+		s += "/"
+	}
+	if n.Title != "" {
+		s += "(" + n.Title + ")"
+	}
+	if n.Draft {
+		s += "*"
+	}
+	if len(n.Children) > 0 {
+		var cs []string
+		for _, c := range n.Children {
+			cs = append(cs, treeString(c))
+		}
+		s += "[" + strings.Join(cs, " ") + "]"
+	}
+	return s
+}
+
+func TestContentTree(t *testing.T) {
+	testSetup(t)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "acl"), []byte("secret/** view=alice\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(a string) { *aclFile = a }(*aclFile)
+	*aclFile = filepath.Join(dir, "acl")
+	acls = &aclTable{}
+	defer func() { acls = &aclTable{} }()
+	r := httptest.NewRequest("POST", "/save/", nil)
+	for _, this := range []struct {
+		path, title string
+		draft       bool
+	}{
+		{IndexPage, "Home", false},
+		{"about", "About", false},
+		{"blog/" + IndexPage, "Blog", false},
+		{"blog/2024/post", "A Post", false},
+		{"blog/2024/draft", "", true},
+		{"blog/zebra", "", false},
+		{"docs/intro", "Intro", false},
+		{"drafts/" + IndexPage, "Drafts", true},
+		{"secret/plan", "", false},
+	} {
+		p := NewPage(this.path)
+		if this.title != "" {
+			p.FrontMatter["title"] = this.title
+		}
+		if this.draft {
+			p.FrontMatter["draft"] = true
+		}
+		if err := storePage(r, p, NewPage(p.Path), ""); err != nil {
+			t.Fatalf("unable to store %s: %s", this.path, err)
+		}
+	}
+
+	for i, this := range []struct {
+		user   string
+		drafts bool
+		expect string
+	}{
+		{"anonymous", false, "/(Home)[blog/(Blog)[2024/[post(A Post)] zebra] docs/[intro(Intro)] about(About)]"},
+		{"anonymous", true, "/(Home)[blog/(Blog)[2024/[draft* post(A Post)] zebra] docs/[intro(Intro)] drafts/(Drafts)* about(About)]"},
+		{"alice", false, "/(Home)[blog/(Blog)[2024/[post(A Post)] zebra] docs/[intro(Intro)] secret/[plan] about(About)]"},
+	} {
+		tree := contentTree(withUser(httptest.NewRequest("GET", "/api/v1/tree", nil), this.user), this.drafts)
+		if got := treeString(tree); got != this.expect {
+			t.Errorf("[%d] got tree %s but expected %s", i, got, this.expect)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	treeHandler(w, httptest.NewRequest("GET", "/api/v1/tree?drafts=true", nil))
+	var tree TreeNode
+	if err := json.Unmarshal(w.Body.Bytes(), &tree); err != nil {
+		t.Fatalf("got invalid JSON %s: %s", w.Body, err)
+	}
+	if n := tree.find("blog/2024/draft"); n == nil || !n.Draft || n.Section {
+		t.Errorf("got node %v for blog/2024/draft", n)
+	}
+	if n := tree.find("blog/2024"); n == nil || !n.Section || len(n.Children) != 2 {
+		t.Errorf("got node %v for blog/2024", n)
+	}
+	if n := tree.find("blog/2025"); n != nil {
+		t.Errorf("got node %v for a missing section", n)
+	}
+
+	for i, this := range []struct {
+		path   string
+		expect []Breadcrumb
+	}{
+		{IndexPage, nil},
+		{"about", []Breadcrumb{{"About", "about"}}},
+		{"blog/" + IndexPage, []Breadcrumb{{"Blog", "blog"}}},
+		{"blog/2024/post", []Breadcrumb{{"Blog", "blog"}, {"2024", "blog/2024"}, {"A Post", "blog/2024/post"}}},
+	} {
+		if got := breadcrumbs(this.path); !reflect.DeepEqual(got, this.expect) {
+			t.Errorf("[%d] got breadcrumbs %v of %s but expected %v", i, got, this.path, this.expect)
+		}
+	}
+	if !isSection("blog/2024") || isSection("about") || isSection("blog/2025") {
+		t.Errorf("got the wrong sections")
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flowdev/gwiki/parser"
+	"golang.org/x/image/draw"
+)
+
+var uploadPoliciesFile = flag.String("upload-policies", "./gwiki-uploads.toml", "file with upload rules per section (TOML, YAML or JSON)")
+
+// Upload targets: attachments are stored next to the page (a Hugo page
+// bundle) or in the static directory of the site below the same path.
+const (
+	TargetBundle = "bundle"
+	TargetStatic = "static"
+)
+
+const (
+	ImageMaxWidth = 2048
+	ImageQuality  = 85
+)
+
+// UploadPolicy restricts the uploads of a section.
+type UploadPolicy struct {
+	Section       string
+	MaxSize       int64
+	Types         []string // allowed MIME types like "image/*" (empty allows all)
+	Target        string
+	Images        bool // downscale and re-encode JPEG and PNG images (removes metadata)
+	ImageMaxWidth int
+	ImageQuality  int
+}
+
+var defaultUploadPolicy = &UploadPolicy{MaxSize: MaxUploadSize, Target: TargetBundle}
+
+var uploadPolicies []*UploadPolicy // longest section first
+
+// loadUploadPolicies reads the upload policy file. A missing file means
+// the default policy for all sections.
+//
+//	[sections.photos]
+//	maxSize = "20MB"
+//	types = ["image/jpeg", "image/png"]
+//	target = "static"
+//	images = true
+//	imageMaxWidth = 1600
+func loadUploadPolicies(fn string) ([]*UploadPolicy, error) {
+	data, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	switch filepath.Ext(fn) {
+	case ".json":
+		raw, err = parser.HandleJSONMetaData(data)
+	case ".yaml", ".yml":
+		raw, err = parser.HandleYAMLMetaData(data)
+	default:
+		raw, err = parser.HandleTOMLMetaData(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse upload policies '%s': %s", fn, err)
+	}
+	sections, _ := lowerKeys(raw)["sections"].(map[string]interface{})
+	var ps []*UploadPolicy
+	for section, v := range sections {
+		m, _ := v.(map[string]interface{})
+		p := &UploadPolicy{
+			Section:       strings.Trim(section, "/"),
+			MaxSize:       MaxUploadSize,
+			Types:         toStrings(m["types"]),
+			Target:        toString(m["target"]),
+			Images:        m["images"] == true,
+			ImageMaxWidth: toInt(m["imagemaxwidth"]),
+			ImageQuality:  toInt(m["imagequality"]),
+		}
+		if s := toString(m["maxsize"]); s != "" {
+			if p.MaxSize, err = parseSize(s); err != nil {
+				return nil, fmt.Errorf("invalid upload policy of section '%s': %s", section, err)
+			}
+		}
+		switch p.Target {
+		case "":
+			p.Target = TargetBundle
+		case TargetBundle, TargetStatic:
+		default:
+			return nil, fmt.Errorf("invalid upload policy of section '%s': unknown target '%s'", section, p.Target)
+		}
+		if p.ImageMaxWidth <= 0 {
+			p.ImageMaxWidth = ImageMaxWidth
+		}
+		if p.ImageQuality <= 0 || p.ImageQuality > 100 {
+			p.ImageQuality = ImageQuality
+		}
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return len(ps[i].Section) > len(ps[j].Section) })
+	return ps, nil
+}
+
+// parseSize parses sizes like "512KB", "20MB" or "1048576".
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return n * mult, nil
+}
+
+func initUploadPolicies() {
+	var err error
+	if uploadPolicies, err = loadUploadPolicies(*uploadPoliciesFile); err != nil {
+		fatal("Unable to read upload policies", "err", err)
+	}
+}
+
+// uploadPolicy returns the policy for attachments in dir (relative to the
+// content directory); the one of the nearest section wins.
+func uploadPolicy(dir string) *UploadPolicy {
+	for _, p := range uploadPolicies {
+		if dir == p.Section || strings.HasPrefix(dir, p.Section+"/") {
+			return p
+		}
+	}
+	return defaultUploadPolicy
+}
+
+// attachmentRoot returns the directory attachments of dir are stored below.
+func attachmentRoot(dir string) string {
+	if uploadPolicy(dir).Target == TargetStatic {
+		return filepath.Join(*siteDir, "static")
+	}
+	return *contentDir
+}
+
+// Accept returns the allowed types for the accept attribute of file inputs.
+func (p *UploadPolicy) Accept() string {
+	return strings.Join(p.Types, ",")
+}
+
+// Allows reports whether the MIME type t matches the allowed types.
+func (p *UploadPolicy) Allows(t string) bool {
+	if len(p.Types) == 0 {
+		return true
+	}
+	t, _, _ = mime.ParseMediaType(t)
+	for _, a := range p.Types {
+		if a == t || strings.HasSuffix(a, "/*") && strings.HasPrefix(t, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadType detects the MIME type of an upload from its content; the file
+// name only refines generic results (e.g. for SVG or CSV), so a text file
+// named like an image isn't taken for one.
+func uploadType(name string, head []byte) string {
+	t := http.DetectContentType(head)
+	et := mime.TypeByExtension(path.Ext(name))
+	switch strings.SplitN(t, ";", 2)[0] {
+	case "text/plain":
+		if strings.HasPrefix(et, "text/") {
+			return et
+		}
+	case "text/xml":
+		if strings.HasSuffix(et, "xml") {
+			return et
+		}
+	case "application/octet-stream":
+		if et != "" && !strings.HasPrefix(et, "image/") && !strings.HasPrefix(et, "text/") {
+			return et
+		}
+	}
+	return t
+}
+
+// checkUpload checks an upload of size bytes against the policy and returns
+// a reader for its content (processed if it's an image).
+func (p *UploadPolicy) checkUpload(name string, size int64, r io.Reader) (io.Reader, error) {
+	if size > p.MaxSize {
+		return nil, fmt.Errorf("'%s' is larger than %d bytes", name, p.MaxSize)
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	t := uploadType(name, head)
+	if !p.Allows(t) {
+		return nil, fmt.Errorf("files of type '%s' aren't allowed here", t)
+	}
+	r = io.MultiReader(bytes.NewReader(head), r)
+	if p.Images && (t == "image/jpeg" || t == "image/png") {
+		return p.processImage(r, t)
+	}
+	return r, nil
+}
+
+// processImage downscales images wider than ImageMaxWidth and re-encodes
+// them, which also removes their metadata (e.g. GPS positions).
+func (p *UploadPolicy) processImage(r io.Reader, t string) (io.Reader, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image: %s", err)
+	}
+	if t == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	if b := img.Bounds(); b.Dx() > p.ImageMaxWidth {
+		h := b.Dy() * p.ImageMaxWidth / b.Dx()
+		dst := image.NewRGBA(image.Rect(0, 0, p.ImageMaxWidth, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+		img = dst
+	}
+	var buf bytes.Buffer
+	if t == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.ImageQuality})
+	}
+	return &buf, err
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG image (1 if it
+// has none).
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker, size := data[i+1], int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 {
+			break
+		}
+		end := i + 2 + size
+		if end > len(data) {
+			end = len(data)
+		}
+		seg := data[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifOrientation(seg[6:])
+		}
+		if marker == 0xDA { // start of scan
+			break
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder = binary.BigEndian
+	if string(tiff[:2]) == "II" {
+		bo = binary.LittleEndian
+	}
+	ifd := int(bo.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(bo.Uint16(tiff[ifd:]))
+	for e := ifd + 2; e+12 <= len(tiff) && n > 0; e, n = e+12, n-1 {
+		if bo.Uint16(tiff[e:]) == 0x0112 {
+			return int(bo.Uint16(tiff[e+8:]))
+		}
+	}
+	return 1
+}
+
+// orient rotates img upright according to the EXIF orientation o (mirrored
+// orientations are only rotated).
+func orient(img image.Image, o int) image.Image {
+	var turns int
+	switch o {
+	case 3, 4:
+		turns = 2
+	case 6, 5:
+		turns = 1
+	case 8, 7:
+		turns = 3
+	default:
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var dst *image.RGBA
+	if turns == 2 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			switch turns {
+			case 1: // clockwise
+				dst.Set(h-1-y, x, c)
+			case 2:
+				dst.Set(w-1-x, h-1-y, c)
+			case 3:
+				dst.Set(y, w-1-x, c)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadPolicies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwiki-uploads")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "uploads.toml")
+	err = ioutil.WriteFile(fn, []byte(`
+[sections.photos]
+maxSize = "1KB"
+types = ["image/*"]
+target = "static"
+images = true
+imageMaxWidth = 4
+
+[sections."docs/specs"]
+types = ["application/pdf", "text/csv"]
+`), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ps, err := loadUploadPolicies(fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(ps []*UploadPolicy) { uploadPolicies = ps }(uploadPolicies)
+	uploadPolicies = ps
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 2)))
+	for i, this := range []struct {
+		dir, name string
+		content   []byte
+		expectErr string
+		expectW   int
+	}{
+		{"", "a.exe", []byte("MZ\x90\x00"), "", 0},
+		{"photos/2025", "a.png", img.Bytes(), "", 4},
+		{"photos", "a.png", bytes.Repeat([]byte("x"), 2000), "larger", 0},
+		{"photos", "a.png", []byte("not an image"), "type 'text/plain", 0},
+		{"docs/specs", "a.csv", []byte("a,b\n1,2\n"), "", 0},
+		{"docs/specs/x", "a.pdf", []byte("%PDF-1.4"), "", 0},
+		{"docs/specs", "a.png", img.Bytes(), "type 'image/png'", 0},
+	} {
+		r, err := uploadPolicy(this.dir).checkUpload(this.name, int64(len(this.content)), bytes.NewReader(this.content))
+		if this.expectErr != "" {
+			if err == nil || !strings.Contains(err.Error(), this.expectErr) {
+				t.Errorf("[%d] got error %v but expected %q", i, err, this.expectErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(r)
+		if this.expectW == 0 {
+			if !bytes.Equal(b, this.content) {
+				t.Errorf("[%d] got changed content %q", i, b)
+			}
+			continue
+		}
+		if c, err := png.DecodeConfig(bytes.NewReader(b)); err != nil || c.Width != this.expectW {
+			t.Errorf("[%d] got width %d (%v) but expected %d", i, c.Width, err, this.expectW)
+		}
+	}
+	if got := attachmentRoot("photos"); got != filepath.Join(*siteDir, "static") {
+		t.Errorf("got root %q for photos", got)
+	}
+	if got := attachmentRoot("docs"); got != ContentDir {
+		t.Errorf("got root %q for docs", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	img.Pix[0] = 255 // top left
+	for i, this := range []struct {
+		o          int
+		w, h, x, y int
+	}{
+		{1, 3, 2, 0, 0},
+		{6, 2, 3, 1, 0},
+		{3, 3, 2, 2, 1},
+		{8, 2, 3, 0, 2},
+	} {
+		got := orient(img, this.o)
+		b := got.Bounds()
+		if b.Dx() != this.w || b.Dy() != this.h {
+			t.Errorf("[%d] got size %dx%d but expected %dx%d", i, b.Dx(), b.Dy(), this.w, this.h)
+		}
+		if r, _, _, _ := got.At(this.x, this.y).RGBA(); r == 0 {
+			t.Errorf("[%d] expected the top left pixel at %d,%d", i, this.x, this.y)
+		}
+	}
+}
+
+func TestFileHandler(t *testing.T) {
+	testSetup(t)
+	for _, name := range []string{"notes/photo.png", "notes/evil.html", "notes/evil.svg", "notes/agenda.pdf"} {
+		if err := content.WriteFile(name, []byte("data")); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	for i, this := range []struct {
+		url, disposition string
+	}{
+		{"/files/notes/photo.png", ""},
+		{"/files/notes/evil.html", "attachment"},
+		{"/files/notes/evil.svg", "attachment"},
+		{"/files/notes/agenda.pdf", "attachment"},
+	} {
+		w := httptest.NewRecorder()
+		fileHandler(w, httptest.NewRequest("GET", this.url, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("[%d] got status %d", i, w.Code)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != this.disposition {
+			t.Errorf("[%d] got Content-Disposition %q but expected %q", i, got, this.disposition)
+		}
+		if got := w.Header().Get("Content-Security-Policy"); got != "sandbox" {
+			t.Errorf("[%d] got Content-Security-Policy %q", i, got)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/flowdev/gwiki/parser"
+	"golang.org/x/net/webdav"
+)
+
+// The content directory can be mounted as network drive over WebDAV
+// (/dav/) to edit pages in local editors. Requests go through the same
+// login and ACL file as the web pages. Pages are validated like in the
+// editor before they are saved, other files are stored as attachments
+// with the upload policy of their directory. Hidden files aren't shown.
+var webdavEnabled = flag.Bool("webdav", false, "serve the content directory over WebDAV at /dav/")
+
+const DAVPrefix = "/dav"
+
+var davLocks = webdav.NewMemLS()
+
+var errNotEmpty = errors.New("directory isn't empty")
+
+func initWebDAV() {
+	if !*webdavEnabled {
+		return
+	}
+	if *storageName != "fs" {
+		fatal("WebDAV needs the fs storage", "storage", *storageName)
+	}
+	http.HandleFunc(DAVPrefix+"/", davHandler)
+}
+
+// isDAV reports whether r is a WebDAV request that can't be sent by forms
+// of other websites (browsers preflight the other methods).
+func isDAV(r *http.Request) bool {
+	return *webdavEnabled && strings.HasPrefix(r.URL.Path, DAVPrefix+"/") && r.Method != http.MethodPost
+}
+
+// davHandler serves /dav/. Pages are validated before the WebDAV handler
+// takes them, so clients get the reason of a refused PUT.
+func davHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		http.Error(w, "POST isn't supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, Suffix) {
+		r.Body = http.MaxBytesReader(w, r.Body, *maxPageSize)
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if name, err := davName(strings.TrimPrefix(r.URL.Path, DAVPrefix)); err == nil {
+			if _, _, err = davPage(r, strings.TrimSuffix(name, Suffix), b); err != nil {
+				logger(r.Context()).Info("Invalid page", "path", name, "err", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+	h := &webdav.Handler{
+		Prefix:     DAVPrefix,
+		FileSystem: &davFS{r: r},
+		LockSystem: davLocks,
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger(r.Context()).Warn("WebDAV request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+			}
+		},
+	}
+	h.ServeHTTP(w, r)
+}
+
+// davName returns the name in the content FS of the WebDAV path name.
+func davName(name string) (string, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return ".", nil
+	}
+	for _, s := range strings.Split(name, "/") {
+		if strings.HasPrefix(s, ".") {
+			return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return name, nil
+}
+
+// davPage returns the page at path with the raw content b and the page it
+// replaces if it can be saved.
+func davPage(r *http.Request, path string, b []byte) (*Page, *Page, error) {
+	if !isValidPath(path) {
+		return nil, nil, fmt.Errorf("%w '%s'", ErrInvalidPath, path)
+	}
+	pg, err := parser.ReadFrom(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, err
+	}
+	md, err := pg.Metadata()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing front matter: %s", err)
+	}
+	m, ok := md.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("no front matter")
+	}
+	p := &Page{Path: path, Mark: mark(pg.FrontMatter()), Body: pg.Content(), FrontMatter: m}
+	old, err := loadPage(r.Context(), path)
+	if err != nil {
+		old = NewPage(path)
+	}
+	if err = checkPage(old, p); err != nil {
+		return nil, nil, err
+	}
+	return p, old, nil
+}
+
+// davFS is the content FS for the WebDAV request r.
+type davFS struct {
+	r *http.Request
+}
+
+// allowed checks the ACL file for name.
+func (d *davFS) allowed(name string, edit bool) bool {
+	if name == "." {
+		return !edit
+	}
+	return acls.Allowed(currentUser(d.r), strings.TrimSuffix(name, Suffix), edit)
+}
+
+func (d *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	n, err := davName(name)
+	if err != nil {
+		return err
+	}
+	if !isValidPath(n) {
+		return &fs.PathError{Op: "mkdir", Path: n, Err: ErrInvalidPath}
+	}
+	if !d.allowed(n, true) {
+		return &fs.PathError{Op: "mkdir", Path: n, Err: fs.ErrPermission}
+	}
+	return content.Mkdir(n)
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	n, err := davName(name)
+	if err != nil {
+		return nil, err
+	}
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if !d.allowed(n, write) {
+		return nil, &fs.PathError{Op: "open", Path: n, Err: fs.ErrPermission}
+	}
+	if !write {
+		f, err := content.Open(n)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(n, Suffix) && !isEditor(d.r) {
+			if f, err = redactedPageFile(d.r, f, n); err != nil {
+				return nil, err
+			}
+		}
+		return &davFile{File: f, name: n, fs: d}, nil
+	}
+	if fi, err := content.Stat(path.Dir(n)); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: n, Err: fs.ErrInvalid}
+	}
+	max := *maxPageSize
+	if !strings.HasSuffix(n, Suffix) {
+		if !validAttachmentName.MatchString(path.Base(n)) {
+			return nil, &fs.PathError{Op: "open", Path: n, Err: fmt.Errorf("invalid attachment name")}
+		}
+		max = uploadPolicy(attachmentDir(n)).MaxSize
+	}
+	return &davWriter{name: n, max: max, fs: d}, nil
+}
+
+func (d *davFS) RemoveAll(ctx context.Context, name string) error {
+	n, err := davName(name)
+	if err != nil {
+		return err
+	}
+	if !d.allowed(n, true) {
+		return &fs.PathError{Op: "remove", Path: n, Err: fs.ErrPermission}
+	}
+	fi, err := content.Stat(n)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.IsDir():
+		if des, err := content.ReadDir(n); err != nil {
+			return err
+		} else if len(des) > 0 {
+			return &fs.PathError{Op: "remove", Path: n, Err: errNotEmpty}
+		}
+		return content.Remove(n)
+	case strings.HasSuffix(n, Suffix):
+		return deletePage(d.r, strings.TrimSuffix(n, Suffix))
+	default:
+		dir := attachmentDir(n)
+		if err = keepVersion(dir, path.Base(n)); err != nil {
+			return err
+		}
+		if err = content.Remove(n); err != nil {
+			return err
+		}
+		audit(d.r, "delete-attachment", n)
+		return nil
+	}
+}
+
+func (d *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	from, err := davName(oldName)
+	if err != nil {
+		return err
+	}
+	to, err := davName(newName)
+	if err != nil {
+		return err
+	}
+	if !d.allowed(from, true) || !d.allowed(to, true) {
+		return &fs.PathError{Op: "rename", Path: from, Err: fs.ErrPermission}
+	}
+	fi, err := content.Stat(from)
+	if err != nil {
+		return err
+	}
+	isPage := strings.HasSuffix(from, Suffix)
+	if fi.IsDir() || isPage != strings.HasSuffix(to, Suffix) {
+		return &fs.PathError{Op: "rename", Path: from, Err: fs.ErrInvalid}
+	}
+	if isPage {
+		from, to = strings.TrimSuffix(from, Suffix), strings.TrimSuffix(to, Suffix)
+		if err = renamePage(d.r, from, to, nil, true); err != nil {
+			return err
+		}
+		audit(d.r, "rename", from+" -> "+to)
+		return nil
+	}
+	if !validAttachmentName.MatchString(path.Base(to)) {
+		return &fs.PathError{Op: "rename", Path: to, Err: fmt.Errorf("invalid attachment name")}
+	}
+	if err = content.Rename(from, to); err != nil {
+		return err
+	}
+	audit(d.r, "rename-attachment", from+" -> "+to)
+	return nil
+}
+
+func (d *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	n, err := davName(name)
+	if err != nil {
+		return nil, err
+	}
+	if !d.allowed(n, false) {
+		return nil, &fs.PathError{Op: "stat", Path: n, Err: fs.ErrNotExist}
+	}
+	return content.Stat(n)
+}
+
+// save stores the content b of the file name written over WebDAV.
+func (d *davFS) save(name string, b []byte) error {
+	if strings.HasSuffix(name, Suffix) {
+		p, old, err := davPage(d.r, strings.TrimSuffix(name, Suffix), b)
+		if err != nil {
+			return err
+		}
+		return storePage(d.r, p, old, "")
+	}
+	dir, base := attachmentDir(name), path.Base(name)
+	r, err := uploadPolicy(dir).checkUpload(base, int64(len(b)), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	if err = saveAttachment(dir, base, r); err != nil {
+		return err
+	}
+	audit(d.r, "upload", name)
+	return nil
+}
+
+// redactedFile is a page without the private content, see sourceFor.
+type redactedFile struct {
+	*bytes.Reader
+	fi fs.FileInfo
+}
+
+func (f *redactedFile) Stat() (fs.FileInfo, error) {
+	return redactedInfo{FileInfo: f.fi, size: f.Size()}, nil
+}
+
+func (f *redactedFile) Close() error {
+	return nil
+}
+
+type redactedInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi redactedInfo) Size() int64 {
+	return fi.size
+}
+
+// redactedPageFile returns the page file f opened as name as the user of r
+// may see it. f is closed.
+func redactedPageFile(r *http.Request, f fs.File, name string) (fs.File, error) {
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return content.Open(name)
+	}
+	b, err := io.ReadAll(f)
+	if err == nil {
+		b, err = sourceFor(r, strings.TrimSuffix(name, Suffix), b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &redactedFile{Reader: bytes.NewReader(b), fi: fi}, nil
+}
+
+// davFile is a file or directory opened for reading.
+type davFile struct {
+	fs.File
+	name string
+	fs   *davFS
+	des  []fs.DirEntry // not read yet by Readdir, nil before the first call
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+}
+
+// Readdir returns the entries the user may see.
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.des == nil {
+		des, err := content.ReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.des = []fs.DirEntry{}
+		for _, de := range des {
+			if n := path.Join(f.name, de.Name()); !strings.HasPrefix(de.Name(), ".") && f.fs.allowed(n, false) {
+				f.des = append(f.des, de)
+			}
+		}
+	}
+	if count > 0 && len(f.des) == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > len(f.des) {
+		count = len(f.des)
+	}
+	fis := []os.FileInfo{}
+	for _, de := range f.des[:count] {
+		fi, err := de.Info()
+		if err != nil {
+			return fis, err
+		}
+		fis = append(fis, fi)
+	}
+	f.des = f.des[count:]
+	return fis, nil
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+// davWriter collects the content of a file written over WebDAV and saves
+// it on Close.
+type davWriter struct {
+	name string
+	max  int64
+	fs   *davFS
+	buf  bytes.Buffer
+}
+
+func (w *davWriter) Write(p []byte) (int, error) {
+	if int64(w.buf.Len()+len(p)) > w.max {
+		return 0, fmt.Errorf("'%s' is larger than %d bytes", w.name, w.max)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *davWriter) Close() error {
+	return w.fs.save(w.name, w.buf.Bytes())
+}
+
+func (w *davWriter) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: w.name, Err: fs.ErrInvalid}
+}
+
+func (w *davWriter) Seek(offset int64, whence int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: w.name, Err: fs.ErrInvalid}
+}
+
+func (w *davWriter) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: w.name, Err: fs.ErrInvalid}
+}
+
+func (w *davWriter) Stat() (os.FileInfo, error) {
+	return davFileInfo{name: path.Base(w.name), size: int64(w.buf.Len())}, nil
+}
+
+// davFileInfo describes a file that is being written.
+type davFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi davFileInfo) Name() string       { return fi.name }
+func (fi davFileInfo) Size() int64        { return fi.size }
+func (fi davFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi davFileInfo) ModTime() time.Time { return time.Now() }
+func (fi davFileInfo) IsDir() bool        { return false }
+func (fi davFileInfo) Sys() interface{}   { return nil }
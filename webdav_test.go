@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDavName(t *testing.T) {
+	for i, this := range []struct {
+		name, expect string
+	}{
+		{"/", "."},
+		{"", "."},
+		{"/docs/intro.md", "docs/intro.md"},
+		{"/docs/../../etc/passwd", "etc/passwd"},
+		{"/docs/.git/config", ""},
+		{"/.hidden.md", ""},
+	} {
+		got, err := davName(this.name)
+		if this.expect == "" && err == nil || this.expect != "" && got != this.expect {
+			t.Errorf("[%d] got %q (err: %v) but expected %q", i, got, err, this.expect)
+		}
+	}
+}
+
+func TestDavHandler(t *testing.T) {
+	defer func(c ContentFS, s Storage) { content, store = c, s }(content, store)
+	content = newMemFS()
+	store = &fsStorage{fsys: content}
+	for name, s := range map[string]string{
+		"docs/intro.md": "+++\ntitle = \"Intro\"\n+++\nhello\n",
+		"docs/.secret":  "hidden",
+		"docs/logo.png": "png",
+	} {
+		content.WriteFile(name, []byte(s))
+	}
+	for i, this := range []struct {
+		method, url, body string
+		expectCode        int
+		expectBody        string
+	}{
+		{"GET", "/dav/docs/intro.md", "", http.StatusOK, "hello"},
+		{"GET", "/dav/docs/.secret", "", http.StatusNotFound, ""},
+		{"PROPFIND", "/dav/docs/", "", http.StatusMultiStatus, "/dav/docs/logo.png"},
+		{"PUT", "/dav/docs/bad.md", "+++\ntitle = \n+++\n", http.StatusBadRequest, "front matter"},
+		{"PUT", "/dav/docs/in%20valid.md", "+++\n+++\n", http.StatusBadRequest, "invalid page path"},
+		{"POST", "/dav/docs/intro.md", "", http.StatusMethodNotAllowed, ""},
+	} {
+		r := httptest.NewRequest(this.method, this.url, strings.NewReader(this.body))
+		r.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		davHandler(w, r)
+		if w.Code != this.expectCode {
+			t.Errorf("[%d] got code %d but expected %d", i, w.Code, this.expectCode)
+		}
+		if !strings.Contains(w.Body.String(), this.expectBody) {
+			t.Errorf("[%d] got %q but expected it to contain %q", i, w.Body.String(), this.expectBody)
+		}
+		if strings.Contains(w.Body.String(), ".secret") {
+			t.Errorf("[%d] got hidden file in %q", i, w.Body.String())
+		}
+	}
+}
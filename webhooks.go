@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flowdev/gwiki/parser"
+)
+
+// Webhooks are posted on content events so CI pipelines and chat bots can
+// react to edits. The JSON payload is signed with the secret of the hook
+// (HMAC-SHA256 in the X-Gwiki-Signature header).
+var webhooksFile = flag.String("webhooks", "./gwiki-webhooks.toml", "file with outgoing webhooks (TOML, YAML or JSON)")
+
+const (
+	WebhookSignatureHeader = "X-Gwiki-Signature"
+	WebhookEventHeader     = "X-Gwiki-Event"
+	WebhookAttempts        = 3
+)
+
+// webhookEvents are the audit actions sent to webhooks.
+var webhookEvents = map[string]bool{"save": true, "delete": true, "rename": true, "publish": true}
+
+// Webhook is an URL events are posted to.
+type Webhook struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []string // empty for all
+}
+
+// WebhookEvent is the payload of a webhook request.
+type WebhookEvent struct {
+	Event     string        `json:"event"`
+	Time      time.Time     `json:"time"`
+	User      string        `json:"user"`
+	Path      string        `json:"path,omitempty"`
+	From      string        `json:"from,omitempty"` // old path of renamed pages
+	Summary   string        `json:"summary,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"` // changed front matter fields
+	RequestID string        `json:"requestID,omitempty"`
+}
+
+var webhooks []*Webhook
+
+// loadWebhooks reads the webhooks file. A missing file means no webhooks.
+//
+//	[webhooks.deploy]
+//	url = "https://ci.example.com/hooks/gwiki"
+//	secret = "s3cret"
+//	events = ["save", "publish"]
+func loadWebhooks(fn string) ([]*Webhook, error) {
+	data, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	switch filepath.Ext(fn) {
+	case ".json":
+		raw, err = parser.HandleJSONMetaData(data)
+	case ".yaml", ".yml":
+		raw, err = parser.HandleYAMLMetaData(data)
+	default:
+		raw, err = parser.HandleTOMLMetaData(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse webhooks '%s': %s", fn, err)
+	}
+	hooks, _ := lowerKeys(raw)["webhooks"].(map[string]interface{})
+	var whs []*Webhook
+	for name, v := range hooks {
+		m, _ := v.(map[string]interface{})
+		wh := &Webhook{Name: name, URL: toString(m["url"]), Secret: toString(m["secret"]), Events: toStrings(m["events"])}
+		if !strings.HasPrefix(wh.URL, "http://") && !strings.HasPrefix(wh.URL, "https://") {
+			return nil, fmt.Errorf("invalid webhook '%s': URL '%s' isn't absolute", name, wh.URL)
+		}
+		for _, e := range wh.Events {
+			if !webhookEvents[e] {
+				return nil, fmt.Errorf("invalid webhook '%s': unknown event '%s'", name, e)
+			}
+		}
+		whs = append(whs, wh)
+	}
+	sort.Slice(whs, func(i, j int) bool { return whs[i].Name < whs[j].Name })
+	return whs, nil
+}
+
+func initWebhooks() {
+	var err error
+	if webhooks, err = loadWebhooks(*webhooksFile); err != nil {
+		fatal("Unable to read webhooks", "err", err)
+	}
+}
+
+// Wants reports whether the webhook subscribed to event.
+func (wh *Webhook) Wants(event string) bool {
+	return len(wh.Events) == 0 || contains(wh.Events, event)
+}
+
+// webhookEvent returns the payload for the audit entry e.
+func webhookEvent(e *AuditEntry) *WebhookEvent {
+	ev := &WebhookEvent{Event: e.Action, Time: e.Time, User: e.User, Path: e.Path, Summary: e.Summary, Changes: e.Changes, RequestID: e.RequestID}
+	if from, to, ok := strings.Cut(e.Path, " -> "); ok && e.Action == "rename" {
+		ev.From, ev.Path = from, to
+	}
+	return ev
+}
+
+// webhookSignature returns the signature of body for secret.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// fireWebhooks posts the audit entry e to all webhooks subscribed to its
+// action in the background.
+func fireWebhooks(e *AuditEntry) {
+	if !webhookEvents[e.Action] {
+		return
+	}
+	var b []byte
+	for _, wh := range webhooks {
+		if !wh.Wants(e.Action) {
+			continue
+		}
+		if b == nil {
+			b, _ = json.Marshal(webhookEvent(e))
+		}
+		wh := wh
+		goBackground(func() { sendWebhook(wh, e.Action, b) })
+	}
+}
+
+// sendWebhook posts body to wh and retries failed requests.
+func sendWebhook(wh *Webhook, event string, body []byte) {
+	client := http.Client{Timeout: 10 * time.Second}
+	var err error
+	for i := 0; i < WebhookAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(time.Duration(i) * time.Second):
+			case <-appCtx.Done():
+				return
+			}
+		}
+		if err = postWebhook(&client, wh, event, body); err == nil {
+			return
+		}
+	}
+	slog.Error("Unable to post webhook", "webhook", wh.Name, "event", event, "err", err)
+}
+
+func postWebhook(client *http.Client, wh *Webhook, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(appCtx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event)
+	if wh.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, webhookSignature(wh.Secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
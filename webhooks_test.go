@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadWebhooks(t *testing.T) {
+	dir := t.TempDir()
+	for i, this := range []struct {
+		config string
+		expect []*Webhook
+		err    bool
+	}{
+		{`[webhooks.deploy]
+url = "https://ci.example.com/hook"
+secret = "s3cret"
+events = ["save", "publish"]
+
+[webhooks.Chat]
+url = "http://chat/hook"
+`, []*Webhook{
+			{Name: "chat", URL: "http://chat/hook"},
+			{Name: "deploy", URL: "https://ci.example.com/hook", Secret: "s3cret", Events: []string{"save", "publish"}},
+		}, false},
+		{"[webhooks.a]\nurl = \"/hook\"\n", nil, true},
+		{"[webhooks.a]\nurl = \"http://a\"\nevents = [\"upload\"]\n", nil, true},
+	} {
+		fn := filepath.Join(dir, "webhooks.toml")
+		if err := ioutil.WriteFile(fn, []byte(this.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadWebhooks(fn)
+		if (err != nil) != this.err {
+			t.Errorf("[%d] got error %v", i, err)
+		}
+		if !reflect.DeepEqual(got, this.expect) {
+			t.Errorf("[%d] got %+v but expected %+v", i, got, this.expect)
+		}
+	}
+	if whs, err := loadWebhooks(filepath.Join(dir, "missing.toml")); whs != nil || err != nil {
+		t.Errorf("got %v, %v for a missing file", whs, err)
+	}
+}
+
+func TestFireWebhooks(t *testing.T) {
+	got := make(chan *http.Request, 2)
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		got <- r
+	}))
+	defer srv.Close()
+	defer func(whs []*Webhook) { webhooks = whs }(webhooks)
+	webhooks = []*Webhook{
+		{Name: "all", URL: srv.URL, Secret: "s3cret"},
+		{Name: "publish", URL: srv.URL, Events: []string{"publish"}},
+	}
+	e := &AuditEntry{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), User: "alice", Action: "rename", Path: "a -> b"}
+	fireWebhooks(&AuditEntry{Action: "upload", Path: "a/x.png"})
+	fireWebhooks(e)
+	background.Wait()
+	if len(got) != 1 {
+		t.Fatalf("got %d requests but expected 1", len(got))
+	}
+	r := <-got
+	if s := r.Header.Get(WebhookSignatureHeader); s != webhookSignature("s3cret", body) {
+		t.Errorf("got signature %q", s)
+	}
+	if ev := r.Header.Get(WebhookEventHeader); ev != "rename" {
+		t.Errorf("got event %q but expected rename", ev)
+	}
+	var ev WebhookEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if expect := (WebhookEvent{Event: "rename", Time: e.Time, User: "alice", Path: "b", From: "a"}); !reflect.DeepEqual(ev, expect) {
+		t.Errorf("got %+v but expected %+v", ev, expect)
+	}
+}
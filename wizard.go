@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The new page wizard (/new) creates a page in steps: section, type (the
+// boilerplate), metadata (title, name and the custom fields of the
+// section) and body. Each step is validated before the next one is shown;
+// the values of the other steps are carried along as hidden fields and
+// checked again.
+var wizardSteps = []string{"section", "type", "metadata", "body"}
+
+const (
+	stepSection = iota
+	stepType
+	stepMetadata
+	stepBody
+)
+
+// wizardInputs are the form fields of each step (prefixes ending in "-").
+var wizardInputs = [][]string{{"section"}, {"boilerplate"}, {"title", "name", "field-"}, {"body"}}
+
+type wizardValue struct {
+	Name  string
+	Value string
+}
+
+type wizardData struct {
+	Steps        []string
+	Step         string
+	Err          string
+	Sections     []string
+	Section      string
+	Boilerplates []string
+	Boilerplate  string
+	Title        string
+	Name         string
+	Page         *Page
+	Hidden       []wizardValue
+}
+
+// wizardSections returns all sections of the wiki.
+func wizardSections() []string {
+	seen := make(map[string]bool)
+	for _, info := range index.Pages(true) {
+		segs := strings.Split(info.Path, "/")
+		for i := 1; i < len(segs); i++ {
+			seen[strings.Join(segs[:i], "/")] = true
+		}
+	}
+	ss := make([]string, 0, len(seen))
+	for s := range seen {
+		ss = append(ss, s)
+	}
+	sort.Strings(ss)
+	return ss
+}
+
+func wizardPath(section, name string) string {
+	if section == "" {
+		return name
+	}
+	return section + "/" + name
+}
+
+// wizardPage checks the steps of the wizard up to step and returns the
+// new page once the metadata is known. On error it returns the step that
+// failed.
+func wizardPage(form url.Values, step int) (*Page, int, error) {
+	section, boilerplate := form.Get("section"), form.Get("boilerplate")
+	if section != "" && !contains(wizardSections(), section) {
+		return nil, stepSection, fmt.Errorf("unknown section '%s'", section)
+	}
+	if step < stepType {
+		return nil, 0, nil
+	}
+	if boilerplate != "" && !contains(listBoilerplates(), boilerplate) {
+		return nil, stepType, fmt.Errorf("unknown type '%s'", boilerplate)
+	}
+	if step < stepMetadata {
+		return nil, 0, nil
+	}
+	title := strings.TrimSpace(form.Get("title"))
+	if title == "" {
+		return nil, stepMetadata, fmt.Errorf("a page needs a title")
+	}
+	name := strings.TrimSpace(form.Get("name"))
+	if name == "" {
+		name = slugify(title)
+	}
+	path := wizardPath(section, name)
+	if !isValidPath(path) {
+		return nil, stepMetadata, fmt.Errorf("invalid page path '%s'", path)
+	}
+	if pageExists(path) {
+		return nil, stepMetadata, fmt.Errorf("page '%s' exists already", path)
+	}
+	p := NewPage(path)
+	if err := applyNewPage(p, boilerplate, time.Now()); err != nil {
+		return nil, stepType, err
+	}
+	p.Boilerplate = boilerplate
+	if _, ok := p.FrontMatter["date"]; !ok {
+		p.FrontMatter["date"] = time.Now().Truncate(24 * time.Hour)
+	}
+	if _, ok := p.FrontMatter["draft"]; !ok {
+		p.FrontMatter["draft"] = true
+	}
+	p.SetTitle(title)
+	p.SetCustomFields(form)
+	if err := validatePage(NewPage(path), p); err != nil {
+		return nil, stepMetadata, err
+	}
+	if _, ok := form["body"]; ok {
+		p.Body = []byte(form.Get("body"))
+	}
+	if step < stepBody {
+		return p, 0, nil
+	}
+	if err := aliases.Check(p); err != nil {
+		return nil, stepBody, err
+	}
+	if err := index.CheckID(p); err != nil {
+		return nil, stepBody, err
+	}
+	return p, 0, nil
+}
+
+// hiddenValues returns the form values not belonging to step.
+func hiddenValues(form url.Values, step int) []wizardValue {
+	var vs []wizardValue
+	for name, values := range form {
+		if name == "step" || name == "back" || isWizardInput(name, step) {
+			continue
+		}
+		for _, v := range values {
+			vs = append(vs, wizardValue{name, v})
+		}
+	}
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].Name < vs[j].Name })
+	return vs
+}
+
+func isWizardInput(name string, step int) bool {
+	for _, in := range wizardInputs[step] {
+		if name == in || strings.HasSuffix(in, "-") && strings.HasPrefix(name, in) {
+			return true
+		}
+	}
+	return false
+}
+
+// newPageHandler serves the wizard (/new): the form of a step is posted
+// with step=<name> and shows the next step (or the previous one with
+// back). It can be started in a section with /new?step=section&section=<s>.
+func newPageHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, *maxPageSize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	show := 0
+	for i, s := range wizardSteps {
+		if s == r.FormValue("step") {
+			show = i + 1
+			if r.FormValue("back") != "" {
+				show = i - 1
+			}
+		}
+	}
+	if show < 0 {
+		show = 0
+	}
+	if show == len(wizardSteps) && r.Method != http.MethodPost {
+		show = stepBody
+	}
+	data := &wizardData{
+		Steps: wizardSteps, Sections: wizardSections(), Boilerplates: listBoilerplates(),
+		Section: r.FormValue("section"), Boilerplate: r.FormValue("boilerplate"),
+		Title: r.FormValue("title"), Name: r.FormValue("name"),
+	}
+	p, failed, err := wizardPage(r.Form, show-1)
+	if err != nil {
+		show = failed
+		data.Err = err.Error()
+	} else if show == len(wizardSteps) {
+		if err = storePage(r, p, NewPage(p.Path), "new page"); err == nil {
+			http.Redirect(w, r, "/view/"+p.Path, http.StatusFound)
+			return
+		}
+		logger(r.Context()).Error("Unable to create page", "path", p.Path, "err", err)
+		show = stepBody
+		data.Err = err.Error()
+	}
+	if show == stepMetadata && p == nil {
+		// only for the custom fields and their defaults
+		p = NewPage(wizardPath(data.Section, "new"))
+		if err := applyNewPage(p, data.Boilerplate, time.Now()); err != nil {
+			data.Err = err.Error()
+		}
+		if _, ok := r.Form["title"]; ok {
+			p.SetCustomFields(r.Form)
+		}
+	}
+	data.Step, data.Page = wizardSteps[show], p
+	data.Hidden = hiddenValues(r.Form, show)
+	renderTemplate(w, "new", data)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestWizardPage(t *testing.T) {
+	defer func(s Storage, pi *pageIndex, sc *Schema) { store, index, schema = s, pi, sc }(store, index, schema)
+	store = newMemoryStorage()
+	index = &pageIndex{pages: make(map[string]*PageInfo), backlinks: make(map[string]map[string]bool), ids: make(map[string]string)}
+	schema = &Schema{Fields: []*Field{{Name: "author", Widget: WidgetSelect, Options: []string{"Alice", "Bob"}, Required: true, Sections: []string{"blog"}}}}
+	if err := store.Save("blog/first", []byte("+++\ntitle = \"First\"\n+++\nText\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Build(); err != nil {
+		t.Fatal(err)
+	}
+	for i, this := range []struct {
+		form       string
+		step       int
+		expectPath string
+		expectStep int // of the error, -1 for none
+	}{
+		{"section=blog", stepSection, "", -1},
+		{"section=nope", stepSection, "", stepSection},
+		{"section=blog&boilerplate=runbook", stepType, "", -1},
+		{"section=blog&boilerplate=unknown", stepType, "", stepType},
+		{"section=blog&boilerplate=&title=Second+Post&field-author=Bob", stepMetadata, "blog/second-post", -1},
+		{"section=blog&title=Second+Post", stepMetadata, "", stepMetadata},
+		{"section=blog&title=Second+Post&field-author=Eve", stepMetadata, "", stepMetadata},
+		{"section=blog&title=Again&name=first&field-author=Bob", stepMetadata, "", stepMetadata},
+		{"section=blog&title=Bad&name=no+spaces&field-author=Bob", stepMetadata, "", stepMetadata},
+		{"section=&title=Top", stepBody, "top", -1},
+		{"section=nope&title=Top", stepBody, "", stepSection},
+	} {
+		form, _ := url.ParseQuery(this.form)
+		p, failed, err := wizardPage(form, this.step)
+		if this.expectStep >= 0 {
+			if err == nil || failed != this.expectStep {
+				t.Errorf("[%d] got error %v in step %d but expected an error in step %d", i, err, failed, this.expectStep)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", i, err)
+			continue
+		}
+		if this.expectPath == "" {
+			if p != nil {
+				t.Errorf("[%d] got page %q but expected none", i, p.Path)
+			}
+		} else if p == nil || p.Path != this.expectPath {
+			t.Errorf("[%d] got page %v but expected %q", i, p, this.expectPath)
+		}
+	}
+
+	form, _ := url.ParseQuery("step=metadata&section=blog&boilerplate=x&title=T&field-author=Bob&body=text")
+	for i, this := range []struct {
+		step   int
+		expect []wizardValue
+	}{
+		{stepSection, []wizardValue{{"body", "text"}, {"boilerplate", "x"}, {"field-author", "Bob"}, {"title", "T"}}},
+		{stepMetadata, []wizardValue{{"body", "text"}, {"boilerplate", "x"}, {"section", "blog"}}},
+		{stepBody, []wizardValue{{"boilerplate", "x"}, {"field-author", "Bob"}, {"section", "blog"}, {"title", "T"}}},
+	} {
+		got := hiddenValues(form, this.step)
+		if len(got) != len(this.expect) {
+			t.Errorf("[%d] got %v but expected %v", i, got, this.expect)
+			continue
+		}
+		for j := range got {
+			if got[j] != this.expect[j] {
+				t.Errorf("[%d] got %v but expected %v", i, got, this.expect)
+				break
+			}
+		}
+	}
+}